@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/approval"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/notify"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// runApprovalCommand implements "approval plan", which prints the plan a run
+// would submit for approval with its hash, and "approval token", which
+// issues an approval token for that plan with the configured token secret.
+// Both need the --run-id the approved run will use, since the plan names it.
+func runApprovalCommand(args []string) int {
+	if len(args) == 0 || (args[0] != "plan" && args[0] != "token") {
+		fmt.Fprintln(os.Stderr, "Usage: crowdstrike-data-collector approval plan|token --run-id id [--reference ticket] [config flags]")
+		return 2
+	}
+
+	flags := config.Flags{}
+	flagSet := flag.NewFlagSet("approval "+args[0], flag.ContinueOnError)
+	registerConfigFlags(flagSet, &flags)
+	flagSet.StringVar(&flags.RunID, "run-id", "", "Run ID the approved run will be started with")
+	reference := flagSet.String("reference", "", "Change ticket or approval reference to issue the token under")
+	if err := flagSet.Parse(args[1:]); err != nil {
+		return parseExitCode(err)
+	}
+
+	if flags.RunID == "" {
+		fmt.Fprintln(os.Stderr, "approval: --run-id is required; start the approved run with the same --run-id")
+		return 2
+	}
+	cfg, err := loadConfig(flags)
+	if err == nil {
+		err = cfg.CheckMetadata()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return 1
+	}
+	if err := checkTargetSource(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	rtrClient, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return 1
+	}
+	if cfg.Target.Hostname != "" || cfg.Target.ByIdentifier() {
+		// Resolving a hostname selector or identifiers needs an authenticated client.
+		if err := rtrClient.Authenticate(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get authentication token: %v\n", err)
+			return 1
+		}
+	}
+	deviceIDs, mappings, err := targets(context.Background(), rtrClient, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	plan := runPlan(rtrClient, cfg, deviceIDs, mappings)
+	if cfg.MinimalPermissions {
+		// The capability set is known without probing: admin commands are
+		// rejected here rather than at run time.
+		caps := rtr.MinimalCapabilities()
+		printCapabilities(caps)
+		if err := checkPlan(caps, plan); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if args[0] == "plan" {
+		out, _ := json.MarshalIndent(plan, "", "  ")
+		fmt.Printf("%s\nPlan hash: %s\n", out, plan.Hash())
+		return 0
+	}
+	if *reference == "" {
+		fmt.Fprintln(os.Stderr, "approval token: --reference is required")
+		return 2
+	}
+	if cfg.Approval.TokenSecret == "" {
+		fmt.Fprintln(os.Stderr, "approval token: approval.token_secret (or APPROVAL_TOKEN_SECRET) is not set")
+		return 1
+	}
+	fmt.Println(approval.Token(cfg.Approval.TokenSecret, *reference, plan.Hash()))
+	return 0
+}
+
+// runPlan describes the collection run: the configured script on the
+// target devices, through the least-privileged endpoint that accepts it,
+// the put of each host's receipt when receipt.path is set, and the sandbox
+// submission of retrieved files when sandbox is enabled.
+func runPlan(rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config, deviceIDs []string, mappings []sink.TargetMapping) *approval.Plan {
+	commandString := rtrClient.ScriptCommand(cfg.ScriptName, rtrClient.ScriptTimeout)
+	plan := &approval.Plan{
+		RunID:       cfg.RunID,
+		DeviceIDs:   deviceIDs,
+		Metadata:    cfg.Metadata(),
+		Targets:     mappings,
+		Concurrency: &cfg.Concurrency,
+		Commands: []approval.Command{{
+			Endpoint:      rtrClient.CommandEndpoint("runscript", commandString),
+			BaseCommand:   "runscript",
+			CommandString: commandString,
+		}},
+	}
+	if cfg.Continuation.TokenPath != "" {
+		continueString := rtrClient.ContinuationCommand(cfg.ScriptName, rtrClient.ScriptTimeout)
+		plan.Commands = append(plan.Commands, approval.Command{
+			Endpoint:      rtrClient.CommandEndpoint("runscript", continueString),
+			BaseCommand:   "runscript",
+			CommandString: continueString,
+		})
+	}
+	// Per-platform runscript steps appear once for each platform they have a
+	// script for.
+	for _, platform := range []string{rtr.PlatformLinux, rtr.PlatformMac, rtr.PlatformWindows} {
+		var stepStrings []string
+		if cfg.Prerequisites.Enabled() {
+			stepStrings = append(stepStrings, resourceProbe(cfg).ProbeCommand(platform))
+		}
+		if cfg.HostClock.Enabled {
+			stepStrings = append(stepStrings, rtr.ClockCommand(platform))
+		}
+		for _, stepString := range stepStrings {
+			if stepString != "" {
+				plan.Commands = append(plan.Commands, approval.Command{
+					Endpoint:      rtrClient.CommandEndpoint("runscript", stepString),
+					BaseCommand:   "runscript",
+					CommandString: stepString,
+				})
+			}
+		}
+	}
+	if cfg.Sandbox.Enabled {
+		plan.Sandbox = &cfg.Sandbox
+	}
+	if rtrClient.NeedsUninstallToken() {
+		plan.Secrets = append(plan.Secrets, "uninstall_token")
+	}
+	if cfg.Receipt.Path != "" {
+		putString := "put " + receiptPrefix + cfg.RunID + "-<device_id>.json"
+		plan.Commands = append(plan.Commands, approval.Command{
+			Endpoint:      rtrClient.CommandEndpoint("put", putString),
+			BaseCommand:   "put",
+			CommandString: putString,
+		})
+	}
+	return plan
+}
+
+// checkPlan fails the run before any session is opened when the plan needs
+// a command endpoint or a secret the capabilities do not allow.
+func checkPlan(caps rtr.Capabilities, plan *approval.Plan) error {
+	for _, command := range plan.Commands {
+		if err := caps.CheckEndpoint(command.Endpoint); err != nil {
+			return withExitCode(exitConfigError, fmt.Errorf("Scope Error: %s needs the %s endpoint: %v", command.BaseCommand, command.Endpoint, err))
+		}
+	}
+	for _, secret := range plan.Secrets {
+		if secret != "uninstall_token" {
+			continue
+		}
+		if err := caps.CheckUninstallTokens(); err != nil {
+			return withExitCode(exitConfigError, fmt.Errorf("Scope Error: script_command_line needs uninstall tokens: %v", err))
+		}
+	}
+	return nil
+}
+
+// detectCapabilities adds the write scopes of the API credentials to caps,
+// the read scopes, and prints the resulting capability set.
+func detectCapabilities(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, caps rtr.Capabilities) (rtr.Capabilities, error) {
+	caps, err := rtrClient.DetectCommandCapabilities(ctx, caps)
+	if err != nil {
+		return caps, fmt.Errorf("Failed to detect API capabilities: %v", err)
+	}
+	printCapabilities(caps)
+	return caps, nil
+}
+
+// printCapabilities lists the scopes in caps and the features they disable.
+func printCapabilities(caps rtr.Capabilities) {
+	mode := ""
+	if caps.Minimal {
+		mode = " (minimal_permissions)"
+	}
+	progress.Printf("Capabilities%s: %s\n", mode, strings.Join(caps.Scopes(), ", "))
+	for _, disabled := range caps.Disabled() {
+		progress.Printf("  Disabled: %s\n", disabled)
+	}
+}
+
+// approve runs the change-control gate on plan, when one is configured, and
+// records the approval reference in summary. It must run before any session
+// is opened; a rejection aborts the run with exitApprovalDenied.
+func approve(ctx context.Context, cfg *config.Config, plan *approval.Plan, summary *notify.Summary) error {
+	gate := approval.NewGate(cfg.Approval)
+	if gate == nil {
+		return nil
+	}
+	gate.Console = progress
+	result, err := gate.Approve(ctx, plan)
+	if err != nil {
+		return withExitCode(exitApprovalDenied, fmt.Errorf("Approval Error: %v. Refusing to run admin commands without change-control approval.", err))
+	}
+	summary.ApprovalReference = result.Reference
+	if result.Reference != "" {
+		progress.Printf("Run approved by %s under %s (plan %s)\n", result.Method, result.Reference, result.PlanHash)
+	} else {
+		progress.Printf("Run approved by %s (plan %s)\n", result.Method, result.PlanHash)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// skipQuarantined skips host when an earlier run's circuit breaker
+// quarantined its device, unless the run was started with
+// --include-quarantined, and reports whether it did.
+func skipQuarantined(rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config, host *hostRun) bool {
+	if cfg.IncludeQuarantined {
+		if state, ok := rtrClient.Breaker.State(host.deviceID); ok && state.QuarantinedUntil != nil && state.QuarantinedUntil.After(time.Now()) {
+			progress.Printf("Device %s is quarantined after %d consecutive %s failures; attempting it anyway (--include-quarantined).\n", host.deviceID, state.Failures, state.Class)
+		}
+		return false
+	}
+	state, ok := rtrClient.Breaker.Quarantined(host.deviceID)
+	if !ok {
+		return false
+	}
+	host.quarantined, host.circuit = true, circuitState(state)
+	host.err = fmt.Errorf("device %s skipped: %w, quarantined until %s after %d consecutive %s failures; run with --include-quarantined to attempt it",
+		host.deviceID, rtr.ErrCircuitOpen, host.circuit.QuarantinedUntil, state.Failures, state.Class)
+	return true
+}
+
+// countFailure counts a failed attempt on deviceID against the circuit
+// breaker. It returns err, marked with rtr.ErrCircuitOpen when the attempt
+// opened the device's circuit, so that the device is not attempted again.
+func countFailure(rtrClient *rtr.CrowdStrikeRTRClient, deviceID string, result *sink.Result, err error) error {
+	state, open := rtrClient.Breaker.Failure(deviceID, failureClass(result, err))
+	if !open {
+		return err
+	}
+	progress.Printf("Circuit open for device %s after %d consecutive %s failures; not attempting it again.\n", deviceID, state.Failures, state.Class)
+	if err == nil {
+		return fmt.Errorf("%w after %d consecutive %s failures", rtr.ErrCircuitOpen, state.Failures, state.Class)
+	}
+	return fmt.Errorf("%w; %w after %d consecutive %s failures", err, rtr.ErrCircuitOpen, state.Failures, state.Class)
+}
+
+// failureClass is the class a failed attempt counts against in the circuit
+// breaker: the classified failure reason of the command, or of the error.
+// Failures that are not the device's, such as an interrupted run or an
+// exhausted call budget, have no class and are not counted.
+func failureClass(result *sink.Result, err error) string {
+	switch {
+	case result != nil && result.FailureReason != "":
+		return result.FailureReason
+	case err == nil, exitCodeFor(err) == exitInterrupted, errors.Is(err, context.Canceled), errors.Is(err, rtr.ErrBudgetExceeded):
+		return ""
+	case errors.Is(err, rtr.ErrDeviceNotFound):
+		return rtr.FailureDeviceNotFound
+	}
+	reason, _ := rtr.ClassifyFailure(err.Error())
+	return reason
+}
+
+// circuitState records why the circuit breaker stopped attempting a device.
+func circuitState(state rtr.BreakerState) *sink.CircuitState {
+	circuit := &sink.CircuitState{Class: state.Class, Failures: state.Failures}
+	if state.QuarantinedUntil != nil {
+		circuit.QuarantinedUntil = sink.FormatTime(*state.QuarantinedUntil)
+	}
+	return circuit
+}
+
+// circuitSummary lists the hosts the circuit breaker stopped attempting,
+// for the run summary.
+func circuitSummary(hosts []hostRun) []string {
+	var lines []string
+	for _, host := range hosts {
+		if host.circuit == nil {
+			continue
+		}
+		line := fmt.Sprintf("%s after %d consecutive %s failures", host.deviceID, host.circuit.Failures, host.circuit.Class)
+		if host.circuit.QuarantinedUntil != "" {
+			line += ", quarantined until " + host.circuit.QuarantinedUntil
+		}
+		if host.quarantined {
+			line += " (skipped)"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+)
+
+// runCleanupCommand implements "cleanup", which deletes RTR sessions leaked
+// by earlier runs and, with --prune-prefix, stale cloud scripts and
+// put-files. Nothing is deleted without --confirm; --dry-run lists exactly
+// what would be removed. It exits 0 on success, 1 when any deletion failed
+// and 2 on usage errors.
+func runCleanupCommand(args []string) int {
+	flags := config.Flags{}
+	flagSet := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	registerConfigFlags(flagSet, &flags)
+	olderThan := flagSet.Duration("older-than", 24*time.Hour, "Delete sessions created longer ago than this")
+	owner := flagSet.String("owner", "", "Only delete sessions created by this user ID or name (default: the configured client ID)")
+	prunePrefix := flagSet.String("prune-prefix", "", "Also prune cloud scripts and put-files whose name starts with this prefix")
+	pruneDays := flagSet.Int("prune-days", 30, "Prune cloud files not modified for this many days")
+	dryRun := flagSet.Bool("dry-run", false, "List what would be removed without deleting anything")
+	confirm := flagSet.Bool("confirm", false, "Actually delete the listed sessions and files")
+	if err := flagSet.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+
+	if *dryRun == *confirm {
+		fmt.Fprintln(os.Stderr, "cleanup: specify exactly one of --dry-run or --confirm")
+		return 2
+	}
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return 2
+	}
+	rtrClient, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return 2
+	}
+	if *prunePrefix != "" && cfg.MinimalPermissions {
+		fmt.Fprintln(os.Stderr, "cleanup: --prune-prefix needs Real time response (admin): Write, which minimal_permissions never uses")
+		return 2
+	}
+	ctx := context.Background()
+	if err := rtrClient.Authenticate(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to authenticate: %v\n", err)
+		return 1
+	}
+	if *owner == "" {
+		*owner = cfg.ClientID
+	}
+
+	filter := ""
+	if cfg.DeviceID != "" {
+		filter = "device_id:" + rtr.QuoteFQL(cfg.DeviceID)
+	}
+	sessions, err := rtrClient.ListAuditSessions(ctx, filter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	cutoff := time.Now().Add(-*olderThan)
+	var staleSessions []rtr.AuditSession
+	for _, session := range sessions {
+		if session.Deleted || session.CreatedAt.IsZero() || session.CreatedAt.After(cutoff) {
+			continue
+		}
+		if !strings.EqualFold(session.UserID, *owner) && !strings.EqualFold(session.UserName, *owner) {
+			continue
+		}
+		staleSessions = append(staleSessions, session)
+	}
+
+	var staleFiles []rtr.CloudFile
+	if *prunePrefix != "" {
+		fileCutoff := time.Now().AddDate(0, 0, -*pruneDays)
+		for _, kind := range []string{rtr.CloudFileScript, rtr.CloudFilePutFile} {
+			files, err := rtrClient.ListCloudFiles(ctx, kind)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			for _, file := range files {
+				if strings.HasPrefix(file.Name, *prunePrefix) && !file.ModifiedAt.IsZero() && file.ModifiedAt.Before(fileCutoff) {
+					staleFiles = append(staleFiles, file)
+				}
+			}
+		}
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "KIND\tID\tNAME / DEVICE\tOWNER\tAGE")
+	for _, session := range staleSessions {
+		fmt.Fprintf(writer, "session\t%s\t%s\t%s\t%s\n", session.ID, session.DeviceID, session.UserName, time.Since(session.CreatedAt).Round(time.Minute))
+	}
+	for _, file := range staleFiles {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", file.Kind, file.ID, file.Name, file.CreatedBy, time.Since(file.ModifiedAt).Round(time.Minute))
+	}
+	writer.Flush()
+
+	if *dryRun {
+		fmt.Printf("\nDry run: %d session(s) and %d cloud file(s) would be removed. Re-run with --confirm to delete them.\n", len(staleSessions), len(staleFiles))
+		return 0
+	}
+
+	failures := 0
+	for _, session := range staleSessions {
+		if err := rtrClient.DeleteSession(ctx, session.ID); err != nil {
+			fmt.Println(err)
+			failures++
+		}
+	}
+	for _, file := range staleFiles {
+		if err := rtrClient.DeleteCloudFile(ctx, file); err != nil {
+			fmt.Println(err)
+			failures++
+		}
+	}
+	fmt.Printf("\nRemoved %d of %d item(s).\n", len(staleSessions)+len(staleFiles)-failures, len(staleSessions)+len(staleFiles))
+	if failures > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/postprocess"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/simulate"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/vcr"
+)
+
+// newClient builds the RTR client of the resolved configuration, with its
+// progress going to progress.
+func newClient(cfg *config.Config, opts ...rtr.Option) (*rtr.CrowdStrikeRTRClient, error) {
+	deviceID := cfg.DeviceID
+	if cfg.Simulation.Enabled && deviceID == "" {
+		deviceID = simulate.DefaultDevice.ID
+		if len(cfg.Simulation.Devices) > 0 {
+			deviceID = cfg.Simulation.Devices[0].DeviceID
+		}
+	}
+
+	var transport http.RoundTripper
+	if cfg.VCR.Mode != "" {
+		cassette, err := vcr.New(cfg.VCR.Mode, cfg.VCR.Cassette, nil, vcr.Options{AnonymizeIDs: cfg.VCR.AnonymizeIDs})
+		if err != nil {
+			return nil, err
+		}
+		progress.Printf("VCR %s mode: cassette %s\n", cfg.VCR.Mode, cfg.VCR.Cassette)
+		transport = cassette
+	}
+	if cfg.Simulation.Enabled {
+		progress.Printf("Simulation mode: no requests reach the CrowdStrike API (seed %d)\n", cfg.Simulation.Seed)
+		transport = simulate.New(simulationOptions(cfg.Simulation))
+	}
+
+	var sandbox *rtr.Sandbox
+	if cfg.Sandbox.Enabled {
+		sandbox = &rtr.Sandbox{
+			Extensions:    cfg.Sandbox.Extensions,
+			MaxBytes:      cfg.Sandbox.MaxBytes,
+			EnvironmentID: cfg.Sandbox.EnvironmentID,
+			Timeout:       time.Duration(cfg.Sandbox.Timeout),
+		}
+	}
+	var breaker *rtr.CircuitBreaker
+	if cfg.CircuitBreaker.Enabled {
+		var err error
+		breaker, err = rtr.LoadCircuitBreaker(cfg.CircuitBreaker.QuarantineFile, cfg.CircuitBreaker.Failures, time.Duration(cfg.CircuitBreaker.QuarantineTTL))
+		if err != nil {
+			return nil, fmt.Errorf("circuit_breaker.quarantine_file: %w", err)
+		}
+	}
+
+	return rtr.NewCrowdStrikeRTRClient(rtr.Options{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		BaseURL:      cfg.BaseURL,
+		MemberCID:    cfg.MemberCID,
+		DeviceID:     deviceID,
+		RunID:        cfg.RunID,
+		PassRunID:    cfg.PassRunID,
+		CaseID:       cfg.CaseID,
+		Operator:     cfg.Operator,
+
+		ScriptCommandLine: cfg.ScriptCommandLine,
+		UninstallAudit:    cfg.UninstallToken.AuditMessage,
+		ForbidUninstall:   cfg.UninstallToken.Forbid,
+
+		RedactionRulesFile: cfg.Redaction.RulesFile,
+		KeepRawOutput:      cfg.Redaction.KeepRawOutput,
+		ScriptPinsFile:     cfg.ScriptPinsFile,
+
+		Endpoints:          cfg.Endpoints,
+		CommandEndpoints:   cfg.CommandEndpoints,
+		ReissuePolicy:      cfg.ReissuePolicy,
+		ReissueCommands:    cfg.ReissueCommands,
+		MinimalPermissions: cfg.MinimalPermissions,
+		PollStrategy:       cfg.PollStrategy,
+
+		ArtifactNames: cfg.Naming.Artifact,
+		OutputNames:   cfg.Naming.Output,
+		OutputDir:     cfg.OutputDir,
+		DownloadDir:   cfg.DownloadDir,
+
+		MemdumpTimeout:        time.Duration(cfg.MemdumpTimeout),
+		ArchiveMaxBytes:       cfg.Archive.MaxBytes,
+		ArchiveCleanup:        cfg.Archive.Cleanup,
+		ScriptTimeout:         time.Duration(cfg.ScriptTimeout),
+		StallWindow:           time.Duration(cfg.StallWindow),
+		StallRefresh:          cfg.StallRefresh,
+		PlatformScripts:       cfg.PlatformScripts,
+		ContinuationParameter: cfg.Continuation.Parameter,
+		NormalizeOutput:       cfg.Output.Normalize,
+		KeepOriginalOutput:    cfg.Output.KeepOriginal,
+
+		APICallBudget:    cfg.APICallBudget,
+		ThrottleJitter:   time.Duration(cfg.Throttle.Jitter),
+		PauseIssuance:    cfg.Throttle.PauseIssuance,
+		MaxResponseBytes: cfg.MaxResponseBytes,
+		APIRate:          cfg.Concurrency.APIRate,
+		Downloads:        cfg.Concurrency.Downloads,
+
+		PostProcessors:         postProcessors(cfg.PostProcess),
+		PostProcessConcurrency: cfg.Concurrency.PostProcessors,
+		Sandbox:                sandbox,
+		Breaker:                breaker,
+
+		Transport: transport,
+		Simulated: cfg.Simulation.Enabled,
+		Console:   progress,
+	}, opts...)
+}
+
+// postProcessors builds the processors the postprocess config names, in
+// its order.
+func postProcessors(cfg config.PostProcess) []postprocess.Processor {
+	var processors []postprocess.Processor
+	for _, name := range cfg.Processors {
+		switch name {
+		case "hashes":
+			processors = append(processors, postprocess.Hashes{SSDeepBinary: cfg.SSDeepBinary})
+		case "strings":
+			processors = append(processors, postprocess.Strings{MinLength: cfg.StringsMinLength})
+		case "yara":
+			processors = append(processors, postprocess.YARA{Binary: cfg.YARABinary, Rules: cfg.YARARules})
+		}
+	}
+	return processors
+}
+
+// simulationOptions converts the simulation config into simulate.Options.
+func simulationOptions(cfg config.Simulation) simulate.Options {
+	opts := simulate.Options{
+		Seed:         cfg.Seed,
+		Outputs:      cfg.Outputs,
+		Errors:       cfg.Errors,
+		Scopes:       cfg.Scopes,
+		Children:     cfg.Children,
+		Ambiguous:    cfg.Ambiguous,
+		Latency:      time.Duration(cfg.Latency),
+		FailureRate:  cfg.FailureRate,
+		ThrottleRate: cfg.ThrottleRate,
+		Scripts:      cfg.Scripts,
+		LineInterval: time.Duration(cfg.LineInterval),
+		Verdicts:     cfg.SandboxVerdicts,
+	}
+	for _, device := range cfg.Devices {
+		opts.Devices = append(opts.Devices, simulate.Device{
+			ID:       rtr.NormalizeDeviceID(device.DeviceID),
+			Hostname: device.Hostname,
+			Platform: device.Platform,
+			Offline:  device.Offline,
+			BusyWith: device.BusyWith,
+			Stale:    device.Stale,
+
+			SerialNumber: device.SerialNumber,
+			MACAddress:   device.MACAddress,
+		})
+	}
+	return opts
+}
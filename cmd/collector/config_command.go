@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+// registerConfigFlags adds the flags that override configuration values.
+func registerConfigFlags(flagSet *flag.FlagSet, flags *config.Flags) {
+	flagSet.StringVar(&flags.ConfigPath, "config", "", "Path to a YAML or JSON config file (default: $COLLECTOR_CONFIG)")
+	flagSet.BoolVar(&flags.AllowUnknown, "allow-unknown", false, "Ignore unknown keys in the config file with a warning instead of rejecting it")
+	flagSet.StringVar(&flags.Profile, "profile", "", "Named profile from the config file (default: $COLLECTOR_PROFILE)")
+	flagSet.StringVar(&flags.DeviceID, "device-id", "", "Device ID (AID) to target; overrides device_id and DEVICE_ID")
+	flagSet.StringVar(&flags.ScriptName, "script", "", "Cloud script to run; overrides script_name and SCRIPT_NAME")
+	flagSet.StringVar(&flags.BaseURL, "base-url", "", "CrowdStrike API base URL; overrides base_url and BASE_URL")
+	flagSet.StringVar(&flags.TargetHostname, "hostname", "", "Target every host whose hostname matches this glob or regex; overrides target.hostname")
+	flagSet.StringVar(&flags.TargetMatch, "match", "", "How --hostname matches: glob or regex; overrides target.match")
+	flagSet.StringVar(&flags.TargetFilter, "filter", "", "FQL filter bounding the candidate hosts, e.g. platform_name:'Windows'; overrides target.filter")
+	flagSet.BoolVar(&flags.TargetCaseSensitive, "case-sensitive", false, "Match --hostname case-sensitively")
+	flagSet.StringVar(&flags.TargetSerials, "serial", "", "Comma-separated serial numbers of the hosts to target; overrides target.serials")
+	flagSet.StringVar(&flags.TargetMACs, "mac", "", "Comma-separated MAC addresses of the hosts to target, in any common notation; overrides target.macs")
+	flagSet.StringVar(&flags.TargetIdentifiers, "identifiers-file", "", "File of serial=... and mac=... lines naming the hosts to target; overrides target.identifiers_file")
+	flagSet.StringVar(&flags.MemberCID, "member-cid", "", "MSSP child CID to act in with the parent credentials; overrides member_cid and MEMBER_CID")
+	flagSet.StringVar(&flags.OutputDir, "output-dir", "", "Directory relative output paths are written under; overrides output_dir and OUTPUT_DIR")
+	flagSet.StringVar(&flags.CaseID, "case-id", "", "Case the run collects for; overrides case_id and CASE_ID")
+	flagSet.StringVar(&flags.Operator, "operator", "", "Who runs the collection; overrides operator and RUN_OPERATOR")
+	flagSet.StringVar(&flags.Reason, "reason", "", "Why the collection runs; overrides reason and RUN_REASON")
+	flagSet.StringVar(&flags.TicketURL, "ticket-url", "", "Ticket the collection is made for; overrides ticket_url and TICKET_URL")
+	flagSet.IntVar(&flags.MaxParallelism, "max-parallelism", 0, "Scale every concurrency pool so the largest has this many slots; overrides MAX_PARALLELISM")
+}
+
+// loadConfig resolves the configuration like config.Load and prints what
+// loading ignored.
+func loadConfig(flags config.Flags) (*config.Config, error) {
+	cfg, err := config.Load(flags)
+	printNotices(cfg)
+	return cfg, err
+}
+
+// loadConfigFile reads the config file like config.LoadFile and prints what
+// it ignored.
+func loadConfigFile(path string, allowUnknown bool) (*config.Config, error) {
+	cfg, err := config.LoadFile(path, allowUnknown)
+	printNotices(cfg)
+	return cfg, err
+}
+
+func printNotices(cfg *config.Config) {
+	if cfg == nil {
+		return
+	}
+	for _, notice := range cfg.Notices {
+		progress.Printf("Warning: %s\n", notice)
+	}
+}
+
+// runConfigCommand implements "config print", which shows the resolved
+// configuration with secrets masked, and "config schema", which prints the
+// JSON Schema of the config file.
+func runConfigCommand(args []string) int {
+	if len(args) > 0 && args[0] == "schema" {
+		out, err := json.MarshalIndent(config.Schema(), "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to render schema: %v\n", err)
+			return 1
+		}
+		os.Stdout.Write(append(out, '\n'))
+		return 0
+	}
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "Usage: crowdstrike-data-collector config print [--format yaml|json] [flags]")
+		fmt.Fprintln(os.Stderr, "       crowdstrike-data-collector config schema")
+		return 2
+	}
+
+	flags := config.Flags{}
+	flagSet := flag.NewFlagSet("config print", flag.ContinueOnError)
+	registerConfigFlags(flagSet, &flags)
+	format := flagSet.String("format", "yaml", "Output format: yaml or json")
+	if err := flagSet.Parse(args[1:]); err != nil {
+		return parseExitCode(err)
+	}
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return 1
+	}
+
+	masked := cfg.Masked()
+	var out []byte
+	switch *format {
+	case "yaml":
+		out, err = yaml.Marshal(masked)
+	case "json":
+		out, err = json.MarshalIndent(masked, "", "  ")
+		out = append(out, '\n')
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format %q (use yaml or json)\n", *format)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to render configuration: %v\n", err)
+		return 1
+	}
+	os.Stdout.Write(out)
+	return 0
+}
+
+// runProfilesCommand implements "profiles list", which shows the configured
+// profiles with their regions and masked client IDs.
+func runProfilesCommand(args []string) int {
+	if len(args) == 0 || args[0] != "list" {
+		fmt.Fprintln(os.Stderr, "Usage: crowdstrike-data-collector profiles list [--config path]")
+		return 2
+	}
+
+	flags := config.Flags{}
+	flagSet := flag.NewFlagSet("profiles list", flag.ContinueOnError)
+	registerConfigFlags(flagSet, &flags)
+	if err := flagSet.Parse(args[1:]); err != nil {
+		return parseExitCode(err)
+	}
+
+	cfg, err := loadConfigFile(flags.ConfigPath, flags.AllowUnknown)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return 1
+	}
+
+	selected := flags.Profile
+	if selected == "" {
+		selected = os.Getenv("COLLECTOR_PROFILE")
+	}
+	if selected == "" {
+		selected = cfg.Profile
+	}
+
+	if len(cfg.Profiles) == 0 {
+		fmt.Println("No profiles configured.")
+		return 0
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tPROFILE\tREGION\tBASE URL\tCLIENT ID")
+	for _, name := range cfg.ProfileNames() {
+		profile := cfg.Profiles[name]
+		marker := ""
+		if name == selected {
+			marker = "*"
+		}
+
+		region := profile.Region
+		if region == "" && profile.BaseURL == "" {
+			region = "us-1"
+		}
+		baseURL := profile.BaseURL
+		if baseURL == "" {
+			baseURL = config.Regions[region]
+		}
+
+		clientID := config.MaskID(profile.ClientID)
+		if profile.ClientIDEnv != "" {
+			clientID = "$" + profile.ClientIDEnv
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", marker, name, region, baseURL, clientID)
+	}
+	writer.Flush()
+	return 0
+}
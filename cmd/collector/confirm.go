@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/approval"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/audit"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+)
+
+// sampleHosts is how many hostnames the confirmation prompt shows.
+const sampleHosts = 5
+
+// destructiveConfirmation records how the destructive commands of a run
+// were confirmed: typed at the prompt, or forced with --force-destructive.
+type destructiveConfirmation struct {
+	Method      string    `json:"method"` // prompt or forced
+	Commands    []string  `json:"commands"`
+	HostCount   int       `json:"host_count"`
+	Operator    string    `json:"operator,omitempty"`
+	ConfirmedAt time.Time `json:"confirmed_at"`
+}
+
+// destructiveCommands returns the command strings of the plan that start
+// with one of the configured destructive commands. The match is on whole
+// words and ignores case, so "reg delete" matches "reg delete HKLM\..." but
+// not "reg query".
+func destructiveCommands(cfg *config.Config, plan *approval.Plan) []string {
+	var matched []string
+	for _, command := range plan.Commands {
+		words := strings.Fields(strings.ToLower(command.CommandString))
+		for _, destructive := range cfg.DestructiveCommands {
+			prefix := strings.Fields(strings.ToLower(destructive))
+			if len(prefix) > 0 && len(prefix) <= len(words) && strings.Join(words[:len(prefix)], " ") == strings.Join(prefix, " ") {
+				matched = append(matched, command.CommandString)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// confirmDestructive stops a run whose plan holds destructive commands
+// until the operator confirms it. On a terminal the operator is shown the
+// commands, the host count and a sample of hostnames and must type the host
+// count; elsewhere the run needs --force-destructive. The approval gate, if
+// configured, has already passed. The confirmation is recorded in the run
+// outcome, and it or the refusal in the audit log; a refusal exits with
+// exitPolicyRejected.
+func confirmDestructive(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config, caps rtr.Capabilities, plan *approval.Plan, outcome *runOutcome) error {
+	deviceIDs := plan.DeviceIDs
+	commands := destructiveCommands(cfg, plan)
+	if len(commands) == 0 {
+		return nil
+	}
+	confirmation := &destructiveConfirmation{Commands: commands, HostCount: len(deviceIDs), Operator: cfg.Operator}
+	details := map[string]string{"commands": rtrClient.Redactor.Conceal(strings.Join(commands, "; ")), "host_count": strconv.Itoa(len(deviceIDs))}
+	refuse := func(err error) error {
+		outcome.audit.Record(audit.Record{Event: audit.EventDestructiveRefused, Details: details, Error: err.Error()})
+		return withExitCode(exitPolicyRejected, err)
+	}
+
+	switch {
+	case cfg.ForceDestructive:
+		confirmation.Method = "forced"
+		progress.Printf("Destructive commands confirmed by --force-destructive for %d host(s): %s\n", len(deviceIDs), strings.Join(commands, "; "))
+	case !interactive(os.Stdin):
+		return refuse(fmt.Errorf("Confirmation Error: the run issues destructive commands (%s) and stdin is not a terminal. Pass --force-destructive to run them unattended.", strings.Join(commands, "; ")))
+	default:
+		// The prompt goes to stderr even with --quiet or --log-file, as the
+		// operator has to see it to answer.
+		fmt.Fprintln(os.Stderr, "\n!!! This run issues destructive commands !!!")
+		for _, command := range commands {
+			fmt.Fprintf(os.Stderr, "  %s\n", command)
+		}
+		fmt.Fprintf(os.Stderr, "Hosts (%d): %s\n", len(deviceIDs), hostSample(ctx, rtrClient, caps, deviceIDs))
+		fmt.Fprintf(os.Stderr, "Type the host count (%d) to proceed: ", len(deviceIDs))
+		answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return refuse(fmt.Errorf("Confirmation Error: failed to read the confirmation: %v", err))
+		}
+		if typed, err := strconv.Atoi(strings.TrimSpace(answer)); err != nil || typed != len(deviceIDs) {
+			return refuse(fmt.Errorf("Confirmation Error: the host count was not confirmed. Refusing to run destructive commands."))
+		}
+		confirmation.Method = "prompt"
+		progress.Println("Destructive commands confirmed.")
+	}
+	confirmation.ConfirmedAt = time.Now().UTC()
+	outcome.DestructiveConfirmation = confirmation
+	details["method"] = confirmation.Method
+	outcome.audit.Record(audit.Record{Event: audit.EventDestructiveConfirmed, Details: details})
+	return nil
+}
+
+// interactive reports whether file is a terminal an operator can answer on:
+// a character device other than the null device.
+func interactive(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, null)
+}
+
+// hostSample names up to sampleHosts of the hosts, by hostname when the
+// credentials can read hosts and by device ID otherwise.
+func hostSample(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, caps rtr.Capabilities, deviceIDs []string) string {
+	sample := deviceIDs[:min(sampleHosts, len(deviceIDs))]
+	hostnames := map[string]string{}
+	if caps.HostsRead {
+		if hosts, err := rtrClient.GetHosts(ctx, sample); err == nil {
+			for _, host := range hosts {
+				hostnames[host.DeviceID] = host.Hostname
+			}
+		}
+	}
+	names := make([]string, len(sample))
+	for i, deviceID := range sample {
+		names[i] = deviceID
+		if hostname := hostnames[deviceID]; hostname != "" {
+			names[i] = hostname
+		}
+	}
+	line := strings.Join(names, ", ")
+	if more := len(deviceIDs) - len(sample); more > 0 {
+		line += fmt.Sprintf(" and %d more", more)
+	}
+	return line
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/notify"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// errContinuationLoop fails a host whose script returned a continuation
+// token it had returned before, and would otherwise be run forever.
+var errContinuationLoop = errors.New("continuation loop")
+
+// runContinued runs the configured script on session and, with
+// continuation.token_path set, runs it again for as long as its output
+// holds a continuation token, passing the token back. The runs are merged
+// into one result by mergeIteration. A failed run ends the loop with its
+// failure. A token returned twice fails the host, and a token still
+// returned after continuation.max_iterations runs is a continuation_limit
+// warning.
+func runContinued(ctx context.Context, session *rtr.Session, cfg *config.Config, summary *notify.Summary, timing *sink.Timing) (*sink.Result, error) {
+	result, err := runScript(ctx, session, cfg, summary, timing, "")
+	if cfg.Continuation.TokenPath == "" || err != nil || result == nil || result.FailureReason != "" {
+		return result, err
+	}
+	result.Iterations = 1
+	seen := map[string]int{} // Token to the run that returned it
+	stdout := result.Stdout
+	for {
+		token := continuationToken(stdout, cfg.Continuation.TokenPath)
+		if token == "" {
+			return result, nil
+		}
+		if run, ok := seen[token]; ok {
+			return result, fmt.Errorf("%w: the script returned continuation token %q after run %d and again after run %d", errContinuationLoop, token, run, result.Iterations)
+		}
+		seen[token] = result.Iterations
+		if result.Iterations >= cfg.Continuation.MaxIterations {
+			session.Warnings.Add(sink.WarningContinuationLimit, session.DeviceID, "script still returned continuation token %q after %d runs (continuation.max_iterations); its output is partial", token, result.Iterations)
+			return result, nil
+		}
+		if err := interrupted(ctx); err != nil {
+			return result, err
+		}
+		progress.Printf("Script reported partial completion on device %s; continuing from %q (run %d of at most %d)\n", session.DeviceID, token, result.Iterations+1, cfg.Continuation.MaxIterations)
+		next, err := runScript(ctx, session, cfg, summary, timing, token)
+		if next == nil {
+			if err == nil {
+				err = fmt.Errorf("status of continuation run %d could not be retrieved", result.Iterations+1)
+			}
+			return result, err
+		}
+		mergeIteration(result, next)
+		if err != nil || next.FailureReason != "" {
+			return result, err
+		}
+		stdout = next.Stdout
+	}
+}
+
+// mergeIteration adds the result of another run of the script to result:
+// stdout and stderr are concatenated, command errors and normalization
+// steps collected, redactions added up, and the command fields and failure
+// are the latest run's.
+func mergeIteration(result, next *sink.Result) {
+	result.Stdout = joinOutput(result.Stdout, next.Stdout)
+	result.Stderr = joinOutput(result.Stderr, next.Stderr)
+	result.Errors = append(result.Errors, next.Errors...)
+	for name, n := range next.Redactions {
+		if result.Redactions == nil {
+			result.Redactions = map[string]int{}
+		}
+		result.Redactions[name] += n
+	}
+	for _, step := range next.Normalization {
+		if !slices.Contains(result.Normalization, step) {
+			result.Normalization = append(result.Normalization, step)
+		}
+	}
+	result.SessionID, result.CloudRequestID, result.Endpoint = next.SessionID, next.CloudRequestID, next.Endpoint
+	result.FailureReason, result.Raw = next.FailureReason, next.Raw
+	result.Iterations++
+}
+
+// joinOutput appends next to output, on a line of its own.
+func joinOutput(output, next string) string {
+	if output == "" || next == "" || strings.HasSuffix(output, "\n") {
+		return output + next
+	}
+	return output + "\n" + next
+}
+
+// continuationToken returns the continuation token at path in stdout, when
+// stdout is a JSON document as a whole, or "" when it holds none.
+func continuationToken(stdout, path string) string {
+	var output interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(stdout)), &output); err != nil {
+		return ""
+	}
+	value, ok := lookupPath(output, path)
+	if !ok {
+		return ""
+	}
+	return valueText(value)
+}
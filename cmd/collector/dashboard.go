@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/console"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+
+	"golang.org/x/term"
+)
+
+// dashboardRefresh is how often the --tui dashboard is redrawn.
+const dashboardRefresh = 500 * time.Millisecond
+
+// dashboardLines is how many lines of progress output the dashboard keeps.
+const dashboardLines = 200
+
+// rateWindow is the span the dashboard averages the API call rate over.
+const rateWindow = 10 * time.Second
+
+// errDashboardInterrupt is the cause of a run interrupted from the
+// dashboard, where the terminal does not turn Ctrl-C into a signal.
+var errDashboardInterrupt = errors.New("interrupted from the dashboard")
+
+// Terminal control sequences of the dashboard: the alternate screen keeps
+// the dashboard out of the scrollback.
+const (
+	enterScreen = "\x1b[?1049h\x1b[?25l"
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+	clearLine   = "\x1b[K"
+	clearBelow  = "\x1b[J"
+	cursorHome  = "\x1b[H"
+)
+
+// dashboard is the --tui view of the dispatch loop: host counts from the
+// dispatch, call counts and the call rate from the call budget, 429s and
+// downloads from the client's metrics, throttle pauses from the throttle,
+// the same sources the run outcome and reports are built from. While it is
+// up, progress output is kept out of the way and its latest lines shown in
+// the dashboard; progress meant for stderr is written there once the
+// dashboard is gone. With a terminal on stdin, keys pause and resume host
+// dispatch, list the failed hosts and interrupt the run.
+//
+// Methods on a nil *dashboard do nothing.
+type dashboard struct {
+	rtrClient *rtr.CrowdStrikeRTRClient
+	cfg       *config.Config
+	queue     *dispatch
+	cancel    context.CancelCauseFunc
+	keys      bool // Whether stdin is read for key bindings
+	restore   func()
+	redraw    chan struct{}
+	done      chan struct{}
+	drawn     chan struct{} // Closed once the last frame is drawn
+
+	mu         sync.Mutex
+	progress   bytes.Buffer // Progress output held back from stderr, if meant for it
+	held       bool
+	lines      []string // Latest lines of progress output
+	partial    string   // Progress output after the last line break
+	showFailed bool
+	scroll     int
+	samples    []callSample
+}
+
+// callSample is the call count at one moment, for the call rate.
+type callSample struct {
+	at    time.Time
+	calls int
+}
+
+// startDashboard shows the dashboard of queue when the run was started
+// with --tui and stderr is a terminal; on anything else it says so and the
+// plain progress output goes on. The returned context is cancelled when
+// the run is interrupted from the dashboard.
+func startDashboard(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config, queue *dispatch) (context.Context, *dashboard) {
+	if !cfg.TUI {
+		return ctx, nil
+	}
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		progress.Println("--tui: stderr is not a terminal; showing plain progress output instead.")
+		return ctx, nil
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	d := &dashboard{
+		rtrClient: rtrClient,
+		cfg:       cfg,
+		queue:     queue,
+		cancel:    cancel,
+		redraw:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		drawn:     make(chan struct{}),
+	}
+
+	// Progress meant for stderr is held back; progress going to a log file
+	// still goes there.
+	progressOut, logOut := progress.Output(), log.Writer()
+	d.held = progressOut == io.Writer(os.Stderr)
+	if d.held {
+		progress.SetOutput(d)
+	} else {
+		progress.SetOutput(io.MultiWriter(progressOut, d))
+	}
+	if logOut == io.Writer(os.Stderr) {
+		log.SetOutput(d)
+	}
+	var state *term.State
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		if s, err := term.MakeRaw(fd); err == nil {
+			state, d.keys = s, true
+		}
+	}
+	d.restore = func() {
+		if state != nil {
+			term.Restore(int(os.Stdin.Fd()), state)
+		}
+		progress.SetOutput(progressOut)
+		log.SetOutput(logOut)
+	}
+
+	io.WriteString(os.Stderr, enterScreen)
+	go d.loop()
+	if d.keys {
+		go d.readKeys()
+	}
+	return ctx, d
+}
+
+// stop takes the dashboard down and writes the progress output it held
+// back to stderr.
+func (d *dashboard) stop() {
+	if d == nil {
+		return
+	}
+	close(d.done)
+	<-d.drawn
+	io.WriteString(os.Stderr, leaveScreen)
+	d.restore()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.held {
+		os.Stderr.Write(d.progress.Bytes())
+	}
+	d.cancel(nil)
+}
+
+// Write takes the progress output while the dashboard is up.
+func (d *dashboard) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.held {
+		d.progress.Write(p)
+	}
+	text := strings.ReplaceAll(d.partial+string(p), "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	d.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		if line = strings.TrimSpace(console.StripANSI(line)); line != "" {
+			d.lines = append(d.lines, line)
+		}
+	}
+	if excess := len(d.lines) - dashboardLines; excess > 0 {
+		d.lines = append([]string(nil), d.lines[excess:]...)
+	}
+	return len(p), nil
+}
+
+// loop redraws the dashboard until it is stopped.
+func (d *dashboard) loop() {
+	defer close(d.drawn)
+	ticker := time.NewTicker(dashboardRefresh)
+	defer ticker.Stop()
+	for {
+		d.draw()
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		case <-d.redraw:
+		}
+	}
+}
+
+// readKeys acts on the keys typed on stdin: p pauses or resumes host
+// dispatch, f shows or hides the failed hosts, j and k (or the arrow keys)
+// scroll them, and q or Ctrl-C interrupts the run. A key typed after the
+// dashboard is stopped is dropped.
+func (d *dashboard) readKeys() {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+		if err != nil {
+			return
+		}
+		keys := string(buf[:n])
+		keys = strings.NewReplacer("\x1b[A", "k", "\x1b[B", "j").Replace(keys)
+		for _, key := range keys {
+			d.key(key)
+		}
+		select {
+		case d.redraw <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (d *dashboard) key(key rune) {
+	switch key {
+	case 'p':
+		if d.queue.togglePause() {
+			progress.Println("Host dispatch paused from the dashboard; hosts already dispatched run on.")
+		} else {
+			progress.Println("Host dispatch resumed from the dashboard.")
+		}
+	case 'f':
+		d.mu.Lock()
+		d.showFailed, d.scroll = !d.showFailed, 0
+		d.mu.Unlock()
+	case 'j':
+		d.mu.Lock()
+		d.scroll++
+		d.mu.Unlock()
+	case 'k':
+		d.mu.Lock()
+		d.scroll = max(d.scroll-1, 0)
+		d.mu.Unlock()
+	case 'q', 3: // 3 is Ctrl-C
+		progress.Println("Run interrupted from the dashboard.")
+		d.cancel(errDashboardInterrupt)
+	}
+}
+
+// draw renders one frame to fit the terminal.
+func (d *dashboard) draw() {
+	width, height, err := term.GetSize(int(os.Stderr.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+	progress := d.queue.progress()
+	succeeded, failed, skipped := progress.counts()
+	metrics := d.rtrClient.Metrics.Snapshot()
+	calls := d.rtrClient.Budget.Total()
+	throttled := d.rtrClient.Throttle.Stats()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	d.samples = append(d.samples, callSample{at: now, calls: calls})
+	for len(d.samples) > 2 && now.Sub(d.samples[1].at) >= rateWindow {
+		d.samples = d.samples[1:]
+	}
+	rate := 0.0
+	if span := now.Sub(d.samples[0].at); span > 0 {
+		rate = float64(calls-d.samples[0].calls) / span.Seconds()
+	}
+
+	state := "running"
+	if progress.paused {
+		state = "DISPATCH PAUSED"
+	}
+	limit := ""
+	if d.rtrClient.Budget.Limit > 0 {
+		limit = fmt.Sprintf(" of %d", d.rtrClient.Budget.Limit)
+	}
+	done := len(progress.done)
+	lines := []string{
+		fmt.Sprintf("Run %s  %s  %s  %s", d.cfg.RunID, d.cfg.ScriptName, progress.elapsed.Round(time.Second), state),
+		"",
+		fmt.Sprintf("Hosts      %d/%d done  %d active  %d queued   %d succeeded  %d failed  %d skipped",
+			done, progress.total, len(progress.active), progress.queued, succeeded, failed, skipped),
+		fmt.Sprintf("           %s  ETA %s", bar(int64(done), int64(progress.total), 30), eta(progress)),
+		fmt.Sprintf("API calls  %d%s  %.1f/s  429s %d  retries %d  throttle pauses %d (%s)",
+			calls, limit, rate, metrics.Throttled, metrics.Retries, throttled.Pauses, throttled.PausedFor.Round(time.Second)),
+		fmt.Sprintf("Downloads  %s  %d in flight", formatBytes(metrics.BytesDownloaded), len(metrics.Downloads)),
+		"",
+	}
+	for _, download := range metrics.Downloads {
+		if download.Size > 0 {
+			lines = append(lines, fmt.Sprintf("  %s  %s  %s of %s", download.Name, bar(download.Bytes, download.Size, 20), formatBytes(download.Bytes), formatBytes(download.Size)))
+		} else {
+			lines = append(lines, fmt.Sprintf("  %s  %s", download.Name, formatBytes(download.Bytes)))
+		}
+	}
+	if len(metrics.Downloads) > 0 {
+		lines = append(lines, "")
+	}
+	if len(progress.active) > 0 {
+		lines = append(lines, "Active hosts")
+		for _, host := range progress.active {
+			lines = append(lines, fmt.Sprintf("  %s  %s", host.deviceID, now.Sub(host.since).Round(time.Second)))
+		}
+		lines = append(lines, "")
+	}
+
+	// The rest of the screen shows the failed hosts or the latest progress.
+	footer := "p pause dispatch  f failed hosts  j/k scroll  q interrupt"
+	if progress.paused {
+		footer = "p resume dispatch  f failed hosts  j/k scroll  q interrupt"
+	}
+	if !d.keys {
+		footer = "Keys unavailable: stdin is not a terminal"
+	}
+	var body []string
+	if d.showFailed {
+		lines = append(lines, fmt.Sprintf("Failed hosts (%d)", failed))
+		for _, host := range progress.done {
+			if host.skipped() || host.err == nil {
+				continue
+			}
+			body = append(body, fmt.Sprintf("  %s  %s: %s", host.deviceID, hostStatus(host.err), firstLine(host.err.Error())))
+			if hint := failureHint(d.cfg.NoHints, host.result, host.err); hint != "" {
+				body = append(body, "    Hint: "+hint)
+			}
+		}
+	} else {
+		lines = append(lines, "Progress")
+		body = d.lines
+	}
+	room := max(height-len(lines)-2, 0)
+	if d.showFailed {
+		d.scroll = min(d.scroll, max(len(body)-room, 0))
+		body = body[d.scroll:]
+		body = body[:min(room, len(body))]
+	} else {
+		body = body[max(len(body)-room, 0):]
+	}
+	lines = append(lines, body...)
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines[:height-1], footer)
+
+	var frame strings.Builder
+	frame.WriteString(cursorHome)
+	for i, line := range lines {
+		if runes := []rune(line); len(runes) > width {
+			line = string(runes[:width])
+		}
+		frame.WriteString(line + clearLine)
+		if i < len(lines)-1 {
+			frame.WriteString("\r\n")
+		}
+	}
+	frame.WriteString(clearBelow)
+	io.WriteString(os.Stderr, frame.String())
+}
+
+// eta estimates the time left from the pace of the hosts done so far.
+func eta(progress dispatchProgress) string {
+	done := len(progress.done)
+	switch {
+	case progress.paused:
+		return "paused"
+	case done == progress.total:
+		return "done"
+	case done == 0:
+		return "-"
+	}
+	left := progress.elapsed / time.Duration(done) * time.Duration(progress.total-done)
+	return left.Round(time.Second).String()
+}
+
+// bar draws the fraction n of total as a bar width cells wide.
+func bar(n, total int64, width int) string {
+	filled := 0
+	if total > 0 {
+		filled = int(min(n, total) * int64(width) / total)
+	}
+	percent := 0
+	if total > 0 {
+		percent = int(min(n, total) * 100 / total)
+	}
+	return fmt.Sprintf("[%s%s] %3d%%", strings.Repeat("#", filled), strings.Repeat(".", width-filled), percent)
+}
+
+// formatBytes renders n bytes in binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+// firstLine returns the first line of text.
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// dispatch follows the hosts of a run through the collection: queued until
+// dispatched, active while they are collected and done once their outcome
+// is in. run builds the hosts of the report from it and the --tui dashboard
+// shows it, so the two never count hosts differently. Dispatch of new hosts
+// can be paused; hosts already dispatched run on.
+type dispatch struct {
+	deviceIDs []string
+	started   time.Time
+
+	mu        sync.Mutex
+	collected []*hostRun        // By position in deviceIDs; nil until done
+	active    map[int]time.Time // Dispatched hosts not done yet, by position
+	resume    chan struct{}     // Set while paused; closed on resume
+}
+
+// activeHost is a host being collected, and since when.
+type activeHost struct {
+	deviceID string
+	since    time.Time
+}
+
+// dispatchProgress is the state of a dispatch at one moment.
+type dispatchProgress struct {
+	total   int
+	queued  int
+	active  []activeHost // In the order of the targets
+	done    []hostRun    // In the order of the targets
+	paused  bool
+	elapsed time.Duration
+}
+
+func newDispatch(deviceIDs []string) *dispatch {
+	return &dispatch{
+		deviceIDs: deviceIDs,
+		started:   time.Now(),
+		collected: make([]*hostRun, len(deviceIDs)),
+		active:    map[int]time.Time{},
+	}
+}
+
+// wait blocks while dispatch is paused, until it is resumed or ctx is done.
+func (d *dispatch) wait(ctx context.Context) {
+	d.mu.Lock()
+	resume := d.resume
+	d.mu.Unlock()
+	if resume == nil {
+		return
+	}
+	select {
+	case <-resume:
+	case <-ctx.Done():
+	}
+}
+
+// start marks the host at position i as dispatched.
+func (d *dispatch) start(i int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active[i] = time.Now()
+}
+
+// finish records the outcome of the host at position i.
+func (d *dispatch) finish(i int, host *hostRun) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.active, i)
+	d.collected[i] = host
+}
+
+// togglePause pauses dispatch, or resumes it when paused, and reports
+// whether it is paused now.
+func (d *dispatch) togglePause() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.resume != nil {
+		close(d.resume)
+		d.resume = nil
+		return false
+	}
+	d.resume = make(chan struct{})
+	return true
+}
+
+// hosts returns the outcomes of the hosts that are done, in the order of
+// the targets. A host left undispatched by an interrupt or an exhausted
+// call budget is not among them.
+func (d *dispatch) hosts() []hostRun {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var hosts []hostRun
+	for _, host := range d.collected {
+		if host != nil {
+			hosts = append(hosts, *host)
+		}
+	}
+	return hosts
+}
+
+// progress returns the state of the dispatch.
+func (d *dispatch) progress() dispatchProgress {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	progress := dispatchProgress{total: len(d.deviceIDs), paused: d.resume != nil, elapsed: time.Since(d.started)}
+	for i, deviceID := range d.deviceIDs {
+		if host := d.collected[i]; host != nil {
+			progress.done = append(progress.done, *host)
+		} else if since, ok := d.active[i]; ok {
+			progress.active = append(progress.active, activeHost{deviceID: deviceID, since: since})
+		} else {
+			progress.queued++
+		}
+	}
+	return progress
+}
+
+// counts splits the hosts that are done the way the run summary does.
+func (p dispatchProgress) counts() (succeeded, failed, skipped int) {
+	for _, host := range p.done {
+		switch {
+		case host.skipped():
+			skipped++
+		case host.err != nil:
+			failed++
+		default:
+			succeeded++
+		}
+	}
+	return succeeded, failed, skipped
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/compression"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/evidence"
+)
+
+// runExportCommand implements "export", which bundles a run's output
+// directory into a zip or tar.gz evidence package with a hashed manifest,
+// optionally signed, and with --verify re-hashes and validates a bundle. It
+// exits 0 on success, 1 when verification finds a problem and 2 on errors.
+func runExportCommand(args []string) int {
+	flagSet := flag.NewFlagSet("export", flag.ContinueOnError)
+	dir := flagSet.String("dir", ".", "Run output directory to bundle")
+	runID := flagSet.String("run-id", "", "Only bundle files and result records of this run")
+	out := flagSet.String("out", "", "Bundle to write; .zip or .tar.gz (default: evidence-<run-id>.zip)")
+	signKey := flagSet.String("sign-key", "", "PEM private key (Ed25519, RSA or ECDSA) to sign the manifest with (default: $SIGNING_KEY)")
+	signCert := flagSet.String("sign-cert", "", "PEM certificate of the signing key, embedded in the signature (default: $SIGNING_CERT)")
+	verify := flagSet.String("verify", "", "Verify this bundle instead of creating one")
+	publicKey := flagSet.String("public-key", "", "PEM public key or certificate the bundle signature must verify against")
+	if err := flagSet.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+
+	if *verify != "" {
+		return verifyBundle(*verify, *publicKey)
+	}
+
+	if *out == "" {
+		name := *runID
+		if name == "" {
+			name = time.Now().UTC().Format("20060102T150405Z")
+		}
+		*out = fmt.Sprintf("evidence-%s.zip", name)
+	}
+	if *signKey == "" {
+		*signKey, *signCert = os.Getenv("SIGNING_KEY"), os.Getenv("SIGNING_CERT")
+	}
+	var signer *evidence.Signer
+	if *signKey != "" {
+		var err error
+		if signer, err = evidence.LoadSigner(*signKey, *signCert); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	sources, err := evidenceSources(*dir, *runID, *out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(sources) == 0 {
+		fmt.Fprintf(os.Stderr, "export: nothing to bundle in %s\n", *dir)
+		return 2
+	}
+
+	// Write next to the target and rename, so a failed export leaves no partial bundle.
+	tmp := *out + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 2
+	}
+	manifest, err := evidence.Write(file, evidence.FormatFor(*out), *runID, sources, signer)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, *out)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 2
+	}
+
+	fmt.Printf("Wrote %s: %d member(s), hash of hashes %s", *out, len(manifest.Members), manifest.HashOfHashes)
+	if signer != nil {
+		fmt.Print(", signed")
+	}
+	fmt.Println()
+	return 0
+}
+
+// verifyBundle prints the verification result of a bundle.
+func verifyBundle(path, publicKeyPath string) int {
+	var key crypto.PublicKey
+	if publicKeyPath != "" {
+		var err error
+		if key, err = evidence.LoadPublicKey(publicKeyPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	result, err := evidence.Verify(path, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	for _, problem := range result.Problems {
+		fmt.Printf("FAIL %s\n", problem)
+	}
+	switch {
+	case result.Verified:
+		fmt.Println("Signature: valid")
+	case result.Signed:
+		fmt.Println("Signature: present, not checked (pass --public-key to verify it)")
+	default:
+		fmt.Println("Signature: none")
+	}
+	if len(result.Problems) > 0 {
+		fmt.Printf("%s: %d problem(s) found\n", path, len(result.Problems))
+		return 1
+	}
+	fmt.Printf("%s: %d member(s) verified, hash of hashes %s\n", path, len(result.Manifest.Members), result.Manifest.HashOfHashes)
+	return 0
+}
+
+// evidenceSources lists the files of dir to bundle. Result files (JSON
+// lines) and the run outcome go under report/, everything else under
+// artifacts/ with its relative path. With runID, only files whose path names
+// the run are kept and result files are cut down to that run's records; a
+// compressed result file is decompressed to be cut down, and bundled
+// without its compression extension. Other compressed files are bundled as
+// they are stored, with their encoding in the manifest.
+func evidenceSources(dir, runID, out string) ([]evidence.Source, error) {
+	outPath, _ := filepath.Abs(out)
+	var sources []evidence.Source
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if abs, _ := filepath.Abs(path); abs == outPath || abs == outPath+".tmp" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case strings.HasSuffix(compression.Trim(rel), ".jsonl"):
+			source := evidence.Source{Name: "report/" + rel, Path: path}
+			if runID != "" {
+				if source.Content, err = runRecords(path, runID); err != nil {
+					return err
+				}
+				if len(source.Content) == 0 {
+					return nil
+				}
+				source.Name = "report/" + compression.Trim(rel)
+			}
+			sources = append(sources, source)
+		case filepath.Base(rel) == defaultOutcomePath:
+			if runID != "" && !outcomeOfRun(path, runID) {
+				return nil
+			}
+			sources = append(sources, evidence.Source{Name: "report/" + rel, Path: path})
+		case runID == "" || strings.Contains(rel, runID):
+			sources = append(sources, evidence.Source{Name: "artifacts/" + rel, Path: path})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect %s: %w", dir, err)
+	}
+	return sources, nil
+}
+
+// runRecords returns the lines of a results file whose run_id is runID.
+func runRecords(path, runID string) ([]byte, error) {
+	file, err := compression.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records bytes.Buffer
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var record struct {
+			RunID string `json:"run_id"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &record) == nil && record.RunID == runID {
+			records.Write(scanner.Bytes())
+			records.WriteByte('\n')
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return records.Bytes(), nil
+}
+
+// outcomeOfRun reports whether the run-outcome file at path belongs to runID.
+func outcomeOfRun(path, runID string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var outcome runOutcome
+	return json.Unmarshal(data, &outcome) == nil && outcome.RunID == runID
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+)
+
+// checkFollow refuses a --follow that does not name the hosts to follow in
+// a multi-host run, or that names a host the run does not target.
+func checkFollow(cfg *config.Config, deviceIDs []string) error {
+	if !cfg.Follow {
+		return nil
+	}
+	if len(cfg.FollowHosts) == 0 && len(deviceIDs) > 1 {
+		return withExitCode(exitConfigError, fmt.Errorf("Configuration Error: the run targets %d hosts; name the ones to follow with --follow-hosts", len(deviceIDs)))
+	}
+	for _, deviceID := range cfg.FollowHosts {
+		if !slices.Contains(deviceIDs, deviceID) {
+			return withExitCode(exitConfigError, fmt.Errorf("Configuration Error: --follow-hosts names %s, which the run does not target", deviceID))
+		}
+	}
+	return nil
+}
+
+// followWriter returns where the script output of deviceID is followed to,
+// or nil when it is not followed. With more than one followed host, each
+// line is prefixed with the device ID.
+func followWriter(cfg *config.Config, deviceID string) io.Writer {
+	switch {
+	case !cfg.Follow:
+		return nil
+	case len(cfg.FollowHosts) == 0:
+		return progress.Writer()
+	case !slices.Contains(cfg.FollowHosts, deviceID):
+		return nil
+	case len(cfg.FollowHosts) == 1:
+		return progress.Writer()
+	}
+	return newPrefixWriter(progress.Writer(), deviceID)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+)
+
+// runHealthcheckCommand implements "healthcheck", which verifies DNS, TLS,
+// authentication and API access without running a collection. It exits 0
+// when every check passes and 1 otherwise.
+func runHealthcheckCommand(args []string) int {
+	flags := config.Flags{}
+	flagSet := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	registerConfigFlags(flagSet, &flags)
+	timeout := flagSet.Duration("timeout", 30*time.Second, "Upper bound for the whole healthcheck")
+	format := flagSet.String("format", "text", "Output format: text or json")
+	if err := flagSet.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return 1
+	}
+	rtrClient, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	report := rtrClient.HealthCheck(ctx)
+
+	switch *format {
+	case "json":
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	default:
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "CHECK\tSTATUS\tLATENCY\tDETAIL")
+		for _, check := range report.Checks {
+			status := "FAIL"
+			if check.Passed {
+				status = "PASS"
+			} else if check.Skipped {
+				status = "SKIP"
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%dms\t%s\n", check.Name, status, check.LatencyMS, check.Detail)
+		}
+		writer.Flush()
+		if report.Passed {
+			fmt.Println("\nHealthcheck passed.")
+		} else {
+			fmt.Println("\nHealthcheck failed.")
+		}
+	}
+
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/hooks"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/notify"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// preRunHooks runs the registered pre_run hooks on the selected targets and
+// returns the device IDs they leave. The labels they add are kept in outcome
+// for every host's result.
+func preRunHooks(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config, deviceIDs []string, mappings []sink.TargetMapping, warnings *sink.Warnings, outcome *runOutcome) ([]string, error) {
+	run := &hooks.PreRun{
+		RunID:     cfg.RunID,
+		DeviceIDs: deviceIDs,
+		Targets:   mappings,
+		Commands:  runPlan(rtrClient, cfg, deviceIDs, mappings).Commands,
+	}
+	if metadata := cfg.Metadata(); metadata != nil {
+		run.Metadata = *metadata
+	}
+	hookOutcomes, err := hooks.RunPreRun(ctx, run, warnings)
+	outcome.Hooks = append(outcome.Hooks, hookOutcomes...)
+	if err != nil {
+		return nil, hookError(ctx, err)
+	}
+	outcome.labels = run.Labels
+	if len(run.DeviceIDs) == 0 {
+		return nil, withExitCode(exitPolicyRejected, fmt.Errorf("Hook Error: no hosts left to collect after the pre_run hooks"))
+	}
+	if len(run.DeviceIDs) != len(deviceIDs) {
+		progress.Printf("Pre-run hooks changed the targets from %d to %d host(s)\n", len(deviceIDs), len(run.DeviceIDs))
+	}
+	return run.DeviceIDs, nil
+}
+
+// hostPreHooks runs the registered host_pre hooks for host, recording
+// their outcomes and labels on it. A host a hook skipped is marked vetoed.
+func hostPreHooks(ctx context.Context, cfg *config.Config, host *hostRun) error {
+	pre := &hooks.HostPre{RunID: cfg.RunID, DeviceID: host.deviceID, Target: host.target}
+	hookOutcomes, err := hooks.RunHostPre(ctx, pre, host.warnings)
+	host.hooks, host.labels = append(host.hooks, hookOutcomes...), pre.Labels
+	if errors.Is(err, hooks.ErrSkip) {
+		host.vetoed = true
+		return fmt.Errorf("device %s %v", host.deviceID, err)
+	}
+	if err != nil {
+		return hookError(ctx, err)
+	}
+	return nil
+}
+
+// hostPostHooks runs the registered host_post hooks on the host's final
+// result and adds the labels they set to it.
+func hostPostHooks(cfg *config.Config, host hostRun, result *sink.Result) error {
+	post := &hooks.HostPost{RunID: cfg.RunID, Result: *result, Labels: result.Labels}
+	// The result is recorded even when the run was interrupted, so are its hooks.
+	hookOutcomes, err := hooks.RunHostPost(context.Background(), post, host.warnings)
+	result.Hooks = append(result.Hooks, hookOutcomes...)
+	if len(post.Labels) > 0 {
+		result.Labels = post.Labels
+	}
+	if err != nil {
+		return hookError(context.Background(), err)
+	}
+	return nil
+}
+
+// postRunHooks runs the registered post_run hooks once the results are out.
+func postRunHooks(cfg *config.Config, summary *notify.Summary, outcome *runOutcome, warnings *sink.Warnings) error {
+	run := &hooks.PostRun{
+		RunID:        cfg.RunID,
+		Status:       summary.Status,
+		Error:        summary.Error,
+		HostsTotal:   outcome.HostsTotal,
+		HostsFailed:  outcome.HostsFailed,
+		HostsSkipped: outcome.HostsSkipped,
+	}
+	for _, result := range outcome.results {
+		run.Results = append(run.Results, *result)
+	}
+	hookOutcomes, err := hooks.RunPostRun(context.Background(), run, warnings)
+	outcome.Hooks = append(outcome.Hooks, hookOutcomes...)
+	if err != nil {
+		return hookError(context.Background(), err)
+	}
+	return nil
+}
+
+// hookError is the run's error for a hook that aborted it, or for the
+// interruption that cut the hooks short.
+func hookError(ctx context.Context, err error) error {
+	if interruptErr := interrupted(ctx); interruptErr != nil {
+		return interruptErr
+	}
+	if errors.Is(err, hooks.ErrAbort) {
+		return withExitCode(exitPolicyRejected, fmt.Errorf("Hook Error: %v", err))
+	}
+	return err
+}
+
+// mergeLabels returns the run's labels overlaid with the host's, or nil when
+// there are none.
+func mergeLabels(run, host map[string]string) map[string]string {
+	if len(run)+len(host) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(run)+len(host))
+	for key, value := range run {
+		labels[key] = value
+	}
+	for key, value := range host {
+		labels[key] = value
+	}
+	return labels
+}
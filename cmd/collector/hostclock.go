@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// captureClock reads the host's clock and timezone when host_clock is
+// enabled. A failed read is a clock_capture_failed warning and nil; the
+// host is collected all the same.
+func captureClock(ctx context.Context, session *rtr.Session, cfg *config.Config, timing *sink.Timing, warnings *sink.Warnings) *sink.HostClock {
+	if !cfg.HostClock.Enabled {
+		return nil
+	}
+	clockDone := timing.Start("clock_capture")
+	clock, err := session.CaptureClock(ctx, time.Duration(cfg.HostClock.Timeout))
+	clockDone()
+	if err != nil {
+		if interrupted(ctx) == nil {
+			warnings.Add(sink.WarningClockCaptureFailed, session.DeviceID, "%v", err)
+		}
+		return nil
+	}
+	progress.Printf("Device %s clock is %+d ms off (±%d ms), timezone %s (%s)\n", session.DeviceID, clock.SkewMS, clock.UncertaintyMS, orUnknown(clock.Timezone), orUnknown(clock.UTCOffset))
+	return &clock
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
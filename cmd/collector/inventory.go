@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// inventoryColumns are the columns of a csv inventory, one row per device.
+var inventoryColumns = []string{"snapshot_at", "filter", "device_id", "hostname", "platform", "os_version", "agent_version",
+	"last_seen", "containment", "tags", "groups", "serial_number", "mac_address", "targeted", "run_status"}
+
+// inventoryRecord is the inventory snapshot of a run, as recorded in the run
+// outcome.
+type inventoryRecord struct {
+	Path       string `json:"path"`
+	Filter     string `json:"filter,omitempty"`
+	SnapshotAt string `json:"snapshot_at"`
+	Devices    int    `json:"devices"`
+	SHA256     string `json:"sha256"`
+}
+
+// inventoryDevice is a device of the inventory file: its details and what
+// the run did with it.
+type inventoryDevice struct {
+	rtr.InventoryDevice
+	Targeted  bool   `json:"targeted"`
+	RunStatus string `json:"run_status,omitempty"` // Status of the device's sink result, if targeted
+}
+
+// snapshotInventory takes the run's inventory snapshot once its targets are
+// selected, so it shows the fleet as the collection found it. A failed
+// snapshot is a warning; the collection goes on without it.
+func snapshotInventory(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config, timing *sink.Timing, warnings *sink.Warnings) *rtr.Inventory {
+	if !cfg.Inventory.Enabled {
+		return nil
+	}
+	inventoryDone := timing.Start("inventory_snapshot")
+	inventory, err := rtrClient.SnapshotInventory(ctx, cfg.Inventory.Filter)
+	inventoryDone()
+	if err != nil {
+		warnings.Add(sink.WarningInventoryFailed, "", "inventory snapshot failed: %v", err)
+		return nil
+	}
+	progress.Printf("Inventory snapshot: %d device(s)\n", len(inventory.Devices))
+	return inventory
+}
+
+// writeInventory writes the inventory snapshot with the statuses of the
+// run's results to inventory.path and delivers it to the artifact sinks.
+func writeInventory(cfg *config.Config, cid string, inventory *rtr.Inventory, outcome *runOutcome, sinks *sink.FanOut, warnings *sink.Warnings) {
+	statuses := map[string]string{}
+	for _, result := range outcome.results {
+		statuses[result.DeviceID] = result.Status
+	}
+	devices := make([]inventoryDevice, len(inventory.Devices))
+	for i, device := range inventory.Devices {
+		status, targeted := statuses[device.DeviceID]
+		devices[i] = inventoryDevice{InventoryDevice: device, Targeted: targeted, RunStatus: status}
+	}
+
+	snapshotAt := sink.FormatTime(inventory.SnapshotAt)
+	var data []byte
+	var err error
+	if cfg.Inventory.Format == "csv" {
+		data, err = inventoryCSV(snapshotAt, inventory.Filter, devices)
+	} else {
+		data, err = json.MarshalIndent(struct {
+			RunID      string            `json:"run_id"`
+			CID        string            `json:"cid,omitempty"`
+			SnapshotAt string            `json:"snapshot_at"`
+			Filter     string            `json:"filter"`
+			Devices    []inventoryDevice `json:"devices"`
+		}{cfg.RunID, cid, snapshotAt, inventory.Filter, devices}, "", "  ")
+		data = append(data, '\n')
+	}
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(cfg.Inventory.Path), 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(cfg.Inventory.Path, data, 0600)
+	}
+	if err != nil {
+		warnings.Add(sink.WarningInventoryFailed, "", "failed to write inventory %s: %v", cfg.Inventory.Path, err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	outcome.Inventory = &inventoryRecord{Path: cfg.Inventory.Path, Filter: inventory.Filter, SnapshotAt: snapshotAt, Devices: len(devices), SHA256: hex.EncodeToString(sum[:])}
+	progress.Printf("Inventory of %d device(s) written to %s\n", len(devices), cfg.Inventory.Path)
+
+	artifact := &sink.Artifact{
+		RunID:    cfg.RunID,
+		Name:     filepath.Base(cfg.Inventory.Path),
+		Path:     cfg.Inventory.Path,
+		Size:     int64(len(data)),
+		SHA256:   outcome.Inventory.SHA256,
+		Metadata: cfg.Metadata(),
+	}
+	for name, err := range sinks.DeliverArtifact(context.Background(), artifact) {
+		warnings.Add(sink.WarningSinkFailed, "", "failed to deliver inventory to sink %s: %v", name, err)
+	}
+}
+
+// inventoryCSV renders devices as csv, with the snapshot time and filter on
+// every row so each row stands on its own.
+func inventoryCSV(snapshotAt, filter string, devices []inventoryDevice) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(inventoryColumns)
+	for _, device := range devices {
+		writer.Write([]string{
+			snapshotAt, filter, device.DeviceID, device.Hostname, device.Platform, device.OSVersion, device.AgentVersion,
+			device.LastSeen, device.Containment, strings.Join(device.Tags, ";"), strings.Join(device.Groups, ";"),
+			device.SerialNumber, device.MACAddress, strconv.FormatBool(device.Targeted), device.RunStatus,
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to render inventory: %w", err)
+	}
+	return buf.Bytes(), nil
+}
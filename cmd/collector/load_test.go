@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/hooks"
+)
+
+// loadHold is how long the test hook keeps each host busy, so that hosts
+// the pool lets run side by side overlap.
+const loadHold = 20 * time.Millisecond
+
+// loads holds, by run ID, the hosts in flight of a load test run.
+var loads sync.Map
+
+type hostLoad struct {
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+// holdLoad keeps host busy for loadHold if its run is a load test run,
+// counting it in flight meanwhile.
+func holdLoad(host *hooks.HostPre) {
+	value, ok := loads.Load(host.RunID)
+	if !ok {
+		return
+	}
+	load := value.(*hostLoad)
+	load.mu.Lock()
+	load.inFlight++
+	load.peak = max(load.peak, load.inFlight)
+	load.mu.Unlock()
+	time.Sleep(loadHold)
+	load.mu.Lock()
+	load.inFlight--
+	load.mu.Unlock()
+}
+
+// TestConcurrencyLoad collects from a dozen simulated hosts under several
+// concurrency blocks and checks that the host pool never runs more hosts at
+// once than configured, that it fills up to that bound, and that api_rate
+// spaces the run's API requests.
+func TestConcurrencyLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test collects from a dozen hosts per case")
+	}
+	const hosts = 12
+	tests := []struct {
+		name           string
+		concurrency    string
+		maxParallelism int
+		wantHosts      int     // Peak hosts in flight
+		wantRate       float64 // Resolved api_rate; 0 for none
+	}{
+		{name: "one host at a time", concurrency: "{hosts: 1}", wantHosts: 1},
+		{name: "three hosts", concurrency: "{hosts: 3}", wantHosts: 3},
+		{name: "more hosts than targets", concurrency: "{hosts: 20}", wantHosts: hosts},
+		// The largest pool, hosts, is scaled from 4 to 2.
+		{name: "max parallelism", concurrency: "{hosts: 4, downloads: 2}", maxParallelism: 2, wantHosts: 2},
+		{name: "api rate", concurrency: "{hosts: 6, api_rate: 200}", wantHosts: 6, wantRate: 200},
+	}
+	output := progress.Output()
+	progress.SetOutput(io.Discard)
+	t.Cleanup(func() { progress.SetOutput(output) })
+
+	var devices []string
+	for i := 0; i < hosts; i++ {
+		devices = append(devices, fmt.Sprintf("{device_id: %032x, hostname: load-%02d, platform: windows}", i+1, i+1))
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			configPath := filepath.Join(dir, "config.yaml")
+			configYAML := fmt.Sprintf(`script_name: collect.ps1
+output_dir: %s
+target: {hostname: "load-*"}
+command_wait: 1ms
+concurrency: %s
+simulation:
+  enabled: true
+  seed: 1
+  latency: 2ms
+  outputs: {collect.ps1: "collected\n"}
+  devices:
+    - %s
+`, dir, test.concurrency, strings.Join(devices, "\n    - "))
+			if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+				t.Fatal(err)
+			}
+			runID := "load-" + strings.ReplaceAll(test.name, " ", "-")
+			load := &hostLoad{}
+			loads.Store(runID, load)
+			defer loads.Delete(runID)
+
+			outcome := &runOutcome{}
+			start := time.Now()
+			err := collect(context.Background(), config.Flags{ConfigPath: configPath, RunID: runID, MaxParallelism: test.maxParallelism}, outcome)
+			elapsed := time.Since(start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if outcome.HostsSucceeded != hosts {
+				t.Fatalf("%d of %d hosts succeeded", outcome.HostsSucceeded, hosts)
+			}
+			if outcome.Concurrency == nil || outcome.Concurrency.Hosts < test.wantHosts {
+				t.Fatalf("outcome concurrency %+v, want at least %d hosts", outcome.Concurrency, test.wantHosts)
+			}
+			if load.peak != test.wantHosts {
+				t.Errorf("%d hosts in flight at most, want %d", load.peak, test.wantHosts)
+			}
+			// The pool bounds the run's length from below as well.
+			if rounds := (hosts + test.wantHosts - 1) / test.wantHosts; elapsed < time.Duration(rounds)*loadHold {
+				t.Errorf("run took %s, less than %d rounds of %s", elapsed, rounds, loadHold)
+			}
+
+			if outcome.Concurrency.APIRate != test.wantRate {
+				t.Errorf("api_rate %g, want %g", outcome.Concurrency.APIRate, test.wantRate)
+			}
+			if test.wantRate > 0 {
+				calls := 0
+				for _, n := range outcome.Metrics.APICalls {
+					calls += n
+				}
+				if least := time.Duration(float64(calls-1) / test.wantRate * float64(time.Second)); elapsed < least {
+					t.Errorf("%d API calls in %s, faster than %g/s allows (%s)", calls, elapsed, test.wantRate, least)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,1283 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/audit"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/console"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr" // Import the rtr package
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/hooks"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/notify"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/rundir"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/runid"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+
+	"github.com/joho/godotenv"
+)
+
+// scriptRetries is how many times a script is re-run after a failure that
+// rtr.ClassifyFailure marks retryable, such as an interrupted session.
+const scriptRetries = 1
+
+// version is the collector version recorded in host receipts, set at build
+// time with -ldflags "-X main.version=<version>".
+var version = "dev"
+
+// progress carries the run's progress output: to stderr, or to --log-file,
+// and nowhere with --quiet.
+var progress = console.New(os.Stderr)
+
+// subcommands are run by name, given the arguments after the name, and
+// return their exit code.
+var subcommands = map[string]func(args []string) int{
+	"config":         runConfigCommand,
+	"profiles":       runProfilesCommand,
+	"healthcheck":    runHealthcheckCommand,
+	"search":         runSearchCommand,
+	"cleanup":        runCleanupCommand,
+	"export":         runExportCommand,
+	"approval":       runApprovalCommand,
+	"tenants":        runTenantsCommand,
+	"scripts":        runScriptsCommand,
+	"support-bundle": runSupportBundleCommand,
+}
+
+func main() {
+	// Load environment variables from .env file when present. A run that
+	// cannot load it still ends with a config error and its run outcome.
+	var setupErr error
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		setupErr = withExitCode(exitConfigError, fmt.Errorf("Configuration Error: loading .env file: %v", err))
+	}
+
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if run, ok := subcommands[args[0]]; ok {
+			if setupErr != nil {
+				log.Print(setupErr)
+				os.Exit(exitCodeFor(setupErr))
+			}
+			os.Exit(run(args[1:]))
+		}
+	}
+
+	flags := config.Flags{}
+	flagSet := flag.NewFlagSet("crowdstrike-data-collector", flag.ContinueOnError)
+	registerConfigFlags(flagSet, &flags)
+	flagSet.StringVar(&flags.RunID, "run-id", "", "Correlation ID for this run (default: a generated UUIDv7)")
+	flagSet.StringVar(&flags.ApprovalToken, "approval-token", "", "Change-control approval token for this run's plan (default: $APPROVAL_TOKEN)")
+	flagSet.Float64Var(&flags.FailOnWarnings, "fail-on-warnings", 0, "Exit with a partial failure when at least this fraction of hosts raised warnings, e.g. 0.1 (default: fail_on_warnings)")
+	flagSet.BoolVar(&flags.ForceDestructive, "force-destructive", false, "Run destructive_commands without the interactive confirmation, e.g. from CI")
+	flagSet.BoolVar(&flags.Follow, "follow", false, "Print the script's output as it arrives")
+	flagSet.BoolVar(&flags.NoHints, "no-hints", false, "Leave remediation hints out of error output and reports, for machine consumption")
+	flagSet.BoolVar(&flags.IncludeQuarantined, "include-quarantined", false, "Attempt devices the circuit breaker quarantined in earlier runs")
+	flagSet.BoolVar(&flags.TUI, "tui", false, "Show a live dashboard of the run on the terminal instead of scrolling progress output")
+	flagSet.StringVar(&flags.FollowHosts, "follow-hosts", "", "Comma-separated device IDs to --follow; required when the run targets more than one host")
+	outcomePath := flagSet.String("outcome-file", "", "Where to write the run-outcome JSON: a path or fd:N (default: $COLLECTOR_OUTCOME_FILE or "+defaultOutcomePath+")")
+	stats := flagSet.Bool("stats", false, "Print the run's metrics as a table at the end")
+	metricsPath := flagSet.String("metrics-textfile", "", "Also write the run outcome as an OpenMetrics .prom file for the node_exporter textfile collector (default: $COLLECTOR_METRICS_TEXTFILE)")
+	format := flagSet.String("format", "", "Write machine output to stdout: json (run outcome), jsonl (one result per host) or csv; text writes the human summary (default: $COLLECTOR_FORMAT or text)")
+	logPath := flagSet.String("log-file", "", "Append progress output to this file instead of stderr (default: $COLLECTOR_LOG_FILE)")
+	logMaxBytes := flagSet.Int64("log-max-bytes", 0, "Rotate --log-file before it grows past this many bytes; 0 never rotates (default: $COLLECTOR_LOG_MAX_BYTES)")
+	logMaxFiles := flagSet.Int64("log-max-files", 5, "Rotated log files to keep, 0 for all (default: $COLLECTOR_LOG_MAX_FILES or 5)")
+	logCompress := flagSet.Bool("log-compress", os.Getenv("COLLECTOR_LOG_COMPRESS") != "", "Gzip rotated log files (default: set when $COLLECTOR_LOG_COMPRESS is)")
+	quiet := flagSet.Bool("quiet", false, "Suppress progress output; errors are still reported")
+	noColor := flagSet.Bool("no-color", os.Getenv("NO_COLOR") != "", "Strip ANSI escape sequences from progress output (default: set when $NO_COLOR is)")
+	if err := flagSet.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(exitSucceeded)
+		}
+		// The flag package has printed the error and the usage.
+		setupErr = cmp.Or(setupErr, withExitCode(exitConfigError, fmt.Errorf("Configuration Error: %v", err)))
+	}
+
+	// Progress goes to stderr or --log-file; stdout carries only the
+	// machine output, or the human summary without one.
+	if *format == "" {
+		*format = os.Getenv("COLLECTOR_FORMAT")
+	}
+	if *format == "" {
+		*format = "text"
+	}
+	if !slices.Contains(outputFormats, *format) {
+		log.Printf("Configuration Error: unknown --format %q (expected %s)", *format, strings.Join(outputFormats, ", "))
+		os.Exit(exitConfigError)
+	}
+	if *logPath == "" {
+		*logPath = os.Getenv("COLLECTOR_LOG_FILE")
+	}
+	for name, env := range map[string]string{"log-max-bytes": "COLLECTOR_LOG_MAX_BYTES", "log-max-files": "COLLECTOR_LOG_MAX_FILES"} {
+		if err := int64FromEnv(flagSet, name, env); err != nil {
+			log.Printf("Configuration Error: %v", err)
+			os.Exit(exitConfigError)
+		}
+	}
+	var logFile *console.RotatingFile
+	if *logPath != "" {
+		var err error
+		logFile, err = console.OpenRotating(*logPath, console.RotateOptions{MaxBytes: *logMaxBytes, MaxFiles: int(*logMaxFiles), Compress: *logCompress})
+		if err != nil {
+			log.Printf("Configuration Error: %v", err)
+			os.Exit(exitConfigError)
+		}
+		defer logFile.Close()
+		progress.SetOutput(logFile)
+		log.SetOutput(logFile)
+	}
+	progress.SetQuiet(*quiet)
+	progress.SetNoColor(*noColor)
+
+	if flags.RunID == "" {
+		flags.RunID = runid.New()
+	} else if err := runid.Validate(flags.RunID); err != nil {
+		log.Printf("Configuration Error: %v", err)
+		os.Exit(exitConfigError)
+	}
+	log.SetPrefix(fmt.Sprintf("[run %s] ", flags.RunID))
+	progress.Printf("Run ID: %s\n", flags.RunID)
+
+	if *outcomePath == "" {
+		*outcomePath = os.Getenv("COLLECTOR_OUTCOME_FILE")
+	}
+	if *metricsPath == "" {
+		*metricsPath = os.Getenv("COLLECTOR_METRICS_TEXTFILE")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	outcome := &runOutcome{RunID: flags.RunID, Profile: flags.Profile, Script: flags.ScriptName, StartedAt: time.Now().UTC()}
+	runErr := setupErr
+	if runErr == nil {
+		runErr = collect(ctx, flags, outcome)
+	}
+	outcome.FinishedAt = time.Now().UTC()
+	if logFile != nil {
+		outcome.LogFile, outcome.LogRotations = logFile.Path(), logFile.Rotations()
+	}
+	outcome.ExitCode = exitCodeFor(runErr)
+	outcome.Status = outcomeStatuses[outcome.ExitCode]
+	if runErr != nil {
+		outcome.Error = runErr.Error()
+		outcome.Hint = failureHint(flags.NoHints, nil, runErr)
+	}
+
+	if *outcomePath == "" {
+		*outcomePath = defaultOutcomePath
+		if outcome.runDir != nil {
+			*outcomePath = filepath.Join(outcome.runDir.Path, defaultOutcomePath)
+		}
+	}
+	if err := writeOutcome(*outcomePath, outcome); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write run outcome: %v\n", err)
+	}
+	if outcome.runDir != nil {
+		if err := outcome.runDir.MarkLatest(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		outcome.runDir.Release()
+	}
+	if *metricsPath != "" {
+		if err := writeMetricsTextfile(*metricsPath, outcome); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write metrics textfile: %v\n", err)
+		}
+	}
+	if *format == "text" {
+		writeSummary(os.Stdout, outcome, *stats)
+	} else {
+		writeSummary(progress.Writer(), outcome, *stats)
+		if err := writeMachineOutput(os.Stdout, *format, outcome); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write %s output: %v\n", *format, err)
+		}
+	}
+
+	if runErr != nil {
+		log.Printf("%v (exit code %d)", runErr, outcome.ExitCode)
+		if outcome.Hint != "" {
+			log.Printf("Hint: %s", outcome.Hint)
+		}
+		os.Exit(outcome.ExitCode)
+	}
+	progress.Println("\n--- Application Finished ---")
+}
+
+// int64FromEnv sets the integer flag name from the environment variable env
+// when the flag was not given on the command line.
+func int64FromEnv(flagSet *flag.FlagSet, name, env string) error {
+	value := os.Getenv(env)
+	if value == "" {
+		return nil
+	}
+	explicit := false
+	flagSet.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == name })
+	if explicit {
+		return nil
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+		return fmt.Errorf("%s must be an integer, got %q", env, value)
+	}
+	return flagSet.Set(name, value)
+}
+
+// hostRun is the outcome of the collection on one host. err is set when the
+// host failed or, with heldBy naming the holder of its live session, was
+// skipped as busy; timing holds the host's stages and warnings its warnings.
+type hostRun struct {
+	deviceID    string
+	result      *sink.Result
+	err         error
+	heldBy      string
+	unmet       bool                // Skipped for failing its prerequisites
+	vetoed      bool                // Skipped by a host_pre hook
+	quarantined bool                // Skipped as quarantined by the circuit breaker
+	circuit     *sink.CircuitState  // Set when the circuit breaker stopped attempting the device
+	labels      map[string]string   // Added by host_pre hooks
+	hooks       []sink.HookOutcome  // Host hooks called for the host
+	target      *sink.TargetMapping // Identifier the device was resolved from, if any
+	replaced    *sink.Replacement   // Set when the device ID was stale and deviceID is its replacement
+	timing      *sink.Timing
+	warnings    *sink.Warnings
+}
+
+// hostWarnings returns the warnings of host: its own and the run-level
+// warnings about its device.
+func hostWarnings(host hostRun, runWarnings []sink.Warning) []sink.Warning {
+	warnings := host.warnings.List()
+	for _, warning := range runWarnings {
+		if warning.DeviceID == host.deviceID {
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
+
+// warningsError fails the run as a partial failure when at least threshold
+// of the hosts that were collected raised warnings.
+func warningsError(hosts []hostRun, runWarnings []sink.Warning, threshold float64) (warned int, err error) {
+	collected := 0
+	for _, host := range hosts {
+		if host.skipped() {
+			continue
+		}
+		collected++
+		if len(hostWarnings(host, runWarnings)) > 0 {
+			warned++
+		}
+	}
+	if threshold <= 0 || collected == 0 || float64(warned)/float64(collected) < threshold {
+		return warned, nil
+	}
+	return warned, withExitCode(exitPartialFailure, fmt.Errorf("%d of %d hosts raised warnings, at or above fail_on_warnings %g", warned, collected, threshold))
+}
+
+// skipped reports whether the host was skipped as busy, for failing its
+// prerequisites, as quarantined or by a hook.
+func (h hostRun) skipped() bool {
+	return h.heldBy != "" || h.unmet || h.quarantined || h.vetoed
+}
+
+// collect loads the configuration, runs the collection and delivers the
+// per-host results to the configured sinks and notifiers. Host counts and
+// the approval reference are recorded in outcome.
+func collect(ctx context.Context, flags config.Flags, outcome *runOutcome) error {
+	cfg, err := loadConfig(flags)
+	if err == nil {
+		err = cfg.CheckMetadata()
+	}
+	if err != nil {
+		return withExitCode(exitConfigError, fmt.Errorf("Configuration Error: %v", err))
+	}
+	outcome.Profile, outcome.Script = cfg.Profile, cfg.ScriptName
+	outcome.Metadata = cfg.Metadata()
+	outcome.Concurrency = &cfg.Concurrency
+	progress.Printf("Concurrency: %s\n", cfg.Concurrency)
+	for _, warning := range cfg.Concurrency.Warnings() {
+		progress.Printf("Warning: %s.\n", warning)
+	}
+	if cfg.RunDirs.Enabled {
+		dir, err := rundir.Acquire(ctx, cfg.RunDirs.Parent, cfg.RunID, rundir.Options{OnLocked: cfg.RunDirs.OnLocked, Wait: time.Duration(cfg.RunDirs.Wait), Console: progress})
+		if errors.Is(err, rundir.ErrLocked) {
+			return withExitCode(exitPolicyRejected, fmt.Errorf("Run Directory Error: %v", err))
+		}
+		if err != nil {
+			return withExitCode(exitConfigError, fmt.Errorf("Run Directory Error: %v", err))
+		}
+		outcome.runDir, outcome.RunDir = dir, dir.Path
+		if !dir.Locked {
+			progress.Printf("Warning: %s is locked by another run; writing to %s without the lock (run_dirs.on_locked: new).\n", dir.Parent, dir.Path)
+		}
+		progress.Printf("Run directory: %s\n", dir.Path)
+	}
+	if outcome.Metadata != nil {
+		progress.Printf("Run metadata: %s\n", formatMetadata(outcome.Metadata))
+	}
+	identity := audit.Identity{RunID: cfg.RunID, Profile: cfg.Profile}
+	if outcome.Metadata != nil {
+		identity.Metadata = *outcome.Metadata
+	}
+	auditLog, err := audit.Open(filepath.Join(cfg.OutputDir, audit.FileName(cfg.Profile)), identity)
+	if err != nil {
+		return withExitCode(exitConfigError, fmt.Errorf("Audit Log Error: %v", err))
+	}
+	outcome.audit, outcome.AuditLog = auditLog, auditLog.Path()
+	auditLog.Record(audit.Record{Event: audit.EventRunStarted, Details: map[string]string{"script": cfg.ScriptName}})
+	if registered := hooks.Registered(); len(registered) > 0 {
+		progress.Printf("Hooks: %s\n", strings.Join(registered, ", "))
+	}
+
+	notifier, err := notify.NewSMTPNotifier(cfg.SMTP)
+	if err != nil {
+		return withExitCode(exitConfigError, fmt.Errorf("Configuration Error: %v", err))
+	}
+	if notifier != nil && notifier.InsecureSkipVerify {
+		progress.Println("Warning: SMTP TLS certificate verification is disabled (smtp.insecure_skip_verify).")
+	}
+
+	sinks, err := sink.Build(cfg.Sinks)
+	if err == nil {
+		sinks.LimitDeliveries(cfg.Concurrency.SinkDeliveries)
+		err = sinks.Start(ctx)
+	}
+	if err != nil {
+		return withExitCode(exitConfigError, fmt.Errorf("Configuration Error: %v", err))
+	}
+
+	summary := &notify.Summary{RunID: cfg.RunID, Status: "succeeded", ReportName: "status.json", Metadata: outcome.Metadata}
+	timing := &sink.Timing{}
+	warnings := &sink.Warnings{Console: progress}
+	hosts, runErr := run(ctx, cfg, summary, timing, warnings, outcome)
+	outcome.Approval = summary.ApprovalReference
+
+	summary.Stages = timing.Stages()
+	var durations []time.Duration
+	failed, skipped := 0, 0
+	for _, host := range hosts {
+		summary.Stages = append(summary.Stages, host.timing.Stages()...)
+		if host.result != nil && host.result.Receipt != nil {
+			if host.result.Receipt.Status == "placed" {
+				summary.ReceiptsPlaced++
+			} else {
+				summary.ReceiptsFailed++
+			}
+		}
+		switch {
+		case host.skipped():
+			skipped++
+			continue
+		case host.err != nil:
+			failed++
+		}
+		durations = append(durations, host.timing.Elapsed())
+	}
+	summary.HostDurationP50 = sink.Percentile(durations, 50)
+	summary.HostDurationP95 = sink.Percentile(durations, 95)
+	if runErr == nil {
+		runErr = hostsError(hosts, failed, skipped)
+	}
+	warned, warnErr := warningsError(hosts, warnings.List(), cfg.FailOnWarnings)
+	if runErr == nil {
+		runErr = warnErr
+	}
+	outcome.HostsWarned = warned
+	outcome.HostsTotal, outcome.HostsFailed, outcome.HostsSkipped = len(hosts), failed, skipped
+	outcome.HostsSucceeded = len(hosts) - failed - skipped
+	outcome.ReceiptsPlaced, outcome.ReceiptsFailed = summary.ReceiptsPlaced, summary.ReceiptsFailed
+	summary.CircuitOpen = circuitSummary(hosts)
+	outcome.CircuitOpen = summary.CircuitOpen
+	if len(hosts) == 0 && runErr != nil {
+		switch exitCodeFor(runErr) {
+		case exitConfigError, exitPolicyRejected, exitApprovalDenied:
+			// Config and policy errors abort before any host is contacted.
+		default:
+			// The run failed before any host was attempted; count the target as failed.
+			outcome.HostsTotal, outcome.HostsFailed = 1, 1
+		}
+	}
+	if runErr != nil {
+		summary.Status = "failed"
+		if exitCodeFor(runErr) == exitInterrupted {
+			// Cancelled hosts are reported apart from failed ones.
+			summary.Status = "cancelled"
+		}
+		summary.FailureCount = max(failed+skipped, 1)
+		summary.Error = runErr.Error()
+		summary.Hint = failureHint(cfg.NoHints, nil, runErr)
+	}
+
+	// Host hooks are only called for hosts the run got to.
+	attempted := len(hosts) > 0
+	if !attempted {
+		hosts = []hostRun{{deviceID: cfg.DeviceID, err: runErr, timing: &sink.Timing{}}}
+	}
+	var hookErr error
+	for _, host := range hosts {
+		result := host.result
+		if result == nil {
+			result = &sink.Result{RunID: cfg.RunID, CID: summary.CID, DeviceID: host.deviceID}
+		}
+		result.Status = hostStatus(host.err)
+		switch {
+		case host.unmet:
+			result.Status = "precondition_failed"
+		case host.vetoed:
+			result.Status = "skipped_by_hook"
+		case host.circuit != nil:
+			result.Status, result.Circuit = "circuit_open", host.circuit
+		case host.skipped():
+			result.Status, result.HeldBy = "busy", host.heldBy
+		}
+		if host.err != nil {
+			result.Error = host.err.Error()
+		}
+		result.Hint = failureHint(cfg.NoHints, result, host.err)
+		result.CollectedAt = time.Now().UTC()
+		result.Stages = host.timing.Stages()
+		result.DurationMS = host.timing.Elapsed().Milliseconds()
+		result.APICalls = summary.APICalls
+		result.Approval = summary.ApprovalReference
+		result.Metadata = outcome.Metadata
+		result.Target = host.target
+		result.Replaced = host.replaced
+		result.Labels = mergeLabels(outcome.labels, host.labels)
+		result.Hooks = host.hooks
+		if attempted {
+			if err := hostPostHooks(cfg, host, result); err != nil && hookErr == nil {
+				hookErr = err
+			}
+		}
+		result.Warnings = hostWarnings(host, warnings.List())
+		sink.SortWarnings(result.Warnings)
+		sink.SortResourceErrors(result.Errors)
+		outcome.results = append(outcome.results, result)
+		// Deliver even when interrupted so the sinks record the outcome.
+		for name, err := range sinks.DeliverResult(context.Background(), result) {
+			warnings.Add(sink.WarningSinkFailed, host.deviceID, "failed to deliver result to sink %s: %v", name, err)
+		}
+	}
+	if outcome.inventory != nil {
+		writeInventory(cfg, summary.CID, outcome.inventory, outcome, sinks, warnings)
+	}
+	// Drain buffered sinks before the outcome and the email are finalized,
+	// so both carry the delivery status; the run's context may already be
+	// cancelled by a signal, so the drain is bounded by its own timeout.
+	sinks.Shutdown(context.Background(), time.Duration(cfg.SinkDrainTimeout))
+	outcome.Sinks = sinks.Status()
+	summary.Sinks = outcome.Sinks
+	for _, status := range outcome.Sinks {
+		if status.Dropped > 0 {
+			warnings.Add(sink.WarningSinkFailed, "", "sink %s dropped %d undelivered entries at shutdown", status.Sink, status.Dropped)
+		}
+	}
+
+	if err := postRunHooks(cfg, summary, outcome, warnings); err != nil && hookErr == nil {
+		hookErr = err
+	}
+	if hookErr != nil && runErr == nil {
+		// The results are out; an aborting hook fails the run after the fact.
+		runErr = hookErr
+		summary.Status, summary.Error, summary.FailureCount = "failed", runErr.Error(), 1
+	}
+
+	auditLog.Record(audit.Record{Event: audit.EventRunFinished, Details: map[string]string{"status": summary.Status}, Error: summary.Error})
+	if err := auditLog.Close(); err != nil {
+		warnings.Add(sink.WarningAuditLogFailed, "", "%v", err)
+	}
+
+	writeReport(cfg, summary, outcome, warnings)
+	summary.Warnings = warnings.List()
+	for _, host := range hosts {
+		summary.Warnings = append(summary.Warnings, host.warnings.List()...)
+	}
+	sink.SortWarnings(summary.Warnings)
+	outcome.Warnings = sink.CountWarnings(summary.Warnings)
+
+	if notifier != nil {
+		if err := notifier.Notify(summary); err != nil {
+			progress.Printf("Failed to send email notification: %v\n", err)
+		} else {
+			progress.Println("Email notification sent.")
+		}
+	}
+
+	return runErr
+}
+
+// hostsError turns per-host failures into the run's error: the host's own
+// error when every host failed, a partial failure when some succeeded, and
+// a policy rejection when every host that did not fail was skipped.
+// An interrupted host interrupts the run.
+func hostsError(hosts []hostRun, failed, skipped int) error {
+	for _, host := range hosts {
+		if exitCodeFor(host.err) == exitInterrupted {
+			return host.err
+		}
+	}
+	switch {
+	case failed+skipped == 0:
+		return nil
+	case failed+skipped < len(hosts):
+		return withExitCode(exitPartialFailure, fmt.Errorf("%d of %d hosts failed, %d skipped (busy, failing prerequisites, quarantined or vetoed by a hook)", failed, len(hosts), skipped))
+	case failed == 0:
+		return withExitCode(exitPolicyRejected, fmt.Errorf("all %d host(s) skipped: busy with another RTR session, failing prerequisites, quarantined or vetoed by a hook", skipped))
+	case len(hosts) == 1:
+		return hosts[0].err
+	}
+	return withExitCode(exitAllFailed, fmt.Errorf("%d of %d hosts failed, %d skipped (busy, failing prerequisites, quarantined or vetoed by a hook); first error: %v", failed, len(hosts), skipped, firstError(hosts)))
+}
+
+// firstError returns the error of the first host that failed outright.
+func firstError(hosts []hostRun) error {
+	for _, host := range hosts {
+		if host.err != nil && !host.skipped() {
+			return host.err
+		}
+	}
+	return nil
+}
+
+// hostStatus names a host's outcome in sink results.
+func hostStatus(err error) string {
+	switch {
+	case err == nil:
+		return "succeeded"
+	case exitCodeFor(err) == exitInterrupted:
+		return "cancelled"
+	}
+	return "failed"
+}
+
+// run authenticates, resolves and approves the targets, then runs the
+// collection on each host in turn and returns the per-host outcomes. The
+// returned error is reserved for failures that stop the whole run; run-level
+// steps are timed into timing, run-level warnings go to warnings, and the
+// files it names are recorded in outcome.
+func run(ctx context.Context, cfg *config.Config, summary *notify.Summary, timing *sink.Timing, warnings *sink.Warnings, outcome *runOutcome) ([]hostRun, error) {
+	if err := checkTargetSource(cfg); err != nil {
+		return nil, err
+	}
+
+	// Create a new CrowdStrikeRTRClient instance
+	rtrClient, err := newClient(cfg, rtr.WithAuditLog(outcome.audit))
+	if err != nil {
+		return nil, withExitCode(exitConfigError, fmt.Errorf("Configuration Error: %v", err))
+	}
+	rtrClient.Warnings = warnings
+	summary.DeviceID = rtrClient.DefaultDeviceID
+	defer func() {
+		summary.APICalls = rtrClient.Budget.Counts()
+		if err := rtrClient.Breaker.Save(); err != nil {
+			warnings.Add(sink.WarningQuarantineFailed, "", "%v", err)
+		}
+		metrics := rtrClient.Metrics.Snapshot()
+		outcome.Metrics = &metrics
+		outcome.Names = fileNames(cfg, summary, rtrClient.NamedFiles(), rtrClient.RenamedFiles())
+		progress.Printf("API calls: %d (%s)\n", rtrClient.Budget.Total(), rtr.FormatCallCounts(summary.APICalls))
+		if throttled := rtrClient.Throttle.Stats(); throttled.Pauses > 0 {
+			outcome.ThrottlePauses, outcome.ThrottledMS = throttled.Pauses, throttled.PausedFor.Milliseconds()
+			progress.Printf("Throttled: %d pauses, %s paused\n", throttled.Pauses, throttled.PausedFor.Round(time.Second))
+		}
+	}()
+
+	// 1. Get Authentication Token
+	progress.Println("--- Step 1: Getting Authentication Token ---")
+	authDone := timing.Start("authentication")
+	authenticated := rtrClient.GetAuthToken()
+	authDone()
+	if !authenticated {
+		return nil, withExitCode(exitConfigError, fmt.Errorf("Failed to get authentication token. Exiting."))
+	}
+	progress.Println("Authentication token obtained successfully.")
+
+	if err := checkCID(ctx, rtrClient, cfg, summary); err != nil {
+		return nil, err
+	}
+
+	// Capabilities: features the credentials cannot back are refused up
+	// front. Only the read scopes are probed until the run is approved.
+	caps, err := rtrClient.DetectCapabilities(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to detect API capabilities: %v", err)
+	}
+	if cfg.Target.Hostname != "" && !caps.HostsRead {
+		return nil, withExitCode(exitConfigError, fmt.Errorf("Scope Error: target.hostname needs Hosts: Read, which the API client lacks"))
+	}
+	if cfg.Inventory.Enabled && !caps.HostsRead {
+		return nil, withExitCode(exitConfigError, fmt.Errorf("Scope Error: inventory.enabled needs Hosts: Read, which the API client lacks"))
+	}
+	if cfg.Target.ByIdentifier() && !caps.HostsRead {
+		return nil, withExitCode(exitConfigError, fmt.Errorf("Scope Error: targeting by serial or MAC needs Hosts: Read, which the API client lacks"))
+	}
+
+	selectDone := timing.Start("target_selection")
+	deviceIDs, mappings, err := targets(ctx, rtrClient, cfg)
+	selectDone()
+	if err != nil {
+		return nil, err
+	}
+	deviceIDs, err = preRunHooks(ctx, rtrClient, cfg, deviceIDs, mappings, warnings, outcome)
+	if err != nil {
+		return nil, err
+	}
+	outcome.inventory = snapshotInventory(ctx, rtrClient, cfg, timing, warnings)
+	outcome.Targets = mappings
+	summary.DeviceID = strings.Join(deviceIDs, ", ")
+	if err := nameReport(cfg, summary, deviceIDs); err != nil {
+		return nil, withExitCode(exitConfigError, fmt.Errorf("Configuration Error: naming.report: %v", err))
+	}
+	if err := checkFollow(cfg, deviceIDs); err != nil {
+		return nil, err
+	}
+
+	// Change control: no command endpoint beyond read-only is touched, not
+	// even to probe its scope, without approval.
+	plan := runPlan(rtrClient, cfg, deviceIDs, mappings)
+	if err := approve(ctx, cfg, plan, summary); err != nil {
+		return nil, err
+	}
+	if caps, err = detectCapabilities(ctx, rtrClient, caps); err != nil {
+		return nil, err
+	}
+	outcome.Capabilities = capabilityReport(caps)
+	summary.Capabilities, summary.Disabled = caps.Scopes(), caps.Disabled()
+	if rtrClient.Sandbox != nil {
+		if err := caps.CheckSandbox(); err != nil {
+			return nil, withExitCode(exitConfigError, fmt.Errorf("Scope Error: sandbox.enabled needs sandbox submission: %v", err))
+		}
+	}
+	if err := checkPlan(caps, plan); err != nil {
+		return nil, err
+	}
+	if err := verifyScript(ctx, rtrClient, cfg, timing, warnings, outcome); err != nil {
+		return nil, err
+	}
+	receipts, err := newReceiptStep(rtrClient, cfg, caps)
+	if err != nil {
+		return nil, err
+	}
+	if err := confirmDestructive(ctx, rtrClient, cfg, caps, plan, outcome); err != nil {
+		return nil, err
+	}
+
+	// Preflight: don't step on live incident-response work.
+	busy := busyHosts(ctx, rtrClient, cfg, deviceIDs)
+
+	var hosts []hostRun
+	// Files retrieved from the hosts are post-processed in the background;
+	// the findings join each host's result once the collection is done.
+	defer attachFindings(rtrClient, &hosts)
+
+	// Up to concurrency.hosts hosts are collected at once. Each keeps its
+	// place in deviceIDs; a host left undispatched by an interrupt or an
+	// exhausted call budget is not in hosts.
+	queue := newDispatch(deviceIDs)
+	ctx, dashboard := startDashboard(ctx, rtrClient, cfg, queue)
+	slots := make(chan struct{}, max(cfg.Concurrency.Hosts, 1))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var stopErr error
+	stopped := false
+	for i, deviceID := range deviceIDs {
+		slots <- struct{}{}
+		queue.wait(ctx)
+		mu.Lock()
+		halt := stopped
+		mu.Unlock()
+		if halt {
+			break
+		}
+		if err := interrupted(ctx); err != nil {
+			mu.Lock()
+			stopErr = err
+			mu.Unlock()
+			break
+		}
+		if len(deviceIDs) > 1 {
+			progress.Printf("\n=== Host %d of %d: %s ===\n", i+1, len(deviceIDs), deviceID)
+		}
+		queue.start(i)
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+			// Hosts collected side by side each fill their own summary.
+			hostSummary := &notify.Summary{CID: summary.CID}
+			host := collectHost(ctx, rtrClient, cfg, deviceID, deviceIDs, mappings, busy, hostSummary, receipts)
+			mu.Lock()
+			defer mu.Unlock()
+			mergeHostSummary(summary, hostSummary)
+			queue.finish(i, &host)
+			if (rtrClient.Budget.Exceeded() || errors.Is(host.err, hooks.ErrAbort)) && !stopped {
+				// Later hosts would fail the same way, or a hook stopped the run.
+				stopped, stopErr = true, host.err
+			}
+		}()
+	}
+	wg.Wait()
+	dashboard.stop()
+	hosts = queue.hosts()
+	return hosts, stopErr
+}
+
+// collectHost collects from one host of the run: it waits for the host's
+// busy sessions per busy_policy, runs the script and, when the device ID
+// has gone stale, retries under its replacement. The host's session and
+// cloud request go to summary, which is the host's own.
+func collectHost(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config, deviceID string, deviceIDs []string, mappings []sink.TargetMapping,
+	busy map[string][]rtr.AuditSession, summary *notify.Summary, receipts *receiptStep) hostRun {
+	host := hostRun{deviceID: deviceID, target: resolvedFrom(mappings, deviceID), timing: &sink.Timing{}, warnings: &sink.Warnings{Console: progress}}
+	if skipQuarantined(rtrClient, cfg, &host) {
+		progress.Printf("Host %s skipped: quarantined by the circuit breaker until %s\n", deviceID, host.circuit.QuarantinedUntil)
+		return host
+	}
+	if sessions := busy[deviceID]; len(sessions) > 0 {
+		waitDone := host.timing.Start("busy_wait")
+		host.heldBy = awaitIdle(ctx, rtrClient, cfg, deviceID, sessions)
+		waitDone()
+	}
+	if host.skipped() {
+		host.err = fmt.Errorf("device %s skipped: busy with an RTR session held by %s", deviceID, host.heldBy)
+		return host
+	}
+	if host.err = hostPreHooks(ctx, cfg, &host); host.err != nil {
+		return host
+	}
+	host.result, host.err = runHost(ctx, rtrClient, cfg, deviceID, summary, receipts, host.timing, host.warnings)
+	if errors.Is(host.err, rtr.ErrDeviceNotFound) {
+		replaceStaleDevice(ctx, rtrClient, cfg, &host, deviceIDs, summary, receipts)
+	}
+	host.unmet = errors.Is(host.err, errPreconditionFailed)
+	if errors.Is(host.err, rtr.ErrCircuitOpen) {
+		if state, ok := rtrClient.Breaker.State(host.deviceID); ok {
+			host.circuit = circuitState(state)
+		}
+	}
+	if host.err != nil && len(deviceIDs) > 1 {
+		progress.Printf("Host %s failed: %v\n", host.deviceID, host.err)
+		if hint := failureHint(cfg.NoHints, host.result, host.err); hint != "" {
+			progress.Printf("  Hint: %s\n", hint)
+		}
+	}
+	return host
+}
+
+// mergeHostSummary makes the session and cloud request a host recorded the
+// run summary's, as the latest host's are. The report covers every host and
+// is built once the run is done (see writeReport).
+func mergeHostSummary(summary, host *notify.Summary) {
+	if host.SessionID != "" {
+		summary.SessionID = host.SessionID
+	}
+	if host.CloudRequestID != "" {
+		summary.CloudRequestID = host.CloudRequestID
+	}
+}
+
+// replaceStaleDevice handles a host whose device ID the API no longer
+// knows, as after a sensor reinstall. When the host was targeted by serial,
+// MAC or hostname, that identifier is resolved once more and, if one other
+// device now carries it, the collection is retried there; the substitution
+// is a device_replaced warning and appears in the result and the target
+// mapping. A replacement that is a target of the run already is not
+// collected from twice. A device ID given directly fails with a hint to
+// re-resolve it.
+func replaceStaleDevice(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config, host *hostRun, deviceIDs []string, summary *notify.Summary, receipts *receiptStep) {
+	kind, value := "", ""
+	switch {
+	case host.target != nil:
+		kind, value = host.target.Kind, host.target.Identifier
+	case cfg.Target.Hostname != "":
+		if known, ok := rtrClient.KnownHost(host.deviceID); ok && known.Hostname != "" {
+			kind, value = rtr.IdentifierHostname, known.Hostname
+		}
+	}
+	if kind == "" {
+		host.err = fmt.Errorf("%w; the device ID may be stale after a sensor reinstall: target the host by --hostname, --serial or --mac so it can be re-resolved, or look up its current device ID", host.err)
+		return
+	}
+	progress.Printf("Device %s was not found; re-resolving %s %s...\n", host.deviceID, kind, value)
+	replacement, err := rtrClient.FindReplacement(ctx, host.deviceID, kind, value)
+	if err != nil {
+		host.err = fmt.Errorf("%w; re-resolving %s %s failed: %v", host.err, kind, value, err)
+		return
+	}
+	if slices.Contains(deviceIDs, replacement.DeviceID) {
+		host.err = fmt.Errorf("%w; %s %s now resolves to device %s, which the run targets as well", host.err, kind, value, replacement.DeviceID)
+		return
+	}
+	host.replaced = &sink.Replacement{StaleDeviceID: host.deviceID, DeviceID: replacement.DeviceID, Kind: kind, Identifier: value}
+	host.warnings.Add(sink.WarningDeviceReplaced, replacement.DeviceID, "device %s was not found; %s %s now resolves to device %s (%s)",
+		host.deviceID, kind, value, replacement.DeviceID, replacement.Hostname)
+	host.deviceID = replacement.DeviceID
+	if host.target != nil {
+		host.target.DeviceID, host.target.Hostname = replacement.DeviceID, replacement.Hostname
+	}
+	host.result, host.err = runHost(ctx, rtrClient, cfg, replacement.DeviceID, summary, receipts, host.timing, host.warnings)
+}
+
+// attachFindings waits for the post-processing of the files retrieved from
+// hosts and attaches each host's findings to its result. A file whose
+// processing failed is a postprocess_failed warning, not a host failure.
+func attachFindings(rtrClient *rtr.CrowdStrikeRTRClient, hosts *[]hostRun) {
+	if rtrClient.PostProcess == nil {
+		return
+	}
+	rtrClient.PostProcess.Wait()
+	for _, host := range *hosts {
+		if host.result == nil {
+			continue
+		}
+		host.result.Artifacts = rtrClient.PostProcess.Findings(host.deviceID)
+		for _, artifact := range host.result.Artifacts {
+			if artifact.Incomplete {
+				host.warnings.Add(sink.WarningPostProcessFailed, host.deviceID, "post-processing of %s is incomplete: %s", artifact.Path, strings.Join(artifact.Errors, "; "))
+			}
+		}
+	}
+}
+
+// verifyScript refuses the run when the configured script, or one of its
+// platform_scripts, is pinned in script_pins_file and no longer matches its
+// pin, or cannot be checked. A mismatch is recorded as a security finding.
+func verifyScript(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config, timing *sink.Timing, warnings *sink.Warnings, outcome *runOutcome) error {
+	scripts := []string{cfg.ScriptName}
+	for _, script := range rtrClient.PlatformScripts {
+		if !slices.Contains(scripts, script) {
+			scripts = append(scripts, script)
+		}
+	}
+	slices.Sort(scripts[1:])
+	for _, script := range scripts {
+		if _, pinned := rtrClient.ScriptPins[script]; !pinned {
+			continue
+		}
+		verifyDone := timing.Start("script_verify")
+		err := rtrClient.VerifyScript(ctx, script)
+		verifyDone()
+		if errors.Is(err, rtr.ErrScriptPinMismatch) {
+			warnings.Add(sink.WarningScriptPinMismatch, "", "%v", err)
+			outcome.SecurityFindings = append(outcome.SecurityFindings, err.Error())
+		}
+		if err != nil {
+			return withExitCode(exitPolicyRejected, fmt.Errorf("Integrity Error: %v", err))
+		}
+	}
+	return nil
+}
+
+// checkTargetSource refuses a run that names no target hosts, before any
+// API call, listing the settings that name them. Simulations default to
+// their first device.
+func checkTargetSource(cfg *config.Config) error {
+	if cfg.TargetSource() != "" || cfg.Simulation.Enabled {
+		return nil
+	}
+	return withExitCode(exitConfigError, fmt.Errorf("Configuration Error: no target hosts given. Name them with one of:\n  - %s", strings.Join(config.TargetSources, "\n  - ")))
+}
+
+// targets resolves the devices to collect from: the hosts named by serial
+// number or MAC address, the hosts matched by the target selector, or else
+// the configured device. Targeting by identifier also returns the mapping
+// of each identifier to its device.
+func targets(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config) ([]string, []sink.TargetMapping, error) {
+	if cfg.Target.ByIdentifier() {
+		return resolveTargets(ctx, rtrClient, cfg)
+	}
+	if cfg.Target.Hostname == "" {
+		return []string{rtrClient.DefaultDeviceID}, nil, nil
+	}
+	if cfg.DeviceID != "" {
+		progress.Printf("Warning: target.hostname is set, ignoring device_id %s.\n", cfg.DeviceID)
+	}
+	selection, err := rtrClient.SelectHosts(ctx, rtr.HostSelector{
+		Pattern:       cfg.Target.Hostname,
+		Match:         cfg.Target.Match,
+		Filter:        cfg.Target.Filter,
+		CaseSensitive: cfg.Target.CaseSensitive,
+		MaxCandidates: cfg.Target.MaxCandidates,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to select target hosts: %v", err)
+	}
+
+	filter := ""
+	if cfg.Target.Filter != "" {
+		filter = fmt.Sprintf(" (filter %s)", cfg.Target.Filter)
+	}
+	progress.Printf("Target selection: %d candidate host(s) fetched%s, %d matched %s %q\n",
+		selection.Candidates, filter, len(selection.Matched), cfg.Target.Match, cfg.Target.Hostname)
+	if selection.Truncated {
+		progress.Printf("Warning: more hosts match the filter than target.max_candidates (%d); narrow the filter or raise the limit.\n", cfg.Target.MaxCandidates)
+	}
+	hostnames := map[string]string{}
+	for _, host := range selection.Matched {
+		progress.Printf("  %s  %s\n", host.DeviceID, host.Hostname)
+		hostnames[host.DeviceID] = host.Hostname
+	}
+	if len(selection.Matched) == 0 {
+		return nil, nil, withExitCode(exitPolicyRejected, fmt.Errorf("No host matches target.hostname %q among %d candidate(s).", cfg.Target.Hostname, selection.Candidates))
+	}
+	deviceIDs := selection.DeviceIDs()
+	sortByHostname(deviceIDs, hostnames)
+	return deviceIDs, nil, nil
+}
+
+// sortByHostname orders deviceIDs by hostname, then device ID. Hosts are
+// collected in this order, and reported in it, so that the reports of two
+// runs over the same hosts line up.
+func sortByHostname(deviceIDs []string, hostnames map[string]string) {
+	sort.SliceStable(deviceIDs, func(i, j int) bool {
+		a, b := strings.ToLower(hostnames[deviceIDs[i]]), strings.ToLower(hostnames[deviceIDs[j]])
+		if a != b {
+			return a < b
+		}
+		return deviceIDs[i] < deviceIDs[j]
+	})
+}
+
+// resolveTargets looks up the hosts named by target.serials, target.macs
+// and target.identifiers_file. Each identifier is printed with the device
+// it resolved to; ambiguous and unmatched identifiers are reported with
+// where they were given and are not targeted. The run is rejected when no
+// identifier resolves.
+func resolveTargets(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config) ([]string, []sink.TargetMapping, error) {
+	if cfg.DeviceID != "" {
+		progress.Printf("Warning: the target names hosts by serial or MAC, ignoring device_id %s.\n", cfg.DeviceID)
+	}
+	var identifiers []rtr.Identifier
+	for i, serial := range cfg.Target.Serials {
+		identifiers = append(identifiers, rtr.Identifier{Kind: rtr.IdentifierSerial, Value: serial, Source: fmt.Sprintf("target.serials[%d]", i)})
+	}
+	for i, mac := range cfg.Target.MACs {
+		identifiers = append(identifiers, rtr.Identifier{Kind: rtr.IdentifierMAC, Value: mac, Source: fmt.Sprintf("target.macs[%d]", i)})
+	}
+	if cfg.Target.IdentifiersFile != "" {
+		fromFile, err := rtr.LoadIdentifiers(cfg.Target.IdentifiersFile)
+		if err != nil {
+			return nil, nil, withExitCode(exitConfigError, fmt.Errorf("Configuration Error: %v", err))
+		}
+		identifiers = append(identifiers, fromFile...)
+	}
+	for _, id := range identifiers {
+		if _, err := id.Normalize(); err != nil {
+			return nil, nil, withExitCode(exitConfigError, fmt.Errorf("Configuration Error: %v", err))
+		}
+	}
+	matches, err := rtrClient.ResolveIdentifiers(ctx, identifiers)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to resolve target hosts: %v", err)
+	}
+
+	var deviceIDs []string
+	seen := map[string]bool{}
+	mappings := make([]sink.TargetMapping, 0, len(matches))
+	counts := map[string]int{}
+	for _, match := range matches {
+		mapping := sink.TargetMapping{Kind: match.Kind, Identifier: match.Value, Source: match.Source}
+		switch len(match.Hosts) {
+		case 0:
+			mapping.Status = sink.TargetUnmatched
+			progress.Printf("Warning: %s %s (%s) matches no device.\n", match.Kind, match.Value, match.Source)
+		case 1:
+			mapping.Status, mapping.DeviceID, mapping.Hostname = sink.TargetResolved, match.Hosts[0].DeviceID, match.Hosts[0].Hostname
+			if !seen[mapping.DeviceID] {
+				seen[mapping.DeviceID] = true
+				deviceIDs = append(deviceIDs, mapping.DeviceID)
+			}
+		default:
+			mapping.Status = sink.TargetAmbiguous
+			described := make([]string, 0, len(match.Hosts))
+			for _, host := range match.Hosts {
+				mapping.Matches = append(mapping.Matches, host.DeviceID)
+				described = append(described, fmt.Sprintf("%s (%s)", host.DeviceID, host.Hostname))
+			}
+			progress.Printf("Warning: %s %s (%s) is ambiguous, it matches %s; not targeted.\n", match.Kind, match.Value, match.Source, strings.Join(described, ", "))
+		}
+		counts[mapping.Status]++
+		mappings = append(mappings, mapping)
+	}
+	progress.Printf("Target resolution: %d identifier(s), %d resolved, %d ambiguous, %d unmatched\n",
+		len(matches), counts[sink.TargetResolved], counts[sink.TargetAmbiguous], counts[sink.TargetUnmatched])
+	hostnames := map[string]string{}
+	for _, mapping := range mappings {
+		if mapping.Status == sink.TargetResolved {
+			progress.Printf("  %s %s -> %s  %s\n", mapping.Kind, mapping.Identifier, mapping.DeviceID, mapping.Hostname)
+			hostnames[mapping.DeviceID] = mapping.Hostname
+		}
+	}
+	sortByHostname(deviceIDs, hostnames)
+	if len(deviceIDs) == 0 {
+		return nil, mappings, withExitCode(exitPolicyRejected, fmt.Errorf("None of the %d target identifier(s) resolved to a device.", len(matches)))
+	}
+	return deviceIDs, mappings, nil
+}
+
+// resolvedFrom returns the first mapping that resolved to deviceID, if any.
+func resolvedFrom(mappings []sink.TargetMapping, deviceID string) *sink.TargetMapping {
+	for i := range mappings {
+		if mappings[i].Status == sink.TargetResolved && mappings[i].DeviceID == deviceID {
+			return &mappings[i]
+		}
+	}
+	return nil
+}
+
+// runHost opens a session on deviceID and runs the configured script,
+// re-running it once after a retryable failure, then places the host's
+// receipt when receipts is not nil. Each step is timed into timing, and the
+// host's warnings are collected in warnings.
+func runHost(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config, deviceID string, summary *notify.Summary, receipts *receiptStep, timing *sink.Timing, warnings *sink.Warnings) (*sink.Result, error) {
+	// 2. Initialize RTR Session
+	progress.Println("\n--- Step 2: Initializing RTR Session ---")
+	sessionDone := timing.Start("session_init")
+	session, err := rtrClient.InitializeRTRSession(ctx, deviceID)
+	sessionDone()
+	if err != nil {
+		return nil, countFailure(rtrClient, deviceID, nil, fmt.Errorf("Failed to initialize RTR session: %w", err))
+	}
+	session.Warnings = warnings
+	summary.SessionID = session.SessionID
+	progress.Printf("RTR Session ID: %s\n", session.SessionID)
+	defer func() {
+		// The session is deleted once the host is done, so that it does not
+		// hold the host busy against the next run; a run aborted by the call
+		// budget, or by a signal, deletes it all the same.
+		if rtrClient.Budget.Exceeded() {
+			progress.Println("API call budget exhausted, deleting session before aborting...")
+		}
+		deleteSession(session, warnings)
+	}()
+
+	if err := interrupted(ctx); err != nil {
+		return nil, err
+	}
+
+	var resources *sink.HostResources
+	if cfg.Prerequisites.Enabled() {
+		if resources, err = checkPrerequisites(ctx, session, cfg, timing, warnings); err != nil {
+			return &sink.Result{RunID: cfg.RunID, CID: summary.CID, DeviceID: session.DeviceID, SessionID: session.SessionID, Resources: resources}, err
+		}
+	}
+
+	clock := captureClock(ctx, session, cfg, timing, warnings)
+
+	for attempt := 1; ; attempt++ {
+		result, err := runContinued(ctx, session, cfg, summary, timing)
+		if result != nil {
+			result.Resources, result.Clock = resources, clock
+		}
+		if err != nil || result == nil {
+			return result, countFailure(rtrClient, session.DeviceID, result, err)
+		}
+		if result.FailureReason == "" {
+			rtrClient.Breaker.Success(session.DeviceID)
+			if receipts != nil {
+				result.Receipt = receipts.place(ctx, session, result, timing)
+			}
+			return result, nil
+		}
+		progress.Printf("Script reported a failure on device %s: %s\n", session.DeviceID, result.FailureReason)
+		if hint := failureHint(cfg.NoHints, result, nil); hint != "" {
+			progress.Printf("  Hint: %s\n", hint)
+		}
+		var failure error
+		if len(result.Errors) > 0 {
+			// The API call succeeded but the command failed on the host.
+			failure = fmt.Errorf("%w: %s", rtr.ErrCommandFailed, rtr.FormatResourceErrors(result.Errors))
+		}
+		failure = countFailure(rtrClient, session.DeviceID, result, failure)
+		if _, retryable := rtr.ClassifyCommand(result.Errors, result.Stderr); !retryable || attempt > scriptRetries || errors.Is(failure, rtr.ErrCircuitOpen) {
+			return result, failure
+		}
+
+		warnings.Add(sink.WarningScriptRetried, session.DeviceID, "%s is retryable, re-running script (attempt %d of %d)", result.FailureReason, attempt+1, scriptRetries+1)
+		rtrClient.Metrics.Retry()
+		if result.FailureReason == rtr.FailureSessionInterrupted {
+			sessionDone := timing.Start("session_init")
+			reopened, err := rtrClient.InitializeRTRSession(ctx, session.DeviceID)
+			sessionDone()
+			if err != nil {
+				return result, countFailure(rtrClient, session.DeviceID, nil, fmt.Errorf("Failed to re-initialize RTR session: %v", err))
+			}
+			deleteSession(session, warnings)
+			session = reopened
+			session.Warnings = warnings
+			warnings.Add(sink.WarningSessionReopened, session.DeviceID, "session was interrupted, continuing on new session %s", session.SessionID)
+			summary.SessionID = session.SessionID
+		}
+	}
+}
+
+// deleteSession deletes session, outside of the run's context so that an
+// interrupted run still cleans up. A session that cannot be deleted is left
+// to time out, with a warning.
+func deleteSession(session *rtr.Session, warnings *sink.Warnings) {
+	if err := session.Delete(context.Background()); err != nil {
+		warnings.Add(sink.WarningSessionNotDeleted, session.DeviceID, "%v; it times out after 10 minutes without use", err)
+	}
+}
+
+// runScript runs the configured script on session, waits for it and returns
+// the per-host result built from the command status. A continuation token,
+// if not "", is passed to the script to continue from.
+func runScript(ctx context.Context, session *rtr.Session, cfg *config.Config, summary *notify.Summary, timing *sink.Timing, token string) (*sink.Result, error) {
+	// 3. Run the RTR Script
+	// Set script_name (or SCRIPT_NAME) to the name of your cloud-stored script.
+	progress.Println("\n--- Step 3: Running RTR Script ---")
+	// Linux and macOS hosts run their platform_scripts entry, if any.
+	scriptName, err := session.PlatformScript(ctx, cfg.ScriptName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to run RTR script: %v", err)
+	}
+	var command *rtr.Command
+	if token == "" {
+		command, err = session.RunScript(ctx, scriptName)
+	} else {
+		command, err = session.ContinueScript(ctx, scriptName, token)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to run RTR script: %v", err)
+	}
+	summary.CloudRequestID = command.CloudRequestID
+	timing.Add(command.Stages()...)
+	progress.Printf("Cloud Request ID for command: %s\n", command.CloudRequestID)
+
+	// Give some time for the command to execute and status to update. A
+	// followed script, or one with a -Timeout, is instead polled until it
+	// completes or times out on the host. Either way Wait collects the
+	// output: every sequence of it, joined and redacted.
+	var waited *rtr.CommandResult
+	waitDone := timing.Start("command_wait")
+	if follow := followWriter(cfg, session.DeviceID); follow != nil {
+		progress.Printf("\nFollowing the output of %s on device %s...\n", scriptName, session.DeviceID)
+		command.Follow = follow
+		waited, err = command.Wait(ctx, 0)
+	} else if command.ScriptTimeout > 0 {
+		progress.Printf("\nWaiting for command execution (script timeout %s)...\n", command.ScriptTimeout)
+		waited, err = command.Wait(ctx, 0)
+	} else {
+		wait := time.Duration(cfg.CommandWait)
+		progress.Printf("\nWaiting %s for command execution...\n", wait)
+		if session.Sleep(ctx, wait) == nil {
+			waited, err = command.Wait(ctx, 0)
+		}
+	}
+	if err != nil && ctx.Err() == nil {
+		progress.Printf("Warning: %v\n", err)
+	}
+	waitDone()
+	if ctx.Err() != nil {
+		// Abandon the command on the host rather than leaving it running.
+		cancelled, err := command.Cancel(context.Background())
+		if err != nil {
+			progress.Printf("Warning: %v\n", err)
+		}
+		result := &sink.Result{
+			RunID:          cfg.RunID,
+			CID:            summary.CID,
+			DeviceID:       session.DeviceID,
+			SessionID:      session.SessionID,
+			CloudRequestID: command.CloudRequestID,
+			Endpoint:       command.Endpoint,
+			TimeoutSeconds: int(command.ScriptTimeout / time.Second),
+			Stdout:         cancelled.Stdout,
+			Stderr:         cancelled.Stderr,
+			Normalization:  cancelled.Normalization,
+		}
+		return result, interrupted(ctx)
+	}
+
+	// 4. Get Status of the executed RTR command
+	progress.Println("\n--- Step 4: Getting RTR Command Status ---")
+	statusDone := timing.Start("command_status")
+	status, err := command.Status(ctx)
+	statusDone()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get command status: %v", err)
+	}
+	if status == nil {
+		progress.Println("RTR Command Status could not be retrieved.")
+		return nil, nil
+	}
+	progress.Println("RTR Command Status retrieved successfully.")
+
+	result := &sink.Result{
+		RunID:          cfg.RunID,
+		CID:            summary.CID,
+		DeviceID:       session.DeviceID,
+		SessionID:      session.SessionID,
+		CloudRequestID: command.CloudRequestID,
+		Endpoint:       command.Endpoint,
+		TimeoutSeconds: int(command.ScriptTimeout / time.Second),
+		Raw:            status,
+	}
+	if waited != nil && waited.Complete {
+		result.Stdout, result.Stderr = waited.Stdout, waited.Stderr
+		result.Normalization, result.Errors = waited.Normalization, waited.Errors
+		result.Redactions = waited.Redactions
+	} else if resources, ok := status["resources"].([]interface{}); ok && len(resources) > 0 {
+		// The command did not complete in time: keep what the status
+		// shows of it so far.
+		if resourceMap, ok := resources[0].(map[string]interface{}); ok {
+			result.Stdout, _ = resourceMap["stdout"].(string)
+			result.Stderr, _ = resourceMap["stderr"].(string)
+			result.Normalization, _ = resourceMap["normalization"].([]string)
+			result.Errors = rtr.ResourceErrors(resourceMap)
+		}
+	}
+	result.FailureReason, _ = rtr.ClassifyCommand(result.Errors, result.Stderr)
+	if stdout := strings.TrimSpace(result.Stdout); (strings.HasPrefix(stdout, "{") || strings.HasPrefix(stdout, "[")) && !json.Valid([]byte(stdout)) {
+		session.Warnings.Add(sink.WarningStdoutParseFailed, session.DeviceID, "script output starts like JSON but does not parse")
+	}
+	return result, nil
+}
+
+// checkCID records the authenticated CID in summary and, when expected_cid is
+// configured, refuses to continue if the credentials belong to another tenant.
+func checkCID(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config, summary *notify.Summary) error {
+	cid, err := rtrClient.GetCurrentCID(ctx)
+	if err != nil {
+		if cfg.ExpectedCID != "" {
+			return withExitCode(exitPolicyRejected, fmt.Errorf("Failed to verify expected_cid: %v", err))
+		}
+		rtrClient.Warnings.Add(sink.WarningCIDUnknown, "", "could not determine the authenticated CID: %v", err)
+		return nil
+	}
+	summary.CID = cid
+	rtrClient.Audit.SetCID(cid)
+	progress.Printf("Authenticated CID: %s\n", cid)
+
+	if cfg.ExpectedCID != "" && cid != rtr.NormalizeCID(cfg.ExpectedCID) {
+		profile := ""
+		if cfg.Profile != "" {
+			profile = fmt.Sprintf(" (profile %q)", cfg.Profile)
+		}
+		return withExitCode(exitPolicyRejected, fmt.Errorf("CID mismatch: credentials belong to %s but expected_cid%s is %s. Refusing to run against the wrong tenant.",
+			cid, profile, rtr.NormalizeCID(cfg.ExpectedCID)))
+	}
+	return nil
+}
+
+// interrupted returns an interrupted-class error once ctx is cancelled by a signal.
+func interrupted(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	return withExitCode(exitInterrupted, fmt.Errorf("Run interrupted: %v", context.Cause(ctx)))
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/approval"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/audit"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/notify"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/simulate"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// roundTripFunc answers every request of a client with one func.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// failingAPI answers every request with a server error.
+var failingAPI = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusInternalServerError, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{"errors":[{"message":"down"}]}`)), Request: req}, nil
+})
+
+func TestCheckCID(t *testing.T) {
+	tenant := rtr.NormalizeCID(simulate.SimulatedCID)
+	tests := []struct {
+		name        string
+		expected    string
+		profile     string
+		transport   http.RoundTripper
+		wantCode    int    // Exit code of the error; 0 for none
+		wantErr     string // In the error message
+		wantCID     string // Recorded in the summary
+		wantWarning string
+	}{
+		{name: "no expected CID", wantCID: tenant},
+		{name: "matching CID", expected: tenant, wantCID: tenant},
+		{name: "matching CID with checksum and case", expected: strings.ToUpper(tenant) + "-51", wantCID: tenant},
+		{
+			name:     "mismatch",
+			expected: "0123456789abcdef0123456789abcdef",
+			wantCode: exitPolicyRejected,
+			wantErr:  "CID mismatch: credentials belong to " + tenant + " but expected_cid is 0123456789abcdef0123456789abcdef",
+			wantCID:  tenant,
+		},
+		{
+			name:     "mismatch names the profile",
+			expected: "0123456789abcdef0123456789abcdef",
+			profile:  "acme",
+			wantCode: exitPolicyRejected,
+			wantErr:  `expected_cid (profile "acme") is 0123456789abcdef0123456789abcdef`,
+			wantCID:  tenant,
+		},
+		{
+			name:      "unknown CID with expected_cid",
+			expected:  tenant,
+			transport: failingAPI,
+			wantCode:  exitPolicyRejected,
+			wantErr:   "Failed to verify expected_cid",
+		},
+		{name: "unknown CID without expected_cid", transport: failingAPI, wantWarning: sink.WarningCIDUnknown},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := test.transport
+			if transport == nil {
+				transport = simulate.New(simulate.Options{})
+			}
+			client, err := rtr.NewCrowdStrikeRTRClient(rtr.Options{BaseURL: "https://api.test", Simulated: true, Transport: transport})
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.Warnings = &sink.Warnings{}
+			summary := &notify.Summary{}
+
+			err = checkCID(context.Background(), client, &config.Config{ExpectedCID: test.expected, Profile: test.profile}, summary)
+			switch {
+			case test.wantCode == 0 && err != nil:
+				t.Fatalf("checkCID: %v", err)
+			case test.wantCode != 0 && err == nil:
+				t.Fatalf("checkCID succeeded, want exit code %d", test.wantCode)
+			case err != nil:
+				var exitErr *exitError
+				if !errors.As(err, &exitErr) || exitErr.code != test.wantCode {
+					t.Errorf("exit code %d, want %d", exitCodeFor(err), test.wantCode)
+				}
+				if !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("error %q does not contain %q", err, test.wantErr)
+				}
+			}
+			if summary.CID != test.wantCID {
+				t.Errorf("summary CID %q, want %q", summary.CID, test.wantCID)
+			}
+			counts := sink.CountWarnings(client.Warnings.List())
+			if test.wantWarning != "" && counts[test.wantWarning] != 1 {
+				t.Errorf("warnings %v, want one %s", counts, test.wantWarning)
+			}
+			if test.wantWarning == "" && len(counts) > 0 {
+				t.Errorf("unexpected warnings %v", counts)
+			}
+		})
+	}
+}
+
+func TestHostsErrorExitCodes(t *testing.T) {
+	failedHost := hostRun{deviceID: "a", err: errors.New("script failed")}
+	succeededHost := hostRun{deviceID: "b"}
+	busyHost := hostRun{deviceID: "c", heldBy: "analyst", err: errors.New("busy")}
+	configHost := hostRun{deviceID: "d", err: withExitCode(exitConfigError, errors.New("bad script"))}
+	interruptedHost := hostRun{deviceID: "e", err: withExitCode(exitInterrupted, errors.New("Run interrupted"))}
+	tests := []struct {
+		name  string
+		hosts []hostRun
+		want  int
+	}{
+		{"all succeeded", []hostRun{succeededHost, succeededHost}, exitSucceeded},
+		{"some failed", []hostRun{succeededHost, failedHost}, exitPartialFailure},
+		{"some skipped", []hostRun{succeededHost, busyHost}, exitPartialFailure},
+		{"all failed", []hostRun{failedHost, failedHost}, exitAllFailed},
+		{"failed and skipped", []hostRun{failedHost, busyHost}, exitAllFailed},
+		{"all skipped", []hostRun{busyHost, busyHost}, exitPolicyRejected},
+		{"single host keeps its class", []hostRun{configHost}, exitConfigError},
+		{"interrupted host", []hostRun{succeededHost, interruptedHost, failedHost}, exitInterrupted},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			failed, skipped := 0, 0
+			for _, host := range test.hosts {
+				switch {
+				case host.skipped():
+					skipped++
+				case host.err != nil:
+					failed++
+				}
+			}
+			if got := exitCodeFor(hostsError(test.hosts, failed, skipped)); got != test.want {
+				t.Errorf("exit code %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWarningsErrorExitCode(t *testing.T) {
+	warned := &sink.Warnings{}
+	warned.Add(sink.WarningCIDUnknown, "a", "warning")
+	hosts := []hostRun{{deviceID: "a", warnings: warned}, {deviceID: "b"}}
+	tests := []struct {
+		threshold float64
+		want      int
+	}{
+		{0, exitSucceeded},
+		{0.5, exitPartialFailure},
+		{0.6, exitSucceeded},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.threshold), func(t *testing.T) {
+			count, err := warningsError(hosts, nil, test.threshold)
+			if count != 1 {
+				t.Errorf("%d hosts warned, want 1", count)
+			}
+			if got := exitCodeFor(err); got != test.want {
+				t.Errorf("exit code %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInterruptedExitCode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := interrupted(ctx); err != nil {
+		t.Fatalf("interrupted before cancel: %v", err)
+	}
+	cancel()
+	if got := exitCodeFor(interrupted(ctx)); got != exitInterrupted {
+		t.Errorf("exit code %d, want %d", got, exitInterrupted)
+	}
+}
+
+func TestCheckTargetSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *config.Config)
+		refuse bool
+	}{
+		{"no source", func(cfg *config.Config) {}, true},
+		{"filter alone", func(cfg *config.Config) { cfg.Target.Filter = "platform_name:'Windows'" }, true},
+		{"device_id", func(cfg *config.Config) { cfg.DeviceID = "abcdef" }, false},
+		{"hostname", func(cfg *config.Config) { cfg.Target.Hostname = "web-*" }, false},
+		{"serials", func(cfg *config.Config) { cfg.Target.Serials = []string{"SN1"} }, false},
+		{"identifiers file", func(cfg *config.Config) { cfg.Target.IdentifiersFile = "hosts.txt" }, false},
+		{"simulation", func(cfg *config.Config) { cfg.Simulation.Enabled = true }, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := config.Defaults()
+			test.config(cfg)
+			err := checkTargetSource(cfg)
+			if !test.refuse {
+				if err != nil {
+					t.Errorf("checkTargetSource = %v, want nil", err)
+				}
+				return
+			}
+			if got := exitCodeFor(err); got != exitConfigError {
+				t.Errorf("exit code %d, want %d", got, exitConfigError)
+			}
+			for _, source := range config.TargetSources {
+				if !strings.Contains(err.Error(), source) {
+					t.Errorf("error does not list %q:\n%v", source, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunWithoutTargetsMakesNoAPICall(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "unexpected call", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	cfg := config.Defaults()
+	cfg.ClientID, cfg.ClientSecret, cfg.BaseURL = "id", "secret", server.URL
+	_, err := run(context.Background(), cfg, &notify.Summary{}, &sink.Timing{}, &sink.Warnings{}, &runOutcome{})
+	if got := exitCodeFor(err); got != exitConfigError || !strings.Contains(fmt.Sprint(err), "no target hosts given") {
+		t.Errorf("run error = %v (exit code %d), want the missing target refusal", err, got)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("%d API call(s) made before the refusal", n)
+	}
+}
+
+func TestApprovalBeforeCommandEndpoints(t *testing.T) {
+	var mu sync.Mutex
+	var commandCalls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth2/token" {
+			fmt.Fprint(w, `{"access_token":"token","expires_in":1800}`)
+			return
+		}
+		if strings.Contains(r.URL.Path, "-command/") {
+			mu.Lock()
+			commandCalls = append(commandCalls, r.Method+" "+r.URL.Path)
+			mu.Unlock()
+		}
+		fmt.Fprint(w, `{"resources":[]}`)
+	}))
+	defer server.Close()
+
+	cfg := config.Defaults()
+	cfg.ClientID, cfg.ClientSecret, cfg.BaseURL = "id", "secret", server.URL
+	cfg.DeviceID = "abcdef"
+	cfg.Approval.TokenSecret = "change-control"
+	output := progress.Output()
+	progress.SetOutput(io.Discard)
+	defer progress.SetOutput(output)
+	_, err := run(context.Background(), cfg, &notify.Summary{}, &sink.Timing{}, &sink.Warnings{}, &runOutcome{})
+	if got := exitCodeFor(err); got != exitApprovalDenied {
+		t.Errorf("run error = %v (exit code %d), want the approval refusal", err, got)
+	}
+	if len(commandCalls) > 0 {
+		t.Errorf("command endpoints called before approval: %q", commandCalls)
+	}
+}
+
+func TestConfirmDestructiveAudit(t *testing.T) {
+	// Stdin is a pipe, never a terminal, whatever go test was started from.
+	stdin, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	defer stdin.Close()
+	saved := os.Stdin
+	os.Stdin = stdin
+	t.Cleanup(func() { os.Stdin = saved })
+	output := progress.Output()
+	progress.SetOutput(io.Discard)
+	t.Cleanup(func() { progress.SetOutput(output) })
+
+	tests := []struct {
+		name       string
+		force      bool
+		wantEvent  string
+		wantMethod string
+	}{
+		{name: "forced", force: true, wantEvent: audit.EventDestructiveConfirmed, wantMethod: "forced"},
+		{name: "refused without a terminal", wantEvent: audit.EventDestructiveRefused},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), audit.DefaultName)
+			log, err := audit.Open(path, audit.Identity{RunID: "run-1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, err := rtr.NewCrowdStrikeRTRClient(rtr.Options{BaseURL: "https://api.test", Simulated: true, Transport: failingAPI})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := &config.Config{DestructiveCommands: []string{"rm"}, ForceDestructive: test.force}
+			plan := &approval.Plan{DeviceIDs: []string{"a", "b"}, Commands: []approval.Command{{BaseCommand: "rm", CommandString: `rm C:\temp\x`}}}
+			err = confirmDestructive(context.Background(), client, cfg, rtr.Capabilities{}, plan, &runOutcome{audit: log})
+			if test.wantEvent == audit.EventDestructiveRefused && exitCodeFor(err) != exitPolicyRejected {
+				t.Errorf("confirmDestructive = %v, want a policy rejection", err)
+			}
+			if test.wantEvent == audit.EventDestructiveConfirmed && err != nil {
+				t.Fatal(err)
+			}
+			if err := log.Close(); err != nil {
+				t.Fatal(err)
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var record audit.Record
+			if err := json.Unmarshal(content, &record); err != nil {
+				t.Fatalf("audit log %q: %v", content, err)
+			}
+			if record.Event != test.wantEvent || record.Details["method"] != test.wantMethod || record.Details["host_count"] != "2" || record.Details["commands"] != `rm C:\temp\x` {
+				t.Errorf("audit record = %+v, want %s (method %q) for rm on 2 hosts", record, test.wantEvent, test.wantMethod)
+			}
+			if (record.Error != "") != (test.wantEvent == audit.EventDestructiveRefused) {
+				t.Errorf("audit record error = %q", record.Error)
+			}
+		})
+	}
+}
+
+// TestRunHostFailureFixtures serves captured status responses of failed
+// commands from testdata/failures and checks what runHost makes of each:
+// the failure reason, whether the script is re-run, and whether the host
+// fails with rtr.ErrCommandFailed because the command failed on the host
+// although the API call succeeded.
+func TestRunHostFailureFixtures(t *testing.T) {
+	const device = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	tests := []struct {
+		fixture       string
+		reason        string
+		runs          int  // Times the script is issued
+		commandFailed bool // The host's error is rtr.ErrCommandFailed
+	}{
+		{"success", "", 1, false},
+		{"session-not-found", rtr.FailureSessionInterrupted, 2, true},
+		{"host-offline", rtr.FailureSessionInterrupted, 2, true},
+		{"command-timed-out", rtr.FailureTimeout, 2, true},
+		{"cloud-file-not-found", rtr.FailureScriptNotFound, 1, true},
+		{"internal-error", rtr.FailureUnknown, 1, true},
+		{"execution-policy", rtr.FailureExecutionPolicy, 1, false},
+		{"access-denied", rtr.FailureAccessDenied, 1, false},
+	}
+	output := progress.Output()
+	progress.SetOutput(io.Discard)
+	t.Cleanup(func() { progress.SetOutput(output) })
+
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			fixture, err := os.ReadFile(filepath.Join("testdata", "failures", test.fixture+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			api := simulate.New(simulate.Options{Devices: []simulate.Device{{ID: device, Hostname: "alpha", Platform: "windows"}}})
+			var runs atomic.Int32
+			transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if !strings.HasSuffix(req.URL.Path, "-command/v1") {
+					return api.RoundTrip(req)
+				}
+				if req.Method == http.MethodPost {
+					runs.Add(1)
+					return api.RoundTrip(req)
+				}
+				body := string(fixture)
+				if req.URL.Query().Get("sequence_id") != "0" {
+					body = `{"resources":[{"complete":true,"stdout":"","stderr":""}]}`
+				}
+				return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+			})
+			client, err := rtr.NewCrowdStrikeRTRClient(rtr.Options{BaseURL: "https://api.test", Simulated: true, Transport: transport})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := client.Authenticate(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			cfg := config.Defaults()
+			cfg.ScriptName, cfg.CommandWait = "collect.ps1", 0
+
+			result, err := runHost(context.Background(), client, cfg, device, &notify.Summary{}, nil, &sink.Timing{}, &sink.Warnings{})
+			if result == nil {
+				t.Fatalf("runHost returned no result (error %v)", err)
+			}
+			if result.FailureReason != test.reason {
+				t.Errorf("failure reason %q, want %q", result.FailureReason, test.reason)
+			}
+			if got := int(runs.Load()); got != test.runs {
+				t.Errorf("script issued %d time(s), want %d", got, test.runs)
+			}
+			if got := errors.Is(err, rtr.ErrCommandFailed); got != test.commandFailed {
+				t.Errorf("runHost error = %v, want rtr.ErrCommandFailed %t", err, test.commandFailed)
+			}
+			if test.commandFailed != (len(result.Errors) > 0) {
+				t.Errorf("result errors %+v, want them only for a command that failed on the host", result.Errors)
+			}
+		})
+	}
+}
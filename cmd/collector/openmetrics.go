@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Metric and label names of the exposition format.
+var (
+	metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNamePattern  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// metricsPrefix starts the name of every metric in the textfile. The names
+// are a stable contract for dashboards and alerts.
+const metricsPrefix = "crowdstrike_collector_"
+
+// textfileMetric is one metric family with a single sample.
+type textfileMetric struct {
+	name  string // Without metricsPrefix; counters without the _total suffix
+	kind  string // gauge or counter
+	unit  string
+	help  string
+	value float64
+}
+
+// writeMetricsTextfile writes the outcome as an OpenMetrics textfile for
+// the node_exporter textfile collector, labeled by profile and script. Like
+// the outcome file, it is written to a temporary file and renamed, so the
+// collector never scrapes a partial file.
+func writeMetricsTextfile(path string, outcome *runOutcome) error {
+	apiCalls, breakerTrips := 0, 0
+	if outcome.Metrics != nil {
+		breakerTrips = outcome.Metrics.BreakerTrips
+		for _, n := range outcome.Metrics.APICalls {
+			apiCalls += n
+		}
+	}
+	metrics := []textfileMetric{
+		{name: "hosts_total", kind: "gauge", help: "Hosts the last run targeted.", value: float64(outcome.HostsTotal)},
+		{name: "hosts_succeeded", kind: "gauge", help: "Hosts the last run collected from.", value: float64(outcome.HostsSucceeded)},
+		{name: "hosts_failed", kind: "gauge", help: "Hosts that failed in the last run.", value: float64(outcome.HostsFailed)},
+		{name: "hosts_skipped", kind: "gauge", help: "Hosts the last run skipped as busy.", value: float64(outcome.HostsSkipped)},
+		{name: "breaker_trips", kind: "counter", help: "Devices whose circuit breaker opened in the last run.", value: float64(breakerTrips)},
+		{name: "exit_code", kind: "gauge", help: "Exit code of the last run.", value: float64(outcome.ExitCode)},
+		{name: "duration_seconds", kind: "gauge", unit: "seconds", help: "How long the last run took.", value: outcome.FinishedAt.Sub(outcome.StartedAt).Seconds()},
+		{name: "api_calls", kind: "counter", help: "CrowdStrike API calls made by the last run.", value: float64(apiCalls)},
+		{name: "log_rotations", kind: "counter", help: "Log file rotations during the last run.", value: float64(outcome.LogRotations)},
+		{name: "last_run_timestamp", kind: "gauge", help: "Unix time the last run finished.", value: float64(outcome.FinishedAt.UnixMilli()) / 1000},
+	}
+	labels := [][2]string{{"profile", outcome.Profile}, {"script", outcome.Script}}
+
+	data, err := formatOpenMetrics(metrics, labels)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write metrics textfile: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write metrics textfile: %w", err)
+	}
+	return nil
+}
+
+// formatOpenMetrics renders metrics in the OpenMetrics text format, each
+// sample with labels, and ends the exposition with # EOF. Names that the
+// format does not allow are an error rather than a file scrapers reject.
+func formatOpenMetrics(metrics []textfileMetric, labels [][2]string) ([]byte, error) {
+	var rendered []string
+	for _, label := range labels {
+		if !labelNamePattern.MatchString(label[0]) || strings.HasPrefix(label[0], "__") {
+			return nil, fmt.Errorf("invalid metric label name %q", label[0])
+		}
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(label[1])
+		rendered = append(rendered, fmt.Sprintf(`%s="%s"`, label[0], value))
+	}
+	labelSet := "{" + strings.Join(rendered, ",") + "}"
+
+	var out bytes.Buffer
+	for _, metric := range metrics {
+		family := metricsPrefix + metric.name
+		if !metricNamePattern.MatchString(family) {
+			return nil, fmt.Errorf("invalid metric name %q", family)
+		}
+		sample := family
+		switch metric.kind {
+		case "counter":
+			sample += "_total"
+		case "gauge":
+		default:
+			return nil, fmt.Errorf("metric %s: unsupported type %q", family, metric.kind)
+		}
+		if metric.unit != "" && !strings.HasSuffix(family, "_"+metric.unit) {
+			return nil, fmt.Errorf("metric %s: name must end with its unit %q", family, metric.unit)
+		}
+		fmt.Fprintf(&out, "# TYPE %s %s\n", family, metric.kind)
+		if metric.unit != "" {
+			fmt.Fprintf(&out, "# UNIT %s %s\n", family, metric.unit)
+		}
+		fmt.Fprintf(&out, "# HELP %s %s\n", family, metric.help)
+		fmt.Fprintf(&out, "%s%s %s\n", sample, labelSet, strconv.FormatFloat(metric.value, 'f', -1, 64))
+	}
+	out.WriteString("# EOF\n")
+	return out.Bytes(), nil
+}
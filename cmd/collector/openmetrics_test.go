@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+)
+
+// exposedFamily is a metric family as the Prometheus OpenMetrics parser
+// read it from a textfile.
+type exposedFamily struct {
+	kind    model.MetricType
+	unit    string
+	help    string
+	samples map[string]exposedSample // By sample name
+}
+
+type exposedSample struct {
+	labels labels.Labels
+	value  float64
+}
+
+// parseOpenMetrics parses data with the parser Prometheus scrapes
+// OpenMetrics with, failing the test on anything it rejects.
+func parseOpenMetrics(t *testing.T, data []byte) map[string]*exposedFamily {
+	t.Helper()
+	families := map[string]*exposedFamily{}
+	family := func(name []byte) *exposedFamily {
+		f, ok := families[string(name)]
+		if !ok {
+			f = &exposedFamily{samples: map[string]exposedSample{}}
+			families[string(name)] = f
+		}
+		return f
+	}
+	parser := textparse.NewOpenMetricsParser(data, labels.NewSymbolTable())
+	var current string
+	for {
+		entry, err := parser.Next()
+		if errors.Is(err, io.EOF) {
+			return families
+		}
+		if err != nil {
+			t.Fatalf("Prometheus parser rejected the textfile: %v\n%s", err, data)
+		}
+		switch entry {
+		case textparse.EntryType:
+			name, kind := parser.Type()
+			family(name).kind = kind
+			current = string(name)
+		case textparse.EntryUnit:
+			name, unit := parser.Unit()
+			family(name).unit = string(unit)
+		case textparse.EntryHelp:
+			name, help := parser.Help()
+			family(name).help = string(help)
+		case textparse.EntrySeries:
+			_, _, value := parser.Series()
+			var sampleLabels labels.Labels
+			parser.Metric(&sampleLabels)
+			name := sampleLabels.Get(labels.MetricName)
+			if !strings.HasPrefix(name, current) {
+				t.Fatalf("sample %s outside its family %s", name, current)
+			}
+			family([]byte(current)).samples[name] = exposedSample{labels: sampleLabels, value: value}
+		default:
+			t.Fatalf("unexpected entry %v in the textfile", entry)
+		}
+	}
+}
+
+func TestWriteMetricsTextfile(t *testing.T) {
+	started := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	outcome := &runOutcome{
+		HostsTotal:     5,
+		HostsSucceeded: 3,
+		HostsFailed:    1,
+		HostsSkipped:   1,
+		ExitCode:       exitPartialFailure,
+		LogRotations:   2,
+		Metrics:        &rtr.MetricsSnapshot{APICalls: map[string]int{"POST /oauth2/token": 1, "GET /devices": 4}, BreakerTrips: 3},
+		Profile:        `prod "eu"` + "\nsecond line",
+		Script:         `C:\scripts\collect.ps1`,
+		StartedAt:      started,
+		FinishedAt:     started.Add(90*time.Second + 500*time.Millisecond),
+	}
+	path := filepath.Join(t.TempDir(), "collector.prom")
+	if err := writeMetricsTextfile(path, outcome); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	families := parseOpenMetrics(t, data)
+
+	tests := []struct {
+		family string
+		kind   model.MetricType
+		unit   string
+		value  float64
+	}{
+		{"hosts_total", model.MetricTypeGauge, "", 5},
+		{"hosts_succeeded", model.MetricTypeGauge, "", 3},
+		{"hosts_failed", model.MetricTypeGauge, "", 1},
+		{"hosts_skipped", model.MetricTypeGauge, "", 1},
+		{"breaker_trips", model.MetricTypeCounter, "", 3},
+		{"exit_code", model.MetricTypeGauge, "", exitPartialFailure},
+		{"duration_seconds", model.MetricTypeGauge, "seconds", 90.5},
+		{"api_calls", model.MetricTypeCounter, "", 5},
+		{"log_rotations", model.MetricTypeCounter, "", 2},
+		{"last_run_timestamp", model.MetricTypeGauge, "", float64(outcome.FinishedAt.Unix()) + 0.5},
+	}
+	if len(families) != len(tests) {
+		t.Errorf("textfile has %d metric families, want %d", len(families), len(tests))
+	}
+	for _, test := range tests {
+		t.Run(test.family, func(t *testing.T) {
+			name := metricsPrefix + test.family
+			family, ok := families[name]
+			if !ok {
+				t.Fatalf("metric family %s missing", name)
+			}
+			if family.kind != test.kind {
+				t.Errorf("type = %s, want %s", family.kind, test.kind)
+			}
+			if family.unit != test.unit {
+				t.Errorf("unit = %q, want %q", family.unit, test.unit)
+			}
+			if family.help == "" {
+				t.Error("help missing")
+			}
+			sampleName := name
+			if test.kind == model.MetricTypeCounter {
+				sampleName += "_total"
+			}
+			sample, ok := family.samples[sampleName]
+			if !ok || len(family.samples) != 1 {
+				t.Fatalf("samples = %v, want one named %s", family.samples, sampleName)
+			}
+			if sample.value != test.value {
+				t.Errorf("value = %v, want %v", sample.value, test.value)
+			}
+			if got := sample.labels.Get("profile"); got != outcome.Profile {
+				t.Errorf("profile label = %q, want %q", got, outcome.Profile)
+			}
+			if got := sample.labels.Get("script"); got != outcome.Script {
+				t.Errorf("script label = %q, want %q", got, outcome.Script)
+			}
+		})
+	}
+}
+
+func TestWriteMetricsTextfileEmptyOutcome(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collector.prom")
+	if err := writeMetricsTextfile(path, &runOutcome{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	families := parseOpenMetrics(t, data)
+	if got := families[metricsPrefix+"api_calls"].samples[metricsPrefix+"api_calls_total"].value; got != 0 {
+		t.Errorf("api_calls_total = %v without metrics, want 0", got)
+	}
+}
+
+func TestFormatOpenMetricsRejects(t *testing.T) {
+	gauge := textfileMetric{name: "hosts_total", kind: "gauge", help: "Hosts."}
+	tests := []struct {
+		name    string
+		metric  textfileMetric
+		label   string
+		wantErr string
+	}{
+		{"metric name", textfileMetric{name: "hosts-total", kind: "gauge"}, "profile", "invalid metric name"},
+		{"label name", gauge, "script name", "invalid metric label name"},
+		{"reserved label name", gauge, "__name__", "invalid metric label name"},
+		{"label name starting with a digit", gauge, "1script", "invalid metric label name"},
+		{"type", textfileMetric{name: "hosts", kind: "histogram"}, "profile", `unsupported type "histogram"`},
+		{"unit missing from the name", textfileMetric{name: "duration", kind: "gauge", unit: "seconds"}, "profile", `must end with its unit "seconds"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := formatOpenMetrics([]textfileMetric{test.metric}, [][2]string{{test.label, "x"}})
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("error = %v, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/audit"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/naming"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/notify"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/rundir"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// Exit codes are a stable contract for automation wrapping the CLI.
+const (
+	exitSucceeded      = 0  // All hosts succeeded
+	exitPartialFailure = 10 // Some hosts failed
+	exitAllFailed      = 20 // Every host failed
+	exitConfigError    = 30 // Authentication or configuration error
+	exitPolicyRejected = 40 // Preflight or policy rejection
+	exitInterrupted    = 50 // Interrupted by a signal
+	exitApprovalDenied = 60 // Change-control approval rejected or timed out
+)
+
+// outcomeStatuses names each exit code in the run-outcome file.
+var outcomeStatuses = map[int]string{
+	exitSucceeded:      "succeeded",
+	exitPartialFailure: "partial_failure",
+	exitAllFailed:      "failed",
+	exitConfigError:    "config_error",
+	exitPolicyRejected: "policy_rejected",
+	exitInterrupted:    "interrupted",
+	exitApprovalDenied: "approval_rejected",
+}
+
+// exitError attaches an exit code to an error.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// withExitCode wraps err so the top-level handler exits with code.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCodeFor maps an error to its exit code. Unclassified errors count as
+// host failures.
+func exitCodeFor(err error) int {
+	if err == nil {
+		return exitSucceeded
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return exitAllFailed
+}
+
+// parseExitCode is the exit code of a subcommand whose flags did not
+// parse: success for -h, which printed the usage, and a config error
+// otherwise.
+func parseExitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitSucceeded
+	}
+	return exitCodeFor(withExitCode(exitConfigError, err))
+}
+
+// failureHint returns the remediation hint for a failed host or run: from
+// the classified command of result when it failed, otherwise from err. It
+// is "" with --no-hints and for failures the classification does not know.
+func failureHint(noHints bool, result *sink.Result, err error) string {
+	switch {
+	case noHints:
+		return ""
+	case result != nil && result.FailureReason != "":
+		return rtr.CommandHint(result.Errors, result.Stderr)
+	case err != nil:
+		return rtr.FailureHint(err.Error())
+	}
+	return ""
+}
+
+// runOutcome is the small machine-readable summary written after every run,
+// including runs that abort before contacting any host.
+type runOutcome struct {
+	RunID                   string                   `json:"run_id"`
+	Status                  string                   `json:"status"`
+	ExitCode                int                      `json:"exit_code"`
+	HostsTotal              int                      `json:"hosts_total"`
+	HostsSucceeded          int                      `json:"hosts_succeeded"`
+	HostsFailed             int                      `json:"hosts_failed"`
+	HostsSkipped            int                      `json:"hosts_skipped"` // Skipped as busy, failing prerequisites, quarantined or by a hook
+	ReceiptsPlaced          int                      `json:"receipts_placed,omitempty"`
+	ReceiptsFailed          int                      `json:"receipts_failed,omitempty"`
+	HostsWarned             int                      `json:"hosts_warned,omitempty"`      // Collected hosts that raised warnings
+	ThrottlePauses          int                      `json:"throttle_pauses,omitempty"`   // Times a 429 paused every poller
+	ThrottledMS             int64                    `json:"throttled_ms,omitempty"`      // Combined length of those pauses
+	Warnings                map[string]int           `json:"warnings,omitempty"`          // Warning counts by code
+	SecurityFindings        []string                 `json:"security_findings,omitempty"` // Integrity problems that refused the run, such as a changed pinned script
+	Metrics                 *rtr.MetricsSnapshot     `json:"metrics,omitempty"`           // Calls, sessions, downloads and command latency
+	Profile                 string                   `json:"profile,omitempty"`           // Config profile the run used
+	Script                  string                   `json:"script,omitempty"`            // Cloud script the run executes
+	ReportPath              string                   `json:"report_path,omitempty"`
+	Approval                string                   `json:"approval,omitempty"`                 // Change-control reference the run was approved under
+	DestructiveConfirmation *destructiveConfirmation `json:"destructive_confirmation,omitempty"` // How the destructive commands were confirmed
+	Metadata                *sink.Metadata           `json:"metadata,omitempty"`                 // Case, operator and reason the run was made for
+	Targets                 []sink.TargetMapping     `json:"targets,omitempty"`                  // Serial and MAC identifiers and the devices they resolved to
+	Sinks                   []sink.DeliveryStatus    `json:"sinks,omitempty"`                    // Deliveries, flushes and drops per sink
+	Names                   *names                   `json:"names,omitempty"`
+	LogFile                 string                   `json:"log_file,omitempty"`      // --log-file the run's progress went to
+	LogRotations            int                      `json:"log_rotations,omitempty"` // Times the run rotated it
+	RunDir                  string                   `json:"run_dir,omitempty"`       // Directory the run wrote under (run_dirs)
+	AuditLog                string                   `json:"audit_log,omitempty"`     // Local audit log the run appended to
+	Concurrency             *config.Concurrency      `json:"concurrency,omitempty"`   // Parallelism the run was configured with
+	Capabilities            *capabilities            `json:"capabilities,omitempty"`
+	Hooks                   []sink.HookOutcome       `json:"hooks,omitempty"`        // Pre-run and post-run hooks called
+	Inventory               *inventoryRecord         `json:"inventory,omitempty"`    // Device inventory snapshot written with the run
+	CircuitOpen             []string                 `json:"circuit_open,omitempty"` // Devices the circuit breaker stopped attempting, and why
+	Error                   string                   `json:"error,omitempty"`
+	Hint                    string                   `json:"hint,omitempty"` // How to fix the classified error, unless --no-hints
+	StartedAt               time.Time                `json:"started_at"`
+	FinishedAt              time.Time                `json:"finished_at"`
+
+	results   []*sink.Result    // Per-host results, for --format jsonl and csv
+	runDir    *rundir.Dir       // Released, and made latest, once the outcome is written
+	audit     *audit.Log        // What the run did in the tenant, for the client to record into
+	labels    map[string]string // Labels the pre_run hooks added for every host
+	inventory *rtr.Inventory    // Snapshot taken after target selection, written with the results
+}
+
+// MarshalJSON writes the outcome with its times in sink.TimeFormat.
+func (o runOutcome) MarshalJSON() ([]byte, error) {
+	type plain runOutcome
+	return json.Marshal(struct {
+		plain
+		StartedAt  string `json:"started_at"`
+		FinishedAt string `json:"finished_at"`
+	}{plain(o), sink.FormatTime(o.StartedAt), sink.FormatTime(o.FinishedAt)})
+}
+
+// defaultOutcomePath is used when neither --outcome-file nor COLLECTOR_OUTCOME_FILE is set.
+const defaultOutcomePath = "run-outcome.json"
+
+// writeOutcome writes the outcome as JSON to target, which is a file path or
+// "fd:N" for an already-open file descriptor inherited from the caller.
+func writeOutcome(target string, outcome *runOutcome) error {
+	data, err := json.MarshalIndent(outcome, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run outcome: %w", err)
+	}
+	data = append(data, '\n')
+
+	if fd, ok := strings.CutPrefix(target, "fd:"); ok {
+		n, err := strconv.Atoi(fd)
+		if err != nil {
+			return fmt.Errorf("invalid outcome file descriptor %q", target)
+		}
+		file := os.NewFile(uintptr(n), target)
+		if file == nil {
+			return fmt.Errorf("invalid outcome file descriptor %q", target)
+		}
+		_, err = file.Write(data)
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial outcome.
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write run outcome: %w", err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return fmt.Errorf("failed to write run outcome: %w", err)
+	}
+	return nil
+}
+
+// capabilities records the capability set a run detected and the features
+// it disabled.
+type capabilities struct {
+	rtr.Capabilities
+	Disabled []string `json:"disabled,omitempty"`
+}
+
+// capabilityReport builds the capabilities record of a run.
+func capabilityReport(caps rtr.Capabilities) *capabilities {
+	return &capabilities{Capabilities: caps, Disabled: caps.Disabled()}
+}
+
+// names records the file name templates of a run and the names resolved
+// from them.
+type names struct {
+	Templates map[string]string `json:"templates"`
+	Report    string            `json:"report,omitempty"` // Attachment name of the status report
+	Files     []string          `json:"files,omitempty"`
+	Renamed   map[string]string `json:"renamed,omitempty"` // Names the templates produced to the files written, where made portable or suffixed
+}
+
+// fileNames builds the names record of a run that wrote files.
+func fileNames(cfg *config.Config, summary *notify.Summary, files []string, renamed map[string]string) *names {
+	return &names{
+		Templates: map[string]string{
+			"artifact": cfg.Naming.Artifact,
+			"output":   cfg.Naming.Output,
+			"report":   cfg.Naming.Report,
+		},
+		Report:  summary.ReportName,
+		Files:   files,
+		Renamed: renamed,
+	}
+}
+
+// nameReport names the status report attachment from naming.report. The
+// device ID is only filled for single-host runs.
+func nameReport(cfg *config.Config, summary *notify.Summary, deviceIDs []string) error {
+	template, err := naming.Parse(cfg.Naming.Report)
+	if err != nil {
+		return err
+	}
+	fields := naming.Fields{RunID: cfg.RunID, CaseID: cfg.CaseID, Command: "runscript", Name: "status", Ext: ".json", Time: time.Now()}
+	if len(deviceIDs) == 1 {
+		fields.DeviceID = deviceIDs[0]
+	}
+	name, err := template.Resolve(fields)
+	if err != nil {
+		return err
+	}
+	summary.ReportName = path.Base(name)
+	return nil
+}
+
+// runReport is the status report of a run: its status and the sink result
+// of every host, in the order of the targets.
+type runReport struct {
+	RunID  string         `json:"run_id"`
+	Status string         `json:"status"`
+	Hosts  []*sink.Result `json:"hosts"`
+}
+
+// writeReport builds the status report of the run into summary, for the
+// email to attach, and writes it under output_dir, named by naming.report.
+// Where it went is recorded in outcome and summary.
+func writeReport(cfg *config.Config, summary *notify.Summary, outcome *runOutcome, warnings *sink.Warnings) {
+	summary.Report, _ = json.MarshalIndent(runReport{RunID: cfg.RunID, Status: summary.Status, Hosts: outcome.results}, "", "  ")
+	reportPath := filepath.Join(cfg.OutputDir, summary.ReportName)
+	err := os.MkdirAll(filepath.Dir(reportPath), 0700)
+	if err == nil {
+		err = os.WriteFile(reportPath, summary.Report, 0600)
+	}
+	if err != nil {
+		warnings.Add(sink.WarningReportFailed, "", "failed to write status report %s: %v", reportPath, err)
+		return
+	}
+	outcome.ReportPath, summary.ReportPath = reportPath, reportPath
+	progress.Printf("Status report written to %s\n", reportPath)
+}
+
+// formatMetadata renders the set metadata fields as "field=value, ...".
+func formatMetadata(metadata *sink.Metadata) string {
+	var parts []string
+	for _, field := range []struct{ name, value string }{
+		{"case_id", metadata.CaseID},
+		{"operator", metadata.Operator},
+		{"reason", metadata.Reason},
+		{"ticket_url", metadata.TicketURL},
+	} {
+		if field.value != "" {
+			parts = append(parts, field.name+"="+field.value)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+func TestExitCodeFor(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, exitSucceeded},
+		{"unclassified", errors.New("host failed"), exitAllFailed},
+		{"partial failure", withExitCode(exitPartialFailure, errors.New("1 of 2 hosts failed")), exitPartialFailure},
+		{"config error", withExitCode(exitConfigError, errors.New("Configuration Error")), exitConfigError},
+		{"policy rejection", withExitCode(exitPolicyRejected, errors.New("CID mismatch")), exitPolicyRejected},
+		{"interrupted", withExitCode(exitInterrupted, errors.New("Run interrupted")), exitInterrupted},
+		{"approval denied", withExitCode(exitApprovalDenied, errors.New("Approval Error")), exitApprovalDenied},
+		{"wrapped", fmt.Errorf("tenant acme: %w", withExitCode(exitConfigError, errors.New("no credentials"))), exitConfigError},
+		{"outermost class wins", withExitCode(exitPartialFailure, withExitCode(exitInterrupted, errors.New("stop"))), exitPartialFailure},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := exitCodeFor(test.err); got != test.want {
+				t.Errorf("exitCodeFor = %d, want %d", got, test.want)
+			}
+		})
+	}
+	if err := withExitCode(exitConfigError, nil); err != nil {
+		t.Errorf("withExitCode(nil) = %v, want nil", err)
+	}
+}
+
+func TestOutcomeStatusesNameEveryExitCode(t *testing.T) {
+	codes := map[int]int{
+		exitSucceeded:      0,
+		exitPartialFailure: 10,
+		exitAllFailed:      20,
+		exitConfigError:    30,
+		exitPolicyRejected: 40,
+		exitInterrupted:    50,
+		exitApprovalDenied: 60,
+	}
+	for code, want := range codes {
+		if code != want {
+			t.Errorf("exit code %d changed to %d; it is a documented contract", want, code)
+		}
+		if outcomeStatuses[code] == "" {
+			t.Errorf("exit code %d has no outcome status", code)
+		}
+	}
+	if len(outcomeStatuses) != len(codes) {
+		t.Errorf("%d outcome statuses for %d exit codes", len(outcomeStatuses), len(codes))
+	}
+}
+
+// TestSubcommandFlagErrors checks that a subcommand given flags it does not
+// know exits with the config error code, not the flag package's own 2.
+func TestSubcommandFlagErrors(t *testing.T) {
+	stderr := os.Stderr
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	os.Stderr = devNull
+	defer func() { os.Stderr = stderr }()
+
+	// Actions of the subcommands that have them.
+	actions := map[string]string{"config": "print", "profiles": "list", "approval": "plan", "tenants": "run", "scripts": "sync"}
+	for name, run := range subcommands {
+		args := []string{"--no-such-flag"}
+		if action, ok := actions[name]; ok {
+			args = append([]string{action}, args...)
+		}
+		if code := run(args); code != exitConfigError {
+			t.Errorf("%s %q exited %d, want %d", name, args, code, exitConfigError)
+		}
+	}
+	if code := parseExitCode(flag.ErrHelp); code != exitSucceeded {
+		t.Errorf("parseExitCode(ErrHelp) = %d, want %d", code, exitSucceeded)
+	}
+}
+
+func TestFailureHint(t *testing.T) {
+	tests := []struct {
+		name    string
+		noHints bool
+		result  *sink.Result
+		err     error
+		want    string // In the hint; "" for none
+	}{
+		{name: "success", result: &sink.Result{}},
+		{name: "classified command", result: &sink.Result{FailureReason: rtr.FailureSessionLimit, Stderr: "Too many concurrent sessions"}, want: "Close idle RTR sessions"},
+		{name: "command over the error", result: &sink.Result{FailureReason: rtr.FailureAccessDenied, Stderr: "Access is denied."}, err: errors.New("status code 403"), want: "refused access"},
+		{name: "error without a command", err: errors.New("Failed to initialize RTR session: API request failed with status code 403"), want: "'Real time response (admin)'"},
+		{name: "error after a clean command", result: &sink.Result{}, err: errors.New("Host is offline"), want: "The host is offline"},
+		{name: "unclassified error", err: errors.New("host failed")},
+		{name: "no hints", noHints: true, err: errors.New("status code 403")},
+		{name: "no hints for a command", noHints: true, result: &sink.Result{FailureReason: rtr.FailureTimeout, Stderr: "timed out"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hint := failureHint(test.noHints, test.result, test.err)
+			if (test.want == "") != (hint == "") || !strings.Contains(hint, test.want) {
+				t.Errorf("failureHint = %q, want one containing %q", hint, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// outputFormats are the values of --format. text writes the human summary
+// to stdout; the others write machine output there and the summary goes to
+// the progress output with everything else.
+var outputFormats = []string{"text", "json", "jsonl", "csv"}
+
+// resultColumns are the columns of --format csv, one row per host.
+var resultColumns = []string{"run_id", "device_id", "status", "failure_reason", "error", "duration_ms", "session_id", "cloud_request_id", "collected_at", "stdout", "stderr"}
+
+// writeMachineOutput writes the run in format to w: json is the run
+// outcome, jsonl one sink result per line and csv one row per host.
+func writeMachineOutput(w io.Writer, format string, outcome *runOutcome) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(outcome, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal run outcome: %w", err)
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case "jsonl":
+		encoder := json.NewEncoder(w)
+		for _, result := range outcome.results {
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write(resultColumns)
+		for _, result := range outcome.results {
+			writer.Write([]string{
+				result.RunID, result.DeviceID, result.Status, result.FailureReason, result.Error,
+				strconv.FormatInt(result.DurationMS, 10), result.SessionID, result.CloudRequestID,
+				sink.FormatTime(result.CollectedAt), result.Stdout, result.Stderr,
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+// writeSummary writes the human summary of the run: its status, host
+// counts, per-sink delivery and warnings, and the metrics table with stats.
+func writeSummary(w io.Writer, outcome *runOutcome, stats bool) {
+	fmt.Fprintln(w, "--- Run Summary ---")
+	fmt.Fprintf(w, "Run %s: %s (exit code %d)\n", outcome.RunID, outcome.Status, outcome.ExitCode)
+	fmt.Fprintf(w, "Hosts: %d total, %d succeeded, %d failed, %d skipped\n",
+		outcome.HostsTotal, outcome.HostsSucceeded, outcome.HostsFailed, outcome.HostsSkipped)
+	for _, status := range outcome.Sinks {
+		fmt.Fprintf(w, "Sink %s: %s\n", status.Sink, sink.FormatDeliveryStatus(status))
+	}
+	if len(outcome.Warnings) > 0 {
+		total := 0
+		for _, n := range outcome.Warnings {
+			total += n
+		}
+		fmt.Fprintf(w, "Warnings: %d (%s)\n", total, sink.FormatWarningCounts(outcome.Warnings))
+	}
+	if stats && outcome.Metrics != nil {
+		fmt.Fprintln(w, "\n--- Run Metrics ---")
+		outcome.Metrics.WriteTable(w)
+	}
+}
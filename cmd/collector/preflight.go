@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+)
+
+// busyRecheckInterval is how often busy_policy wait re-checks a busy host.
+const busyRecheckInterval = 30 * time.Second
+
+// busyHosts returns the live sessions other operators hold on deviceIDs.
+// With busy_policy proceed nothing is checked. A failed lookup is a warning,
+// not a reason to stop the run.
+func busyHosts(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config, deviceIDs []string) map[string][]rtr.AuditSession {
+	if cfg.BusyPolicy == "proceed" {
+		return nil
+	}
+	busy, err := rtrClient.ActiveSessions(ctx, deviceIDs)
+	if err != nil {
+		progress.Printf("Warning: could not check for active RTR sessions: %v\n", err)
+		return nil
+	}
+	for _, deviceID := range deviceIDs {
+		if sessions := busy[deviceID]; len(sessions) > 0 {
+			progress.Printf("Device %s already has %d active RTR session(s): %s\n", deviceID, len(sessions), rtr.SessionHolders(sessions))
+		}
+	}
+	return busy
+}
+
+// awaitIdle applies busy_policy to a host found busy. It returns an empty
+// string when the run may go ahead on the host, or who holds the session
+// when the host must be skipped. With busy_policy wait the host is re-checked
+// until busy_wait runs out.
+func awaitIdle(ctx context.Context, rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config, deviceID string, sessions []rtr.AuditSession) string {
+	holders := rtr.SessionHolders(sessions)
+	if cfg.BusyPolicy != "wait" {
+		progress.Printf("Skipping device %s: busy with an RTR session held by %s\n", deviceID, holders)
+		return holders
+	}
+
+	deadline := time.Now().Add(time.Duration(cfg.BusyWait))
+	for time.Now().Before(deadline) {
+		delay := min(busyRecheckInterval, time.Until(deadline))
+		progress.Printf("Device %s is busy (session held by %s), re-checking in %s...\n", deviceID, holders, delay.Round(time.Second))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return holders
+		}
+		active, err := rtrClient.ActiveSessions(ctx, []string{deviceID})
+		if err != nil {
+			progress.Printf("Warning: could not re-check device %s: %v\n", deviceID, err)
+			continue
+		}
+		if len(active[deviceID]) == 0 {
+			progress.Printf("Device %s is no longer busy.\n", deviceID)
+			return ""
+		}
+		holders = rtr.SessionHolders(active[deviceID])
+	}
+	progress.Printf("Skipping device %s: still busy after %s, session held by %s\n", deviceID, time.Duration(cfg.BusyWait), holders)
+	return holders
+}
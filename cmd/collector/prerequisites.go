@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// errPreconditionFailed marks a host skipped because it failed its
+// prerequisites.
+var errPreconditionFailed = errors.New("precondition failed")
+
+// resourceProbe is the prerequisites probe of cfg.
+func resourceProbe(cfg *config.Config) rtr.ResourceProbe {
+	return rtr.ResourceProbe{
+		Volume:  cfg.Prerequisites.Volume,
+		Scripts: cfg.Prerequisites.Commands,
+		Timeout: time.Duration(cfg.Prerequisites.Timeout),
+	}
+}
+
+// checkPrerequisites probes the host of session for free disk space and
+// memory and returns what it found, or nil when the probe failed. The error
+// wraps errPreconditionFailed when the host falls short of prerequisites,
+// or when the probe failed and on_probe_failure is skip; a probe failure is
+// otherwise a prerequisites_unknown warning and the host is collected.
+func checkPrerequisites(ctx context.Context, session *rtr.Session, cfg *config.Config, timing *sink.Timing, warnings *sink.Warnings) (*sink.HostResources, error) {
+	prerequisites := cfg.Prerequisites
+	probeDone := timing.Start("prerequisites")
+	resources, err := session.ProbeResources(ctx, resourceProbe(cfg))
+	probeDone()
+	if err == nil && prerequisites.MinFreeMemoryMB > 0 && resources.FreeMemoryBytes < 0 {
+		err = fmt.Errorf("%w: device %s reported no free_memory", rtr.ErrProbeUnparsed, session.DeviceID)
+	}
+	if err != nil {
+		if ctxErr := interrupted(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if prerequisites.OnProbeFailure == "skip" {
+			return nil, fmt.Errorf("device %s skipped: %w: %v (prerequisites.on_probe_failure is skip)", session.DeviceID, errPreconditionFailed, err)
+		}
+		warnings.Add(sink.WarningPrerequisitesUnknown, session.DeviceID, "prerequisites not checked, collecting anyway: %v", err)
+		return nil, nil
+	}
+
+	const mb = 1 << 20
+	progress.Printf("Device %s has %d MB free on %s and %s of free memory\n", session.DeviceID, resources.FreeDiskBytes/mb, resources.Volume, formatMB(resources.FreeMemoryBytes))
+	if minimum := prerequisites.MinFreeDiskMB; minimum > 0 && resources.FreeDiskBytes < minimum*mb {
+		return &resources, fmt.Errorf("device %s skipped: %w: %d MB free on %s, prerequisites.min_free_disk_mb is %d",
+			session.DeviceID, errPreconditionFailed, resources.FreeDiskBytes/mb, resources.Volume, minimum)
+	}
+	if minimum := prerequisites.MinFreeMemoryMB; minimum > 0 && resources.FreeMemoryBytes < minimum*mb {
+		return &resources, fmt.Errorf("device %s skipped: %w: %d MB of free memory, prerequisites.min_free_memory_mb is %d",
+			session.DeviceID, errPreconditionFailed, resources.FreeMemoryBytes/mb, minimum)
+	}
+	return &resources, nil
+}
+
+// formatMB renders a byte count the probe reported in MB, or "unknown".
+func formatMB(bytes int64) string {
+	if bytes < 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d MB", bytes>>20)
+}
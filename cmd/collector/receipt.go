@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/evidence"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// receiptPrefix starts the names of the temporary put-files receipts are
+// uploaded as, so "cleanup --prune-prefix" finds any a crashed run left.
+const receiptPrefix = "collector-receipt-"
+
+// receiptStep places a signed receipt on each host whose collection
+// succeeded (receipt.path).
+type receiptStep struct {
+	rtrClient *rtr.CrowdStrikeRTRClient
+	cfg       *config.Config
+	signer    *evidence.Signer
+}
+
+// newReceiptStep returns the run's receipt step, or nil when receipt.path is
+// not set. Uploading the put-file needs the RTR admin scope.
+func newReceiptStep(rtrClient *rtr.CrowdStrikeRTRClient, cfg *config.Config, caps rtr.Capabilities) (*receiptStep, error) {
+	if cfg.Receipt.Path == "" {
+		return nil, nil
+	}
+	if err := caps.CheckEndpoint(rtr.AdminCommandEndpoint); err != nil {
+		return nil, withExitCode(exitConfigError, fmt.Errorf("Scope Error: receipt.path needs put-file uploads: %v", err))
+	}
+	signer, err := evidence.LoadSigner(cfg.Signing.Key, cfg.Signing.Cert)
+	if err != nil {
+		return nil, withExitCode(exitConfigError, fmt.Errorf("Configuration Error: signing: %v", err))
+	}
+	return &receiptStep{rtrClient: rtrClient, cfg: cfg, signer: signer}, nil
+}
+
+// place signs a receipt for result and drops it on the session's host. A
+// failure is reported in the returned status rather than failing the host.
+func (r *receiptStep) place(ctx context.Context, session *rtr.Session, result *sink.Result, timing *sink.Timing) *sink.ReceiptStatus {
+	progress.Println("\n--- Step 5: Placing Collection Receipt ---")
+	done := timing.Start("receipt")
+	defer done()
+
+	status := &sink.ReceiptStatus{Path: r.cfg.Receipt.Path, Status: "failed"}
+	if err := r.placeReceipt(ctx, session, result, status); err != nil {
+		status.Error = err.Error()
+		session.Warnings.Add(sink.WarningReceiptFailed, session.DeviceID, "failed to place receipt at %s: %v", status.Path, err)
+		return status
+	}
+	status.Status = "placed"
+	progress.Printf("Receipt placed at %s (sha256 %s)\n", status.Path, status.SHA256)
+	return status
+}
+
+// placeReceipt uploads the signed receipt as a put-file named for the run
+// and host, puts it at receipt.path and deletes the put-file again.
+func (r *receiptStep) placeReceipt(ctx context.Context, session *rtr.Session, result *sink.Result, status *sink.ReceiptStatus) error {
+	collected := sha256.Sum256([]byte(result.Stdout))
+	receipt := &evidence.Receipt{
+		RunID:            r.cfg.RunID,
+		CID:              result.CID,
+		DeviceID:         session.DeviceID,
+		CollectedAt:      time.Now().UTC(),
+		CollectorVersion: version,
+		CollectedSHA256:  hex.EncodeToString(collected[:]),
+	}
+	if err := receipt.Sign(r.signer); err != nil {
+		return fmt.Errorf("receipt: %w", err)
+	}
+	data, err := json.MarshalIndent(receipt, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode receipt: %w", err)
+	}
+	digest := sha256.Sum256(data)
+	status.SHA256 = hex.EncodeToString(digest[:])
+
+	name := receiptPrefix + r.cfg.RunID + "-" + session.DeviceID + ".json"
+	file, err := r.rtrClient.UploadPutFile(ctx, name, "Collection receipt of run "+r.cfg.RunID, data)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// The put-file is only a vehicle; never leave it in the cloud.
+		if err := r.rtrClient.DeleteCloudFile(context.Background(), file); err != nil {
+			progress.Printf("Warning: %v\n", err)
+		}
+	}()
+	return session.PlaceFile(ctx, name, r.cfg.Receipt.Path)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/audit"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/hooks"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files under testdata")
+
+// reportDevices are listed out of hostname order, and with hostnames in
+// mixed case, so that the reports show the order they were sorted into.
+var reportDevices = []string{
+	"{device_id: cccccccccccccccccccccccccccccccc, hostname: Charlie, platform: windows}",
+	"{device_id: aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa, hostname: alpha, platform: windows}",
+	"{device_id: dddddddddddddddddddddddddddddddd, hostname: bravo, platform: windows}",
+	"{device_id: bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb, hostname: bravo, platform: windows%s}",
+}
+
+var (
+	// reportTime matches the timestamps of a report, and reportTimeUTC the
+	// format they must have: UTC with exactly three fractional digits.
+	reportTime    = regexp.MustCompile(`"(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[^"]*)"`)
+	reportTimeUTC = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}Z$`)
+	// reportDuration and reportID match what varies between runs: durations,
+	// and the session, command and trace IDs the simulated API hands out.
+	// Durations are dropped rather than masked, since one that rounds to 0 ms
+	// is omitted: reportDuration matches the field followed by another one,
+	// and reportLastDuration the last field of an object.
+	reportDuration     = regexp.MustCompile(`(?m)^\s*"duration_ms": \d+,\n`)
+	reportLastDuration = regexp.MustCompile(`,\n\s*"duration_ms": \d+\n`)
+	reportID           = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+)
+
+// interruptions holds, by run ID, the device whose host_pre hook cancels
+// the run, and how.
+var interruptions sync.Map
+
+// The test hook is the one host_pre hook the package's tests register, as
+// every registered hook shows in the reports of every run: it interrupts the
+// runs in interruptions and holds the hosts of the runs in loads.
+func init() {
+	hooks.RegisterHostPre("test", func(ctx context.Context, host *hooks.HostPre) error {
+		holdLoad(host)
+		if value, ok := interruptions.Load(host.RunID); ok {
+			if interrupt := value.(reportInterrupt); host.DeviceID == interrupt.deviceID {
+				interrupt.cancel()
+				<-ctx.Done()
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+}
+
+type reportInterrupt struct {
+	deviceID string
+	cancel   context.CancelFunc
+}
+
+// TestReportGolden runs collections against the simulated API and compares
+// the status report each writes to testdata/report/<name>.golden.json.
+// Timestamps are checked for their format and then, like IDs, masked;
+// durations are dropped. Run with -update to rewrite the golden files after a change.
+func TestReportGolden(t *testing.T) {
+	tests := []struct {
+		name        string
+		offline     bool   // bbbb… is offline
+		interruptAt string // Device whose collection is interrupted
+		hosts       int    // concurrency.hosts
+		wantCode    int
+	}{
+		{name: "success", hosts: 4, wantCode: exitSucceeded},
+		{name: "partial", offline: true, hosts: 4, wantCode: exitPartialFailure},
+		// One host at a time, so that the hosts after the interrupted one
+		// are never dispatched.
+		{name: "interrupted", interruptAt: "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", hosts: 1, wantCode: exitInterrupted},
+	}
+	output := progress.Output()
+	progress.SetOutput(io.Discard)
+	t.Cleanup(func() { progress.SetOutput(output) })
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			offline := ""
+			if test.offline {
+				offline = ", offline: true"
+			}
+			devices := fmt.Sprintf(strings.Join(reportDevices, "\n    - "), offline)
+			configPath := filepath.Join(dir, "config.yaml")
+			configYAML := fmt.Sprintf(`script_name: collect.ps1
+output_dir: %s
+naming: {report: "status.json"}
+target: {hostname: "*"}
+command_wait: 1ms
+concurrency: {hosts: %d}
+simulation:
+  enabled: true
+  seed: 1
+  outputs: {collect.ps1: "collected\n"}
+  devices:
+    - %s
+`, dir, test.hosts, devices)
+			if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			runID := "run-" + test.name
+			if test.interruptAt != "" {
+				interruptions.Store(runID, reportInterrupt{deviceID: test.interruptAt, cancel: cancel})
+				defer interruptions.Delete(runID)
+			}
+			err := collect(ctx, config.Flags{ConfigPath: configPath, RunID: runID}, &runOutcome{})
+			if got := exitCodeFor(err); got != test.wantCode {
+				t.Fatalf("exit code %d, want %d (%v)", got, test.wantCode, err)
+			}
+			checkAuditLog(t, filepath.Join(dir, audit.DefaultName), runID)
+			report, err := os.ReadFile(filepath.Join(dir, "status.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, match := range reportTime.FindAllSubmatch(report, -1) {
+				if !reportTimeUTC.Match(match[1]) {
+					t.Errorf("timestamp %s is not UTC with millisecond precision", match[1])
+				}
+			}
+			got := reportTime.ReplaceAll(report, []byte(`"<time>"`))
+			got = reportDuration.ReplaceAll(got, nil)
+			got = reportLastDuration.ReplaceAll(got, []byte("\n"))
+			got = reportID.ReplaceAll(got, []byte("<id>"))
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", "report", test.name+".golden.json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("report differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+// checkAuditLog checks that the run's audit log opens with run_started,
+// closes with run_finished, records the sessions opened and stamps every
+// record with the run ID, and those after authentication with the CID.
+func checkAuditLog(t *testing.T, path, runID string) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var events []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record audit.Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.RunID != runID {
+			t.Errorf("audit record %s has run ID %q, want %q", record.Event, record.RunID, runID)
+		}
+		if record.Event == audit.EventSessionOpened && (record.DeviceID == "" || record.SessionID == "" && record.Error == "") {
+			t.Errorf("session record lacks its device or session: %s", scanner.Text())
+		}
+		if record.Event != audit.EventRunStarted && record.CID == "" {
+			t.Errorf("audit record %s has no CID", record.Event)
+		}
+		events = append(events, record.Event)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) < 3 || events[0] != audit.EventRunStarted || events[len(events)-1] != audit.EventRunFinished || !slices.Contains(events, audit.EventSessionOpened) {
+		t.Errorf("audit events = %q, want run_started, the sessions opened, then run_finished", events)
+	}
+}
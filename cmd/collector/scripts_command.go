@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runScriptsCommand implements the "scripts" subcommands: "pin-update" and
+// "sync".
+func runScriptsCommand(args []string) int {
+	if len(args) > 0 && args[0] == "pin-update" {
+		return runPinUpdate(args[1:])
+	}
+	if len(args) > 0 && args[0] == "sync" {
+		return runScriptSync(args[1:])
+	}
+	fmt.Fprintln(os.Stderr, "Usage: crowdstrike-data-collector scripts pin-update [--scripts a,b] [config flags]")
+	fmt.Fprintln(os.Stderr, "       crowdstrike-data-collector scripts sync --dir path [--prune] [--dry-run] [--format text|json] [config flags]")
+	return 2
+}
+
+// runPinUpdate implements "scripts pin-update", which fetches the current
+// SHA256 of cloud scripts and writes them into script_pins_file for review.
+// It pins the scripts already in the file, the configured script and any
+// named with --scripts. It exits 0 on success, 1 when a script could not be
+// fetched, leaving the file untouched, and 2 on usage errors.
+func runPinUpdate(args []string) int {
+	flags := config.Flags{}
+	flagSet := flag.NewFlagSet("scripts pin-update", flag.ContinueOnError)
+	registerConfigFlags(flagSet, &flags)
+	scripts := flagSet.String("scripts", "", "Comma-separated cloud scripts to pin besides those already pinned and the configured script")
+	if err := flagSet.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return 2
+	}
+	pinsFile := cfg.ScriptPinsFile
+	if pinsFile == "" {
+		fmt.Fprintln(os.Stderr, "scripts pin-update: script_pins_file (SCRIPT_PINS_FILE) must name the file to write")
+		return 2
+	}
+	pins, err := rtr.LoadScriptPins(pinsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		pins, err = map[string]string{}, nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return 2
+	}
+	// The pins are being replaced, so the client must not check against them.
+	cfg.ScriptPinsFile = ""
+	rtrClient, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return 2
+	}
+	ctx := context.Background()
+	if err := rtrClient.Authenticate(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to authenticate: %v\n", err)
+		return 1
+	}
+
+	wanted := map[string]bool{}
+	if cfg.ScriptName != "" {
+		wanted[cfg.ScriptName] = true
+	}
+	for name := range pins {
+		wanted[name] = true
+	}
+	for _, name := range strings.Split(*scripts, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			wanted[name] = true
+		}
+	}
+	names := make([]string, 0, len(wanted))
+	for name := range wanted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	updated, failed := map[string]string{}, 0
+	for _, name := range names {
+		script, err := rtrClient.GetCloudScript(ctx, name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+			continue
+		}
+		updated[name] = script.SHA256
+		switch previous := pins[name]; {
+		case previous == "":
+			fmt.Printf("%s: pinned %s\n", name, script.SHA256)
+		case previous != script.SHA256:
+			fmt.Printf("%s: CHANGED %s -> %s\n", name, previous, script.SHA256)
+		default:
+			fmt.Printf("%s: unchanged\n", name)
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d script(s) could not be fetched; %s was not changed\n", failed, pinsFile)
+		return 1
+	}
+	if err := rtr.WriteScriptPins(pinsFile, updated); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Wrote %d pin(s) to %s; review the changes before committing them.\n", len(updated), pinsFile)
+	return 0
+}
+
+// scriptSidecar is the metadata a script can carry in a <name>.yaml file
+// next to it.
+type scriptSidecar struct {
+	Description    string `yaml:"description"`
+	Platform       string `yaml:"platform"`
+	PermissionType string `yaml:"permission_type"`
+}
+
+// syncReport is the machine-readable result of "scripts sync".
+type syncReport struct {
+	Dir     string             `json:"dir"`
+	DryRun  bool               `json:"dry_run"`
+	Prune   bool               `json:"prune"`
+	Changes []rtr.ScriptChange `json:"changes"`
+	Created int                `json:"created"`
+	Updated int                `json:"updated"`
+	Deleted int                `json:"deleted"`
+	Failed  int                `json:"failed"`
+}
+
+// runScriptSync implements "scripts sync", which brings the cloud scripts in
+// line with the scripts in a local directory: scripts missing from the cloud
+// are created, those whose content or sidecar metadata differs are updated,
+// and with --prune cloud scripts without a local file are deleted. --dry-run
+// only reports the plan. The result can be written as JSON with --report.
+// It exits 0 on success, 1 when any change failed and 2 on usage errors.
+func runScriptSync(args []string) int {
+	flags := config.Flags{}
+	flagSet := flag.NewFlagSet("scripts sync", flag.ContinueOnError)
+	registerConfigFlags(flagSet, &flags)
+	dir := flagSet.String("dir", "", "Local directory of scripts to sync")
+	prune := flagSet.Bool("prune", false, "Delete cloud scripts that have no file in --dir")
+	dryRun := flagSet.Bool("dry-run", false, "Report the planned creates, updates and deletes without changing anything")
+	format := flagSet.String("format", "text", "Output format: text or json")
+	reportPath := flagSet.String("report", "", "Also write the JSON result to this file, for CI")
+	if err := flagSet.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "scripts sync: --dir is required")
+		return 2
+	}
+	local, err := readLocalScripts(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scripts sync: %v\n", err)
+		return 2
+	}
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return 2
+	}
+	if cfg.MinimalPermissions && !*dryRun {
+		fmt.Fprintln(os.Stderr, "scripts sync: changing cloud scripts needs Real time response (admin): Write, which minimal_permissions never uses")
+		return 2
+	}
+	rtrClient, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return 2
+	}
+	ctx := context.Background()
+	if err := rtrClient.Authenticate(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to authenticate: %v\n", err)
+		return 1
+	}
+	cloud, err := rtrClient.ListCloudScripts(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	report := syncReport{Dir: *dir, DryRun: *dryRun, Prune: *prune, Changes: rtr.PlanScriptSync(local, cloud, *prune)}
+	if !*dryRun {
+		report.Failed = rtrClient.ApplyScriptSync(ctx, report.Changes)
+	}
+	for _, change := range report.Changes {
+		if change.Error != "" {
+			continue
+		}
+		switch change.Action {
+		case rtr.SyncCreate:
+			report.Created++
+		case rtr.SyncUpdate:
+			report.Updated++
+		case rtr.SyncDelete:
+			report.Deleted++
+		}
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	if *reportPath != "" {
+		if err := os.WriteFile(*reportPath, append(out, '\n'), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write sync report: %v\n", err)
+			report.Failed++
+		}
+	}
+	switch *format {
+	case "json":
+		fmt.Println(string(out))
+	default:
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "ACTION\tSCRIPT\tSTATUS\tDETAIL")
+		for _, change := range report.Changes {
+			status, detail := "done", strings.Join(change.Changed, ", ")
+			switch {
+			case *dryRun:
+				status = "planned"
+			case change.Error != "":
+				status, detail = "FAILED", change.Error
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", change.Action, change.Name, status, detail)
+		}
+		writer.Flush()
+		verb := "Synced"
+		if *dryRun {
+			verb = "Dry run, would sync"
+		}
+		fmt.Printf("\n%s %s: %d created, %d updated, %d deleted, %d failed.\n", verb, *dir, report.Created, report.Updated, report.Deleted, report.Failed)
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readLocalScripts reads the scripts in dir. Every regular file is a script
+// named after the file, except dotfiles and the .yaml sidecars that carry a
+// script's metadata.
+func readLocalScripts(dir string) ([]rtr.ScriptSpec, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var scripts []rtr.ScriptSpec
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".yaml") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		spec := rtr.ScriptSpec{Name: name, Content: string(content)}
+		if err := readSidecar(filepath.Join(dir, name+".yaml"), &spec); err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, spec)
+	}
+	return scripts, nil
+}
+
+// readSidecar fills the metadata of spec from the sidecar at path, if any.
+func readSidecar(path string, spec *rtr.ScriptSpec) error {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var sidecar scriptSidecar
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&sidecar); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	switch sidecar.Platform {
+	case "", "windows", "linux", "mac":
+	default:
+		return fmt.Errorf("%s: platform must be windows, linux or mac, got %q", path, sidecar.Platform)
+	}
+	switch sidecar.PermissionType {
+	case "", "private", "group", "public":
+	default:
+		return fmt.Errorf("%s: permission_type must be private, group or public, got %q", path, sidecar.PermissionType)
+	}
+	spec.Description, spec.Platform, spec.PermissionType = sidecar.Description, sidecar.Platform, sidecar.PermissionType
+	return nil
+}
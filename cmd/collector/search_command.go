@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/compression"
+)
+
+// excerptContext is how many characters around a match the excerpt keeps.
+const excerptContext = 40
+
+// searchMatch is one result record matching a search.
+type searchMatch struct {
+	RunID    string `json:"run_id,omitempty"`
+	DeviceID string `json:"device_id"`
+	Field    string `json:"field"`
+	Excerpt  string `json:"excerpt"`
+}
+
+// runSearchCommand implements "search", which scans a results file written by
+// the "file" sink for hosts whose output matches a substring, a regular
+// expression or a field path. Records are decoded one at a time, so files
+// larger than memory can be searched. It exits 0 when something matched, 1
+// when nothing did and 2 on errors.
+func runSearchCommand(args []string) int {
+	flagSet := flag.NewFlagSet("search", flag.ContinueOnError)
+	resultsPath := flagSet.String("results", "", "Results file (JSON lines) written by a \"file\" sink; .zst and .gz files are decompressed")
+	contains := flagSet.String("contains", "", "Match records whose output contains this substring")
+	pattern := flagSet.String("regex", "", "Match records whose output matches this regular expression")
+	field := flagSet.String("field", "", "Search this field path (e.g. raw.resources.0.stdout) instead of stdout/stderr; alone, matches records where it is set")
+	runID := flagSet.String("run-id", "", "Only search records from this run")
+	deviceList := flagSet.String("device-list", "", "Write the matching device IDs, one per line, to this file")
+	format := flagSet.String("format", "text", "Output format: text or json")
+	if err := flagSet.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+
+	if *resultsPath == "" {
+		fmt.Fprintln(os.Stderr, "Usage: search --results <file> [--contains <text> | --regex <pattern>] [--field <path>]")
+		return 2
+	}
+	if *contains != "" && *pattern != "" {
+		fmt.Fprintln(os.Stderr, "search: --contains and --regex are mutually exclusive")
+		return 2
+	}
+	if *contains == "" && *pattern == "" && *field == "" {
+		fmt.Fprintln(os.Stderr, "search: one of --contains, --regex or --field is required")
+		return 2
+	}
+
+	var matcher func(string) (int, int, bool)
+	switch {
+	case *contains != "":
+		matcher = func(text string) (int, int, bool) {
+			i := strings.Index(text, *contains)
+			return i, i + len(*contains), i >= 0
+		}
+	case *pattern != "":
+		re, err := regexp.Compile(*pattern)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "search: invalid --regex: %v\n", err)
+			return 2
+		}
+		matcher = func(text string) (int, int, bool) {
+			loc := re.FindStringIndex(text)
+			if loc == nil {
+				return 0, 0, false
+			}
+			return loc[0], loc[1], true
+		}
+	default:
+		matcher = func(text string) (int, int, bool) { return 0, len(text), true }
+	}
+
+	// A compressed results file, such as results.jsonl.zst, is read
+	// decompressed.
+	file, err := compression.Open(*resultsPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "search: %v\n", err)
+		return 2
+	}
+	defer file.Close()
+
+	matches, err := searchResults(file, *runID, *field, matcher)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "search: %s: %v\n", *resultsPath, err)
+		return 2
+	}
+
+	if *deviceList != "" {
+		if err := writeDeviceList(*deviceList, matches); err != nil {
+			fmt.Fprintf(os.Stderr, "search: %v\n", err)
+			return 2
+		}
+	}
+
+	switch *format {
+	case "json":
+		out, _ := json.MarshalIndent(matches, "", "  ")
+		fmt.Println(string(out))
+	default:
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "RUN ID\tDEVICE ID\tFIELD\tEXCERPT")
+		for _, match := range matches {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", match.RunID, match.DeviceID, match.Field, match.Excerpt)
+		}
+		writer.Flush()
+		fmt.Printf("\n%d matching record(s).\n", len(matches))
+	}
+
+	if len(matches) == 0 {
+		return 1
+	}
+	return 0
+}
+
+// searchResults decodes JSON-line records from r one at a time and returns
+// those whose searched fields satisfy matcher.
+func searchResults(r io.Reader, runID, fieldPath string, matcher func(string) (int, int, bool)) ([]searchMatch, error) {
+	matches := []searchMatch{}
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	for record := 1; ; record++ {
+		var result map[string]interface{}
+		if err := decoder.Decode(&result); errors.Is(err, io.EOF) {
+			return matches, nil
+		} else if err != nil {
+			return matches, fmt.Errorf("record %d: %w", record, err)
+		}
+
+		recordRunID, _ := result["run_id"].(string)
+		if runID != "" && recordRunID != runID {
+			continue
+		}
+		deviceID, _ := result["device_id"].(string)
+
+		fields := []string{"stdout", "stderr"}
+		if fieldPath != "" {
+			fields = []string{fieldPath}
+		}
+		for _, name := range fields {
+			value, ok := lookupPath(result, name)
+			if !ok {
+				continue
+			}
+			text := valueText(value)
+			if start, end, ok := matcher(text); ok {
+				matches = append(matches, searchMatch{
+					RunID:    recordRunID,
+					DeviceID: deviceID,
+					Field:    name,
+					Excerpt:  excerpt(text, start, end),
+				})
+				break
+			}
+		}
+	}
+}
+
+// lookupPath resolves a dot-separated path such as "raw.resources.0.stdout"
+// in a decoded JSON value. A leading "$." is accepted and numeric segments
+// index into arrays.
+func lookupPath(value interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return value, true
+	}
+	for _, segment := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			next, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			value = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, value != nil
+}
+
+// valueText renders a decoded JSON value for matching: strings as is,
+// everything else as compact JSON.
+func valueText(value interface{}) string {
+	if text, ok := value.(string); ok {
+		return text
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// excerpt returns the match with some surrounding context on one line.
+func excerpt(text string, start, end int) string {
+	from := max(0, start-excerptContext)
+	to := min(len(text), end+excerptContext)
+	snippet := strings.Join(strings.Fields(text[from:to]), " ")
+	if from > 0 {
+		snippet = "..." + snippet
+	}
+	if to < len(text) {
+		snippet += "..."
+	}
+	return snippet
+}
+
+// writeDeviceList writes the unique device IDs of matches, one per line.
+func writeDeviceList(path string, matches []searchMatch) error {
+	var list strings.Builder
+	seen := make(map[string]bool)
+	for _, match := range matches {
+		if match.DeviceID == "" || seen[match.DeviceID] {
+			continue
+		}
+		seen[match.DeviceID] = true
+		list.WriteString(match.DeviceID + "\n")
+	}
+	if err := os.WriteFile(path, []byte(list.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write device list: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	rtr "github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+
+	"gopkg.in/yaml.v3"
+)
+
+// traceIDPattern finds the trace IDs CrowdStrike puts in the meta of every
+// response, including error bodies quoted, and escaped, in JSON strings.
+var traceIDPattern = regexp.MustCompile(`\\?"trace_id\\?"\s*:\s*\\?"([^"\\]+)`)
+
+// supportItem is one file of a support bundle.
+type supportItem struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Size        int    `json:"size"`
+	SHA256      string `json:"sha256"`
+	data        []byte
+}
+
+// supportManifest is manifest.json of a support bundle.
+type supportManifest struct {
+	CreatedAt        time.Time      `json:"created_at"`
+	CollectorVersion string         `json:"collector_version"`
+	Redactions       map[string]int `json:"redactions,omitempty"` // Replacements made per redaction rule
+	Files            []supportItem  `json:"files"`
+}
+
+// traceRecord is one API error trace ID and where it was found.
+type traceRecord struct {
+	TraceID string `json:"trace_id"`
+	Source  string `json:"source"`
+	Context string `json:"context"`
+}
+
+// runSupportBundleCommand implements "support-bundle", which gathers what
+// is needed to troubleshoot the collector into one zip: the masked resolved
+// config, the environment, a healthcheck, the last run outcome and report,
+// the tail of a log file and the trace IDs of recent API errors. Every file
+// passes through the redaction rules. The contents are listed and confirmed
+// before the zip is written, unless --yes is given. It exits 0 when the
+// bundle was written, 1 when it was declined or could not be written and 2
+// on usage errors.
+func runSupportBundleCommand(args []string) int {
+	flags := config.Flags{}
+	flagSet := flag.NewFlagSet("support-bundle", flag.ContinueOnError)
+	registerConfigFlags(flagSet, &flags)
+	out := flagSet.String("out", "", "Bundle to write (default: support-bundle-<timestamp>.zip)")
+	outcomePath := flagSet.String("outcome-file", "", "Run-outcome file of the last run (default: $COLLECTOR_OUTCOME_FILE or "+defaultOutcomePath+")")
+	logPath := flagSet.String("log-file", "", "Log of a collector run, e.g. its redirected output, to include the tail of (default: $COLLECTOR_LOG_FILE)")
+	logLines := flagSet.Int("log-lines", 500, "How many lines of --log-file to include")
+	timeout := flagSet.Duration("timeout", 30*time.Second, "Upper bound for the connectivity check")
+	skipHealthcheck := flagSet.Bool("skip-healthcheck", false, "Do not contact the API for the connectivity check")
+	yes := flagSet.Bool("yes", false, "Write the bundle without listing its contents for confirmation")
+	if err := flagSet.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+
+	if *logLines < 0 {
+		fmt.Fprintln(os.Stderr, "support-bundle: --log-lines must not be negative")
+		return 2
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("support-bundle-%s.zip", time.Now().UTC().Format("20060102T150405Z"))
+	}
+	if *logPath == "" {
+		*logPath = os.Getenv("COLLECTOR_LOG_FILE")
+	}
+	if *outcomePath == "" {
+		*outcomePath = os.Getenv("COLLECTOR_OUTCOME_FILE")
+	}
+	if *outcomePath == "" {
+		*outcomePath = defaultOutcomePath
+	}
+
+	var items []supportItem
+	add := func(name, description string, data []byte) {
+		items = append(items, supportItem{Name: name, Description: description, data: data})
+	}
+	var traces []traceRecord
+	findTraces := func(source, text string) {
+		for _, line := range strings.Split(text, "\n") {
+			for _, match := range traceIDPattern.FindAllStringSubmatch(line, -1) {
+				traces = append(traces, traceRecord{TraceID: match[1], Source: source, Context: strings.TrimSpace(line)})
+			}
+		}
+	}
+
+	// The redactor also conceals the configured secrets wherever they appear.
+	cfg, cfgErr := loadConfig(flags)
+	rulesFile := ""
+	if cfgErr == nil {
+		rulesFile = cfg.Redaction.RulesFile
+	}
+	redactor, err := rtr.NewRedactor(rulesFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return 2
+	}
+	if cfgErr == nil {
+		for _, secret := range []string{cfg.ClientSecret, cfg.SMTP.Password, cfg.Approval.TokenSecret} {
+			redactor.AddSecret("config_secret", secret)
+		}
+		for _, profile := range cfg.Profiles {
+			redactor.AddSecret("config_secret", profile.ClientSecret)
+		}
+		masked, err := yaml.Marshal(cfg.Masked())
+		if err != nil {
+			masked = []byte(fmt.Sprintf("failed to render configuration: %v\n", err))
+		}
+		add("config.yaml", "Resolved configuration, secrets masked", masked)
+	} else {
+		add("config-error.txt", "Why the configuration did not load", []byte(cfgErr.Error()+"\n"))
+	}
+
+	environment, _ := json.MarshalIndent(map[string]string{
+		"collector_version": version,
+		"go_version":        runtime.Version(),
+		"os":                runtime.GOOS,
+		"arch":              runtime.GOARCH,
+		"args":              strings.Join(os.Args[1:], " "),
+	}, "", "  ")
+	add("environment.json", "Collector, Go and OS versions", append(environment, '\n'))
+
+	if cfgErr == nil && !*skipHealthcheck {
+		if rtrClient, err := newClient(cfg); err != nil {
+			add("healthcheck.txt", "Why the connectivity check could not run", []byte(err.Error()+"\n"))
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+			report := rtrClient.HealthCheck(ctx)
+			cancel()
+			data, _ := json.MarshalIndent(report, "", "  ")
+			add("healthcheck.json", "Connectivity check: DNS, TLS, authentication and API access", append(data, '\n'))
+			for _, check := range report.Checks {
+				findTraces("healthcheck "+check.Name, check.Detail)
+			}
+		}
+	}
+
+	if data, err := os.ReadFile(*outcomePath); err == nil {
+		add("run-outcome.json", "Outcome file of the last run ("+*outcomePath+")", data)
+		findTraces(*outcomePath, string(data))
+		var outcome runOutcome
+		if json.Unmarshal(data, &outcome) == nil && *logPath == "" {
+			*logPath = outcome.LogFile
+		}
+		switch {
+		case outcome.ReportPath != "":
+			if report, err := os.ReadFile(outcome.ReportPath); err == nil {
+				add("run-report.json", "Status report of the last run ("+outcome.ReportPath+")", report)
+				findTraces(outcome.ReportPath, string(report))
+			} else {
+				fmt.Fprintf(os.Stderr, "Warning: no run report included: %v\n", err)
+			}
+		case outcome.RunID != "":
+			fmt.Fprintf(os.Stderr, "Warning: no run report included: %s names no report_path\n", *outcomePath)
+		}
+	} else if !strings.HasPrefix(*outcomePath, "fd:") {
+		fmt.Fprintf(os.Stderr, "Warning: no run outcome included: %v\n", err)
+	}
+
+	if *logPath != "" {
+		tail, err := tailLines(*logPath, *logLines)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "support-bundle: %v\n", err)
+			return 2
+		}
+		add("log.txt", fmt.Sprintf("Last %d lines of %s", *logLines, *logPath), []byte(tail))
+		add("log-files.txt", "Active log file and its rotated files", []byte(listLogFiles(*logPath)))
+		findTraces(*logPath, tail)
+	}
+
+	if len(traces) > 0 {
+		data, _ := json.MarshalIndent(traces, "", "  ")
+		add("api-errors.json", "Trace IDs of recent API errors, for CrowdStrike support", append(data, '\n'))
+	}
+
+	manifest := supportManifest{CreatedAt: time.Now().UTC(), CollectorVersion: version, Redactions: map[string]int{}}
+	for i := range items {
+		redacted, counts := redactor.Redact(string(items[i].data))
+		for name, n := range counts {
+			manifest.Redactions[name] += n
+		}
+		items[i].data = []byte(redacted)
+		sum := sha256.Sum256(items[i].data)
+		items[i].Size, items[i].SHA256 = len(items[i].data), hex.EncodeToString(sum[:])
+	}
+	manifest.Files = items
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "FILE\tBYTES\tCONTENTS")
+	for _, item := range items {
+		fmt.Fprintf(writer, "%s\t%d\t%s\n", item.Name, item.Size, item.Description)
+	}
+	writer.Flush()
+	if len(manifest.Redactions) > 0 {
+		fmt.Printf("Redacted: %s\n", formatCounts(manifest.Redactions))
+	}
+	if !*yes {
+		if !interactive(os.Stdin) {
+			fmt.Fprintln(os.Stderr, "support-bundle: stdin is not a terminal; review the listing and pass --yes to write the bundle")
+			return 1
+		}
+		fmt.Printf("Write these files to %s? [y/N] ", *out)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			fmt.Println("Support bundle not written.")
+			return 1
+		}
+	}
+
+	if err := writeSupportBundle(*out, manifest); err != nil {
+		fmt.Fprintf(os.Stderr, "support-bundle: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote support bundle %s (%d files).\n", *out, len(items)+1)
+	return 0
+}
+
+// writeSupportBundle writes the manifest and its files as a zip. Like the
+// evidence export, it writes next to path and renames, so a failure leaves
+// no partial bundle.
+func writeSupportBundle(path string, manifest supportManifest) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	archive := zip.NewWriter(file)
+	data, _ := json.MarshalIndent(manifest, "", "  ")
+	members := append([]supportItem{{Name: "manifest.json", data: append(data, '\n')}}, manifest.Files...)
+	for _, member := range members {
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: member.Name, Method: zip.Deflate, Modified: manifest.CreatedAt})
+		if err == nil {
+			_, err = entry.Write(member.data)
+		}
+		if err != nil {
+			file.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	err = archive.Close()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// tailLines returns the last n lines of the file at path.
+func tailLines(path string, n int) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	lines := make([]string, 0, n)
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" && n > 0 {
+			if len(lines) == n {
+				lines = lines[1:]
+			}
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(lines, ""), nil
+}
+
+// formatCounts renders counts as "name=n, ..." in name order.
+func formatCounts(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%d", name, counts[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// listLogFiles lists the active log file at path and the files rotated
+// from it, path.N and path.N.gz, with their sizes and modification times.
+func listLogFiles(path string) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "active: %s\n", path)
+	rotated, _ := filepath.Glob(path + ".[0-9]*")
+	for _, name := range append([]string{path}, rotated...) {
+		if info, err := os.Stat(name); err == nil {
+			fmt.Fprintf(&out, "%s\t%d bytes\t%s\n", name, info.Size(), info.ModTime().UTC().Format(time.RFC3339))
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/naming"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/runid"
+)
+
+// tenantStopDelay is how long a tenant run may clean up after an interrupt
+// before it is killed.
+const tenantStopDelay = time.Minute
+
+// tenant is one tenant of a multi-tenant sweep: a configured profile, or an
+// MSSP child CID reached with the parent credentials.
+type tenant struct {
+	Name      string `json:"name"`
+	Profile   string `json:"profile,omitempty"`
+	MemberCID string `json:"member_cid,omitempty"`
+	CID       string `json:"cid,omitempty"`
+	Dir       string `json:"dir,omitempty"` // Output directory of the tenant's run
+}
+
+// tenantRun is the outcome of the collection in one tenant, taken from the
+// run-outcome file its run wrote.
+type tenantRun struct {
+	tenant
+	Status         string `json:"status"`
+	ExitCode       int    `json:"exit_code"`
+	HostsTotal     int    `json:"hosts_total"`
+	HostsSucceeded int    `json:"hosts_succeeded"`
+	HostsFailed    int    `json:"hosts_failed"`
+	HostsSkipped   int    `json:"hosts_skipped"`
+	HostsWarned    int    `json:"hosts_warned,omitempty"`
+	Error          string `json:"error,omitempty"`
+	DurationMS     int64  `json:"duration_ms"`
+}
+
+// tenantRollup summarizes a sweep across tenants.
+type tenantRollup struct {
+	RunID            string      `json:"run_id"`
+	Status           string      `json:"status"`
+	ExitCode         int         `json:"exit_code"`
+	TenantsTotal     int         `json:"tenants_total"`
+	TenantsSucceeded int         `json:"tenants_succeeded"`
+	TenantsFailed    int         `json:"tenants_failed"`
+	HostsTotal       int         `json:"hosts_total"`
+	HostsSucceeded   int         `json:"hosts_succeeded"`
+	HostsFailed      int         `json:"hosts_failed"`
+	HostsSkipped     int         `json:"hosts_skipped"`
+	HostsWarned      int         `json:"hosts_warned"`
+	Tenants          []tenantRun `json:"tenants"`
+	StartedAt        time.Time   `json:"started_at"`
+	FinishedAt       time.Time   `json:"finished_at"`
+}
+
+// runTenantsCommand implements "tenants run", which runs the same collection
+// in several tenants: the named profiles (every profile with credentials by
+// default), or with --children every MSSP child CID of the configured
+// credentials. Each tenant runs as its own collector process, with its own
+// token and call budget, writing under <output-dir>/<CID>. A tenant that
+// fails, even to authenticate, does not stop the others. The exit code
+// follows the run exit codes, counting tenants instead of hosts.
+func runTenantsCommand(args []string) int {
+	if len(args) == 0 || args[0] != "run" {
+		fmt.Fprintln(os.Stderr, "Usage: crowdstrike-data-collector tenants run [--profiles a,b | --children] [--concurrency n] [--output-dir dir] [config flags]")
+		return 2
+	}
+
+	flags := config.Flags{}
+	flagSet := flag.NewFlagSet("tenants run", flag.ContinueOnError)
+	registerConfigFlags(flagSet, &flags)
+	flagSet.StringVar(&flags.RunID, "run-id", "", "Run ID shared by every tenant's run (default: a generated UUIDv7)")
+	profiles := flagSet.String("profiles", "", "Comma-separated profiles to run in (default: every profile with credentials)")
+	children := flagSet.Bool("children", false, "Run in every MSSP child CID of the configured credentials")
+	concurrency := flagSet.Int("concurrency", 4, "How many tenants run at once")
+	flagSet.BoolVar(&flags.ForceDestructive, "force-destructive", false, "Run destructive_commands in every tenant; tenant runs cannot prompt for confirmation")
+	flagSet.BoolVar(&flags.IncludeQuarantined, "include-quarantined", false, "Attempt devices the circuit breaker quarantined in earlier runs")
+	if err := flagSet.Parse(args[1:]); err != nil {
+		return parseExitCode(err)
+	}
+
+	// --output-dir holds one output directory per tenant CID and the rollup.
+	outputDir := flags.OutputDir
+	if outputDir == "" {
+		outputDir = "tenants"
+	}
+
+	if *children && *profiles != "" {
+		fmt.Fprintln(os.Stderr, "tenants run: --profiles and --children cannot be combined")
+		return 2
+	}
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "tenants run: --concurrency must be at least 1")
+		return 2
+	}
+	if flags.RunID == "" {
+		flags.RunID = runid.New()
+	} else if err := runid.Validate(flags.RunID); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration Error: %v\n", err)
+		return exitConfigError
+	}
+	if flags.ConfigPath != "" {
+		// Tenant runs are passed the path; keep it valid whatever their directory.
+		if abs, err := filepath.Abs(flags.ConfigPath); err == nil {
+			flags.ConfigPath = abs
+		}
+	}
+	fmt.Printf("Run ID: %s\n", flags.RunID)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rollup := &tenantRollup{RunID: flags.RunID, StartedAt: time.Now().UTC()}
+	var tenants []tenant
+	var err error
+	if *children {
+		tenants, err = childTenants(ctx, flags)
+	} else {
+		tenants, rollup.Tenants, err = profileTenants(ctx, flags, *profiles)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitConfigError
+	}
+	if len(tenants)+len(rollup.Tenants) == 0 {
+		fmt.Fprintln(os.Stderr, "tenants run: no tenants to run in")
+		return exitConfigError
+	}
+	assignTenantDirs(tenants, outputDir)
+	fmt.Printf("Running in %d tenant(s), %d at a time, output under %s\n", len(tenants), *concurrency, outputDir)
+
+	runs := make([]tenantRun, len(tenants))
+	sem := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+	for i, t := range tenants {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+			}
+			runs[i] = runTenant(ctx, flags, t)
+		}()
+	}
+	wg.Wait()
+	rollup.Tenants = append(rollup.Tenants, runs...)
+
+	summarizeTenants(rollup)
+	rollup.FinishedAt = time.Now().UTC()
+	printRollup(rollup)
+	if err := writeRollup(filepath.Join(outputDir, "rollup.json"), rollup); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write rollup: %v\n", err)
+	}
+	return rollup.ExitCode
+}
+
+// profileTenants lists the tenants of the named profiles, or of every
+// profile with credentials, and resolves the CID of each. A profile that
+// cannot authenticate is returned as a failed run instead.
+func profileTenants(ctx context.Context, flags config.Flags, list string) ([]tenant, []tenantRun, error) {
+	cfg, err := loadConfigFile(flags.ConfigPath, flags.AllowUnknown)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Configuration Error: %v", err)
+	}
+	var names []string
+	if list != "" {
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	} else {
+		for _, name := range cfg.ProfileNames() {
+			if cfg.Profiles[name].HasCredentials() {
+				names = append(names, name)
+			}
+		}
+	}
+
+	var tenants []tenant
+	var failed []tenantRun
+	for _, name := range names {
+		t := tenant{Name: name, Profile: name}
+		tenantFlags := flags
+		tenantFlags.Profile = name
+		cid, err := resolveTenantCID(ctx, tenantFlags)
+		if err != nil {
+			fmt.Printf("[%s] %v\n", name, err)
+			failed = append(failed, tenantRun{tenant: t, Status: outcomeStatuses[exitConfigError], ExitCode: exitConfigError, Error: err.Error()})
+			continue
+		}
+		t.CID = cid
+		tenants = append(tenants, t)
+	}
+	return tenants, failed, nil
+}
+
+// resolveTenantCID authenticates with the tenant's configuration and returns
+// the CID its credentials belong to.
+func resolveTenantCID(ctx context.Context, flags config.Flags) (string, error) {
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		return "", fmt.Errorf("Configuration Error: %v", err)
+	}
+	rtrClient, err := newClient(cfg)
+	if err != nil {
+		return "", fmt.Errorf("Configuration Error: %v", err)
+	}
+	if err := rtrClient.Authenticate(ctx); err != nil {
+		return "", fmt.Errorf("Failed to authenticate: %v", err)
+	}
+	return rtrClient.GetCurrentCID(ctx)
+}
+
+// childTenants lists the MSSP child CIDs of the configured credentials.
+func childTenants(ctx context.Context, flags config.Flags) ([]tenant, error) {
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		return nil, fmt.Errorf("Configuration Error: %v", err)
+	}
+	rtrClient, err := newClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Configuration Error: %v", err)
+	}
+	if err := rtrClient.Authenticate(ctx); err != nil {
+		return nil, fmt.Errorf("Failed to authenticate as the parent tenant: %v", err)
+	}
+	children, err := rtrClient.ListChildCIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tenants := make([]tenant, len(children))
+	for i, child := range children {
+		name := child.Name
+		if name == "" {
+			name = child.CID
+		}
+		tenants[i] = tenant{Name: name, Profile: flags.Profile, MemberCID: child.CID, CID: child.CID}
+	}
+	return tenants, nil
+}
+
+// assignTenantDirs gives each tenant the output directory <root>/<CID>. A
+// CID shared by several tenants also gets the tenant name, so no two
+// tenants write to the same directory.
+func assignTenantDirs(tenants []tenant, root string) {
+	count := map[string]int{}
+	for _, t := range tenants {
+		count[t.CID]++
+	}
+	for i, t := range tenants {
+		dir := t.CID
+		if count[t.CID] > 1 {
+			dir += "-" + naming.PortableElement(strings.ReplaceAll(naming.Sanitize(t.Name), "/", "_"))
+		}
+		tenants[i].Dir = filepath.Join(root, dir)
+	}
+}
+
+// runTenant runs the collection in one tenant as a child collector process
+// and reads back its run outcome. Its output is prefixed with the tenant
+// name. An interrupt is passed on so the run can delete its sessions.
+func runTenant(ctx context.Context, flags config.Flags, t tenant) tenantRun {
+	run := tenantRun{tenant: t}
+	if ctx.Err() != nil {
+		run.Status, run.ExitCode, run.Error = outcomeStatuses[exitInterrupted], exitInterrupted, "not started: interrupted"
+		return run
+	}
+	start := time.Now()
+	defer func() { run.DurationMS = time.Since(start).Milliseconds() }()
+
+	outcomePath := filepath.Join(t.Dir, defaultOutcomePath)
+	fail := func(err error) tenantRun {
+		fmt.Printf("[%s] %v\n", t.Name, err)
+		run.Status, run.ExitCode, run.Error = outcomeStatuses[exitAllFailed], exitAllFailed, err.Error()
+		return run
+	}
+	if err := os.MkdirAll(t.Dir, 0700); err != nil {
+		return fail(fmt.Errorf("failed to create %s: %w", t.Dir, err))
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fail(fmt.Errorf("cannot find the collector executable: %w", err))
+	}
+
+	tenantFlags := flags
+	tenantFlags.Profile, tenantFlags.MemberCID, tenantFlags.OutputDir = t.Profile, t.MemberCID, t.Dir
+	args := append(configArgs(tenantFlags), "--run-id", flags.RunID, "--outcome-file", outcomePath)
+	cmd := exec.CommandContext(ctx, executable, args...)
+	cmd.Stdout = newPrefixWriter(os.Stdout, t.Name)
+	cmd.Stderr = newPrefixWriter(os.Stderr, t.Name)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = tenantStopDelay
+	fmt.Printf("[%s] Starting run in CID %s\n", t.Name, t.CID)
+	cmd.Run()
+	cmd.Stdout.(*prefixWriter).Flush()
+	cmd.Stderr.(*prefixWriter).Flush()
+
+	data, err := os.ReadFile(outcomePath)
+	if err != nil {
+		return fail(fmt.Errorf("run ended without an outcome: %v", err))
+	}
+	var outcome runOutcome
+	if err := json.Unmarshal(data, &outcome); err != nil {
+		return fail(fmt.Errorf("invalid run outcome %s: %v", outcomePath, err))
+	}
+	run.Status, run.ExitCode, run.Error = outcome.Status, outcome.ExitCode, outcome.Error
+	run.HostsTotal, run.HostsSucceeded = outcome.HostsTotal, outcome.HostsSucceeded
+	run.HostsFailed, run.HostsSkipped = outcome.HostsFailed, outcome.HostsSkipped
+	run.HostsWarned = outcome.HostsWarned
+	return run
+}
+
+// configArgs turns config flags back into command-line arguments.
+func configArgs(flags config.Flags) []string {
+	var args []string
+	for _, flag := range []struct{ name, value string }{
+		{"--config", flags.ConfigPath},
+		{"--profile", flags.Profile},
+		{"--device-id", flags.DeviceID},
+		{"--script", flags.ScriptName},
+		{"--base-url", flags.BaseURL},
+		{"--hostname", flags.TargetHostname},
+		{"--match", flags.TargetMatch},
+		{"--filter", flags.TargetFilter},
+		{"--serial", flags.TargetSerials},
+		{"--mac", flags.TargetMACs},
+		{"--identifiers-file", flags.TargetIdentifiers},
+		{"--member-cid", flags.MemberCID},
+		{"--output-dir", flags.OutputDir},
+		{"--case-id", flags.CaseID},
+		{"--operator", flags.Operator},
+		{"--reason", flags.Reason},
+		{"--ticket-url", flags.TicketURL},
+	} {
+		if flag.value != "" {
+			args = append(args, flag.name, flag.value)
+		}
+	}
+	if flags.TargetCaseSensitive {
+		args = append(args, "--case-sensitive")
+	}
+	if flags.AllowUnknown {
+		args = append(args, "--allow-unknown")
+	}
+	if flags.ForceDestructive {
+		args = append(args, "--force-destructive")
+	}
+	if flags.IncludeQuarantined {
+		args = append(args, "--include-quarantined")
+	}
+	return args
+}
+
+// summarizeTenants totals the tenant runs and sets the rollup status: every
+// tenant succeeded, some failed, or all failed. An interrupted tenant
+// interrupts the sweep.
+func summarizeTenants(rollup *tenantRollup) {
+	interrupted := false
+	for _, run := range rollup.Tenants {
+		rollup.TenantsTotal++
+		if run.ExitCode == exitSucceeded {
+			rollup.TenantsSucceeded++
+		} else {
+			rollup.TenantsFailed++
+		}
+		interrupted = interrupted || run.ExitCode == exitInterrupted
+		rollup.HostsTotal += run.HostsTotal
+		rollup.HostsSucceeded += run.HostsSucceeded
+		rollup.HostsFailed += run.HostsFailed
+		rollup.HostsSkipped += run.HostsSkipped
+		rollup.HostsWarned += run.HostsWarned
+	}
+	switch {
+	case interrupted:
+		rollup.ExitCode = exitInterrupted
+	case rollup.TenantsFailed == 0:
+		rollup.ExitCode = exitSucceeded
+	case rollup.TenantsSucceeded > 0:
+		rollup.ExitCode = exitPartialFailure
+	default:
+		rollup.ExitCode = exitAllFailed
+	}
+	rollup.Status = outcomeStatuses[rollup.ExitCode]
+}
+
+// printRollup prints one line per tenant and the totals.
+func printRollup(rollup *tenantRollup) {
+	fmt.Println("\n--- Tenant Rollup ---")
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "TENANT\tCID\tSTATUS\tHOSTS OK/FAILED/SKIPPED\tERROR")
+	for _, run := range rollup.Tenants {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%d/%d/%d\t%s\n", run.Name, run.CID, run.Status, run.HostsSucceeded, run.HostsFailed, run.HostsSkipped, run.Error)
+	}
+	writer.Flush()
+	fmt.Printf("Tenants: %d succeeded, %d failed of %d; hosts: %d succeeded, %d failed, %d skipped of %d, %d with warnings\n",
+		rollup.TenantsSucceeded, rollup.TenantsFailed, rollup.TenantsTotal,
+		rollup.HostsSucceeded, rollup.HostsFailed, rollup.HostsSkipped, rollup.HostsTotal, rollup.HostsWarned)
+}
+
+// writeRollup writes the rollup as JSON to path.
+func writeRollup(path string, rollup *tenantRollup) error {
+	data, err := json.MarshalIndent(rollup, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal rollup: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// prefixWriter writes whole lines to out, each prefixed with a tenant name,
+// so the output of concurrent tenant runs can be told apart.
+type prefixWriter struct {
+	out    io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+// prefixMu keeps lines of concurrent tenant runs from interleaving.
+var prefixMu sync.Mutex
+
+func newPrefixWriter(out io.Writer, name string) *prefixWriter {
+	return &prefixWriter{out: out, prefix: []byte("[" + name + "] ")}
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.writeLine(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Flush writes a final line that did not end in a newline.
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	prefixMu.Lock()
+	defer prefixMu.Unlock()
+	w.out.Write(append(append([]byte{}, w.prefix...), line...))
+}
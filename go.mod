@@ -1,5 +1,24 @@
-module crowdstrike-data-collector
+module github.com/omkarj-metron/crowdstrike-data-collector
 
 go 1.22.2
 
-require github.com/joho/godotenv v1.5.1 // indirect
+require github.com/joho/godotenv v1.5.1
+
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/prometheus/common v0.55.0
+	github.com/prometheus/prometheus v0.54.1
+	golang.org/x/term v0.29.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/gogo/protobuf v1.3.2 // indirect
+	github.com/grafana/regexp v0.0.0-20240518133315-a468a5bfb3bc // indirect
+	github.com/kr/pretty v0.3.1 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+)
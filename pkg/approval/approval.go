@@ -0,0 +1,229 @@
+// Package approval gates admin-level RTR runs behind change control. Before
+// any privileged command endpoint is touched, the run's plan is either sent
+// to an approval webhook or checked against an approval token carrying an
+// HMAC over the plan hash.
+package approval
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/console"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// Approval methods recorded on an Approval.
+const (
+	MethodWebhook = "webhook"
+	MethodToken   = "token"
+	MethodExempt  = "exempt"
+)
+
+// ErrRejected is returned when the plan was not approved: the webhook
+// declined it or could not be reached in time, or the token is missing or
+// does not match the plan.
+var ErrRejected = errors.New("approval rejected")
+
+// Command is one command the run intends to issue. Endpoint is the RTR
+// endpoint key, e.g. "admin-command".
+type Command struct {
+	Endpoint      string `json:"endpoint"`
+	BaseCommand   string `json:"base_command"`
+	CommandString string `json:"command_string"`
+}
+
+// Plan describes what a run will do before it does it.
+type Plan struct {
+	RunID     string         `json:"run_id"`
+	DeviceIDs []string       `json:"device_ids"`
+	Commands  []Command      `json:"commands"`
+	Metadata  *sink.Metadata `json:"metadata,omitempty"` // Attribution the run will record; part of the hash
+
+	// Targets traces the device IDs back to the serial numbers and MAC
+	// addresses they were resolved from, when the run targets by identifier.
+	Targets []sink.TargetMapping `json:"targets,omitempty"`
+
+	// Secrets names the secrets revealed for each host and injected into
+	// the commands, e.g. "uninstall_token". The commands show them redacted.
+	Secrets []string `json:"secrets,omitempty"`
+
+	// Concurrency is how many hosts, downloads, sink deliveries and
+	// post-processors the run will have going at once.
+	Concurrency *config.Concurrency `json:"concurrency,omitempty"`
+
+	// Sandbox is set when the run submits retrieved files to Falcon
+	// Intelligence Sandbox, which shares them with the sandbox environment.
+	Sandbox *config.Sandbox `json:"sandbox,omitempty"`
+}
+
+// Hash returns the hex SHA256 of the plan's JSON encoding. Approval tokens
+// are bound to it, so a token issued for one plan cannot approve another.
+func (p *Plan) Hash() string {
+	data, _ := json.Marshal(p)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Privileged reports whether the plan needs approval: any command outside
+// the read-only endpoint does, and read-only ones do too unless exempted.
+func (p *Plan) Privileged(exemptReadOnly bool) bool {
+	for _, command := range p.Commands {
+		if command.Endpoint != "command" || !exemptReadOnly {
+			return true
+		}
+	}
+	return false
+}
+
+// Approval records how a plan was approved. Reference is the change ticket
+// or approval ID stamped into the run's report.
+type Approval struct {
+	Reference  string    `json:"reference,omitempty"`
+	Method     string    `json:"method"`
+	PlanHash   string    `json:"plan_hash"`
+	ApprovedAt time.Time `json:"approved_at"`
+}
+
+// Gate checks plans against the configured approval webhook or token secret.
+type Gate struct {
+	WebhookURL     string
+	TokenSecret    string
+	Token          string // The run's --approval-token
+	Timeout        time.Duration
+	ExemptReadOnly bool
+
+	HTTPClient *http.Client
+	Console    *console.Console // Receives progress; nil prints none
+}
+
+// NewGate returns the gate configured by cfg, or nil when neither a webhook
+// nor a token secret is set.
+func NewGate(cfg config.Approval) *Gate {
+	if cfg.WebhookURL == "" && cfg.TokenSecret == "" {
+		return nil
+	}
+	return &Gate{
+		WebhookURL:     cfg.WebhookURL,
+		TokenSecret:    cfg.TokenSecret,
+		Token:          cfg.Token,
+		Timeout:        time.Duration(cfg.Timeout),
+		ExemptReadOnly: cfg.ExemptReadOnly,
+		HTTPClient:     &http.Client{},
+	}
+}
+
+// Approve approves plan or returns an error wrapping ErrRejected. A token,
+// when given and a token secret is configured, is checked offline; otherwise
+// the webhook is asked. Plans that only use exempt read-only commands pass
+// without either.
+func (g *Gate) Approve(ctx context.Context, plan *Plan) (*Approval, error) {
+	planHash := plan.Hash()
+	if !plan.Privileged(g.ExemptReadOnly) {
+		return &Approval{Method: MethodExempt, PlanHash: planHash, ApprovedAt: time.Now().UTC()}, nil
+	}
+	switch {
+	case g.TokenSecret != "" && g.Token != "":
+		reference, err := VerifyToken(g.TokenSecret, g.Token, planHash)
+		if err != nil {
+			return nil, err
+		}
+		return &Approval{Reference: reference, Method: MethodToken, PlanHash: planHash, ApprovedAt: time.Now().UTC()}, nil
+	case g.WebhookURL != "":
+		return g.askWebhook(ctx, plan, planHash)
+	default:
+		return nil, fmt.Errorf("%w: an approval token for plan %s is required (--approval-token or APPROVAL_TOKEN)", ErrRejected, planHash)
+	}
+}
+
+// webhookRequest is posted to the approval webhook.
+type webhookRequest struct {
+	Plan     *Plan  `json:"plan"`
+	PlanHash string `json:"plan_hash"`
+}
+
+// webhookResponse is the webhook's decision.
+type webhookResponse struct {
+	Approved  bool   `json:"approved"`
+	Reference string `json:"reference"`
+	Reason    string `json:"reason"`
+}
+
+// askWebhook posts the plan and waits up to Timeout for a decision. Anything
+// short of a 2xx answer with approved set counts as a rejection.
+func (g *Gate) askWebhook(ctx context.Context, plan *Plan, planHash string) (*Approval, error) {
+	timeout := g.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(webhookRequest{Plan: plan, PlanHash: planHash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal approval request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", g.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create approval request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	g.Console.Printf("Requesting approval for plan %s from %s...\n", planHash, g.WebhookURL)
+	resp, err := g.HTTPClient.Do(req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w: approval webhook did not answer within %s", ErrRejected, timeout)
+		}
+		return nil, fmt.Errorf("%w: approval webhook request failed: %v", ErrRejected, err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var decision webhookResponse
+	json.Unmarshal(data, &decision)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || !decision.Approved {
+		reason := decision.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("status %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("%w by webhook: %s", ErrRejected, reason)
+	}
+	return &Approval{Reference: decision.Reference, Method: MethodWebhook, PlanHash: planHash, ApprovedAt: time.Now().UTC()}, nil
+}
+
+// Token issues an approval token for planHash under the change reference,
+// as "<reference>.<hex HMAC-SHA256 of reference and plan hash>".
+func Token(secret, reference, planHash string) string {
+	return reference + "." + hex.EncodeToString(tokenMAC(secret, reference, planHash))
+}
+
+// VerifyToken checks token against planHash and returns its reference.
+func VerifyToken(secret, token, planHash string) (string, error) {
+	i := strings.LastIndex(token, ".")
+	if i <= 0 {
+		return "", fmt.Errorf("%w: approval token must have the form <reference>.<hmac>", ErrRejected)
+	}
+	reference := token[:i]
+	mac, err := hex.DecodeString(token[i+1:])
+	if err != nil || !hmac.Equal(mac, tokenMAC(secret, reference, planHash)) {
+		return "", fmt.Errorf("%w: approval token %s does not match plan %s", ErrRejected, reference, planHash)
+	}
+	return reference, nil
+}
+
+func tokenMAC(secret, reference, planHash string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s", reference, planHash)
+	return mac.Sum(nil)
+}
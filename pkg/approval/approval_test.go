@@ -0,0 +1,158 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+func testPlan() *Plan {
+	return &Plan{
+		RunID:     "0190f5c2-7a3b-7c4d-8e5f-6a7b8c9d0e1f",
+		DeviceIDs: []string{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"},
+		Commands:  []Command{{Endpoint: "admin-command", BaseCommand: "runscript", CommandString: `runscript -CloudFile="collect.ps1"`}},
+		Metadata:  &sink.Metadata{CaseID: "IR-1042", Operator: "analyst"},
+	}
+}
+
+// TestPlanHashStable pins the hash of a fixed plan. Issued approval tokens
+// are bound to plan hashes, so a change to the plan's encoding invalidates
+// every outstanding token and must be deliberate.
+func TestPlanHashStable(t *testing.T) {
+	const want = "6cf5a29353e4aa5558504b3d4b4804be883d857f51be4cba518a1fd383ae3894"
+	if got := testPlan().Hash(); got != want {
+		t.Errorf("plan hash %s, want %s", got, want)
+	}
+	if testPlan().Hash() != testPlan().Hash() {
+		t.Error("equal plans hash differently")
+	}
+}
+
+func TestPlanHashCoversEveryField(t *testing.T) {
+	base := testPlan().Hash()
+	changes := map[string]func(*Plan){
+		"run ID":         func(p *Plan) { p.RunID = "other" },
+		"device order":   func(p *Plan) { p.DeviceIDs[0], p.DeviceIDs[1] = p.DeviceIDs[1], p.DeviceIDs[0] },
+		"device added":   func(p *Plan) { p.DeviceIDs = append(p.DeviceIDs, "cccccccccccccccccccccccccccccccc") },
+		"command string": func(p *Plan) { p.Commands[0].CommandString += " -CommandLine=x" },
+		"endpoint":       func(p *Plan) { p.Commands[0].Endpoint = "active-responder-command" },
+		"metadata":       func(p *Plan) { p.Metadata.Operator = "someone else" },
+		"targets":        func(p *Plan) { p.Targets = []sink.TargetMapping{{DeviceID: p.DeviceIDs[0]}} },
+		"secrets":        func(p *Plan) { p.Secrets = []string{"uninstall_token"} },
+		"concurrency":    func(p *Plan) { p.Concurrency = &config.Concurrency{Hosts: 4} },
+		"sandbox":        func(p *Plan) { p.Sandbox = &config.Sandbox{Enabled: true} },
+	}
+	for name, change := range changes {
+		plan := testPlan()
+		change(plan)
+		if plan.Hash() == base {
+			t.Errorf("changing the %s keeps the plan hash", name)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	planHash := testPlan().Hash()
+	token := Token("secret", "CHG-7", planHash)
+	if reference, err := VerifyToken("secret", token, planHash); err != nil || reference != "CHG-7" {
+		t.Errorf("VerifyToken = %q, %v, want CHG-7", reference, err)
+	}
+	other := testPlan()
+	other.RunID = "other"
+	for name, check := range map[string]func() (string, error){
+		"other plan":   func() (string, error) { return VerifyToken("secret", token, other.Hash()) },
+		"other secret": func() (string, error) { return VerifyToken("other", token, planHash) },
+		"no reference": func() (string, error) { return VerifyToken("secret", token[len("CHG-7"):], planHash) },
+		"not hex":      func() (string, error) { return VerifyToken("secret", "CHG-7.zz", planHash) },
+		"reference swap": func() (string, error) {
+			return VerifyToken("secret", "CHG-8"+token[len("CHG-7"):], planHash)
+		},
+	} {
+		if _, err := check(); !errors.Is(err, ErrRejected) {
+			t.Errorf("%s: VerifyToken = %v, want ErrRejected", name, err)
+		}
+	}
+}
+
+func TestGateApprove(t *testing.T) {
+	plan := testPlan()
+	readOnly := &Plan{RunID: plan.RunID, DeviceIDs: plan.DeviceIDs, Commands: []Command{{Endpoint: "command", BaseCommand: "ls", CommandString: "ls C:\\"}}}
+	tests := []struct {
+		name       string
+		gate       Gate
+		plan       *Plan
+		wantMethod string // "" when the plan is rejected
+	}{
+		{"token", Gate{TokenSecret: "secret", Token: Token("secret", "CHG-7", plan.Hash())}, plan, MethodToken},
+		{"token for another plan", Gate{TokenSecret: "secret", Token: Token("secret", "CHG-7", readOnly.Hash())}, plan, ""},
+		{"no token", Gate{TokenSecret: "secret"}, plan, ""},
+		{"exempt read-only", Gate{TokenSecret: "secret", ExemptReadOnly: true}, readOnly, MethodExempt},
+		{"read-only not exempt", Gate{TokenSecret: "secret"}, readOnly, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			approval, err := test.gate.Approve(context.Background(), test.plan)
+			if test.wantMethod == "" {
+				if !errors.Is(err, ErrRejected) {
+					t.Errorf("Approve = %+v, %v, want ErrRejected", approval, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if approval.Method != test.wantMethod || approval.PlanHash != test.plan.Hash() {
+				t.Errorf("approval %+v, want method %s for plan %s", approval, test.wantMethod, test.plan.Hash())
+			}
+		})
+	}
+}
+
+func TestGateWebhook(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		wantReference string // "" when the plan is rejected
+	}{
+		{"approved", http.StatusOK, `{"approved": true, "reference": "CHG-9"}`, "CHG-9"},
+		{"declined", http.StatusOK, `{"approved": false, "reason": "outside the change window"}`, ""},
+		{"error status", http.StatusInternalServerError, `{"approved": true}`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan := testPlan()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var request webhookRequest
+				if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.PlanHash != plan.Hash() {
+					t.Errorf("webhook request plan hash %q (%v), want %s", request.PlanHash, err, plan.Hash())
+				}
+				w.WriteHeader(test.status)
+				io.WriteString(w, test.body)
+			}))
+			defer server.Close()
+
+			gate := &Gate{WebhookURL: server.URL, HTTPClient: server.Client()}
+			approval, err := gate.Approve(context.Background(), plan)
+			if test.wantReference == "" {
+				if !errors.Is(err, ErrRejected) {
+					t.Errorf("Approve = %+v, %v, want ErrRejected", approval, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if approval.Method != MethodWebhook || approval.Reference != test.wantReference {
+				t.Errorf("approval %+v, want webhook reference %s", approval, test.wantReference)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+// Package audit writes the local audit log of a run: one JSON record per
+// line for each thing the run did in the tenant on the operator's behalf,
+// such as opening a session or revealing an uninstall token. The file is
+// only ever appended to, so the records of earlier runs sharing it stay as
+// they were written.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// DefaultName is the file name of the audit log in the run's output
+// directory when no profile is selected.
+const DefaultName = "audit.jsonl"
+
+// FileName returns the name of the audit log of profile: audit-<profile>.jsonl,
+// so that runs against different tenants sharing an output directory keep
+// separate logs, or DefaultName without a profile. Characters a file name
+// cannot safely hold are replaced with _.
+func FileName(profile string) string {
+	if profile == "" {
+		return DefaultName
+	}
+	safe := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, profile)
+	return "audit-" + safe + ".jsonl"
+}
+
+// Events recorded in the audit log.
+const (
+	EventRunStarted             = "run_started"
+	EventRunFinished            = "run_finished"
+	EventSessionOpened          = "session_opened"
+	EventCommandIssued          = "command_issued"
+	EventDestructiveConfirmed   = "destructive_confirmed"
+	EventDestructiveRefused     = "destructive_refused"
+	EventPutFileUploaded        = "put_file_uploaded"
+	EventUninstallTokenRevealed = "uninstall_token_revealed"
+	EventSampleUploaded         = "sample_uploaded"
+	EventSandboxSubmitted       = "sandbox_submitted"
+)
+
+// Identity is who a run acts for, in which tenant and for what case. It is
+// stamped on every record of the run's log.
+type Identity struct {
+	RunID   string `json:"run_id"`
+	CID     string `json:"cid,omitempty"`     // Tenant the credentials belong to, once known (SetCID)
+	Profile string `json:"profile,omitempty"` // Config profile, and so tenant, the run used
+	sink.Metadata
+}
+
+// Record is one line of the audit log. Time and the Identity fields are
+// filled in by Log.Record.
+type Record struct {
+	Time  string `json:"time"` // In sink.TimeFormat
+	Event string `json:"event"`
+	Identity
+	DeviceID  string `json:"device_id,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+
+	// Comment is the free-text audit field sent to the API with the
+	// action, the operator included, when the action has one.
+	Comment string            `json:"comment,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+	Error   string            `json:"error,omitempty"` // Set when the action failed
+}
+
+// Log appends records to an audit log file. A nil *Log records nothing, so
+// callers need not check whether there is one.
+type Log struct {
+	path     string
+	identity Identity
+
+	mu   sync.Mutex
+	file *os.File
+	err  error // First failed write
+}
+
+// Open opens the audit log at path for appending, creating it and its
+// directory when missing. Records are stamped with identity.
+func Open(path string, identity Identity) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{path: path, identity: identity, file: file}, nil
+}
+
+// Path returns the path of the log file.
+func (l *Log) Path() string {
+	if l == nil {
+		return ""
+	}
+	return l.path
+}
+
+// SetCID stamps cid, the tenant the run authenticated to, on the records
+// that follow. Records written before the CID is known lack it.
+func (l *Log) SetCID(cid string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.identity.CID = cid
+}
+
+// Record stamps record with the time and the run's identity and appends it
+// as one line, synced to disk. A failed write is kept for Close to return;
+// the run goes on without the record.
+func (l *Log) Record(record Record) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	record.Time = sink.FormatTime(time.Now())
+	record.Identity = l.identity
+	line, err := json.Marshal(record)
+	if err != nil {
+		l.setErr(fmt.Errorf("failed to encode %s audit record: %w", record.Event, err))
+		return
+	}
+	line = append(line, '\n')
+
+	if l.file == nil {
+		l.setErr(fmt.Errorf("audit log closed before the %s record", record.Event))
+		return
+	}
+	// One write per record, so that records appended by concurrent runs
+	// never interleave within a line.
+	if _, err := l.file.Write(line); err != nil {
+		l.setErr(fmt.Errorf("failed to write %s audit record: %w", record.Event, err))
+		return
+	}
+	if err := l.file.Sync(); err != nil {
+		l.setErr(fmt.Errorf("failed to sync audit log: %w", err))
+	}
+}
+
+// Close closes the log file. It returns the first record that could not be
+// written, if any, or the error closing the file.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		if err := l.file.Close(); err != nil {
+			l.setErr(fmt.Errorf("failed to close audit log: %w", err))
+		}
+		l.file = nil
+	}
+	return l.err
+}
+
+// setErr keeps err unless an earlier one is kept. The caller holds mu.
+func (l *Log) setErr(err error) {
+	if l.err == nil {
+		l.err = err
+	}
+}
@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// readRecords returns the records of the log at path, in file order.
+func readRecords(t *testing.T, path string) []Record {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestLogAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs", DefaultName)
+	first := Identity{RunID: "first", Metadata: sink.Metadata{CaseID: "CASE-1", Operator: "alice@example.com", Reason: "triage", TicketURL: "https://tickets.example.com/1"}}
+	for _, identity := range []Identity{first, {RunID: "second"}} {
+		log, err := Open(path, identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.Record(Record{Event: EventRunStarted, Identity: Identity{RunID: "ignored"}})
+		log.Record(Record{Event: EventSessionOpened, DeviceID: "abc", SessionID: "s1", Comment: "origin", Error: "refused"})
+		if err := log.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records := readRecords(t, path)
+	var got []Record
+	for _, record := range records {
+		if !isFormattedTime(record.Time) {
+			t.Errorf("record time %q is not UTC with millisecond precision", record.Time)
+		}
+		record.Time = ""
+		got = append(got, record)
+	}
+	want := []Record{
+		{Event: EventRunStarted, Identity: first},
+		{Event: EventSessionOpened, Identity: first, DeviceID: "abc", SessionID: "s1", Comment: "origin", Error: "refused"},
+		{Event: EventRunStarted, Identity: Identity{RunID: "second"}},
+		{Event: EventSessionOpened, Identity: Identity{RunID: "second"}, DeviceID: "abc", SessionID: "s1", Comment: "origin", Error: "refused"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %+v, want %+v (the second run appended after the first)", got, want)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("audit log mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestLogRecordAfterClose(t *testing.T) {
+	log, err := Open(filepath.Join(t.TempDir(), DefaultName), Identity{RunID: "run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	log.Record(Record{Event: EventRunFinished})
+	if err := log.Close(); err == nil {
+		t.Error("Close = nil after a record was dropped, want the error")
+	}
+}
+
+func TestNilLog(t *testing.T) {
+	var log *Log
+	log.Record(Record{Event: EventRunStarted})
+	if log.Path() != "" || log.Close() != nil {
+		t.Error("nil log is not a no-op")
+	}
+}
+
+// isFormattedTime reports whether value is a sink.FormatTime timestamp.
+func isFormattedTime(value string) bool {
+	return len(value) == len("2006-01-02T15:04:05.000Z") && value[len(value)-1] == 'Z' && value[19] == '.'
+}
+
+func TestFileName(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    string
+	}{
+		{"", "audit.jsonl"},
+		{"prod-us", "audit-prod-us.jsonl"},
+		{"lab.v2_eu", "audit-lab.v2_eu.jsonl"},
+		{"../prod eu", "audit-.._prod_eu.jsonl"},
+	}
+	for _, test := range tests {
+		if got := FileName(test.profile); got != test.want {
+			t.Errorf("FileName(%q) = %q, want %q", test.profile, got, test.want)
+		}
+	}
+}
+
+func TestLogSetCID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultName)
+	log, err := Open(path, Identity{RunID: "run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Record(Record{Event: EventRunStarted})
+	log.SetCID("0123456789abcdef0123456789abcdef")
+	log.Record(Record{Event: EventSessionOpened})
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	records := readRecords(t, path)
+	if len(records) != 2 || records[0].CID != "" || records[1].CID != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("records = %+v, want the CID on the record after SetCID only", records)
+	}
+}
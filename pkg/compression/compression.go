@@ -0,0 +1,137 @@
+// Package compression writes and reads the compressed files of a run: the
+// result files and artifacts a local sink stores with compression set, and
+// the same files read back by the search and export subcommands. A file's
+// encoding is named by its extension, so readers need no other record of it.
+package compression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encodings.
+const (
+	Zstd = "zstd"
+	Gzip = "gzip"
+)
+
+// extensions maps each encoding to the extension of its files.
+var extensions = map[string]string{Zstd: ".zst", Gzip: ".gz"}
+
+// Check returns an error for an encoding that is not supported. "" is no
+// compression.
+func Check(encoding string) error {
+	if _, ok := extensions[encoding]; !ok && encoding != "" {
+		return fmt.Errorf("unknown compression %q (expected %s or %s)", encoding, Zstd, Gzip)
+	}
+	return nil
+}
+
+// Ext returns the extension of files with encoding, such as ".zst", or ""
+// without one.
+func Ext(encoding string) string {
+	return extensions[encoding]
+}
+
+// EncodingOf returns the encoding that the extension of name names, or "".
+func EncodingOf(name string) string {
+	for encoding, ext := range extensions {
+		if strings.HasSuffix(name, ext) {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// Trim returns name without the extension of its encoding.
+func Trim(name string) string {
+	return strings.TrimSuffix(name, Ext(EncodingOf(name)))
+}
+
+// Writer compresses what is written to it. Flush writes out what it holds
+// so far, so that a reader sees it, and Close finishes the stream.
+type Writer interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// NewWriter returns a writer that compresses what is written to it into w
+// as it goes. Close finishes the compressed stream; it does not close w.
+// Without an encoding, writes go to w as they are.
+func NewWriter(w io.Writer, encoding string) (Writer, error) {
+	switch encoding {
+	case Zstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case "":
+		return nopCloser{w}, nil
+	}
+	return nil, Check(encoding)
+}
+
+// NewReader returns a reader of r decompressed from encoding. Streams
+// appended one after another, as a file sink writes them, read as one.
+func NewReader(r io.Reader, encoding string) (io.ReadCloser, error) {
+	switch encoding {
+	case Zstd:
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case Gzip:
+		return gzip.NewReader(r)
+	case "":
+		return io.NopCloser(r), nil
+	}
+	return nil, Check(encoding)
+}
+
+// Open opens the file at path for reading, decompressed when its extension
+// names an encoding.
+func Open(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewReader(file, EncodingOf(path))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return readCloser{reader, file}, nil
+}
+
+// Counter counts the bytes written through it to W.
+type Counter struct {
+	W io.Writer
+	N int64
+}
+
+func (c *Counter) Write(p []byte) (int, error) {
+	n, err := c.W.Write(p)
+	c.N += int64(n)
+	return n, err
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+func (nopCloser) Flush() error { return nil }
+
+// readCloser closes the decompressor and the file under it.
+type readCloser struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (r readCloser) Close() error {
+	r.ReadCloser.Close()
+	return r.file.Close()
+}
@@ -0,0 +1,120 @@
+package compression
+
+import (
+	"bytes"
+	"cmp"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMultistreamRoundTrip appends several compressed streams to one file,
+// as a file sink does across writes and runs, and reads them back as one.
+func TestMultistreamRoundTrip(t *testing.T) {
+	streams := []string{"{\"host\": \"a\"}\n", "{\"host\": \"b\"}\n", strings.Repeat("{\"host\": \"c\"}\n", 1000)}
+	for _, encoding := range []string{Zstd, Gzip, ""} {
+		t.Run(cmp.Or(encoding, "none"), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "results.jsonl"+Ext(encoding))
+			for _, stream := range streams {
+				file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+				writer, err := NewWriter(file, encoding)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Half of each stream is flushed before the rest is written.
+				half := len(stream) / 2
+				if _, err := io.WriteString(writer, stream[:half]); err != nil {
+					t.Fatal(err)
+				}
+				if err := writer.Flush(); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := io.WriteString(writer, stream[half:]); err != nil {
+					t.Fatal(err)
+				}
+				if err := writer.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if err := file.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			reader, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			got, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := strings.Join(streams, ""); string(got) != want {
+				t.Errorf("read %d bytes, want the %d bytes of all %d streams", len(got), len(want), len(streams))
+			}
+		})
+	}
+}
+
+// TestFlushIsReadable checks that what is flushed can be read before the
+// stream is closed, as search does with a file a run is still writing.
+func TestFlushIsReadable(t *testing.T) {
+	for _, encoding := range []string{Zstd, Gzip} {
+		t.Run(encoding, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewWriter(&buf, encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(writer, "first line\n")
+			if err := writer.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			reader, err := NewReader(bytes.NewReader(buf.Bytes()), encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			line := make([]byte, len("first line\n"))
+			if _, err := io.ReadFull(reader, line); err != nil || string(line) != "first line\n" {
+				t.Errorf("read %q, %v, want the flushed line", line, err)
+			}
+			writer.Close()
+		})
+	}
+}
+
+func TestEncodingNames(t *testing.T) {
+	tests := []struct {
+		name, encoding, trimmed string
+	}{
+		{"results.jsonl.zst", Zstd, "results.jsonl"},
+		{"artifact.evtx.gz", Gzip, "artifact.evtx"},
+		{"results.jsonl", "", "results.jsonl"},
+		{"archive.tgz", "", "archive.tgz"},
+	}
+	for _, test := range tests {
+		if got := EncodingOf(test.name); got != test.encoding {
+			t.Errorf("EncodingOf(%q) = %q, want %q", test.name, got, test.encoding)
+		}
+		if got := Trim(test.name); got != test.trimmed {
+			t.Errorf("Trim(%q) = %q, want %q", test.name, got, test.trimmed)
+		}
+	}
+	if err := Check("brotli"); err == nil {
+		t.Error("Check(brotli) succeeded, want an error")
+	}
+	if _, err := NewWriter(io.Discard, "brotli"); err == nil {
+		t.Error("NewWriter(brotli) succeeded, want an error")
+	}
+	for _, encoding := range []string{Zstd, Gzip, ""} {
+		if err := Check(encoding); err != nil {
+			t.Errorf("Check(%q) = %v", encoding, err)
+		}
+	}
+}
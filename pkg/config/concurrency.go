@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/postprocess"
+)
+
+// Concurrency bounds every pool of a run in one place. Hosts is how many
+// hosts are collected at once (default 1, one after the other), Downloads
+// how many retrieved files download at once across them (default: one per
+// host), SinkDeliveries how many deliveries run at once across all sinks
+// (default: one per sink) and PostProcessors how many files are
+// post-processed at once (default: postprocess.concurrency, or 2). APIRate
+// spaces the run's API requests to at most that many per second (0 leaves
+// them unlimited); the 429 throttle and api_call_budget apply on top.
+//
+// MaxParallelism, from --max-parallelism, scales all of them by the same
+// factor, so the largest pool gets that many slots and the others keep
+// their proportions; sink deliveries stay at most one per sink.
+type Concurrency struct {
+	Hosts          int     `yaml:"hosts" json:"hosts"`
+	Downloads      int     `yaml:"downloads" json:"downloads"`
+	SinkDeliveries int     `yaml:"sink_deliveries" json:"sink_deliveries"`
+	PostProcessors int     `yaml:"post_processors" json:"post_processors"`
+	APIRate        float64 `yaml:"api_rate" json:"api_rate,omitempty"`
+	MaxParallelism int     `yaml:"-" json:"max_parallelism,omitempty"`
+
+	sinks int // Configured sinks, for Warnings
+}
+
+// resolve fills in the defaults of the unset pools and applies
+// MaxParallelism.
+func (c *Concurrency) resolve(postProcess PostProcess, sinks int) {
+	c.sinks = sinks
+	if c.Hosts == 0 {
+		c.Hosts = 1
+	}
+	if c.Downloads == 0 {
+		c.Downloads = c.Hosts
+	}
+	if c.SinkDeliveries == 0 {
+		c.SinkDeliveries = max(sinks, 1)
+	}
+	if c.PostProcessors == 0 {
+		c.PostProcessors = postProcess.Concurrency
+	}
+	if c.PostProcessors == 0 {
+		c.PostProcessors = postprocess.DefaultConcurrency
+	}
+	if c.MaxParallelism == 0 {
+		return
+	}
+	factor := float64(c.MaxParallelism) / float64(max(c.Hosts, c.Downloads, c.SinkDeliveries, c.PostProcessors))
+	scale := func(slots int) int { return max(int(math.Round(float64(slots)*factor)), 1) }
+	c.Hosts, c.Downloads = scale(c.Hosts), scale(c.Downloads)
+	c.SinkDeliveries, c.PostProcessors = scale(c.SinkDeliveries), scale(c.PostProcessors)
+	if sinks > 0 {
+		// More would never run at once; see Warnings.
+		c.SinkDeliveries = min(c.SinkDeliveries, sinks)
+	}
+	c.APIRate *= factor
+}
+
+// Warnings returns the settings of a resolved Concurrency that cannot take
+// effect as given. They do not fail the run.
+func (c Concurrency) Warnings() []string {
+	var warnings []string
+	if c.Downloads > c.Hosts {
+		warnings = append(warnings, fmt.Sprintf("concurrency.downloads (%d) exceeds concurrency.hosts (%d); each host downloads one file at a time, so at most %d downloads run at once",
+			c.Downloads, c.Hosts, c.Hosts))
+	}
+	if c.sinks > 0 && c.SinkDeliveries > c.sinks {
+		warnings = append(warnings, fmt.Sprintf("concurrency.sink_deliveries (%d) exceeds the %d configured sinks; results are delivered one at a time, so at most %d deliveries run at once",
+			c.SinkDeliveries, c.sinks, c.sinks))
+	}
+	return warnings
+}
+
+// String describes the resolved pools for the progress output.
+func (c Concurrency) String() string {
+	rate := "unlimited"
+	if c.APIRate > 0 {
+		rate = fmt.Sprintf("%g/s", c.APIRate)
+	}
+	text := fmt.Sprintf("%d hosts, %d downloads, %d sink deliveries, %d post-processors, API rate %s",
+		c.Hosts, c.Downloads, c.SinkDeliveries, c.PostProcessors, rate)
+	if c.MaxParallelism > 0 {
+		text += fmt.Sprintf(" (scaled to --max-parallelism %d)", c.MaxParallelism)
+	}
+	return text
+}
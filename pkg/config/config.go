@@ -0,0 +1,1489 @@
+// Package config resolves the collector configuration from defaults, a YAML
+// or JSON file, a named profile, environment variables and flags.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/naming"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/simulate"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultBaseURL is the US-1 CrowdStrike API endpoint.
+const DefaultBaseURL = "https://api.crowdstrike.com"
+
+// cidPattern matches a CID with an optional checksum suffix.
+var cidPattern = regexp.MustCompile(`^[0-9a-fA-F]{32}(-[0-9a-fA-F]{2})?$`)
+
+// continuationParameterPattern matches the script parameter names a
+// continuation token can be passed in.
+var continuationParameterPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// Regions maps CrowdStrike cloud region names to their API base URLs.
+var Regions = map[string]string{
+	"us-1":     DefaultBaseURL,
+	"us-2":     "https://api.us-2.crowdstrike.com",
+	"eu-1":     "https://api.eu-1.crowdstrike.com",
+	"us-gov-1": "https://api.laggar.gcw.crowdstrike.com",
+	"us-gov-2": "https://api.us-gov-2.crowdstrike.mil",
+}
+
+// Config is the resolved collector configuration. It is the single source
+// consumed by the RTR client, the collection run, the notifiers and the sinks.
+type Config struct {
+	// SchemaVersion is the config file schema the file was written for
+	// (see SchemaVersion); files for a newer schema are refused.
+	SchemaVersion int `yaml:"schema_version" json:"schema_version"`
+
+	ClientID     string `yaml:"client_id" json:"client_id"`
+	ClientSecret string `yaml:"client_secret" json:"client_secret"`
+	Region       string `yaml:"region" json:"region"`
+	BaseURL      string `yaml:"base_url" json:"base_url"`
+	ExpectedCID  string `yaml:"expected_cid" json:"expected_cid"` // Abort when the credentials belong to another CID
+	MemberCID    string `yaml:"member_cid" json:"member_cid"`     // MSSP child CID to act in with parent credentials
+
+	// Profile names the profile to apply; Profiles holds the named profiles.
+	Profile  string             `yaml:"profile" json:"profile"`
+	Profiles map[string]Profile `yaml:"profiles" json:"profiles"`
+
+	DeviceID      string   `yaml:"device_id" json:"device_id"`
+	Target        Target   `yaml:"target" json:"target"` // Hostname selector; replaces device_id when set
+	ScriptName    string   `yaml:"script_name" json:"script_name"`
+	ScriptTimeout Duration `yaml:"script_timeout" json:"script_timeout"` // runscript -Timeout; 0 leaves the platform default
+	CommandWait   Duration `yaml:"command_wait" json:"command_wait"`
+	PassRunID     bool     `yaml:"pass_run_id" json:"pass_run_id"` // Script accepts -RunId <id> via -CommandLine
+
+	// ScriptCommandLine is a text/template rendered for each host into the
+	// script's -CommandLine, e.g. "-RunId {{.RunID}} -Token {{.Secrets.UninstallToken}}".
+	// UninstallToken governs revealing the token it may ask for.
+	ScriptCommandLine string         `yaml:"script_command_line" json:"script_command_line"`
+	UninstallToken    UninstallToken `yaml:"uninstall_token" json:"uninstall_token"`
+
+	// OutputDir is the directory relative output paths are written under:
+	// download_dir, retained command output and file and directory sinks.
+	OutputDir      string   `yaml:"output_dir" json:"output_dir"`
+	DownloadDir    string   `yaml:"download_dir" json:"download_dir"`
+	MemdumpTimeout Duration `yaml:"memdump_timeout" json:"memdump_timeout"`
+
+	// StallWindow abandons a polled command whose output has not advanced for
+	// this long (0 disables); StallRefresh first refreshes the session once.
+	StallWindow  Duration `yaml:"stall_window" json:"stall_window"`
+	StallRefresh bool     `yaml:"stall_refresh" json:"stall_refresh"`
+
+	// BusyPolicy decides what happens to hosts that already have a live RTR
+	// session: skip (recorded as busy), wait up to BusyWait for it to close,
+	// or proceed anyway.
+	BusyPolicy string   `yaml:"busy_policy" json:"busy_policy"`
+	BusyWait   Duration `yaml:"busy_wait" json:"busy_wait"`
+
+	// PollStrategy paces command status polling: fixed, exponential or adaptive.
+	PollStrategy string `yaml:"poll_strategy" json:"poll_strategy"`
+
+	// Endpoints overrides individual API paths by endpoint key, for
+	// deployments behind an API gateway or proxy.
+	Endpoints map[string]string `yaml:"endpoints" json:"endpoints"`
+
+	// CommandEndpoints sends base commands through a given command endpoint
+	// instead of the least-privileged one that accepts them.
+	CommandEndpoints map[string]string `yaml:"command_endpoints" json:"command_endpoints"`
+
+	// ReissuePolicy decides what happens when posting a command fails without
+	// telling whether it was accepted: never re-post, check the session's
+	// command log and adopt a match before re-posting, or always re-post.
+	// ReissueCommands overrides it per base command.
+	ReissuePolicy   string            `yaml:"reissue_policy" json:"reissue_policy"`
+	ReissueCommands map[string]string `yaml:"reissue_commands" json:"reissue_commands"`
+
+	// MinimalPermissions limits the run to Hosts Read and RTR read-only:
+	// features needing Hosts Write or an RTR write scope are refused.
+	MinimalPermissions bool `yaml:"minimal_permissions" json:"minimal_permissions"`
+
+	// APICallBudget caps the API calls of one run (0 disables the cap).
+	APICallBudget int `yaml:"api_call_budget" json:"api_call_budget"`
+
+	// MaxResponseBytes caps the JSON API responses read into memory (0 uses
+	// the client default). File downloads are streamed and not capped.
+	MaxResponseBytes int64 `yaml:"max_response_bytes" json:"max_response_bytes"`
+
+	// FailOnWarnings turns a run into a partial failure when at least this
+	// fraction of the collected hosts raised warnings (0 disables).
+	FailOnWarnings float64 `yaml:"fail_on_warnings" json:"fail_on_warnings"`
+
+	// RunID is set per invocation from --run-id or a generated ID, never from the file.
+	RunID string `yaml:"-" json:"-"`
+
+	// Notices lists what loading ignored, such as unknown keys, for the
+	// caller to print.
+	Notices []string `yaml:"-" json:"-"`
+
+	// CaseID names the case the run collects for; artifact names can use it.
+	// Operator, Reason and TicketURL complete the run's attribution, and
+	// MetadataPolicy can require each of the four and constrain its format.
+	CaseID         string                 `yaml:"case_id" json:"case_id"`
+	Operator       string                 `yaml:"operator" json:"operator"`
+	Reason         string                 `yaml:"reason" json:"reason"`
+	TicketURL      string                 `yaml:"ticket_url" json:"ticket_url"`
+	MetadataPolicy map[string]FieldPolicy `yaml:"metadata_policy" json:"metadata_policy"`
+
+	// ScriptPinsFile pins the SHA256 of cloud scripts, one name=sha256 per
+	// line; a pinned script whose content changed is refused.
+	ScriptPinsFile string `yaml:"script_pins_file" json:"script_pins_file"`
+
+	// PlatformScripts names the cloud script to run instead of ScriptName
+	// on hosts of a platform (windows, linux or mac), e.g. a .sh script for
+	// Linux and macOS hosts when script_name is a PowerShell script.
+	PlatformScripts map[string]string `yaml:"platform_scripts" json:"platform_scripts"`
+
+	// Continuation re-runs a script that reports partial completion with
+	// the continuation token it returned.
+	Continuation Continuation `yaml:"continuation" json:"continuation"`
+
+	// DestructiveCommands lists the commands, a base command optionally
+	// followed by a subcommand such as "reg delete", that need the operator
+	// to confirm the run; ForceDestructive confirms them without a prompt.
+	DestructiveCommands []string `yaml:"destructive_commands" json:"destructive_commands"`
+	ForceDestructive    bool     `yaml:"-" json:"-"`
+
+	// Follow prints the script's output while it runs, for the device IDs
+	// in FollowHosts; a single-host run needs none.
+	Follow      bool     `yaml:"-" json:"-"`
+	FollowHosts []string `yaml:"-" json:"-"`
+
+	// NoHints leaves the remediation hints of classified failures out of
+	// the error output and the reports (--no-hints).
+	NoHints bool `yaml:"-" json:"-"`
+
+	Redaction  Redaction   `yaml:"redaction" json:"redaction"`
+	Output     Output      `yaml:"output" json:"output"`
+	Approval   Approval    `yaml:"approval" json:"approval"`
+	Signing    Signing     `yaml:"signing" json:"signing"`
+	Receipt    Receipt     `yaml:"receipt" json:"receipt"`
+	Archive    Archive     `yaml:"archive" json:"archive"`
+	Throttle   Throttle    `yaml:"throttle" json:"throttle"`
+	Naming     Naming      `yaml:"naming" json:"naming"`
+	VCR        VCR         `yaml:"vcr" json:"vcr"`
+	Simulation Simulation  `yaml:"simulation" json:"simulation"`
+	SMTP       SMTP        `yaml:"smtp" json:"smtp"`
+	Sinks      []sink.Spec `yaml:"sinks" json:"sinks"`
+
+	// SinkDrainTimeout bounds flushing buffered sinks at the end of a run
+	// (default: 30s); each is then closed within its delivery timeout.
+	SinkDrainTimeout Duration `yaml:"sink_drain_timeout" json:"sink_drain_timeout"`
+
+	// PostProcess runs local processors over the files retrieved from hosts.
+	PostProcess PostProcess `yaml:"postprocess" json:"postprocess"`
+
+	// Sandbox submits retrieved files to Falcon Intelligence Sandbox.
+	Sandbox Sandbox `yaml:"sandbox" json:"sandbox"`
+
+	// Prerequisites skips hosts without enough free disk or memory for the
+	// collection, probed before the script runs.
+	Prerequisites Prerequisites `yaml:"prerequisites" json:"prerequisites"`
+
+	// HostClock records each host's clock skew and timezone at session start.
+	HostClock HostClock `yaml:"host_clock" json:"host_clock"`
+
+	// Inventory writes a snapshot of the fleet's device details with the run.
+	Inventory Inventory `yaml:"inventory" json:"inventory"`
+
+	// CircuitBreaker stops attempting devices that keep failing the same
+	// way, and can quarantine them for later runs.
+	CircuitBreaker CircuitBreaker `yaml:"circuit_breaker" json:"circuit_breaker"`
+
+	// IncludeQuarantined attempts devices the circuit breaker quarantined
+	// (--include-quarantined).
+	IncludeQuarantined bool `yaml:"-" json:"-"`
+
+	// TUI shows a live dashboard of the run on the terminal in place of the
+	// scrolling progress output (--tui).
+	TUI bool `yaml:"-" json:"-"`
+
+	// RunDirs gives every run its own directory under output_dir.
+	RunDirs RunDirs `yaml:"run_dirs" json:"run_dirs"`
+
+	// Concurrency bounds the hosts, downloads, sink deliveries and
+	// post-processors that run at once, and the rate of API requests.
+	Concurrency Concurrency `yaml:"concurrency" json:"concurrency"`
+}
+
+// Profile is a named set of credentials, region and defaults for one tenant.
+// Credentials can be given inline or read from the named environment variables.
+type Profile struct {
+	ClientID        string   `yaml:"client_id" json:"client_id"`
+	ClientSecret    string   `yaml:"client_secret" json:"client_secret"`
+	ClientIDEnv     string   `yaml:"client_id_env" json:"client_id_env"`
+	ClientSecretEnv string   `yaml:"client_secret_env" json:"client_secret_env"`
+	Region          string   `yaml:"region" json:"region"`
+	BaseURL         string   `yaml:"base_url" json:"base_url"`
+	ExpectedCID     string   `yaml:"expected_cid" json:"expected_cid"`
+	MemberCID       string   `yaml:"member_cid" json:"member_cid"`
+	DeviceID        string   `yaml:"device_id" json:"device_id"`
+	ScriptName      string   `yaml:"script_name" json:"script_name"`
+	CommandWait     Duration `yaml:"command_wait" json:"command_wait"`
+}
+
+// HasCredentials reports whether the profile supplies its own credentials.
+func (p Profile) HasCredentials() bool {
+	return p.ClientID != "" || p.ClientSecret != "" || p.ClientIDEnv != "" || p.ClientSecretEnv != ""
+}
+
+// Target selects hosts by hostname instead of a single device_id. Devices
+// matching the FQL Filter are fetched, up to MaxCandidates, and their
+// hostnames are matched client-side against Hostname: a glob, or an RE2
+// regular expression when Match is regex. Matching ignores case unless
+// CaseSensitive is set. Alternatively, Serials, MACs and the
+// IdentifiersFile name hosts by the serial numbers and MAC addresses of an
+// asset inventory.
+type Target struct {
+	Hostname      string `yaml:"hostname" json:"hostname"`
+	Match         string `yaml:"match" json:"match"`
+	Filter        string `yaml:"filter" json:"filter"`
+	CaseSensitive bool   `yaml:"case_sensitive" json:"case_sensitive"`
+	MaxCandidates int    `yaml:"max_candidates" json:"max_candidates"`
+
+	Serials         []string `yaml:"serials" json:"serials"`
+	MACs            []string `yaml:"macs" json:"macs"`
+	IdentifiersFile string   `yaml:"identifiers_file" json:"identifiers_file"` // One serial=... or mac=... per line
+}
+
+// ByIdentifier reports whether the target names hosts by serial number or
+// MAC address.
+func (t Target) ByIdentifier() bool {
+	return len(t.Serials) > 0 || len(t.MACs) > 0 || t.IdentifiersFile != ""
+}
+
+// TargetSources describes, in precedence order, the settings a run can name
+// its target hosts with.
+var TargetSources = []string{
+	"--serial, --mac or --identifiers-file (target.serials, target.macs, target.identifiers_file)",
+	"--hostname (target.hostname, TARGET_HOSTNAME), optionally bounded by --filter",
+	"--device-id (device_id, DEVICE_ID)",
+}
+
+// TargetSource names the setting the run's target hosts come from:
+// "identifiers", "hostname" or "device_id", in that precedence when several
+// are set. It is empty when the configuration names no target.
+func (c *Config) TargetSource() string {
+	switch {
+	case c.Target.ByIdentifier():
+		return "identifiers"
+	case c.Target.Hostname != "":
+		return "hostname"
+	case c.DeviceID != "":
+		return "device_id"
+	}
+	return ""
+}
+
+// FieldPolicy constrains one run metadata field: Required refuses runs
+// without it, and a set value must match Pattern, an RE2 regular expression
+// matched against the whole value.
+type FieldPolicy struct {
+	Required bool   `yaml:"required" json:"required"`
+	Pattern  string `yaml:"pattern" json:"pattern"`
+}
+
+// UninstallToken controls revealing sensor uninstall tokens for
+// script_command_line. Each reveal is audited with AuditMessage, which is
+// required. Forbid refuses any configuration that would reveal a token.
+type UninstallToken struct {
+	AuditMessage string `yaml:"audit_message" json:"audit_message"`
+	Forbid       bool   `yaml:"forbid" json:"forbid"`
+}
+
+// Redaction controls masking of sensitive patterns in command output.
+type Redaction struct {
+	RulesFile     string `yaml:"rules_file" json:"rules_file"`
+	KeepRawOutput bool   `yaml:"keep_raw_output" json:"keep_raw_output"`
+}
+
+// Output controls normalization of command output from Windows hosts:
+// UTF-16 and UTF-8 BOM decoding, CRLF to LF and trailing NUL removal.
+// KeepOriginal also keeps the un-normalized bytes in a local file.
+type Output struct {
+	Normalize    bool `yaml:"normalize" json:"normalize"`
+	KeepOriginal bool `yaml:"keep_original" json:"keep_original"`
+}
+
+// Approval gates admin-level runs behind change control. With WebhookURL
+// the run's plan is posted for a decision; with TokenSecret an approval
+// token carrying an HMAC over the plan hash is required. Plans with only
+// read-only commands pass when ExemptReadOnly is set.
+type Approval struct {
+	WebhookURL     string   `yaml:"webhook_url" json:"webhook_url"`
+	TokenSecret    string   `yaml:"token_secret" json:"token_secret"`
+	Timeout        Duration `yaml:"timeout" json:"timeout"`
+	ExemptReadOnly bool     `yaml:"exempt_read_only" json:"exempt_read_only"`
+
+	// Token is set per invocation from --approval-token or APPROVAL_TOKEN, never from the file.
+	Token string `yaml:"-" json:"-"`
+}
+
+// Signing names the PEM private key (Ed25519, RSA or ECDSA) evidence bundles
+// and host receipts are signed with, and optionally its certificate.
+type Signing struct {
+	Key  string `yaml:"key" json:"key"`
+	Cert string `yaml:"cert" json:"cert"`
+}
+
+// Receipt drops a signed receipt of the collection on each host it succeeds
+// on, at Path on the host, through a temporary cloud put-file. It is
+// disabled when Path is empty.
+type Receipt struct {
+	Path string `yaml:"path" json:"path"`
+}
+
+// Archive bounds archives built on a host before retrieval: MaxBytes caps
+// both the content and the archive (0 uses the client default), and Cleanup
+// removes the archive from the host once it has been retrieved.
+type Archive struct {
+	MaxBytes int64 `yaml:"max_bytes" json:"max_bytes"`
+	Cleanup  bool  `yaml:"cleanup" json:"cleanup"`
+}
+
+// PostProcess lists the processors run, in order, over every retrieved file:
+// hashes (MD5, SHA1, SHA256 and, with SSDeepBinary, ssdeep), strings
+// (runs of at least StringsMinLength characters, default 6) and yara (a
+// scan with YARARules using YARABinary, "yara" if empty). Concurrency bounds
+// how many files are processed at once (0 uses the default of 2).
+type PostProcess struct {
+	Processors       []string `yaml:"processors" json:"processors"`
+	Concurrency      int      `yaml:"concurrency" json:"concurrency"`
+	StringsMinLength int      `yaml:"strings_min_length" json:"strings_min_length"`
+	SSDeepBinary     string   `yaml:"ssdeep_binary" json:"ssdeep_binary"`
+	YARABinary       string   `yaml:"yara_binary" json:"yara_binary"`
+	YARARules        string   `yaml:"yara_rules" json:"yara_rules"`
+}
+
+// Sandbox, when Enabled, submits retrieved files to Falcon Intelligence
+// Sandbox for detonation and attaches each verdict to the host's result.
+// Submitting shares the files with the sandbox environment, so it is off
+// by default. Only files with one of Extensions (the executables, scripts
+// and documents of falconrtr.DefaultSandboxExtensions if empty, "*" for
+// any) and of at most MaxBytes are submitted, to the sandbox environment
+// EnvironmentID (160 is Windows 10 64-bit). Timeout bounds the wait for
+// each verdict.
+type Sandbox struct {
+	Enabled       bool     `yaml:"enabled" json:"enabled"`
+	Extensions    []string `yaml:"extensions" json:"extensions"`
+	MaxBytes      int64    `yaml:"max_bytes" json:"max_bytes"`
+	EnvironmentID int      `yaml:"environment_id" json:"environment_id"`
+	Timeout       Duration `yaml:"timeout" json:"timeout"`
+}
+
+// Prerequisites, when MinFreeDiskMB or MinFreeMemoryMB is set, probes each
+// host before the script runs and skips it, with status
+// precondition_failed, when it has less free disk space on Volume (C on
+// Windows and / elsewhere, if empty) or less free memory. Commands replace
+// the built-in probe of a platform (windows, linux or mac); a probe prints
+// free_disk=<bytes> and free_memory=<bytes> lines. OnProbeFailure decides
+// what happens to a host whose probe fails or is not understood: proceed
+// (default, with a warning) or skip. Timeout bounds each probe (default 1m).
+type Prerequisites struct {
+	MinFreeDiskMB   int64             `yaml:"min_free_disk_mb" json:"min_free_disk_mb"`
+	MinFreeMemoryMB int64             `yaml:"min_free_memory_mb" json:"min_free_memory_mb"`
+	Volume          string            `yaml:"volume" json:"volume"`
+	Commands        map[string]string `yaml:"commands" json:"commands"`
+	OnProbeFailure  string            `yaml:"on_probe_failure" json:"on_probe_failure"`
+	Timeout         Duration          `yaml:"timeout" json:"timeout"`
+}
+
+// Enabled reports whether hosts are probed before the script runs.
+func (p Prerequisites) Enabled() bool {
+	return p.MinFreeDiskMB > 0 || p.MinFreeMemoryMB > 0
+}
+
+// HostClock, when Enabled, reads each host's clock and timezone with one
+// read-only runscript when its session opens, and records the clock's skew
+// against the collector's in the host's result. Timeout bounds the command
+// (default 1m). A failed read is a warning, never a host failure.
+type HostClock struct {
+	Enabled bool     `yaml:"enabled" json:"enabled"`
+	Timeout Duration `yaml:"timeout" json:"timeout"`
+}
+
+// Inventory, when Enabled, writes a snapshot of the details of every device
+// matching Filter (target.filter if empty, and all devices when both are)
+// to Path, whether the run targets the device or not. Format is json
+// (default) or csv. Path defaults to inventory-<run_id>.<format> and, when
+// relative, is resolved under output_dir. The file is also delivered to the
+// artifact sinks.
+type Inventory struct {
+	Enabled bool   `yaml:"enabled" json:"enabled"`
+	Path    string `yaml:"path" json:"path"`
+	Format  string `yaml:"format" json:"format"`
+	Filter  string `yaml:"filter" json:"filter"`
+}
+
+// Continuation, when TokenPath is set, re-runs the script on a host for as
+// long as its JSON output holds a continuation token at TokenPath, a path
+// such as $.continuation.marker. The token is passed back on the script's
+// -CommandLine as -<Parameter> '<token>' (default -Continuation), for at
+// most MaxIterations runs per host (default 10). The runs' output is
+// merged into one result.
+type Continuation struct {
+	TokenPath     string `yaml:"token_path" json:"token_path"`
+	Parameter     string `yaml:"parameter" json:"parameter"`
+	MaxIterations int    `yaml:"max_iterations" json:"max_iterations"`
+}
+
+// CircuitBreaker, when Enabled, stops attempting a device after Failures
+// (default 3) consecutive failed attempts with the same failure class, and
+// reports it circuit_open with that class. With QuarantineFile, failures
+// are counted across runs and a device whose circuit opened is quarantined
+// for QuarantineTTL (default 24h): later runs skip it until then, unless
+// run with --include-quarantined. A relative QuarantineFile is resolved
+// under output_dir, outside any run directory.
+type CircuitBreaker struct {
+	Enabled        bool     `yaml:"enabled" json:"enabled"`
+	Failures       int      `yaml:"failures" json:"failures"`
+	QuarantineFile string   `yaml:"quarantine_file" json:"quarantine_file"`
+	QuarantineTTL  Duration `yaml:"quarantine_ttl" json:"quarantine_ttl"`
+}
+
+// RunDirs, when Enabled, moves a run's output into output_dir/<run-id>,
+// which output_dir then names after Load; Parent keeps the configured
+// output_dir. A run holds a lock in Parent while it writes, and OnLocked
+// says what a second run does meanwhile: wait (default, for at most Wait
+// when set), new (run in its own directory without the lock) or abort.
+type RunDirs struct {
+	Enabled  bool     `yaml:"enabled" json:"enabled"`
+	OnLocked string   `yaml:"on_locked" json:"on_locked"`
+	Wait     Duration `yaml:"wait" json:"wait"`
+	Parent   string   `yaml:"-" json:"-"`
+}
+
+// Throttle tunes how a 429 pauses every status poller of the run: each
+// resumes after a random delay of up to Jitter (0 uses the client default),
+// and PauseIssuance holds new commands during a pause as well.
+type Throttle struct {
+	Jitter        Duration `yaml:"jitter" json:"jitter"`
+	PauseIssuance bool     `yaml:"pause_issuance" json:"pause_issuance"`
+}
+
+// Naming holds the templates for the names of the files a run writes: see
+// the naming package for the fields available.
+type Naming struct {
+	Artifact string `yaml:"artifact" json:"artifact"` // Retrieved files, relative to download_dir
+	Output   string `yaml:"output" json:"output"`     // Retained raw and original command output
+	Report   string `yaml:"report" json:"report"`     // Status report attached to the email summary
+}
+
+// VCR records API interactions to a cassette or replays them from one.
+// It is disabled when Mode is empty.
+type VCR struct {
+	Mode         string `yaml:"mode" json:"mode"` // record or replay
+	Cassette     string `yaml:"cassette" json:"cassette"`
+	AnonymizeIDs bool   `yaml:"anonymize_ids" json:"anonymize_ids"`
+}
+
+// Simulation replaces the CrowdStrike API with simulated devices, for demos
+// and end-to-end testing without real hosts.
+type Simulation struct {
+	Enabled      bool              `yaml:"enabled" json:"enabled"`
+	Seed         int64             `yaml:"seed" json:"seed"`
+	Latency      Duration          `yaml:"latency" json:"latency"`
+	LineInterval Duration          `yaml:"line_interval" json:"line_interval"`
+	FailureRate  float64           `yaml:"failure_rate" json:"failure_rate"`
+	ThrottleRate float64           `yaml:"throttle_rate" json:"throttle_rate"` // Probability that an RTR request is answered with 429
+	Devices      []SimulatedDevice `yaml:"devices" json:"devices"`
+	Outputs      map[string]string `yaml:"outputs" json:"outputs"`     // Script name or base command to stdout
+	Errors       map[string]string `yaml:"errors" json:"errors"`       // Script name or base command to a status resource error
+	Scopes       []string          `yaml:"scopes" json:"scopes"`       // Scopes granted to the simulated API client; empty grants all
+	Children     []string          `yaml:"children" json:"children"`   // Child CIDs of the simulated MSSP tenant
+	Ambiguous    []string          `yaml:"ambiguous" json:"ambiguous"` // Script names or base commands whose first post loses its response
+	Scripts      map[string]string `yaml:"scripts" json:"scripts"`     // Cloud script name to content
+
+	SandboxVerdicts map[string]string `yaml:"sandbox_verdicts" json:"sandbox_verdicts"` // Submitted file name to its sandbox verdict; others are "no specific threat"
+}
+
+// SimulatedDevice is one fake host of the simulation.
+type SimulatedDevice struct {
+	DeviceID string `yaml:"device_id" json:"device_id"`
+	Hostname string `yaml:"hostname" json:"hostname"`
+	Platform string `yaml:"platform" json:"platform"`
+	Offline  bool   `yaml:"offline" json:"offline"`
+	BusyWith string `yaml:"busy_with" json:"busy_with"` // User holding a live session on the device
+	Stale    bool   `yaml:"stale" json:"stale"`         // Listed, but its ID no longer opens sessions
+
+	SerialNumber string `yaml:"serial_number" json:"serial_number"`
+	MACAddress   string `yaml:"mac_address" json:"mac_address"`
+}
+
+// SMTP configures the run-completion email notifier. It is disabled when Host is empty.
+type SMTP struct {
+	Host               string   `yaml:"host" json:"host"`
+	Port               int      `yaml:"port" json:"port"`
+	TLSMode            string   `yaml:"tls_mode" json:"tls_mode"`
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify" json:"insecure_skip_verify"`
+	Username           string   `yaml:"username" json:"username"`
+	Password           string   `yaml:"password" json:"password"`
+	From               string   `yaml:"from" json:"from"`
+	SuccessRecipients  []string `yaml:"to_success" json:"to_success"`
+	FailureRecipients  []string `yaml:"to_failure" json:"to_failure"`
+	SubjectTemplate    string   `yaml:"subject_template" json:"subject_template"`
+	AttachMaxBytes     int      `yaml:"attach_max_bytes" json:"attach_max_bytes"`
+}
+
+// Duration is a time.Duration written as a Go duration string ("5s", "2m") in config files.
+type Duration time.Duration
+
+// UnmarshalYAML parses a duration string.
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return fmt.Errorf("line %d: expected a duration string", node.Line)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q", node.Line, s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("expected a duration string, got %s", string(data))
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalYAML writes the duration as a string.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+// MarshalJSON writes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Defaults returns the configuration used when nothing else is set.
+func Defaults() *Config {
+	return &Config{
+		SchemaVersion:       SchemaVersion,
+		ScriptName:          "test-omkar.ps1",
+		CommandWait:         Duration(5 * time.Second),
+		DownloadDir:         "downloads",
+		MemdumpTimeout:      Duration(2 * time.Hour),
+		StallWindow:         Duration(10 * time.Minute),
+		StallRefresh:        true,
+		BusyPolicy:          "skip",
+		ReissuePolicy:       "check",
+		DestructiveCommands: []string{"rm", "kill", "shutdown", "restart", "reg delete"},
+		BusyWait:            Duration(5 * time.Minute),
+		Target:              Target{Match: "glob", MaxCandidates: 10000},
+		Output:              Output{Normalize: true},
+		Approval:            Approval{Timeout: Duration(30 * time.Second), ExemptReadOnly: true},
+		Naming:              Naming{Artifact: naming.DefaultArtifact, Output: naming.DefaultOutput, Report: naming.DefaultReport},
+		Sandbox:             Sandbox{MaxBytes: 100 * 1024 * 1024, EnvironmentID: 160, Timeout: Duration(15 * time.Minute)},
+		SMTP: SMTP{
+			TLSMode:        "starttls",
+			AttachMaxBytes: 5 * 1024 * 1024,
+		},
+	}
+}
+
+// Flags holds command-line overrides. Empty fields leave the resolved value unchanged.
+type Flags struct {
+	RunID      string
+	ConfigPath string
+	Profile    string
+	DeviceID   string
+	ScriptName string
+	BaseURL    string
+	MemberCID  string
+	OutputDir  string
+
+	TargetHostname      string
+	TargetMatch         string
+	TargetFilter        string
+	TargetCaseSensitive bool
+	TargetSerials       string // Comma-separated
+	TargetMACs          string // Comma-separated
+	TargetIdentifiers   string
+
+	ApprovalToken    string
+	FailOnWarnings   float64
+	ForceDestructive bool
+	Follow           bool
+	FollowHosts      string // Comma-separated device IDs
+	MaxParallelism   int
+	NoHints          bool
+	AllowUnknown     bool
+
+	IncludeQuarantined bool
+	TUI                bool
+
+	CaseID    string
+	Operator  string
+	Reason    string
+	TicketURL string
+}
+
+// Load resolves the configuration with the precedence
+// flags > env > profile > file > defaults. The file path comes from
+// flags.ConfigPath or COLLECTOR_CONFIG; without one, only defaults,
+// environment variables and flags apply. The profile comes from
+// flags.Profile, COLLECTOR_PROFILE or the file's profile key.
+func Load(flags Flags) (*Config, error) {
+	cfg, err := LoadFile(flags.ConfigPath, flags.AllowUnknown)
+	if err != nil {
+		return nil, err
+	}
+
+	profileName := flags.Profile
+	if profileName == "" {
+		profileName = os.Getenv("COLLECTOR_PROFILE")
+	}
+	if profileName == "" {
+		profileName = cfg.Profile
+	}
+	cfg.Profile = profileName
+
+	profileCredentials := false
+	if profileName != "" {
+		profile, ok := cfg.Profiles[profileName]
+		if !ok {
+			return nil, fmt.Errorf("profile %q is not defined (available: %s)", profileName, strings.Join(cfg.ProfileNames(), ", "))
+		}
+		if err := cfg.applyProfile(profile); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", profileName, err)
+		}
+		profileCredentials = profile.HasCredentials()
+	}
+
+	if err := applyEnv(cfg, profileCredentials); err != nil {
+		return nil, err
+	}
+	applyFlags(cfg, flags)
+	cfg.RunID = flags.RunID
+	cfg.normalizeDeviceIDs()
+
+	if cfg.BaseURL == "" {
+		region := cfg.Region
+		if region == "" {
+			region = "us-1"
+		}
+		cfg.BaseURL = Regions[region]
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Inventory.Enabled {
+		if cfg.Inventory.Format == "" {
+			cfg.Inventory.Format = "json"
+		}
+		if cfg.Inventory.Path == "" {
+			cfg.Inventory.Path = "inventory-" + cfg.RunID + "." + cfg.Inventory.Format
+		}
+		if cfg.Inventory.Filter == "" {
+			cfg.Inventory.Filter = cfg.Target.Filter
+		}
+	}
+	if cfg.Continuation.TokenPath != "" {
+		if cfg.Continuation.Parameter == "" {
+			cfg.Continuation.Parameter = "Continuation"
+		}
+		if cfg.Continuation.MaxIterations == 0 {
+			cfg.Continuation.MaxIterations = 10
+		}
+	}
+	if cfg.CircuitBreaker.Enabled {
+		if cfg.CircuitBreaker.Failures == 0 {
+			cfg.CircuitBreaker.Failures = 3
+		}
+		if cfg.CircuitBreaker.QuarantineTTL == 0 {
+			cfg.CircuitBreaker.QuarantineTTL = Duration(24 * time.Hour)
+		}
+	}
+	cfg.applyOutputDir()
+	cfg.Concurrency.resolve(cfg.PostProcess, len(cfg.Sinks))
+	return cfg, nil
+}
+
+// applyOutputDir moves relative output paths under output_dir, or under
+// the run's directory in it with run_dirs.
+func (c *Config) applyOutputDir() {
+	if c.OutputDir == "" {
+		return
+	}
+	if c.CircuitBreaker.QuarantineFile != "" && !filepath.IsAbs(c.CircuitBreaker.QuarantineFile) {
+		// Later runs consult the file, so it stays out of this run's directory.
+		c.CircuitBreaker.QuarantineFile = filepath.Join(c.OutputDir, c.CircuitBreaker.QuarantineFile)
+	}
+	if c.RunDirs.Enabled {
+		c.RunDirs.Parent = c.OutputDir
+		c.OutputDir = filepath.Join(c.OutputDir, c.RunID)
+	}
+	if c.DownloadDir != "" && !filepath.IsAbs(c.DownloadDir) {
+		c.DownloadDir = filepath.Join(c.OutputDir, c.DownloadDir)
+	}
+	if c.Inventory.Path != "" && !filepath.IsAbs(c.Inventory.Path) {
+		c.Inventory.Path = filepath.Join(c.OutputDir, c.Inventory.Path)
+	}
+	for i, spec := range c.Sinks {
+		c.Sinks[i] = spec.Under(c.OutputDir)
+	}
+}
+
+// LoadFile returns the defaults overlaid with the config file at path (or
+// COLLECTOR_CONFIG when path is empty), without applying profiles or
+// overrides. Unknown keys in the file are rejected unless allowUnknown is
+// set, in which case they are ignored and listed in Notices.
+func LoadFile(path string, allowUnknown bool) (*Config, error) {
+	cfg := Defaults()
+	if path == "" {
+		path = os.Getenv("COLLECTOR_CONFIG")
+	}
+	if path != "" {
+		if err := loadFile(path, cfg, allowUnknown); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// ProfileNames lists the configured profile names, sorted.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile overlays the non-empty profile fields onto the top-level settings.
+func (c *Config) applyProfile(p Profile) error {
+	if p.ClientIDEnv != "" {
+		p.ClientID = os.Getenv(p.ClientIDEnv)
+		if p.ClientID == "" {
+			return fmt.Errorf("client_id_env %s is not set", p.ClientIDEnv)
+		}
+	}
+	if p.ClientSecretEnv != "" {
+		p.ClientSecret = os.Getenv(p.ClientSecretEnv)
+		if p.ClientSecret == "" {
+			return fmt.Errorf("client_secret_env %s is not set", p.ClientSecretEnv)
+		}
+	}
+
+	if p.ClientID != "" {
+		c.ClientID = p.ClientID
+	}
+	if p.ClientSecret != "" {
+		c.ClientSecret = p.ClientSecret
+	}
+	if p.Region != "" {
+		c.Region = p.Region
+		c.BaseURL = ""
+	}
+	if p.BaseURL != "" {
+		c.BaseURL = p.BaseURL
+	}
+	if p.ExpectedCID != "" {
+		c.ExpectedCID = p.ExpectedCID
+	}
+	if p.MemberCID != "" {
+		c.MemberCID = p.MemberCID
+	}
+	if p.DeviceID != "" {
+		c.DeviceID = p.DeviceID
+	}
+	if p.ScriptName != "" {
+		c.ScriptName = p.ScriptName
+	}
+	if p.CommandWait != 0 {
+		c.CommandWait = p.CommandWait
+	}
+	return nil
+}
+
+// loadFile checks a YAML or JSON file against the schema, reporting every
+// violation with its line and column, and then decodes it over cfg.
+func loadFile(path string, cfg *Config, allowUnknown bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".json", ".yaml", ".yml":
+	default:
+		return fmt.Errorf("%s: unsupported config file extension (use .yaml, .yml or .json)", path)
+	}
+
+	// JSON is read as YAML here only to locate the violations; it is
+	// decoded as JSON below.
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	violations, unknown := checkSchema(&root, ext == ".json")
+	if allowUnknown {
+		for _, field := range unknown {
+			cfg.Notices = append(cfg.Notices, fmt.Sprintf("%s:%d:%d: ignoring %s", path, field.line, field.column, field.message))
+		}
+	} else {
+		violations = append(violations, unknown...)
+		sortViolations(violations)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("%s does not match the config schema (version %d):\n  - %s", path, SchemaVersion, formatViolations(path, violations))
+	}
+
+	if ext == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		if !allowUnknown {
+			decoder.DisallowUnknownFields()
+		}
+		if err := decoder.Decode(cfg); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return nil
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(!allowUnknown)
+	if err := decoder.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// envOverride maps an environment variable onto a config field.
+type envOverride struct {
+	name       string
+	credential bool // Ignored when the selected profile supplies credentials
+	apply      func(cfg *Config, value string) error
+}
+
+// envOverrides lists every supported environment variable. Existing .env
+// variable names are kept so older deployments continue to work.
+var envOverrides = []envOverride{
+	{"CLIENT_ID", true, func(c *Config, v string) error { c.ClientID = v; return nil }},
+	{"CLIENT_SECRET", true, func(c *Config, v string) error { c.ClientSecret = v; return nil }},
+	{"REGION", true, func(c *Config, v string) error { c.Region = v; c.BaseURL = ""; return nil }},
+	{"BASE_URL", true, func(c *Config, v string) error { c.BaseURL = v; return nil }},
+	{"EXPECTED_CID", true, func(c *Config, v string) error { c.ExpectedCID = v; return nil }},
+	{"MEMBER_CID", true, func(c *Config, v string) error { c.MemberCID = v; return nil }},
+	{"DEVICE_ID", false, func(c *Config, v string) error { c.DeviceID = v; return nil }},
+	{"TARGET_HOSTNAME", false, func(c *Config, v string) error { c.Target.Hostname = v; return nil }},
+	{"TARGET_MATCH", false, func(c *Config, v string) error { c.Target.Match = strings.ToLower(v); return nil }},
+	{"TARGET_FILTER", false, func(c *Config, v string) error { c.Target.Filter = v; return nil }},
+	{"TARGET_CASE_SENSITIVE", false, func(c *Config, v string) error { return parseBool(v, &c.Target.CaseSensitive) }},
+	{"TARGET_MAX_CANDIDATES", false, func(c *Config, v string) error { return parseInt(v, &c.Target.MaxCandidates) }},
+	{"TARGET_SERIALS", false, func(c *Config, v string) error { c.Target.Serials = splitList(v); return nil }},
+	{"TARGET_MACS", false, func(c *Config, v string) error { c.Target.MACs = splitList(v); return nil }},
+	{"TARGET_IDENTIFIERS_FILE", false, func(c *Config, v string) error { c.Target.IdentifiersFile = v; return nil }},
+	{"PASS_RUN_ID", false, func(c *Config, v string) error { return parseBool(v, &c.PassRunID) }},
+	{"SCRIPT_COMMAND_LINE", false, func(c *Config, v string) error { c.ScriptCommandLine = v; return nil }},
+	{"UNINSTALL_TOKEN_AUDIT_MESSAGE", false, func(c *Config, v string) error { c.UninstallToken.AuditMessage = v; return nil }},
+	{"UNINSTALL_TOKEN_FORBID", false, func(c *Config, v string) error {
+		// The environment can forbid uninstall tokens, never allow them again.
+		var forbid bool
+		err := parseBool(v, &forbid)
+		c.UninstallToken.Forbid = c.UninstallToken.Forbid || forbid
+		return err
+	}},
+	{"OUTPUT_DIR", false, func(c *Config, v string) error { c.OutputDir = v; return nil }},
+	{"DOWNLOAD_DIR", false, func(c *Config, v string) error { c.DownloadDir = v; return nil }},
+	{"MEMDUMP_TIMEOUT", false, func(c *Config, v string) error { return parseDuration(v, &c.MemdumpTimeout) }},
+	{"STALL_WINDOW", false, func(c *Config, v string) error { return parseDuration(v, &c.StallWindow) }},
+	{"STALL_REFRESH", false, func(c *Config, v string) error { return parseBool(v, &c.StallRefresh) }},
+	{"BUSY_POLICY", false, func(c *Config, v string) error { c.BusyPolicy = strings.ToLower(v); return nil }},
+	{"BUSY_WAIT", false, func(c *Config, v string) error { return parseDuration(v, &c.BusyWait) }},
+	{"REISSUE_POLICY", false, func(c *Config, v string) error { c.ReissuePolicy = strings.ToLower(v); return nil }},
+	{"POLL_STRATEGY", false, func(c *Config, v string) error { c.PollStrategy = v; return nil }},
+	{"MINIMAL_PERMISSIONS", false, func(c *Config, v string) error { return parseBool(v, &c.MinimalPermissions) }},
+	{"API_CALL_BUDGET", false, func(c *Config, v string) error { return parseInt(v, &c.APICallBudget) }},
+	{"MAX_RESPONSE_BYTES", false, func(c *Config, v string) error {
+		maxBytes, err := strconv.ParseInt(v, 10, 64)
+		c.MaxResponseBytes = maxBytes
+		return err
+	}},
+	{"FAIL_ON_WARNINGS", false, func(c *Config, v string) error {
+		rate, err := strconv.ParseFloat(v, 64)
+		c.FailOnWarnings = rate
+		return err
+	}},
+	{"SINK_DRAIN_TIMEOUT", false, func(c *Config, v string) error { return parseDuration(v, &c.SinkDrainTimeout) }},
+	{"SCRIPT_NAME", false, func(c *Config, v string) error { c.ScriptName = v; return nil }},
+	{"SCRIPT_TIMEOUT", false, func(c *Config, v string) error { return parseDuration(v, &c.ScriptTimeout) }},
+	{"COMMAND_WAIT", false, func(c *Config, v string) error { return parseDuration(v, &c.CommandWait) }},
+	{"SCRIPT_PINS_FILE", false, func(c *Config, v string) error { c.ScriptPinsFile = v; return nil }},
+	{"DESTRUCTIVE_COMMANDS", false, func(c *Config, v string) error { c.DestructiveCommands = splitList(v); return nil }},
+	{"REDACTION_RULES_FILE", false, func(c *Config, v string) error { c.Redaction.RulesFile = v; return nil }},
+	{"KEEP_RAW_OUTPUT", false, func(c *Config, v string) error { return parseBool(v, &c.Redaction.KeepRawOutput) }},
+	{"NORMALIZE_OUTPUT", false, func(c *Config, v string) error { return parseBool(v, &c.Output.Normalize) }},
+	{"KEEP_ORIGINAL_OUTPUT", false, func(c *Config, v string) error { return parseBool(v, &c.Output.KeepOriginal) }},
+	{"APPROVAL_WEBHOOK_URL", false, func(c *Config, v string) error { c.Approval.WebhookURL = v; return nil }},
+	{"APPROVAL_TOKEN_SECRET", false, func(c *Config, v string) error { c.Approval.TokenSecret = v; return nil }},
+	{"APPROVAL_TOKEN", false, func(c *Config, v string) error { c.Approval.Token = v; return nil }},
+	{"APPROVAL_TIMEOUT", false, func(c *Config, v string) error { return parseDuration(v, &c.Approval.Timeout) }},
+	{"APPROVAL_EXEMPT_READ_ONLY", false, func(c *Config, v string) error { return parseBool(v, &c.Approval.ExemptReadOnly) }},
+	{"SIGNING_KEY", false, func(c *Config, v string) error { c.Signing.Key = v; return nil }},
+	{"SIGNING_CERT", false, func(c *Config, v string) error { c.Signing.Cert = v; return nil }},
+	{"RECEIPT_PATH", false, func(c *Config, v string) error { c.Receipt.Path = v; return nil }},
+	{"ARCHIVE_MAX_BYTES", false, func(c *Config, v string) error {
+		maxBytes, err := strconv.ParseInt(v, 10, 64)
+		c.Archive.MaxBytes = maxBytes
+		return err
+	}},
+	{"THROTTLE_JITTER", false, func(c *Config, v string) error { return parseDuration(v, &c.Throttle.Jitter) }},
+	{"THROTTLE_PAUSE_ISSUANCE", false, func(c *Config, v string) error { return parseBool(v, &c.Throttle.PauseIssuance) }},
+	{"RUN_DIRS_ENABLED", false, func(c *Config, v string) error { return parseBool(v, &c.RunDirs.Enabled) }},
+	{"RUN_DIRS_ON_LOCKED", false, func(c *Config, v string) error { c.RunDirs.OnLocked = strings.ToLower(v); return nil }},
+	{"RUN_DIRS_WAIT", false, func(c *Config, v string) error { return parseDuration(v, &c.RunDirs.Wait) }},
+	{"SANDBOX_ENABLED", false, func(c *Config, v string) error { return parseBool(v, &c.Sandbox.Enabled) }},
+	{"SANDBOX_ENVIRONMENT_ID", false, func(c *Config, v string) error { return parseInt(v, &c.Sandbox.EnvironmentID) }},
+	{"CONCURRENCY_HOSTS", false, func(c *Config, v string) error { return parseInt(v, &c.Concurrency.Hosts) }},
+	{"CONCURRENCY_DOWNLOADS", false, func(c *Config, v string) error { return parseInt(v, &c.Concurrency.Downloads) }},
+	{"CONCURRENCY_SINK_DELIVERIES", false, func(c *Config, v string) error { return parseInt(v, &c.Concurrency.SinkDeliveries) }},
+	{"CONCURRENCY_POST_PROCESSORS", false, func(c *Config, v string) error { return parseInt(v, &c.Concurrency.PostProcessors) }},
+	{"CONCURRENCY_API_RATE", false, func(c *Config, v string) error {
+		rate, err := strconv.ParseFloat(v, 64)
+		c.Concurrency.APIRate = rate
+		return err
+	}},
+	{"MAX_PARALLELISM", false, func(c *Config, v string) error { return parseInt(v, &c.Concurrency.MaxParallelism) }},
+	{"ARCHIVE_CLEANUP", false, func(c *Config, v string) error { return parseBool(v, &c.Archive.Cleanup) }},
+	{"CASE_ID", false, func(c *Config, v string) error { c.CaseID = v; return nil }},
+	{"RUN_OPERATOR", false, func(c *Config, v string) error { c.Operator = v; return nil }},
+	{"RUN_REASON", false, func(c *Config, v string) error { c.Reason = v; return nil }},
+	{"TICKET_URL", false, func(c *Config, v string) error { c.TicketURL = v; return nil }},
+	{"NAMING_ARTIFACT", false, func(c *Config, v string) error { c.Naming.Artifact = v; return nil }},
+	{"NAMING_OUTPUT", false, func(c *Config, v string) error { c.Naming.Output = v; return nil }},
+	{"NAMING_REPORT", false, func(c *Config, v string) error { c.Naming.Report = v; return nil }},
+	{"VCR_MODE", false, func(c *Config, v string) error { c.VCR.Mode = strings.ToLower(v); return nil }},
+	{"VCR_CASSETTE", false, func(c *Config, v string) error { c.VCR.Cassette = v; return nil }},
+	{"VCR_ANONYMIZE_IDS", false, func(c *Config, v string) error { return parseBool(v, &c.VCR.AnonymizeIDs) }},
+	{"SIMULATION_ENABLED", false, func(c *Config, v string) error { return parseBool(v, &c.Simulation.Enabled) }},
+	{"SIMULATION_SEED", false, func(c *Config, v string) error {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		c.Simulation.Seed = seed
+		return err
+	}},
+	{"SMTP_HOST", false, func(c *Config, v string) error { c.SMTP.Host = v; return nil }},
+	{"SMTP_PORT", false, func(c *Config, v string) error { return parseInt(v, &c.SMTP.Port) }},
+	{"SMTP_TLS_MODE", false, func(c *Config, v string) error { c.SMTP.TLSMode = strings.ToLower(v); return nil }},
+	{"SMTP_INSECURE_SKIP_VERIFY", false, func(c *Config, v string) error { return parseBool(v, &c.SMTP.InsecureSkipVerify) }},
+	{"SMTP_USERNAME", false, func(c *Config, v string) error { c.SMTP.Username = v; return nil }},
+	{"SMTP_PASSWORD", false, func(c *Config, v string) error { c.SMTP.Password = v; return nil }},
+	{"SMTP_FROM", false, func(c *Config, v string) error { c.SMTP.From = v; return nil }},
+	{"SMTP_TO_SUCCESS", false, func(c *Config, v string) error { c.SMTP.SuccessRecipients = splitList(v); return nil }},
+	{"SMTP_TO_FAILURE", false, func(c *Config, v string) error { c.SMTP.FailureRecipients = splitList(v); return nil }},
+	{"SMTP_SUBJECT_TEMPLATE", false, func(c *Config, v string) error { c.SMTP.SubjectTemplate = v; return nil }},
+	{"SMTP_ATTACH_MAX_BYTES", false, func(c *Config, v string) error { return parseInt(v, &c.SMTP.AttachMaxBytes) }},
+}
+
+// applyEnv overlays every set environment variable onto cfg. When the
+// selected profile supplies credentials, credential and endpoint variables
+// (typically left over from a .env file) are ignored so a run can never
+// silently switch to another tenant.
+func applyEnv(cfg *Config, profileCredentials bool) error {
+	for _, override := range envOverrides {
+		value, ok := os.LookupEnv(override.name)
+		if !ok || value == "" {
+			continue
+		}
+		if override.credential && profileCredentials {
+			cfg.Notices = append(cfg.Notices, fmt.Sprintf("ignoring %s because profile %q defines its own credentials.", override.name, cfg.Profile))
+			continue
+		}
+		if err := override.apply(cfg, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", override.name, err)
+		}
+	}
+	return nil
+}
+
+// normalizeDeviceIDs lowercases and trims the device IDs the run targets,
+// as the API reports them lowercase and results are keyed by them.
+func (c *Config) normalizeDeviceIDs() {
+	c.DeviceID = strings.ToLower(strings.TrimSpace(c.DeviceID))
+	for i, id := range c.FollowHosts {
+		c.FollowHosts[i] = strings.ToLower(strings.TrimSpace(id))
+	}
+}
+
+// applyFlags overlays command-line flags onto cfg.
+func applyFlags(cfg *Config, flags Flags) {
+	if flags.DeviceID != "" {
+		cfg.DeviceID = flags.DeviceID
+	}
+	if flags.ScriptName != "" {
+		cfg.ScriptName = flags.ScriptName
+	}
+	if flags.BaseURL != "" {
+		cfg.BaseURL = flags.BaseURL
+	}
+	if flags.MemberCID != "" {
+		cfg.MemberCID = flags.MemberCID
+	}
+	if flags.OutputDir != "" {
+		cfg.OutputDir = flags.OutputDir
+	}
+	if flags.TargetHostname != "" {
+		cfg.Target.Hostname = flags.TargetHostname
+	}
+	if flags.TargetMatch != "" {
+		cfg.Target.Match = flags.TargetMatch
+	}
+	if flags.TargetFilter != "" {
+		cfg.Target.Filter = flags.TargetFilter
+	}
+	if flags.TargetCaseSensitive {
+		cfg.Target.CaseSensitive = true
+	}
+	if flags.TargetSerials != "" {
+		cfg.Target.Serials = splitList(flags.TargetSerials)
+	}
+	if flags.TargetMACs != "" {
+		cfg.Target.MACs = splitList(flags.TargetMACs)
+	}
+	if flags.TargetIdentifiers != "" {
+		cfg.Target.IdentifiersFile = flags.TargetIdentifiers
+	}
+	if flags.ApprovalToken != "" {
+		cfg.Approval.Token = flags.ApprovalToken
+	}
+	if flags.FailOnWarnings != 0 {
+		cfg.FailOnWarnings = flags.FailOnWarnings
+	}
+	cfg.ForceDestructive = flags.ForceDestructive
+	cfg.Follow = flags.Follow || flags.FollowHosts != ""
+	if flags.FollowHosts != "" {
+		cfg.FollowHosts = splitList(flags.FollowHosts)
+	}
+	cfg.NoHints = flags.NoHints
+	cfg.IncludeQuarantined = flags.IncludeQuarantined
+	cfg.TUI = flags.TUI
+	if flags.CaseID != "" {
+		cfg.CaseID = flags.CaseID
+	}
+	if flags.Operator != "" {
+		cfg.Operator = flags.Operator
+	}
+	if flags.Reason != "" {
+		cfg.Reason = flags.Reason
+	}
+	if flags.TicketURL != "" {
+		cfg.TicketURL = flags.TicketURL
+	}
+	if flags.MaxParallelism != 0 {
+		cfg.Concurrency.MaxParallelism = flags.MaxParallelism
+	}
+}
+
+// Validate checks the resolved configuration and names the offending field on error.
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.ClientID == "" && !c.Simulation.Enabled {
+		problems = append(problems, "client_id is required (config file or CLIENT_ID)")
+	}
+	if c.ClientSecret == "" && !c.Simulation.Enabled {
+		problems = append(problems, "client_secret is required (config file or CLIENT_SECRET)")
+	}
+	if _, ok := Regions[c.Region]; c.Region != "" && !ok {
+		problems = append(problems, fmt.Sprintf("region %q is unknown (known: %s)", c.Region, strings.Join(regionNames(), ", ")))
+	}
+	for _, name := range c.ProfileNames() {
+		if region := c.Profiles[name].Region; region != "" {
+			if _, ok := Regions[region]; !ok {
+				problems = append(problems, fmt.Sprintf("profiles.%s.region %q is unknown (known: %s)", name, region, strings.Join(regionNames(), ", ")))
+			}
+		}
+	}
+	if parsed, err := url.Parse(c.BaseURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		problems = append(problems, fmt.Sprintf("base_url %q must be an absolute URL", c.BaseURL))
+	}
+	if c.MemberCID != "" && !cidPattern.MatchString(c.MemberCID) {
+		problems = append(problems, fmt.Sprintf("member_cid %q must be a 32-character hex CID (an optional -XX checksum suffix is allowed)", c.MemberCID))
+	}
+	if c.ExpectedCID != "" && !cidPattern.MatchString(c.ExpectedCID) {
+		problems = append(problems, fmt.Sprintf("expected_cid %q must be a 32-character hex CID (an optional -XX checksum suffix is allowed)", c.ExpectedCID))
+	}
+	for i, command := range c.DestructiveCommands {
+		if strings.TrimSpace(command) == "" {
+			problems = append(problems, fmt.Sprintf("destructive_commands[%d] is empty", i))
+		}
+	}
+	switch c.Target.Match {
+	case "glob":
+		if _, err := path.Match(c.Target.Hostname, ""); err != nil {
+			problems = append(problems, fmt.Sprintf("target.hostname %q is not a valid glob: %v", c.Target.Hostname, err))
+		}
+	case "regex":
+		if _, err := regexp.Compile(c.Target.Hostname); err != nil {
+			problems = append(problems, fmt.Sprintf("target.hostname %q is not a valid regular expression: %v", c.Target.Hostname, err))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("target.match must be glob or regex, got %q", c.Target.Match))
+	}
+	if c.Target.MaxCandidates <= 0 {
+		problems = append(problems, "target.max_candidates must be positive")
+	}
+	if c.Target.Hostname != "" && c.Target.ByIdentifier() {
+		problems = append(problems, "target.hostname cannot be combined with target.serials, target.macs or target.identifiers_file")
+	}
+	if c.ScriptName == "" {
+		problems = append(problems, "script_name must not be empty")
+	}
+	for platform, script := range c.PlatformScripts {
+		switch strings.ToLower(platform) {
+		case "windows", "linux", "mac":
+		default:
+			problems = append(problems, fmt.Sprintf("platform_scripts: unknown platform %q (want windows, linux or mac)", platform))
+		}
+		if script == "" {
+			problems = append(problems, fmt.Sprintf("platform_scripts.%s must not be empty", platform))
+		}
+	}
+	if c.ScriptTimeout < 0 || time.Duration(c.ScriptTimeout) > 10*time.Minute {
+		// runscript accepts a -Timeout of at most 600 seconds.
+		problems = append(problems, fmt.Sprintf("script_timeout must be between 0 and 10m, got %s", time.Duration(c.ScriptTimeout)))
+	}
+	if c.PassRunID && c.ScriptCommandLine != "" {
+		problems = append(problems, "pass_run_id and script_command_line both set -CommandLine; use {{.RunID}} in script_command_line instead")
+	}
+	if c.CommandWait < 0 {
+		problems = append(problems, "command_wait must not be negative")
+	}
+	if c.Continuation.Parameter != "" && !continuationParameterPattern.MatchString(c.Continuation.Parameter) {
+		problems = append(problems, fmt.Sprintf("continuation.parameter must be a parameter name such as Continuation, got %q", c.Continuation.Parameter))
+	}
+	if c.Continuation.MaxIterations < 0 {
+		problems = append(problems, "continuation.max_iterations must not be negative")
+	}
+	if c.StallWindow < 0 {
+		problems = append(problems, "stall_window must not be negative")
+	}
+	switch c.BusyPolicy {
+	case "skip", "wait", "proceed":
+	default:
+		problems = append(problems, fmt.Sprintf("busy_policy must be skip, wait or proceed, got %q", c.BusyPolicy))
+	}
+	if c.BusyWait < 0 {
+		problems = append(problems, "busy_wait must not be negative")
+	}
+	switch c.ReissuePolicy {
+	case "never", "check", "always":
+	default:
+		problems = append(problems, fmt.Sprintf("reissue_policy must be never, check or always, got %q", c.ReissuePolicy))
+	}
+	switch c.PollStrategy {
+	case "", "fixed", "exponential", "adaptive":
+	default:
+		problems = append(problems, fmt.Sprintf("poll_strategy must be fixed, exponential or adaptive, got %q", c.PollStrategy))
+	}
+	if c.APICallBudget < 0 {
+		problems = append(problems, "api_call_budget must not be negative")
+	}
+	if c.MaxResponseBytes < 0 {
+		problems = append(problems, "max_response_bytes must not be negative")
+	}
+	if c.Throttle.Jitter < 0 {
+		problems = append(problems, "throttle.jitter must not be negative")
+	}
+	if c.Archive.MaxBytes < 0 {
+		problems = append(problems, "archive.max_bytes must not be negative")
+	}
+	for _, processor := range c.PostProcess.Processors {
+		switch processor {
+		case "hashes", "strings":
+		case "yara":
+			if c.PostProcess.YARARules == "" {
+				problems = append(problems, "postprocess: the yara processor needs postprocess.yara_rules")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("postprocess.processors: unknown processor %q (want hashes, strings or yara)", processor))
+		}
+	}
+	if c.PostProcess.Concurrency < 0 || c.PostProcess.StringsMinLength < 0 {
+		problems = append(problems, "postprocess.concurrency and postprocess.strings_min_length must not be negative")
+	}
+	if c.Concurrency.Hosts < 0 || c.Concurrency.Downloads < 0 || c.Concurrency.SinkDeliveries < 0 || c.Concurrency.PostProcessors < 0 || c.Concurrency.APIRate < 0 {
+		problems = append(problems, "concurrency.hosts, downloads, sink_deliveries, post_processors and api_rate must not be negative")
+	}
+	if c.Concurrency.MaxParallelism < 0 {
+		problems = append(problems, fmt.Sprintf("max parallelism must not be negative, got %d", c.Concurrency.MaxParallelism))
+	}
+	if c.Concurrency.PostProcessors > 0 && c.PostProcess.Concurrency > 0 && c.Concurrency.PostProcessors != c.PostProcess.Concurrency {
+		problems = append(problems, fmt.Sprintf("concurrency.post_processors (%d) and postprocess.concurrency (%d) disagree; set only concurrency.post_processors",
+			c.Concurrency.PostProcessors, c.PostProcess.Concurrency))
+	}
+	if c.Sandbox.Enabled {
+		if c.Sandbox.MaxBytes <= 0 || c.Sandbox.EnvironmentID <= 0 || c.Sandbox.Timeout <= 0 {
+			problems = append(problems, "sandbox.max_bytes, sandbox.environment_id and sandbox.timeout must be positive")
+		}
+		if c.MinimalPermissions {
+			problems = append(problems, "sandbox needs Falcon Intelligence Sandbox and sample upload write scopes, which minimal_permissions does not use")
+		}
+	}
+	if c.RunDirs.Enabled && c.OutputDir == "" {
+		problems = append(problems, "run_dirs needs output_dir")
+	}
+	if c.Prerequisites.MinFreeDiskMB < 0 || c.Prerequisites.MinFreeMemoryMB < 0 || c.Prerequisites.Timeout < 0 {
+		problems = append(problems, "prerequisites.min_free_disk_mb, prerequisites.min_free_memory_mb and prerequisites.timeout must not be negative")
+	}
+	switch c.Prerequisites.OnProbeFailure {
+	case "", "proceed", "skip":
+	default:
+		problems = append(problems, fmt.Sprintf("prerequisites.on_probe_failure must be proceed or skip, got %q", c.Prerequisites.OnProbeFailure))
+	}
+	if c.HostClock.Timeout < 0 {
+		problems = append(problems, "host_clock.timeout must not be negative")
+	}
+	switch c.Inventory.Format {
+	case "", "json", "csv":
+	default:
+		problems = append(problems, fmt.Sprintf("inventory.format must be json or csv, got %q", c.Inventory.Format))
+	}
+	for platform := range c.Prerequisites.Commands {
+		switch platform {
+		case "windows", "linux", "mac":
+		default:
+			problems = append(problems, fmt.Sprintf("prerequisites.commands: unknown platform %q (want windows, linux or mac)", platform))
+		}
+	}
+	if c.CircuitBreaker.Failures < 0 || c.CircuitBreaker.QuarantineTTL < 0 {
+		problems = append(problems, "circuit_breaker.failures and circuit_breaker.quarantine_ttl must not be negative")
+	}
+	switch c.RunDirs.OnLocked {
+	case "", "wait", "new", "abort":
+	default:
+		problems = append(problems, fmt.Sprintf("run_dirs.on_locked must be wait, new or abort, got %q", c.RunDirs.OnLocked))
+	}
+	if c.RunDirs.Wait < 0 {
+		problems = append(problems, "run_dirs.wait must not be negative")
+	}
+	if c.FailOnWarnings < 0 || c.FailOnWarnings > 1 {
+		problems = append(problems, fmt.Sprintf("fail_on_warnings must be a fraction between 0 and 1, got %v", c.FailOnWarnings))
+	}
+	if c.SinkDrainTimeout < 0 {
+		problems = append(problems, "sink_drain_timeout must not be negative")
+	}
+	if c.Approval.WebhookURL != "" {
+		if parsed, err := url.Parse(c.Approval.WebhookURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("approval.webhook_url %q must be an absolute URL", c.Approval.WebhookURL))
+		}
+	}
+	if c.Approval.Timeout <= 0 {
+		problems = append(problems, "approval.timeout must be positive")
+	}
+	if c.Signing.Cert != "" && c.Signing.Key == "" {
+		problems = append(problems, "signing.cert needs signing.key")
+	}
+	if c.Receipt.Path != "" && c.Signing.Key == "" {
+		problems = append(problems, "receipt.path needs signing.key to sign the receipt with")
+	}
+	values := c.metadataValues()
+	for _, field := range sortedPolicyFields(c.MetadataPolicy) {
+		value, known := values[field]
+		if !known {
+			problems = append(problems, fmt.Sprintf("metadata_policy: unknown field %q (known: case_id, operator, reason, ticket_url)", field))
+			continue
+		}
+		pattern := c.MetadataPolicy[field].Pattern
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("metadata_policy.%s.pattern: %v", field, err))
+		} else if value != "" && !re.MatchString(value) {
+			problems = append(problems, fmt.Sprintf("%s %q does not match the metadata policy pattern %s", field, value, pattern))
+		}
+	}
+	for _, template := range []struct{ key, text string }{
+		{"naming.artifact", c.Naming.Artifact},
+		{"naming.output", c.Naming.Output},
+		{"naming.report", c.Naming.Report},
+	} {
+		parsed, err := naming.Parse(template.text)
+		if err == nil {
+			// The case ID is known now; a template may depend on nothing else.
+			fields := naming.Sample()
+			fields.CaseID = c.CaseID
+			_, err = parsed.Resolve(fields)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", template.key, err))
+		}
+	}
+
+	if c.SMTP.Host != "" {
+		if c.SMTP.TLSMode != "starttls" && c.SMTP.TLSMode != "implicit" {
+			problems = append(problems, fmt.Sprintf("smtp.tls_mode must be starttls or implicit, got %q", c.SMTP.TLSMode))
+		}
+		if c.SMTP.From == "" {
+			problems = append(problems, "smtp.from is required when smtp.host is set")
+		}
+		if len(c.SMTP.SuccessRecipients) == 0 && len(c.SMTP.FailureRecipients) == 0 {
+			problems = append(problems, "smtp.to_success or smtp.to_failure is required when smtp.host is set")
+		}
+	}
+
+	if c.Simulation.Enabled {
+		if c.Simulation.LineInterval < 0 {
+			problems = append(problems, "simulation.line_interval must not be negative")
+		}
+		if c.Simulation.FailureRate < 0 || c.Simulation.FailureRate > 1 {
+			problems = append(problems, fmt.Sprintf("simulation.failure_rate must be between 0 and 1, got %v", c.Simulation.FailureRate))
+		}
+		if c.Simulation.ThrottleRate < 0 || c.Simulation.ThrottleRate > 1 {
+			problems = append(problems, fmt.Sprintf("simulation.throttle_rate must be between 0 and 1, got %v", c.Simulation.ThrottleRate))
+		}
+		if c.VCR.Mode != "" {
+			problems = append(problems, "simulation and vcr cannot be used together")
+		}
+		for _, scope := range c.Simulation.Scopes {
+			if !simulate.ValidScope(scope) {
+				problems = append(problems, fmt.Sprintf("simulation.scopes: unknown scope %q (want %s, %s, %s, %s, %s, %s or %s)",
+					scope, simulate.ScopeHostsRead, simulate.ScopeRTRRead, simulate.ScopeRTRWrite, simulate.ScopeRTRAdmin, simulate.ScopeSensorUpdatePolicies,
+					simulate.ScopeSandbox, simulate.ScopeSampleUploads))
+			}
+		}
+	}
+	if c.VCR.Mode != "" {
+		if c.VCR.Mode != "record" && c.VCR.Mode != "replay" {
+			problems = append(problems, fmt.Sprintf("vcr.mode must be record or replay, got %q", c.VCR.Mode))
+		}
+		if c.VCR.Cassette == "" {
+			problems = append(problems, "vcr.cassette is required when vcr.mode is set")
+		}
+	}
+
+	registered := map[string]bool{}
+	for _, t := range sink.RegisteredTypes() {
+		registered[t] = true
+	}
+	for i, spec := range c.Sinks {
+		switch {
+		case spec.Type == "":
+			problems = append(problems, fmt.Sprintf("sinks[%d].type is required", i))
+		case !registered[spec.Type]:
+			problems = append(problems, fmt.Sprintf("sinks[%d].type %q is not a registered sink type (registered: %s)",
+				i, spec.Type, strings.Join(sink.RegisteredTypes(), ", ")))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// Metadata returns the run's attribution, or nil when none is set.
+func (c *Config) Metadata() *sink.Metadata {
+	metadata := &sink.Metadata{CaseID: c.CaseID, Operator: c.Operator, Reason: c.Reason, TicketURL: c.TicketURL}
+	if *metadata == (sink.Metadata{}) {
+		return nil
+	}
+	return metadata
+}
+
+// CheckMetadata refuses a collection run that lacks metadata the policy
+// requires. Validate has already checked the formats; the requirement is
+// checked apart so other commands run without the attribution.
+func (c *Config) CheckMetadata() error {
+	values := c.metadataValues()
+	var missing []string
+	for _, field := range sortedPolicyFields(c.MetadataPolicy) {
+		if c.MetadataPolicy[field].Required && values[field] == "" {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the metadata policy requires %s (flags --%s)", strings.Join(missing, ", "), strings.ReplaceAll(strings.Join(missing, ", --"), "_", "-"))
+	}
+	return nil
+}
+
+// metadataValues maps the metadata_policy field names to their values.
+func (c *Config) metadataValues() map[string]string {
+	return map[string]string{"case_id": c.CaseID, "operator": c.Operator, "reason": c.Reason, "ticket_url": c.TicketURL}
+}
+
+func sortedPolicyFields(policy map[string]FieldPolicy) []string {
+	fields := make([]string, 0, len(policy))
+	for field := range policy {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func regionNames() []string {
+	names := make([]string, 0, len(Regions))
+	for name := range Regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func parseDuration(value string, dst *Duration) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*dst = Duration(parsed)
+	return nil
+}
+
+func parseBool(value string, dst *bool) error {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*dst = parsed
+	return nil
+}
+
+func parseInt(value string, dst *int) error {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*dst = parsed
+	return nil
+}
+
+// splitList parses a comma-separated list, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// isolateEnv clears every variable Load reads, so the test sees only the
+// ones it sets, and gives it credentials.
+func isolateEnv(t *testing.T) {
+	t.Helper()
+	for _, override := range envOverrides {
+		t.Setenv(override.name, "")
+	}
+	t.Setenv("COLLECTOR_CONFIG", "")
+	t.Setenv("COLLECTOR_PROFILE", "")
+	t.Setenv("CLIENT_ID", "id")
+	t.Setenv("CLIENT_SECRET", "secret")
+}
+
+func TestTargetSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string // Config file contents; none when empty
+		env        map[string]string
+		flags      Flags
+		wantSource string
+		wantDevice string
+		wantErr    string // Load refuses the combination
+	}{
+		{name: "no source"},
+		{name: "legacy DEVICE_ID", env: map[string]string{"DEVICE_ID": " ABCDEF "}, wantSource: "device_id", wantDevice: "abcdef"},
+		{name: "device_id in the file", file: "device_id: abcdef\n", wantSource: "device_id", wantDevice: "abcdef"},
+		{name: "--device-id over DEVICE_ID", env: map[string]string{"DEVICE_ID": "abcdef"}, flags: Flags{DeviceID: "fedcba"}, wantSource: "device_id", wantDevice: "fedcba"},
+		{name: "TARGET_HOSTNAME", env: map[string]string{"TARGET_HOSTNAME": "web-*"}, wantSource: "hostname"},
+		{name: "filter alone", flags: Flags{TargetFilter: "platform_name:'Windows'"}},
+		{name: "hostname over device_id", env: map[string]string{"DEVICE_ID": "abcdef"}, flags: Flags{TargetHostname: "web-*"}, wantSource: "hostname", wantDevice: "abcdef"},
+		{name: "serials over device_id", env: map[string]string{"DEVICE_ID": "abcdef"}, flags: Flags{TargetSerials: "SN1,SN2"}, wantSource: "identifiers", wantDevice: "abcdef"},
+		{name: "MACs over device_id", env: map[string]string{"TARGET_MACS": "00:11:22:33:44:55"}, flags: Flags{DeviceID: "abcdef"}, wantSource: "identifiers", wantDevice: "abcdef"},
+		{name: "identifiers with hostname", env: map[string]string{"TARGET_HOSTNAME": "web-*"}, flags: Flags{TargetSerials: "SN1"}, wantErr: "target.hostname cannot be combined with target.serials"},
+		{name: "identifiers file", file: "device_id: abcdef\ntarget:\n  identifiers_file: hosts.txt\n", wantSource: "identifiers", wantDevice: "abcdef"},
+		{name: "--identifiers-file", flags: Flags{TargetIdentifiers: "hosts.txt"}, wantSource: "identifiers"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isolateEnv(t)
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			flags := test.flags
+			if test.file != "" {
+				flags.ConfigPath = filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(flags.ConfigPath, []byte(test.file), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg, err := Load(flags)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("Load error = %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cfg.TargetSource(); got != test.wantSource {
+				t.Errorf("TargetSource = %q, want %q", got, test.wantSource)
+			}
+			if cfg.DeviceID != test.wantDevice {
+				t.Errorf("DeviceID = %q, want %q", cfg.DeviceID, test.wantDevice)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+const maskedValue = "********"
+
+// sensitiveSettingWords marks sink settings whose values must never be printed.
+var sensitiveSettingWords = []string{"password", "secret", "token", "key", "credential", "connection_string"}
+
+// Masked returns a copy of the configuration with every secret replaced,
+// suitable for printing or attaching to bug reports.
+func (c *Config) Masked() *Config {
+	masked := *c
+	masked.ClientID = MaskID(c.ClientID)
+	masked.ClientSecret = maskSecret(c.ClientSecret)
+	masked.SMTP.Password = maskSecret(c.SMTP.Password)
+	masked.Approval.TokenSecret = maskSecret(c.Approval.TokenSecret)
+
+	if c.Profiles != nil {
+		masked.Profiles = make(map[string]Profile, len(c.Profiles))
+		for name, profile := range c.Profiles {
+			profile.ClientID = MaskID(profile.ClientID)
+			profile.ClientSecret = maskSecret(profile.ClientSecret)
+			masked.Profiles[name] = profile
+		}
+	}
+
+	masked.Sinks = make([]sink.Spec, len(c.Sinks))
+	for i, spec := range c.Sinks {
+		settings := make(map[string]interface{}, len(spec.Settings))
+		for key, value := range spec.Settings {
+			if isSensitiveSetting(key) {
+				value = maskedValue
+			}
+			settings[key] = value
+		}
+		spec.Settings = settings
+		masked.Sinks[i] = spec
+	}
+	return &masked
+}
+
+// MaskID keeps the first four characters of an identifier and masks the rest.
+func MaskID(id string) string {
+	if len(id) <= 4 {
+		return maskSecret(id)
+	}
+	return id[:4] + strings.Repeat("*", len(id)-4)
+}
+
+func maskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return maskedValue
+}
+
+func isSensitiveSetting(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range sensitiveSettingWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
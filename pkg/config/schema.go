@@ -0,0 +1,322 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaVersion is the version of the config file schema. A file declares
+// the version it was written for in schema_version; files written for a
+// newer version are refused instead of being half understood.
+const SchemaVersion = 1
+
+// durationPattern matches the Go duration strings Duration accepts.
+const durationPattern = `^(0|[-+]?(\d+(\.\d*)?|\.\d+)(ns|us|µs|ms|s|m|h)((\d+(\.\d*)?|\.\d+)(ns|us|µs|ms|s|m|h))*)$`
+
+// schemaEnums returns the allowed values of the enumerated settings, keyed
+// by their path in the file with "*" for any map key or list index. An
+// empty value leaves the setting unset and is not checked against them.
+func schemaEnums() map[string][]string {
+	reissuePolicies := []string{"never", "check", "always"}
+	return map[string][]string{
+		"region":                         regionNames(),
+		"profiles.*.region":              regionNames(),
+		"target.match":                   {"glob", "regex"},
+		"busy_policy":                    {"skip", "wait", "proceed"},
+		"poll_strategy":                  {"fixed", "exponential", "adaptive"},
+		"reissue_policy":                 reissuePolicies,
+		"reissue_commands.*":             reissuePolicies,
+		"postprocess.processors.*":       {"hashes", "strings", "yara"},
+		"prerequisites.on_probe_failure": {"proceed", "skip"},
+		"inventory.format":               {"json", "csv"},
+		"run_dirs.on_locked":             {"wait", "new", "abort"},
+		"smtp.tls_mode":                  {"starttls", "implicit"},
+		"vcr.mode":                       {"record", "replay"},
+		"simulation.devices.*.platform":  {"windows", "linux", "mac"},
+		"sinks.*.type":                   sink.RegisteredTypes(),
+	}
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// Schema returns the JSON Schema of the config file, for editors to
+// validate and complete config files with.
+func Schema() map[string]interface{} {
+	schema := typeSchema(reflect.TypeOf(Config{}), "", schemaEnums())
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = fmt.Sprintf("urn:crowdstrike-data-collector:config:v%d", SchemaVersion)
+	schema["title"] = "crowdstrike-data-collector config file"
+	properties := schema["properties"].(map[string]interface{})
+	properties["schema_version"] = map[string]interface{}{"type": "integer", "minimum": 1, "maximum": SchemaVersion}
+	return schema
+}
+
+// typeSchema returns the JSON Schema of the values of type t found at key.
+func typeSchema(t reflect.Type, key string, enums map[string][]string) map[string]interface{} {
+	if t == durationType {
+		return map[string]interface{}{"type": "string", "pattern": durationPattern}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for name, field := range schemaFields(t) {
+			properties[name] = typeSchema(field.Type, joinKey(key, name), enums)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), joinKey(key, "*"), enums)}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), joinKey(key, "*"), enums)}
+	case reflect.String:
+		schema := map[string]interface{}{"type": "string"}
+		if values, ok := enums[key]; ok {
+			schema["enum"] = append([]string{""}, values...)
+		}
+		return schema
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+// schemaFields maps the keys a struct is read from to its fields. Fields
+// never read from the file (yaml:"-") are left out.
+func schemaFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+func joinKey(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+// schemaViolation is one place where a config file departs from the schema.
+type schemaViolation struct {
+	line, column int
+	message      string
+}
+
+// schemaCheck walks a parsed config file against the schema, collecting
+// every violation rather than stopping at the first.
+type schemaCheck struct {
+	json       bool // Strings must be quoted, as JSON has no plain scalars
+	enums      map[string][]string
+	violations []schemaViolation
+	unknown    []schemaViolation
+}
+
+// checkSchema checks the document root of a config file against the
+// schema. It returns the violations, and apart from them the unknown
+// fields, both in file order.
+func checkSchema(root *yaml.Node, json bool) (violations, unknown []schemaViolation) {
+	if root.Kind == yaml.DocumentNode {
+		if len(root.Content) == 0 {
+			return nil, nil
+		}
+		root = root.Content[0]
+	}
+	check := &schemaCheck{json: json, enums: schemaEnums()}
+	if root.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value == "schema_version" {
+				check.version(root.Content[i+1])
+			}
+		}
+	}
+	check.node(root, reflect.TypeOf(Config{}), "", "")
+	sortViolations(check.violations)
+	sortViolations(check.unknown)
+	return check.violations, check.unknown
+}
+
+// version checks the schema_version the file declares.
+func (c *schemaCheck) version(node *yaml.Node) {
+	version, err := strconv.Atoi(node.Value)
+	if node.Kind != yaml.ScalarNode || node.Tag != "!!int" || err != nil {
+		c.fail(node, "schema_version", fmt.Sprintf("an integer from 1 to %d", SchemaVersion))
+		return
+	}
+	if version < 1 || version > SchemaVersion {
+		c.violations = append(c.violations, schemaViolation{node.Line, node.Column,
+			fmt.Sprintf("schema_version: %d is not supported; this collector reads versions 1 to %d", version, SchemaVersion)})
+	}
+}
+
+// node checks node, found at field (as written, for messages) and key (with
+// "*" for map keys and list indexes, for enums), against type t.
+func (c *schemaCheck) node(node *yaml.Node, t reflect.Type, field, key string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return // Decodes to the zero value, as if the key were absent
+	}
+	if t == durationType {
+		if _, err := time.ParseDuration(node.Value); node.Kind != yaml.ScalarNode || err != nil || (c.json && node.Tag != "!!str") {
+			c.fail(node, field, "a duration such as 30s or 5m")
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			c.fail(node, field, "a mapping")
+			return
+		}
+		fields := schemaFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name, value := node.Content[i], node.Content[i+1]
+			if field == "" && name.Value == "schema_version" {
+				continue // Checked by version
+			}
+			structField, ok := fields[name.Value]
+			if !ok {
+				message := joinKey(field, name.Value) + ": unknown field"
+				if suggestion := closestField(name.Value, fields); suggestion != "" {
+					message += fmt.Sprintf(" (did you mean %s?)", suggestion)
+				}
+				c.unknown = append(c.unknown, schemaViolation{name.Line, name.Column, message})
+				continue
+			}
+			c.node(value, structField.Type, joinKey(field, name.Value), joinKey(key, name.Value))
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			c.fail(node, field, "a mapping")
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			c.node(node.Content[i+1], t.Elem(), joinKey(field, node.Content[i].Value), joinKey(key, "*"))
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			c.fail(node, field, "a list")
+			return
+		}
+		for i, item := range node.Content {
+			c.node(item, t.Elem(), fmt.Sprintf("%s[%d]", field, i), joinKey(key, "*"))
+		}
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode || (c.json && node.Tag != "!!str") {
+			c.fail(node, field, "a string")
+			return
+		}
+		if values, ok := c.enums[key]; ok && node.Value != "" && !contains(values, node.Value) {
+			c.fail(node, field, "one of "+strings.Join(values, ", "))
+		}
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			c.fail(node, field, "true or false")
+		}
+	case reflect.Int, reflect.Int64:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			c.fail(node, field, "an integer")
+		}
+	case reflect.Float64:
+		if node.Kind != yaml.ScalarNode || (node.Tag != "!!int" && node.Tag != "!!float") {
+			c.fail(node, field, "a number")
+		}
+	}
+}
+
+// fail records that the value of node at field is not what was expected.
+func (c *schemaCheck) fail(node *yaml.Node, field, expected string) {
+	var got string
+	switch node.Kind {
+	case yaml.MappingNode:
+		got = "a mapping"
+	case yaml.SequenceNode:
+		got = "a list"
+	default:
+		got = strconv.Quote(node.Value)
+	}
+	c.violations = append(c.violations, schemaViolation{node.Line, node.Column,
+		fmt.Sprintf("%s: got %s, expected %s", field, got, expected)})
+}
+
+func sortViolations(violations []schemaViolation) {
+	sort.SliceStable(violations, func(i, j int) bool {
+		if violations[i].line != violations[j].line {
+			return violations[i].line < violations[j].line
+		}
+		return violations[i].column < violations[j].column
+	})
+}
+
+// formatViolations renders violations as path:line:column: message, one per line.
+func formatViolations(path string, violations []schemaViolation) string {
+	lines := make([]string, len(violations))
+	for i, violation := range violations {
+		lines[i] = fmt.Sprintf("%s:%d:%d: %s", path, violation.line, violation.column, violation.message)
+	}
+	return strings.Join(lines, "\n  - ")
+}
+
+// closestField returns the known field name is most likely a misspelling
+// of, or "" when none is close.
+func closestField(name string, fields map[string]reflect.StructField) string {
+	best, bestDistance := "", 3
+	for field := range fields {
+		if distance := editDistance(name, field); distance < bestDistance || (distance == bestDistance && field < best) {
+			best, bestDistance = field, distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+// Package console carries the collector's human-readable progress output.
+// It is kept apart from stdout, which a run reserves for its machine output
+// (or, without one, its human summary), so scripts wrapping the CLI can
+// parse stdout without filtering progress lines out of it.
+//
+// A Console is passed to what reports progress, such as the RTR client;
+// the package holds no state of its own, so library users decide where
+// progress goes, if anywhere.
+package console
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+)
+
+// ansiPattern matches ANSI escape sequences: CSI sequences such as colors
+// and cursor movement, and OSC sequences such as terminal titles.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)`)
+
+// Console writes progress output. It is safe for concurrent use. A nil
+// *Console writes nothing.
+type Console struct {
+	mu      sync.Mutex
+	out     io.Writer
+	quiet   bool
+	noColor bool
+}
+
+// New returns a Console writing to w.
+func New(w io.Writer) *Console {
+	return &Console{out: w}
+}
+
+// SetOutput sends progress output to w.
+func (c *Console) SetOutput(w io.Writer) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.out = w
+}
+
+// Output returns where progress output goes, so that it can be restored
+// after a SetOutput.
+func (c *Console) Output() io.Writer {
+	if c == nil {
+		return io.Discard
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.out
+}
+
+// SetQuiet suppresses all progress output when on is true.
+func (c *Console) SetQuiet(on bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.quiet = on
+}
+
+// SetNoColor strips ANSI escape sequences, such as those in script output,
+// from progress output when on is true.
+func (c *Console) SetNoColor(on bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.noColor = on
+}
+
+// Printf writes a progress line formatted like fmt.Printf.
+func (c *Console) Printf(format string, args ...interface{}) {
+	if c == nil {
+		return
+	}
+	c.write(fmt.Sprintf(format, args...))
+}
+
+// Println writes a progress line formatted like fmt.Println.
+func (c *Console) Println(args ...interface{}) {
+	if c == nil {
+		return
+	}
+	c.write(fmt.Sprintln(args...))
+}
+
+// Writer returns a writer for progress output, for code that renders
+// tables or other multi-line text to an io.Writer.
+func (c *Console) Writer() io.Writer {
+	if c == nil {
+		return io.Discard
+	}
+	return writer{c}
+}
+
+type writer struct{ c *Console }
+
+func (w writer) Write(p []byte) (int, error) {
+	w.c.write(string(p))
+	return len(p), nil
+}
+
+// write sends text to the progress output. Output errors are ignored, as
+// progress must never fail a run.
+func (c *Console) write(text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.quiet || c.out == nil {
+		return
+	}
+	if c.noColor {
+		text = StripANSI(text)
+	}
+	io.WriteString(c.out, text)
+}
+
+// StripANSI removes ANSI escape sequences from text.
+func StripANSI(text string) string {
+	return ansiPattern.ReplaceAllString(text, "")
+}
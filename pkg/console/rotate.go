@@ -0,0 +1,219 @@
+package console
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// RotateOptions bound a RotatingFile.
+type RotateOptions struct {
+	MaxBytes int64 // Rotate before a write would take the file past this size; 0 never rotates
+	MaxFiles int   // Rotated files kept as path.1 (newest) to path.N; older ones are removed. 0 keeps them all
+	Compress bool  // Gzip rotated files to path.N.gz
+}
+
+// RotatingFile is a log file that is rotated by size. It is safe for
+// concurrent writers, such as the progress output and the standard logger
+// sharing one file: each Write lands whole in either the old or the new
+// file, never split across them. The file is closed before it is renamed,
+// as Windows does not allow renaming a file that is open, and reopened
+// afterwards; when a rename fails all the same, writing goes on in the
+// current file and rotation is tried again once it has grown by MaxBytes.
+// When the file cannot be reopened, writes go to stderr until it can.
+type RotatingFile struct {
+	mu           sync.Mutex
+	path         string
+	opts         RotateOptions
+	file         *os.File // nil once closed, or while it cannot be reopened
+	closed       bool
+	reopenFailed bool // Reported on stderr, once until the file is reopened
+	size         int64
+	limit        int64 // Size at which the next write rotates
+	rotations    int
+}
+
+// OpenRotating opens path for appending, creating it if needed.
+func OpenRotating(path string, opts RotateOptions) (*RotatingFile, error) {
+	if opts.MaxBytes < 0 || opts.MaxFiles < 0 {
+		return nil, fmt.Errorf("log rotation limits must not be negative")
+	}
+	f := &RotatingFile{path: path, opts: opts, limit: opts.MaxBytes}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Path returns the path of the active log file.
+func (f *RotatingFile) Path() string {
+	return f.path
+}
+
+// Rotations returns how many times the file has been rotated.
+func (f *RotatingFile) Rotations() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotations
+}
+
+// Write appends p, rotating the file first when p would take it past
+// MaxBytes. A file that is empty is never rotated, however long p is.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.file != nil && f.opts.MaxBytes > 0 && f.size > 0 && f.size+int64(len(p)) > f.limit {
+		f.rotate()
+	}
+	if f.file == nil && !f.reopen() {
+		return os.Stderr.Write(p)
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the active file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// rotate closes the active file and shifts it into path.1; the next write
+// reopens path. A failed shift is reported on stderr, as progress output
+// may be this very file, and the current file is kept.
+func (f *RotatingFile) rotate() {
+	f.file.Close()
+	f.file = nil
+	if err := f.shift(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: log rotation of %s failed, continuing in the same file: %v\n", f.path, err)
+		f.limit = f.size + f.opts.MaxBytes
+		return
+	}
+	f.limit = f.opts.MaxBytes
+	f.rotations++
+}
+
+// reopen opens path again after a rotation closed it, and reports whether
+// it could. The first failure is reported on stderr, which takes the writes
+// until path can be opened, so that nothing logged is lost.
+func (f *RotatingFile) reopen() bool {
+	err := f.open()
+	if err == nil {
+		f.reopenFailed = false
+		return true
+	}
+	if !f.reopenFailed {
+		fmt.Fprintf(os.Stderr, "Warning: log file %s could not be reopened after rotation, writing the log to stderr until it can be: %v\n", f.path, err)
+		f.reopenFailed = true
+	}
+	return false
+}
+
+// shift renames path.N-1 to path.N down to path to path.1, removing what
+// falls beyond MaxFiles, and compresses path.1 when Compress is set. With
+// MaxFiles 0 nothing is removed: every rotated file moves up one.
+func (f *RotatingFile) shift() error {
+	keep := f.opts.MaxFiles
+	if keep == 0 {
+		keep = 1
+		for exists(f.backup(keep)) {
+			keep++
+		}
+	} else if err := removeIfExists(f.backup(keep)); err != nil {
+		return err
+	}
+	for n := keep - 1; n >= 1; n-- {
+		if err := renameIfExists(f.backup(n), f.backup(n+1)); err != nil {
+			return err
+		}
+	}
+	if !f.opts.Compress {
+		return os.Rename(f.path, f.backup(1))
+	}
+	// The active file is compressed in place of a rename, then removed.
+	if err := gzipFile(f.path, f.backup(1)); err != nil {
+		return err
+	}
+	return os.Remove(f.path)
+}
+
+// backup names the nth rotated file.
+func (f *RotatingFile) backup(n int) string {
+	name := fmt.Sprintf("%s.%d", f.path, n)
+	if f.opts.Compress {
+		name += ".gz"
+	}
+	return name
+}
+
+// gzipFile writes a gzip copy of src to dst.
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(out)
+	_, err = io.Copy(writer, in)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func renameIfExists(from, to string) error {
+	if err := os.Rename(from, to); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
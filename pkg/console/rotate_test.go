@@ -0,0 +1,217 @@
+package console
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// readLog returns the content of a log file, gunzipped if it ends in .gz,
+// or "" when it does not exist.
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		r = gz
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFileBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collector.log")
+	f, err := OpenRotating(path, RotateOptions{MaxBytes: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range []string{"one\n", "two\n", "three\n", "a line longer than the limit\n", "four\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A write that would pass 10 bytes rotates first; one longer than the
+	// limit still lands whole, in a file of its own.
+	want := map[string]string{
+		path:        "four\n",
+		path + ".1": "a line longer than the limit\n",
+		path + ".2": "three\n",
+		path + ".3": "one\ntwo\n",
+	}
+	for name, content := range want {
+		if got := readLog(t, name); got != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, content)
+		}
+	}
+	if f.Rotations() != 3 {
+		t.Errorf("%d rotations, want 3", f.Rotations())
+	}
+}
+
+func TestRotatingFileAppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collector.log")
+	if err := os.WriteFile(path, []byte("earlier\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenRotating(path, RotateOptions{MaxBytes: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fmt.Fprint(f, "later\n")
+	if got := readLog(t, path+".1"); got != "earlier\n" {
+		t.Errorf("rotated file %q, want the earlier content counted against the limit", got)
+	}
+	if got := readLog(t, path); got != "later\n" {
+		t.Errorf("active file %q, want %q", got, "later\n")
+	}
+}
+
+func TestRotatingFileRetention(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     RotateOptions
+		want     []string // Files left after 5 rotations, the active one first
+		contents []string // Their contents, by the same index
+	}{
+		{
+			name:     "max files",
+			opts:     RotateOptions{MaxBytes: 1, MaxFiles: 2},
+			want:     []string{"", ".1", ".2"},
+			contents: []string{"5\n", "4\n", "3\n"},
+		},
+		{
+			name:     "keep all",
+			opts:     RotateOptions{MaxBytes: 1},
+			want:     []string{"", ".1", ".2", ".3", ".4", ".5"},
+			contents: []string{"5\n", "4\n", "3\n", "2\n", "1\n", "0\n"},
+		},
+		{
+			name:     "compressed",
+			opts:     RotateOptions{MaxBytes: 1, MaxFiles: 3, Compress: true},
+			want:     []string{"", ".1.gz", ".2.gz", ".3.gz"},
+			contents: []string{"5\n", "4\n", "3\n", "2\n"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "collector.log")
+			f, err := OpenRotating(path, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			for i := 0; i <= 5; i++ {
+				fmt.Fprintf(f, "%d\n", i)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(test.want) {
+				var names []string
+				for _, entry := range entries {
+					names = append(names, entry.Name())
+				}
+				t.Fatalf("files %q, want %d", names, len(test.want))
+			}
+			for i, suffix := range test.want {
+				if got := readLog(t, path+suffix); got != test.contents[i] {
+					t.Errorf("collector.log%s = %q, want %q", suffix, got, test.contents[i])
+				}
+			}
+			if f.Rotations() != 5 {
+				t.Errorf("%d rotations, want 5", f.Rotations())
+			}
+		})
+	}
+}
+
+// TestRotatingFileConcurrentWrites writes from several goroutines across
+// many rotations and checks that every line lands whole, exactly once.
+func TestRotatingFileConcurrentWrites(t *testing.T) {
+	const writers, lines = 8, 200
+	dir := t.TempDir()
+	path := filepath.Join(dir, "collector.log")
+	f, err := OpenRotating(path, RotateOptions{MaxBytes: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				fmt.Fprintf(f, "writer %d line %03d\n", w, i)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]int{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		content := readLog(t, filepath.Join(dir, entry.Name()))
+		if len(content) > 512 {
+			t.Errorf("%s holds %d bytes, past the 512-byte limit", entry.Name(), len(content))
+		}
+		for _, line := range strings.SplitAfter(content, "\n") {
+			if line != "" {
+				seen[line]++
+			}
+		}
+	}
+	for w := 0; w < writers; w++ {
+		for i := 0; i < lines; i++ {
+			if line := fmt.Sprintf("writer %d line %03d\n", w, i); seen[line] != 1 {
+				t.Errorf("%q written %d times, want once", line, seen[line])
+			}
+		}
+	}
+	if len(seen) != writers*lines {
+		t.Errorf("%d distinct lines, want %d", len(seen), writers*lines)
+	}
+	if f.Rotations() == 0 {
+		t.Error("no rotations")
+	}
+	if _, err := f.Write([]byte("after close\n")); err != os.ErrClosed {
+		t.Errorf("Write after Close = %v, want os.ErrClosed", err)
+	}
+}
+
+func TestOpenRotatingRejectsNegativeLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collector.log")
+	for _, opts := range []RotateOptions{{MaxBytes: -1}, {MaxFiles: -1}} {
+		if _, err := OpenRotating(path, opts); err == nil {
+			t.Errorf("OpenRotating(%+v) succeeded, want an error", opts)
+		}
+	}
+}
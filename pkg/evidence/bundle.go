@@ -0,0 +1,221 @@
+// Package evidence builds tamper-evident bundles of a run's output: every
+// member is hashed into a manifest, the manifest carries a hash of those
+// hashes, and it can be signed so a recipient can verify the bundle later.
+package evidence
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/compression"
+)
+
+// Archive formats.
+const (
+	FormatZip   = "zip"
+	FormatTarGz = "tar.gz"
+)
+
+// Names of the bundle's own members.
+const (
+	ManifestName  = "manifest.json"
+	SignatureName = "manifest.sig"
+)
+
+// Source is one file to bundle. Name is its path inside the bundle. When
+// Content is set it is bundled instead of the file at Path.
+type Source struct {
+	Name    string
+	Path    string
+	Content []byte
+}
+
+// Member is a bundled file as listed in the manifest. Encoding names the
+// compression of a member stored compressed, from its extension; Size and
+// SHA256 are of the member as stored.
+type Member struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Manifest lists every member of a bundle. HashOfHashes is the SHA256 of
+// "<sha256>  <name>\n" for each member in name order.
+type Manifest struct {
+	Version      int       `json:"version"`
+	RunID        string    `json:"run_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	Members      []Member  `json:"members"`
+	HashOfHashes string    `json:"hash_of_hashes"`
+}
+
+// FormatFor picks the archive format from a file name.
+func FormatFor(name string) string {
+	if strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz") {
+		return FormatTarGz
+	}
+	return FormatZip
+}
+
+// Write streams sources into a zip or tar.gz archive on w, followed by the
+// manifest and, with a signer, its signature. Files are copied straight from
+// disk, so large artifacts are never held in memory.
+func Write(w io.Writer, format, runID string, sources []Source, signer *Signer) (*Manifest, error) {
+	archive, err := newArchiveWriter(w, format)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{Version: 1, RunID: runID, CreatedAt: time.Now().UTC()}
+	seen := map[string]bool{ManifestName: true, SignatureName: true}
+	for _, source := range sources {
+		if seen[source.Name] {
+			return nil, fmt.Errorf("duplicate bundle member %s", source.Name)
+		}
+		seen[source.Name] = true
+		member, err := writeSource(archive, source)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Members = append(manifest.Members, member)
+	}
+	sort.Slice(manifest.Members, func(i, j int) bool { return manifest.Members[i].Name < manifest.Members[j].Name })
+	manifest.HashOfHashes = hashOfHashes(manifest.Members)
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := writeBytes(archive, ManifestName, manifestJSON); err != nil {
+		return nil, err
+	}
+	if signer != nil {
+		signature, err := signer.Sign(manifestJSON)
+		if err != nil {
+			return nil, fmt.Errorf("manifest: %w", err)
+		}
+		signatureJSON, _ := json.MarshalIndent(signature, "", "  ")
+		if err := writeBytes(archive, SignatureName, signatureJSON); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return manifest, nil
+}
+
+func writeSource(archive archiveWriter, source Source) (Member, error) {
+	member := Member{Name: source.Name, Encoding: compression.EncodingOf(source.Name)}
+	var reader io.Reader
+	if source.Content != nil {
+		reader = bytes.NewReader(source.Content)
+		member.Size = int64(len(source.Content))
+	} else {
+		file, err := os.Open(source.Path)
+		if err != nil {
+			return member, fmt.Errorf("failed to open %s: %w", source.Path, err)
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return member, fmt.Errorf("failed to stat %s: %w", source.Path, err)
+		}
+		reader, member.Size = file, info.Size()
+	}
+
+	entry, err := archive.Create(source.Name, member.Size)
+	if err != nil {
+		return member, fmt.Errorf("failed to add %s: %w", source.Name, err)
+	}
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(entry, hash), reader)
+	if err != nil {
+		return member, fmt.Errorf("failed to add %s: %w", source.Name, err)
+	}
+	if written != member.Size {
+		return member, fmt.Errorf("%s changed size while it was being bundled", source.Name)
+	}
+	member.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return member, nil
+}
+
+func writeBytes(archive archiveWriter, name string, data []byte) error {
+	entry, err := archive.Create(name, int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	if _, err := entry.Write(data); err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	return nil
+}
+
+func hashOfHashes(members []Member) string {
+	hash := sha256.New()
+	for _, member := range members {
+		fmt.Fprintf(hash, "%s  %s\n", member.SHA256, member.Name)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// archiveWriter adds entries of a known size to an archive.
+type archiveWriter interface {
+	Create(name string, size int64) (io.Writer, error)
+	Close() error
+}
+
+func newArchiveWriter(w io.Writer, format string) (archiveWriter, error) {
+	switch format {
+	case FormatZip:
+		return &zipWriter{zip.NewWriter(w)}, nil
+	case FormatTarGz:
+		gz := gzip.NewWriter(w)
+		return &tarGzWriter{gz: gz, tar: tar.NewWriter(gz)}, nil
+	}
+	return nil, fmt.Errorf("unknown bundle format %q (want %s or %s)", format, FormatZip, FormatTarGz)
+}
+
+type zipWriter struct {
+	zip *zip.Writer
+}
+
+func (z *zipWriter) Create(name string, size int64) (io.Writer, error) {
+	return z.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+}
+
+func (z *zipWriter) Close() error {
+	return z.zip.Close()
+}
+
+type tarGzWriter struct {
+	gz  *gzip.Writer
+	tar *tar.Writer
+}
+
+func (t *tarGzWriter) Create(name string, size int64) (io.Writer, error) {
+	header := &tar.Header{Name: name, Mode: 0600, Size: size, ModTime: time.Now(), Typeflag: tar.TypeReg}
+	if err := t.tar.WriteHeader(header); err != nil {
+		return nil, err
+	}
+	return t.tar, nil
+}
+
+func (t *tarGzWriter) Close() error {
+	if err := t.tar.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
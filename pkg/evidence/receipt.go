@@ -0,0 +1,58 @@
+package evidence
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Receipt attests on a host that a collection ran there: which run, when,
+// by which collector version, and the SHA256 of the collected output.
+// Signature covers the JSON encoding of the receipt without it.
+type Receipt struct {
+	RunID            string     `json:"run_id"`
+	CID              string     `json:"cid,omitempty"`
+	DeviceID         string     `json:"device_id"`
+	CollectedAt      time.Time  `json:"collected_at"`
+	CollectorVersion string     `json:"collector_version"`
+	CollectedSHA256  string     `json:"collected_sha256"`
+	Signature        *Signature `json:"signature,omitempty"`
+}
+
+// Sign signs the receipt, replacing any previous signature.
+func (r *Receipt) Sign(signer *Signer) error {
+	unsigned := *r
+	unsigned.Signature = nil
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return fmt.Errorf("failed to encode receipt: %w", err)
+	}
+	signature, err := signer.Sign(data)
+	if err != nil {
+		return err
+	}
+	r.Signature = signature
+	return nil
+}
+
+// VerifyReceipt parses a receipt and checks its signature against key.
+func VerifyReceipt(data []byte, key crypto.PublicKey) (*Receipt, error) {
+	var receipt Receipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		return nil, fmt.Errorf("failed to parse receipt: %w", err)
+	}
+	if receipt.Signature == nil {
+		return nil, fmt.Errorf("receipt of run %s is not signed", receipt.RunID)
+	}
+	unsigned := receipt
+	unsigned.Signature = nil
+	signed, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode receipt: %w", err)
+	}
+	if err := verifySignature(key, signed, receipt.Signature); err != nil {
+		return nil, fmt.Errorf("receipt of run %s: %w", receipt.RunID, err)
+	}
+	return &receipt, nil
+}
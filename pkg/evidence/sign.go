@@ -0,0 +1,144 @@
+package evidence
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Signature is the detached signature over manifest.json stored as
+// manifest.sig. Ed25519 signs the manifest itself; RSA (PKCS #1 v1.5) and
+// ECDSA sign its SHA256. Certificate carries the signer's PEM certificate
+// when one was given.
+type Signature struct {
+	Algorithm   string `json:"algorithm"`
+	Signature   []byte `json:"signature"`
+	Certificate string `json:"certificate,omitempty"`
+}
+
+// Signer signs bundle manifests with a PEM private key.
+type Signer struct {
+	key         crypto.Signer
+	certificate string
+}
+
+// LoadSigner reads a PKCS #8, PKCS #1 or SEC 1 PEM private key (Ed25519, RSA
+// or ECDSA). certPath optionally names the matching PEM certificate, which
+// is embedded in the signature for the recipient's records.
+func LoadSigner(keyPath, certPath string) (*Signer, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s is not PEM encoded", keyPath)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", keyPath, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s has an unsupported type %T", keyPath, key)
+	}
+
+	s := &Signer{key: signer}
+	if certPath != "" {
+		certificate, err := os.ReadFile(certPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate: %w", err)
+		}
+		s.certificate = string(certificate)
+	}
+	return s, nil
+}
+
+// Sign signs data.
+func (s *Signer) Sign(data []byte) (*Signature, error) {
+	var (
+		algorithm string
+		signature []byte
+		err       error
+	)
+	switch s.key.Public().(type) {
+	case ed25519.PublicKey:
+		algorithm = "ed25519"
+		signature, err = s.key.Sign(rand.Reader, data, crypto.Hash(0))
+	case *rsa.PublicKey:
+		algorithm = "rsa-pkcs1v15-sha256"
+		digest := sha256.Sum256(data)
+		signature, err = s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case *ecdsa.PublicKey:
+		algorithm = "ecdsa-sha256"
+		digest := sha256.Sum256(data)
+		signature, err = s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", s.key.Public())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return &Signature{Algorithm: algorithm, Signature: signature, Certificate: s.certificate}, nil
+}
+
+// LoadPublicKey reads a PEM public key or certificate for verification.
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("public key %s is not PEM encoded", path)
+	}
+	if block.Type == "CERTIFICATE" {
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %s: %w", path, err)
+		}
+		return certificate.PublicKey, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// verifySignature checks signature over data with key.
+func verifySignature(key crypto.PublicKey, data []byte, signature *Signature) error {
+	digest := sha256.Sum256(data)
+	valid := false
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		valid = signature.Algorithm == "ed25519" && ed25519.Verify(key, data, signature.Signature)
+	case *rsa.PublicKey:
+		valid = signature.Algorithm == "rsa-pkcs1v15-sha256" && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature.Signature) == nil
+	case *ecdsa.PublicKey:
+		valid = signature.Algorithm == "ecdsa-sha256" && ecdsa.VerifyASN1(key, digest[:], signature.Signature)
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+	if !valid {
+		return errors.New("signature is invalid")
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package evidence
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// VerifyResult is the outcome of verifying a bundle. Problems lists every
+// mismatch found; the bundle is intact when it is empty.
+type VerifyResult struct {
+	Manifest *Manifest
+	Signed   bool // The bundle carries a signature
+	Verified bool // The signature was checked against a public key and is valid
+	Problems []string
+}
+
+// Verify re-hashes every member of the bundle at path and checks them, and
+// the hash of hashes, against its manifest. With a public key the manifest
+// signature must also be present and valid. Members are hashed as they are
+// read, so large bundles are not loaded into memory.
+func Verify(path string, publicKey crypto.PublicKey) (*VerifyResult, error) {
+	hashes := map[string]Member{}
+	var manifestJSON, signatureJSON []byte
+	visit := func(name string, r io.Reader) error {
+		switch name {
+		case ManifestName, SignatureName:
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if name == ManifestName {
+				manifestJSON = data
+			} else {
+				signatureJSON = data
+			}
+			return nil
+		}
+		hash := sha256.New()
+		size, err := io.Copy(hash, r)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		hashes[name] = Member{Name: name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}
+		return nil
+	}
+
+	var err error
+	if FormatFor(path) == FormatTarGz {
+		err = walkTarGz(path, visit)
+	} else {
+		err = walkZip(path, visit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if manifestJSON == nil {
+		return nil, fmt.Errorf("%s has no %s", path, ManifestName)
+	}
+
+	result := &VerifyResult{Manifest: &Manifest{}}
+	if err := json.Unmarshal(manifestJSON, result.Manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ManifestName, err)
+	}
+
+	listed := map[string]bool{}
+	for _, member := range result.Manifest.Members {
+		listed[member.Name] = true
+		actual, ok := hashes[member.Name]
+		switch {
+		case !ok:
+			result.Problems = append(result.Problems, fmt.Sprintf("%s is listed in the manifest but missing", member.Name))
+		case actual.SHA256 != member.SHA256 || actual.Size != member.Size:
+			result.Problems = append(result.Problems, fmt.Sprintf("%s does not match the manifest (sha256 %s, expected %s)", member.Name, actual.SHA256, member.SHA256))
+		}
+	}
+	var extra []string
+	for name := range hashes {
+		if !listed[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		result.Problems = append(result.Problems, fmt.Sprintf("%s is not listed in the manifest", name))
+	}
+	if hashOfHashes(result.Manifest.Members) != result.Manifest.HashOfHashes {
+		result.Problems = append(result.Problems, "hash_of_hashes does not match the listed members")
+	}
+
+	if signatureJSON != nil {
+		result.Signed = true
+		signature := &Signature{}
+		if err := json.Unmarshal(signatureJSON, signature); err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("%s is unreadable: %v", SignatureName, err))
+		} else if publicKey != nil {
+			if err := verifySignature(publicKey, manifestJSON, signature); err != nil {
+				result.Problems = append(result.Problems, fmt.Sprintf("%s: %v", SignatureName, err))
+			} else {
+				result.Verified = true
+			}
+		}
+	} else if publicKey != nil {
+		result.Problems = append(result.Problems, "bundle is not signed")
+	}
+	return result, nil
+}
+
+func walkZip(path string, visit func(string, io.Reader) error) error {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer reader.Close()
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		entry, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open %s in %s: %w", file.Name, path, err)
+		}
+		err = visit(file.Name, entry)
+		entry.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTarGz(path string, visit func(string, io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := visit(header.Name, reader); err != nil {
+			return err
+		}
+	}
+}
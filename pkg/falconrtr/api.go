@@ -0,0 +1,603 @@
+package falconrtr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/audit"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/console"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/naming"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/postprocess"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// UserAgent identifies the collector in API requests. The run ID is appended
+// as a comment so CrowdStrike-side logs can be tied back to a run.
+const UserAgent = "crowdstrike-data-collector"
+
+// CrowdStrikeRTRClient holds the credentials, API endpoints, token and HTTP
+// machinery for interacting with the CrowdStrike RTR API. Per-host state
+// lives on Session values, so one client can drive many sessions
+// concurrently.
+type CrowdStrikeRTRClient struct {
+	ClientID          string
+	ClientSecret      string
+	BaseURL           string
+	MemberCID         string            // MSSP child CID the token is requested for (member_cid)
+	EndpointOverrides map[string]string // Endpoint key to path, for API gateways (endpoints)
+	CommandEndpoints  map[string]string // Base command to command endpoint, overriding the classification (command_endpoints)
+	ReissuePolicy     string            // What to do after an ambiguous command post: never, check or always (reissue_policy)
+	ReissueCommands   map[string]string // Base command to reissue policy, overriding ReissuePolicy (reissue_commands)
+
+	MinimalPermissions bool // Never use Hosts Write or RTR write scopes (minimal_permissions)
+
+	RunID           string // Correlation ID stamped into the User-Agent and, optionally, the script command line
+	PassRunID       bool   // Pass the run ID to scripts as -CommandLine="-RunId <id>"
+	DefaultDeviceID string // Device from configuration (device_id); sessions carry their own
+	CaseID          string // Case the run collects for (case_id), available to file name templates
+	Operator        string // Analyst the run acts on behalf of (operator), added to the API's audit comments
+
+	CommandLine     *CommandLine // Rendered per host into the script's -CommandLine (script_command_line); replaces PassRunID
+	UninstallAudit  string       // Audit message of uninstall token reveals (uninstall_token.audit_message)
+	ForbidUninstall bool         // Refuse to reveal uninstall tokens (uninstall_token.forbid)
+
+	tokenMu     sync.RWMutex
+	accessToken string
+
+	OutputDir       string        // Directory retained outputs are written under (output_dir)
+	DownloadDir     string        // Local directory for retrieved files (download_dir)
+	ArtifactNames   *naming.Namer // Names retrieved files under DownloadDir (naming.artifact)
+	OutputNames     *naming.Namer // Names retained raw and original output files (naming.output)
+	MemdumpTimeout  time.Duration // Upper bound for memdump/xmemdump (memdump_timeout)
+	ArchiveMaxBytes int64         // Cap on what ArchiveAndGet archives and retrieves (archive.max_bytes, 0 uses DefaultArchiveMaxBytes)
+	ArchiveCleanup  bool          // Remove archives from the host after ArchiveAndGet (archive.cleanup)
+	ScriptTimeout   time.Duration // -Timeout passed to runscript (script_timeout, 0 leaves the platform default)
+	StallWindow     time.Duration // Abandon commands whose output stops advancing (stall_window, 0 disables)
+	StallRefresh    bool          // Refresh the session once before giving up on a stall (stall_refresh)
+
+	Redactor        *Redactor         // Applied to command output before it is printed or returned
+	ScriptPins      map[string]string // Pinned SHA256 of cloud scripts by name (script_pins_file), checked before they run
+	KeepRawOutput   bool              // Write unredacted output to a local file (redaction.keep_raw_output)
+	PlatformScripts map[string]string // Cloud script run instead of script_name by platform (platform_scripts)
+
+	ContinuationParameter string // Script parameter ContinueScript passes a continuation token in (continuation.parameter)
+
+	NormalizeOutput    bool // Convert Windows output to UTF-8 with LF line endings (output.normalize)
+	KeepOriginalOutput bool // Write un-normalized output bytes to a local file (output.keep_original)
+
+	Budget       *CallBudget      // Counts API calls and enforces api_call_budget
+	Throttle     *Throttle        // Pauses every poller on a 429 (throttle); nil disables the coordination
+	Rate         *RateLimit       // Spaces API requests (concurrency.api_rate); nil leaves them unlimited
+	Clock        Clock            // Times polling, timeouts, stalls and pool expiry; nil uses SystemClock
+	Metrics      *Metrics         // Instruments calls, sessions, downloads and commands for the run report
+	Breaker      *CircuitBreaker  // Stops attempting devices that keep failing (circuit_breaker); nil never opens
+	Warnings     *sink.Warnings   // Collects warnings not tied to a session; nil only prints them
+	Console      *console.Console // Progress output; nil prints none
+	PollStrategy PollStrategy     // Default pacing of Command.Wait (poll_strategy)
+
+	// PostProcess runs over every file DownloadSessionFile verifies
+	// (postprocess); nil skips post-processing.
+	PostProcess *postprocess.Pipeline
+
+	// Sandbox submits retrieved files to Falcon Intelligence Sandbox as
+	// the last post-processing step (sandbox); nil submits nothing.
+	Sandbox *Sandbox
+
+	// OnResponseMeta is called with the meta of every API response
+	// (WithResponseMetaHook); nil ignores it.
+	OnResponseMeta MetaHook
+
+	// Audit records sessions, uploads and secret reveals in the run's local
+	// audit log (WithAuditLog); nil records nothing.
+	Audit *audit.Log
+
+	HTTPClient       *http.Client // Reusable HTTP client
+	MaxResponseBytes int64        // Cap on JSON response bodies (max_response_bytes, 0 uses DefaultMaxResponseBytes); file downloads are streamed and not capped
+
+	hostsMu sync.Mutex
+	hosts   map[string]Host // Details of devices seen by GetHosts, for file names
+
+	capabilitiesMu sync.Mutex
+	capabilities   *Capabilities // Set by DetectCapabilities
+
+	verifiedMu sync.Mutex
+	verified   map[string]bool // Pinned scripts VerifyScript has checked
+
+	sessionsMu sync.Mutex
+	sessions   map[string]bool // IDs of the sessions this client opened, for OwnSession
+
+	downloads chan struct{} // Slots of the downloads in flight (concurrency.downloads); nil is unbounded
+}
+
+// Options configure the client NewCrowdStrikeRTRClient builds. Most fields
+// carry the collector config setting named in their comment; zero values
+// leave the defaults.
+type Options struct {
+	ClientID     string
+	ClientSecret string
+	BaseURL      string
+	MemberCID    string // member_cid
+	DeviceID     string // device_id, the device of callers that name none
+	RunID        string
+	PassRunID    bool   // pass_run_id
+	CaseID       string // case_id
+	Operator     string // operator
+
+	ScriptCommandLine string // script_command_line
+	UninstallAudit    string // uninstall_token.audit_message
+	ForbidUninstall   bool   // uninstall_token.forbid
+
+	RedactionRulesFile string // redaction.rules_file
+	KeepRawOutput      bool   // redaction.keep_raw_output
+	ScriptPinsFile     string // script_pins_file
+
+	Endpoints          map[string]string // endpoints
+	CommandEndpoints   map[string]string // command_endpoints
+	ReissuePolicy      string            // reissue_policy
+	ReissueCommands    map[string]string // reissue_commands
+	MinimalPermissions bool              // minimal_permissions
+	PollStrategy       string            // poll_strategy
+
+	ArtifactNames string // naming.artifact; "" uses naming.DefaultArtifact
+	OutputNames   string // naming.output; "" uses naming.DefaultOutput
+	OutputDir     string // output_dir
+	DownloadDir   string // download_dir
+
+	MemdumpTimeout        time.Duration     // memdump_timeout
+	ArchiveMaxBytes       int64             // archive.max_bytes
+	ArchiveCleanup        bool              // archive.cleanup
+	ScriptTimeout         time.Duration     // script_timeout
+	StallWindow           time.Duration     // stall_window
+	StallRefresh          bool              // stall_refresh
+	PlatformScripts       map[string]string // platform_scripts
+	ContinuationParameter string            // continuation.parameter
+	NormalizeOutput       bool              // output.normalize
+	KeepOriginalOutput    bool              // output.keep_original
+
+	APICallBudget    int           // api_call_budget
+	ThrottleJitter   time.Duration // throttle.jitter
+	PauseIssuance    bool          // throttle.pause_issuance
+	MaxResponseBytes int64         // max_response_bytes
+	APIRate          float64       // concurrency.api_rate
+	Downloads        int           // concurrency.downloads
+
+	PostProcessors         []postprocess.Processor // postprocess.processors; the sandbox, if any, runs after them
+	PostProcessConcurrency int                     // concurrency.post_processors
+	Sandbox                *Sandbox                // sandbox, when enabled
+	Breaker                *CircuitBreaker         // circuit_breaker, when enabled; it takes the client's Metrics
+
+	// Transport replaces the HTTP transport, e.g. with a VCR cassette or a
+	// simulated API; Simulated lets the client run without credentials.
+	Transport http.RoundTripper
+	Simulated bool
+
+	Console *console.Console // Progress output; nil prints none
+}
+
+// NewCrowdStrikeRTRClient initializes and returns a new CrowdStrikeRTRClient
+// from options and sets up API endpoints. Options are applied last.
+func NewCrowdStrikeRTRClient(options Options, opts ...Option) (*CrowdStrikeRTRClient, error) {
+	if (options.ClientID == "" || options.ClientSecret == "") && !options.Simulated {
+		return nil, fmt.Errorf("client_id and client_secret must be set in the config file or .env file")
+	}
+
+	var commandLine *CommandLine
+	if options.ScriptCommandLine != "" {
+		var err error
+		if commandLine, err = ParseCommandLine(options.ScriptCommandLine); err != nil {
+			return nil, err
+		}
+		if commandLine.NeedsUninstallToken() {
+			if options.ForbidUninstall {
+				return nil, fmt.Errorf("script_command_line uses .Secrets.UninstallToken: %w", ErrUninstallTokensForbidden)
+			}
+			if strings.TrimSpace(options.UninstallAudit) == "" {
+				return nil, fmt.Errorf("script_command_line uses .Secrets.UninstallToken: %w (uninstall_token.audit_message)", ErrAuditMessageRequired)
+			}
+		}
+	}
+
+	redactor, err := NewRedactor(options.RedactionRulesFile)
+	if err != nil {
+		return nil, err
+	}
+	scriptPins, err := LoadScriptPins(options.ScriptPinsFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateEndpointOverrides(options.Endpoints); err != nil {
+		return nil, err
+	}
+	if err := validateCommandEndpointOverrides(options.CommandEndpoints); err != nil {
+		return nil, err
+	}
+	if err := validateReissueOverrides(options.ReissueCommands); err != nil {
+		return nil, err
+	}
+	pollStrategy, err := ParsePollStrategy(options.PollStrategy)
+	if err != nil {
+		return nil, err
+	}
+	artifactNames, err := naming.Parse(orDefault(options.ArtifactNames, naming.DefaultArtifact))
+	if err != nil {
+		return nil, fmt.Errorf("naming.artifact: %w", err)
+	}
+	outputNames, err := naming.Parse(orDefault(options.OutputNames, naming.DefaultOutput))
+	if err != nil {
+		return nil, fmt.Errorf("naming.output: %w", err)
+	}
+
+	httpClient := &http.Client{
+		Timeout:   30 * time.Second, // Set a default timeout for HTTP requests
+		Transport: options.Transport,
+	}
+
+	baseURL := strings.TrimRight(options.BaseURL, "/")
+	client := &CrowdStrikeRTRClient{
+		ClientID:              options.ClientID,
+		ClientSecret:          options.ClientSecret,
+		RunID:                 options.RunID,
+		PassRunID:             options.PassRunID,
+		CommandLine:           commandLine,
+		UninstallAudit:        options.UninstallAudit,
+		ForbidUninstall:       options.ForbidUninstall,
+		DefaultDeviceID:       NormalizeDeviceID(options.DeviceID),
+		CaseID:                options.CaseID,
+		Operator:              options.Operator,
+		BaseURL:               baseURL,
+		MemberCID:             NormalizeCID(options.MemberCID),
+		EndpointOverrides:     options.Endpoints,
+		CommandEndpoints:      options.CommandEndpoints,
+		ReissuePolicy:         options.ReissuePolicy,
+		ReissueCommands:       options.ReissueCommands,
+		MinimalPermissions:    options.MinimalPermissions,
+		OutputDir:             options.OutputDir,
+		DownloadDir:           options.DownloadDir,
+		ArtifactNames:         naming.NewNamer(artifactNames),
+		OutputNames:           naming.NewNamer(outputNames),
+		MemdumpTimeout:        options.MemdumpTimeout,
+		ArchiveMaxBytes:       options.ArchiveMaxBytes,
+		ArchiveCleanup:        options.ArchiveCleanup,
+		ScriptTimeout:         options.ScriptTimeout,
+		StallWindow:           options.StallWindow,
+		StallRefresh:          options.StallRefresh,
+		Redactor:              redactor,
+		ScriptPins:            scriptPins,
+		PlatformScripts:       platformScripts(options.PlatformScripts),
+		ContinuationParameter: options.ContinuationParameter,
+		KeepRawOutput:         options.KeepRawOutput,
+		NormalizeOutput:       options.NormalizeOutput,
+		KeepOriginalOutput:    options.KeepOriginalOutput,
+		Budget:                &CallBudget{Limit: options.APICallBudget},
+		Throttle:              &Throttle{Jitter: options.ThrottleJitter, PauseIssuance: options.PauseIssuance},
+		Metrics:               &Metrics{},
+		MaxResponseBytes:      options.MaxResponseBytes,
+		PollStrategy:          pollStrategy,
+		Rate:                  newRateLimit(options.APIRate),
+		Sandbox:               options.Sandbox,
+		Console:               options.Console,
+		HTTPClient:            httpClient,
+	}
+	if options.Downloads > 0 {
+		client.downloads = make(chan struct{}, options.Downloads)
+	}
+	if options.Breaker != nil {
+		options.Breaker.Metrics = client.Metrics
+		client.Breaker = options.Breaker
+	}
+	client.PostProcess = postProcessPipeline(options.PostProcessors, options.PostProcessConcurrency, client.sandboxProcessor())
+	for _, opt := range opts {
+		opt(client)
+	}
+	return client, nil
+}
+
+// orDefault returns value, or fallback when value is empty.
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// auditComment appends the operator the run acts on behalf of to comment.
+// It is used for the free-text fields the API records in the Falcon audit
+// log, so that a shared service account's actions name the analyst.
+func (c *CrowdStrikeRTRClient) auditComment(comment string) string {
+	switch {
+	case c.Operator == "":
+		return comment
+	case comment == "":
+		return "on behalf of " + c.Operator
+	}
+	return comment + " (on behalf of " + c.Operator + ")"
+}
+
+// WithAuditLog makes the client record what it does in the tenant, and the
+// audit comments it sends, in log.
+func WithAuditLog(log *audit.Log) Option {
+	return func(c *CrowdStrikeRTRClient) {
+		c.Audit = log
+	}
+}
+
+// record appends record to the audit log, with err, when not nil, as the
+// reason the action failed.
+func (c *CrowdStrikeRTRClient) record(record audit.Record, err error) {
+	if err != nil {
+		record.Error = err.Error()
+	}
+	c.Audit.Record(record)
+}
+
+// postProcessPipeline builds the pipeline of processors, with concurrency
+// files processed at once and sandbox, when not nil, run last. It is nil
+// when there is nothing to run.
+func postProcessPipeline(processors []postprocess.Processor, concurrency int, sandbox postprocess.Processor) *postprocess.Pipeline {
+	if len(processors) == 0 && sandbox == nil {
+		return nil
+	}
+	if sandbox != nil {
+		processors = append(processors[:len(processors):len(processors)], sandbox)
+	}
+	return postprocess.New(processors, concurrency)
+}
+
+// APIError is returned by makeAPICall when the API answers with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // When a 429 said to retry, if it did
+	TraceID    string        // From the response meta or X-Cs-Traceid header
+}
+
+func (e *APIError) Error() string {
+	if e.TraceID != "" {
+		return fmt.Sprintf("API request failed with status code %d (trace_id %s): %s", e.StatusCode, e.TraceID, e.Body)
+	}
+	return fmt.Sprintf("API request failed with status code %d: %s", e.StatusCode, e.Body)
+}
+
+// DefaultMaxResponseBytes caps the JSON responses makeAPICall reads when
+// max_response_bytes is unset.
+const DefaultMaxResponseBytes = 8 << 20
+
+// ErrResponseTooLarge matches every *ResponseTooLargeError.
+var ErrResponseTooLarge = errors.New("API response too large")
+
+// ResponseTooLargeError reports a JSON response larger than the client's
+// MaxResponseBytes. The body is not read past Limit.
+type ResponseTooLargeError struct {
+	Endpoint string // Request path
+	Limit    int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("%v: %s returned more than %d bytes", ErrResponseTooLarge, e.Endpoint, e.Limit)
+}
+
+// Is reports whether target is ErrResponseTooLarge.
+func (e *ResponseTooLargeError) Is(target error) bool {
+	return target == ErrResponseTooLarge
+}
+
+// userAgent returns UserAgent with the run ID, when there is one, as a
+// comment: "crowdstrike-data-collector (run_id=<id>)".
+func (c *CrowdStrikeRTRClient) userAgent() string {
+	if c.RunID == "" {
+		return UserAgent
+	}
+	return fmt.Sprintf("%s (run_id=%s)", UserAgent, c.RunID)
+}
+
+// getHeaders constructs HTTP headers based on content type and authentication status.
+func (c *CrowdStrikeRTRClient) getHeaders(contentType string, includeAuth bool) map[string]string {
+	headers := map[string]string{
+		"accept":       "application/json",
+		"Content-Type": contentType,
+		"User-Agent":   c.userAgent(),
+	}
+	if includeAuth {
+		c.tokenMu.RLock()
+		if c.accessToken != "" {
+			headers["authorization"] = fmt.Sprintf("Bearer %s", c.accessToken)
+		}
+		c.tokenMu.RUnlock()
+	}
+	return headers
+}
+
+// makeAPICall is a generic helper to perform HTTP requests and handle responses.
+func (c *CrowdStrikeRTRClient) makeAPICall(
+	ctx context.Context,
+	method string,
+	url string,
+	headers map[string]string,
+	params url.Values, // Query parameters, encoded here; never append them to url
+	jsonPayload interface{}, // Use interface{} for generic JSON payload; []byte is sent as is
+	formData url.Values, // Use url.Values for form data
+) (map[string]interface{}, error) { // Return map[string]interface{} for generic JSON response
+	var reqBody []byte
+	var err error
+
+	if body, ok := jsonPayload.([]byte); ok {
+		// Already encoded, such as a multipart upload; headers carry its type.
+		reqBody = body
+	} else if jsonPayload != nil {
+		reqBody, err = json.Marshal(jsonPayload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal JSON payload: %w", err)
+		}
+	} else if formData != nil {
+		reqBody = []byte(formData.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	// Add headers
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	setQuery(req.URL, params)
+
+	if c.Budget != nil {
+		if err := c.Budget.allow(method, c.callCategory(method, req.URL.Path)); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Rate.Wait(ctx); err != nil {
+		return nil, err
+	}
+	c.Metrics.call(method, req.URL.Path)
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	limit := c.MaxResponseBytes
+	if limit <= 0 {
+		limit = DefaultMaxResponseBytes
+	}
+	bodyBytes, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if int64(len(bodyBytes)) > limit {
+		return nil, &ResponseTooLargeError{Endpoint: req.URL.Path, Limit: limit}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		meta := errorMeta(resp.Header, bodyBytes)
+		c.observeMeta(method, req.URL.Path, meta)
+		apiErr := &APIError{StatusCode: resp.StatusCode, Body: string(bodyBytes), TraceID: meta.TraceID}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			apiErr.RetryAfter = retryAfter(resp.Header, c.clock().Now())
+			c.Metrics.throttle()
+			if c.Throttle != nil {
+				pause := apiErr.RetryAfter
+				if pause <= 0 {
+					pause = DefaultThrottlePause
+				}
+				c.Console.Printf("API throttled %s %s: pausing status polling for %s\n", method, req.URL.Path, pause.Round(time.Millisecond))
+				c.Throttle.Pause(pause)
+			}
+		}
+		return nil, apiErr
+	}
+
+	// DELETE endpoints answer 204 No Content.
+	if len(bytes.TrimSpace(bodyBytes)) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	var result map[string]interface{}
+	err = json.Unmarshal(bodyBytes, &result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON response: %w. Response: %s", err, string(bodyBytes))
+	}
+	c.observeMeta(method, req.URL.Path, responseMeta(result))
+
+	return result, nil
+}
+
+// GetAuthToken obtains an authentication token from the CrowdStrike API.
+func (c *CrowdStrikeRTRClient) GetAuthToken() bool {
+	if err := c.Authenticate(context.Background()); err != nil {
+		c.Console.Printf("Failed to get authentication token: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// Authenticate obtains an authentication token and stores it on the client.
+func (c *CrowdStrikeRTRClient) Authenticate(ctx context.Context) error {
+	headers := c.getHeaders("application/x-www-form-urlencoded", false)
+	formData := url.Values{}
+	formData.Set("client_id", c.ClientID)
+	formData.Set("client_secret", c.ClientSecret)
+	if c.MemberCID != "" {
+		formData.Set("member_cid", c.MemberCID)
+	}
+
+	tokenInfo, err := c.makeAPICall(ctx, "POST", c.url(EndpointToken, 0), headers, nil, nil, formData)
+	if err != nil {
+		return err
+	}
+
+	if accessToken, ok := tokenInfo["access_token"].(string); ok {
+		c.tokenMu.Lock()
+		c.accessToken = accessToken
+		c.tokenMu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("access token not found in response")
+}
+
+// redactStatusResponse redacts stdout and stderr of every resource in place.
+func (c *CrowdStrikeRTRClient) redactStatusResponse(statusResponse map[string]interface{}, deviceID string) {
+	if c.Redactor == nil {
+		return
+	}
+	resources, ok := statusResponse["resources"].([]interface{})
+	if !ok {
+		return
+	}
+
+	total := map[string]int{}
+	for _, resource := range resources {
+		resourceMap, ok := resource.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, field := range []string{"stdout", "stderr"} {
+			text, ok := resourceMap[field].(string)
+			if !ok || text == "" {
+				continue
+			}
+			redacted, counts := c.Redactor.Redact(text)
+			resourceMap[field] = redacted
+			for name, n := range counts {
+				total[name] += n
+			}
+		}
+	}
+
+	if len(total) > 0 {
+		c.Console.Printf("Redacted output for device %s: %s\n", deviceID, formatRedactionCounts(total))
+	}
+}
+
+// writeRawOutput stores an unredacted status response under the output
+// directory, named from naming.output. The file is only readable by the
+// current user and is never sent anywhere.
+func (c *CrowdStrikeRTRClient) writeRawOutput(cmd *Command, statusResponse map[string]interface{}) error {
+	rawJSON, err := json.MarshalIndent(statusResponse, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal raw output: %w", err)
+	}
+	path, err := cmd.outputPath("raw-output", ".json")
+	if err != nil {
+		return fmt.Errorf("failed to name raw output file: %w", err)
+	}
+	if err := os.WriteFile(path, rawJSON, 0600); err != nil {
+		return fmt.Errorf("failed to write raw output: %w", err)
+	}
+	c.Console.Printf("Unredacted output retained locally at %s\n", path)
+	return nil
+}
@@ -0,0 +1,146 @@
+package falconrtr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc answers every request of a client with one func.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// newTestClient returns a client whose API is transport.
+func newTestClient(t *testing.T, transport http.RoundTripper) *CrowdStrikeRTRClient {
+	t.Helper()
+	client, err := NewCrowdStrikeRTRClient(Options{BaseURL: "https://api.test", Simulated: true, Transport: transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// countingReader counts the bytes read from it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestMakeAPICallCapsResponseBody(t *testing.T) {
+	small := `{"resources":["ok"]}`
+	tests := []struct {
+		name    string
+		cap     int64
+		body    string
+		tooBig  bool
+		wantCap int64
+	}{
+		{name: "under the cap", cap: 1024, body: small},
+		{name: "exactly the cap", cap: int64(len(small)), body: small},
+		{name: "one byte over", cap: int64(len(small)) - 1, body: small, tooBig: true, wantCap: int64(len(small)) - 1},
+		{name: "oversized", cap: 64, body: `{"resources":["` + strings.Repeat("x", 1<<20) + `"]}`, tooBig: true, wantCap: 64},
+		{name: "default cap", body: `{"resources":["` + strings.Repeat("x", DefaultMaxResponseBytes) + `"]}`, tooBig: true, wantCap: DefaultMaxResponseBytes},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := &countingReader{r: strings.NewReader(test.body)}
+			client := newTestClient(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(body), Request: req}, nil
+			}))
+			client.MaxResponseBytes = test.cap
+
+			response, err := client.makeAPICall(context.Background(), "GET", "https://api.test/devices/entities/devices/v2", nil, nil, nil, nil)
+			if !test.tooBig {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resources, _ := response["resources"].([]interface{}); len(resources) != 1 {
+					t.Fatalf("response %v", response)
+				}
+				return
+			}
+
+			var tooLarge *ResponseTooLargeError
+			if !errors.As(err, &tooLarge) || !errors.Is(err, ErrResponseTooLarge) {
+				t.Fatalf("err = %v, want a ResponseTooLargeError", err)
+			}
+			if tooLarge.Endpoint != "/devices/entities/devices/v2" || tooLarge.Limit != test.wantCap {
+				t.Errorf("error names %s and %d, want /devices/entities/devices/v2 and %d", tooLarge.Endpoint, tooLarge.Limit, test.wantCap)
+			}
+			if body.n > test.wantCap+1 {
+				t.Errorf("read %d bytes of the body, want at most %d", body.n, test.wantCap+1)
+			}
+		})
+	}
+}
+
+// TestKeepRawOutput serves a command whose output spans three sequences and
+// checks that the retained raw output joins them unredacted, while the
+// result is redacted, and that Status does not replace it with sequence 0.
+func TestKeepRawOutput(t *testing.T) {
+	chunks := []string{"user alice\n", "pass hunter2\n", "done\n"}
+	client := newTestClient(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sequence, _ := strconv.Atoi(req.URL.Query().Get("sequence_id"))
+		if sequence >= len(chunks) {
+			return &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{"errors":[{"message":"no such sequence"}]}`)), Request: req}, nil
+		}
+		body, _ := json.Marshal(map[string]interface{}{"resources": []interface{}{map[string]interface{}{"complete": true, "stdout": chunks[sequence], "stderr": ""}}})
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(string(body))), Request: req}, nil
+	}))
+	client.Redactor.AddSecret("password", "hunter2")
+	client.KeepRawOutput = true
+	client.OutputDir = t.TempDir()
+	session := &Session{client: client, DeviceID: "device", SessionID: "session"}
+	cmd := &Command{session: session, Endpoint: ReadOnlyCommandEndpoint, CloudRequestID: "request", PollStrategy: FixedPoll{Interval: time.Millisecond}}
+
+	result, err := cmd.Wait(context.Background(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(result.Stdout, "hunter2") || result.Sequences != 3 {
+		t.Errorf("result stdout %q from %d sequences, want 3 sequences redacted", result.Stdout, result.Sequences)
+	}
+	if _, err := cmd.Status(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	files := client.NamedFiles()
+	if len(files) != 1 {
+		t.Fatalf("named files %q, want one raw output file", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Resources []struct {
+			Stdout    string `json:"stdout"`
+			Sequences int    `json:"sequences"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(chunks, ""); len(raw.Resources) != 1 || raw.Resources[0].Stdout != want || raw.Resources[0].Sequences != 3 {
+		t.Errorf("raw output %s, want the stdout of all 3 sequences, %q", data, want)
+	}
+	if info, err := os.Stat(files[0]); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("raw output mode %v, want 0600", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,142 @@
+package falconrtr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// DefaultArchiveMaxBytes bounds ArchiveAndGet when archive.max_bytes is unset.
+const DefaultArchiveMaxBytes = 1 << 30
+
+// ErrArchiveTooLarge is returned by ArchiveAndGet when the content to
+// archive, or the archive itself, exceeds the client's ArchiveMaxBytes.
+var ErrArchiveTooLarge = errors.New("archive exceeds the size limit")
+
+// ArchivedFile is the outcome of ArchiveAndGet. EstimatedBytes sums the
+// sizes ls reports for remotePath: for a directory only the files directly
+// in it, so it is a lower bound. ArchiveBytes is the archive's size on the
+// host. Stages times each sub-step: estimate, archive, verify, retrieve and
+// cleanup.
+type ArchivedFile struct {
+	*RetrievedFile
+	SourcePath     string       `json:"source_path"`
+	RemoteArchive  string       `json:"remote_archive"`
+	EstimatedBytes int64        `json:"estimated_bytes"`
+	ArchiveBytes   int64        `json:"archive_bytes"`
+	CleanedUp      bool         `json:"cleaned_up"`
+	Stages         []sink.Stage `json:"stages,omitempty"`
+}
+
+// ArchiveAndGet archives remotePath on the host and retrieves the archive,
+// for directories of many small files that would take one get each. Windows
+// hosts use zip; Linux and macOS hosts run tar -czf through runscript. A
+// bare archiveName is created next to remotePath. The size ls reports for
+// remotePath, and then that of the archive, are checked against the
+// client's ArchiveMaxBytes before anything is retrieved. With ArchiveCleanup
+// the archive is removed from the host afterwards, whether or not the
+// retrieval succeeded.
+func (s *Session) ArchiveAndGet(ctx context.Context, remotePath, archiveName string) (*ArchivedFile, error) {
+	maxBytes := s.client.ArchiveMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultArchiveMaxBytes
+	}
+	archivePath := archiveName
+	if !strings.ContainsAny(archiveName, `\/`) {
+		parent, _ := splitRemotePath(remotePath)
+		archivePath = joinRemotePath(parent, archiveName)
+	}
+	archived := &ArchivedFile{SourcePath: remotePath, RemoteArchive: archivePath}
+	var timing sink.Timing
+	defer func() { archived.Stages = timing.Stages() }()
+
+	start := time.Now()
+	estimate, err := s.estimateSize(ctx, remotePath)
+	timing.Record("estimate", start)
+	if err != nil {
+		return archived, err
+	}
+	archived.EstimatedBytes = estimate
+	if estimate > maxBytes {
+		return archived, fmt.Errorf("%s holds at least %d bytes: %w of %d bytes", remotePath, estimate, ErrArchiveTooLarge, maxBytes)
+	}
+
+	start = time.Now()
+	err = s.createArchive(ctx, remotePath, archivePath)
+	timing.Record("archive", start)
+	if err != nil {
+		return archived, err
+	}
+	if s.client.ArchiveCleanup {
+		defer func() {
+			start := time.Now()
+			if err := s.runFileCommand(context.Background(), "rm", archivePath, "rm "+quoteArg(archivePath)); err != nil {
+				s.client.Console.Printf("Warning: failed to remove archive %s from device %s: %v\n", archivePath, s.DeviceID, err)
+			} else {
+				archived.CleanedUp = true
+			}
+			timing.Record("cleanup", start)
+		}()
+	}
+
+	start = time.Now()
+	entry, err := s.Stat(ctx, archivePath)
+	timing.Record("verify", start)
+	if err != nil {
+		return archived, fmt.Errorf("archive of %s was not created: %w", remotePath, err)
+	}
+	archived.ArchiveBytes = entry.Size
+	if entry.Size > maxBytes {
+		return archived, fmt.Errorf("archive %s is %d bytes: %w of %d bytes", archivePath, entry.Size, ErrArchiveTooLarge, maxBytes)
+	}
+	s.client.Console.Printf("Archived %s on device %s to %s (%d bytes), retrieving...\n", remotePath, s.DeviceID, archivePath, entry.Size)
+
+	start = time.Now()
+	archived.RetrievedFile, err = s.GetFile(ctx, archivePath, 0)
+	timing.Record("retrieve", start)
+	return archived, err
+}
+
+// estimateSize sums the sizes ls reports for path: the file itself, or the
+// files directly in a directory. Sizes the host does not report count as 0.
+func (s *Session) estimateSize(ctx context.Context, path string) (int64, error) {
+	entry, err := s.Stat(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	if !entry.IsDir {
+		return max(entry.Size, 0), nil
+	}
+	entries, err := s.List(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, entry := range entries {
+		total += max(entry.Size, 0)
+	}
+	return total, nil
+}
+
+// createArchive archives source to archivePath with zip on Windows, or with
+// tar through runscript elsewhere.
+func (s *Session) createArchive(ctx context.Context, source, archivePath string) error {
+	if isWindowsPath(source) {
+		return s.runFileCommand(ctx, "zip", source, "zip "+quoteArg(source)+" "+quoteArg(archivePath))
+	}
+	dir, name := splitRemotePath(source)
+	if name == "" {
+		dir, name = source, "."
+	}
+	script := fmt.Sprintf("tar -czf %s -C %s %s", shellQuote(archivePath), shellQuote(dir), shellQuote(name))
+	return s.runFileCommand(ctx, "runscript", source, "runscript -Raw=```"+script+"```")
+}
+
+// shellQuote wraps arg in single quotes for a POSIX shell.
+func shellQuote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
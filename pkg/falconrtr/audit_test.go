@@ -0,0 +1,165 @@
+package falconrtr
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/audit"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/simulate"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// TestAuditRecords checks that sessions, commands, put-files and uninstall
+// token reveals are recorded in the local audit log, with the comment sent
+// to the API, and failed ones with their error.
+func TestAuditRecords(t *testing.T) {
+	const online, offline = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	api := simulate.New(simulate.Options{Devices: []simulate.Device{
+		{ID: online, Hostname: "alpha", Platform: "windows"},
+		{ID: offline, Hostname: "bravo", Platform: "windows", Offline: true},
+	}})
+	path := filepath.Join(t.TempDir(), audit.DefaultName)
+	log, err := audit.Open(path, audit.Identity{RunID: "run-1", Metadata: sink.Metadata{Operator: "alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewCrowdStrikeRTRClient(Options{BaseURL: "https://api.test", Simulated: true, Transport: api, RunID: "run-1", Operator: "alice"}, WithAuditLog(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := client.Authenticate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	session, err := client.InitializeRTRSession(ctx, online)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Redactor.AddSecret("password", "hunter2")
+	if _, err := session.RunCommand(ctx, "", "ls", `ls "C:\hunter2"`, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.RunCommand(ctx, AdminCommandEndpoint, "ls", "ls C:\\", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.InitializeRTRSession(ctx, offline); err == nil {
+		t.Fatal("session opened on an offline host")
+	}
+	if _, err := client.UploadPutFile(ctx, "receipt.txt", "Receipt of run run-1", []byte("receipt")); err != nil {
+		t.Fatal(err)
+	}
+	token, err := client.GetUninstallToken(ctx, online, "maintenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), token.Reveal()) || strings.Contains(string(content), "hunter2") {
+		t.Errorf("audit log holds a secret:\n%s", content)
+	}
+	records := readAuditLog(t, path)
+	tests := []struct {
+		event, device, comment string
+		failed                 bool
+	}{
+		{audit.EventSessionOpened, online, "crowdstrike-data-collector (run_id=run-1) (on behalf of alice)", false},
+		{audit.EventCommandIssued, online, "", false},
+		{audit.EventCommandIssued, online, "", false},
+		{audit.EventSessionOpened, offline, "crowdstrike-data-collector (run_id=run-1) (on behalf of alice)", true},
+		{audit.EventPutFileUploaded, "", "Receipt of run run-1 (on behalf of alice)", false},
+		{audit.EventUninstallTokenRevealed, online, "maintenance (on behalf of alice)", false},
+	}
+	if len(records) != len(tests) {
+		t.Fatalf("%d audit records, want %d:\n%s", len(records), len(tests), content)
+	}
+	for i, test := range tests {
+		record := records[i]
+		if record.Event != test.event || record.DeviceID != test.device || record.Comment != test.comment || (record.Error != "") != test.failed {
+			t.Errorf("record %d = %+v, want %s on %q with comment %q (failed %t)", i, record, test.event, test.device, test.comment, test.failed)
+		}
+		if record.RunID != "run-1" || record.Operator != "alice" {
+			t.Errorf("record %d identity = %+v, want run-1 on behalf of alice", i, record.Identity)
+		}
+	}
+	if records[0].SessionID == "" || records[3].SessionID != "" {
+		t.Errorf("session IDs = %q, %q, want only the opened session's", records[0].SessionID, records[3].SessionID)
+	}
+	for i, endpoint := range []string{ReadOnlyCommandEndpoint, AdminCommandEndpoint} {
+		details := records[1+i].Details
+		if details["endpoint"] != endpoint || details["base_command"] != "ls" || details["cloud_request_id"] == "" || records[1+i].SessionID != session.SessionID {
+			t.Errorf("command record %d = %+v, want ls through %s with its cloud request", i, records[1+i], endpoint)
+		}
+	}
+	if got := records[1].Details["command"]; !strings.Contains(got, "[REDACTED") {
+		t.Errorf("recorded command = %q, want the secret concealed", got)
+	}
+}
+
+func TestAuditBatchSession(t *testing.T) {
+	const joined, offline = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	path := filepath.Join(t.TempDir(), audit.DefaultName)
+	log, err := audit.Open(path, audit.Identity{RunID: "run-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newTestClient(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"batch_id":"batch-1","resources":{` +
+			`"` + joined + `":{"session_id":"session-1","complete":true},` +
+			`"` + offline + `":{"session_id":"","errors":[{"code":404,"message":"host is offline"}]}}}`
+		return &http.Response{StatusCode: http.StatusCreated, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+	}))
+	client.Audit = log
+	if _, err := client.InitBatchSession(context.Background(), []string{joined, offline}); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readAuditLog(t, path)
+	if len(records) != 2 {
+		t.Fatalf("audit records = %+v, want one per host", records)
+	}
+	if record := records[0]; record.Event != audit.EventSessionOpened || record.DeviceID != joined || record.SessionID != "session-1" || record.Details["batch_id"] != "batch-1" || record.Error != "" {
+		t.Errorf("joined host record = %+v, want session-1 in batch-1", record)
+	}
+	if record := records[1]; record.Event != audit.EventSessionOpened || record.DeviceID != offline || record.SessionID != "" || !strings.Contains(record.Error, "host is offline") {
+		t.Errorf("offline host record = %+v, want a failed session", record)
+	}
+}
+
+// readAuditLog returns the records of the audit log at path, in order.
+func readAuditLog(t *testing.T, path string) []audit.Record {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var records []audit.Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record audit.Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
@@ -0,0 +1,358 @@
+package falconrtr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/audit"
+)
+
+// BatchSession is an RTR batch session spanning several devices. Commands
+// issued on the batch run on every host at once, so fleet-wide collection
+// costs a handful of API calls instead of a poll loop per host.
+type BatchSession struct {
+	client  *CrowdStrikeRTRClient
+	BatchID string
+
+	Sessions map[string]*Session // Device ID to its session, for hosts that joined
+	Errors   map[string]string   // Device ID to the reason it did not join
+}
+
+// BatchGetCommand is a get issued on a batch session. Hosts maps each device
+// the command reached to the immediate outcome the API reported for it.
+type BatchGetCommand struct {
+	BatchGetCmdReqID string
+	FilePath         string
+	Hosts            map[string]BatchGetHost
+}
+
+// BatchGetHost is the per-host outcome of issuing a batch get.
+type BatchGetHost struct {
+	DeviceID  string `json:"device_id"`
+	SessionID string `json:"session_id"`
+	TaskID    string `json:"task_id,omitempty"`
+	Stderr    string `json:"stderr,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BatchGetStatus is the upload state of a batch get on one host. Ready is set
+// once the file has reached the cloud; File then carries the SHA256 and name
+// needed to download it from the host's session.
+type BatchGetStatus struct {
+	DeviceID  string      `json:"device_id"`
+	SessionID string      `json:"session_id"`
+	Ready     bool        `json:"ready"`
+	File      SessionFile `json:"file"`
+}
+
+// HostFile is the outcome of a multi-host file retrieval for one device.
+type HostFile struct {
+	DeviceID string
+	File     *RetrievedFile
+	Err      error
+}
+
+// InitBatchSession opens a batch session on deviceIDs. Hosts that could not
+// join are listed in Errors; an error is only returned when none joined.
+func (c *CrowdStrikeRTRClient) InitBatchSession(ctx context.Context, deviceIDs []string) (*BatchSession, error) {
+	if len(deviceIDs) == 0 {
+		return nil, fmt.Errorf("no device IDs provided, cannot initialize RTR batch session")
+	}
+
+	headers := c.getHeaders("application/json", true)
+	params := url.Values{"timeout": {"30"}, "timeout_duration": {"30s"}}
+	payload := map[string]interface{}{"host_ids": deviceIDs, "queue_offline": false}
+
+	c.Console.Printf("Attempting to initialize RTR batch session for %d device(s)...\n", len(deviceIDs))
+	response, err := c.makeAPICall(ctx, "POST", c.url(EndpointBatchInitSession, 0), headers, params, payload, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to initialize RTR batch session: %w", err)
+		for _, deviceID := range deviceIDs {
+			c.record(audit.Record{Event: audit.EventSessionOpened, DeviceID: deviceID}, err)
+		}
+		return nil, err
+	}
+
+	batchID, _ := response["batch_id"].(string)
+	if batchID == "" {
+		return nil, fmt.Errorf("batch_id not found in RTR batch session initialization response")
+	}
+	batch := &BatchSession{client: c, BatchID: batchID, Sessions: map[string]*Session{}, Errors: map[string]string{}}
+
+	// The response structure is `{"batch_id": "...", "resources": {"<device_id>": {"session_id": "...", ...}}}`
+	resources, _ := response["resources"].(map[string]interface{})
+	for _, deviceID := range deviceIDs {
+		resource, _ := resources[deviceID].(map[string]interface{})
+		sessionID, _ := resource["session_id"].(string)
+		record := audit.Record{Event: audit.EventSessionOpened, DeviceID: deviceID, SessionID: sessionID, Details: map[string]string{"batch_id": batchID}}
+		if sessionID == "" {
+			batch.Errors[deviceID] = batchHostError(resource, "no session was opened")
+			record.Error = batch.Errors[deviceID]
+			c.Audit.Record(record)
+			continue
+		}
+		c.Audit.Record(record)
+		batch.Sessions[deviceID] = &Session{client: c, DeviceID: deviceID, SessionID: sessionID}
+	}
+	if len(batch.Sessions) == 0 {
+		return nil, fmt.Errorf("RTR batch session %s: no device joined", batchID)
+	}
+	c.Metrics.sessionOpened(len(batch.Sessions))
+	c.Console.Printf("RTR batch session %s opened on %d of %d device(s).\n", batchID, len(batch.Sessions), len(deviceIDs))
+	return batch, nil
+}
+
+// Delete closes the session of every host in the batch.
+func (b *BatchSession) Delete(ctx context.Context) error {
+	var errs []error
+	for _, session := range b.Sessions {
+		if err := session.Delete(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunBatchGetCommand issues get filePath on every host of the batch session
+// batchID and returns the batch_get_cmd_req_id to poll with GetBatchGetStatus.
+func (c *CrowdStrikeRTRClient) RunBatchGetCommand(ctx context.Context, batchID, filePath string) (*BatchGetCommand, error) {
+	if batchID == "" {
+		return nil, fmt.Errorf("batch ID not provided, cannot run batch get")
+	}
+
+	headers := c.getHeaders("application/json", true)
+	params := url.Values{"timeout": {"30"}, "timeout_duration": {"30s"}}
+	payload := map[string]interface{}{"batch_id": batchID, "file_path": filePath}
+
+	c.Console.Printf("Issuing batch 'get %s' on batch session %s...\n", filePath, batchID)
+	response, err := c.makeAPICall(ctx, "POST", c.url(EndpointBatchGetCommand, 0), headers, params, payload, nil)
+	reqID, _ := response["batch_get_cmd_req_id"].(string)
+	c.record(audit.Record{Event: audit.EventCommandIssued, Details: map[string]string{
+		"endpoint": EndpointBatchGetCommand, "base_command": "get", "command": c.Redactor.Conceal("get " + filePath), "batch_id": batchID, "batch_get_cmd_req_id": reqID,
+	}}, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue batch get: %w", err)
+	}
+
+	if reqID == "" {
+		return nil, fmt.Errorf("batch_get_cmd_req_id not found in batch get response")
+	}
+	command := &BatchGetCommand{BatchGetCmdReqID: reqID, FilePath: filePath, Hosts: map[string]BatchGetHost{}}
+
+	// Per-host results sit under `{"combined": {"resources": {"<device_id>": {...}}}}`
+	combined, _ := response["combined"].(map[string]interface{})
+	resources, _ := combined["resources"].(map[string]interface{})
+	for deviceID, resource := range resources {
+		resourceMap, ok := resource.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		host := BatchGetHost{DeviceID: deviceID}
+		host.SessionID, _ = resourceMap["session_id"].(string)
+		host.TaskID, _ = resourceMap["task_id"].(string)
+		host.Stderr, _ = resourceMap["stderr"].(string)
+		if errs, _ := resourceMap["errors"].([]interface{}); len(errs) > 0 {
+			host.Error = batchHostError(resourceMap, "get failed")
+		}
+		command.Hosts[deviceID] = host
+	}
+	return command, nil
+}
+
+// GetBatchGetStatus reports, per device, whether the file of the batch get
+// batchGetReqID has been uploaded to the cloud yet. Hosts the API does not
+// list have not uploaded anything so far.
+func (c *CrowdStrikeRTRClient) GetBatchGetStatus(ctx context.Context, batchGetReqID string) (map[string]BatchGetStatus, error) {
+	headers := c.getHeaders("application/json", true)
+	params := url.Values{"batch_get_cmd_req_id": {batchGetReqID}, "timeout": {"30"}, "timeout_duration": {"30s"}}
+	response, err := c.makeAPICall(ctx, "GET", c.url(EndpointBatchGetCommand, 0), headers, params, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch get status: %w", err)
+	}
+
+	statuses := map[string]BatchGetStatus{}
+	resources, _ := response["resources"].(map[string]interface{})
+	for deviceID, resource := range resources {
+		resourceMap, ok := resource.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		status := BatchGetStatus{DeviceID: deviceID}
+		status.SessionID, _ = resourceMap["session_id"].(string)
+		status.File.Name, _ = resourceMap["name"].(string)
+		status.File.SHA256, _ = resourceMap["sha256"].(string)
+		status.File.CloudRequestID, _ = resourceMap["cloud_request_id"].(string)
+		status.File.CreatedAt, _ = resourceMap["created_at"].(string)
+		if size, ok := resourceMap["size"].(float64); ok {
+			status.File.Size = int64(size)
+		}
+		status.Ready = status.File.SHA256 != ""
+		statuses[deviceID] = status
+	}
+	return statuses, nil
+}
+
+// GetFile retrieves remotePath from every host of the batch: one batch get,
+// a shared status poll until every host has uploaded or timeout expires, then
+// one download per host through DownloadSessionFile. The result holds one
+// entry per host in the batch, sorted by device ID; hosts that failed carry
+// Err instead of File.
+func (b *BatchSession) GetFile(ctx context.Context, remotePath string, timeout time.Duration) ([]HostFile, error) {
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	command, err := b.client.RunBatchGetCommand(ctx, b.BatchID, remotePath)
+	if err != nil {
+		return nil, err
+	}
+
+	results := map[string]*HostFile{}
+	pending := map[string]bool{}
+	for deviceID := range b.Sessions {
+		result := &HostFile{DeviceID: deviceID}
+		results[deviceID] = result
+		host, ok := command.Hosts[deviceID]
+		switch {
+		case !ok:
+			result.Err = fmt.Errorf("get %s was not issued on device %s", remotePath, deviceID)
+		case host.Error != "":
+			result.Err = fmt.Errorf("get %s failed on device %s: %s", remotePath, deviceID, host.Error)
+		case host.Stderr != "":
+			result.Err = fmt.Errorf("get %s failed on device %s: %s", remotePath, deviceID, strings.TrimSpace(host.Stderr))
+		default:
+			pending[deviceID] = true
+		}
+	}
+	for deviceID, reason := range b.Errors {
+		results[deviceID] = &HostFile{DeviceID: deviceID, Err: fmt.Errorf("device %s is not in batch session %s: %s", deviceID, b.BatchID, reason)}
+	}
+
+	ready, err := b.waitForUploads(ctx, command, pending, timeout)
+	if err != nil {
+		return nil, err
+	}
+	// The uploaded files download side by side, as many at once as the
+	// client's download slots allow.
+	var wg sync.WaitGroup
+	for deviceID := range pending {
+		status, ok := ready[deviceID]
+		if !ok {
+			results[deviceID].Err = fmt.Errorf("get %s on device %s did not upload within %s", remotePath, deviceID, timeout)
+			continue
+		}
+		session := b.Sessions[deviceID]
+		if status.SessionID != "" && status.SessionID != session.SessionID {
+			session = &Session{client: b.client, DeviceID: deviceID, SessionID: status.SessionID}
+		}
+		wg.Add(1)
+		go func(result *HostFile) {
+			defer wg.Done()
+			file, err := session.DownloadSessionFile(ctx, status.File)
+			if file != nil {
+				file.RemotePath = remotePath
+			}
+			result.File, result.Err = file, err
+		}(results[deviceID])
+	}
+	wg.Wait()
+
+	deviceIDs := make([]string, 0, len(results))
+	for deviceID := range results {
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	sort.Strings(deviceIDs)
+	files := make([]HostFile, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		files = append(files, *results[deviceID])
+	}
+	return files, nil
+}
+
+// GetFileFromHosts retrieves remotePath from every device in deviceIDs
+// through a batch session, which it closes afterwards.
+func (c *CrowdStrikeRTRClient) GetFileFromHosts(ctx context.Context, deviceIDs []string, remotePath string, timeout time.Duration) ([]HostFile, error) {
+	batch, err := c.InitBatchSession(ctx, deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := batch.Delete(context.Background()); err != nil {
+			c.Console.Printf("Warning: failed to close batch session %s: %v\n", batch.BatchID, err)
+		}
+	}()
+	return batch.GetFile(ctx, remotePath, timeout)
+}
+
+// waitForUploads polls the batch get status, paced by the client's poll
+// strategy and call budget, until every pending host is ready or timeout
+// expires. It returns the statuses of the hosts that became ready; reaching
+// the timeout is not an error.
+func (b *BatchSession) waitForUploads(ctx context.Context, command *BatchGetCommand, pending map[string]bool, timeout time.Duration) (map[string]BatchGetStatus, error) {
+	ready := map[string]BatchGetStatus{}
+	if len(pending) == 0 {
+		return ready, nil
+	}
+	clock := b.client.clock()
+	deadline := clock.Now().Add(timeout)
+	strategy := b.client.PollStrategy
+	if strategy == nil {
+		strategy = DefaultPollStrategy
+	}
+	var poll PollResult
+	pollStart := clock.Now()
+	for attempt := 1; ; attempt++ {
+		statuses, err := b.client.GetBatchGetStatus(ctx, command.BatchGetCmdReqID)
+		b.client.Metrics.poll()
+		if err != nil {
+			return nil, err
+		}
+		for deviceID, status := range statuses {
+			if pending[deviceID] && status.Ready {
+				ready[deviceID] = status
+			}
+		}
+		b.client.Console.Printf("Batch get %s: %d of %d host(s) uploaded.\n", command.BatchGetCmdReqID, len(ready), len(pending))
+		if len(ready) == len(pending) {
+			return ready, nil
+		}
+
+		// Hosts finishing their upload count as progress for adaptive pacing.
+		poll.Advanced, poll.OutputLen = len(ready) > poll.OutputLen, len(ready)
+		interval := strategy.NextDelay(attempt, clock.Now().Sub(pollStart), poll)
+		if budget := b.client.Budget; budget != nil {
+			if interval, err = budget.pollInterval(interval, deadline.Sub(clock.Now()), b.client.Console); err != nil {
+				return nil, fmt.Errorf("batch get %s: %w", command.BatchGetCmdReqID, err)
+			}
+		}
+		if clock.Now().Add(interval).After(deadline) {
+			return ready, nil
+		}
+		poll.Delay = interval
+		if err := sleep(ctx, clock, interval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// batchHostError describes why a host failed in a batch response, from the
+// message of its first error when there is one.
+func batchHostError(resource map[string]interface{}, fallback string) string {
+	errs, _ := resource["errors"].([]interface{})
+	for _, e := range errs {
+		if errMap, ok := e.(map[string]interface{}); ok {
+			if message, _ := errMap["message"].(string); message != "" {
+				return message
+			}
+		}
+	}
+	if stderr, _ := resource["stderr"].(string); stderr != "" {
+		return strings.TrimSpace(stderr)
+	}
+	return fallback
+}
@@ -0,0 +1,219 @@
+package falconrtr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultBreakerFailures is how many consecutive failures of one class open
+// a device's circuit when circuit_breaker.failures is not set.
+const DefaultBreakerFailures = 3
+
+// DefaultQuarantineTTL is how long a device whose circuit opened stays
+// quarantined when circuit_breaker.quarantine_ttl is not set.
+const DefaultQuarantineTTL = 24 * time.Hour
+
+// ErrCircuitOpen marks a device the circuit breaker stopped attempting:
+// its circuit opened in this run, or it is quarantined by an earlier one.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// BreakerState is what the circuit breaker knows of one device: the class
+// of its last failure, such as session_interrupted, and how many attempts
+// in a row failed with it.
+type BreakerState struct {
+	Class            string     `json:"class"`
+	Failures         int        `json:"failures"`
+	LastFailureAt    time.Time  `json:"last_failure_at"`
+	QuarantinedUntil *time.Time `json:"quarantined_until,omitempty"`
+}
+
+// quarantineFile is the layout of the quarantine file.
+type quarantineFile struct {
+	Devices map[string]*BreakerState `json:"devices"`
+}
+
+// CircuitBreaker stops a run from spending retries and API calls on a
+// device that keeps failing the same way. Every failed attempt on a device
+// counts against the class of its failure; a success, or a failure of
+// another class, starts the count over. When the count reaches Threshold
+// the device's circuit opens and it is not attempted again in the run.
+// With a quarantine file at Path, the counts carry over from run to run and
+// an opened device is quarantined for TTL, which later runs consult before
+// attempting it. A device whose quarantine expired gets one attempt: a
+// failure of the same class opens its circuit again.
+//
+// Methods on a nil *CircuitBreaker do nothing and never open a circuit; it
+// is safe for concurrent use.
+type CircuitBreaker struct {
+	Threshold int           // 0 uses DefaultBreakerFailures
+	TTL       time.Duration // How long an opened device stays quarantined
+	Path      string        // Quarantine file; "" keeps the counts for the run only
+	Clock     Clock         // nil uses SystemClock
+	Metrics   *Metrics      // Counts trips and quarantined devices skipped
+
+	mu      sync.Mutex
+	devices map[string]*BreakerState
+	opened  map[string]bool // Devices whose circuit opened in this run
+}
+
+// LoadCircuitBreaker returns a circuit breaker with the device states of
+// the quarantine file at path. A file that does not exist yet is empty.
+func LoadCircuitBreaker(path string, threshold int, ttl time.Duration) (*CircuitBreaker, error) {
+	b := &CircuitBreaker{Threshold: threshold, TTL: ttl, Path: path, devices: map[string]*BreakerState{}}
+	if path == "" {
+		return b, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quarantine file: %w", err)
+	}
+	var file quarantineFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid quarantine file %s: %w", path, err)
+	}
+	for deviceID, state := range file.Devices {
+		if state != nil {
+			b.devices[NormalizeDeviceID(deviceID)] = state
+		}
+	}
+	return b, nil
+}
+
+// Quarantined returns the state of deviceID when an earlier run
+// quarantined it and the quarantine has not expired, and counts the device
+// as skipped for it.
+func (b *CircuitBreaker) Quarantined(deviceID string) (BreakerState, bool) {
+	if b == nil {
+		return BreakerState{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.devices[NormalizeDeviceID(deviceID)]
+	if state == nil || state.QuarantinedUntil == nil || !state.QuarantinedUntil.After(b.clock().Now()) {
+		return BreakerState{}, false
+	}
+	b.Metrics.quarantineSkip()
+	return *state, true
+}
+
+// State returns what the breaker knows of deviceID, if anything.
+func (b *CircuitBreaker) State(deviceID string) (BreakerState, bool) {
+	if b == nil {
+		return BreakerState{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.devices[NormalizeDeviceID(deviceID)]
+	if state == nil {
+		return BreakerState{}, false
+	}
+	return *state, true
+}
+
+// Failure counts a failed attempt on deviceID against class and reports
+// whether the device's circuit is open after it. The attempt that opens
+// it counts as a trip and, with a quarantine file, quarantines the device
+// for TTL. An empty class, as for an interrupted run, is not counted.
+func (b *CircuitBreaker) Failure(deviceID, class string) (BreakerState, bool) {
+	if b == nil || class == "" {
+		return BreakerState{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	deviceID = NormalizeDeviceID(deviceID)
+	state := b.devices[deviceID]
+	if state == nil || state.Class != class {
+		if b.devices == nil {
+			b.devices = map[string]*BreakerState{}
+		}
+		state = &BreakerState{Class: class}
+		b.devices[deviceID] = state
+	}
+	now := b.clock().Now().UTC()
+	state.Failures++
+	state.LastFailureAt = now
+	threshold := b.Threshold
+	if threshold <= 0 {
+		threshold = DefaultBreakerFailures
+	}
+	if state.Failures >= threshold && !b.opened[deviceID] {
+		if b.opened == nil {
+			b.opened = map[string]bool{}
+		}
+		b.opened[deviceID] = true
+		b.Metrics.breakerTrip()
+		if b.Path != "" && b.TTL > 0 {
+			until := now.Add(b.TTL)
+			state.QuarantinedUntil = &until
+		}
+	}
+	return *state, b.opened[deviceID]
+}
+
+// Success closes the circuit of deviceID: its failure count starts over
+// and any quarantine is lifted.
+func (b *CircuitBreaker) Success(deviceID string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.devices, NormalizeDeviceID(deviceID))
+}
+
+// Opened returns the device IDs whose circuit opened in this run, sorted.
+func (b *CircuitBreaker) Opened() []string {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	opened := make([]string, 0, len(b.opened))
+	for deviceID := range b.opened {
+		opened = append(opened, deviceID)
+	}
+	sort.Strings(opened)
+	return opened
+}
+
+// Save writes the device states to the quarantine file, through a
+// temporary file so that a concurrent reader never sees a partial one.
+// Without a quarantine file it does nothing.
+func (b *CircuitBreaker) Save() error {
+	if b == nil || b.Path == "" {
+		return nil
+	}
+	b.mu.Lock()
+	data, err := json.MarshalIndent(quarantineFile{Devices: b.devices}, "", "  ")
+	b.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal quarantine file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(b.Path), 0755); err != nil {
+		return fmt.Errorf("failed to write quarantine file: %w", err)
+	}
+	tmp := b.Path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write quarantine file: %w", err)
+	}
+	if err := os.Rename(tmp, b.Path); err != nil {
+		return fmt.Errorf("failed to write quarantine file: %w", err)
+	}
+	return nil
+}
+
+func (b *CircuitBreaker) clock() Clock {
+	if b.Clock == nil {
+		return SystemClock
+	}
+	return b.Clock
+}
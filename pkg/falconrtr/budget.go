@@ -0,0 +1,140 @@
+package falconrtr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/console"
+)
+
+// API call categories counted by CallBudget.
+const (
+	CallsAuth          = "auth"
+	CallsHosts         = "hosts"
+	CallsSessions      = "sessions"
+	CallsCommands      = "commands"
+	CallsStatusPolls   = "status_polls"
+	CallsFileDownloads = "file_downloads"
+	CallsOther         = "other"
+)
+
+// ErrBudgetExceeded is returned for API calls made after the run's call
+// budget is spent, and by Command.Wait when the polls it still needs would
+// not fit in the budget.
+var ErrBudgetExceeded = errors.New("API call budget exceeded")
+
+// budgetHotFraction is the share of the budget after which polling slows down.
+const budgetHotFraction = 0.8
+
+// maxPollInterval caps how far a hot budget widens the poll interval.
+const maxPollInterval = 30 * time.Second
+
+// CallBudget counts the API calls of a run by category and, when Limit is
+// set, enforces it. Session deletes are always allowed so an aborted run can
+// still clean up after itself.
+type CallBudget struct {
+	Limit int // 0 means unlimited
+
+	mu       sync.Mutex
+	counts   map[string]int
+	total    int
+	exceeded bool
+}
+
+// allow counts one call in category and reports ErrBudgetExceeded when it is
+// over the limit.
+func (b *CallBudget) allow(method, category string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cleanup := method == http.MethodDelete && category == CallsSessions
+	if b.Limit > 0 && b.total >= b.Limit && !cleanup {
+		b.exceeded = true
+		return fmt.Errorf("%s %s call: %w (limit %d)", method, category, ErrBudgetExceeded, b.Limit)
+	}
+	if b.counts == nil {
+		b.counts = make(map[string]int)
+	}
+	b.counts[category]++
+	b.total++
+	return nil
+}
+
+// Counts returns the calls made so far by category.
+func (b *CallBudget) Counts() map[string]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	counts := make(map[string]int, len(b.counts))
+	for category, n := range b.counts {
+		counts[category] = n
+	}
+	return counts
+}
+
+// Total returns the number of calls made so far.
+func (b *CallBudget) Total() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total
+}
+
+// Exceeded reports whether a call was refused, or polling abandoned, because
+// of the limit.
+func (b *CallBudget) Exceeded() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exceeded
+}
+
+// Remaining returns the calls left, or -1 when the budget is unlimited.
+func (b *CallBudget) Remaining() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Limit <= 0 {
+		return -1
+	}
+	return max(b.Limit-b.total, 0)
+}
+
+// pollInterval returns the delay before the next status poll of a command
+// that may poll for left longer. While the budget is running hot, the
+// interval is widened so the remaining polls fit in what is left. It
+// returns ErrBudgetExceeded when they cannot fit even at maxPollInterval.
+// A widened interval is reported on out.
+func (b *CallBudget) pollInterval(interval, left time.Duration, out *console.Console) (time.Duration, error) {
+	remaining := b.Remaining()
+	if remaining < 0 || float64(b.Total()) < budgetHotFraction*float64(b.Limit) {
+		return interval, nil
+	}
+	// Keep one call in reserve for fetching the output once complete.
+	polls := remaining - 1
+	if polls <= 0 || time.Duration(polls)*maxPollInterval < left {
+		b.mu.Lock()
+		b.exceeded = true
+		b.mu.Unlock()
+		return 0, fmt.Errorf("%w: %d call(s) left cannot cover polling until the timeout", ErrBudgetExceeded, remaining)
+	}
+	if widened := left / time.Duration(polls); widened > interval {
+		out.Printf("API call budget running hot (%d of %d used), polling every %s\n", b.Total(), b.Limit, widened.Round(time.Second))
+		return min(widened, maxPollInterval), nil
+	}
+	return interval, nil
+}
+
+// FormatCallCounts renders call counts as "category=n" pairs, sorted by category.
+func FormatCallCounts(counts map[string]int) string {
+	categories := make([]string, 0, len(counts))
+	for category := range counts {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	parts := make([]string, 0, len(categories))
+	for _, category := range categories {
+		parts = append(parts, fmt.Sprintf("%s=%d", category, counts[category]))
+	}
+	return strings.Join(parts, ", ")
+}
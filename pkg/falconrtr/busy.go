@@ -0,0 +1,132 @@
+package falconrtr
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// activeSessionWindow is how recently a session must have been used to count
+// as live: RTR sessions time out after ten minutes without activity.
+const activeSessionWindow = 10 * time.Minute
+
+// busyQueryBatch bounds the device IDs named in one FQL filter.
+const busyQueryBatch = 100
+
+// ActiveSessions returns the live RTR sessions already open on deviceIDs,
+// keyed by device. It reads the audit API, which names the user holding each
+// session. Sessions this run opened itself (see OwnSession) are left out;
+// those of other collector runs count like any other, as they may be
+// collecting from the host at the same time. Without audit access it falls
+// back to the sessions query, which only sees the caller's own sessions and
+// names no holder.
+func (c *CrowdStrikeRTRClient) ActiveSessions(ctx context.Context, deviceIDs []string) (map[string][]AuditSession, error) {
+	active := map[string][]AuditSession{}
+	wanted := map[string]bool{}
+	for _, id := range deviceIDs {
+		wanted[NormalizeDeviceID(id)] = true
+	}
+	cutoff := c.clock().Now().Add(-activeSessionWindow)
+
+	for start := 0; start < len(deviceIDs); start += busyQueryBatch {
+		batch := deviceIDs[start:min(start+busyQueryBatch, len(deviceIDs))]
+		sessions, err := c.ListAuditSessions(ctx, deviceFilter(batch))
+		if err != nil {
+			c.Console.Printf("Warning: audit session lookup failed, checking own sessions only: %v\n", err)
+			return c.ownActiveSessions(ctx, deviceIDs)
+		}
+		for _, session := range sessions {
+			lastUsed := session.UpdatedAt
+			if lastUsed.IsZero() {
+				lastUsed = session.CreatedAt
+			}
+			if session.Deleted || !wanted[session.DeviceID] || lastUsed.Before(cutoff) || c.OwnSession(session) {
+				continue
+			}
+			active[session.DeviceID] = append(active[session.DeviceID], session)
+		}
+	}
+	return active, nil
+}
+
+// OwnSession reports whether this run opened session: the client opened a
+// session with its ID, or its origin names the client's run ID, as
+// InitializeRTRSession writes it. Sessions of other collector runs, which
+// share the User-Agent, are not the run's own.
+func (c *CrowdStrikeRTRClient) OwnSession(session AuditSession) bool {
+	c.sessionsMu.Lock()
+	opened := c.sessions[session.ID]
+	c.sessionsMu.Unlock()
+	if opened {
+		return true
+	}
+	return c.RunID != "" && strings.Contains(session.Origin, "(run_id="+c.RunID+")")
+}
+
+// recordSession notes that the client opened sessionID.
+func (c *CrowdStrikeRTRClient) recordSession(sessionID string) {
+	c.sessionsMu.Lock()
+	defer c.sessionsMu.Unlock()
+	if c.sessions == nil {
+		c.sessions = map[string]bool{}
+	}
+	c.sessions[sessionID] = true
+}
+
+// ownActiveSessions queries the caller's open sessions one device at a time.
+func (c *CrowdStrikeRTRClient) ownActiveSessions(ctx context.Context, deviceIDs []string) (map[string][]AuditSession, error) {
+	headers := c.getHeaders("application/json", true)
+	active := map[string][]AuditSession{}
+	for _, deviceID := range deviceIDs {
+		deviceID = NormalizeDeviceID(deviceID)
+		params := url.Values{"filter": {deviceFilter([]string{deviceID})}}
+		response, err := c.makeAPICall(ctx, "GET", c.url(EndpointSessionsQuery, 0), headers, params, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query sessions on device %s: %w", deviceID, err)
+		}
+		resources, _ := response["resources"].([]interface{})
+		for _, resource := range resources {
+			if id, ok := resource.(string); ok && id != "" {
+				active[deviceID] = append(active[deviceID], AuditSession{ID: id, DeviceID: deviceID})
+			}
+		}
+	}
+	return active, nil
+}
+
+// deviceFilter builds an FQL filter matching any of deviceIDs.
+func deviceFilter(deviceIDs []string) string {
+	quoted := make([]string, len(deviceIDs))
+	for i, id := range deviceIDs {
+		quoted[i] = QuoteFQL(NormalizeDeviceID(id))
+	}
+	return fmt.Sprintf("device_id:[%s]", strings.Join(quoted, ","))
+}
+
+// QuoteFQL quotes value as an FQL string literal, escaping backslashes and
+// single quotes, so IDs and names can be placed in a filter safely.
+func QuoteFQL(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value) + "'"
+}
+
+// SessionHolders describes who holds sessions, e.g. "alice (since
+// 2024-05-01T10:00:00Z)". Holders the API does not name are "unknown user".
+func SessionHolders(sessions []AuditSession) string {
+	holders := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		holder := session.UserName
+		if holder == "" {
+			holder = session.UserID
+		}
+		if holder == "" {
+			holder = "unknown user"
+		}
+		if !session.CreatedAt.IsZero() {
+			holder += fmt.Sprintf(" (since %s)", session.CreatedAt.UTC().Format(time.RFC3339))
+		}
+		holders = append(holders, holder)
+	}
+	return strings.Join(holders, ", ")
+}
@@ -0,0 +1,66 @@
+package falconrtr
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActiveSessionsOwnSessions(t *testing.T) {
+	const device = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	tests := []struct {
+		name     string
+		id       string
+		origin   string
+		lastUsed time.Duration // Before now
+		deleted  bool
+		wantBusy bool
+	}{
+		{name: "analyst session", id: "s-analyst", origin: "falcon-console", wantBusy: true},
+		{name: "another collector run", id: "s-foreign", origin: "crowdstrike-data-collector (run_id=run-2)", wantBusy: true},
+		{name: "another collector run without a run ID", id: "s-foreign", origin: "crowdstrike-data-collector", wantBusy: true},
+		{name: "run ID as a prefix of another", id: "s-foreign", origin: "crowdstrike-data-collector (run_id=run-10)", wantBusy: true},
+		{name: "this run, by origin", id: "s-leaked", origin: "crowdstrike-data-collector (run_id=run-1) (on behalf of alice)"},
+		{name: "this run, by session ID", id: "s-opened", origin: "falcon-console"},
+		{name: "idle", id: "s-analyst", origin: "falcon-console", lastUsed: 11 * time.Minute},
+		{name: "deleted", id: "s-analyst", origin: "falcon-console", deleted: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := NewFakeClock(epoch)
+			resource := map[string]interface{}{
+				"id":         test.id,
+				"device_id":  strings.ToUpper(device),
+				"user_name":  "svc-collector",
+				"origin":     test.origin,
+				"created_at": epoch.Add(-time.Hour).Format(time.RFC3339),
+				"updated_at": epoch.Add(-test.lastUsed).Format(time.RFC3339),
+			}
+			if test.deleted {
+				resource["deleted_at"] = epoch.Format(time.RFC3339)
+			}
+			client := newTestClient(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if !strings.HasSuffix(req.URL.Path, "/real-time-response-audit/combined/sessions/v1") {
+					t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+				}
+				body, _ := json.Marshal(map[string]interface{}{"resources": []interface{}{resource}})
+				return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(string(body))), Request: req}, nil
+			}))
+			client.Clock = clock
+			client.RunID = "run-1"
+			client.recordSession("s-opened")
+
+			active, err := client.ActiveSessions(context.Background(), []string{device})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if busy := len(active[device]) > 0; busy != test.wantBusy {
+				t.Errorf("busy = %t, want %t (sessions %+v)", busy, test.wantBusy, active)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package falconrtr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Capabilities are the API scopes a run may use, detected before any host
+// is touched. Features that need a capability the run lacks are refused up
+// front, with the reason, instead of failing on the first host.
+type Capabilities struct {
+	Minimal         bool `json:"minimal"` // minimal_permissions: only read scopes are used, even when more are granted
+	HostsRead       bool `json:"hosts_read"`
+	ReadOnly        bool `json:"rtr_read_only"`
+	ActiveResponder bool `json:"rtr_active_responder"`
+	Admin           bool `json:"rtr_admin"`
+
+	// UninstallTokens is Sensor update policies: Write, which reveals
+	// uninstall tokens. It is only probed when script_command_line uses one.
+	UninstallTokens bool `json:"uninstall_tokens"`
+
+	// Sandbox is Falcon Intelligence Sandbox and Sample uploads: Write,
+	// which submit files for detonation. It is only probed when sandbox is
+	// enabled.
+	Sandbox bool `json:"sandbox"`
+}
+
+// MinimalCapabilities is the capability set of minimal_permissions mode:
+// Hosts Read and RTR read-only, and never Hosts Write or an RTR write scope.
+func MinimalCapabilities() Capabilities {
+	return Capabilities{Minimal: true, HostsRead: true, ReadOnly: true}
+}
+
+// DetectCapabilities probes the read scopes the credentials grant: Hosts
+// Read and RTR read-only. Only a 403 counts as a missing scope; other
+// failures are returned. The write scopes are left unset for
+// DetectCommandCapabilities. The result is kept on the client, which then
+// refuses commands on endpoints it does not allow.
+func (c *CrowdStrikeRTRClient) DetectCapabilities(ctx context.Context) (Capabilities, error) {
+	caps := Capabilities{Minimal: c.MinimalPermissions}
+	headers := c.getHeaders("application/json", true)
+	params := url.Values{"limit": {"1"}}
+
+	var err error
+	if caps.HostsRead, err = c.probeScope(ctx, c.url(EndpointDevicesQuery, 0), headers, params); err != nil {
+		return caps, err
+	}
+	if caps.ReadOnly, err = c.probeScope(ctx, c.url(EndpointSessionsQuery, 0), headers, params); err != nil {
+		return caps, err
+	}
+	c.setCapabilities(caps)
+	return caps, nil
+}
+
+// DetectCommandCapabilities adds to caps, found by DetectCapabilities, the
+// write scopes: the active-responder and admin command endpoints, uninstall
+// tokens when script_command_line needs them, and the sandbox when it is
+// enabled. It calls the command endpoints, so the collector runs it only
+// once change control has approved the run. In minimal_permissions mode
+// nothing is probed, since the write scopes are never used.
+func (c *CrowdStrikeRTRClient) DetectCommandCapabilities(ctx context.Context, caps Capabilities) (Capabilities, error) {
+	if !caps.Minimal {
+		for _, probe := range []struct {
+			endpoint string
+			allowed  *bool
+		}{
+			{ActiveResponderCommandEndpoint, &caps.ActiveResponder},
+			{AdminCommandEndpoint, &caps.Admin},
+		} {
+			err := c.CheckCommandScope(ctx, probe.endpoint)
+			if err != nil && !errors.Is(err, ErrMissingScope) {
+				return caps, fmt.Errorf("capability detection failed: %w", err)
+			}
+			*probe.allowed = err == nil
+		}
+		var err error
+		if c.NeedsUninstallToken() && !c.ForbidUninstall {
+			if caps.UninstallTokens, err = c.probeUninstallTokens(ctx); err != nil {
+				return caps, err
+			}
+		}
+		if c.Sandbox != nil {
+			if caps.Sandbox, err = c.probeSandbox(ctx); err != nil {
+				return caps, err
+			}
+		}
+	}
+	c.setCapabilities(caps)
+	return caps, nil
+}
+
+// setCapabilities keeps caps for Capabilities and the endpoint checks.
+func (c *CrowdStrikeRTRClient) setCapabilities(caps Capabilities) {
+	c.capabilitiesMu.Lock()
+	defer c.capabilitiesMu.Unlock()
+	c.capabilities = &caps
+}
+
+// probeScope reports whether a GET of endpointURL is allowed: a 403 means
+// it is not, and a 400 or 404, given past authorization, that it is.
+func (c *CrowdStrikeRTRClient) probeScope(ctx context.Context, endpointURL string, headers map[string]string, params url.Values) (bool, error) {
+	_, err := c.makeAPICall(ctx, "GET", endpointURL, headers, params, nil, nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusForbidden:
+			return false, nil
+		case http.StatusBadRequest, http.StatusNotFound:
+			return true, nil
+		}
+	}
+	if err != nil {
+		return false, fmt.Errorf("capability detection failed: %w", err)
+	}
+	return true, nil
+}
+
+// CheckUninstallTokens explains, as an ErrMissingScope error, why uninstall
+// tokens may not be revealed.
+func (caps Capabilities) CheckUninstallTokens() error {
+	if caps.UninstallTokens {
+		return nil
+	}
+	if caps.Minimal {
+		return fmt.Errorf("%w: uninstall tokens (%s) are disabled by minimal_permissions", ErrMissingScope, uninstallTokenScope)
+	}
+	return fmt.Errorf("%w: the API client may not reveal uninstall tokens (requires %s)", ErrMissingScope, uninstallTokenScope)
+}
+
+// CheckSandbox explains, as an ErrMissingScope error, why files may not be
+// submitted to the sandbox.
+func (caps Capabilities) CheckSandbox() error {
+	if caps.Sandbox {
+		return nil
+	}
+	if caps.Minimal {
+		return fmt.Errorf("%w: sandbox submission (%s) is disabled by minimal_permissions", ErrMissingScope, sandboxScope)
+	}
+	return fmt.Errorf("%w: the API client may not submit files to the sandbox (requires %s)", ErrMissingScope, sandboxScope)
+}
+
+// Capabilities returns the capabilities found by DetectCapabilities, and
+// false when they have not been detected.
+func (c *CrowdStrikeRTRClient) Capabilities() (Capabilities, bool) {
+	c.capabilitiesMu.Lock()
+	defer c.capabilitiesMu.Unlock()
+	if c.capabilities == nil {
+		return Capabilities{}, false
+	}
+	return *c.capabilities, true
+}
+
+// AllowsEndpoint reports whether commands may be sent through the command
+// endpoint.
+func (caps Capabilities) AllowsEndpoint(endpoint string) bool {
+	switch endpoint {
+	case ReadOnlyCommandEndpoint:
+		return caps.ReadOnly
+	case ActiveResponderCommandEndpoint:
+		return caps.ActiveResponder
+	case AdminCommandEndpoint:
+		return caps.Admin
+	}
+	return false
+}
+
+// CheckEndpoint explains, as an ErrMissingScope error, why commands may not
+// be sent through the command endpoint.
+func (caps Capabilities) CheckEndpoint(endpoint string) error {
+	if caps.AllowsEndpoint(endpoint) {
+		return nil
+	}
+	if caps.Minimal && endpoint != ReadOnlyCommandEndpoint {
+		return fmt.Errorf("%w: the %s endpoint (%s) is disabled by minimal_permissions", ErrMissingScope, endpoint, commandEndpointScopes[endpoint])
+	}
+	return fmt.Errorf("%w: the API client may not use the %s endpoint (requires %s)", ErrMissingScope, endpoint, commandEndpointScopes[endpoint])
+}
+
+// Scopes names the scopes in the set, e.g. "Hosts: Read".
+func (caps Capabilities) Scopes() []string {
+	var scopes []string
+	if caps.HostsRead {
+		scopes = append(scopes, "Hosts: Read")
+	}
+	for _, endpoint := range []string{ReadOnlyCommandEndpoint, ActiveResponderCommandEndpoint, AdminCommandEndpoint} {
+		if caps.AllowsEndpoint(endpoint) {
+			scopes = append(scopes, commandEndpointScopes[endpoint])
+		}
+	}
+	if caps.UninstallTokens {
+		scopes = append(scopes, uninstallTokenScope)
+	}
+	if caps.Sandbox {
+		scopes = append(scopes, sandboxScope)
+	}
+	return scopes
+}
+
+// Disabled describes each feature the set turns off and why.
+func (caps Capabilities) Disabled() []string {
+	reason := func(scope string) string {
+		if caps.Minimal {
+			return "disabled by minimal_permissions"
+		}
+		return "requires " + scope
+	}
+	var disabled []string
+	if !caps.HostsRead {
+		disabled = append(disabled, "target selection by hostname and host details in file names: requires Hosts: Read")
+	}
+	if !caps.ReadOnly {
+		disabled = append(disabled, "read-only commands: requires "+commandEndpointScopes[ReadOnlyCommandEndpoint])
+	}
+	if !caps.ActiveResponder {
+		disabled = append(disabled, "active-responder commands (get, cp, memdump, kill, ...): "+reason(commandEndpointScopes[ActiveResponderCommandEndpoint]))
+	}
+	if !caps.Admin {
+		disabled = append(disabled, "admin commands (runscript, put-and-run) and cloud file cleanup: "+reason(commandEndpointScopes[AdminCommandEndpoint]))
+	}
+	return disabled
+}
@@ -0,0 +1,160 @@
+package falconrtr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/simulate"
+)
+
+// TestCapabilityGates detects the capabilities of clients granted subsets of
+// the simulated scopes, as simulation.scopes grants them, and checks the
+// features each set allows. Detection must only read.
+func TestCapabilityGates(t *testing.T) {
+	allowed := func(err error) bool { return err == nil }
+	tests := []struct {
+		name    string
+		scopes  []string
+		minimal bool
+		want    Capabilities
+	}{
+		{
+			name: "every scope",
+			want: Capabilities{HostsRead: true, ReadOnly: true, ActiveResponder: true, Admin: true, UninstallTokens: true, Sandbox: true},
+		},
+		{
+			name:   "read only",
+			scopes: []string{simulate.ScopeHostsRead, simulate.ScopeRTRRead},
+			want:   Capabilities{HostsRead: true, ReadOnly: true},
+		},
+		{
+			name:   "RTR read without hosts",
+			scopes: []string{simulate.ScopeRTRRead},
+			want:   Capabilities{ReadOnly: true},
+		},
+		{
+			name:   "active responder",
+			scopes: []string{simulate.ScopeHostsRead, simulate.ScopeRTRRead, simulate.ScopeRTRWrite},
+			want:   Capabilities{HostsRead: true, ReadOnly: true, ActiveResponder: true},
+		},
+		{
+			name:   "admin",
+			scopes: []string{simulate.ScopeHostsRead, simulate.ScopeRTRRead, simulate.ScopeRTRWrite, simulate.ScopeRTRAdmin},
+			want:   Capabilities{HostsRead: true, ReadOnly: true, ActiveResponder: true, Admin: true},
+		},
+		{
+			name:   "uninstall tokens",
+			scopes: []string{simulate.ScopeRTRRead, simulate.ScopeRTRAdmin, simulate.ScopeSensorUpdatePolicies},
+			want:   Capabilities{ReadOnly: true, Admin: true, UninstallTokens: true},
+		},
+		{
+			name:   "sandbox without sample uploads",
+			scopes: []string{simulate.ScopeRTRRead, simulate.ScopeSandbox},
+			want:   Capabilities{ReadOnly: true},
+		},
+		{
+			name:   "sandbox",
+			scopes: []string{simulate.ScopeRTRRead, simulate.ScopeSandbox, simulate.ScopeSampleUploads},
+			want:   Capabilities{ReadOnly: true, Sandbox: true},
+		},
+		{
+			name:    "minimal permissions with every scope",
+			minimal: true,
+			want:    Capabilities{Minimal: true, HostsRead: true, ReadOnly: true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := simulate.New(simulate.Options{Scopes: test.scopes})
+			var mu sync.Mutex
+			var writes []string
+			client, err := NewCrowdStrikeRTRClient(Options{
+				BaseURL:            "https://api.test",
+				Simulated:          true,
+				MinimalPermissions: test.minimal,
+				ScriptCommandLine:  "-Token {{.Secrets.UninstallToken}}",
+				UninstallAudit:     "maintenance",
+				Sandbox:            &Sandbox{},
+				Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					if req.Method != http.MethodGet && req.URL.Path != "/oauth2/token" {
+						mu.Lock()
+						writes = append(writes, req.Method+" "+req.URL.Path)
+						mu.Unlock()
+					}
+					return api.RoundTrip(req)
+				}),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			if err := client.Authenticate(ctx); err != nil {
+				t.Fatal(err)
+			}
+			caps, err := client.DetectCapabilities(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if caps.ActiveResponder || caps.Admin || caps.UninstallTokens || caps.Sandbox {
+				t.Errorf("DetectCapabilities = %+v, want only the read scopes", caps)
+			}
+			if caps, err = client.DetectCommandCapabilities(ctx, caps); err != nil {
+				t.Fatal(err)
+			}
+			if caps != test.want {
+				t.Errorf("capabilities = %+v, want %+v", caps, test.want)
+			}
+			if kept, ok := client.Capabilities(); !ok || kept != caps {
+				t.Errorf("client keeps %+v, want %+v", kept, caps)
+			}
+			if len(writes) > 0 {
+				t.Errorf("detection made write requests: %q", writes)
+			}
+
+			gates := []struct {
+				feature string
+				allowed bool
+				want    bool
+			}{
+				{"read-only commands", allowed(caps.CheckEndpoint(ReadOnlyCommandEndpoint)), test.want.ReadOnly},
+				{"active-responder commands", allowed(caps.CheckEndpoint(ActiveResponderCommandEndpoint)), test.want.ActiveResponder},
+				{"admin commands", allowed(caps.CheckEndpoint(AdminCommandEndpoint)), test.want.Admin},
+				{"uninstall tokens", allowed(caps.CheckUninstallTokens()), test.want.UninstallTokens},
+				{"sandbox", allowed(caps.CheckSandbox()), test.want.Sandbox},
+			}
+			for _, gate := range gates {
+				if gate.allowed != gate.want {
+					t.Errorf("%s allowed = %t, want %t", gate.feature, gate.allowed, gate.want)
+				}
+			}
+			for _, err := range []error{caps.CheckEndpoint(AdminCommandEndpoint), caps.CheckUninstallTokens(), caps.CheckSandbox()} {
+				if err == nil {
+					continue
+				}
+				if !errors.Is(err, ErrMissingScope) {
+					t.Errorf("refusal %v is not ErrMissingScope", err)
+				}
+				if test.minimal && !strings.Contains(err.Error(), "minimal_permissions") {
+					t.Errorf("refusal %v does not name minimal_permissions", err)
+				}
+			}
+			wantHostsDisabled := !test.want.HostsRead
+			if gotHostsDisabled := strings.Contains(strings.Join(caps.Disabled(), "\n"), "requires Hosts: Read"); gotHostsDisabled != wantHostsDisabled {
+				t.Errorf("Disabled = %q, want hostname selection disabled %t", caps.Disabled(), wantHostsDisabled)
+			}
+		})
+	}
+}
+
+func TestCapabilityScopes(t *testing.T) {
+	caps := Capabilities{HostsRead: true, ReadOnly: true, Admin: true, Sandbox: true}
+	want := []string{"Hosts: Read", "Real time response: Read", "Real time response (admin): Write", sandboxScope}
+	if got := caps.Scopes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Scopes = %q, want %q", got, want)
+	}
+}
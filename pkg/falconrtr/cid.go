@@ -0,0 +1,35 @@
+package falconrtr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// GetCurrentCID returns the customer ID (CID) the authenticated credentials
+// belong to, lowercased and without the checksum suffix the API appends.
+func (c *CrowdStrikeRTRClient) GetCurrentCID(ctx context.Context) (string, error) {
+	headers := c.getHeaders("application/json", true)
+	response, err := c.makeAPICall(ctx, "GET", c.url(EndpointCCID, 0), headers, nil, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get customer ID: %w", err)
+	}
+
+	// The response structure is `{"resources": ["<CID>-<checksum>"]}`
+	if resources, ok := response["resources"].([]interface{}); ok && len(resources) > 0 {
+		if ccid, ok := resources[0].(string); ok && ccid != "" {
+			return NormalizeCID(ccid), nil
+		}
+	}
+	return "", fmt.Errorf("customer ID not found in response")
+}
+
+// NormalizeCID lowercases a CID and strips a trailing "-XX" checksum, so
+// values copied from the Falcon console compare equal to API responses.
+func NormalizeCID(cid string) string {
+	cid = strings.ToLower(strings.TrimSpace(cid))
+	if i := strings.Index(cid, "-"); i >= 0 {
+		cid = cid[:i]
+	}
+	return cid
+}
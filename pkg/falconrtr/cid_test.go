@@ -0,0 +1,17 @@
+package falconrtr
+
+import "testing"
+
+func TestNormalizeCID(t *testing.T) {
+	tests := []struct{ cid, want string }{
+		{"0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef"},
+		{"0123456789ABCDEF0123456789ABCDEF-A7", "0123456789abcdef0123456789abcdef"},
+		{"  0123456789abcdef0123456789abcdef-a7\n", "0123456789abcdef0123456789abcdef"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := NormalizeCID(test.cid); got != test.want {
+			t.Errorf("NormalizeCID(%q) = %q, want %q", test.cid, got, test.want)
+		}
+	}
+}
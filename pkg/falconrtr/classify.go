@@ -0,0 +1,161 @@
+package falconrtr
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// ErrCommandFailed marks a command the API accepted and completed, but whose
+// status resource reported errors from the host.
+var ErrCommandFailed = errors.New("command failed on host")
+
+// Failure reasons attached to command results with stderr output or
+// resource errors.
+const (
+	FailureMissingScope        = "missing_scope"
+	FailureScriptNotFound      = "script_not_found"
+	FailurePathNotFound        = "path_not_found"
+	FailureAccessDenied        = "access_denied"
+	FailureExecutionPolicy     = "execution_policy"
+	FailureUnsupportedCommand  = "unsupported_command"
+	FailureUnsupportedPlatform = "unsupported_platform"
+	FailureSessionInterrupted  = "session_interrupted"
+	FailureSessionLimit        = "session_limit"
+	FailureTimeout             = "timeout"
+	FailureStalled             = "stalled"          // Set by Command.Wait, never matched from stderr
+	FailureDeviceNotFound      = "device_not_found" // Set for ErrDeviceNotFound, never matched from stderr
+	FailureUnknown             = "unknown"
+)
+
+// failureRule maps an RTR or script error signature to a failure reason,
+// and to the hint printed to help the operator fix it.
+type failureRule struct {
+	Reason    string
+	Retryable bool
+	Pattern   *regexp.Regexp
+	Hint      string
+}
+
+// failureRules is checked in order; the first matching rule wins. A reason
+// may have several rules when its causes need different fixes.
+var failureRules = []failureRule{
+	{FailureMissingScope, false, regexp.MustCompile(`(?i)missing API scope|status code 403\b`),
+		"Grant the API client the missing scope, e.g. 'Real time response (admin)' for runscript, in Falcon console → Support and resources → API clients and keys"},
+	{FailureScriptNotFound, false, regexp.MustCompile(`(?i)(script|cloud file)\b.*\b(not found|does not exist)|could not find (the )?(script|cloud file)`),
+		"Check script_name against Falcon console → Host setup and management → Response scripts and files, and that the credentials belong to the CID holding the script (expected_cid guards this)"},
+	{FailureExecutionPolicy, false, regexp.MustCompile(`(?i)execution ?policy|running scripts is disabled|is not digitally signed`),
+		"Sign the script, or relax the host's PowerShell execution policy for it"},
+	{FailureAccessDenied, false, regexp.MustCompile(`(?i)access (is )?denied|access to the path .* is denied|permission denied|not authorized|unauthorized`),
+		"The host refused access to the path; check that no other process locks it and that the OS does not protect it"},
+	{FailureUnsupportedPlatform, false, regexp.MustCompile(`(?i)not (supported|available) on this (platform|os|operating system)|not supported on (windows|linux|mac ?os|mac)\b|only (supported|available) on (windows|linux|mac)`),
+		"Run a script written for the host's OS, e.g. through platform_scripts"},
+	{FailureUnsupportedCommand, false, regexp.MustCompile(`(?i)unsupported command|(command|operation) (is )?not supported|unknown command|not recognized as the name of a cmdlet`),
+		"Check the command's spelling and that the host's sensor version supports it"},
+	{FailureSessionLimit, false, regexp.MustCompile(`(?i)session limit|too many (active |concurrent |open )?sessions|maximum (number of )?(concurrent )?sessions`),
+		"Close idle RTR sessions in Falcon console → Host setup and management → Response sessions, or lower concurrency.hosts"},
+	{FailureSessionInterrupted, true, regexp.MustCompile(`(?i)host (is |went )?offline|sensor comms`),
+		"The host is offline; check its Last seen in Falcon console → Host management and re-run once it is back"},
+	{FailureSessionInterrupted, true, regexp.MustCompile(`(?i)session (was |has been )?(interrupted|expired|closed|terminated|disconnected|not found)|connection (was )?(reset|lost|closed)`),
+		"The session dropped while the command ran; check the host's network connection, then re-run"},
+	{FailurePathNotFound, false, regexp.MustCompile(`(?i)cannot find path|no such file or directory|(path|file) not found|does not exist`),
+		"Check the path on the host; Linux and macOS paths are case-sensitive"},
+	{FailureTimeout, true, regexp.MustCompile(`(?i)timed? ?out|deadline exceeded`),
+		"Raise script_timeout (at most 10m), or collect less per run"},
+}
+
+// matchFailure returns the first failure rule matching text, or nil.
+func matchFailure(text string) *failureRule {
+	for i := range failureRules {
+		if failureRules[i].Pattern.MatchString(text) {
+			return &failureRules[i]
+		}
+	}
+	return nil
+}
+
+// ClassifyFailure returns a machine-readable failure reason for command
+// stderr and whether re-running the command may succeed. Empty stderr
+// yields no reason; unrecognized stderr is FailureUnknown and not retryable.
+func ClassifyFailure(stderr string) (reason string, retryable bool) {
+	if stderr == "" {
+		return "", false
+	}
+	if rule := matchFailure(stderr); rule != nil {
+		return rule.Reason, rule.Retryable
+	}
+	return FailureUnknown, false
+}
+
+// FailureHint returns the remediation hint of the failure rule that
+// classifies text, such as a command's stderr or an error message, or ""
+// when no rule does.
+func FailureHint(text string) string {
+	if rule := matchFailure(text); rule != nil {
+		return rule.Hint
+	}
+	return ""
+}
+
+// CommandHint returns the remediation hint of a completed command, from
+// the same errors and stderr ClassifyCommand classifies.
+func CommandHint(errs []sink.ResourceError, stderr string) string {
+	for _, resourceErr := range errs {
+		if hint := FailureHint(resourceErr.Message); hint != "" {
+			return hint
+		}
+	}
+	if len(errs) > 0 {
+		return ""
+	}
+	return FailureHint(stderr)
+}
+
+// ResourceErrors parses the errors array of a command status resource.
+// Errors in a 200 response mean the command itself failed on the host.
+func ResourceErrors(resource map[string]interface{}) []sink.ResourceError {
+	entries, _ := resource["errors"].([]interface{})
+	var errs []sink.ResourceError
+	for _, entry := range entries {
+		entryMap, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var resourceErr sink.ResourceError
+		if code, ok := entryMap["code"].(float64); ok {
+			resourceErr.Code = int(code)
+		}
+		resourceErr.Message, _ = entryMap["message"].(string)
+		errs = append(errs, resourceErr)
+	}
+	return errs
+}
+
+// FormatResourceErrors renders errs as "message (code N); ...".
+func FormatResourceErrors(errs []sink.ResourceError) string {
+	messages := make([]string, len(errs))
+	for i, resourceErr := range errs {
+		messages[i] = fmt.Sprintf("%s (code %d)", resourceErr.Message, resourceErr.Code)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ClassifyCommand returns the failure reason of a completed command and
+// whether re-running it may succeed: from the errors its status resource
+// reported when there are any, otherwise from its stderr. Resource errors
+// take the reason of the first message the failure rules recognize, and are
+// FailureUnknown and not retryable when none is recognized.
+func ClassifyCommand(errs []sink.ResourceError, stderr string) (reason string, retryable bool) {
+	if len(errs) == 0 {
+		return ClassifyFailure(stderr)
+	}
+	for _, resourceErr := range errs {
+		if reason, retryable := ClassifyFailure(resourceErr.Message); reason != "" && reason != FailureUnknown {
+			return reason, retryable
+		}
+	}
+	return FailureUnknown, false
+}
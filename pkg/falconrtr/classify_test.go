@@ -0,0 +1,158 @@
+package falconrtr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		stderr    string
+		reason    string
+		retryable bool
+	}{
+		{"", "", false},
+		{"something odd happened", FailureUnknown, false},
+		{"API request failed with status code 403: missing API scope rtr-admin:write", FailureMissingScope, false},
+		{"Cloud file collect.ps1 not found", FailureScriptNotFound, false},
+		{"The script 'collect.ps1' does not exist", FailureScriptNotFound, false},
+		{"Could not find the cloud file", FailureScriptNotFound, false},
+		{"File C:\\collect.ps1 cannot be loaded because running scripts is disabled on this system.", FailureExecutionPolicy, false},
+		{"The file is not digitally signed.", FailureExecutionPolicy, false},
+		{"Access to the path 'C:\\Windows\\System32\\config\\SAM' is denied.", FailureAccessDenied, false},
+		{"Access is denied.", FailureAccessDenied, false},
+		{"cat: /etc/shadow: Permission denied", FailureAccessDenied, false},
+		{"memdump is not supported on this platform", FailureUnsupportedPlatform, false},
+		{"This command is only available on Windows", FailureUnsupportedPlatform, false},
+		{"Unsupported command: foo", FailureUnsupportedCommand, false},
+		{"The term 'Get-Foo' is not recognized as the name of a cmdlet", FailureUnsupportedCommand, false},
+		{"Too many concurrent sessions for this host", FailureSessionLimit, false},
+		{"Host is offline", FailureSessionInterrupted, true},
+		{"The RTR session was interrupted", FailureSessionInterrupted, true},
+		{"connection reset by peer", FailureSessionInterrupted, true},
+		{"Get-Item : Cannot find path 'C:\\missing' because it does not exist.", FailurePathNotFound, false},
+		{"ls: /nope: No such file or directory", FailurePathNotFound, false},
+		{"The operation timed out", FailureTimeout, true},
+		{"context deadline exceeded", FailureTimeout, true},
+		// Earlier rules win where two match.
+		{"script not found: session expired", FailureScriptNotFound, false},
+		{"Access denied: cannot find path", FailureAccessDenied, false},
+	}
+	for _, test := range tests {
+		t.Run(test.stderr, func(t *testing.T) {
+			reason, retryable := ClassifyFailure(test.stderr)
+			if reason != test.reason || retryable != test.retryable {
+				t.Errorf("ClassifyFailure = %q, %v; want %q, %v", reason, retryable, test.reason, test.retryable)
+			}
+			if hint := FailureHint(test.stderr); (hint != "") != (test.reason != "" && test.reason != FailureUnknown) {
+				t.Errorf("FailureHint = %q for reason %q", hint, test.reason)
+			}
+		})
+	}
+}
+
+func TestClassifyCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []sink.ResourceError
+		stderr    string
+		reason    string
+		retryable bool
+	}{
+		{"clean", nil, "", "", false},
+		{"stderr only", nil, "Access is denied.", FailureAccessDenied, false},
+		{"resource error wins over stderr", []sink.ResourceError{{Code: 40401, Message: "Session not found"}}, "Access is denied.", FailureSessionInterrupted, true},
+		{"first recognized resource error", []sink.ResourceError{{Code: 500, Message: "oops"}, {Code: 404, Message: "cloud file not found"}}, "", FailureScriptNotFound, false},
+		{"unrecognized resource errors", []sink.ResourceError{{Code: 500, Message: "oops"}}, "Access is denied.", FailureUnknown, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reason, retryable := ClassifyCommand(test.errs, test.stderr)
+			if reason != test.reason || retryable != test.retryable {
+				t.Errorf("ClassifyCommand = %q, %v; want %q, %v", reason, retryable, test.reason, test.retryable)
+			}
+		})
+	}
+}
+
+func TestResourceErrors(t *testing.T) {
+	resource := map[string]interface{}{"errors": []interface{}{
+		map[string]interface{}{"code": float64(40401), "message": "Session not found"},
+		"not an object",
+		map[string]interface{}{"message": "no code"},
+	}}
+	errs := ResourceErrors(resource)
+	if len(errs) != 2 || errs[0] != (sink.ResourceError{Code: 40401, Message: "Session not found"}) || errs[1] != (sink.ResourceError{Message: "no code"}) {
+		t.Fatalf("ResourceErrors = %+v", errs)
+	}
+	if got, want := FormatResourceErrors(errs), "Session not found (code 40401); no code (code 0)"; got != want {
+		t.Errorf("FormatResourceErrors = %q, want %q", got, want)
+	}
+}
+
+func TestFailureHint(t *testing.T) {
+	tests := []struct {
+		text string
+		want string // In the hint; "" for none
+	}{
+		{"API request failed with status code 403: access denied, authorization failed", "'Real time response (admin)'"},
+		{"missing API scope rtr-admin:write", "API clients and keys"},
+		{"Cloud file collect.ps1 not found", "script_name"},
+		{"Could not find the cloud file", "expected_cid"},
+		{"Host is offline", "The host is offline"},
+		{"The RTR session was interrupted", "network connection"},
+		{"Too many concurrent sessions for this host", "Close idle RTR sessions"},
+		{"running scripts is disabled on this system", "execution policy"},
+		{"cat: /etc/shadow: Permission denied", "refused access"},
+		{"This command is only available on Windows", "platform_scripts"},
+		{"The term 'Get-Foo' is not recognized as the name of a cmdlet", "sensor version"},
+		{"ls: /nope: No such file or directory", "case-sensitive"},
+		{"context deadline exceeded", "script_timeout"},
+		{"something odd happened", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			hint := FailureHint(test.text)
+			if (test.want == "") != (hint == "") || !strings.Contains(hint, test.want) {
+				t.Errorf("FailureHint = %q, want one containing %q", hint, test.want)
+			}
+		})
+	}
+}
+
+// TestFailureRulesHaveHints keeps the hints in step with the classification:
+// every rule, and so every reason it can return, comes with a hint.
+func TestFailureRulesHaveHints(t *testing.T) {
+	for _, rule := range failureRules {
+		if strings.TrimSpace(rule.Hint) == "" {
+			t.Errorf("rule %s (%s) has no hint", rule.Reason, rule.Pattern)
+		}
+	}
+}
+
+func TestCommandHint(t *testing.T) {
+	tests := []struct {
+		name   string
+		errs   []sink.ResourceError
+		stderr string
+		want   string // In the hint; "" for none
+	}{
+		{"clean", nil, "", ""},
+		{"stderr", nil, "Access is denied.", "refused access"},
+		{"resource error wins over stderr", []sink.ResourceError{{Code: 40401, Message: "Session not found"}}, "Access is denied.", "network connection"},
+		{"first recognized resource error", []sink.ResourceError{{Code: 500, Message: "oops"}, {Code: 40006, Message: "cloud file not found"}}, "", "script_name"},
+		// The classification is unknown, so stderr gives no hint either.
+		{"unrecognized resource errors", []sink.ResourceError{{Code: 500, Message: "oops"}}, "Access is denied.", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hint := CommandHint(test.errs, test.stderr)
+			if (test.want == "") != (hint == "") || !strings.Contains(hint, test.want) {
+				t.Errorf("CommandHint = %q, want one containing %q", hint, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package falconrtr
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cleanupPageSize = 100
+
+// Cloud file kinds managed by ListCloudFiles and DeleteCloudFile.
+const (
+	CloudFileScript  = "script"
+	CloudFilePutFile = "put-file"
+)
+
+// cloudFileEndpoints holds the query and entities endpoint keys of each
+// cloud file kind.
+var cloudFileEndpoints = map[string][2]string{
+	CloudFileScript:  {EndpointScriptsQuery, EndpointScripts},
+	CloudFilePutFile: {EndpointPutFilesQuery, EndpointPutFiles},
+}
+
+// AuditSession is an RTR session as recorded by the audit API.
+type AuditSession struct {
+	ID        string    `json:"id"`
+	DeviceID  string    `json:"device_id"`
+	Hostname  string    `json:"hostname,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+	UserName  string    `json:"user_name,omitempty"`
+	Origin    string    `json:"origin,omitempty"` // What opened the session, as it named itself
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	Deleted   bool      `json:"deleted"`
+}
+
+// CloudFile is a script or put-file stored in the Falcon cloud.
+type CloudFile struct {
+	Kind       string    `json:"kind"`
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// ListAuditSessions returns every audited RTR session matching the FQL
+// filter (all sessions when empty), following pagination.
+func (c *CrowdStrikeRTRClient) ListAuditSessions(ctx context.Context, filter string) ([]AuditSession, error) {
+	headers := c.getHeaders("application/json", true)
+	var sessions []AuditSession
+	for offset := 0; ; {
+		params := url.Values{"limit": {strconv.Itoa(cleanupPageSize)}, "offset": {strconv.Itoa(offset)}}
+		if filter != "" {
+			params.Set("filter", filter)
+		}
+		response, err := c.makeAPICall(ctx, "GET", c.url(EndpointAuditSessions, 0), headers, params, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list audit sessions: %w", err)
+		}
+
+		resources, _ := response["resources"].([]interface{})
+		for _, resource := range resources {
+			resourceMap, ok := resource.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			session := AuditSession{}
+			session.ID, _ = resourceMap["id"].(string)
+			session.DeviceID, _ = resourceMap["device_id"].(string)
+			session.DeviceID = NormalizeDeviceID(session.DeviceID)
+			session.Hostname, _ = resourceMap["hostname"].(string)
+			session.UserID, _ = resourceMap["user_id"].(string)
+			session.UserName, _ = resourceMap["user_name"].(string)
+			session.Origin, _ = resourceMap["origin"].(string)
+			session.CreatedAt = parseTimestamp(resourceMap["created_at"])
+			session.UpdatedAt = parseTimestamp(resourceMap["updated_at"])
+			deletedAt, _ := resourceMap["deleted_at"].(string)
+			session.Deleted = deletedAt != ""
+			sessions = append(sessions, session)
+		}
+		next, more := responseMeta(response).Pagination.Next(offset, len(resources), cleanupPageSize)
+		if !more {
+			return sessions, nil
+		}
+		offset = next
+	}
+}
+
+// DeleteSession deletes an RTR session.
+func (c *CrowdStrikeRTRClient) DeleteSession(ctx context.Context, sessionID string) error {
+	headers := c.getHeaders("application/json", true)
+	params := url.Values{"session_id": {sessionID}}
+	if _, err := c.makeAPICall(ctx, "DELETE", c.url(EndpointSessions, 0), headers, params, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete session %s: %w", sessionID, err)
+	}
+	c.Metrics.sessionClosed()
+	return nil
+}
+
+// ListCloudFiles returns every cloud script or put-file, depending on kind.
+func (c *CrowdStrikeRTRClient) ListCloudFiles(ctx context.Context, kind string) ([]CloudFile, error) {
+	keys, ok := cloudFileEndpoints[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown cloud file kind %q", kind)
+	}
+	headers := c.getHeaders("application/json", true)
+
+	var ids []string
+	for offset := 0; ; {
+		params := url.Values{"limit": {strconv.Itoa(cleanupPageSize)}, "offset": {strconv.Itoa(offset)}}
+		response, err := c.makeAPICall(ctx, "GET", c.url(keys[0], 0), headers, params, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %ss: %w", kind, err)
+		}
+		resources, _ := response["resources"].([]interface{})
+		for _, resource := range resources {
+			if id, ok := resource.(string); ok {
+				ids = append(ids, id)
+			}
+		}
+		next, more := responseMeta(response).Pagination.Next(offset, len(resources), cleanupPageSize)
+		if !more {
+			break
+		}
+		offset = next
+	}
+
+	var files []CloudFile
+	for start := 0; start < len(ids); start += cleanupPageSize {
+		end := min(start+cleanupPageSize, len(ids))
+		params := url.Values{"ids": ids[start:end]}
+		response, err := c.makeAPICall(ctx, "GET", c.url(keys[1], 0), headers, params, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s details: %w", kind, err)
+		}
+		resources, _ := response["resources"].([]interface{})
+		for _, resource := range resources {
+			resourceMap, ok := resource.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			file := CloudFile{Kind: kind}
+			file.ID, _ = resourceMap["id"].(string)
+			file.Name, _ = resourceMap["name"].(string)
+			file.CreatedBy, _ = resourceMap["created_by"].(string)
+			file.ModifiedAt = parseTimestamp(resourceMap["modified_timestamp"])
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// DeleteCloudFile deletes a cloud script or put-file.
+func (c *CrowdStrikeRTRClient) DeleteCloudFile(ctx context.Context, file CloudFile) error {
+	keys, ok := cloudFileEndpoints[file.Kind]
+	if !ok {
+		return fmt.Errorf("unknown cloud file kind %q", file.Kind)
+	}
+	headers := c.getHeaders("application/json", true)
+	params := url.Values{"ids": {file.ID}}
+	if _, err := c.makeAPICall(ctx, "DELETE", c.url(keys[1], 0), headers, params, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete %s %s: %w", file.Kind, file.Name, err)
+	}
+	return nil
+}
+
+// parseTimestamp parses an RFC 3339 API timestamp, returning the zero time
+// when it is missing or malformed.
+func parseTimestamp(value interface{}) time.Time {
+	text, _ := value.(string)
+	parsed, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(text))
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
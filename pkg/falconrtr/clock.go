@@ -0,0 +1,136 @@
+package falconrtr
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits. Every timing decision of the client goes
+// through one: poll intervals, command timeouts, stall detection, throttle
+// pauses, session pool expiry, command stage timings and command latency
+// metrics. Host-level stage timings in reports use the wall clock.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the wall clock, used when no other is injected.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Option configures a client at construction.
+type Option func(*CrowdStrikeRTRClient)
+
+// WithClock makes the client, its throttle and its rate limit take the
+// time from clock.
+func WithClock(clock Clock) Option {
+	return func(c *CrowdStrikeRTRClient) {
+		c.Clock = clock
+		if c.Throttle != nil {
+			c.Throttle.Clock = clock
+		}
+		if c.Rate != nil {
+			c.Rate.Clock = clock
+		}
+	}
+}
+
+// clock returns the client's clock.
+func (c *CrowdStrikeRTRClient) clock() Clock {
+	if c.Clock == nil {
+		return SystemClock
+	}
+	return c.Clock
+}
+
+// Sleep waits d on the client's clock, or until ctx is done.
+func (c *CrowdStrikeRTRClient) Sleep(ctx context.Context, d time.Duration) error {
+	return sleep(ctx, c.clock(), d)
+}
+
+// Sleep waits d on the clock of the session's client, or until ctx is done.
+func (s *Session) Sleep(ctx context.Context, d time.Duration) error {
+	return s.client.Sleep(ctx, d)
+}
+
+// sleep waits d on clock, or until ctx is done.
+func sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	select {
+	case <-clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FakeClock is a Clock that only moves when Advance is called, so polling,
+// backoff and expiry can be exercised without real sleeps. It is safe for
+// concurrent use.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewFakeClock returns a fake clock reading now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the fake time.
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// After returns a channel that receives once the clock has been advanced by
+// at least d.
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.waiters = append(f.waiters, fakeWaiter{at: f.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d and fires the waits that are due,
+// earliest first.
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	sort.SliceStable(f.waiters, func(i, j int) bool { return f.waiters[i].at.Before(f.waiters[j].at) })
+	pending := f.waiters[:0]
+	for _, waiter := range f.waiters {
+		if waiter.at.After(f.now) {
+			pending = append(pending, waiter)
+			continue
+		}
+		waiter.ch <- f.now
+	}
+	f.waiters = pending
+}
+
+// Waiters returns how many waits are pending, so a test can advance the
+// clock once the code under test is blocked on it.
+func (f *FakeClock) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
@@ -0,0 +1,278 @@
+package falconrtr
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// awaitWaiters blocks until n waits are pending on clock, so the test
+// advances it only once the code under test sleeps on it.
+func awaitWaiters(t *testing.T, clock *FakeClock, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for clock.Waiters() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d wait(s) pending, want %d", clock.Waiters(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFakeClockFiresDueWaitsInOrder(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	late, early := clock.After(2*time.Second), clock.After(time.Second)
+	select {
+	case <-clock.After(0):
+	default:
+		t.Fatal("After(0) did not fire at once")
+	}
+
+	clock.Advance(999 * time.Millisecond)
+	if clock.Waiters() != 2 {
+		t.Fatalf("%d waits pending before they are due, want 2", clock.Waiters())
+	}
+	clock.Advance(time.Millisecond)
+	if at := <-early; !at.Equal(epoch.Add(time.Second)) {
+		t.Errorf("1s wait fired at %s", at)
+	}
+	select {
+	case <-late:
+		t.Fatal("2s wait fired after 1s")
+	default:
+	}
+	clock.Advance(time.Hour)
+	if at := <-late; !at.Equal(epoch.Add(time.Hour + time.Second)) {
+		t.Errorf("2s wait fired at %s", at)
+	}
+	if clock.Waiters() != 0 {
+		t.Errorf("%d waits pending after all fired", clock.Waiters())
+	}
+}
+
+// statusTransport answers command status polls with an incomplete command
+// until the complete'th poll, or until after has passed since epoch if set.
+// It records when, on clock, each poll came.
+type statusTransport struct {
+	clock    Clock
+	complete int
+	after    time.Duration
+
+	mu    sync.Mutex
+	polls []time.Time
+}
+
+func (s *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resources := []map[string]interface{}{}
+	if req.URL.Query().Get("sequence_id") == "0" {
+		s.mu.Lock()
+		now := s.clock.Now()
+		s.polls = append(s.polls, now)
+		complete := len(s.polls) >= s.complete || (s.after > 0 && !now.Before(epoch.Add(s.after)))
+		s.mu.Unlock()
+		resources = append(resources, map[string]interface{}{"complete": complete, "stdout": ""})
+	}
+	body, _ := json.Marshal(map[string]interface{}{"resources": resources})
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(string(body))),
+		Request:    req,
+	}, nil
+}
+
+func (s *statusTransport) times() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Time(nil), s.polls...)
+}
+
+// newClockedCommand returns a command on a client whose API is transport
+// and whose time is clock.
+func newClockedCommand(t *testing.T, clock *FakeClock, transport http.RoundTripper, strategy PollStrategy) *Command {
+	t.Helper()
+	client, err := NewCrowdStrikeRTRClient(Options{BaseURL: "https://api.test", Simulated: true, Transport: transport}, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &Session{client: client, DeviceID: "device", SessionID: "session"}
+	return &Command{session: session, Endpoint: ReadOnlyCommandEndpoint, CloudRequestID: "request", PollStrategy: strategy}
+}
+
+func TestCommandWaitPollsOnStrategyDelays(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy PollStrategy
+		delays   []time.Duration // Between consecutive polls
+	}{
+		{"fixed", FixedPoll{Interval: 5 * time.Second}, []time.Duration{5 * time.Second, 5 * time.Second, 5 * time.Second}},
+		{"exponential", ExponentialPoll{Initial: time.Second, Max: 4 * time.Second, Factor: 2}, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}},
+		{"adaptive while idle", AdaptivePoll{Initial: 2 * time.Second, Min: time.Second, Max: 4 * time.Second}, []time.Duration{2 * time.Second, 3 * time.Second, 4 * time.Second}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := NewFakeClock(epoch)
+			transport := &statusTransport{clock: clock, complete: len(test.delays) + 1}
+			cmd := newClockedCommand(t, clock, transport, test.strategy)
+
+			done := make(chan error, 1)
+			go func() {
+				result, err := cmd.Wait(context.Background(), time.Hour)
+				if err == nil && !result.Complete {
+					t.Error("result not complete")
+				}
+				done <- err
+			}()
+			for _, delay := range test.delays {
+				awaitWaiters(t, clock, 1)
+				clock.Advance(delay)
+			}
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+
+			polls := transport.times()
+			if len(polls) != len(test.delays)+1 {
+				t.Fatalf("%d polls, want %d", len(polls), len(test.delays)+1)
+			}
+			for i, delay := range test.delays {
+				if got := polls[i+1].Sub(polls[i]); got != delay {
+					t.Errorf("poll %d came %s after the previous, want %s", i+2, got, delay)
+				}
+			}
+		})
+	}
+}
+
+// nextWait returns how far clock must move for its earliest pending wait to
+// fire.
+func nextWait(clock *FakeClock) time.Duration {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	next := clock.waiters[0].at
+	for _, waiter := range clock.waiters[1:] {
+		if waiter.at.Before(next) {
+			next = waiter.at
+		}
+	}
+	return next.Sub(clock.now)
+}
+
+// TestCommandWaitPollCount runs a command that completes 30 seconds after
+// it is issued under each strategy and counts the status polls Wait makes.
+func TestCommandWaitPollCount(t *testing.T) {
+	const runtime = 30 * time.Second
+	tests := []struct {
+		name     string
+		strategy PollStrategy
+		polls    int
+		last     time.Duration // When, after issue, the completing poll came
+	}{
+		// 0, 2, 4 ... 30s.
+		{"fixed", FixedPoll{Interval: 2 * time.Second}, 16, 30 * time.Second},
+		// 0, 1, 3, 7, 15, 31s.
+		{"exponential", ExponentialPoll{Initial: time.Second, Max: 16 * time.Second, Factor: 2}, 6, 31 * time.Second},
+		// 0, 1, 2.5, 4.75, 8.125, 13.1875, 20.78125, 30.78125s.
+		{"adaptive", AdaptivePoll{Initial: time.Second, Min: 500 * time.Millisecond, Max: 10 * time.Second}, 8, 30781250 * time.Microsecond},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := NewFakeClock(epoch)
+			transport := &statusTransport{clock: clock, complete: 1 << 30, after: runtime}
+			cmd := newClockedCommand(t, clock, transport, test.strategy)
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := cmd.Wait(context.Background(), time.Hour)
+				done <- err
+			}()
+			for {
+				select {
+				case err := <-done:
+					if err != nil {
+						t.Fatal(err)
+					}
+					polls := transport.times()
+					if len(polls) != test.polls {
+						t.Fatalf("%d polls, want %d", len(polls), test.polls)
+					}
+					if got := polls[len(polls)-1].Sub(epoch); got != test.last {
+						t.Errorf("completing poll came %s after issue, want %s", got, test.last)
+					}
+					return
+				default:
+				}
+				if clock.Waiters() == 0 {
+					time.Sleep(time.Millisecond)
+					continue
+				}
+				clock.Advance(nextWait(clock))
+			}
+		})
+	}
+}
+
+func TestCommandWaitTimesOutOnClock(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	transport := &statusTransport{clock: clock, complete: 1 << 30} // Never completes
+	cmd := newClockedCommand(t, clock, transport, FixedPoll{Interval: 10 * time.Second})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := cmd.Wait(context.Background(), 30*time.Second)
+		done <- err
+	}()
+	for i := 0; i < 3; i++ {
+		awaitWaiters(t, clock, 1)
+		clock.Advance(10 * time.Second)
+	}
+	err := <-done
+	if err == nil || !strings.Contains(err.Error(), "did not complete within 30s") {
+		t.Fatalf("Wait = %v, want a timeout after 30s", err)
+	}
+	if polls := len(transport.times()); polls != 3 {
+		t.Errorf("%d polls before the timeout, want 3", polls)
+	}
+}
+
+// TestCommandTimingsOnClock checks that a command's stage timings and the
+// latency recorded in the client's metrics are read from its clock.
+func TestCommandTimingsOnClock(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	transport := &statusTransport{clock: clock, complete: 3}
+	cmd := newClockedCommand(t, clock, transport, FixedPoll{Interval: 5 * time.Second})
+	cmd.issuedAt = clock.Now()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := cmd.Wait(context.Background(), time.Hour)
+		done <- err
+	}()
+	for i := 0; i < 2; i++ {
+		awaitWaiters(t, clock, 1)
+		clock.Advance(5 * time.Second)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	stages := map[string]int64{}
+	for _, stage := range cmd.Stages() {
+		stages[stage.Name] = stage.DurationMS
+		if !stage.StartedAt.Add(time.Duration(stage.DurationMS) * time.Millisecond).Equal(stage.CompletedAt) {
+			t.Errorf("stage %s from %s to %s, not %dms", stage.Name, stage.StartedAt, stage.CompletedAt, stage.DurationMS)
+		}
+	}
+	if stages["command_execution"] != 10000 || stages["output_retrieval"] != 0 {
+		t.Errorf("stages %v, want command_execution 10000ms and output_retrieval 0ms on the clock", stages)
+	}
+	if latency := cmd.session.client.Metrics.Snapshot().LatencyMeanMS; latency != 10000 {
+		t.Errorf("latency %dms, want 10000ms", latency)
+	}
+}
@@ -0,0 +1,511 @@
+package falconrtr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/audit"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+const (
+	// DefaultCommandTimeout bounds how long WaitForCommand polls a regular command.
+	DefaultCommandTimeout = 5 * time.Minute
+	// DefaultPollInterval is the delay between status polls.
+	DefaultPollInterval = 2 * time.Second
+)
+
+// CommandResult is the assembled outcome of one RTR command. Stdout and
+// Stderr are the concatenation of every sequence chunk the API returned.
+// Endpoint is the command endpoint the command was issued through.
+// Normalization lists the output normalization steps applied, as
+// field:step. Stages times issuing, execution and output retrieval.
+// Errors lists the errors the status resource reported: the API call
+// succeeded but the command failed on the host. FailureReason classifies
+// Errors, or Stderr when there are none (see ClassifyCommand). Data holds
+// structured records parsed from the output, when a helper knows how to
+// parse it.
+type CommandResult struct {
+	Endpoint       string               `json:"endpoint"`
+	BaseCommand    string               `json:"base_command"`
+	CommandString  string               `json:"command_string"`
+	SessionID      string               `json:"session_id"`
+	CloudRequestID string               `json:"cloud_request_id"`
+	Stdout         string               `json:"stdout"`
+	Stderr         string               `json:"stderr"`
+	Complete       bool                 `json:"complete"`
+	Sequences      int                  `json:"sequences"`
+	Normalization  []string             `json:"normalization,omitempty"`
+	Stages         []sink.Stage         `json:"stages,omitempty"`
+	FailureReason  string               `json:"failure_reason,omitempty"`
+	Retryable      bool                 `json:"retryable,omitempty"`
+	Errors         []sink.ResourceError `json:"errors,omitempty"`
+	TimeoutSeconds int                  `json:"timeout_seconds,omitempty"` // -Timeout of a runscript command
+	Cancelled      bool                 `json:"cancelled,omitempty"`
+	Redactions     map[string]int       `json:"redactions,omitempty"` // Matches redacted from stdout and stderr, by rule
+	Data           interface{}          `json:"data,omitempty"`
+}
+
+// ErrCommandStalled is returned by Command.Wait when a command's output stops
+// advancing for the client's StallWindow.
+var ErrCommandStalled = errors.New("command stalled")
+
+// Command is a handle to an issued RTR command.
+type Command struct {
+	session        *Session
+	Endpoint       string // Endpoint key, e.g. ReadOnlyCommandEndpoint
+	BaseCommand    string
+	CommandString  string
+	CloudRequestID string
+
+	// PollStrategy paces Wait; it defaults to the client's poll_strategy.
+	PollStrategy PollStrategy
+
+	// ScriptTimeout is the -Timeout a runscript command was issued with.
+	ScriptTimeout time.Duration
+
+	// Follow, when set, receives the command's stdout, redacted, line by
+	// line as Wait sees it arrive. It makes no API calls of its own, so it
+	// is paced by PollStrategy and the call budget like any other poll.
+	Follow io.Writer
+
+	issuedAt time.Time
+	timing   sink.Timing
+	measured sync.Once // Records the command's latency once it is seen complete
+	rawKept  bool      // Wait kept the unredacted output of every sequence
+}
+
+// Stages returns the timings recorded for the command so far.
+func (cmd *Command) Stages() []sink.Stage {
+	return cmd.timing.Stages()
+}
+
+// stage records the stage name of the command that began at start, as read
+// from the client's clock, and ends now on that clock.
+func (cmd *Command) stage(name string, start time.Time) {
+	elapsed := cmd.session.client.clock().Now().Sub(start)
+	cmd.timing.Add(sink.Stage{Name: name, StartedAt: start.UTC(), CompletedAt: start.Add(elapsed).UTC(), DurationMS: elapsed.Milliseconds()})
+}
+
+// RunCommand issues commandString on the session and waits up to timeout for
+// it to complete. An empty endpoint selects the least-privileged command
+// endpoint that accepts the command (see CommandEndpoint); otherwise it
+// forces ReadOnlyCommandEndpoint, ActiveResponderCommandEndpoint or
+// AdminCommandEndpoint.
+func (s *Session) RunCommand(ctx context.Context, endpoint, baseCommand, commandString string, timeout time.Duration) (*CommandResult, error) {
+	command, err := s.IssueCommand(ctx, endpoint, baseCommand, commandString)
+	if err != nil {
+		return nil, err
+	}
+	return command.Wait(ctx, timeout)
+}
+
+// IssueCommand posts a command to the session and returns a handle carrying
+// its cloud_request_id. endpoint is chosen as for RunCommand.
+func (s *Session) IssueCommand(ctx context.Context, endpoint, baseCommand, commandString string) (*Command, error) {
+	if s.DeviceID == "" || s.SessionID == "" {
+		return nil, fmt.Errorf("device ID or session ID not available, cannot run %s", baseCommand)
+	}
+	if endpoint == "" {
+		endpoint = s.client.CommandEndpoint(baseCommand, commandString)
+	}
+	switch endpoint {
+	case ReadOnlyCommandEndpoint, ActiveResponderCommandEndpoint, AdminCommandEndpoint:
+	default:
+		return nil, fmt.Errorf("%q is not a command endpoint", endpoint)
+	}
+	if caps, ok := s.client.Capabilities(); ok {
+		if err := caps.CheckEndpoint(endpoint); err != nil {
+			return nil, fmt.Errorf("cannot run %s: %w", baseCommand, err)
+		}
+	}
+	if limitedCommand(baseCommand) {
+		if err := CheckCommandPlatform(baseCommand, s.platform(ctx)); err != nil {
+			return nil, fmt.Errorf("cannot run %s on device %s: %w", baseCommand, s.DeviceID, err)
+		}
+	}
+
+	payload := map[string]interface{}{
+		"base_command":   baseCommand,
+		"command_string": commandString,
+		"device_id":      s.DeviceID,
+		"id":             0,
+		"persist":        true,
+		"session_id":     s.SessionID,
+	}
+
+	// Secrets in the command string are sent, never printed or recorded.
+	shown := s.client.Redactor.Conceal(commandString)
+	s.client.Console.Printf("Issuing '%s' on session %s via %s...\n", shown, s.SessionID, endpoint)
+	clock := s.client.clock()
+	start := clock.Now()
+	cloudRequestID, err := s.postCommand(ctx, endpoint, payload)
+	if err != nil && ambiguousIssue(ctx, err) {
+		cloudRequestID, err = s.issueAgain(ctx, endpoint, payload, start, err)
+	}
+	s.client.record(audit.Record{Event: audit.EventCommandIssued, DeviceID: s.DeviceID, SessionID: s.SessionID, Details: map[string]string{
+		"endpoint": endpoint, "base_command": baseCommand, "command": shown, "cloud_request_id": cloudRequestID,
+	}}, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue %s: %w", baseCommand, err)
+	}
+
+	cmd := &Command{
+		session:        s,
+		Endpoint:       endpoint,
+		BaseCommand:    baseCommand,
+		CommandString:  shown,
+		CloudRequestID: cloudRequestID,
+		PollStrategy:   s.client.PollStrategy,
+		issuedAt:       clock.Now(),
+	}
+	cmd.stage("command_issue", start)
+	return cmd, nil
+}
+
+// postCommand posts payload to a command endpoint and returns the
+// cloud_request_id of the accepted command. With the throttle's
+// PauseIssuance it waits out a pause first and posts again after a 429.
+func (s *Session) postCommand(ctx context.Context, endpoint string, payload map[string]interface{}) (string, error) {
+	throttle := s.client.Throttle
+	pauseIssuance := throttle != nil && throttle.PauseIssuance
+	headers := s.client.getHeaders("application/json", true)
+	var response map[string]interface{}
+	for {
+		if pauseIssuance {
+			if err := throttle.Wait(ctx); err != nil {
+				return "", err
+			}
+		}
+		var err error
+		response, err = s.client.makeAPICall(ctx, "POST", s.client.url(endpoint, 0), headers, nil, payload, nil)
+		var apiErr *APIError
+		if pauseIssuance && errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+			// A throttled post was not accepted, so it is safe to send again.
+			s.client.Metrics.Retry()
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		break
+	}
+	if resource := firstResource(response); resource != nil {
+		if cloudRequestID, ok := resource["cloud_request_id"].(string); ok && cloudRequestID != "" {
+			return cloudRequestID, nil
+		}
+	}
+	return "", errors.New("cloud_request_id not found in response")
+}
+
+// Wait polls the status of the command until it completes or the timeout
+// expires, then collects any further sequence chunks of its output. A
+// script with a -Timeout is polled at least until a little after it.
+func (cmd *Command) Wait(ctx context.Context, timeout time.Duration) (*CommandResult, error) {
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	timeout = max(timeout, cmd.ScriptTimeout+scriptTimeoutGrace)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	s := cmd.session
+	result := &CommandResult{
+		Endpoint:       cmd.Endpoint,
+		BaseCommand:    cmd.BaseCommand,
+		CommandString:  cmd.CommandString,
+		SessionID:      s.SessionID,
+		CloudRequestID: cmd.CloudRequestID,
+		TimeoutSeconds: int(cmd.ScriptTimeout / time.Second),
+	}
+	strategy := cmd.PollStrategy
+	if strategy == nil {
+		strategy = DefaultPollStrategy
+	}
+	var follow *follower
+	if cmd.Follow != nil {
+		follow = &follower{w: cmd.Follow, redactor: s.client.Redactor}
+	}
+	var poll PollResult
+	var first map[string]interface{} // The completed sequence-0 resource
+	clock := s.client.clock()
+	pollStart := clock.Now()
+	deadline := pollStart.Add(timeout)
+	lastProgress, lastOutput, nudged := pollStart, -1, false
+	for attempt := 1; ; attempt++ {
+		resource, err := cmd.sequence(ctx, 0)
+		if err != nil {
+			return result, err
+		}
+		if complete, _ := resource["complete"].(bool); complete {
+			first = resource
+			result.Complete = true
+			result.Stdout, _ = resource["stdout"].(string)
+			result.Stderr, _ = resource["stderr"].(string)
+			result.Errors = ResourceErrors(resource)
+			result.Sequences = 1
+			cmd.stage("command_execution", cmd.issuedAt)
+			cmd.completed()
+			break
+		}
+
+		// Stall detection: give up early on a command whose output has
+		// stopped advancing, optionally nudging the session once first.
+		stdout, _ := resource["stdout"].(string)
+		stderr, _ := resource["stderr"].(string)
+		follow.update(stdout)
+		output := len(stdout) + len(stderr)
+		poll.Advanced, poll.OutputLen = output > poll.OutputLen, output
+		if output != lastOutput {
+			lastProgress, lastOutput = clock.Now(), output
+		} else if window := s.client.StallWindow; window > 0 && clock.Now().Sub(lastProgress) >= window {
+			if s.client.StallRefresh && !nudged {
+				s.warn(sink.WarningSessionRefreshed, "command %s stalled: no progress for %s, refreshing session %s", cmd.CloudRequestID, window, s.SessionID)
+				if err := s.Refresh(ctx); err != nil {
+					s.client.Console.Printf("Warning: %v\n", err)
+				}
+				lastProgress, nudged = clock.Now(), true
+			} else {
+				s.client.Console.Printf("Command %s on device %s stalled: no progress for %s, giving up.\n", cmd.CloudRequestID, s.DeviceID, window)
+				result.Stdout, result.Stderr = stdout, stderr
+				result.FailureReason = FailureStalled
+				return result, fmt.Errorf("command %s: %w after %s without progress", cmd.CloudRequestID, ErrCommandStalled, window)
+			}
+		}
+
+		interval := strategy.NextDelay(attempt, clock.Now().Sub(pollStart), poll)
+		if budget := s.client.Budget; budget != nil {
+			if interval, err = budget.pollInterval(interval, deadline.Sub(clock.Now()), s.client.Console); err != nil {
+				return result, fmt.Errorf("command %s: %w", cmd.CloudRequestID, err)
+			}
+		}
+		poll.Delay = interval
+		if err := sleep(ctx, clock, interval); err != nil {
+			return result, fmt.Errorf("command %s did not complete within %s: %w", cmd.CloudRequestID, timeout, err)
+		}
+		if !clock.Now().Before(deadline) {
+			return result, fmt.Errorf("command %s did not complete within %s: %w", cmd.CloudRequestID, timeout, context.DeadlineExceeded)
+		}
+	}
+
+	// Large outputs are split across sequence IDs; fetch until the API has no more.
+	retrievalStart := clock.Now()
+	var stdout, stderr strings.Builder
+	stdout.WriteString(result.Stdout)
+	stderr.WriteString(result.Stderr)
+	for sequence := 1; ; sequence++ {
+		resource, err := cmd.sequence(ctx, sequence)
+		if err != nil {
+			var apiErr *APIError
+			if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusBadRequest) {
+				break
+			}
+			return result, err
+		}
+		if resource == nil {
+			break
+		}
+		chunkOut, _ := resource["stdout"].(string)
+		chunkErr, _ := resource["stderr"].(string)
+		if chunkOut == "" && chunkErr == "" {
+			break
+		}
+		stdout.WriteString(chunkOut)
+		stderr.WriteString(chunkErr)
+		result.Sequences++
+		follow.update(stdout.String())
+	}
+	follow.finish(stdout.String())
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	cmd.stage("output_retrieval", retrievalStart)
+	result.Stages = cmd.timing.Stages()
+	if s.client.KeepRawOutput {
+		raw := make(map[string]interface{}, len(first)+1)
+		for key, value := range first {
+			raw[key] = value
+		}
+		raw["stdout"], raw["stderr"], raw["sequences"] = result.Stdout, result.Stderr, result.Sequences
+		if err := s.client.writeRawOutput(cmd, map[string]interface{}{"resources": []interface{}{raw}}); err != nil {
+			return result, err
+		}
+		cmd.rawKept = true
+	}
+	s.client.normalizeResult(cmd, result)
+
+	if redactor := s.client.Redactor; redactor != nil {
+		var counts map[string]int
+		result.Stdout, counts = redactor.Redact(result.Stdout)
+		var stderrCounts map[string]int
+		result.Stderr, stderrCounts = redactor.Redact(result.Stderr)
+		for name, n := range stderrCounts {
+			counts[name] += n
+		}
+		if len(counts) > 0 {
+			result.Redactions = counts
+			s.client.Console.Printf("Redacted output for device %s: %s\n", s.DeviceID, formatRedactionCounts(counts))
+		}
+	}
+	result.FailureReason, result.Retryable = ClassifyCommand(result.Errors, result.Stderr)
+	if len(result.Errors) > 0 {
+		s.client.Console.Printf("Command %s failed on device %s: %s\n", cmd.CloudRequestID, s.DeviceID, FormatResourceErrors(result.Errors))
+	}
+	return result, nil
+}
+
+// Status fetches the raw status response of the command's first output
+// sequence. When keep_raw_output is set and Wait has not already kept the
+// unredacted output of every sequence, it keeps this response's instead.
+func (cmd *Command) Status(ctx context.Context) (map[string]interface{}, error) {
+	c := cmd.session.client
+	headers := c.getHeaders("application/json", true)
+	params := url.Values{
+		"cloud_request_id": {cmd.CloudRequestID},
+		"sequence_id":      {"0"}, // Typically 0 for the initial command status
+	}
+
+	c.Console.Printf("Attempting to get status for command with Cloud Request ID: %s...\n", cmd.CloudRequestID)
+	statusResponse, err := cmd.poll(ctx, headers, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get RTR command status: %w", err)
+	}
+
+	if c.KeepRawOutput && !cmd.rawKept {
+		if err := c.writeRawOutput(cmd, statusResponse); err != nil {
+			return nil, err
+		}
+	}
+	if complete, _ := firstResource(statusResponse)["complete"].(bool); complete {
+		cmd.completed()
+	}
+	c.normalizeStatusResponse(cmd, statusResponse)
+	c.redactStatusResponse(statusResponse, cmd.session.DeviceID)
+
+	c.Console.Println("RTR Command Status Response:")
+	prettyJSON, _ := json.MarshalIndent(statusResponse, "", "  ")
+	c.Console.Println(string(prettyJSON))
+
+	return statusResponse, nil
+}
+
+// CancelCommand deletes a command that is still queued for an offline host.
+// Commands that already started executing cannot be removed this way; see
+// Command.Cancel.
+func (c *CrowdStrikeRTRClient) CancelCommand(ctx context.Context, sessionID, cloudRequestID string) error {
+	headers := c.getHeaders("application/json", true)
+	params := url.Values{"session_id": {sessionID}, "cloud_request_id": {cloudRequestID}}
+	if _, err := c.makeAPICall(ctx, "DELETE", c.url(EndpointQueuedCommand, 0), headers, params, nil, nil); err != nil {
+		return fmt.Errorf("failed to cancel queued command %s: %w", cloudRequestID, err)
+	}
+	return nil
+}
+
+// Cancel abandons the command. A queued command is deleted from the queue.
+// For a command that is already executing, cancellation is best effort: the
+// output produced so far is fetched, then the session is deleted so the host
+// stops serving it. The returned result is marked Cancelled and carries the
+// partial output; the session must not be used afterwards.
+func (cmd *Command) Cancel(ctx context.Context) (*CommandResult, error) {
+	s := cmd.session
+	result := &CommandResult{
+		Endpoint:       cmd.Endpoint,
+		BaseCommand:    cmd.BaseCommand,
+		CommandString:  cmd.CommandString,
+		SessionID:      s.SessionID,
+		CloudRequestID: cmd.CloudRequestID,
+		Cancelled:      true,
+		Stages:         cmd.timing.Stages(),
+	}
+
+	if err := s.client.CancelCommand(ctx, s.SessionID, cmd.CloudRequestID); err == nil {
+		s.client.Console.Printf("Cancelled queued command %s on device %s.\n", cmd.CloudRequestID, s.DeviceID)
+		return result, nil
+	}
+
+	if resource, err := cmd.sequence(ctx, 0); err == nil && resource != nil {
+		result.Stdout, _ = resource["stdout"].(string)
+		result.Stderr, _ = resource["stderr"].(string)
+		result.Complete, _ = resource["complete"].(bool)
+		result.Sequences = 1
+		s.client.normalizeResult(cmd, result)
+		if redactor := s.client.Redactor; redactor != nil {
+			result.Stdout, _ = redactor.Redact(result.Stdout)
+			result.Stderr, _ = redactor.Redact(result.Stderr)
+		}
+	}
+	if err := s.Delete(ctx); err != nil {
+		return result, fmt.Errorf("command %s could not be cancelled: %w", cmd.CloudRequestID, err)
+	}
+	s.client.Console.Printf("Cancelled command %s by deleting session %s on device %s.\n", cmd.CloudRequestID, s.SessionID, s.DeviceID)
+	return result, nil
+}
+
+// sequence fetches one sequence chunk of the command's status. It returns
+// a nil resource when the response carries none.
+func (cmd *Command) sequence(ctx context.Context, sequence int) (map[string]interface{}, error) {
+	c := cmd.session.client
+	headers := c.getHeaders("application/json", true)
+	params := url.Values{
+		"cloud_request_id": {cmd.CloudRequestID},
+		"sequence_id":      {strconv.Itoa(sequence)},
+	}
+	response, err := cmd.poll(ctx, headers, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get command status: %w", err)
+	}
+	return firstResource(response), nil
+}
+
+// poll gets the command's status. While the client's throttle is paused it
+// waits, and a throttled poll is made again once the pause is over.
+func (cmd *Command) poll(ctx context.Context, headers map[string]string, params url.Values) (map[string]interface{}, error) {
+	c := cmd.session.client
+	for {
+		if err := c.Throttle.Wait(ctx); err != nil {
+			return nil, err
+		}
+		response, err := c.makeAPICall(ctx, "GET", c.url(cmd.Endpoint, 0), headers, params, nil, nil)
+		c.Metrics.poll()
+		var apiErr *APIError
+		if c.Throttle != nil && errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+			c.Metrics.Retry()
+			continue
+		}
+		return response, err
+	}
+}
+
+// completed records the command's latency in the client's metrics, the
+// first time it is seen complete.
+func (cmd *Command) completed() {
+	cmd.measured.Do(func() { cmd.session.client.Metrics.command(cmd.session.client.clock().Now().Sub(cmd.issuedAt)) })
+}
+
+// firstResource returns resources[0] of an API response as a map, or nil.
+func firstResource(response map[string]interface{}) map[string]interface{} {
+	if resources, ok := response["resources"].([]interface{}); ok && len(resources) > 0 {
+		if resourceMap, ok := resources[0].(map[string]interface{}); ok {
+			return resourceMap
+		}
+	}
+	return nil
+}
+
+// quoteArg wraps an RTR command argument in double quotes so paths with spaces survive.
+// A POSIX path, one starting with /, is wrapped in single quotes instead, as
+// the Linux and macOS sensors take a backslash in it literally.
+func quoteArg(arg string) string {
+	if strings.HasPrefix(arg, "/") {
+		return shellQuote(arg)
+	}
+	return `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+}
@@ -0,0 +1,11 @@
+// Package falconrtr is a client for CrowdStrike Falcon Real Time Response:
+// authentication, host lookup, sessions, commands on the least-privileged
+// command endpoint, file retrieval and parsed output of common commands.
+//
+// A client is built from Options and holds all of its state, so several
+// clients, e.g. one per tenant, can be used side by side. See the Session
+// RunScript example for a whole collection.
+//
+// The client reports its progress to the console.Console in its Options;
+// without one, it prints nothing.
+package falconrtr
@@ -0,0 +1,175 @@
+package falconrtr
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Endpoint keys used with the endpoints registry and the endpoints config
+// overrides. The command endpoints are listed from least to most privileged.
+const (
+	EndpointToken                   = "token"
+	EndpointCCID                    = "ccid"
+	EndpointDevicesQuery            = "devices-query"
+	EndpointDevicesScroll           = "devices-scroll"
+	EndpointDevices                 = "devices"
+	EndpointSessions                = "sessions"
+	EndpointSessionsQuery           = "sessions-query"
+	EndpointSessionDetails          = "session-details"
+	EndpointRefreshSession          = "refresh-session"
+	EndpointAuditSessions           = "audit-sessions"
+	EndpointBatchInitSession        = "batch-init-session"
+	EndpointBatchGetCommand         = "batch-get-command"
+	ReadOnlyCommandEndpoint         = "command"
+	ActiveResponderCommandEndpoint  = "active-responder-command"
+	AdminCommandEndpoint            = "admin-command"
+	EndpointQueuedCommand           = "queued-command"
+	EndpointSessionFiles            = "session-files"
+	EndpointExtractedFileContents   = "extracted-file-contents"
+	EndpointScriptsQuery            = "scripts-query"
+	EndpointScripts                 = "scripts"
+	EndpointPutFilesQuery           = "put-files-query"
+	EndpointPutFiles                = "put-files"
+	EndpointMSSPChildrenQuery       = "mssp-children-query"
+	EndpointMSSPChildren            = "mssp-children"
+	EndpointSensorUpdateQuery       = "sensor-update-query"
+	EndpointRevealUninstallToken    = "reveal-uninstall-token"
+	EndpointSamples                 = "samples"
+	EndpointSampleUpload            = "sample-upload"
+	EndpointSandboxSubmissionsQuery = "sandbox-submissions-query"
+	EndpointSandboxSubmissions      = "sandbox-submissions"
+	EndpointSandboxReportSummaries  = "sandbox-report-summaries"
+)
+
+// endpoint is a registered API path. version is the default version
+// appended as /v<n>, or 0 for unversioned paths.
+type endpoint struct {
+	path     string
+	version  int
+	category string // CallBudget category
+}
+
+// endpoints is the registry of every API path the client calls. Region
+// switches only change BaseURL; version migrations only change this table.
+var endpoints = map[string]endpoint{
+	EndpointToken:                   {"/oauth2/token", 0, CallsAuth},
+	EndpointCCID:                    {"/sensors/queries/installers/ccid", 1, CallsHosts},
+	EndpointDevicesQuery:            {"/devices/queries/devices", 1, CallsHosts},
+	EndpointDevicesScroll:           {"/devices/queries/devices-scroll", 1, CallsHosts},
+	EndpointDevices:                 {"/devices/entities/devices", 2, CallsHosts},
+	EndpointSessions:                {"/real-time-response/entities/sessions", 1, CallsSessions},
+	EndpointSessionsQuery:           {"/real-time-response/queries/sessions", 1, CallsSessions},
+	EndpointSessionDetails:          {"/real-time-response/entities/sessions/GET", 1, CallsSessions},
+	EndpointRefreshSession:          {"/real-time-response/entities/refresh-session", 1, CallsSessions},
+	EndpointAuditSessions:           {"/real-time-response-audit/combined/sessions", 1, CallsSessions},
+	EndpointBatchInitSession:        {"/real-time-response/combined/batch-init-session", 1, CallsSessions},
+	EndpointBatchGetCommand:         {"/real-time-response/combined/batch-get-command", 1, CallsCommands},
+	ReadOnlyCommandEndpoint:         {"/real-time-response/entities/command", 1, CallsCommands},
+	ActiveResponderCommandEndpoint:  {"/real-time-response/entities/active-responder-command", 1, CallsCommands},
+	AdminCommandEndpoint:            {"/real-time-response/entities/admin-command", 1, CallsCommands},
+	EndpointQueuedCommand:           {"/real-time-response/entities/queued-sessions/command", 1, CallsCommands},
+	EndpointSessionFiles:            {"/real-time-response/entities/file", 2, CallsFileDownloads},
+	EndpointExtractedFileContents:   {"/real-time-response/entities/extracted-file-contents", 1, CallsFileDownloads},
+	EndpointScriptsQuery:            {"/real-time-response/queries/scripts", 1, CallsOther},
+	EndpointScripts:                 {"/real-time-response/entities/scripts", 1, CallsOther},
+	EndpointPutFilesQuery:           {"/real-time-response/queries/put-files", 1, CallsOther},
+	EndpointPutFiles:                {"/real-time-response/entities/put-files", 1, CallsOther},
+	EndpointMSSPChildrenQuery:       {"/mssp/queries/children", 1, CallsOther},
+	EndpointMSSPChildren:            {"/mssp/entities/children/GET", 2, CallsOther},
+	EndpointSensorUpdateQuery:       {"/policy/queries/sensor-update", 1, CallsOther},
+	EndpointRevealUninstallToken:    {"/policy/combined/reveal-uninstall-token", 1, CallsOther},
+	EndpointSamples:                 {"/samples/entities/samples", 3, CallsOther},
+	EndpointSampleUpload:            {"/samples/entities/samples", 2, CallsOther},
+	EndpointSandboxSubmissionsQuery: {"/falconx/queries/submissions", 1, CallsOther},
+	EndpointSandboxSubmissions:      {"/falconx/entities/submissions", 1, CallsOther},
+	EndpointSandboxReportSummaries:  {"/falconx/entities/report-summaries", 1, CallsOther},
+}
+
+// EndpointKeys lists the registered endpoint keys, sorted.
+func EndpointKeys() []string {
+	keys := make([]string, 0, len(endpoints))
+	for key := range endpoints {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateEndpointOverrides checks config overrides of endpoint paths.
+func validateEndpointOverrides(overrides map[string]string) error {
+	for key, path := range overrides {
+		if _, ok := endpoints[key]; !ok {
+			return fmt.Errorf("endpoints: unknown endpoint %q (known: %s)", key, strings.Join(EndpointKeys(), ", "))
+		}
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("endpoints.%s: path %q must start with /", key, path)
+		}
+		if strings.ContainsAny(path, "?#") {
+			return fmt.Errorf("endpoints.%s: path %q must not carry a query or fragment", key, path)
+		}
+	}
+	return nil
+}
+
+// url returns the full URL of the endpoint registered under key, joined with
+// the current BaseURL. version 0 selects the endpoint's default version. A
+// configured override replaces the path, whatever the version. Query
+// parameters are never part of it: pass them to makeAPICall as url.Values.
+func (c *CrowdStrikeRTRClient) url(key string, version int) string {
+	joined, err := url.JoinPath(c.BaseURL, c.endpointPath(key, version))
+	if err != nil {
+		// An unparsable BaseURL fails when the request is built.
+		return c.BaseURL + c.endpointPath(key, version)
+	}
+	return joined
+}
+
+// setQuery adds params to the query of u, encoding every value.
+func setQuery(u *url.URL, params url.Values) {
+	if len(params) == 0 {
+		return
+	}
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+}
+
+func (c *CrowdStrikeRTRClient) endpointPath(key string, version int) string {
+	if path, ok := c.EndpointOverrides[key]; ok {
+		return path
+	}
+	e, ok := endpoints[key]
+	if !ok {
+		// Keys are constants of this package; an unknown one is a bug.
+		panic(fmt.Sprintf("falconrtr: unknown endpoint %q", key))
+	}
+	if e.version == 0 {
+		return e.path
+	}
+	if version <= 0 {
+		version = e.version
+	}
+	return fmt.Sprintf("%s/v%d", e.path, version)
+}
+
+// callCategory maps a request path back to its endpoint's budget category.
+// Reads of a command endpoint are status polls.
+func (c *CrowdStrikeRTRClient) callCategory(method, path string) string {
+	for key, e := range endpoints {
+		if path != c.endpointPath(key, 0) && !(e.version > 0 && strings.HasPrefix(path, e.path+"/v")) {
+			continue
+		}
+		if e.category == CallsCommands && method == http.MethodGet {
+			return CallsStatusPolls
+		}
+		return e.category
+	}
+	return CallsOther
+}
@@ -0,0 +1,152 @@
+package falconrtr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+)
+
+// TestClientURL checks how URLs are built from the base URL, and then the
+// URL of every registered endpoint in every region against
+// testdata/endpoints.golden.txt. Run with -update to rewrite it after a
+// change to the registry.
+func TestClientURL(t *testing.T) {
+	tests := []struct {
+		baseURL   string
+		overrides map[string]string
+		key       string
+		version   int
+		want      string
+	}{
+		{"https://api.test", nil, EndpointDevicesQuery, 0, "https://api.test/devices/queries/devices/v1"},
+		{"https://api.test/", nil, EndpointDevicesQuery, 0, "https://api.test/devices/queries/devices/v1"},
+		{"https://proxy.test/crowdstrike/", nil, EndpointScripts, 0, "https://proxy.test/crowdstrike/real-time-response/entities/scripts/v1"},
+		{"https://api.test", nil, EndpointDevicesQuery, 2, "https://api.test/devices/queries/devices/v2"},
+		{"https://api.test", map[string]string{EndpointScripts: "/custom/scripts/v9"}, EndpointScripts, 0, "https://api.test/custom/scripts/v9"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			client := &CrowdStrikeRTRClient{BaseURL: strings.TrimRight(test.baseURL, "/"), EndpointOverrides: test.overrides}
+			if got := client.url(test.key, test.version); got != test.want {
+				t.Errorf("url = %s, want %s", got, test.want)
+			}
+		})
+	}
+
+	regions := make([]string, 0, len(config.Regions))
+	for region := range config.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	var got strings.Builder
+	for _, region := range regions {
+		client := &CrowdStrikeRTRClient{BaseURL: config.Regions[region]}
+		for _, key := range EndpointKeys() {
+			fmt.Fprintf(&got, "%-8s  %-31s  %s\n", region, key, client.url(key, 0))
+		}
+	}
+	golden := filepath.Join("testdata", "endpoints.golden.txt")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != string(want) {
+		t.Errorf("endpoint URLs differ from %s:\n%s", golden, got.String())
+	}
+}
+
+func TestSetQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		params url.Values
+		want   string
+	}{
+		{"none", "https://api.test/x?keep=1", nil, "keep=1"},
+		{"spaces and quotes", "https://api.test/x", url.Values{"filter": {"hostname:'WS 01'"}}, "filter=hostname%3A%27WS+01%27"},
+		{"plus signs", "https://api.test/x", url.Values{"filter": {"a+b"}}, "filter=a%2Bb"},
+		{"unicode", "https://api.test/x", url.Values{"filter": {"hostname:'Büro-PC'"}}, "filter=hostname%3A%27B%C3%BCro-PC%27"},
+		{"ampersand and equals", "https://api.test/x", url.Values{"name": {"a&b=c"}}, "name=a%26b%3Dc"},
+		{"repeated", "https://api.test/x", url.Values{"ids": {"a", "b"}}, "ids=a&ids=b"},
+		{"kept and sorted", "https://api.test/x?z=1", url.Values{"a": {"2"}}, "a=2&z=1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := url.Parse(test.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setQuery(u, test.params)
+			if u.RawQuery != test.want {
+				t.Errorf("query = %s, want %s", u.RawQuery, test.want)
+			}
+		})
+	}
+}
+
+func TestQuoteFQL(t *testing.T) {
+	tests := []struct{ value, want string }{
+		{"WS-01", `'WS-01'`},
+		{"O'Brien's PC", `'O\'Brien\'s PC'`},
+		{`C:\Temp`, `'C:\\Temp'`},
+		{`\'`, `'\\\''`},
+		{"Büro", `'Büro'`},
+	}
+	for _, test := range tests {
+		if got := QuoteFQL(test.value); got != test.want {
+			t.Errorf("QuoteFQL(%q) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+// TestRequestURIs checks the exact request URIs the client sends for
+// names and filters that need encoding.
+func TestRequestURIs(t *testing.T) {
+	var mu sync.Mutex
+	var uris []string
+	client := newTestClient(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		uris = append(uris, req.URL.RequestURI())
+		mu.Unlock()
+		body := `{"resources":[]}`
+		if strings.HasPrefix(req.URL.Path, "/real-time-response/queries/scripts") {
+			body = `{"resources":["id with/slash+plus"]}`
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+	}))
+	ctx := context.Background()
+
+	client.GetCloudScript(ctx, "O'Brien sweep+1 ü.ps1")
+	client.QueryDeviceIDs(ctx, "hostname:'WS 01'+platform_name:'Windows'", 10)
+
+	want := []string{
+		"/real-time-response/queries/scripts/v1?filter=name%3A%27O%5C%27Brien+sweep%2B1+%C3%BC.ps1%27",
+		"/real-time-response/entities/scripts/v1?ids=id+with%2Fslash%2Bplus",
+		"/devices/queries/devices/v1?filter=hostname%3A%27WS+01%27%2Bplatform_name%3A%27Windows%27&limit=10&offset=0",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(uris) != len(want) {
+		t.Fatalf("requests %v, want %v", uris, want)
+	}
+	for i := range want {
+		if uris[i] != want[i] {
+			t.Errorf("request %d = %s, want %s", i+1, uris[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package falconrtr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EventLogStageDir is the directory on the host event logs are exported to
+// before retrieval.
+const EventLogStageDir = `C:\Windows\Temp`
+
+// ErrUnsupportedPlatform is returned when a helper that only works on some
+// platforms is pointed at a host of another.
+var ErrUnsupportedPlatform = errors.New("unsupported platform")
+
+// EventLogFile is the outcome of collecting one channel: the retrieved
+// .evtx file, or the error that channel failed with.
+type EventLogFile struct {
+	Channel    string         `json:"channel"`
+	StagedPath string         `json:"staged_path"`
+	File       *RetrievedFile `json:"file,omitempty"`
+	Err        error          `json:"-"`
+}
+
+// CheckEventLogHosts refuses hosts that cannot export event logs, so a run
+// can reject them when it plans rather than once sessions are open. Hosts
+// whose platform is unknown pass; CollectEventLogs checks again.
+func CheckEventLogHosts(hosts []Host) error {
+	var others []string
+	for _, host := range hosts {
+		if host.Platform != "" && !strings.EqualFold(host.Platform, "Windows") {
+			others = append(others, fmt.Sprintf("%s (%s)", orDefault(host.Hostname, host.DeviceID), host.Platform))
+		}
+	}
+	if len(others) > 0 {
+		return fmt.Errorf("event logs can only be collected from Windows hosts: %w: %s", ErrUnsupportedPlatform, strings.Join(others, ", "))
+	}
+	return nil
+}
+
+// CollectEventLogs exports each event log channel on a Windows host to an
+// .evtx file under EventLogStageDir, retrieves it with GetFile, named from
+// the artifact template, and removes the staged copy. With since 0 the
+// whole channel is exported with the built-in eventlog backup command;
+// otherwise wevtutil epl runs through runscript with a query for the events
+// of the last since. A channel that fails is reported in its EventLogFile
+// and does not stop the others; the error is only set when the host is not
+// a Windows host.
+func (s *Session) CollectEventLogs(ctx context.Context, channels []string, since time.Duration) ([]EventLogFile, error) {
+	host, err := s.client.host(ctx, s.DeviceID)
+	if err != nil {
+		s.client.Console.Printf("Warning: platform of device %s unknown, assuming Windows: %v\n", s.DeviceID, err)
+	}
+	if err := CheckEventLogHosts([]Host{host}); err != nil {
+		return nil, err
+	}
+
+	files := make([]EventLogFile, 0, len(channels))
+	for _, channel := range channels {
+		file := EventLogFile{Channel: channel, StagedPath: joinRemotePath(EventLogStageDir, eventLogFileName(channel))}
+		file.File, file.Err = s.collectEventLog(ctx, channel, file.StagedPath, since)
+		if file.Err != nil {
+			s.client.Console.Printf("Failed to collect event log %s from device %s: %v\n", channel, s.DeviceID, file.Err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// collectEventLog exports one channel to stagedPath, retrieves it and
+// removes the staged file.
+func (s *Session) collectEventLog(ctx context.Context, channel, stagedPath string, since time.Duration) (*RetrievedFile, error) {
+	if err := s.runFileCommand(ctx, "rm", stagedPath, "rm "+quoteArg(stagedPath)); err != nil && !errors.Is(err, ErrRemoteFileNotFound) {
+		return nil, err
+	}
+	var err error
+	if since > 0 {
+		query := fmt.Sprintf("*[System[TimeCreated[timediff(@SystemTime) <= %d]]]", since.Milliseconds())
+		script := fmt.Sprintf("wevtutil epl %s %s %s /ow:true", psQuote(channel), psQuote(stagedPath), psQuote("/q:"+query))
+		err = s.runFileCommand(ctx, "runscript", channel, "runscript -Raw=```"+script+"```")
+	} else {
+		err = s.runFileCommand(ctx, "eventlog", channel, "eventlog backup "+quoteArg(channel)+" "+quoteArg(stagedPath))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to export event log %s: %w", channel, err)
+	}
+	defer func() {
+		if err := s.runFileCommand(context.Background(), "rm", stagedPath, "rm "+quoteArg(stagedPath)); err != nil {
+			s.client.Console.Printf("Warning: failed to remove %s from device %s: %v\n", stagedPath, s.DeviceID, err)
+		}
+	}()
+	return s.GetFile(ctx, stagedPath, 0)
+}
+
+// eventLogFileName names the staged export of channel: characters that
+// cannot appear in a Windows file name, and spaces, become dashes.
+func eventLogFileName(channel string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`\/:*?"<>| `, r) {
+			return '-'
+		}
+		return r
+	}, channel)
+	return "collector-" + name + ".evtx"
+}
+
+// psQuote wraps arg in single quotes for PowerShell.
+func psQuote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", "''") + "'"
+}
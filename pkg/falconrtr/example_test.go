@@ -0,0 +1,44 @@
+package falconrtr_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/simulate"
+)
+
+// The client here talks to the simulated API; a real one sets ClientID and
+// ClientSecret instead of Transport and Simulated.
+func ExampleSession_RunScript() {
+	ctx := context.Background()
+	client, err := falconrtr.NewCrowdStrikeRTRClient(falconrtr.Options{
+		Transport: simulate.New(simulate.Options{Outputs: map[string]string{"collect.ps1": "collected\n"}}),
+		BaseURL:   "https://api.crowdstrike.com",
+		Simulated: true,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := client.Authenticate(ctx); err != nil {
+		log.Fatal(err)
+	}
+	session, err := client.InitializeRTRSession(ctx, simulate.DefaultDevice.ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer session.Delete(context.Background())
+
+	command, err := session.RunScript(ctx, "collect.ps1")
+	if err != nil {
+		log.Fatal(err)
+	}
+	result, err := command.Wait(ctx, time.Minute)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(result.Stdout)
+	// Output: collected
+}
@@ -0,0 +1,301 @@
+package falconrtr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/postprocess"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// archivePassword is the fixed password CrowdStrike uses for retrieved-file archives.
+const archivePassword = "infected"
+
+// SessionFile is a file uploaded to the cloud from a host by a get command.
+type SessionFile struct {
+	Name           string `json:"name"`
+	SHA256         string `json:"sha256"`
+	Size           int64  `json:"size"`
+	CloudRequestID string `json:"cloud_request_id"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// RetrievedFile is a file downloaded from the cloud to local disk.
+type RetrievedFile struct {
+	RemotePath   string `json:"remote_path"`
+	ArchivePath  string `json:"archive_path"`         // The 7z archive as downloaded
+	LocalPath    string `json:"local_path,omitempty"` // The extracted file, once verified
+	NameTemplate string `json:"name_template"`        // The naming.artifact template LocalPath was named from
+	SHA256       string `json:"sha256"`
+	Size         int64  `json:"size"`
+	Verified     bool   `json:"verified"`
+
+	Stages []sink.Stage `json:"stages,omitempty"` // download and verify
+}
+
+// ListSessionFiles lists the files retrieved on the session.
+func (s *Session) ListSessionFiles(ctx context.Context) ([]SessionFile, error) {
+	headers := s.client.getHeaders("application/json", true)
+	params := url.Values{"session_id": {s.SessionID}}
+	response, err := s.client.makeAPICall(ctx, "GET", s.client.url(EndpointSessionFiles, 0), headers, params, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list session files: %w", err)
+	}
+
+	var files []SessionFile
+	resources, _ := response["resources"].([]interface{})
+	for _, resource := range resources {
+		resourceMap, ok := resource.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		file := SessionFile{}
+		file.Name, _ = resourceMap["name"].(string)
+		file.SHA256, _ = resourceMap["sha256"].(string)
+		file.CloudRequestID, _ = resourceMap["cloud_request_id"].(string)
+		file.CreatedAt, _ = resourceMap["created_at"].(string)
+		if size, ok := resourceMap["size"].(float64); ok {
+			file.Size = int64(size)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// GetFile retrieves remotePath from the host: it issues get, waits for the
+// upload to the cloud, downloads the archive into the client's DownloadDir
+// and verifies the extracted content against the SHA256 reported by the API.
+func (s *Session) GetFile(ctx context.Context, remotePath string, timeout time.Duration) (*RetrievedFile, error) {
+	result, err := s.RunCommand(ctx, "", "get", "get "+quoteArg(remotePath), timeout)
+	if err != nil {
+		return nil, err
+	}
+	if result.Stderr != "" {
+		return nil, fmt.Errorf("get %s failed on host: %s", remotePath, strings.TrimSpace(result.Stderr))
+	}
+
+	var file *SessionFile
+	for attempt := 0; file == nil; attempt++ {
+		files, err := s.ListSessionFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for i := range files {
+			if files[i].CloudRequestID == result.CloudRequestID {
+				file = &files[i]
+				break
+			}
+		}
+		if file != nil {
+			break
+		}
+		if attempt >= 30 {
+			return nil, fmt.Errorf("retrieved file for %s did not appear in the session file list", remotePath)
+		}
+		if err := sleep(ctx, s.client.clock(), DefaultPollInterval); err != nil {
+			return nil, err
+		}
+	}
+
+	retrieved, err := s.DownloadSessionFile(ctx, *file)
+	if retrieved != nil {
+		retrieved.RemotePath = remotePath
+	}
+	return retrieved, err
+}
+
+// DownloadSessionFile streams the archive for file to the client's
+// DownloadDir without buffering it in memory, then extracts it and verifies
+// its SHA256. The verification is mandatory: an error is returned when it
+// fails or when the 7z tool needed to open the archive is not installed.
+// The extracted file is named from the client's artifact template, and the
+// archive after it, with path separators turned into dashes and .7z added.
+func (s *Session) DownloadSessionFile(ctx context.Context, file SessionFile) (*RetrievedFile, error) {
+	dir := s.client.DownloadDir
+	if dir == "" {
+		dir = "downloads"
+	}
+
+	baseName := filepath.Base(strings.ReplaceAll(file.Name, `\`, "/"))
+	names := s.client.ArtifactNames
+	fields := s.client.fileFields(ctx, names.Template, s.DeviceID)
+	fields.Command, fields.SHA256, fields.CloudRequestID = "get", file.SHA256, file.CloudRequestID
+	fields.Ext = filepath.Ext(baseName)
+	fields.Name = strings.TrimSuffix(baseName, fields.Ext)
+	localPath, err := names.Path(dir, fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to name retrieved file %s: %w", file.Name, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create download directory: %w", err)
+	}
+	relative, _ := filepath.Rel(dir, localPath)
+	archivePath := filepath.Join(dir, strings.ReplaceAll(filepath.ToSlash(relative), "/", "-")+".7z")
+
+	params := url.Values{
+		"session_id": {s.SessionID},
+		"sha256":     {file.SHA256},
+		"filename":   {baseName + ".7z"},
+	}
+	var timing sink.Timing
+	start := time.Now()
+	size, err := s.client.downloadToFile(ctx, s.client.url(EndpointExtractedFileContents, 0), params, archivePath)
+	if err != nil {
+		return nil, err
+	}
+	timing.Record("download", start)
+
+	retrieved := &RetrievedFile{ArchivePath: archivePath, NameTemplate: names.Template.Text, SHA256: file.SHA256, Size: size}
+	start = time.Now()
+	err = extractTo(ctx, archivePath, localPath, file.SHA256)
+	timing.Record("verify", start)
+	retrieved.Stages = timing.Stages()
+	if err != nil {
+		return retrieved, err
+	}
+	retrieved.LocalPath = localPath
+	retrieved.Verified = true
+	s.client.Console.Printf("Retrieved %s (%d bytes, SHA256 %s verified) to %s\n", file.Name, size, file.SHA256, localPath)
+	if s.client.PostProcess != nil {
+		// Processing runs in the background and outlives ctx, which may
+		// only bound this retrieval; the pipeline's Findings collect it.
+		s.client.PostProcess.Submit(context.WithoutCancel(ctx), localPath, postprocess.Meta{DeviceID: s.DeviceID, RemotePath: file.Name, SHA256: file.SHA256, Size: size})
+	}
+	return retrieved, nil
+}
+
+// extractTo extracts and verifies the archive in a scratch directory next
+// to localPath, then moves the verified file to localPath.
+func extractTo(ctx context.Context, archivePath, localPath, expectedSHA256 string) error {
+	scratch, err := os.MkdirTemp(filepath.Dir(localPath), ".extract-")
+	if err != nil {
+		return fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+	defer os.RemoveAll(scratch)
+	extracted, err := extractAndVerify(ctx, archivePath, scratch, expectedSHA256)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(extracted, localPath); err != nil {
+		return fmt.Errorf("failed to move retrieved file to %s: %w", localPath, err)
+	}
+	return nil
+}
+
+// downloadToFile streams a GET response body to path and returns the byte count.
+func (c *CrowdStrikeRTRClient) downloadToFile(ctx context.Context, url string, params url.Values, path string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	for key, value := range c.getHeaders("application/json", true) {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("accept", "application/x-7z-compressed")
+	setQuery(req.URL, params)
+
+	if c.Budget != nil {
+		if err := c.Budget.allow(req.Method, c.callCategory(req.Method, req.URL.Path)); err != nil {
+			return 0, err
+		}
+	}
+	if err := c.Rate.Wait(ctx); err != nil {
+		return 0, err
+	}
+	release, err := c.acquireDownload(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	c.Metrics.call(req.Method, req.URL.Path)
+	// Downloads can outlast the API client's request timeout; ctx bounds them instead.
+	downloadClient := &http.Client{Transport: c.HTTPClient.Transport}
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		meta := errorMeta(resp.Header, body)
+		c.observeMeta(req.Method, req.URL.Path, meta)
+		return 0, &APIError{StatusCode: resp.StatusCode, Body: string(body), TraceID: meta.TraceID}
+	}
+
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer out.Close()
+
+	// The bytes count as downloaded as they arrive, for live views of the run.
+	progress := c.Metrics.startDownload(filepath.Base(path), resp.ContentLength)
+	defer c.Metrics.endDownload(progress)
+	size, err := io.Copy(out, io.TeeReader(resp.Body, downloadCounter{c.Metrics, progress}))
+	if err != nil {
+		return size, fmt.Errorf("failed to download to %s: %w", path, err)
+	}
+	return size, nil
+}
+
+// extractAndVerify unpacks a retrieved-file archive with 7z into dir and checks
+// that the extracted file matches expectedSHA256.
+func extractAndVerify(ctx context.Context, archivePath, dir, expectedSHA256 string) (string, error) {
+	sevenZip, err := exec.LookPath("7z")
+	if err != nil {
+		return "", fmt.Errorf("cannot verify %s: the 7z tool is required to extract retrieved files", archivePath)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, sevenZip, "x", "-y", "-p"+archivePassword, "-o"+dir, archivePath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to extract %s: %v: %s", archivePath, err, strings.TrimSpace(string(output)))
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read extraction directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return "", err
+		}
+		if strings.EqualFold(sum, expectedSHA256) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("SHA256 verification failed: no file extracted from %s matches %s", archivePath, expectedSHA256)
+}
+
+// fileSHA256 hashes a file by streaming it.
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
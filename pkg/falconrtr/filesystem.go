@@ -0,0 +1,359 @@
+package falconrtr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// ErrRemoteFileNotFound is returned when a path does not exist on the host.
+var ErrRemoteFileNotFound = errors.New("remote file not found")
+
+// ErrRemoteFileTooLarge is returned by ReadFile for files over its size limit.
+var ErrRemoteFileTooLarge = errors.New("remote file exceeds the size limit")
+
+// DefaultReadFileMaxBytes bounds ReadFile when no limit is given.
+const DefaultReadFileMaxBytes = 1 << 20
+
+// FileEntry is one entry of parsed ls output. Size is -1 for directories and
+// when the host does not report it. Attributes holds the POSIX mode string,
+// or the type column on Windows. ModTime is in UTC and zero when unparsed.
+type FileEntry struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mtime,omitempty"`
+	Attributes string    `json:"attributes,omitempty"`
+	IsDir      bool      `json:"is_dir"`
+}
+
+// FileHashes are the digests reported by filehash.
+type FileHashes struct {
+	Path   string `json:"path"`
+	MD5    string `json:"md5,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// List runs ls on a remote directory and parses the entries. "." and ".."
+// are left out.
+func (s *Session) List(ctx context.Context, path string) ([]FileEntry, error) {
+	result, err := s.RunCommand(ctx, "", "ls", "ls "+quoteArg(path), 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := remoteFileError("ls", path, result.Stderr); err != nil {
+		return nil, err
+	}
+	return ParseFileList(path, result.Stdout)
+}
+
+// Stat returns the entry for a single remote path by listing its parent
+// directory.
+func (s *Session) Stat(ctx context.Context, path string) (*FileEntry, error) {
+	dir, name := splitRemotePath(path)
+	if name == "" {
+		return &FileEntry{Name: path, Path: path, Size: -1, IsDir: true}, nil
+	}
+	entries, err := s.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	windows := isWindowsPath(path)
+	for _, entry := range entries {
+		if entry.Name == name || (windows && strings.EqualFold(entry.Name, name)) {
+			return &entry, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", path, ErrRemoteFileNotFound)
+}
+
+// FileHash runs filehash on a remote file.
+func (s *Session) FileHash(ctx context.Context, path string) (*FileHashes, error) {
+	result, err := s.RunCommand(ctx, "", "filehash", "filehash "+quoteArg(path), 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := remoteFileError("filehash", path, result.Stderr); err != nil {
+		return nil, err
+	}
+	hashes := ParseFileHash(result.Stdout)
+	if hashes.MD5 == "" && hashes.SHA256 == "" {
+		return nil, fmt.Errorf("filehash %s returned no digests", path)
+	}
+	hashes.Path = path
+	return &hashes, nil
+}
+
+// ReadFile returns the contents of a remote file through cat. Files larger
+// than maxBytes (DefaultReadFileMaxBytes when 0) are refused with
+// ErrRemoteFileTooLarge before cat runs.
+func (s *Session) ReadFile(ctx context.Context, path string, maxBytes int64) (string, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultReadFileMaxBytes
+	}
+	entry, err := s.Stat(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if entry.IsDir {
+		return "", fmt.Errorf("cannot read %s: it is a directory", path)
+	}
+	if entry.Size > maxBytes {
+		return "", fmt.Errorf("%s is %d bytes: %w of %d bytes", path, entry.Size, ErrRemoteFileTooLarge, maxBytes)
+	}
+
+	result, err := s.RunCommand(ctx, "", "cat", "cat "+quoteArg(path), 0)
+	if err != nil {
+		return "", err
+	}
+	if err := remoteFileError("cat", path, result.Stderr); err != nil {
+		return "", err
+	}
+	// The file may have grown since it was listed.
+	if int64(len(result.Stdout)) > maxBytes {
+		s.warn(sink.WarningOutputTruncated, "%s grew past %d bytes while being read; returning the first %d", path, maxBytes, maxBytes)
+		return result.Stdout[:maxBytes], nil
+	}
+	return result.Stdout, nil
+}
+
+// remoteFileError turns a command's stderr into an error, mapping missing
+// paths to ErrRemoteFileNotFound.
+func remoteFileError(command, path, stderr string) error {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return nil
+	}
+	if reason, _ := ClassifyFailure(stderr); reason == FailurePathNotFound {
+		return fmt.Errorf("%s %s: %w: %s", command, path, ErrRemoteFileNotFound, stderr)
+	}
+	return fmt.Errorf("%s %s failed on host: %s", command, path, stderr)
+}
+
+var (
+	// posixListLine matches ls -l style rows: mode, links, owner, group,
+	// size, date and the name as the remainder.
+	posixListLine = regexp.MustCompile(`^([-bcdlps][-rwxsStT]{9}[@+.]?)\s+\d+\s+\S+\s+\S+\s+(\d+)\s+([A-Z][a-z]{2}\s+\d{1,2}\s+(?:\d{1,2}:\d{2}|\d{4}))\s(.*)$`)
+	// windowsZone matches the offset in headers such as "Last Modified (UTC-5)".
+	windowsZone = regexp.MustCompile(`\(UTC([+-]\d{1,2})?(?::(\d{2}))?\)`)
+)
+
+// ParseFileList parses ls output from Windows (the RTR column layout) or
+// Linux/macOS (ls -l rows) listing dir.
+func ParseFileList(dir, output string) ([]FileEntry, error) {
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	for i := 1; i < len(lines); i++ {
+		if isUnderline(lines[i]) && strings.TrimSpace(lines[i-1]) != "" {
+			return parseWindowsList(dir, lines[i-1], lines[i], lines[i+1:]), nil
+		}
+	}
+
+	entries := []FileEntry{}
+	matched := false
+	for _, line := range lines {
+		match := posixListLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		matched = true
+		name := match[4]
+		if match[1][0] == 'l' {
+			name, _, _ = strings.Cut(name, " -> ")
+		}
+		if name == "." || name == ".." {
+			continue
+		}
+		entry := FileEntry{
+			Name:       name,
+			Path:       joinRemotePath(dir, name),
+			Attributes: match[1],
+			IsDir:      match[1][0] == 'd',
+			ModTime:    parsePosixTime(match[3]),
+		}
+		entry.Size, _ = strconv.ParseInt(match[2], 10, 64)
+		if entry.IsDir {
+			entry.Size = -1
+		}
+		entries = append(entries, entry)
+	}
+	if !matched && strings.TrimSpace(output) != "" && !strings.HasPrefix(strings.TrimSpace(output), "total") {
+		return nil, fmt.Errorf("ls output for %s is in an unrecognized format", dir)
+	}
+	return entries, nil
+}
+
+// parseWindowsList splits rows at the columns marked by the dashed underline.
+// Offsets are counted in runes, as PowerShell pads by characters, so
+// non-ASCII names do not shift the columns.
+func parseWindowsList(dir, header, underline string, rows []string) []FileEntry {
+	underlineRunes := []rune(underline)
+	var starts []int
+	for i, r := range underlineRunes {
+		if r == '-' && (i == 0 || underlineRunes[i-1] == ' ') {
+			starts = append(starts, i)
+		}
+	}
+	cell := func(line []rune, column int) string {
+		if column >= len(starts) || starts[column] >= len(line) {
+			return ""
+		}
+		end := len(line)
+		if column+1 < len(starts) && starts[column+1] < end {
+			end = starts[column+1]
+		}
+		return strings.TrimSpace(string(line[starts[column]:end]))
+	}
+
+	headerRunes := []rune(header)
+	column := map[string]int{}
+	zone := time.UTC
+	for i := range starts {
+		name := strings.ToLower(cell(headerRunes, i))
+		switch {
+		case name == "name", name == "type":
+			column[name] = i
+		case strings.HasPrefix(name, "size (bytes)"), name == "size", name == "length":
+			column["size"] = i
+		case strings.HasPrefix(name, "last modified"), strings.HasPrefix(name, "lastwritetime"):
+			column["mtime"] = i
+			if match := windowsZone.FindStringSubmatch(cell(headerRunes, i)); match != nil && match[1] != "" {
+				hours, _ := strconv.Atoi(match[1])
+				minutes, _ := strconv.Atoi(match[2])
+				if hours < 0 {
+					minutes = -minutes
+				}
+				zone = time.FixedZone("host", hours*3600+minutes*60)
+			}
+		}
+	}
+	nameColumn, ok := column["name"]
+	if !ok {
+		nameColumn = 0
+	}
+
+	entries := []FileEntry{}
+	for _, row := range rows {
+		if strings.TrimSpace(row) == "" {
+			continue
+		}
+		line := []rune(row)
+		entry := FileEntry{Name: cell(line, nameColumn), Size: -1}
+		if entry.Name == "" || entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+		entry.Path = joinRemotePath(dir, entry.Name)
+		if i, ok := column["type"]; ok {
+			entry.Attributes = cell(line, i)
+			entry.IsDir = strings.EqualFold(entry.Attributes, "<Directory>")
+		}
+		if i, ok := column["size"]; ok && !entry.IsDir {
+			if size, err := strconv.ParseInt(strings.ReplaceAll(cell(line, i), ",", ""), 10, 64); err == nil {
+				entry.Size = size
+			}
+		}
+		if i, ok := column["mtime"]; ok {
+			entry.ModTime = parseWindowsTime(cell(line, i), zone)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// isUnderline reports whether line consists of dash runs separated by spaces.
+func isUnderline(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, "--") && strings.Trim(trimmed, "- ") == ""
+}
+
+func parseWindowsTime(value string, zone *time.Location) time.Time {
+	for _, layout := range []string{"1/2/2006 3:04:05 PM", "1/2/2006 15:04:05", "2006-01-02 15:04:05"} {
+		if parsed, err := time.ParseInLocation(layout, value, zone); err == nil {
+			return parsed.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// parsePosixTime parses ls -l dates, which carry a time for the last six
+// months and a year otherwise. Host timezones are not reported, so the time
+// is taken as UTC.
+func parsePosixTime(value string) time.Time {
+	value = strings.Join(strings.Fields(value), " ")
+	if parsed, err := time.Parse("Jan 2 2006", value); err == nil {
+		return parsed
+	}
+	parsed, err := time.Parse("Jan 2 15:04", value)
+	if err != nil {
+		return time.Time{}
+	}
+	now := time.Now().UTC()
+	parsed = parsed.AddDate(now.Year(), 0, 0)
+	if parsed.After(now.AddDate(0, 0, 1)) {
+		parsed = parsed.AddDate(-1, 0, 0)
+	}
+	return parsed
+}
+
+var hexDigest = regexp.MustCompile(`\b(?:[0-9A-Fa-f]{64}|[0-9A-Fa-f]{32})\b`)
+
+// ParseFileHash picks the MD5 and SHA256 digests out of filehash output,
+// whatever the layout, by their length.
+func ParseFileHash(output string) FileHashes {
+	var hashes FileHashes
+	for _, digest := range hexDigest.FindAllString(output, -1) {
+		digest = strings.ToLower(digest)
+		if len(digest) == 64 && hashes.SHA256 == "" {
+			hashes.SHA256 = digest
+		} else if len(digest) == 32 && hashes.MD5 == "" {
+			hashes.MD5 = digest
+		}
+	}
+	return hashes
+}
+
+// isWindowsPath reports whether path uses Windows syntax: a drive letter, a
+// UNC prefix or backslash separators.
+func isWindowsPath(path string) bool {
+	return strings.Contains(path, `\`) || (len(path) >= 2 && path[1] == ':')
+}
+
+// splitRemotePath splits path into its directory and final element. The
+// element is empty for roots such as C:\ and /; a bare name is taken to be
+// in the session's working directory.
+func splitRemotePath(path string) (dir, name string) {
+	separators := "/"
+	if isWindowsPath(path) {
+		separators = `\/`
+	}
+	trimmed := strings.TrimRight(path, separators)
+	i := strings.LastIndexAny(trimmed, separators)
+	if i < 0 {
+		if trimmed == "" || strings.HasSuffix(trimmed, ":") {
+			return path, ""
+		}
+		return ".", trimmed
+	}
+	dir = trimmed[:i]
+	if strings.Trim(dir, separators) == "" || strings.HasSuffix(dir, ":") {
+		dir = trimmed[:i+1]
+	}
+	return dir, trimmed[i+1:]
+}
+
+// joinRemotePath appends name to dir with the separator dir's syntax uses.
+func joinRemotePath(dir, name string) string {
+	separator := "/"
+	if isWindowsPath(dir) {
+		separator = `\`
+	}
+	if strings.HasSuffix(dir, separator) || strings.HasSuffix(dir, "/") {
+		return dir + name
+	}
+	return dir + separator + name
+}
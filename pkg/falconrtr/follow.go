@@ -0,0 +1,53 @@
+package falconrtr
+
+import (
+	"io"
+	"strings"
+)
+
+// follower writes a command's stdout to a Command's Follow writer as Wait
+// sees it grow. It only writes whole lines, each redacted on its own, so a
+// secret is never split across two writes; the unfinished last line is held
+// back until it ends or the output is complete. It only reads the output:
+// the result Wait assembles is the same with or without it.
+type follower struct {
+	w        io.Writer
+	redactor *Redactor
+	written  int // Bytes of the stream already written
+}
+
+// update writes the whole lines of stream, the output so far, that were not
+// written yet. A stream shorter than what was written, as when a poll sees
+// the output of a re-run command, starts over.
+func (f *follower) update(stream string) {
+	if f == nil {
+		return
+	}
+	if len(stream) < f.written {
+		f.written = 0
+	}
+	if end := strings.LastIndexByte(stream, '\n') + 1; end > f.written {
+		f.write(stream[f.written:end])
+		f.written = end
+	}
+}
+
+// finish writes the rest of stream, the complete output, ending it with a
+// newline.
+func (f *follower) finish(stream string) {
+	if f == nil {
+		return
+	}
+	f.update(stream)
+	if rest := stream[min(f.written, len(stream)):]; rest != "" {
+		f.write(rest + "\n")
+		f.written = len(stream)
+	}
+}
+
+func (f *follower) write(text string) {
+	if f.redactor != nil {
+		text, _ = f.redactor.Redact(text)
+	}
+	io.WriteString(f.w, text)
+}
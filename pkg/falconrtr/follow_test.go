@@ -0,0 +1,87 @@
+package falconrtr
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCommandFollow serves a command whose stdout grows from poll to poll
+// and checks what Command.Follow is given: whole lines in order, each once,
+// redacted, and the rest of the output at the end.
+func TestCommandFollow(t *testing.T) {
+	tests := []struct {
+		name     string
+		polls    []string // stdout of the incomplete polls
+		complete string   // stdout of the poll that completes
+		chunks   []string // stdout of sequences 1 and on
+		want     string
+	}{
+		{
+			name:     "growing output",
+			polls:    []string{"", "line one\npart", "line one\npartial two\npass hunter2\n"},
+			complete: "line one\npartial two\npass hunter2\nlast",
+			want:     "line one\npartial two\npass [REDACTED:password]\nlast\n",
+		},
+		{
+			name:     "sequence chunks",
+			polls:    []string{"first\n"},
+			complete: "first\nsec",
+			chunks:   []string{"ond\nthi", "rd\n"},
+			want:     "first\nsecond\nthird\n",
+		},
+		{
+			name:     "re-run command starts over",
+			polls:    []string{"a\nb\n", "a\n"},
+			complete: "a\nb\n",
+			want:     "a\nb\na\nb\n",
+		},
+		{
+			name:     "no output",
+			complete: "",
+			want:     "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			polls := 0
+			client := newTestClient(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				sequence, _ := strconv.Atoi(req.URL.Query().Get("sequence_id"))
+				var resource map[string]interface{}
+				switch {
+				case sequence == 0 && polls < len(test.polls):
+					resource = map[string]interface{}{"complete": false, "stdout": test.polls[polls]}
+					polls++
+				case sequence == 0:
+					resource = map[string]interface{}{"complete": true, "stdout": test.complete}
+				case sequence <= len(test.chunks):
+					resource = map[string]interface{}{"complete": true, "stdout": test.chunks[sequence-1]}
+				default:
+					return &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{"errors":[{"message":"no such sequence"}]}`)), Request: req}, nil
+				}
+				body, _ := json.Marshal(map[string]interface{}{"resources": []interface{}{resource}})
+				return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(string(body))), Request: req}, nil
+			}))
+			client.Redactor.AddSecret("password", "hunter2")
+			session := &Session{client: client, DeviceID: "device", SessionID: "session"}
+			var followed strings.Builder
+			cmd := &Command{session: session, Endpoint: ReadOnlyCommandEndpoint, CloudRequestID: "request", PollStrategy: FixedPoll{Interval: time.Millisecond}, Follow: &followed}
+
+			result, err := cmd.Wait(context.Background(), time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := followed.String(); got != test.want {
+				t.Errorf("followed %q, want %q", got, test.want)
+			}
+			if strings.Contains(result.Stdout, "hunter2") {
+				t.Errorf("result stdout %q is not redacted", result.Stdout)
+			}
+		})
+	}
+}
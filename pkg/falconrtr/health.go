@@ -0,0 +1,116 @@
+package falconrtr
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// HealthCheck is the outcome of one connectivity or credential check.
+type HealthCheck struct {
+	Name      string `json:"name"`
+	Passed    bool   `json:"passed"`
+	Skipped   bool   `json:"skipped,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// HealthReport groups the checks run by HealthCheck.
+type HealthReport struct {
+	BaseURL   string        `json:"base_url"`
+	Passed    bool          `json:"passed"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Checks    []HealthCheck `json:"checks"`
+}
+
+// HealthCheck verifies that the collector can reach and authenticate against
+// the CrowdStrike API without touching any endpoint. It runs, in order:
+// dns, tls, auth, api (a one-result device query) and scopes (a one-result
+// RTR session query). Checks after the first failure are reported as skipped.
+func (c *CrowdStrikeRTRClient) HealthCheck(ctx context.Context) *HealthReport {
+	report := &HealthReport{BaseURL: c.BaseURL, Passed: true, CheckedAt: time.Now().UTC()}
+
+	host := ""
+	if parsed, err := url.Parse(c.BaseURL); err == nil {
+		host = parsed.Hostname()
+	}
+	port := "443"
+	if parsed, err := url.Parse(c.BaseURL); err == nil && parsed.Port() != "" {
+		port = parsed.Port()
+	}
+
+	steps := []struct {
+		name string
+		run  func(ctx context.Context) (string, error)
+	}{
+		{"dns", func(ctx context.Context) (string, error) {
+			addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s resolves to %v", host, addrs), nil
+		}},
+		{"tls", func(ctx context.Context) (string, error) {
+			dialer := &tls.Dialer{Config: &tls.Config{ServerName: host}}
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+			if err != nil {
+				return "", err
+			}
+			defer conn.Close()
+			state := conn.(*tls.Conn).ConnectionState()
+			if len(state.PeerCertificates) == 0 {
+				return "TLS handshake completed", nil
+			}
+			return fmt.Sprintf("certificate valid until %s", state.PeerCertificates[0].NotAfter.UTC().Format(time.RFC3339)), nil
+		}},
+		{"auth", func(ctx context.Context) (string, error) {
+			if err := c.Authenticate(ctx); err != nil {
+				return "", err
+			}
+			return "access token obtained", nil
+		}},
+		{"api", func(ctx context.Context) (string, error) {
+			headers := c.getHeaders("application/json", true)
+			params := url.Values{"limit": {"1"}}
+			if _, err := c.makeAPICall(ctx, "GET", c.url(EndpointDevicesQuery, 0), headers, params, nil, nil); err != nil {
+				return "", fmt.Errorf("device query failed (requires Hosts: Read): %w", err)
+			}
+			return "device query succeeded", nil
+		}},
+		{"scopes", func(ctx context.Context) (string, error) {
+			headers := c.getHeaders("application/json", true)
+			params := url.Values{"limit": {"1"}}
+			if _, err := c.makeAPICall(ctx, "GET", c.url(EndpointSessionsQuery, 0), headers, params, nil, nil); err != nil {
+				return "", fmt.Errorf("RTR session query failed (requires Real time response: Read): %w", err)
+			}
+			return "RTR read access confirmed", nil
+		}},
+	}
+
+	for _, step := range steps {
+		check := HealthCheck{Name: step.name}
+		if !report.Passed {
+			check.Skipped = true
+			check.Detail = "skipped after earlier failure"
+			report.Checks = append(report.Checks, check)
+			continue
+		}
+
+		start := time.Now()
+		detail, err := step.run(ctx)
+		check.LatencyMS = time.Since(start).Milliseconds()
+		if err != nil {
+			check.Detail = err.Error()
+			report.Passed = false
+		} else {
+			check.Passed = true
+			check.Detail = detail
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	return report
+}
@@ -0,0 +1,88 @@
+package falconrtr
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// ClockScripts print the host's clock and timezone by platform, run through
+// runscript -Raw: host_time_ms=<Unix milliseconds>, timezone=<zone name>
+// and utc_offset=<+hhmm>, one per line, and resolution_ms=<ms> where the
+// clock is only read to the second. They change nothing on the host.
+var ClockScripts = map[string]string{
+	PlatformWindows: `"host_time_ms=$([DateTimeOffset]::UtcNow.ToUnixTimeMilliseconds())"; ` +
+		`"timezone=$([TimeZoneInfo]::Local.Id)"; "utc_offset=$((Get-Date).ToString('zzz').Replace(':', ''))"`,
+	PlatformLinux: `echo "host_time_ms=$(date +%s%3N)"; ` +
+		`echo "timezone=$(cat /etc/timezone 2>/dev/null || readlink /etc/localtime | sed 's|.*/zoneinfo/||')"; echo "utc_offset=$(date +%z)"`,
+	PlatformMac: `echo "host_time_ms=$(($(date +%s) * 1000))"; echo "resolution_ms=1000"; ` +
+		`echo "timezone=$(readlink /etc/localtime | sed 's|.*/zoneinfo/||')"; echo "utc_offset=$(date +%z)"`,
+}
+
+// ClockCommand returns the runscript command string reading the clock of
+// platform's hosts, or "" when there is no script for the platform.
+func ClockCommand(platform string) string {
+	script := ClockScripts[platform]
+	if script == "" {
+		return ""
+	}
+	return "runscript -Raw=```" + script + "```"
+}
+
+// CaptureClock reads the host's clock and timezone with one command and
+// estimates its skew against the collector's clock. The host read its
+// clock some time between the command being issued and its result
+// arriving, so the skew is taken against the midpoint of the two, and
+// half the round trip, plus the host clock's resolution, bounds the
+// error. timeout bounds the wait (one minute if 0).
+func (s *Session) CaptureClock(ctx context.Context, timeout time.Duration) (sink.HostClock, error) {
+	platform := s.knownPlatform()
+	if platform == "" {
+		platform = s.platform(ctx)
+	}
+	commandString := ClockCommand(platform)
+	if commandString == "" {
+		return sink.HostClock{}, fmt.Errorf("no clock script for the platform %q of device %s", platform, s.DeviceID)
+	}
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+
+	s.client.Console.Printf("Reading the clock of device %s...\n", s.DeviceID)
+	clock := s.client.clock()
+	issued := clock.Now()
+	result, err := s.RunCommand(ctx, "", "runscript", commandString, timeout)
+	answered := clock.Now()
+	if err != nil {
+		return sink.HostClock{}, fmt.Errorf("clock capture failed on device %s: %w", s.DeviceID, err)
+	}
+	if len(result.Errors) > 0 {
+		return sink.HostClock{}, fmt.Errorf("clock capture failed on device %s: %s", s.DeviceID, FormatResourceErrors(result.Errors))
+	}
+
+	values := map[string]string{}
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+	hostMS, err := strconv.ParseInt(values["host_time_ms"], 10, 64)
+	if err != nil {
+		return sink.HostClock{}, fmt.Errorf("clock capture on device %s reported no host_time_ms (stdout %q, stderr %q)", s.DeviceID, result.Stdout, result.Stderr)
+	}
+	resolution, _ := strconv.ParseInt(values["resolution_ms"], 10, 64)
+	hostTime := time.UnixMilli(hostMS).Add(time.Duration(resolution) * time.Millisecond / 2)
+	roundTrip := answered.Sub(issued)
+	midpoint := issued.Add(roundTrip / 2)
+	return sink.HostClock{
+		HostTime:      sink.FormatTime(hostTime),
+		Timezone:      values["timezone"],
+		UTCOffset:     values["utc_offset"],
+		SkewMS:        hostTime.Sub(midpoint).Milliseconds(),
+		UncertaintyMS: (roundTrip / 2).Milliseconds() + resolution/2,
+	}, nil
+}
@@ -0,0 +1,159 @@
+package falconrtr
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Kinds of asset identifiers that can be resolved to devices.
+const (
+	IdentifierSerial = "serial"
+	IdentifierMAC    = "mac"
+)
+
+// identifierBatch bounds the identifiers looked up with one FQL filter.
+const identifierBatch = 100
+
+// Identifier is a serial number or MAC address from an asset inventory.
+// Source says where it was given, e.g. "target.serials[2]" or
+// "inventory.txt:14", so unresolved identifiers can be traced back.
+type Identifier struct {
+	Kind   string
+	Value  string
+	Source string
+}
+
+// IdentifierMatch is the outcome of resolving one Identifier. Normalized is
+// the value the devices were queried with; Hosts holds every device that
+// carries it, so more than one means the identifier is ambiguous.
+type IdentifierMatch struct {
+	Identifier
+	Normalized string
+	Hosts      []Host
+}
+
+// NormalizeMAC returns mac in the form the devices API stores it: lower
+// case hex pairs separated by dashes, e.g. "00-50-56-ab-cd-ef". Colons,
+// dashes, dots and no separators at all are accepted.
+func NormalizeMAC(mac string) (string, error) {
+	digits := strings.ToLower(strings.NewReplacer(":", "", "-", "", ".", "").Replace(strings.TrimSpace(mac)))
+	if len(digits) != 12 || strings.Trim(digits, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid MAC address %q", mac)
+	}
+	pairs := make([]string, 0, 6)
+	for i := 0; i < len(digits); i += 2 {
+		pairs = append(pairs, digits[i:i+2])
+	}
+	return strings.Join(pairs, "-"), nil
+}
+
+// Normalize returns the value id is queried and matched with: the serial
+// number in upper case, or the MAC address as NormalizeMAC returns it.
+func (id Identifier) Normalize() (string, error) {
+	switch id.Kind {
+	case IdentifierSerial:
+		serial := strings.TrimSpace(id.Value)
+		if serial == "" {
+			return "", fmt.Errorf("%s: empty serial number", id.Source)
+		}
+		return strings.ToUpper(serial), nil
+	case IdentifierMAC:
+		mac, err := NormalizeMAC(id.Value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", id.Source, err)
+		}
+		return mac, nil
+	}
+	return "", fmt.Errorf("%s: unknown identifier kind %q (want %s or %s)", id.Source, id.Kind, IdentifierSerial, IdentifierMAC)
+}
+
+// ResolveIdentifiers looks up the devices carrying each identifier through
+// the serial_number and mac_address fields of the devices API. The matches
+// are returned in the order of identifiers; an identifier no device carries
+// has no Hosts. Invalid identifiers fail the whole lookup.
+func (c *CrowdStrikeRTRClient) ResolveIdentifiers(ctx context.Context, identifiers []Identifier) ([]IdentifierMatch, error) {
+	matches := make([]IdentifierMatch, len(identifiers))
+	wanted := map[string][]string{}
+	seen := map[string]bool{}
+	for i, id := range identifiers {
+		normalized, err := id.Normalize()
+		if err != nil {
+			return nil, err
+		}
+		matches[i] = IdentifierMatch{Identifier: id, Normalized: normalized}
+		if key := id.Kind + "=" + normalized; !seen[key] {
+			seen[key] = true
+			wanted[id.Kind] = append(wanted[id.Kind], normalized)
+		}
+	}
+
+	found := map[string][]Host{}
+	for _, lookup := range []struct{ kind, field string }{{IdentifierSerial, "serial_number"}, {IdentifierMAC, "mac_address"}} {
+		kind, field := lookup.kind, lookup.field
+		values := wanted[kind]
+		for start := 0; start < len(values); start += identifierBatch {
+			batch := values[start:min(start+identifierBatch, len(values))]
+			quoted := make([]string, len(batch))
+			for i, value := range batch {
+				quoted[i] = QuoteFQL(value)
+			}
+			ids, _, err := c.QueryDeviceIDs(ctx, field+":["+strings.Join(quoted, ",")+"]", DefaultMaxCandidates)
+			if err != nil {
+				return nil, fmt.Errorf("%s lookup failed: %w", field, err)
+			}
+			hosts, err := c.GetHosts(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			for _, host := range hosts {
+				value := strings.ToUpper(strings.TrimSpace(host.SerialNumber))
+				if kind == IdentifierMAC {
+					value, _ = NormalizeMAC(host.MACAddress)
+				}
+				if value != "" {
+					found[kind+"="+value] = append(found[kind+"="+value], host)
+				}
+			}
+		}
+	}
+	for i := range matches {
+		matches[i].Hosts = found[matches[i].Kind+"="+matches[i].Normalized]
+	}
+	return matches, nil
+}
+
+// LoadIdentifiers reads an identifiers file: one kind=value per line, where
+// kind is serial or mac, e.g. "serial=PF3XK2L9" or "mac=00:50:56:ab:cd:ef".
+// Blank lines and lines starting with # are skipped. Each identifier's
+// Source is "path:line".
+func LoadIdentifiers(path string) ([]Identifier, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identifiers file: %w", err)
+	}
+	defer file.Close()
+
+	var identifiers []Identifier
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kind, value, ok := strings.Cut(line, "=")
+		kind, value = strings.ToLower(strings.TrimSpace(kind)), strings.TrimSpace(value)
+		if !ok || (kind != IdentifierSerial && kind != IdentifierMAC) || value == "" {
+			return nil, fmt.Errorf("%s:%d: expected serial=<serial number> or mac=<MAC address>", path, lineNo)
+		}
+		identifiers = append(identifiers, Identifier{Kind: kind, Value: value, Source: fmt.Sprintf("%s:%d", path, lineNo)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read identifiers file: %w", err)
+	}
+	return identifiers, nil
+}
@@ -0,0 +1,124 @@
+package falconrtr
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// InventoryDevice is one device of an inventory snapshot, as the devices
+// API reports it.
+type InventoryDevice struct {
+	DeviceID     string   `json:"device_id"`
+	Hostname     string   `json:"hostname"`
+	Platform     string   `json:"platform,omitempty"`
+	OSVersion    string   `json:"os_version,omitempty"`
+	AgentVersion string   `json:"agent_version,omitempty"` // Sensor version
+	LastSeen     string   `json:"last_seen,omitempty"`
+	Containment  string   `json:"containment,omitempty"` // normal, containment_pending, contained or lift_containment_pending
+	Tags         []string `json:"tags,omitempty"`
+	Groups       []string `json:"groups,omitempty"` // Host group IDs
+	SerialNumber string   `json:"serial_number,omitempty"`
+	MACAddress   string   `json:"mac_address,omitempty"`
+}
+
+// Inventory is a snapshot of the details of the devices matching Filter,
+// taken at SnapshotAt, sorted by hostname and then device ID.
+type Inventory struct {
+	SnapshotAt time.Time
+	Filter     string
+	Devices    []InventoryDevice
+}
+
+// SnapshotInventory takes an inventory snapshot of every device matching
+// the FQL filter, all devices when it is empty.
+func (c *CrowdStrikeRTRClient) SnapshotInventory(ctx context.Context, filter string) (*Inventory, error) {
+	inventory := &Inventory{SnapshotAt: c.clock().Now().UTC(), Filter: filter}
+	ids, err := c.ScrollDeviceIDs(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	err = c.deviceDetails(ctx, ids, func(resourceMap map[string]interface{}) {
+		device := InventoryDevice{
+			Tags:   stringList(resourceMap["tags"]),
+			Groups: stringList(resourceMap["groups"]),
+		}
+		device.DeviceID, _ = resourceMap["device_id"].(string)
+		device.DeviceID = NormalizeDeviceID(device.DeviceID)
+		device.Hostname, _ = resourceMap["hostname"].(string)
+		device.Platform, _ = resourceMap["platform_name"].(string)
+		device.OSVersion, _ = resourceMap["os_version"].(string)
+		device.AgentVersion, _ = resourceMap["agent_version"].(string)
+		device.LastSeen, _ = resourceMap["last_seen"].(string)
+		device.Containment, _ = resourceMap["status"].(string)
+		device.SerialNumber, _ = resourceMap["serial_number"].(string)
+		device.MACAddress, _ = resourceMap["mac_address"].(string)
+		inventory.Devices = append(inventory.Devices, device)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(inventory.Devices, func(i, j int) bool {
+		a, b := inventory.Devices[i], inventory.Devices[j]
+		if ah, bh := NormalizeHostname(a.Hostname), NormalizeHostname(b.Hostname); ah != bh {
+			return ah < bh
+		}
+		return a.DeviceID < b.DeviceID
+	})
+	return inventory, nil
+}
+
+// ScrollDeviceIDs returns every device ID matching the FQL filter. Unlike
+// QueryDeviceIDs it follows the scroll query, whose pages are chained by an
+// opaque token rather than an offset, so it is not capped at 10,000 devices.
+func (c *CrowdStrikeRTRClient) ScrollDeviceIDs(ctx context.Context, filter string) ([]string, error) {
+	headers := c.getHeaders("application/json", true)
+	var ids []string
+	seen := map[string]bool{}
+	token := ""
+	for {
+		params := url.Values{"limit": {strconv.Itoa(devicesPageSize)}}
+		if token != "" {
+			params.Set("offset", token)
+		}
+		if filter != "" {
+			params.Set("filter", filter)
+		}
+		response, err := c.makeAPICall(ctx, "GET", c.url(EndpointDevicesScroll, 0), headers, params, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("device scroll failed: %w", err)
+		}
+		resources, _ := response["resources"].([]interface{})
+		for _, resource := range resources {
+			if id, ok := resource.(string); ok && !seen[NormalizeDeviceID(id)] {
+				seen[NormalizeDeviceID(id)] = true
+				ids = append(ids, NormalizeDeviceID(id))
+			}
+		}
+		// The scroll token is a string in meta.pagination.offset, which
+		// ResponseMeta reads as a number for the offset queries.
+		meta, _ := response["meta"].(map[string]interface{})
+		pagination, _ := meta["pagination"].(map[string]interface{})
+		next, _ := pagination["offset"].(string)
+		total, _ := pagination["total"].(float64)
+		if len(resources) == 0 || next == "" || next == token || (total > 0 && len(ids) >= int(total)) {
+			return ids, nil
+		}
+		token = next
+	}
+}
+
+// stringList reads a JSON array of strings, skipping other values.
+func stringList(value interface{}) []string {
+	items, _ := value.([]interface{})
+	var list []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,66 @@
+package falconrtr
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit spaces the requests of a client to at most Rate per second
+// (concurrency.api_rate), across every session and host of the run. A
+// request waits for its turn on Clock; there is no burst allowance.
+type RateLimit struct {
+	Rate  float64
+	Clock Clock // nil uses SystemClock
+
+	mu   sync.Mutex
+	next time.Time // When the next request may go out
+}
+
+// Wait blocks until the next request may go out, or until ctx is done. A
+// nil RateLimit, or one without a Rate, never waits.
+func (r *RateLimit) Wait(ctx context.Context) error {
+	if r == nil || r.Rate <= 0 {
+		return nil
+	}
+	clock := r.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	r.mu.Lock()
+	now := clock.Now()
+	turn := r.next
+	if turn.Before(now) {
+		turn = now
+	}
+	r.next = turn.Add(time.Duration(float64(time.Second) / r.Rate))
+	r.mu.Unlock()
+	if wait := turn.Sub(now); wait > 0 {
+		return sleep(ctx, clock, wait)
+	}
+	return nil
+}
+
+// newRateLimit returns the limit of rate requests per second, or nil when
+// rate is 0.
+func newRateLimit(rate float64) *RateLimit {
+	if rate <= 0 {
+		return nil
+	}
+	return &RateLimit{Rate: rate}
+}
+
+// acquireDownload takes one of the client's download slots
+// (concurrency.downloads) and returns the func that gives it back. A
+// client without slots does not bound its downloads.
+func (c *CrowdStrikeRTRClient) acquireDownload(ctx context.Context) (func(), error) {
+	if c.downloads == nil {
+		return func() {}, nil
+	}
+	select {
+	case c.downloads <- struct{}{}:
+		return func() { <-c.downloads }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
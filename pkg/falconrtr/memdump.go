@@ -0,0 +1,58 @@
+package falconrtr
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMemdumpTimeout bounds memdump and xmemdump, which can run for a long
+// time on busy hosts.
+const DefaultMemdumpTimeout = 2 * time.Hour
+
+// RunMemdump dumps the memory of process pid to outputPath on the host, then
+// retrieves and verifies the dump.
+func (s *Session) RunMemdump(ctx context.Context, pid int, outputPath string) (*RetrievedFile, error) {
+	if pid <= 0 {
+		return nil, fmt.Errorf("invalid pid %d", pid)
+	}
+	commandString := fmt.Sprintf("memdump %s %s", strconv.Itoa(pid), quoteArg(outputPath))
+	return s.runDump(ctx, "memdump", commandString, outputPath)
+}
+
+// RunXmemdump dumps the host's memory to outputPath using mode "Kernel" or
+// "Complete", then retrieves and verifies the dump.
+func (s *Session) RunXmemdump(ctx context.Context, mode string, outputPath string) (*RetrievedFile, error) {
+	switch strings.ToLower(mode) {
+	case "kernel":
+		mode = "Kernel"
+	case "complete":
+		mode = "Complete"
+	default:
+		return nil, fmt.Errorf("xmemdump mode must be Kernel or Complete, got %q", mode)
+	}
+	commandString := fmt.Sprintf("xmemdump %s %s", mode, quoteArg(outputPath))
+	return s.runDump(ctx, "xmemdump", commandString, outputPath)
+}
+
+// runDump issues a dump command, waits for it with the long dump timeout and
+// retrieves the resulting file.
+func (s *Session) runDump(ctx context.Context, baseCommand, commandString, outputPath string) (*RetrievedFile, error) {
+	timeout := s.client.MemdumpTimeout
+	if timeout <= 0 {
+		timeout = DefaultMemdumpTimeout
+	}
+
+	result, err := s.RunCommand(ctx, "", baseCommand, commandString, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(result.Stderr) != "" {
+		return nil, fmt.Errorf("%s failed on host: %s", baseCommand, strings.TrimSpace(result.Stderr))
+	}
+	s.client.Console.Printf("%s completed on device %s, retrieving %s...\n", baseCommand, s.DeviceID, outputPath)
+
+	return s.GetFile(ctx, outputPath, timeout)
+}
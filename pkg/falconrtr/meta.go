@@ -0,0 +1,88 @@
+package falconrtr
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ResponseMeta is the meta object the API puts in every JSON response,
+// error responses included.
+type ResponseMeta struct {
+	QueryTime  float64     // Seconds the API spent on the request
+	PoweredBy  string      // Service that answered
+	TraceID    string      // Quote this when asking CrowdStrike support about a request
+	Pagination *Pagination // Set by list and query endpoints
+}
+
+// Pagination is the position of a page in a listing.
+type Pagination struct {
+	Offset int // Offset of the first resource of the page
+	Limit  int
+	Total  int // Resources in the whole listing
+}
+
+// MetaHook is called with the meta of every JSON API response, e.g. to
+// feed query_time into a latency dashboard. method and path identify the
+// request. It runs on the calling goroutine, so it must be quick and safe
+// for concurrent use.
+type MetaHook func(method, path string, meta ResponseMeta)
+
+// WithResponseMetaHook makes the client pass the meta of every response to
+// hook.
+func WithResponseMetaHook(hook MetaHook) Option {
+	return func(c *CrowdStrikeRTRClient) {
+		c.OnResponseMeta = hook
+	}
+}
+
+// responseMeta reads the meta object of a decoded response; what is
+// missing stays zero.
+func responseMeta(response map[string]interface{}) ResponseMeta {
+	var meta ResponseMeta
+	object, _ := response["meta"].(map[string]interface{})
+	meta.QueryTime, _ = object["query_time"].(float64)
+	meta.PoweredBy, _ = object["powered_by"].(string)
+	meta.TraceID, _ = object["trace_id"].(string)
+	if pagination, ok := object["pagination"].(map[string]interface{}); ok {
+		meta.Pagination = &Pagination{}
+		offset, _ := pagination["offset"].(float64)
+		limit, _ := pagination["limit"].(float64)
+		total, _ := pagination["total"].(float64)
+		meta.Pagination.Offset, meta.Pagination.Limit, meta.Pagination.Total = int(offset), int(limit), int(total)
+	}
+	return meta
+}
+
+// errorMeta reads the meta of an error response body, which need not be
+// JSON; the trace ID falls back to the X-Cs-Traceid header.
+func errorMeta(header http.Header, body []byte) ResponseMeta {
+	var response map[string]interface{}
+	json.Unmarshal(body, &response)
+	meta := responseMeta(response)
+	if meta.TraceID == "" {
+		meta.TraceID = header.Get("X-Cs-Traceid")
+	}
+	return meta
+}
+
+// Next returns the offset of the page after one of count resources
+// requested at offset, and whether there is one. The listing's total
+// decides; a response without pagination ends the listing on a page
+// shorter than limit, and an empty page always ends it.
+func (p *Pagination) Next(offset, count, limit int) (int, bool) {
+	next := offset + count
+	if count == 0 {
+		return next, false
+	}
+	if p == nil {
+		return next, count >= limit
+	}
+	return next, next < p.Total
+}
+
+// observeMeta passes meta to the client's hook, if any.
+func (c *CrowdStrikeRTRClient) observeMeta(method, path string, meta ResponseMeta) {
+	if c.OnResponseMeta != nil {
+		c.OnResponseMeta(method, path, meta)
+	}
+}
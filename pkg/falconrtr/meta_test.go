@@ -0,0 +1,165 @@
+package falconrtr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// metaTransport answers every request with status and a meta object whose
+// trace ID names the request's path.
+func metaTransport(status int) roundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		body, _ := json.Marshal(map[string]interface{}{
+			"meta":      map[string]interface{}{"query_time": 0.25, "powered_by": "test", "trace_id": "trace " + req.URL.Path},
+			"resources": []interface{}{},
+			"errors":    []interface{}{},
+		})
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(string(body))), Request: req}, nil
+	}
+}
+
+// TestResponseMetaHook calls the typed API methods and checks that the
+// OnResponseMeta hook sees the meta of each response, error responses
+// included, and that an API error carries its trace ID.
+func TestResponseMetaHook(t *testing.T) {
+	calls := []struct {
+		name string
+		path string
+		call func(ctx context.Context, c *CrowdStrikeRTRClient) error
+	}{
+		{"QueryDeviceIDs", "/devices/queries/devices/v1", func(ctx context.Context, c *CrowdStrikeRTRClient) error {
+			_, _, err := c.QueryDeviceIDs(ctx, "", 10)
+			return err
+		}},
+		{"GetHosts", "/devices/entities/devices/v2", func(ctx context.Context, c *CrowdStrikeRTRClient) error {
+			_, err := c.GetHosts(ctx, []string{"a"})
+			return err
+		}},
+		{"GetCurrentCID", "/sensors/queries/installers/ccid/v1", func(ctx context.Context, c *CrowdStrikeRTRClient) error {
+			_, err := c.GetCurrentCID(ctx)
+			return err
+		}},
+		{"ListAuditSessions", "/real-time-response-audit/combined/sessions/v1", func(ctx context.Context, c *CrowdStrikeRTRClient) error {
+			_, err := c.ListAuditSessions(ctx, "")
+			return err
+		}},
+		{"ListCloudFiles", "/real-time-response/queries/put-files/v1", func(ctx context.Context, c *CrowdStrikeRTRClient) error {
+			_, err := c.ListCloudFiles(ctx, CloudFilePutFile)
+			return err
+		}},
+		{"ListCloudScripts", "/real-time-response/queries/scripts/v1", func(ctx context.Context, c *CrowdStrikeRTRClient) error {
+			_, err := c.ListCloudScripts(ctx)
+			return err
+		}},
+		{"InitializeRTRSession", "/real-time-response/entities/sessions/v1", func(ctx context.Context, c *CrowdStrikeRTRClient) error {
+			_, err := c.InitializeRTRSession(ctx, "a")
+			return err
+		}},
+		{"InitBatchSession", "/real-time-response/combined/batch-init-session/v1", func(ctx context.Context, c *CrowdStrikeRTRClient) error {
+			_, err := c.InitBatchSession(ctx, []string{"a"})
+			return err
+		}},
+		{"GetUninstallToken", "/policy/combined/reveal-uninstall-token/v1", func(ctx context.Context, c *CrowdStrikeRTRClient) error {
+			_, err := c.GetUninstallToken(ctx, "a", "maintenance")
+			return err
+		}},
+		{"ListChildCIDs", "/mssp/queries/children/v1", func(ctx context.Context, c *CrowdStrikeRTRClient) error {
+			_, err := c.ListChildCIDs(ctx)
+			return err
+		}},
+	}
+	for _, status := range []int{http.StatusOK, http.StatusInternalServerError} {
+		for _, call := range calls {
+			t.Run(call.name+" "+strconv.Itoa(status), func(t *testing.T) {
+				var mu sync.Mutex
+				var seen []ResponseMeta
+				client := newTestClient(t, metaTransport(status))
+				client.OnResponseMeta = func(method, path string, meta ResponseMeta) {
+					if path != call.path {
+						return
+					}
+					mu.Lock()
+					defer mu.Unlock()
+					seen = append(seen, meta)
+				}
+				err := call.call(context.Background(), client)
+
+				wantTrace := "trace " + call.path
+				if len(seen) == 0 {
+					t.Fatalf("hook not called for %s", call.path)
+				}
+				for _, meta := range seen {
+					if meta.TraceID != wantTrace || meta.QueryTime != 0.25 || meta.PoweredBy != "test" {
+						t.Errorf("hook meta = %+v, want trace_id %q, query_time 0.25, powered_by test", meta, wantTrace)
+					}
+				}
+				if status != http.StatusOK {
+					var apiErr *APIError
+					if !errors.As(err, &apiErr) || !strings.Contains(err.Error(), wantTrace) {
+						t.Errorf("error = %v, want an APIError naming trace_id %q", err, wantTrace)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestPaginationNext(t *testing.T) {
+	tests := []struct {
+		name                 string
+		pagination           *Pagination
+		offset, count, limit int
+		wantNext             int
+		wantMore             bool
+	}{
+		{"more by total", &Pagination{Total: 7}, 0, 3, 3, 3, true},
+		{"short page before the total", &Pagination{Total: 7}, 3, 2, 3, 5, true},
+		{"last page", &Pagination{Total: 7}, 6, 1, 3, 7, false},
+		{"full page at the total", &Pagination{Total: 6}, 3, 3, 3, 6, false},
+		{"empty page", &Pagination{Total: 10}, 3, 0, 3, 3, false},
+		{"no pagination, full page", nil, 0, 3, 3, 3, true},
+		{"no pagination, short page", nil, 3, 2, 3, 5, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next, more := test.pagination.Next(test.offset, test.count, test.limit)
+			if next != test.wantNext || more != test.wantMore {
+				t.Errorf("Next(%d, %d, %d) = %d, %t, want %d, %t", test.offset, test.count, test.limit, next, more, test.wantNext, test.wantMore)
+			}
+		})
+	}
+}
+
+// TestQueryDeviceIDsFollowsPagination serves pages shorter than the limit
+// asked for, which only the listing's total says are not the last.
+func TestQueryDeviceIDsFollowsPagination(t *testing.T) {
+	all := []string{"a1", "a2", "a3", "a4", "a5", "a6", "a7"}
+	var offsets []string
+	client := newTestClient(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		offset, _ := strconv.Atoi(req.URL.Query().Get("offset"))
+		offsets = append(offsets, req.URL.Query().Get("offset"))
+		page := all[offset:min(offset+3, len(all))]
+		body, _ := json.Marshal(map[string]interface{}{
+			"resources": page,
+			"meta":      map[string]interface{}{"pagination": map[string]interface{}{"offset": offset, "limit": 3, "total": len(all)}},
+		})
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(string(body))), Request: req}, nil
+	}))
+	ids, truncated, err := client.QueryDeviceIDs(context.Background(), "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != strings.Join(all, ",") || truncated {
+		t.Errorf("ids = %q (truncated %t), want %q", ids, truncated, all)
+	}
+	if strings.Join(offsets, ",") != "0,3,6" {
+		t.Errorf("offsets requested = %q, want 0,3,6", offsets)
+	}
+}
@@ -0,0 +1,215 @@
+package falconrtr
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Metrics instruments a client: API calls by endpoint, retries, throttled
+// responses, downloaded bytes and the downloads in flight, sessions,
+// command latency, status polls and circuit breaker trips.
+// The zero value is ready to use and safe for concurrent use; methods on a
+// nil *Metrics do nothing.
+type Metrics struct {
+	mu             sync.Mutex
+	calls          map[string]int
+	retries        int
+	throttled      int
+	bytes          int64
+	sessionsOpened int
+	sessionsClosed int
+	latencies      []time.Duration
+	polls          int
+	breakerTrips   int
+	quarantined    int
+	downloads      map[*DownloadProgress]bool // In flight
+}
+
+// DownloadProgress is how far one download in flight has got. Size is 0
+// when the response did not announce its length.
+type DownloadProgress struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+	Size  int64  `json:"size,omitempty"`
+}
+
+// MetricsSnapshot is the state of a Metrics at one moment. Latencies are in
+// milliseconds; percentiles use the nearest rank.
+type MetricsSnapshot struct {
+	APICalls        map[string]int `json:"api_calls,omitempty"` // By "METHOD path"
+	Retries         int            `json:"retries"`
+	Throttled       int            `json:"throttled"` // 429 responses
+	BytesDownloaded int64          `json:"bytes_downloaded"`
+	SessionsOpened  int            `json:"sessions_opened"`
+	SessionsClosed  int            `json:"sessions_closed"`
+	Commands        int            `json:"commands"` // Commands seen complete
+	LatencyMeanMS   int64          `json:"latency_mean_ms"`
+	LatencyP50MS    int64          `json:"latency_p50_ms"`
+	LatencyP90MS    int64          `json:"latency_p90_ms"`
+	LatencyP99MS    int64          `json:"latency_p99_ms"`
+	LatencyMaxMS    int64          `json:"latency_max_ms"`
+	StatusPolls     int            `json:"status_polls"`
+	PollsPerCommand float64        `json:"polls_per_command,omitempty"`
+	BreakerTrips    int            `json:"breaker_trips,omitempty"` // Devices whose circuit opened
+	Quarantined     int            `json:"quarantined,omitempty"`   // Quarantined devices skipped
+
+	Downloads []DownloadProgress `json:"-"` // In flight, by name; for live views
+}
+
+// call counts one API request.
+func (m *Metrics) call(method, path string) {
+	m.update(func(m *Metrics) {
+		if m.calls == nil {
+			m.calls = make(map[string]int)
+		}
+		m.calls[method+" "+path]++
+	})
+}
+
+// Retry counts a request or command that is made again, whatever the cause.
+func (m *Metrics) Retry() { m.update(func(m *Metrics) { m.retries++ }) }
+
+func (m *Metrics) throttle()           { m.update(func(m *Metrics) { m.throttled++ }) }
+func (m *Metrics) sessionOpened(n int) { m.update(func(m *Metrics) { m.sessionsOpened += n }) }
+func (m *Metrics) sessionClosed()      { m.update(func(m *Metrics) { m.sessionsClosed++ }) }
+func (m *Metrics) poll()               { m.update(func(m *Metrics) { m.polls++ }) }
+func (m *Metrics) breakerTrip()        { m.update(func(m *Metrics) { m.breakerTrips++ }) }
+func (m *Metrics) quarantineSkip()     { m.update(func(m *Metrics) { m.quarantined++ }) }
+
+// startDownload records a download of name, of size bytes when known, as
+// in flight until endDownload.
+func (m *Metrics) startDownload(name string, size int64) *DownloadProgress {
+	progress := &DownloadProgress{Name: name, Size: max(size, 0)}
+	m.update(func(m *Metrics) {
+		if m.downloads == nil {
+			m.downloads = make(map[*DownloadProgress]bool)
+		}
+		m.downloads[progress] = true
+	})
+	return progress
+}
+
+func (m *Metrics) endDownload(progress *DownloadProgress) {
+	m.update(func(m *Metrics) { delete(m.downloads, progress) })
+}
+
+// downloadCounter counts the bytes written through it as downloaded, as
+// they arrive, against the download in flight.
+type downloadCounter struct {
+	m        *Metrics
+	progress *DownloadProgress
+}
+
+func (d downloadCounter) Write(p []byte) (int, error) {
+	d.m.update(func(m *Metrics) {
+		m.bytes += int64(len(p))
+		d.progress.Bytes += int64(len(p))
+	})
+	return len(p), nil
+}
+
+func (m *Metrics) command(latency time.Duration) {
+	m.update(func(m *Metrics) { m.latencies = append(m.latencies, latency) })
+}
+
+func (m *Metrics) update(fn func(*Metrics)) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn(m)
+}
+
+// Snapshot returns the metrics so far.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	if m == nil {
+		return MetricsSnapshot{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := MetricsSnapshot{
+		Retries:         m.retries,
+		Throttled:       m.throttled,
+		BytesDownloaded: m.bytes,
+		SessionsOpened:  m.sessionsOpened,
+		SessionsClosed:  m.sessionsClosed,
+		Commands:        len(m.latencies),
+		StatusPolls:     m.polls,
+		BreakerTrips:    m.breakerTrips,
+		Quarantined:     m.quarantined,
+	}
+	for progress := range m.downloads {
+		snapshot.Downloads = append(snapshot.Downloads, *progress)
+	}
+	sort.Slice(snapshot.Downloads, func(i, j int) bool { return snapshot.Downloads[i].Name < snapshot.Downloads[j].Name })
+	if len(m.calls) > 0 {
+		snapshot.APICalls = make(map[string]int, len(m.calls))
+		for endpoint, n := range m.calls {
+			snapshot.APICalls[endpoint] = n
+		}
+	}
+	if len(m.latencies) == 0 {
+		return snapshot
+	}
+	latencies := append([]time.Duration(nil), m.latencies...)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+	rank := func(p float64) int64 {
+		i := int(p*float64(len(latencies))+0.999999) - 1
+		return latencies[min(max(i, 0), len(latencies)-1)].Milliseconds()
+	}
+	snapshot.LatencyMeanMS = (total / time.Duration(len(latencies))).Milliseconds()
+	snapshot.LatencyP50MS, snapshot.LatencyP90MS, snapshot.LatencyP99MS = rank(0.5), rank(0.9), rank(0.99)
+	snapshot.LatencyMaxMS = latencies[len(latencies)-1].Milliseconds()
+	snapshot.PollsPerCommand = float64(m.polls) / float64(len(latencies))
+	return snapshot
+}
+
+// WriteTable writes the snapshot as an aligned, human-readable table.
+func (s MetricsSnapshot) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "METRIC\tVALUE\n")
+	rows := []struct {
+		name  string
+		value interface{}
+	}{
+		{"retries", s.Retries},
+		{"throttled (429)", s.Throttled},
+		{"bytes downloaded", s.BytesDownloaded},
+		{"sessions opened", s.SessionsOpened},
+		{"sessions closed", s.SessionsClosed},
+		{"commands", s.Commands},
+		{"latency mean", time.Duration(s.LatencyMeanMS) * time.Millisecond},
+		{"latency p50", time.Duration(s.LatencyP50MS) * time.Millisecond},
+		{"latency p90", time.Duration(s.LatencyP90MS) * time.Millisecond},
+		{"latency p99", time.Duration(s.LatencyP99MS) * time.Millisecond},
+		{"latency max", time.Duration(s.LatencyMaxMS) * time.Millisecond},
+		{"status polls", s.StatusPolls},
+		{"polls per command", fmt.Sprintf("%.1f", s.PollsPerCommand)},
+		{"breaker trips", s.BreakerTrips},
+		{"quarantined skipped", s.Quarantined},
+	}
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%s\t%v\n", row.name, row.value)
+	}
+	endpoints := make([]string, 0, len(s.APICalls))
+	for endpoint := range s.APICalls {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	if len(endpoints) > 0 {
+		fmt.Fprintf(tw, "\nENDPOINT\tCALLS\n")
+	}
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(tw, "%s\t%d\n", endpoint, s.APICalls[endpoint])
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,68 @@
+package falconrtr
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// childrenPageSize is the page size of the MSSP child CID query.
+const childrenPageSize = 500
+
+// ChildCID is a child tenant of an MSSP parent CID.
+type ChildCID struct {
+	CID  string `json:"cid"`
+	Name string `json:"name,omitempty"`
+}
+
+// ListChildCIDs returns the child CIDs of the parent tenant the credentials
+// belong to (requires Flight Control: Read). Names are looked up on a best
+// effort basis; children whose details cannot be read keep only their CID.
+func (c *CrowdStrikeRTRClient) ListChildCIDs(ctx context.Context) ([]ChildCID, error) {
+	headers := c.getHeaders("application/json", true)
+	var ids []string
+	for offset := 0; ; {
+		params := url.Values{"limit": {strconv.Itoa(childrenPageSize)}, "offset": {strconv.Itoa(offset)}}
+		response, err := c.makeAPICall(ctx, "GET", c.url(EndpointMSSPChildrenQuery, 0), headers, params, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("child CID query failed (requires Flight Control: Read): %w", err)
+		}
+		resources, _ := response["resources"].([]interface{})
+		for _, resource := range resources {
+			if id, ok := resource.(string); ok && id != "" {
+				ids = append(ids, NormalizeCID(id))
+			}
+		}
+		next, more := responseMeta(response).Pagination.Next(offset, len(resources), childrenPageSize)
+		if !more {
+			break
+		}
+		offset = next
+	}
+
+	children := make([]ChildCID, len(ids))
+	for i, id := range ids {
+		children[i] = ChildCID{CID: id}
+	}
+	if len(ids) == 0 {
+		return children, nil
+	}
+	response, err := c.makeAPICall(ctx, "POST", c.url(EndpointMSSPChildren, 0), headers, nil, map[string]interface{}{"ids": ids}, nil)
+	if err != nil {
+		c.Console.Printf("Warning: child CID names unavailable: %v\n", err)
+		return children, nil
+	}
+	names := map[string]string{}
+	resources, _ := response["resources"].([]interface{})
+	for _, resource := range resources {
+		if resourceMap, ok := resource.(map[string]interface{}); ok {
+			cid, _ := resourceMap["child_cid"].(string)
+			names[NormalizeCID(cid)], _ = resourceMap["name"].(string)
+		}
+	}
+	for i := range children {
+		children[i].Name = names[children[i].CID]
+	}
+	return children, nil
+}
@@ -0,0 +1,95 @@
+package falconrtr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/naming"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// fileFields returns the naming fields known for files written about
+// deviceID. The hostname and platform are looked up, once per device, only
+// when template uses them and the credentials have Hosts Read.
+func (c *CrowdStrikeRTRClient) fileFields(ctx context.Context, template *naming.Template, deviceID string) naming.Fields {
+	fields := naming.Fields{RunID: c.RunID, CaseID: c.CaseID, DeviceID: deviceID, Time: time.Now()}
+	caps, detected := c.Capabilities()
+	if deviceID != "" && (template.Uses("Hostname") || template.Uses("Platform")) && (!detected || caps.HostsRead) {
+		host, err := c.host(ctx, deviceID)
+		if err != nil {
+			c.warn(nil, sink.WarningHostLookupFailed, deviceID, "cannot name files by hostname of device %s: %v", deviceID, err)
+		}
+		fields.Hostname, fields.Platform = host.Hostname, host.Platform
+	}
+	return fields
+}
+
+// host returns the details of deviceID, from the hosts seen by GetHosts
+// when possible.
+func (c *CrowdStrikeRTRClient) host(ctx context.Context, deviceID string) (Host, error) {
+	deviceID = NormalizeDeviceID(deviceID)
+	c.hostsMu.Lock()
+	host, ok := c.hosts[deviceID]
+	c.hostsMu.Unlock()
+	if ok {
+		return host, nil
+	}
+	hosts, err := c.GetHosts(ctx, []string{deviceID})
+	if err != nil {
+		return Host{DeviceID: deviceID}, err
+	}
+	if len(hosts) == 0 {
+		return Host{DeviceID: deviceID}, fmt.Errorf("device %s not found", deviceID)
+	}
+	return hosts[0], nil
+}
+
+// rememberHosts caches host details for naming files.
+func (c *CrowdStrikeRTRClient) rememberHosts(hosts []Host) {
+	c.hostsMu.Lock()
+	defer c.hostsMu.Unlock()
+	if c.hosts == nil {
+		c.hosts = map[string]Host{}
+	}
+	for _, host := range hosts {
+		c.hosts[host.DeviceID] = host
+	}
+}
+
+// outputPath names a retained copy of the command's output from the
+// output template, under the output directory.
+func (cmd *Command) outputPath(name, ext string) (string, error) {
+	c := cmd.session.client
+	fields := c.fileFields(context.Background(), c.OutputNames.Template, cmd.session.DeviceID)
+	fields.Command, fields.Name, fields.Ext = cmd.BaseCommand, name, ext
+	fields.CloudRequestID = cmd.CloudRequestID
+	path, err := c.OutputNames.Path(c.OutputDir, fields)
+	if err != nil {
+		return "", err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+	return path, nil
+}
+
+// NamedFiles returns the paths of every file named from a template so far:
+// retrieved files first, then retained outputs.
+func (c *CrowdStrikeRTRClient) NamedFiles() []string {
+	return append(c.ArtifactNames.Resolved(), c.OutputNames.Resolved()...)
+}
+
+// RenamedFiles maps the names the templates produced to the files written
+// instead, where they differ.
+func (c *CrowdStrikeRTRClient) RenamedFiles() map[string]string {
+	renamed := c.ArtifactNames.Renamed()
+	for logical, path := range c.OutputNames.Renamed() {
+		renamed[logical] = path
+	}
+	return renamed
+}
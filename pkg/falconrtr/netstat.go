@@ -0,0 +1,149 @@
+package falconrtr
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Connection is one socket parsed from netstat output. Ports are 0 for
+// wildcards ("*"); PID is 0 when the platform does not report an owner.
+type Connection struct {
+	Protocol      string `json:"protocol"`
+	LocalAddress  string `json:"local_address"`
+	LocalPort     int    `json:"local_port"`
+	RemoteAddress string `json:"remote_address"`
+	RemotePort    int    `json:"remote_port"`
+	State         string `json:"state,omitempty"`
+	PID           int    `json:"pid,omitempty"`
+	Program       string `json:"program,omitempty"`
+}
+
+// NetstatData is the structured form of netstat output stored in
+// CommandResult.Data. Lines that could not be parsed are kept in Leftovers.
+type NetstatData struct {
+	Connections []Connection `json:"connections"`
+	Leftovers   []string     `json:"leftovers,omitempty"`
+}
+
+// ListConnections runs netstat on the session and parses the connections.
+func (s *Session) ListConnections(ctx context.Context) ([]Connection, error) {
+	result, err := s.CollectConnections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return result.Data.(*NetstatData).Connections, nil
+}
+
+// CollectConnections runs netstat and returns the command result with
+// Data set to the parsed *NetstatData, for callers that report the raw
+// output alongside the connection records.
+func (s *Session) CollectConnections(ctx context.Context) (*CommandResult, error) {
+	result, err := s.RunCommand(ctx, "", "netstat", "netstat", 0)
+	if err != nil {
+		return result, err
+	}
+	if strings.TrimSpace(result.Stderr) != "" {
+		return result, fmt.Errorf("netstat failed on host: %s", strings.TrimSpace(result.Stderr))
+	}
+	result.Data = ParseNetstat(result.Stdout)
+	return result, nil
+}
+
+// ParseNetstat parses Windows ("TCP 0.0.0.0:135 0.0.0.0:0 LISTENING 1000")
+// and Linux/macOS ("tcp6 0 0 :::22 :::* LISTEN 1234/sshd") netstat rows.
+// Header and banner lines are skipped; other unrecognized lines are returned
+// in Leftovers.
+func ParseNetstat(output string) *NetstatData {
+	data := &NetstatData{Connections: []Connection{}}
+	for _, line := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || isNetstatHeader(fields[0]) {
+			continue
+		}
+		connection, ok := parseConnection(fields)
+		if !ok {
+			data.Leftovers = append(data.Leftovers, strings.TrimSpace(line))
+			continue
+		}
+		data.Connections = append(data.Connections, connection)
+	}
+	return data
+}
+
+// parseConnection parses the fields of one netstat row. The first two
+// address-like fields are the local and remote endpoints; queue counters
+// before them are skipped, and the state and owner follow them.
+func parseConnection(fields []string) (Connection, bool) {
+	protocol := strings.ToLower(fields[0])
+	if !strings.HasPrefix(protocol, "tcp") && !strings.HasPrefix(protocol, "udp") {
+		return Connection{}, false
+	}
+	connection := Connection{Protocol: protocol}
+
+	var addresses []string
+	rest := fields[1:]
+	for len(rest) > 0 && len(addresses) < 2 {
+		if strings.Contains(rest[0], ":") || strings.Contains(rest[0], ".") {
+			addresses = append(addresses, rest[0])
+		} else if _, err := strconv.Atoi(rest[0]); err != nil {
+			return Connection{}, false
+		}
+		rest = rest[1:]
+	}
+	if len(addresses) < 2 {
+		return Connection{}, false
+	}
+
+	var ok bool
+	if connection.LocalAddress, connection.LocalPort, ok = splitHostPort(addresses[0]); !ok {
+		return Connection{}, false
+	}
+	if connection.RemoteAddress, connection.RemotePort, ok = splitHostPort(addresses[1]); !ok {
+		return Connection{}, false
+	}
+
+	for _, field := range rest {
+		owner, program, _ := strings.Cut(field, "/")
+		if pid, err := strconv.Atoi(owner); err == nil {
+			connection.PID = pid
+			connection.Program = program
+		} else if field != "-" && connection.State == "" {
+			connection.State = strings.ToUpper(field)
+		}
+	}
+	return connection, true
+}
+
+// splitHostPort splits "host:port", "[v6]:port" and Linux's ":::port" forms.
+// A "*" port becomes 0 and bracketed IPv6 hosts are returned without brackets.
+func splitHostPort(address string) (string, int, bool) {
+	i := strings.LastIndex(address, ":")
+	if i < 0 {
+		// macOS prints "127.0.0.1.631" with the port after the last dot.
+		i = strings.LastIndex(address, ".")
+		if i < 0 {
+			return "", 0, false
+		}
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(address[:i], "["), "]")
+	portText := address[i+1:]
+	if portText == "*" {
+		return host, 0, true
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return "", 0, false
+	}
+	return host, port, true
+}
+
+// isNetstatHeader reports whether a line starting with first is a banner or header.
+func isNetstatHeader(first string) bool {
+	switch strings.ToLower(first) {
+	case "active", "proto", "protocol":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package falconrtr
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// Normalization steps reported by NormalizeOutput.
+const (
+	NormalizedUTF16   = "utf16_to_utf8"
+	NormalizedUTF8BOM = "utf8_bom_removed"
+	NormalizedCRLF    = "crlf_to_lf"
+	NormalizedNULs    = "trailing_nuls_removed"
+)
+
+// NormalizeOutput converts command output from Windows hosts to plain UTF-8
+// with LF line endings. UTF-16LE text (with or without a BOM, as written by
+// PowerShell redirections) is decoded, a UTF-8 BOM is dropped, CRLF becomes
+// LF and trailing NULs are stripped. It returns the normalized text and the
+// steps that changed it, in the order applied.
+func NormalizeOutput(text string) (string, []string) {
+	var steps []string
+	if decoded, ok := decodeUTF16LE(text); ok {
+		text = decoded
+		steps = append(steps, NormalizedUTF16)
+	}
+	if trimmed, ok := strings.CutPrefix(text, "\uFEFF"); ok {
+		text = trimmed
+		steps = append(steps, NormalizedUTF8BOM)
+	}
+	if strings.Contains(text, "\r\n") {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+		steps = append(steps, NormalizedCRLF)
+	}
+	if trimmed := strings.TrimRight(text, "\x00"); len(trimmed) != len(text) {
+		text = trimmed
+		steps = append(steps, NormalizedNULs)
+	}
+	return text, steps
+}
+
+// utf16LEBOMs are the forms a UTF-16LE byte order mark takes once the API has
+// put the output in a JSON string: raw bytes, bytes read as Latin-1, or
+// replacement characters.
+var utf16LEBOMs = []string{"\xFF\xFE", "\u00FF\u00FE", "\uFFFD\uFFFD"}
+
+// decodeUTF16LE decodes text that holds UTF-16LE code units. Without a BOM it
+// only treats text as UTF-16LE when every second byte is NUL, which is how
+// ASCII output looks in that encoding.
+func decodeUTF16LE(text string) (string, bool) {
+	body, hasBOM := text, false
+	for _, bom := range utf16LEBOMs {
+		if trimmed, ok := strings.CutPrefix(text, bom); ok {
+			body, hasBOM = trimmed, true
+			break
+		}
+	}
+
+	raw, ok := codeUnitBytes(body)
+	if !ok || len(raw) < 2 {
+		return "", false
+	}
+	if !hasBOM {
+		if len(raw)%2 != 0 {
+			return "", false
+		}
+		for i := 1; i < len(raw); i += 2 {
+			if raw[i] != 0 {
+				return "", false
+			}
+		}
+	}
+	// A trailing odd byte is a truncated code unit; drop it.
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = uint16(raw[2*i]) | uint16(raw[2*i+1])<<8
+	}
+	return string(utf16.Decode(units)), true
+}
+
+// codeUnitBytes recovers the byte form of text. Output that arrived as raw
+// bytes is used as is; output the API decoded byte-by-byte as Latin-1 is
+// mapped back, and anything else is not UTF-16 data.
+func codeUnitBytes(text string) ([]byte, bool) {
+	if !utf8.ValidString(text) {
+		return []byte(text), true
+	}
+	raw := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r > 0xFF {
+			return nil, false
+		}
+		raw = append(raw, byte(r))
+	}
+	return raw, true
+}
+
+// normalizeResult normalizes the result's output in place when the client has
+// normalization enabled, noting the steps on the result and keeping the
+// original bytes locally when keep_original is set.
+func (c *CrowdStrikeRTRClient) normalizeResult(cmd *Command, result *CommandResult) {
+	if !c.NormalizeOutput {
+		return
+	}
+	result.Stdout, result.Normalization = c.normalizeField(cmd, "stdout", result.Stdout, result.Normalization)
+	result.Stderr, result.Normalization = c.normalizeField(cmd, "stderr", result.Stderr, result.Normalization)
+}
+
+// normalizeStatusResponse normalizes stdout and stderr of every resource in
+// place and records the steps applied under "normalization".
+func (c *CrowdStrikeRTRClient) normalizeStatusResponse(cmd *Command, statusResponse map[string]interface{}) {
+	if !c.NormalizeOutput {
+		return
+	}
+	resources, _ := statusResponse["resources"].([]interface{})
+	for _, resource := range resources {
+		resourceMap, ok := resource.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var noted []string
+		for _, field := range []string{"stdout", "stderr"} {
+			text, ok := resourceMap[field].(string)
+			if !ok || text == "" {
+				continue
+			}
+			resourceMap[field], noted = c.normalizeField(cmd, field, text, noted)
+		}
+		if len(noted) > 0 {
+			resourceMap["normalization"] = noted
+		}
+	}
+}
+
+// normalizeField normalizes one output field and appends its steps, prefixed
+// with the field name, to noted.
+func (c *CrowdStrikeRTRClient) normalizeField(cmd *Command, field, text string, noted []string) (string, []string) {
+	normalized, steps := NormalizeOutput(text)
+	if len(steps) == 0 {
+		return text, noted
+	}
+	if c.KeepOriginalOutput {
+		if err := c.writeOriginalOutput(cmd, field, text); err != nil {
+			cmd.session.warn(sink.WarningOutputNotRetained, "%v", err)
+		}
+	}
+	for _, step := range steps {
+		noted = append(noted, field+":"+step)
+	}
+	return normalized, noted
+}
+
+// writeOriginalOutput stores the output bytes exactly as the API returned
+// them, before normalization and redaction. Like the raw output file it is
+// only readable by the current user and is never sent anywhere.
+func (c *CrowdStrikeRTRClient) writeOriginalOutput(cmd *Command, field, text string) error {
+	path, err := cmd.outputPath("original-output", "."+field)
+	if err != nil {
+		return fmt.Errorf("failed to name original output file: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(text), 0600); err != nil {
+		return fmt.Errorf("failed to write original output: %w", err)
+	}
+	c.Console.Printf("Original %s bytes retained locally at %s\n", field, path)
+	return nil
+}
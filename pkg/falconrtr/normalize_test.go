@@ -0,0 +1,85 @@
+package falconrtr
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestNormalizeOutputGolden normalizes the captured PowerShell output samples
+// in testdata/normalize and compares the text and the steps applied to the
+// .golden.json beside each. Run with -update to rewrite the golden files.
+func TestNormalizeOutputGolden(t *testing.T) {
+	samples, err := filepath.Glob(filepath.Join("testdata", "normalize", "*.txt"))
+	if err != nil || len(samples) == 0 {
+		t.Fatalf("no output samples: %v", err)
+	}
+	for _, sample := range samples {
+		t.Run(filepath.Base(sample), func(t *testing.T) {
+			output, err := os.ReadFile(sample)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text, steps := NormalizeOutput(string(output))
+			if strings.Contains(text, "\r\n") || strings.HasSuffix(text, "\x00") || strings.HasPrefix(text, "\uFEFF") {
+				t.Errorf("normalized %s still holds a CRLF, trailing NUL or BOM: %q", sample, text)
+			}
+			if again, more := NormalizeOutput(text); again != text || len(more) != 0 {
+				t.Errorf("normalizing %s twice applied %v", sample, more)
+			}
+			var buf bytes.Buffer
+			encoder := json.NewEncoder(&buf)
+			encoder.SetEscapeHTML(false) // Keep the CLIXML readable
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(struct {
+				Steps  []string `json:"steps"`
+				Output string   `json:"output"`
+			}{steps, text}); err != nil {
+				t.Fatal(err)
+			}
+			got := buf.Bytes()
+
+			golden := strings.TrimSuffix(sample, ".txt") + ".golden.json"
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("normalized %s differs from %s:\n%s", sample, golden, got)
+			}
+		})
+	}
+}
+
+func TestNormalizeOutput(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		want  string
+		steps []string
+	}{
+		{"empty", "", "", nil},
+		{"plain LF", "a\nb\n", "a\nb\n", nil},
+		{"lone CR kept", "50%\r100%\r\n", "50%\r100%\n", []string{NormalizedCRLF}},
+		{"UTF-16LE with an odd trailing byte", "\xFF\xFEo\x00k\x00\n", "ok", []string{NormalizedUTF16}},
+		{"Latin-1 text is not UTF-16", "caf\u00e9\n", "caf\u00e9\n", nil},
+		{"UTF-8 BOM and CRLF", "\uFEFFok\r\n", "ok\n", []string{NormalizedUTF8BOM, NormalizedCRLF}},
+		{"trailing NULs", "ok\n\x00\x00\x00", "ok\n", []string{NormalizedNULs}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, steps := NormalizeOutput(test.text)
+			if got != test.want || strings.Join(steps, ",") != strings.Join(test.steps, ",") {
+				t.Errorf("NormalizeOutput(%q) = %q, %v, want %q, %v", test.text, got, steps, test.want, test.steps)
+			}
+		})
+	}
+}
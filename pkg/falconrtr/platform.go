@@ -0,0 +1,149 @@
+package falconrtr
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Platforms as reported by the Hosts API, normalized by NormalizePlatform.
+const (
+	PlatformWindows = "windows"
+	PlatformLinux   = "linux"
+	PlatformMac     = "mac"
+)
+
+// platformCommands are the RTR base commands each platform's sensor runs.
+// A command missing from a platform's list but present in another's is
+// refused before it is sent; commands in no list are sent anywhere, so a
+// command added to RTR later is not blocked by an out-of-date table.
+var platformCommands = map[string][]string{
+	PlatformWindows: {
+		"cat", "cd", "clear", "cp", "encrypt", "env", "eventlog", "filehash", "get", "getsid", "help", "history",
+		"ipconfig", "kill", "ls", "map", "memdump", "mkdir", "mount", "mv", "netstat", "ps", "put", "put-and-run",
+		"reg", "restart", "rm", "run", "runscript", "shutdown", "unmap", "update", "users", "xmemdump", "zip",
+	},
+	PlatformLinux: {
+		"cat", "cd", "clear", "cp", "env", "filehash", "get", "help", "history", "ifconfig", "kill", "ls",
+		"mkdir", "mount", "mv", "netstat", "ps", "put", "restart", "rm", "run", "runscript", "shutdown", "users",
+	},
+	PlatformMac: {
+		"cat", "cd", "clear", "cp", "env", "filehash", "get", "help", "history", "ifconfig", "kill", "ls",
+		"mkdir", "mount", "mv", "netstat", "ps", "put", "restart", "rm", "run", "runscript", "shutdown", "users",
+	},
+}
+
+// NormalizePlatform maps a Hosts API platform_name (Windows, Linux, Mac) or
+// a script platform to PlatformWindows, PlatformLinux or PlatformMac. Other
+// values are returned lowercased.
+func NormalizePlatform(platform string) string {
+	platform = strings.ToLower(strings.TrimSpace(platform))
+	switch platform {
+	case "macos", "darwin", "osx":
+		return PlatformMac
+	}
+	return platform
+}
+
+// CheckCommandPlatform refuses baseCommand when the sensor on platform does
+// not run it. An unknown platform passes, as does a command the table does
+// not list for any platform.
+func CheckCommandPlatform(baseCommand, platform string) error {
+	platform = NormalizePlatform(platform)
+	supported, known := platformCommands[platform]
+	if !known || slices.Contains(supported, baseCommand) || !listedCommand(baseCommand) {
+		return nil
+	}
+	var others []string
+	for _, other := range []string{PlatformWindows, PlatformLinux, PlatformMac} {
+		if slices.Contains(platformCommands[other], baseCommand) {
+			others = append(others, other)
+		}
+	}
+	return fmt.Errorf("%s is not supported on %s hosts (only %s): %w", baseCommand, platform, strings.Join(others, ", "), ErrUnsupportedPlatform)
+}
+
+// listedCommand reports whether any platform lists baseCommand.
+func listedCommand(baseCommand string) bool {
+	for _, commands := range platformCommands {
+		if slices.Contains(commands, baseCommand) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedCommand reports whether some platform does not run baseCommand, so
+// issuing it needs the host's platform.
+func limitedCommand(baseCommand string) bool {
+	if !listedCommand(baseCommand) {
+		return false
+	}
+	for _, commands := range platformCommands {
+		if !slices.Contains(commands, baseCommand) {
+			return true
+		}
+	}
+	return false
+}
+
+// platform returns the normalized platform of the session's host, or "" when
+// it cannot be looked up, e.g. without the Hosts Read scope.
+func (s *Session) platform(ctx context.Context) string {
+	if caps, detected := s.client.Capabilities(); detected && !caps.HostsRead {
+		return ""
+	}
+	host, err := s.client.host(ctx, s.DeviceID)
+	if err != nil {
+		return ""
+	}
+	return NormalizePlatform(host.Platform)
+}
+
+// knownPlatform is platform without a Hosts API call: the platform of a
+// host GetHosts has already seen, or "".
+func (s *Session) knownPlatform() string {
+	s.client.hostsMu.Lock()
+	defer s.client.hostsMu.Unlock()
+	return NormalizePlatform(s.client.hosts[s.DeviceID].Platform)
+}
+
+// PlatformScript returns the cloud script to run on the session's host:
+// the client's PlatformScripts entry for its platform, or scriptName when
+// there is none. A PowerShell script is refused on a Linux or macOS host
+// and a shell script on a Windows host, before anything is sent. The host's
+// platform is only looked up when PlatformScripts is set; otherwise the
+// check is made when the platform is already known.
+func (s *Session) PlatformScript(ctx context.Context, scriptName string) (string, error) {
+	platform := s.knownPlatform()
+	if len(s.client.PlatformScripts) > 0 && platform == "" {
+		platform = s.platform(ctx)
+	}
+	if mapped := s.client.PlatformScripts[platform]; mapped != "" {
+		scriptName = mapped
+	}
+	switch ext := strings.ToLower(path.Ext(scriptName)); {
+	case ext == ".ps1" && (platform == PlatformLinux || platform == PlatformMac):
+		return "", fmt.Errorf("script %s is a PowerShell script and device %s is a %s host; set platform_scripts.%s to a .sh script: %w",
+			scriptName, s.DeviceID, platform, platform, ErrUnsupportedPlatform)
+	case ext == ".sh" && platform == PlatformWindows:
+		return "", fmt.Errorf("script %s is a shell script and device %s is a Windows host; set platform_scripts.windows: %w",
+			scriptName, s.DeviceID, ErrUnsupportedPlatform)
+	}
+	return scriptName, nil
+}
+
+// platformScripts returns the platform_scripts mapping keyed by normalized
+// platform.
+func platformScripts(scripts map[string]string) map[string]string {
+	if len(scripts) == 0 {
+		return nil
+	}
+	normalized := make(map[string]string, len(scripts))
+	for platform, script := range scripts {
+		normalized[NormalizePlatform(platform)] = script
+	}
+	return normalized
+}
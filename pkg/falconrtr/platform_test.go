@@ -0,0 +1,223 @@
+package falconrtr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const linuxDevice = "1111111111111111111111111111111a"
+
+// linuxResponses are status resources a Linux sensor returns, by the
+// command_string issued.
+var linuxResponses = map[string]map[string]interface{}{
+	"ls '/var/log'": {"stdout": "total 1352\n" +
+		"drwxrwxr-x  12 root   syslog   4096 Mar  4 09:12 .\n" +
+		"drwxr-xr-x  14 root   root     4096 Jan 10  2024 ..\n" +
+		"drwxr-xr-x   2 root   root     4096 Feb 28 06:25 apt\n" +
+		"-rw-r-----   1 syslog adm    481370 Mar  4 09:12 auth.log\n" +
+		"lrwxrwxrwx   1 root   root        9 Feb  1 11:00 current -> syslog.1\n" +
+		"-rw-r-----   1 syslog adm    870016 Mar  4 09:14 syslog\n"},
+	"ls '/etc'": {"stdout": "total 12\n" +
+		"-rw-r--r--  1 root root   2977 Feb 28 06:25 passwd\n" +
+		"-rw-r-----  1 root shadow 1588 Feb 28 06:25 shadow\n"},
+	"filehash '/etc/passwd'":  {"stdout": "MD5: 5f4dcc3b5aa765d61d8327deb882cf99\nSHA256: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08\n"},
+	"cat '/etc/shadow'":       {"stderr": "cat: /etc/shadow: Permission denied\n"},
+	"ls '/srv/it'\\''s here'": {"stderr": "ls: cannot access '/srv/it'\\''s here': No such file or directory\n"},
+	`runscript -CloudFile="collect.ps1"`: {
+		"stderr": "/bin/sh: collect.ps1: PowerShell scripts are not supported on this platform\n",
+		"errors": []interface{}{map[string]interface{}{"code": 40006, "message": "PowerShell scripts are not supported on this platform"}},
+	},
+}
+
+// linuxTransport serves a Linux host: the devices API describes it as Linux
+// and its commands answer with linuxResponses. It records the command
+// strings posted.
+type linuxTransport struct {
+	mu     sync.Mutex
+	issued []string
+}
+
+func (l *linuxTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body interface{}
+	switch {
+	case req.URL.Path == "/devices/entities/devices/v2":
+		body = map[string]interface{}{"resources": []interface{}{map[string]interface{}{
+			"device_id": linuxDevice, "hostname": "web-01", "platform_name": "Linux",
+			"os_version": "Ubuntu 22.04", "kernel_version": "5.15.0-97-generic",
+		}}}
+	case strings.HasSuffix(req.URL.Path, "command/v1") && req.Method == http.MethodPost:
+		var payload map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			return nil, err
+		}
+		commandString, _ := payload["command_string"].(string)
+		l.mu.Lock()
+		l.issued = append(l.issued, commandString)
+		l.mu.Unlock()
+		body = map[string]interface{}{"resources": []interface{}{map[string]interface{}{"cloud_request_id": commandString, "session_id": "session"}}}
+	case strings.HasSuffix(req.URL.Path, "command/v1"):
+		resource := map[string]interface{}{"complete": true, "stdout": "", "stderr": ""}
+		if req.URL.Query().Get("sequence_id") == "0" {
+			for key, value := range linuxResponses[req.URL.Query().Get("cloud_request_id")] {
+				resource[key] = value
+			}
+		}
+		body = map[string]interface{}{"resources": []interface{}{resource}}
+	default:
+		body = map[string]interface{}{"resources": []interface{}{}}
+	}
+	encoded, _ := json.Marshal(body)
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(string(encoded))), Request: req}, nil
+}
+
+func (l *linuxTransport) commands() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.issued...)
+}
+
+// TestLinuxHost runs the file commands, a Windows-only command and a
+// PowerShell script against a Linux host.
+func TestLinuxHost(t *testing.T) {
+	ctx := context.Background()
+	newSession := func(t *testing.T) (*Session, *linuxTransport) {
+		transport := &linuxTransport{}
+		client := newTestClient(t, transport)
+		return &Session{client: client, DeviceID: linuxDevice, SessionID: "session"}, transport
+	}
+
+	t.Run("list", func(t *testing.T) {
+		session, transport := newSession(t)
+		entries, err := session.List(ctx, "/var/log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name)
+		}
+		if want := []string{"apt", "auth.log", "current", "syslog"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("entries %q, want %q", names, want)
+		}
+		if entries[1].Path != "/var/log/auth.log" || entries[1].Size != 481370 || entries[0].Size != -1 || !entries[0].IsDir {
+			t.Errorf("entries %+v, want POSIX paths, sizes and directories", entries)
+		}
+		if got := transport.commands(); !reflect.DeepEqual(got, []string{"ls '/var/log'"}) {
+			t.Errorf("issued %q, want the path single-quoted", got)
+		}
+	})
+
+	t.Run("missing path with a quote", func(t *testing.T) {
+		session, _ := newSession(t)
+		if _, err := session.List(ctx, "/srv/it's here"); !errors.Is(err, ErrRemoteFileNotFound) {
+			t.Errorf("List = %v, want ErrRemoteFileNotFound", err)
+		}
+	})
+
+	t.Run("filehash", func(t *testing.T) {
+		session, _ := newSession(t)
+		hashes, err := session.FileHash(ctx, "/etc/passwd")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hashes.MD5 != "5f4dcc3b5aa765d61d8327deb882cf99" || hashes.SHA256 != "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" {
+			t.Errorf("hashes %+v", hashes)
+		}
+	})
+
+	t.Run("permission denied", func(t *testing.T) {
+		session, _ := newSession(t)
+		_, err := session.ReadFile(ctx, "/etc/shadow", 0)
+		if err == nil || !strings.Contains(err.Error(), "Permission denied") {
+			t.Errorf("ReadFile = %v, want the sensor's permission error", err)
+		}
+		if reason, _ := ClassifyFailure("cat: /etc/shadow: Permission denied"); reason != FailureAccessDenied {
+			t.Errorf("reason %q, want %q", reason, FailureAccessDenied)
+		}
+	})
+
+	t.Run("windows-only command", func(t *testing.T) {
+		session, transport := newSession(t)
+		_, err := session.RunCommand(ctx, "", "reg", `reg query HKLM\Software`, time.Minute)
+		if !errors.Is(err, ErrUnsupportedPlatform) || !strings.Contains(err.Error(), "reg is not supported on linux hosts (only windows)") {
+			t.Errorf("RunCommand = %v, want reg refused on linux", err)
+		}
+		if got := transport.commands(); len(got) != 0 {
+			t.Errorf("issued %q, want nothing sent", got)
+		}
+	})
+
+	t.Run("PowerShell script", func(t *testing.T) {
+		session, _ := newSession(t)
+		result, err := session.RunCommand(ctx, AdminCommandEndpoint, "runscript", `runscript -CloudFile="collect.ps1"`, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.FailureReason != FailureUnsupportedPlatform || result.Retryable || len(result.Errors) != 1 {
+			t.Errorf("result %+v, want a non-retryable %s failure", result, FailureUnsupportedPlatform)
+		}
+	})
+
+	t.Run("platform script", func(t *testing.T) {
+		session, _ := newSession(t)
+		if _, err := session.PlatformScript(ctx, "collect.ps1"); err != nil {
+			t.Fatalf("PlatformScript before the platform is known = %v, want the check left to the host", err)
+		}
+		session.client.PlatformScripts = map[string]string{PlatformLinux: "collect.sh"}
+		script, err := session.PlatformScript(ctx, "collect.ps1")
+		if err != nil || script != "collect.sh" {
+			t.Errorf("PlatformScript = %q, %v, want collect.sh", script, err)
+		}
+		session.client.PlatformScripts = map[string]string{PlatformMac: "collect-mac.sh"}
+		if _, err := session.PlatformScript(ctx, "collect.ps1"); !errors.Is(err, ErrUnsupportedPlatform) {
+			t.Errorf("PlatformScript = %v, want a PowerShell script refused on linux", err)
+		}
+	})
+}
+
+func TestCheckCommandPlatform(t *testing.T) {
+	tests := []struct {
+		command, platform string
+		supported         bool
+	}{
+		{"ls", "Linux", true},
+		{"ifconfig", "Linux", true},
+		{"ifconfig", "Windows", false},
+		{"ipconfig", "Linux", false},
+		{"memdump", "Mac", false},
+		{"reg", "macOS", false},
+		{"reg", "Windows", true},
+		{"reg", "", true},             // Unknown platform
+		{"reg", "ChromeOS", true},     // Platform not in the table
+		{"newcommand", "Linux", true}, // Command not in the table
+	}
+	for _, test := range tests {
+		err := CheckCommandPlatform(test.command, test.platform)
+		if (err == nil) != test.supported || (err != nil && !errors.Is(err, ErrUnsupportedPlatform)) {
+			t.Errorf("CheckCommandPlatform(%q, %q) = %v, want supported %t", test.command, test.platform, err, test.supported)
+		}
+	}
+}
+
+func TestQuoteArg(t *testing.T) {
+	tests := []struct{ arg, want string }{
+		{`C:\Program Files\app.log`, `"C:\Program Files\app.log"`},
+		{`C:\say "hi".txt`, `"C:\say \"hi\".txt"`},
+		{"/var/log/my logs", "'/var/log/my logs'"},
+		{"/srv/it's here", `'/srv/it'\''s here'`},
+		{`/tmp/back\slash`, `'/tmp/back\slash'`},
+	}
+	for _, test := range tests {
+		if got := quoteArg(test.arg); got != test.want {
+			t.Errorf("quoteArg(%q) = %s, want %s", test.arg, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package falconrtr
+
+import (
+	"fmt"
+	"time"
+)
+
+// Poll strategy names accepted by ParsePollStrategy (poll_strategy).
+const (
+	PollFixed       = "fixed"
+	PollExponential = "exponential"
+	PollAdaptive    = "adaptive"
+)
+
+// PollResult is what the last status poll of a command observed.
+type PollResult struct {
+	Delay     time.Duration // Delay waited before that poll; 0 for the first
+	OutputLen int           // Bytes of stdout and stderr reported so far
+	Advanced  bool          // Whether the output grew since the previous poll
+}
+
+// PollStrategy decides how long Command.Wait sleeps before the next status
+// poll. attempt counts the polls made so far, starting at 1, and elapsed is
+// the time since polling began. Implementations must be safe to share
+// between commands; any state belongs in last.
+type PollStrategy interface {
+	NextDelay(attempt int, elapsed time.Duration, last PollResult) time.Duration
+}
+
+// FixedPoll polls at a constant interval.
+type FixedPoll struct {
+	Interval time.Duration
+}
+
+// NextDelay returns the fixed interval.
+func (p FixedPoll) NextDelay(attempt int, elapsed time.Duration, last PollResult) time.Duration {
+	return p.Interval
+}
+
+// ExponentialPoll starts at Initial and multiplies the delay by Factor after
+// every poll, up to Max. Suited to long scripts that finish late.
+type ExponentialPoll struct {
+	Initial time.Duration
+	Max     time.Duration
+	Factor  float64
+}
+
+// NextDelay returns Initial*Factor^(attempt-1), capped at Max.
+func (p ExponentialPoll) NextDelay(attempt int, elapsed time.Duration, last PollResult) time.Duration {
+	delay := p.Initial
+	for i := 1; i < attempt && delay < p.Max; i++ {
+		delay = time.Duration(float64(delay) * p.Factor)
+	}
+	return min(delay, p.Max)
+}
+
+// AdaptivePoll halves the delay while output is advancing and grows it by
+// half while the command is idle, staying between Min and Max. The first
+// delay is Initial.
+type AdaptivePoll struct {
+	Initial time.Duration
+	Min     time.Duration
+	Max     time.Duration
+}
+
+// NextDelay adjusts the previous delay to the command's progress.
+func (p AdaptivePoll) NextDelay(attempt int, elapsed time.Duration, last PollResult) time.Duration {
+	if last.Delay <= 0 {
+		return p.Initial
+	}
+	delay := last.Delay + last.Delay/2
+	if last.Advanced {
+		delay = last.Delay / 2
+	}
+	return min(max(delay, p.Min), p.Max)
+}
+
+// DefaultPollStrategy polls every DefaultPollInterval.
+var DefaultPollStrategy PollStrategy = FixedPoll{Interval: DefaultPollInterval}
+
+// ParsePollStrategy returns the built-in strategy with the given name, using
+// its default tuning; an empty name selects DefaultPollStrategy.
+func ParsePollStrategy(name string) (PollStrategy, error) {
+	switch name {
+	case "", PollFixed:
+		return DefaultPollStrategy, nil
+	case PollExponential:
+		return ExponentialPoll{Initial: time.Second, Max: maxPollInterval, Factor: 2}, nil
+	case PollAdaptive:
+		return AdaptivePoll{Initial: DefaultPollInterval, Min: 500 * time.Millisecond, Max: maxPollInterval}, nil
+	}
+	return nil, fmt.Errorf("unknown poll strategy %q (want %s, %s or %s)", name, PollFixed, PollExponential, PollAdaptive)
+}
@@ -0,0 +1,71 @@
+package falconrtr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPollStrategyDelays(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy PollStrategy
+		polls    []PollResult // What each poll observed; Delay is filled in
+		want     []time.Duration
+	}{
+		{
+			name:     "fixed",
+			strategy: FixedPoll{Interval: 2 * time.Second},
+			polls:    make([]PollResult, 4),
+			want:     []time.Duration{2 * time.Second, 2 * time.Second, 2 * time.Second, 2 * time.Second},
+		},
+		{
+			name:     "exponential doubles up to max",
+			strategy: ExponentialPoll{Initial: time.Second, Max: 10 * time.Second, Factor: 2},
+			polls:    make([]PollResult, 6),
+			want:     []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second},
+		},
+		{
+			name:     "exponential with initial above max",
+			strategy: ExponentialPoll{Initial: time.Minute, Max: 30 * time.Second, Factor: 2},
+			polls:    make([]PollResult, 2),
+			want:     []time.Duration{30 * time.Second, 30 * time.Second},
+		},
+		{
+			name:     "adaptive grows while idle",
+			strategy: AdaptivePoll{Initial: 2 * time.Second, Min: 500 * time.Millisecond, Max: 5 * time.Second},
+			polls:    make([]PollResult, 5),
+			want:     []time.Duration{2 * time.Second, 3 * time.Second, 4500 * time.Millisecond, 5 * time.Second, 5 * time.Second},
+		},
+		{
+			name:     "adaptive halves while output advances",
+			strategy: AdaptivePoll{Initial: 4 * time.Second, Min: 500 * time.Millisecond, Max: 30 * time.Second},
+			polls:    []PollResult{{}, {Advanced: true}, {Advanced: true}, {Advanced: true}, {Advanced: true}, {}},
+			want:     []time.Duration{4 * time.Second, 2 * time.Second, time.Second, 500 * time.Millisecond, 500 * time.Millisecond, 750 * time.Millisecond},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var elapsed, last time.Duration
+			for i, poll := range test.polls {
+				poll.Delay = last
+				got := test.strategy.NextDelay(i+1, elapsed, poll)
+				if got != test.want[i] {
+					t.Fatalf("delay %d = %s, want %s", i+1, got, test.want[i])
+				}
+				elapsed += got
+				last = got
+			}
+		})
+	}
+}
+
+func TestParsePollStrategy(t *testing.T) {
+	for _, name := range []string{"", PollFixed, PollExponential, PollAdaptive} {
+		if _, err := ParsePollStrategy(name); err != nil {
+			t.Errorf("ParsePollStrategy(%q): %v", name, err)
+		}
+	}
+	if _, err := ParsePollStrategy("linear"); err == nil {
+		t.Error("ParsePollStrategy(\"linear\") succeeded, want an error")
+	}
+}
@@ -0,0 +1,274 @@
+package falconrtr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPoolTTL evicts pooled sessions left idle this long.
+	DefaultPoolTTL = 30 * time.Minute
+	// DefaultPoolRefresh is how often idle sessions are refreshed; RTR closes
+	// sessions after ten minutes without activity.
+	DefaultPoolRefresh = 5 * time.Minute
+	// DefaultPoolSize caps the idle sessions a pool keeps.
+	DefaultPoolSize = 100
+)
+
+// SessionPool keeps RTR sessions open between collections against the same
+// hosts, so repeated jobs skip session setup and teardown. Each session is
+// handed to one caller at a time: Acquire takes it out of the pool and
+// Release puts it back. Idle sessions are refreshed in the background while
+// Run is active, and evicted once idle beyond TTL or when more than MaxSize
+// are idle.
+type SessionPool struct {
+	client *CrowdStrikeRTRClient
+
+	TTL             time.Duration
+	RefreshInterval time.Duration
+	MaxSize         int
+
+	mu    sync.Mutex
+	idle  map[string]*pooledSession // Device ID to its idle session
+	stats PoolStats
+}
+
+// pooledSession is an idle session and when it was last used and refreshed.
+type pooledSession struct {
+	session   *Session
+	lastUsed  time.Time
+	refreshed time.Time
+}
+
+// PoolStats counts what a SessionPool has done. Idle and InUse are current
+// gauges; the rest are totals since the pool was created.
+type PoolStats struct {
+	Idle            int `json:"idle"`
+	InUse           int `json:"in_use"`
+	Hits            int `json:"hits"`
+	Misses          int `json:"misses"`
+	Recreated       int `json:"recreated"`
+	Evicted         int `json:"evicted"`
+	Refreshes       int `json:"refreshes"`
+	RefreshFailures int `json:"refresh_failures"`
+}
+
+// NewSessionPool returns an empty pool of sessions opened through c.
+func (c *CrowdStrikeRTRClient) NewSessionPool() *SessionPool {
+	return &SessionPool{
+		client:          c,
+		TTL:             DefaultPoolTTL,
+		RefreshInterval: DefaultPoolRefresh,
+		MaxSize:         DefaultPoolSize,
+		idle:            map[string]*pooledSession{},
+	}
+}
+
+// Acquire returns a session on deviceID for the caller's exclusive use: the
+// pooled one when there is one and it is still alive, otherwise a new one.
+// A pooled session due a refresh is refreshed first, and re-created if the
+// refresh shows it has died.
+func (p *SessionPool) Acquire(ctx context.Context, deviceID string) (*Session, error) {
+	p.mu.Lock()
+	entry := p.idle[deviceID]
+	delete(p.idle, deviceID)
+	if entry != nil {
+		p.stats.Hits++
+	} else {
+		p.stats.Misses++
+	}
+	p.mu.Unlock()
+
+	if entry != nil && p.client.clock().Now().Sub(entry.refreshed) >= p.RefreshInterval {
+		if err := entry.session.Refresh(ctx); err != nil {
+			p.client.Console.Printf("Pooled session %s on device %s is gone, opening a new one: %v\n", entry.session.SessionID, deviceID, err)
+			entry = nil
+			p.count(func(s *PoolStats) { s.Recreated++ })
+		}
+	}
+	if entry != nil {
+		p.count(func(s *PoolStats) { s.InUse++ })
+		return entry.session, nil
+	}
+
+	session, err := p.client.InitializeRTRSession(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	p.count(func(s *PoolStats) { s.InUse++ })
+	return session, nil
+}
+
+// Release returns a session taken with Acquire to the pool. A session the
+// caller found broken should be passed to Discard instead.
+func (p *SessionPool) Release(session *Session) {
+	now := p.client.clock().Now()
+	p.mu.Lock()
+	p.stats.InUse--
+	var evicted []*Session
+	if existing := p.idle[session.DeviceID]; existing != nil {
+		// Another caller pooled a session on the device meanwhile; keep one.
+		evicted = append(evicted, existing.session)
+		p.stats.Evicted++
+	}
+	p.idle[session.DeviceID] = &pooledSession{session: session, lastUsed: now, refreshed: now}
+	evicted = append(evicted, p.trim()...)
+	p.mu.Unlock()
+	p.close(context.Background(), evicted)
+}
+
+// Discard deletes a session taken with Acquire instead of pooling it.
+func (p *SessionPool) Discard(ctx context.Context, session *Session) {
+	p.count(func(s *PoolStats) { s.InUse--; s.Evicted++ })
+	if err := session.Delete(ctx); err != nil {
+		p.client.Console.Printf("Warning: %v\n", err)
+	}
+}
+
+// Do runs fn with a pooled session on deviceID. When fn fails because the
+// session died under it, the session is discarded and fn runs once more on a
+// new one.
+func (p *SessionPool) Do(ctx context.Context, deviceID string, fn func(*Session) error) error {
+	for attempt := 1; ; attempt++ {
+		session, err := p.Acquire(ctx, deviceID)
+		if err != nil {
+			return err
+		}
+		err = fn(session)
+		if err == nil {
+			p.Release(session)
+			return nil
+		}
+		if !sessionGone(err) {
+			p.Release(session)
+			return err
+		}
+		p.Discard(context.Background(), session)
+		if attempt > 1 {
+			return err
+		}
+		p.client.Console.Printf("Session %s on device %s died during use, retrying on a new session...\n", session.SessionID, deviceID)
+		p.count(func(s *PoolStats) { s.Recreated++ })
+	}
+}
+
+// Run refreshes idle sessions and evicts expired ones every RefreshInterval
+// until ctx is done.
+func (p *SessionPool) Run(ctx context.Context) {
+	for sleep(ctx, p.client.clock(), p.RefreshInterval) == nil {
+		p.maintain(ctx)
+	}
+}
+
+// maintain evicts sessions idle beyond TTL and refreshes the rest. Sessions
+// are taken out of the pool while they are refreshed, so no caller can
+// acquire one mid-refresh.
+func (p *SessionPool) maintain(ctx context.Context) {
+	clock := p.client.clock()
+	p.mu.Lock()
+	var expired []*Session
+	var due []*pooledSession
+	for deviceID, entry := range p.idle {
+		switch {
+		case clock.Now().Sub(entry.lastUsed) >= p.TTL:
+			expired = append(expired, entry.session)
+			p.stats.Evicted++
+		case clock.Now().Sub(entry.refreshed) >= p.RefreshInterval/2:
+			due = append(due, entry)
+		default:
+			continue
+		}
+		delete(p.idle, deviceID)
+	}
+	p.mu.Unlock()
+	p.close(ctx, expired)
+
+	var duplicates []*Session
+	for _, entry := range due {
+		err := entry.session.Refresh(ctx)
+		p.mu.Lock()
+		p.stats.Refreshes++
+		switch {
+		case err != nil:
+			p.stats.RefreshFailures++
+			p.stats.Evicted++
+			p.client.Console.Printf("Warning: dropping pooled session on device %s: %v\n", entry.session.DeviceID, err)
+		case p.idle[entry.session.DeviceID] != nil:
+			// A caller pooled a newer session while this one was refreshed.
+			duplicates = append(duplicates, entry.session)
+		default:
+			entry.refreshed = clock.Now()
+			p.idle[entry.session.DeviceID] = entry
+		}
+		p.mu.Unlock()
+	}
+	p.close(ctx, duplicates)
+}
+
+// trim evicts the least recently used idle sessions beyond MaxSize. The
+// caller holds p.mu and deletes the returned sessions after unlocking.
+func (p *SessionPool) trim() []*Session {
+	var evicted []*Session
+	for p.MaxSize > 0 && len(p.idle) > p.MaxSize {
+		var oldest *pooledSession
+		for _, entry := range p.idle {
+			if oldest == nil || entry.lastUsed.Before(oldest.lastUsed) {
+				oldest = entry
+			}
+		}
+		delete(p.idle, oldest.session.DeviceID)
+		evicted = append(evicted, oldest.session)
+		p.stats.Evicted++
+	}
+	return evicted
+}
+
+// Close deletes every idle session. Sessions still acquired are left to
+// their callers.
+func (p *SessionPool) Close(ctx context.Context) {
+	p.mu.Lock()
+	var sessions []*Session
+	for deviceID, entry := range p.idle {
+		sessions = append(sessions, entry.session)
+		delete(p.idle, deviceID)
+	}
+	p.mu.Unlock()
+	p.close(ctx, sessions)
+}
+
+// Stats returns a snapshot of the pool's counters.
+func (p *SessionPool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Idle = len(p.idle)
+	return stats
+}
+
+func (p *SessionPool) count(update func(*PoolStats)) {
+	p.mu.Lock()
+	update(&p.stats)
+	p.mu.Unlock()
+}
+
+func (p *SessionPool) close(ctx context.Context, sessions []*Session) {
+	for _, session := range sessions {
+		if err := session.Delete(ctx); err != nil {
+			p.client.Console.Printf("Warning: %v\n", err)
+		}
+	}
+}
+
+// sessionGone reports whether err shows the session no longer exists on the
+// RTR side.
+func sessionGone(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return true
+	}
+	reason, _ := ClassifyFailure(err.Error())
+	return reason == FailureSessionInterrupted
+}
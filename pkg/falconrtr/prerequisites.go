@@ -0,0 +1,118 @@
+package falconrtr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// ErrProbeUnparsed is returned by ProbeResources when the probe ran but its
+// output did not report what was asked for.
+var ErrProbeUnparsed = errors.New("resource probe output not understood")
+
+// ProbeScripts are the built-in resource probes by platform, run through
+// runscript -Raw. {{volume}} is replaced by the volume to check. A probe
+// prints free_disk=<bytes> for the volume and, where it can tell,
+// free_memory=<bytes>, one per line; it changes nothing on the host.
+var ProbeScripts = map[string]string{
+	PlatformWindows: `$d = Get-PSDrive -Name '{{volume}}'; "free_disk=$($d.Free)"; ` +
+		`"free_memory=$((Get-CimInstance Win32_OperatingSystem).FreePhysicalMemory * 1024)"`,
+	PlatformLinux: `df -Pk '{{volume}}' | awk 'NR==2 {printf "free_disk=%.0f\n", $4*1024}'; ` +
+		`awk '/^MemAvailable:/ {printf "free_memory=%.0f\n", $2*1024}' /proc/meminfo`,
+	PlatformMac: `df -Pk '{{volume}}' | awk 'NR==2 {printf "free_disk=%.0f\n", $4*1024}'`,
+}
+
+// DefaultProbeVolumes are the volumes probed when none is configured.
+var DefaultProbeVolumes = map[string]string{
+	PlatformWindows: "C",
+	PlatformLinux:   "/",
+	PlatformMac:     "/",
+}
+
+// ResourceProbe configures ProbeResources. Volume is the drive letter on
+// Windows or a path on Linux and macOS, the platform's default if empty.
+// Scripts replace ProbeScripts by platform. Timeout bounds the wait for the
+// probe (one minute if 0).
+type ResourceProbe struct {
+	Volume  string
+	Scripts map[string]string
+	Timeout time.Duration
+}
+
+// ProbeCommand returns the runscript command string probing platform's
+// hosts, or "" when there is no probe for the platform.
+func (p ResourceProbe) ProbeCommand(platform string) string {
+	script := p.Scripts[platform]
+	if script == "" {
+		script = ProbeScripts[platform]
+	}
+	if script == "" {
+		return ""
+	}
+	volume := p.Volume
+	if volume == "" {
+		volume = DefaultProbeVolumes[platform]
+	}
+	if platform == PlatformWindows {
+		volume = strings.TrimRight(volume, ":\\")
+	}
+	return "runscript -Raw=```" + strings.ReplaceAll(script, "{{volume}}", volume) + "```"
+}
+
+// ProbeResources runs the resource probe for the host's platform and
+// parses the free disk space and memory it reports. The probe is a
+// read-only script, but runscript still needs the admin endpoint unless
+// command_endpoints says otherwise. An error wrapping ErrProbeUnparsed means
+// the probe ran and its output was not understood.
+func (s *Session) ProbeResources(ctx context.Context, probe ResourceProbe) (sink.HostResources, error) {
+	platform := s.knownPlatform()
+	if platform == "" {
+		platform = s.platform(ctx)
+	}
+	commandString := probe.ProbeCommand(platform)
+	if commandString == "" {
+		return sink.HostResources{}, fmt.Errorf("%w: no probe for the platform %q of device %s", ErrProbeUnparsed, platform, s.DeviceID)
+	}
+	timeout := probe.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+
+	s.client.Console.Printf("Probing free disk space and memory on device %s...\n", s.DeviceID)
+	result, err := s.RunCommand(ctx, "", "runscript", commandString, timeout)
+	if err != nil {
+		return sink.HostResources{}, fmt.Errorf("resource probe failed on device %s: %w", s.DeviceID, err)
+	}
+	if len(result.Errors) > 0 {
+		return sink.HostResources{}, fmt.Errorf("resource probe failed on device %s: %s", s.DeviceID, FormatResourceErrors(result.Errors))
+	}
+	resources := sink.HostResources{Volume: probe.Volume, FreeDiskBytes: -1, FreeMemoryBytes: -1}
+	if resources.Volume == "" {
+		resources.Volume = DefaultProbeVolumes[platform]
+	}
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		bytes, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || bytes < 0 {
+			continue
+		}
+		switch key {
+		case "free_disk":
+			resources.FreeDiskBytes = bytes
+		case "free_memory":
+			resources.FreeMemoryBytes = bytes
+		}
+	}
+	if resources.FreeDiskBytes < 0 {
+		return resources, fmt.Errorf("%w: device %s reported no free_disk (stdout %q, stderr %q)", ErrProbeUnparsed, s.DeviceID, result.Stdout, result.Stderr)
+	}
+	return resources, nil
+}
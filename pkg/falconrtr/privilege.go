@@ -0,0 +1,122 @@
+package falconrtr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrMissingScope is returned by CheckCommandScope when the API credentials
+// may not use a command endpoint.
+var ErrMissingScope = errors.New("missing API scope")
+
+// commandEndpoints maps RTR base commands to the least-privileged command
+// endpoint that accepts them. Base commands not listed go to the admin
+// endpoint, which accepts every command.
+var commandEndpoints = map[string]string{
+	"cat":          ReadOnlyCommandEndpoint,
+	"cd":           ReadOnlyCommandEndpoint,
+	"clear":        ReadOnlyCommandEndpoint,
+	"env":          ReadOnlyCommandEndpoint,
+	"eventlog":     ReadOnlyCommandEndpoint,
+	"filehash":     ReadOnlyCommandEndpoint,
+	"getsid":       ReadOnlyCommandEndpoint,
+	"help":         ReadOnlyCommandEndpoint,
+	"history":      ReadOnlyCommandEndpoint,
+	"ipconfig":     ReadOnlyCommandEndpoint,
+	"ls":           ReadOnlyCommandEndpoint,
+	"mount":        ReadOnlyCommandEndpoint,
+	"netstat":      ReadOnlyCommandEndpoint,
+	"ps":           ReadOnlyCommandEndpoint,
+	"reg":          ReadOnlyCommandEndpoint, // reg query; changes are active responder, see CommandEndpoint
+	"users":        ReadOnlyCommandEndpoint,
+	"cp":           ActiveResponderCommandEndpoint,
+	"encrypt":      ActiveResponderCommandEndpoint,
+	"get":          ActiveResponderCommandEndpoint,
+	"kill":         ActiveResponderCommandEndpoint,
+	"map":          ActiveResponderCommandEndpoint,
+	"memdump":      ActiveResponderCommandEndpoint,
+	"mkdir":        ActiveResponderCommandEndpoint,
+	"mv":           ActiveResponderCommandEndpoint,
+	"put":          ActiveResponderCommandEndpoint,
+	"restart":      ActiveResponderCommandEndpoint,
+	"rm":           ActiveResponderCommandEndpoint,
+	"shutdown":     ActiveResponderCommandEndpoint,
+	"umount":       ActiveResponderCommandEndpoint,
+	"unmap":        ActiveResponderCommandEndpoint,
+	"update":       ActiveResponderCommandEndpoint,
+	"xmemdump":     ActiveResponderCommandEndpoint,
+	"zip":          ActiveResponderCommandEndpoint,
+	"run":          AdminCommandEndpoint,
+	"runscript":    AdminCommandEndpoint,
+	"put-and-run":  AdminCommandEndpoint,
+	"falconscript": AdminCommandEndpoint,
+}
+
+// commandEndpointScopes names the API scope each command endpoint requires.
+var commandEndpointScopes = map[string]string{
+	ReadOnlyCommandEndpoint:        "Real time response: Read",
+	ActiveResponderCommandEndpoint: "Real time response: Write",
+	AdminCommandEndpoint:           "Real time response (admin): Write",
+}
+
+// validateCommandEndpointOverrides checks config overrides of the command
+// classification.
+func validateCommandEndpointOverrides(overrides map[string]string) error {
+	for baseCommand, endpoint := range overrides {
+		if _, ok := commandEndpointScopes[endpoint]; !ok {
+			return fmt.Errorf("command_endpoints.%s: %q is not a command endpoint (want %s, %s or %s)",
+				baseCommand, endpoint, ReadOnlyCommandEndpoint, ActiveResponderCommandEndpoint, AdminCommandEndpoint)
+		}
+	}
+	return nil
+}
+
+// CommandEndpoint returns the least-privileged endpoint that accepts
+// commandString, unless command_endpoints overrides its base command.
+func (c *CrowdStrikeRTRClient) CommandEndpoint(baseCommand, commandString string) string {
+	if endpoint, ok := c.CommandEndpoints[baseCommand]; ok {
+		return endpoint
+	}
+	endpoint, ok := commandEndpoints[baseCommand]
+	if !ok {
+		return AdminCommandEndpoint
+	}
+	if baseCommand == "reg" {
+		if fields := strings.Fields(commandString); len(fields) > 1 && !strings.EqualFold(fields[1], "query") {
+			return ActiveResponderCommandEndpoint
+		}
+	}
+	return endpoint
+}
+
+// CheckCommandScope reports whether the credentials may use the command
+// endpoint, without issuing a command: it asks for the status of an empty
+// cloud request ID, which the API refuses with 403 when the scope is missing
+// and otherwise with 400 or 404, past authorization. Any other failure is
+// returned as it is, since it says nothing about the scope. The read-only
+// endpoint is not checked, since every RTR scope includes it.
+func (c *CrowdStrikeRTRClient) CheckCommandScope(ctx context.Context, endpoint string) error {
+	if endpoint == ReadOnlyCommandEndpoint {
+		return nil
+	}
+	headers := c.getHeaders("application/json", true)
+	params := url.Values{"cloud_request_id": {""}, "sequence_id": {"0"}}
+	_, err := c.makeAPICall(ctx, "GET", c.url(endpoint, 0), headers, params, nil, nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusForbidden:
+			return fmt.Errorf("%w: the API client may not use the %s endpoint (requires %s)", ErrMissingScope, endpoint, commandEndpointScopes[endpoint])
+		case http.StatusBadRequest, http.StatusNotFound:
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check access to the %s endpoint: %w", endpoint, err)
+	}
+	return nil
+}
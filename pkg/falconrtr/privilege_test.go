@@ -0,0 +1,57 @@
+package falconrtr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCheckCommandScope(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		transport   error
+		wantMissing bool
+		wantErr     bool
+	}{
+		{name: "scope granted, unknown request", status: http.StatusNotFound},
+		{name: "scope granted, empty request ID refused", status: http.StatusBadRequest},
+		{name: "scope granted, status returned", status: http.StatusOK},
+		{name: "scope missing", status: http.StatusForbidden, wantMissing: true, wantErr: true},
+		{name: "token rejected", status: http.StatusUnauthorized, wantErr: true},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: true},
+		{name: "unreachable", transport: errors.New("connection refused"), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var paths []string
+			client := newTestClient(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				paths = append(paths, req.URL.Path)
+				if test.transport != nil {
+					return nil, test.transport
+				}
+				return &http.Response{StatusCode: test.status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{"resources":[],"errors":[]}`)), Request: req}, nil
+			}))
+			err := client.CheckCommandScope(context.Background(), AdminCommandEndpoint)
+			if (err != nil) != test.wantErr || errors.Is(err, ErrMissingScope) != test.wantMissing {
+				t.Errorf("CheckCommandScope = %v, want error %t, missing scope %t", err, test.wantErr, test.wantMissing)
+			}
+			if len(paths) == 0 || paths[0] != "/real-time-response/entities/admin-command/v1" {
+				t.Errorf("requests = %q, want the admin command status", paths)
+			}
+		})
+	}
+}
+
+func TestCheckCommandScopeReadOnly(t *testing.T) {
+	client := newTestClient(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+		return nil, errors.New("unexpected request")
+	}))
+	if err := client.CheckCommandScope(context.Background(), ReadOnlyCommandEndpoint); err != nil {
+		t.Errorf("CheckCommandScope = %v for the read-only endpoint", err)
+	}
+}
@@ -0,0 +1,247 @@
+package falconrtr
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ProcessInfo is one row of parsed ps output. Fields that the host platform
+// does not report are left empty; Columns keeps every column as printed.
+type ProcessInfo struct {
+	PID         int               `json:"pid"`
+	PPID        int               `json:"ppid,omitempty"`
+	Name        string            `json:"name"`
+	User        string            `json:"user,omitempty"`
+	CommandLine string            `json:"command_line,omitempty"`
+	Columns     map[string]string `json:"columns"`
+}
+
+// Header names used by the Windows and Linux/macOS ps variants, lowercased.
+var (
+	pidHeaders     = []string{"pid", "id", "processid"}
+	ppidHeaders    = []string{"ppid", "parentid", "parentprocessid"}
+	nameHeaders    = []string{"name", "comm", "processname", "image"}
+	userHeaders    = []string{"user", "uid", "username", "owner"}
+	commandHeaders = []string{"command", "cmd", "commandline", "args", "path"}
+)
+
+// ListProcesses runs ps on the session and parses the process table.
+func (s *Session) ListProcesses(ctx context.Context) ([]ProcessInfo, error) {
+	result, err := s.RunCommand(ctx, "", "ps", "ps", 0)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(result.Stderr) != "" {
+		return nil, fmt.Errorf("ps failed on host: %s", strings.TrimSpace(result.Stderr))
+	}
+	return ParseProcessList(result.Stdout)
+}
+
+// KillProcess runs kill for pid and confirms the process is no longer listed.
+func (s *Session) KillProcess(ctx context.Context, pid int) error {
+	if pid <= 0 {
+		return fmt.Errorf("invalid PID %d", pid)
+	}
+	result, err := s.RunCommand(ctx, "", "kill", fmt.Sprintf("kill %d", pid), 0)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(result.Stderr) != "" {
+		return fmt.Errorf("kill %d failed on host: %s", pid, strings.TrimSpace(result.Stderr))
+	}
+
+	processes, err := s.ListProcesses(ctx)
+	if err != nil {
+		return fmt.Errorf("kill %d issued but could not be confirmed: %w", pid, err)
+	}
+	for _, process := range processes {
+		if process.PID == pid {
+			return fmt.Errorf("kill %d issued but process %s is still running", pid, process.Name)
+		}
+	}
+	s.client.Console.Printf("Process %d killed.\n", pid)
+	return nil
+}
+
+// ParseProcessList parses Windows or Linux/macOS ps output. Rows are split by
+// the header's column positions, so process names containing spaces stay in
+// one field.
+func ParseProcessList(output string) ([]ProcessInfo, error) {
+	table, ok := parseTable(output, pidHeaders)
+	if !ok {
+		return nil, fmt.Errorf("ps output has no recognizable header row")
+	}
+
+	processes := []ProcessInfo{}
+	for _, row := range table.rows {
+		pid, err := strconv.Atoi(table.value(row, pidHeaders))
+		if err != nil {
+			continue
+		}
+		process := ProcessInfo{
+			PID:         pid,
+			Name:        table.value(row, nameHeaders),
+			User:        table.value(row, userHeaders),
+			CommandLine: table.value(row, commandHeaders),
+			Columns:     table.columns(row),
+		}
+		process.PPID, _ = strconv.Atoi(table.value(row, ppidHeaders))
+		if process.Name == "" && process.CommandLine != "" {
+			process.Name = processNameFromCommand(process.CommandLine)
+		}
+		processes = append(processes, process)
+	}
+	return processes, nil
+}
+
+// processNameFromCommand derives a name from the executable of a command line.
+func processNameFromCommand(commandLine string) string {
+	executable := strings.Fields(commandLine)[0]
+	if i := strings.LastIndexAny(executable, `/\`); i >= 0 {
+		executable = executable[i+1:]
+	}
+	return executable
+}
+
+// textTable is a fixed-width text table split at its header's column positions.
+type textTable struct {
+	headers []string // Lowercased header names
+	rows    [][]string
+}
+
+// parseTable finds the first line containing one of keyHeaders and splits
+// every following line into cells aligned with that header. Each whitespace
+// separated token goes to the column whose header it sits under, which copes
+// with both left-aligned (Windows) and right-aligned (ps on Linux/macOS)
+// columns. The last column takes the remainder of the line verbatim.
+func parseTable(output string, keyHeaders []string) (*textTable, bool) {
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+
+	headerIndex := -1
+	var headerSpans [][2]int
+	var headers []string
+	for i, line := range lines {
+		spans := tokenSpans(line)
+		for _, span := range spans {
+			if containsFold(keyHeaders, line[span[0]:span[1]]) {
+				headerIndex = i
+				break
+			}
+		}
+		if headerIndex >= 0 {
+			headerSpans = spans
+			for _, span := range spans {
+				headers = append(headers, strings.ToLower(line[span[0]:span[1]]))
+			}
+			break
+		}
+	}
+	if headerIndex < 0 {
+		return nil, false
+	}
+
+	table := &textTable{headers: headers}
+	for _, line := range lines[headerIndex+1:] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.Trim(trimmed, "- ") == "" {
+			continue
+		}
+
+		cells := make([]string, len(headers))
+		for _, span := range tokenSpans(line) {
+			column := overlappingColumn(headerSpans, span)
+			if column == len(headers)-1 {
+				cells[column] = strings.TrimSpace(line[span[0]:])
+				break
+			}
+			if cells[column] != "" {
+				cells[column] += " "
+			}
+			cells[column] += line[span[0]:span[1]]
+		}
+		table.rows = append(table.rows, cells)
+	}
+	return table, true
+}
+
+// value returns the first non-empty cell whose header is one of names.
+func (t *textTable) value(row []string, names []string) string {
+	for i, header := range t.headers {
+		if containsFold(names, header) && row[i] != "" {
+			return row[i]
+		}
+	}
+	return ""
+}
+
+// columns returns the row as a header-to-cell map.
+func (t *textTable) columns(row []string) map[string]string {
+	columns := make(map[string]string, len(t.headers))
+	for i, header := range t.headers {
+		if row[i] != "" {
+			columns[header] = row[i]
+		}
+	}
+	return columns
+}
+
+// overlappingColumn picks the column whose header word overlaps the token
+// the most. Tokens under no header word, such as the second word of a process
+// name, go to the column whose region [header start, next header start)
+// overlaps them most. Ties go to the earlier column.
+func overlappingColumn(headerSpans [][2]int, span [2]int) int {
+	best, bestOverlap := 0, 0
+	for i, header := range headerSpans {
+		if overlap := min(header[1], span[1]) - max(header[0], span[0]); overlap > bestOverlap {
+			best, bestOverlap = i, overlap
+		}
+	}
+	if bestOverlap > 0 {
+		return best
+	}
+
+	best, bestOverlap = 0, -1
+	for i, header := range headerSpans {
+		end := int(^uint(0) >> 1)
+		if i+1 < len(headerSpans) {
+			end = headerSpans[i+1][0]
+		}
+		if overlap := min(end, span[1]) - max(header[0], span[0]); overlap > bestOverlap {
+			best, bestOverlap = i, overlap
+		}
+	}
+	return best
+}
+
+// tokenSpans returns the [start, end) byte offsets of whitespace-separated tokens.
+func tokenSpans(line string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range line {
+		if r == ' ' || r == '\t' {
+			if start >= 0 {
+				spans = append(spans, [2]int{start, i})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(line)})
+	}
+	return spans
+}
+
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package falconrtr
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files under testdata")
+
+// TestParseProcessListGolden parses the ps output samples in testdata/ps,
+// one per platform, and compares the result to the .golden.json beside
+// each. Run with -update to rewrite the golden files after a change.
+func TestParseProcessListGolden(t *testing.T) {
+	samples, err := filepath.Glob(filepath.Join("testdata", "ps", "*.txt"))
+	if err != nil || len(samples) == 0 {
+		t.Fatalf("no ps samples: %v", err)
+	}
+	for _, sample := range samples {
+		t.Run(filepath.Base(sample), func(t *testing.T) {
+			output, err := os.ReadFile(sample)
+			if err != nil {
+				t.Fatal(err)
+			}
+			processes, err := ParseProcessList(string(output))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.MarshalIndent(processes, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := strings.TrimSuffix(sample, ".txt") + ".golden.json"
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("parsed %s differs from %s:\n%s", sample, golden, got)
+			}
+		})
+	}
+}
+
+func TestParseProcessList(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []ProcessInfo // Compared without Columns
+		wantErr bool
+	}{
+		{
+			name:   "name with spaces",
+			output: "Name                 Id\n----                 --\nMicrosoft Edge     120\n",
+			want:   []ProcessInfo{{PID: 120, Name: "Microsoft Edge"}},
+		},
+		{
+			name:   "name from command line",
+			output: "PID COMMAND\n  7 /usr/bin/ssh-agent -l\n",
+			want:   []ProcessInfo{{PID: 7, Name: "ssh-agent", CommandLine: "/usr/bin/ssh-agent -l"}},
+		},
+		{
+			name:   "rows without a numeric PID are skipped",
+			output: "PID NAME\n  1 init\nn/a ghost\n",
+			want:   []ProcessInfo{{PID: 1, Name: "init"}},
+		},
+		{
+			name:   "header only",
+			output: "PID NAME\n",
+			want:   []ProcessInfo{},
+		},
+		{
+			name:    "no header",
+			output:  "ps: command not found\n",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			processes, err := ParseProcessList(test.output)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("parsed %+v, want an error", processes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(processes) != len(test.want) {
+				t.Fatalf("got %d processes %+v, want %d", len(processes), processes, len(test.want))
+			}
+			for i, process := range processes {
+				process.Columns = nil
+				if got, want := process, test.want[i]; got.PID != want.PID || got.PPID != want.PPID || got.Name != want.Name || got.User != want.User || got.CommandLine != want.CommandLine {
+					t.Errorf("process %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
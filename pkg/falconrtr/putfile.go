@@ -0,0 +1,99 @@
+package falconrtr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"strings"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/audit"
+)
+
+// UploadPutFile stores content in the cloud as a put-file named name, for
+// Session.PlaceFile to drop on hosts. The caller deletes it with
+// DeleteCloudFile once it is no longer needed.
+func (c *CrowdStrikeRTRClient) UploadPutFile(ctx context.Context, name, description string, content []byte) (CloudFile, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err == nil {
+		_, err = part.Write(content)
+	}
+	comment := c.auditComment(description)
+	for _, field := range [][2]string{{"name", name}, {"description", description}, {"comments_for_audit_log", comment}} {
+		if err == nil {
+			err = form.WriteField(field[0], field[1])
+		}
+	}
+	if err == nil {
+		err = form.Close()
+	}
+	if err != nil {
+		return CloudFile{}, fmt.Errorf("failed to encode put-file %s: %w", name, err)
+	}
+
+	headers := c.getHeaders(form.FormDataContentType(), true)
+	response, err := c.makeAPICall(ctx, "POST", c.url(EndpointPutFiles, 0), headers, nil, body.Bytes(), nil)
+	c.record(audit.Record{Event: audit.EventPutFileUploaded, Comment: comment, Details: map[string]string{"name": name}}, err)
+	if err != nil {
+		return CloudFile{}, fmt.Errorf("failed to upload put-file %s: %w", name, err)
+	}
+	file := CloudFile{Kind: CloudFilePutFile, Name: name}
+	if resource := firstResource(response); resource != nil {
+		file.ID, _ = resource["id"].(string)
+	}
+	if file.ID != "" {
+		return file, nil
+	}
+
+	// The create response does not always carry the ID; look it up by name.
+	files, err := c.ListCloudFiles(ctx, CloudFilePutFile)
+	if err != nil {
+		return file, err
+	}
+	for _, listed := range files {
+		if listed.Name == name {
+			return listed, nil
+		}
+	}
+	return file, fmt.Errorf("uploaded put-file %s is not listed", name)
+}
+
+// PlaceFile drops the put-file cloudName on the host at remotePath. put
+// writes into the session's working directory under the put-file's name, so
+// the session changes to remotePath's directory, removes an earlier copy and
+// renames the file into place when the names differ.
+func (s *Session) PlaceFile(ctx context.Context, cloudName, remotePath string) error {
+	dir, name := splitRemotePath(remotePath)
+	if name == "" {
+		return fmt.Errorf("%s names a directory, not a file", remotePath)
+	}
+	if err := s.runFileCommand(ctx, "cd", dir, "cd "+quoteArg(dir)); err != nil {
+		return err
+	}
+	if err := s.runFileCommand(ctx, "rm", remotePath, "rm "+quoteArg(name)); err != nil && !errors.Is(err, ErrRemoteFileNotFound) {
+		return err
+	}
+	if err := s.runFileCommand(ctx, "put", remotePath, "put "+quoteArg(cloudName)); err != nil {
+		return err
+	}
+	if name == cloudName || (isWindowsPath(remotePath) && strings.EqualFold(name, cloudName)) {
+		return nil
+	}
+	return s.runFileCommand(ctx, "mv", remotePath, "mv "+quoteArg(cloudName)+" "+quoteArg(name))
+}
+
+// runFileCommand runs one filesystem command on path, for PlaceFile and
+// ArchiveAndGet, and turns a reported failure into an error.
+func (s *Session) runFileCommand(ctx context.Context, baseCommand, path, commandString string) error {
+	result, err := s.RunCommand(ctx, "", baseCommand, commandString, 0)
+	if err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%s %s: %w: %s", baseCommand, path, ErrCommandFailed, FormatResourceErrors(result.Errors))
+	}
+	return remoteFileError(baseCommand, path, result.Stderr)
+}
@@ -0,0 +1,143 @@
+package falconrtr
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RedactionRule replaces every match of Pattern with [REDACTED:<Name>].
+type RedactionRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultRedactionRules covers the secrets scripts most commonly leak into stdout.
+var DefaultRedactionRules = []RedactionRule{
+	{Name: "aws_access_key", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Name: "aws_secret_key", Pattern: regexp.MustCompile(`(?i)aws_secret_access_key\s*[=:]\s*["']?[A-Za-z0-9/+=]{40}["']?`)},
+	{Name: "bearer_token", Pattern: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`)},
+	{Name: "password", Pattern: regexp.MustCompile(`(?i)\b(?:password|passwd|pwd)\s*[=:]\s*[^\s;&"']+`)},
+}
+
+// Redactor applies an ordered list of redaction rules to command output,
+// and replaces the secrets the run obtained, such as uninstall tokens,
+// wherever they appear.
+type Redactor struct {
+	Rules []RedactionRule
+
+	secretsMu sync.RWMutex
+	secrets   map[string]string // Secret value to rule name
+}
+
+// NewRedactor returns a Redactor using the default rules plus any rules
+// listed in the file at path (redaction.rules_file). Each non-empty line of
+// that file has the form name=regex; lines starting with # are ignored.
+func NewRedactor(path string) (*Redactor, error) {
+	rules := append([]RedactionRule{}, DefaultRedactionRules...)
+
+	if path == "" {
+		return &Redactor{Rules: rules}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open redaction rules file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, expr, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%s:%d: expected name=regex", path, lineNo)
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid pattern for rule %q: %w", path, lineNo, name, err)
+		}
+		rules = append(rules, RedactionRule{Name: strings.TrimSpace(name), Pattern: pattern})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read redaction rules file: %w", err)
+	}
+
+	return &Redactor{Rules: rules}, nil
+}
+
+// AddSecret makes Redact and Conceal replace value with [REDACTED:<name>].
+func (r *Redactor) AddSecret(name, value string) {
+	if value == "" {
+		return
+	}
+	r.secretsMu.Lock()
+	defer r.secretsMu.Unlock()
+	if r.secrets == nil {
+		r.secrets = map[string]string{}
+	}
+	r.secrets[value] = name
+}
+
+// Conceal replaces the secrets added with AddSecret in text, for command
+// strings and messages that are printed or recorded. A nil Redactor
+// returns text unchanged.
+func (r *Redactor) Conceal(text string) string {
+	concealed, _ := r.concealCounted(text)
+	return concealed
+}
+
+// concealCounted is Conceal, also returning the replacements made per name.
+func (r *Redactor) concealCounted(text string) (string, map[string]int) {
+	counts := map[string]int{}
+	if r == nil {
+		return text, counts
+	}
+	r.secretsMu.RLock()
+	defer r.secretsMu.RUnlock()
+	for value, name := range r.secrets {
+		if n := strings.Count(text, value); n > 0 {
+			text = strings.ReplaceAll(text, value, fmt.Sprintf("[REDACTED:%s]", name))
+			counts[name] += n
+		}
+	}
+	return text, counts
+}
+
+// Redact replaces all rule matches and secrets in text and returns the
+// redacted text along with the number of replacements made per rule.
+func (r *Redactor) Redact(text string) (string, map[string]int) {
+	text, counts := r.concealCounted(text)
+	for _, rule := range r.Rules {
+		replacement := fmt.Sprintf("[REDACTED:%s]", rule.Name)
+		text = rule.Pattern.ReplaceAllStringFunc(text, func(string) string {
+			counts[rule.Name]++
+			return replacement
+		})
+	}
+	return text, counts
+}
+
+// formatRedactionCounts renders per-rule counts in a stable order for console output.
+func formatRedactionCounts(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%d", name, counts[name]))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,182 @@
+package falconrtr
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RegValue is one registry value parsed from reg query output.
+type RegValue struct {
+	Name  string   `json:"name"`
+	Type  string   `json:"type"`
+	Data  string   `json:"data"`
+	Multi []string `json:"multi,omitempty"` // REG_MULTI_SZ strings
+	Bytes []byte   `json:"bytes,omitempty"` // Decoded REG_BINARY data
+}
+
+// RegQueryResult is the parsed output of a reg query command. When the output
+// cannot be parsed, Raw still holds the text and ParseError explains why.
+type RegQueryResult struct {
+	Key        string     `json:"key"`
+	Values     []RegValue `json:"values"`
+	Subkeys    []string   `json:"subkeys,omitempty"`
+	Raw        string     `json:"raw"`
+	ParseError string     `json:"parse_error,omitempty"`
+}
+
+// hiveAliases maps short hive names to the names the reg command prints.
+var hiveAliases = map[string]string{
+	"HKLM": "HKEY_LOCAL_MACHINE",
+	"HKCU": "HKEY_CURRENT_USER",
+	"HKCR": "HKEY_CLASSES_ROOT",
+	"HKU":  "HKEY_USERS",
+	"HKCC": "HKEY_CURRENT_CONFIG",
+}
+
+// regValueLine matches "<name>  REG_<TYPE>  <data>". The REG_* token is the
+// anchor, so value names with spaces and localized "(Default)" names work.
+var regValueLine = regexp.MustCompile(`^\s*(.*?)\s+(REG_[A-Z_]+)(?:\s+(.*))?$`)
+
+// regFieldLine matches "Name: x" / "Type: REG_SZ" / "Data: y" block-style output.
+var regFieldLine = regexp.MustCompile(`^\s*(Name|Type|Data)\s*:\s*(.*)$`)
+
+// RegQuery runs reg query on hive\keyPath and parses the values and subkeys.
+func (s *Session) RegQuery(ctx context.Context, hive, keyPath string) (*RegQueryResult, error) {
+	key := registryKey(hive, keyPath)
+	result, err := s.RunCommand(ctx, "", "reg", "reg query "+quoteArg(key), 0)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(result.Stderr) != "" {
+		return nil, fmt.Errorf("reg query %s failed on host: %s", key, strings.TrimSpace(result.Stderr))
+	}
+	return ParseRegQuery(key, result.Stdout), nil
+}
+
+// RegQueryValue runs reg query for a single value under hive\keyPath.
+func (s *Session) RegQueryValue(ctx context.Context, hive, keyPath, valueName string) (*RegValue, error) {
+	key := registryKey(hive, keyPath)
+	commandString := fmt.Sprintf("reg query %s %s", quoteArg(key), quoteArg(valueName))
+	result, err := s.RunCommand(ctx, "", "reg", commandString, 0)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(result.Stderr) != "" {
+		return nil, fmt.Errorf("reg query %s %s failed on host: %s", key, valueName, strings.TrimSpace(result.Stderr))
+	}
+
+	parsed := ParseRegQuery(key, result.Stdout)
+	for i := range parsed.Values {
+		if strings.EqualFold(parsed.Values[i].Name, valueName) {
+			return &parsed.Values[i], nil
+		}
+	}
+	if len(parsed.Values) == 1 {
+		return &parsed.Values[0], nil
+	}
+	if parsed.ParseError != "" {
+		return nil, fmt.Errorf("value %s not found: %s", valueName, parsed.ParseError)
+	}
+	return nil, fmt.Errorf("value %s not found under %s", valueName, key)
+}
+
+// ParseRegQuery parses reg query output. It understands the reg.exe layout
+// ("name  REG_TYPE  data" lines under key headers) and the block layout with
+// Name:/Type:/Data: lines. It never fails: unparseable output is returned in
+// Raw with ParseError set.
+func ParseRegQuery(key, output string) *RegQueryResult {
+	result := &RegQueryResult{Key: key, Raw: output, Values: []RegValue{}}
+	normalizedKey := strings.ToUpper(strings.TrimRight(key, `\`))
+
+	var block *RegValue
+	flushBlock := func() {
+		if block != nil && block.Type != "" {
+			result.Values = append(result.Values, decodeRegValue(*block))
+		}
+		block = nil
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		if strings.HasPrefix(strings.ToUpper(trimmed), "HKEY_") {
+			flushBlock()
+			if strings.ToUpper(strings.TrimRight(trimmed, `\`)) != normalizedKey {
+				result.Subkeys = append(result.Subkeys, trimmed)
+			}
+			continue
+		}
+
+		if match := regFieldLine.FindStringSubmatch(line); match != nil {
+			switch match[1] {
+			case "Name":
+				flushBlock()
+				block = &RegValue{Name: match[2]}
+			case "Type":
+				if block == nil {
+					block = &RegValue{}
+				}
+				block.Type = strings.TrimSpace(match[2])
+			case "Data":
+				if block == nil {
+					block = &RegValue{}
+				}
+				block.Data = match[2]
+			}
+			continue
+		}
+
+		if match := regValueLine.FindStringSubmatch(line); match != nil {
+			flushBlock()
+			result.Values = append(result.Values, decodeRegValue(RegValue{
+				Name: match[1],
+				Type: match[2],
+				Data: match[3],
+			}))
+		}
+	}
+	flushBlock()
+
+	if len(result.Values) == 0 && len(result.Subkeys) == 0 && strings.TrimSpace(output) != "" {
+		result.ParseError = "no registry values or subkeys recognized in output"
+	}
+	return result
+}
+
+// decodeRegValue fills the typed representations of multi-string and binary data.
+func decodeRegValue(value RegValue) RegValue {
+	value.Name = strings.TrimSpace(value.Name)
+	switch value.Type {
+	case "REG_MULTI_SZ":
+		for _, part := range strings.Split(value.Data, `\0`) {
+			if part != "" {
+				value.Multi = append(value.Multi, part)
+			}
+		}
+	case "REG_BINARY":
+		compact := strings.NewReplacer(" ", "", ",", "", "-", "").Replace(value.Data)
+		if decoded, err := hex.DecodeString(compact); err == nil {
+			value.Bytes = decoded
+		}
+	}
+	return value
+}
+
+// registryKey joins a hive and key path, expanding short hive names.
+func registryKey(hive, keyPath string) string {
+	hive = strings.TrimRight(hive, `\`)
+	if full, ok := hiveAliases[strings.ToUpper(hive)]; ok {
+		hive = full
+	}
+	keyPath = strings.Trim(keyPath, `\`)
+	if keyPath == "" {
+		return hive
+	}
+	return hive + `\` + keyPath
+}
@@ -0,0 +1,138 @@
+package falconrtr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// Reissue policies decide what IssueCommand does when posting a command
+// failed ambiguously, so the command may or may not have been accepted.
+const (
+	ReissueNever  = "never"  // Fail; a command that might run twice is not repeated
+	ReissueCheck  = "check"  // Adopt a matching command from the session's log, else re-post
+	ReissueAlways = "always" // Re-post; for commands that are safe to repeat
+)
+
+// reissueClockSkew widens the window in which a logged command counts as the
+// one just posted, for clock differences between the collector and the cloud.
+const reissueClockSkew = time.Minute
+
+// ErrIssueAmbiguous is returned by IssueCommand when a command post failed
+// without telling whether the command was accepted and the reissue policy
+// forbids finding out by posting again.
+var ErrIssueAmbiguous = errors.New("command may or may not have been issued")
+
+// ValidReissuePolicy reports whether policy is never, check or always.
+func ValidReissuePolicy(policy string) bool {
+	switch policy {
+	case ReissueNever, ReissueCheck, ReissueAlways:
+		return true
+	}
+	return false
+}
+
+// validateReissueOverrides checks config overrides of the reissue policy.
+func validateReissueOverrides(overrides map[string]string) error {
+	for command, policy := range overrides {
+		if !ValidReissuePolicy(policy) {
+			return fmt.Errorf("reissue_commands.%s: policy must be never, check or always, got %q", command, policy)
+		}
+	}
+	return nil
+}
+
+// ReissuePolicyFor returns the reissue policy of baseCommand: its
+// reissue_commands override, else the client's ReissuePolicy (check when
+// unset).
+func (c *CrowdStrikeRTRClient) ReissuePolicyFor(baseCommand string) string {
+	if policy, ok := c.ReissueCommands[baseCommand]; ok {
+		return policy
+	}
+	if c.ReissuePolicy == "" {
+		return ReissueCheck
+	}
+	return c.ReissuePolicy
+}
+
+// ambiguousIssue reports whether a failed command post may still have been
+// accepted: the request was sent but no answer came back, or a gateway in
+// front of the API gave up waiting for one. Errors raised before sending,
+// such as an exhausted call budget, and cancellation by the caller are not.
+func ambiguousIssue(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusBadGateway || apiErr.StatusCode == http.StatusGatewayTimeout
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// issueAgain recovers from an ambiguous failure to post a command, following
+// the command's reissue policy. since is when the failed post started.
+func (s *Session) issueAgain(ctx context.Context, endpoint string, payload map[string]interface{}, since time.Time, postErr error) (string, error) {
+	baseCommand, _ := payload["base_command"].(string)
+	commandString, _ := payload["command_string"].(string)
+	shown := s.client.Redactor.Conceal(commandString)
+	policy := s.client.ReissuePolicyFor(baseCommand)
+	switch policy {
+	case ReissueNever:
+		return "", fmt.Errorf("%w (reissue policy never): %v", ErrIssueAmbiguous, postErr)
+	case ReissueCheck:
+		cloudRequestID, err := s.findIssuedCommand(ctx, baseCommand, commandString, since)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v; checking the session's commands failed: %v", ErrIssueAmbiguous, postErr, err)
+		}
+		if cloudRequestID != "" {
+			s.warn(sink.WarningCommandReissued, "issuing '%s' failed ambiguously (%v), but the session accepted it as %s; adopting it", shown, postErr, cloudRequestID)
+			return cloudRequestID, nil
+		}
+	}
+	s.warn(sink.WarningCommandReissued, "issuing '%s' failed ambiguously (%v), re-issuing (reissue policy %s)", shown, postErr, policy)
+	s.client.Metrics.Retry()
+	return s.postCommand(ctx, endpoint, payload)
+}
+
+// findIssuedCommand looks in the session's command log for baseCommand with
+// exactly commandString, logged no earlier than since, and returns the
+// cloud_request_id of the latest such command, or "" when there is none.
+func (s *Session) findIssuedCommand(ctx context.Context, baseCommand, commandString string, since time.Time) (string, error) {
+	headers := s.client.getHeaders("application/json", true)
+	payload := map[string]interface{}{"ids": []string{s.SessionID}}
+	response, err := s.client.makeAPICall(ctx, "POST", s.client.url(EndpointSessionDetails, 0), headers, nil, payload, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get details of session %s: %w", s.SessionID, err)
+	}
+	session := firstResource(response)
+	if session == nil {
+		return "", fmt.Errorf("session %s is not listed", s.SessionID)
+	}
+
+	var found string
+	var latest time.Time
+	logs, _ := session["logs"].([]interface{})
+	for _, entry := range logs {
+		record, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		logged := parseTimestamp(record["created_at"])
+		cloudRequestID, _ := record["cloud_request_id"].(string)
+		if record["base_command"] != baseCommand || record["command_string"] != commandString || cloudRequestID == "" {
+			continue
+		}
+		if logged.Before(since.Add(-reissueClockSkew)) || (found != "" && logged.Before(latest)) {
+			continue
+		}
+		found, latest = cloudRequestID, logged
+	}
+	return found, nil
+}
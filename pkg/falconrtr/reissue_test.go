@@ -0,0 +1,98 @@
+package falconrtr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/simulate"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// TestIssueCommandAmbiguous has the simulated API drop its answer to the
+// first post of ls, after accepting the command, and checks what each
+// reissue policy makes of it.
+func TestIssueCommandAmbiguous(t *testing.T) {
+	const device = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	tests := []struct {
+		policy  string
+		posts   int    // Command posts the API sees
+		wantErr error  // Of RunCommand
+		warning string // In the command_reissued warning
+	}{
+		{ReissueCheck, 1, nil, "adopting it"},
+		{ReissueAlways, 2, nil, "re-issuing (reissue policy always)"},
+		{ReissueNever, 1, ErrIssueAmbiguous, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			api := simulate.New(simulate.Options{
+				Devices:   []simulate.Device{{ID: device, Hostname: "alpha", Platform: "windows"}},
+				Outputs:   map[string]string{"ls": "listing of {{hostname}}"},
+				Ambiguous: []string{"ls"},
+			})
+			var mu sync.Mutex
+			var posts, detailCalls int
+			transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				mu.Lock()
+				switch {
+				case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/command/v1"):
+					posts++
+				case req.URL.Path == "/real-time-response/entities/sessions/GET/v1":
+					detailCalls++
+				}
+				mu.Unlock()
+				return api.RoundTrip(req)
+			})
+			client, err := NewCrowdStrikeRTRClient(Options{BaseURL: "https://api.test", Simulated: true, Transport: transport, ReissuePolicy: test.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			if err := client.Authenticate(ctx); err != nil {
+				t.Fatal(err)
+			}
+			session, err := client.InitializeRTRSession(ctx, device)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session.Warnings = &sink.Warnings{}
+
+			result, err := session.RunCommand(ctx, "", "ls", "ls C:\\", time.Minute)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("RunCommand = %v, want %v", err, test.wantErr)
+			}
+			if posts != test.posts {
+				t.Errorf("command posted %d time(s), want %d", posts, test.posts)
+			}
+			if (detailCalls > 0) != (test.policy == ReissueCheck) {
+				t.Errorf("session details requested %d time(s) under policy %s", detailCalls, test.policy)
+			}
+			if test.wantErr != nil {
+				return
+			}
+			if result.Stdout != "listing of alpha" {
+				t.Errorf("stdout %q, want the listing", result.Stdout)
+			}
+			if test.policy == ReissueCheck {
+				// The one post was dropped, so the result can only be of
+				// the command it issued, found in the session's log.
+				issued, err := session.findIssuedCommand(ctx, "ls", "ls C:\\", epoch)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.CloudRequestID == "" || result.CloudRequestID != issued {
+					t.Errorf("result of command %q, want the logged %q adopted", result.CloudRequestID, issued)
+				}
+			}
+			warnings := session.Warnings.List()
+			if len(warnings) != 1 || warnings[0].Code != sink.WarningCommandReissued || !strings.Contains(warnings[0].Message, test.warning) {
+				t.Errorf("warnings %+v, want one %s saying %q", warnings, sink.WarningCommandReissued, test.warning)
+			}
+		})
+	}
+}
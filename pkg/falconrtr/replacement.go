@@ -0,0 +1,114 @@
+package falconrtr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrDeviceNotFound is returned when a session cannot be opened because the
+// API does not know the device ID, typically because the sensor was
+// reinstalled and the host now reports under a new ID.
+var ErrDeviceNotFound = errors.New("device not found")
+
+// IdentifierHostname is the kind FindReplacement re-resolves hosts that
+// were selected by hostname with.
+const IdentifierHostname = "hostname"
+
+// deviceNotFound reports whether err is the API rejecting a device ID it
+// does not know.
+func deviceNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound &&
+		!strings.Contains(strings.ToLower(apiErr.Body), "offline")
+}
+
+// FindReplacement re-resolves what a device that is no longer found was
+// targeted by, a serial number, MAC address or hostname of kind
+// IdentifierSerial, IdentifierMAC or IdentifierHostname, and returns the
+// one other device that now carries it. staleID is dropped from the cached
+// host details either way. It fails when no other device, or more than
+// one, carries the identifier.
+func (c *CrowdStrikeRTRClient) FindReplacement(ctx context.Context, staleID, kind, value string) (Host, error) {
+	staleID = NormalizeDeviceID(staleID)
+	c.forgetHost(staleID)
+
+	field, normalized, query := "", "", ""
+	switch kind {
+	case IdentifierSerial, IdentifierMAC:
+		var err error
+		normalized, err = Identifier{Kind: kind, Value: value, Source: "target"}.Normalize()
+		if err != nil {
+			return Host{}, err
+		}
+		field, query = map[string]string{IdentifierSerial: "serial_number", IdentifierMAC: "mac_address"}[kind], normalized
+	case IdentifierHostname:
+		// Matched case-insensitively below, as hostnames are everywhere else.
+		field, normalized, query = "hostname", NormalizeHostname(value), trimHostname(value)
+	default:
+		return Host{}, fmt.Errorf("cannot re-resolve a device by %q", kind)
+	}
+	ids, _, err := c.QueryDeviceIDs(ctx, field+":["+QuoteFQL(query)+"]", DefaultMaxCandidates)
+	if err != nil {
+		return Host{}, fmt.Errorf("%s lookup failed: %w", field, err)
+	}
+	ids = removeID(ids, staleID)
+	hosts, err := c.GetHosts(ctx, ids)
+	if err != nil {
+		return Host{}, err
+	}
+
+	var candidates []Host
+	for _, host := range hosts {
+		carried := strings.ToUpper(strings.TrimSpace(host.SerialNumber))
+		switch kind {
+		case IdentifierMAC:
+			carried, _ = NormalizeMAC(host.MACAddress)
+		case IdentifierHostname:
+			carried = NormalizeHostname(host.Hostname)
+		}
+		if carried == normalized && host.DeviceID != staleID {
+			candidates = append(candidates, host)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return Host{}, fmt.Errorf("no other device carries %s %s", kind, value)
+	case 1:
+		return candidates[0], nil
+	}
+	described := make([]string, len(candidates))
+	for i, host := range candidates {
+		described[i] = fmt.Sprintf("%s (%s, last seen %s)", host.DeviceID, host.Hostname, host.LastSeen)
+	}
+	return Host{}, fmt.Errorf("%s %s is carried by %d other devices, %s; not choosing one", kind, value, len(candidates), strings.Join(described, ", "))
+}
+
+// KnownHost returns the details of deviceID if GetHosts has seen it.
+func (c *CrowdStrikeRTRClient) KnownHost(deviceID string) (Host, bool) {
+	c.hostsMu.Lock()
+	defer c.hostsMu.Unlock()
+	host, ok := c.hosts[NormalizeDeviceID(deviceID)]
+	return host, ok
+}
+
+// forgetHost drops the cached details of deviceID, so a replaced device's
+// hostname and platform are not reused for its successor's files.
+func (c *CrowdStrikeRTRClient) forgetHost(deviceID string) {
+	c.hostsMu.Lock()
+	defer c.hostsMu.Unlock()
+	delete(c.hosts, deviceID)
+}
+
+// removeID returns ids without id.
+func removeID(ids []string, id string) []string {
+	kept := ids[:0]
+	for _, candidate := range ids {
+		if candidate != id {
+			kept = append(kept, candidate)
+		}
+	}
+	return kept
+}
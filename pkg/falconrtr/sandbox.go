@@ -0,0 +1,281 @@
+package falconrtr
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/audit"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/postprocess"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// DefaultSandboxExtensions are the extensions of the files submitted to the
+// sandbox when sandbox.extensions is empty: executables, scripts and
+// documents, which detonate; logs, hives and archives of collected output
+// do not.
+var DefaultSandboxExtensions = []string{
+	".exe", ".dll", ".sys", ".scr", ".cpl", ".msi", ".lnk", ".jar", ".hta",
+	".ps1", ".bat", ".cmd", ".vbs", ".js", ".wsf", ".py", ".sh",
+	".doc", ".docx", ".docm", ".xls", ".xlsx", ".xlsm", ".ppt", ".pptx", ".pptm", ".rtf", ".pdf",
+}
+
+// DefaultSandboxPollInterval is the delay between the status polls of a
+// sandbox submission. Detonation takes minutes, so polling faster only
+// spends API calls.
+const DefaultSandboxPollInterval = 30 * time.Second
+
+// sandboxScope is the API scopes submitting files to the sandbox needs.
+const sandboxScope = "Falcon Intelligence Sandbox: Write and Sample uploads: Write"
+
+// Sandbox configures the submission of retrieved files to Falcon
+// Intelligence Sandbox (sandbox). Only files with one of Extensions ("*" for
+// any) and of at most MaxBytes are submitted, to EnvironmentID; Timeout
+// bounds the wait for each verdict.
+type Sandbox struct {
+	Extensions    []string
+	MaxBytes      int64
+	EnvironmentID int
+	Timeout       time.Duration
+	PollInterval  time.Duration // 0 uses DefaultSandboxPollInterval
+}
+
+// SandboxReport is the outcome of one sandbox submission. ReportURL opens
+// the full report in the Falcon console.
+type SandboxReport struct {
+	SubmissionID string
+	SHA256       string
+	Verdict      string // e.g. malicious, suspicious or no specific threat
+	ThreatScore  int
+	ReportURL    string
+}
+
+// UploadSample uploads content as the sample name and returns its SHA256,
+// which SubmitToSandbox takes.
+func (c *CrowdStrikeRTRClient) UploadSample(ctx context.Context, name string, content []byte) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("sample", name)
+	if err == nil {
+		_, err = part.Write(content)
+	}
+	comment := c.auditComment("Retrieved by run " + c.RunID)
+	for _, field := range [][2]string{{"file_name", name}, {"comment", comment}} {
+		if err == nil {
+			err = form.WriteField(field[0], field[1])
+		}
+	}
+	if err == nil {
+		err = form.Close()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to encode sample %s: %w", name, err)
+	}
+
+	headers := c.getHeaders(form.FormDataContentType(), true)
+	response, err := c.makeAPICall(ctx, "POST", c.url(EndpointSampleUpload, 0), headers, nil, body.Bytes(), nil)
+	sha256, _ := firstResource(response)["sha256"].(string)
+	c.record(audit.Record{Event: audit.EventSampleUploaded, Comment: comment, Details: map[string]string{"name": name, "sha256": sha256}}, err)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload sample %s: %w", name, err)
+	}
+	if sha256 == "" {
+		return "", fmt.Errorf("sample upload of %s returned no SHA256", name)
+	}
+	return sha256, nil
+}
+
+// SubmitToSandbox submits the uploaded sample sha256 for detonation in the
+// sandbox environment environmentID and returns the submission ID.
+func (c *CrowdStrikeRTRClient) SubmitToSandbox(ctx context.Context, sha256, name string, environmentID int) (string, error) {
+	payload := map[string]interface{}{
+		"sandbox": []map[string]interface{}{{
+			"sha256":         sha256,
+			"environment_id": environmentID,
+			"submit_name":    name,
+		}},
+	}
+	headers := c.getHeaders("application/json", true)
+	response, err := c.makeAPICall(ctx, "POST", c.url(EndpointSandboxSubmissions, 0), headers, nil, payload, nil)
+	id, _ := firstResource(response)["id"].(string)
+	c.record(audit.Record{Event: audit.EventSandboxSubmitted, Details: map[string]string{
+		"name": name, "sha256": sha256, "environment_id": strconv.Itoa(environmentID), "submission_id": id,
+	}}, err)
+	if err != nil {
+		return "", fmt.Errorf("failed to submit %s to the sandbox: %w", name, err)
+	}
+	if id == "" {
+		return "", fmt.Errorf("sandbox submission of %s returned no ID", name)
+	}
+	return id, nil
+}
+
+// WaitForSandboxReport polls the submission every interval until the
+// sandbox finishes it, for at most timeout, and returns its verdict.
+func (c *CrowdStrikeRTRClient) WaitForSandboxReport(ctx context.Context, submissionID string, interval, timeout time.Duration) (SandboxReport, error) {
+	if interval <= 0 {
+		interval = DefaultSandboxPollInterval
+	}
+	clock := c.clock()
+	deadline := clock.Now().Add(timeout)
+	headers := c.getHeaders("application/json", true)
+	params := url.Values{"ids": {submissionID}}
+	for {
+		response, err := c.makeAPICall(ctx, "GET", c.url(EndpointSandboxSubmissions, 0), headers, params, nil, nil)
+		if err != nil {
+			return SandboxReport{}, fmt.Errorf("failed to check sandbox submission %s: %w", submissionID, err)
+		}
+		state, _ := firstResource(response)["state"].(string)
+		switch state {
+		case "success":
+			return c.sandboxReportSummary(ctx, submissionID)
+		case "error":
+			return SandboxReport{}, fmt.Errorf("sandbox submission %s failed", submissionID)
+		}
+		if !clock.Now().Add(interval).Before(deadline) {
+			return SandboxReport{}, fmt.Errorf("sandbox submission %s is still %s after %s", submissionID, orDefault(state, "pending"), timeout)
+		}
+		if err := sleep(ctx, clock, interval); err != nil {
+			return SandboxReport{}, err
+		}
+	}
+}
+
+// sandboxReportSummary fetches the verdict of a finished submission.
+func (c *CrowdStrikeRTRClient) sandboxReportSummary(ctx context.Context, submissionID string) (SandboxReport, error) {
+	headers := c.getHeaders("application/json", true)
+	params := url.Values{"ids": {submissionID}}
+	response, err := c.makeAPICall(ctx, "GET", c.url(EndpointSandboxReportSummaries, 0), headers, params, nil, nil)
+	if err != nil {
+		return SandboxReport{}, fmt.Errorf("failed to fetch sandbox report %s: %w", submissionID, err)
+	}
+	summary := firstResource(response)
+	if summary == nil {
+		return SandboxReport{}, fmt.Errorf("sandbox report %s is not available", submissionID)
+	}
+	report := SandboxReport{SubmissionID: submissionID, ReportURL: c.sandboxReportURL(submissionID)}
+	report.Verdict, _ = summary["verdict"].(string)
+	if runs, _ := summary["sandbox"].([]interface{}); len(runs) > 0 {
+		run, _ := runs[0].(map[string]interface{})
+		report.SHA256, _ = run["sha256"].(string)
+		if score, ok := run["threat_score"].(float64); ok {
+			report.ThreatScore = int(score)
+		}
+		if report.Verdict == "" {
+			report.Verdict, _ = run["verdict"].(string)
+		}
+	}
+	return report, nil
+}
+
+// sandboxReportURL links the console page of a sandbox report. The console
+// is served from the API host with falcon in place of api, e.g.
+// falcon.us-2.crowdstrike.com.
+func (c *CrowdStrikeRTRClient) sandboxReportURL(submissionID string) string {
+	console, err := url.Parse(c.BaseURL)
+	if err != nil || console.Host == "" {
+		return ""
+	}
+	console.Host = strings.Replace(console.Host, "api.", "falcon.", 1)
+	console.Path = "/intelligence/sandbox/reports/" + url.PathEscape(submissionID)
+	return console.String()
+}
+
+// probeSandbox reports whether the credentials reach the sandbox and sample
+// APIs. It only reads: it queries submissions and looks up a sample no file
+// has, so nothing is uploaded or submitted. The read probes cannot tell a
+// write scope from its read half; a client granted only the latter fails at
+// its first submission, with missing_scope.
+func (c *CrowdStrikeRTRClient) probeSandbox(ctx context.Context) (bool, error) {
+	headers := c.getHeaders("application/json", true)
+	probes := []struct {
+		key    string
+		params url.Values
+	}{
+		{EndpointSandboxSubmissionsQuery, url.Values{"limit": {"1"}}},
+		{EndpointSamples, url.Values{"ids": {strings.Repeat("0", sha256.Size*2)}}},
+	}
+	for _, probe := range probes {
+		allowed, err := c.probeScope(ctx, c.url(probe.key, 0), headers, probe.params)
+		if err != nil || !allowed {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// sandboxProcessor submits retrieved files to the sandbox as the last step
+// of post-processing, so their verdicts land with the other findings.
+type sandboxProcessor struct {
+	client *CrowdStrikeRTRClient
+}
+
+// Name returns "sandbox".
+func (sandboxProcessor) Name() string { return "sandbox" }
+
+// Process uploads and submits the file at artifactPath and waits for its
+// verdict. Files the sandbox settings exclude are recorded as not submitted.
+func (p sandboxProcessor) Process(ctx context.Context, artifactPath string, meta postprocess.Meta) ([]sink.Finding, error) {
+	settings := p.client.Sandbox
+	_, name := splitRemotePath(meta.RemotePath)
+	if reason := settings.excludes(name, meta.Size); reason != "" {
+		return []sink.Finding{{Processor: p.Name(), Name: "not_submitted", Value: reason}}, nil
+	}
+	content, err := os.ReadFile(artifactPath)
+	if err != nil {
+		return nil, err
+	}
+	sha256, err := p.client.UploadSample(ctx, name, content)
+	if err != nil {
+		return nil, err
+	}
+	id, err := p.client.SubmitToSandbox(ctx, sha256, name, settings.EnvironmentID)
+	if err != nil {
+		return nil, err
+	}
+	findings := []sink.Finding{{Processor: p.Name(), Name: "submission_id", Value: id, Detail: fmt.Sprintf("environment %d", settings.EnvironmentID)}}
+	report, err := p.client.WaitForSandboxReport(ctx, id, settings.PollInterval, settings.Timeout)
+	if err != nil {
+		return findings, err
+	}
+	return append(findings,
+		sink.Finding{Processor: p.Name(), Name: "verdict", Value: report.Verdict},
+		sink.Finding{Processor: p.Name(), Name: "threat_score", Value: fmt.Sprint(report.ThreatScore)},
+		sink.Finding{Processor: p.Name(), Name: "report_url", Value: report.ReportURL},
+	), nil
+}
+
+// excludes says why a file named name of size bytes is not submitted, or
+// returns "" when it is.
+func (s *Sandbox) excludes(name string, size int64) string {
+	if s.MaxBytes > 0 && size > s.MaxBytes {
+		return fmt.Sprintf("%d bytes exceeds sandbox.max_bytes (%d)", size, s.MaxBytes)
+	}
+	extensions := s.Extensions
+	if len(extensions) == 0 {
+		extensions = DefaultSandboxExtensions
+	}
+	lower := strings.ToLower(name)
+	for _, extension := range extensions {
+		if extension == "*" || strings.HasSuffix(lower, "."+strings.TrimPrefix(strings.ToLower(extension), ".")) {
+			return ""
+		}
+	}
+	return "extension not in sandbox.extensions"
+}
+
+// sandboxProcessor returns the processor submitting files to the sandbox,
+// or nil when the client does not submit them.
+func (c *CrowdStrikeRTRClient) sandboxProcessor() postprocess.Processor {
+	if c.Sandbox == nil {
+		return nil
+	}
+	return sandboxProcessor{client: c}
+}
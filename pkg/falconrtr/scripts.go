@@ -0,0 +1,362 @@
+package falconrtr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrScriptNotFound is returned when no cloud script has the requested name.
+var ErrScriptNotFound = errors.New("cloud script not found")
+
+// ErrScriptPinMismatch is returned when a cloud script's content does not
+// hash to the SHA256 pinned for it.
+var ErrScriptPinMismatch = errors.New("cloud script does not match its pinned SHA256")
+
+// CloudScript is a cloud script with its content. SHA256 is computed from
+// Content when the API returns it, and taken from the API otherwise.
+type CloudScript struct {
+	CloudFile
+	SHA256         string `json:"sha256"`
+	Description    string `json:"description,omitempty"`
+	Platform       string `json:"platform,omitempty"`
+	PermissionType string `json:"permission_type,omitempty"`
+	Content        string `json:"-"`
+}
+
+// GetCloudScript fetches the cloud script named name with its content.
+func (c *CrowdStrikeRTRClient) GetCloudScript(ctx context.Context, name string) (*CloudScript, error) {
+	headers := c.getHeaders("application/json", true)
+	params := url.Values{"filter": {"name:" + QuoteFQL(name)}}
+	response, err := c.makeAPICall(ctx, "GET", c.url(EndpointScriptsQuery, 0), headers, params, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up script %s: %w", name, err)
+	}
+	resources, _ := response["resources"].([]interface{})
+	var ids []string
+	for _, resource := range resources {
+		if id, ok := resource.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrScriptNotFound, name)
+	}
+
+	response, err = c.makeAPICall(ctx, "GET", c.url(EndpointScripts, 0), headers, url.Values{"ids": ids}, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get script %s: %w", name, err)
+	}
+	resources, _ = response["resources"].([]interface{})
+	for _, resource := range resources {
+		resourceMap, ok := resource.(map[string]interface{})
+		if !ok || resourceMap["name"] != name {
+			continue
+		}
+		return parseCloudScript(resourceMap), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrScriptNotFound, name)
+}
+
+// parseCloudScript reads a scripts entity resource.
+func parseCloudScript(resource map[string]interface{}) *CloudScript {
+	script := &CloudScript{CloudFile: CloudFile{Kind: CloudFileScript}}
+	script.ID, _ = resource["id"].(string)
+	script.Name, _ = resource["name"].(string)
+	script.CreatedBy, _ = resource["created_by"].(string)
+	script.ModifiedAt = parseTimestamp(resource["modified_timestamp"])
+	script.Description, _ = resource["description"].(string)
+	script.PermissionType, _ = resource["permission_type"].(string)
+	if platforms, ok := resource["platform"].([]interface{}); ok && len(platforms) > 0 {
+		script.Platform, _ = platforms[0].(string)
+	}
+	script.SHA256, _ = resource["sha256"].(string)
+	if content, ok := resource["content"].(string); ok {
+		script.Content, script.SHA256 = content, HashContent(content)
+	}
+	script.SHA256 = strings.ToLower(script.SHA256)
+	return script
+}
+
+// HashContent returns the hex SHA256 of a script's content.
+func HashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyScript checks the cloud script name against the SHA256 pinned for it
+// in the client's ScriptPins, fetching it once per client. Scripts without a
+// pin pass unchecked. It returns ErrScriptPinMismatch when the content has
+// changed since it was pinned.
+func (c *CrowdStrikeRTRClient) VerifyScript(ctx context.Context, name string) error {
+	pin, ok := c.ScriptPins[name]
+	if !ok {
+		return nil
+	}
+	c.verifiedMu.Lock()
+	defer c.verifiedMu.Unlock()
+	if c.verified[name] {
+		return nil
+	}
+	script, err := c.GetCloudScript(ctx, name)
+	if err != nil {
+		return fmt.Errorf("cannot verify pinned script: %w", err)
+	}
+	if !strings.EqualFold(script.SHA256, pin) {
+		return fmt.Errorf("%w: %s has SHA256 %s, pinned %s", ErrScriptPinMismatch, name, script.SHA256, strings.ToLower(pin))
+	}
+	if c.verified == nil {
+		c.verified = make(map[string]bool)
+	}
+	c.verified[name] = true
+	c.Console.Printf("Cloud script %s matches its pinned SHA256.\n", name)
+	return nil
+}
+
+// LoadScriptPins reads the pinned SHA256 of cloud scripts from the file at
+// path (script_pins_file). Each non-empty line has the form name=sha256;
+// lines starting with # are ignored. An empty path pins nothing.
+func LoadScriptPins(path string) (map[string]string, error) {
+	pins := map[string]string{}
+	if path == "" {
+		return pins, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open script pins file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, hash, ok := strings.Cut(line, "=")
+		name, hash = strings.TrimSpace(name), strings.ToLower(strings.TrimSpace(hash))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%s:%d: expected name=sha256", path, lineNo)
+		}
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("%s:%d: pin for %q is not a SHA256 hex digest", path, lineNo, name)
+		}
+		pins[name] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read script pins file: %w", err)
+	}
+	return pins, nil
+}
+
+// WriteScriptPins writes pins to the file at path in the format
+// LoadScriptPins reads, sorted by script name.
+func WriteScriptPins(path string, pins map[string]string) error {
+	names := make([]string, 0, len(pins))
+	for name := range pins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var out strings.Builder
+	out.WriteString("# Pinned SHA256 of cloud scripts, name=sha256. Review changes before committing.\n")
+	for _, name := range names {
+		fmt.Fprintf(&out, "%s=%s\n", name, pins[name])
+	}
+	if err := os.WriteFile(path, []byte(out.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write script pins file: %w", err)
+	}
+	return nil
+}
+
+// ScriptSpec is the desired state of a cloud script: its content and the
+// metadata it is stored with. Empty metadata fields take the defaults of
+// CreateCloudScript and are left alone by UpdateCloudScript.
+type ScriptSpec struct {
+	Name           string `json:"name"`
+	Content        string `json:"-"`
+	Description    string `json:"description,omitempty"`
+	Platform       string `json:"platform,omitempty"`        // windows, linux or mac
+	PermissionType string `json:"permission_type,omitempty"` // private, group or public
+}
+
+// Defaults CreateCloudScript applies to a ScriptSpec.
+const (
+	DefaultScriptPlatform       = "windows"
+	DefaultScriptPermissionType = "private"
+)
+
+// ListCloudScripts returns every cloud script with its content.
+func (c *CrowdStrikeRTRClient) ListCloudScripts(ctx context.Context) ([]*CloudScript, error) {
+	files, err := c.ListCloudFiles(ctx, CloudFileScript)
+	if err != nil {
+		return nil, err
+	}
+	headers := c.getHeaders("application/json", true)
+	var scripts []*CloudScript
+	for start := 0; start < len(files); start += cleanupPageSize {
+		end := min(start+cleanupPageSize, len(files))
+		params := url.Values{}
+		for _, file := range files[start:end] {
+			params.Add("ids", file.ID)
+		}
+		response, err := c.makeAPICall(ctx, "GET", c.url(EndpointScripts, 0), headers, params, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get script details: %w", err)
+		}
+		resources, _ := response["resources"].([]interface{})
+		for _, resource := range resources {
+			if resourceMap, ok := resource.(map[string]interface{}); ok {
+				scripts = append(scripts, parseCloudScript(resourceMap))
+			}
+		}
+	}
+	return scripts, nil
+}
+
+// CreateCloudScript stores spec as a new cloud script, defaulting its
+// platform to DefaultScriptPlatform and its permission type to
+// DefaultScriptPermissionType.
+func (c *CrowdStrikeRTRClient) CreateCloudScript(ctx context.Context, spec ScriptSpec) error {
+	spec.Platform = orDefault(spec.Platform, DefaultScriptPlatform)
+	spec.PermissionType = orDefault(spec.PermissionType, DefaultScriptPermissionType)
+	return c.sendScript(ctx, "POST", "", spec)
+}
+
+// UpdateCloudScript replaces the content of the cloud script id with that
+// of spec, and the metadata spec sets.
+func (c *CrowdStrikeRTRClient) UpdateCloudScript(ctx context.Context, id string, spec ScriptSpec) error {
+	return c.sendScript(ctx, "PATCH", id, spec)
+}
+
+// sendScript posts or patches a script as the multipart form the scripts
+// endpoint takes.
+func (c *CrowdStrikeRTRClient) sendScript(ctx context.Context, method, id string, spec ScriptSpec) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	fields := [][2]string{{"id", id}, {"name", spec.Name}, {"content", spec.Content}, {"description", spec.Description},
+		{"platform", spec.Platform}, {"permission_type", spec.PermissionType}, {"comments_for_audit_log", c.auditComment("synced by " + UserAgent)}}
+	var err error
+	for _, field := range fields {
+		if err == nil && field[1] != "" {
+			err = form.WriteField(field[0], field[1])
+		}
+	}
+	if err == nil {
+		err = form.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode script %s: %w", spec.Name, err)
+	}
+	headers := c.getHeaders(form.FormDataContentType(), true)
+	if _, err := c.makeAPICall(ctx, method, c.url(EndpointScripts, 0), headers, nil, body.Bytes(), nil); err != nil {
+		return fmt.Errorf("failed to store script %s: %w", spec.Name, err)
+	}
+	return nil
+}
+
+// Script sync actions.
+const (
+	SyncCreate = "create"
+	SyncUpdate = "update"
+	SyncDelete = "delete"
+)
+
+// ScriptChange is one step of a script sync: creating a local script missing
+// from the cloud, updating a cloud script whose content or metadata differs,
+// or, with prune, deleting a cloud script with no local counterpart.
+type ScriptChange struct {
+	Action         string   `json:"action"`
+	Name           string   `json:"name"`
+	ID             string   `json:"id,omitempty"`
+	SHA256         string   `json:"sha256,omitempty"`          // Of the local content
+	PreviousSHA256 string   `json:"previous_sha256,omitempty"` // Of the cloud content
+	Changed        []string `json:"changed,omitempty"`         // Fields an update changes
+	Done           bool     `json:"done"`
+	Error          string   `json:"error,omitempty"`
+
+	spec ScriptSpec
+}
+
+// PlanScriptSync compares local scripts against the cloud ones by name and
+// returns the changes that bring the cloud in line, sorted by name.
+func PlanScriptSync(local []ScriptSpec, cloud []*CloudScript, prune bool) []ScriptChange {
+	byName := make(map[string]*CloudScript, len(cloud))
+	for _, script := range cloud {
+		byName[script.Name] = script
+	}
+	var changes []ScriptChange
+	seen := make(map[string]bool, len(local))
+	for _, spec := range local {
+		seen[spec.Name] = true
+		change := ScriptChange{Name: spec.Name, SHA256: HashContent(spec.Content), spec: spec}
+		existing := byName[spec.Name]
+		if existing == nil {
+			change.Action = SyncCreate
+			changes = append(changes, change)
+			continue
+		}
+		change.ID, change.PreviousSHA256 = existing.ID, existing.SHA256
+		if change.SHA256 != existing.SHA256 {
+			change.Changed = append(change.Changed, "content")
+		}
+		for _, field := range []struct{ name, want, have string }{
+			{"description", spec.Description, existing.Description},
+			{"platform", spec.Platform, existing.Platform},
+			{"permission_type", spec.PermissionType, existing.PermissionType},
+		} {
+			if field.want != "" && !strings.EqualFold(field.want, field.have) {
+				change.Changed = append(change.Changed, field.name)
+			}
+		}
+		if len(change.Changed) > 0 {
+			change.Action = SyncUpdate
+			changes = append(changes, change)
+		}
+	}
+	if prune {
+		for _, script := range cloud {
+			if !seen[script.Name] {
+				changes = append(changes, ScriptChange{Action: SyncDelete, Name: script.Name, ID: script.ID, PreviousSHA256: script.SHA256})
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// ApplyScriptSync carries out changes planned by PlanScriptSync, recording in
+// each whether it was done or the error it failed with. A failed change does
+// not stop the others; the returned count is of the failures.
+func (c *CrowdStrikeRTRClient) ApplyScriptSync(ctx context.Context, changes []ScriptChange) int {
+	failed := 0
+	for i := range changes {
+		change := &changes[i]
+		var err error
+		switch change.Action {
+		case SyncCreate:
+			err = c.CreateCloudScript(ctx, change.spec)
+		case SyncUpdate:
+			err = c.UpdateCloudScript(ctx, change.ID, change.spec)
+		case SyncDelete:
+			err = c.DeleteCloudFile(ctx, CloudFile{Kind: CloudFileScript, ID: change.ID, Name: change.Name})
+		}
+		if err != nil {
+			change.Error = err.Error()
+			failed++
+			continue
+		}
+		change.Done = true
+	}
+	return failed
+}
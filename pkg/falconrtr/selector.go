@@ -0,0 +1,223 @@
+package falconrtr
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Hostname match modes of a HostSelector.
+const (
+	MatchGlob  = "glob"
+	MatchRegex = "regex"
+)
+
+const (
+	// DefaultMaxCandidates bounds the hosts fetched for client-side matching.
+	DefaultMaxCandidates = 10000
+	devicesPageSize      = 5000
+	deviceDetailsBatch   = 500
+)
+
+// Host is a device with the details needed to select and report on it.
+type Host struct {
+	DeviceID string `json:"device_id"`
+	Hostname string `json:"hostname"`
+	Platform string `json:"platform,omitempty"`
+	LastSeen string `json:"last_seen,omitempty"`
+
+	SerialNumber string `json:"serial_number,omitempty"`
+	MACAddress   string `json:"mac_address,omitempty"`
+}
+
+// NormalizeDeviceID returns the form device IDs are compared and keyed in:
+// trimmed and in lower case, as the devices API reports them. IDs given in
+// configuration or files may arrive in upper or mixed case.
+func NormalizeDeviceID(deviceID string) string {
+	return strings.ToLower(strings.TrimSpace(deviceID))
+}
+
+// NormalizeHostname returns the form hostnames are matched in: trimmed,
+// without the trailing dot of a fully qualified name and in lower case.
+// Host keeps the hostname as the devices API reports it, for display.
+func NormalizeHostname(hostname string) string {
+	return strings.ToLower(trimHostname(hostname))
+}
+
+// trimHostname strips spaces and the trailing dot of a fully qualified name.
+func trimHostname(hostname string) string {
+	return strings.TrimSuffix(strings.TrimSpace(hostname), ".")
+}
+
+// HostSelector picks target hosts by hostname. Candidates are the devices
+// matching the FQL Filter (all devices when empty), up to MaxCandidates;
+// their hostnames are then matched against Pattern, a glob or an RE2
+// regular expression, case-insensitively unless CaseSensitive is set. A
+// trailing dot is ignored on both.
+type HostSelector struct {
+	Pattern       string
+	Match         string // MatchGlob (default) or MatchRegex
+	Filter        string
+	CaseSensitive bool
+	MaxCandidates int
+}
+
+// Selection is the outcome of a HostSelector. Truncated is set when more
+// devices matched the filter than MaxCandidates allowed to fetch.
+type Selection struct {
+	Candidates int
+	Truncated  bool
+	Matched    []Host
+}
+
+// DeviceIDs returns the device IDs of the matched hosts.
+func (s *Selection) DeviceIDs() []string {
+	ids := make([]string, 0, len(s.Matched))
+	for _, host := range s.Matched {
+		ids = append(ids, host.DeviceID)
+	}
+	return ids
+}
+
+// Matcher compiles the selector's pattern into a hostname predicate.
+func (sel HostSelector) Matcher() (func(hostname string) bool, error) {
+	switch sel.Match {
+	case "", MatchGlob:
+		normalize := NormalizeHostname
+		if sel.CaseSensitive {
+			normalize = trimHostname
+		}
+		pattern := normalize(sel.Pattern)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid hostname glob %q: %w", sel.Pattern, err)
+		}
+		return func(hostname string) bool {
+			hostname = normalize(hostname)
+			matched, _ := path.Match(pattern, hostname)
+			return matched
+		}, nil
+	case MatchRegex:
+		pattern := sel.Pattern
+		if !sel.CaseSensitive {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hostname regex %q: %w", sel.Pattern, err)
+		}
+		return func(hostname string) bool {
+			return re.MatchString(trimHostname(hostname))
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown hostname match mode %q (want %s or %s)", sel.Match, MatchGlob, MatchRegex)
+}
+
+// SelectHosts fetches the candidate hosts of sel and returns those whose
+// hostname matches.
+func (c *CrowdStrikeRTRClient) SelectHosts(ctx context.Context, sel HostSelector) (*Selection, error) {
+	match, err := sel.Matcher()
+	if err != nil {
+		return nil, err
+	}
+	maxCandidates := sel.MaxCandidates
+	if maxCandidates <= 0 {
+		maxCandidates = DefaultMaxCandidates
+	}
+
+	ids, truncated, err := c.QueryDeviceIDs(ctx, sel.Filter, maxCandidates)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := c.GetHosts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	selection := &Selection{Candidates: len(hosts), Truncated: truncated}
+	seen := map[string]bool{}
+	for _, host := range hosts {
+		if seen[host.DeviceID] {
+			continue
+		}
+		seen[host.DeviceID] = true
+		if match(host.Hostname) {
+			selection.Matched = append(selection.Matched, host)
+		}
+	}
+	return selection, nil
+}
+
+// QueryDeviceIDs pages through the device IDs matching the FQL filter, up
+// to max. truncated reports that the API holds more matches.
+func (c *CrowdStrikeRTRClient) QueryDeviceIDs(ctx context.Context, filter string, max int) (ids []string, truncated bool, err error) {
+	headers := c.getHeaders("application/json", true)
+	for offset := 0; len(ids) < max; {
+		limit := min(devicesPageSize, max-len(ids))
+		params := url.Values{"limit": {strconv.Itoa(limit)}, "offset": {strconv.Itoa(offset)}}
+		if filter != "" {
+			params.Set("filter", filter)
+		}
+		response, err := c.makeAPICall(ctx, "GET", c.url(EndpointDevicesQuery, 0), headers, params, nil, nil)
+		if err != nil {
+			return nil, false, fmt.Errorf("device query failed: %w", err)
+		}
+		resources, _ := response["resources"].([]interface{})
+		for _, resource := range resources {
+			if id, ok := resource.(string); ok {
+				ids = append(ids, NormalizeDeviceID(id))
+			}
+		}
+		next, more := responseMeta(response).Pagination.Next(offset, len(resources), limit)
+		if !more {
+			return ids, false, nil
+		}
+		offset = next
+	}
+	return ids, true, nil
+}
+
+// GetHosts returns the hostname, platform, last-seen time, serial number
+// and MAC address of each device.
+func (c *CrowdStrikeRTRClient) GetHosts(ctx context.Context, deviceIDs []string) ([]Host, error) {
+	var hosts []Host
+	err := c.deviceDetails(ctx, deviceIDs, func(resourceMap map[string]interface{}) {
+		host := Host{}
+		host.DeviceID, _ = resourceMap["device_id"].(string)
+		host.DeviceID = NormalizeDeviceID(host.DeviceID)
+		host.Hostname, _ = resourceMap["hostname"].(string)
+		host.Platform, _ = resourceMap["platform_name"].(string)
+		host.LastSeen, _ = resourceMap["last_seen"].(string)
+		host.SerialNumber, _ = resourceMap["serial_number"].(string)
+		host.MACAddress, _ = resourceMap["mac_address"].(string)
+		hosts = append(hosts, host)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.rememberHosts(hosts)
+	return hosts, nil
+}
+
+// deviceDetails looks up the devices in batches and passes each device
+// resource the API returns to fn.
+func (c *CrowdStrikeRTRClient) deviceDetails(ctx context.Context, deviceIDs []string, fn func(resourceMap map[string]interface{})) error {
+	headers := c.getHeaders("application/json", true)
+	for start := 0; start < len(deviceIDs); start += deviceDetailsBatch {
+		batch := deviceIDs[start:min(start+deviceDetailsBatch, len(deviceIDs))]
+		response, err := c.makeAPICall(ctx, "POST", c.url(EndpointDevices, 0), headers, nil, map[string]interface{}{"ids": batch}, nil)
+		if err != nil {
+			return fmt.Errorf("device details lookup failed: %w", err)
+		}
+		resources, _ := response["resources"].([]interface{})
+		for _, resource := range resources {
+			if resourceMap, ok := resource.(map[string]interface{}); ok {
+				fn(resourceMap)
+			}
+		}
+	}
+	return nil
+}
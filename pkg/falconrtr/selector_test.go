@@ -0,0 +1,98 @@
+package falconrtr
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// devicesTransport answers the devices query with ids, whatever the filter,
+// and the device details with hosts.
+func devicesTransport(ids []string, hosts []map[string]interface{}) roundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		var resources interface{} = hosts
+		if strings.HasPrefix(req.URL.Path, "/devices/queries/") {
+			resources = ids
+		}
+		body, _ := json.Marshal(map[string]interface{}{"resources": resources, "meta": map[string]interface{}{"pagination": map[string]interface{}{"total": len(ids)}}})
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(string(body))), Request: req}, nil
+	}
+}
+
+func TestSelectHostsDeduplicates(t *testing.T) {
+	const upper, lower = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	const other = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	tests := []struct {
+		name     string
+		selector HostSelector
+		ids      []string // Device IDs the query returns
+		hosts    []map[string]interface{}
+		want     []Host
+	}{
+		{
+			// The same host given as an upper-case ID, as from a file, and
+			// found lower case by the FQL filter.
+			name:     "upper- and lower-case device ID",
+			selector: HostSelector{Pattern: "alpha", Filter: "device_id:['" + upper + "']"},
+			ids:      []string{upper, lower},
+			hosts: []map[string]interface{}{
+				{"device_id": upper, "hostname": "alpha"},
+				{"device_id": lower, "hostname": "alpha"},
+			},
+			want: []Host{{DeviceID: lower, Hostname: "alpha"}},
+		},
+		{
+			name:     "FQDN with a trailing dot",
+			selector: HostSelector{Pattern: "WEB-1.example.com"},
+			ids:      []string{lower, other},
+			hosts: []map[string]interface{}{
+				{"device_id": lower, "hostname": "web-1.example.com."},
+				{"device_id": other, "hostname": "web-2.example.com."},
+			},
+			want: []Host{{DeviceID: lower, Hostname: "web-1.example.com."}},
+		},
+		{
+			name:     "pattern with a trailing dot",
+			selector: HostSelector{Pattern: "web-*.example.com.", Match: MatchGlob},
+			ids:      []string{lower, other},
+			hosts: []map[string]interface{}{
+				{"device_id": lower, "hostname": "web-1.example.com"},
+				{"device_id": strings.ToUpper(other), "hostname": "Web-2.Example.com."},
+			},
+			want: []Host{{DeviceID: lower, Hostname: "web-1.example.com"}, {DeviceID: other, Hostname: "Web-2.Example.com."}},
+		},
+		{
+			name:     "regex with a trailing dot",
+			selector: HostSelector{Pattern: `^web-\d\.example\.com$`, Match: MatchRegex},
+			ids:      []string{lower},
+			hosts:    []map[string]interface{}{{"device_id": lower, "hostname": "WEB-1.example.com."}},
+			want:     []Host{{DeviceID: lower, Hostname: "WEB-1.example.com."}},
+		},
+		{
+			name:     "case-sensitive",
+			selector: HostSelector{Pattern: "alpha", CaseSensitive: true},
+			ids:      []string{lower, other},
+			hosts: []map[string]interface{}{
+				{"device_id": lower, "hostname": "Alpha"},
+				{"device_id": other, "hostname": "alpha."},
+			},
+			want: []Host{{DeviceID: other, Hostname: "alpha."}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newTestClient(t, devicesTransport(test.ids, test.hosts))
+			selection, err := client.SelectHosts(context.Background(), test.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(selection.Matched, test.want) {
+				t.Errorf("matched %+v, want %+v", selection.Matched, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package falconrtr
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/audit"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+const (
+	// MaxScriptTimeout is the longest -Timeout runscript accepts.
+	MaxScriptTimeout = 10 * time.Minute
+	// scriptTimeoutGrace is how much longer than a script's -Timeout its
+	// command is polled, so the platform's timeout error is collected
+	// instead of the poll giving up first.
+	scriptTimeoutGrace = 15 * time.Second
+)
+
+// Session is one RTR session on one device. It carries the per-host state
+// that used to live on the client; any number of sessions can share a
+// client and be used from different goroutines.
+type Session struct {
+	client    *CrowdStrikeRTRClient
+	DeviceID  string
+	SessionID string
+
+	// Warnings collects the host's warnings; the client's Warnings are
+	// used when it is nil.
+	Warnings *sink.Warnings
+}
+
+// warn records a warning about the session's host.
+func (s *Session) warn(code, format string, args ...interface{}) {
+	s.client.warn(s.Warnings, code, s.DeviceID, format, args...)
+}
+
+// warn records a warning in warnings or, when nil, in the client's
+// Warnings. Without either, the warning is only printed.
+func (c *CrowdStrikeRTRClient) warn(warnings *sink.Warnings, code, deviceID, format string, args ...interface{}) {
+	if warnings == nil {
+		warnings = c.Warnings
+	}
+	if warnings == nil {
+		warnings = &sink.Warnings{Console: c.Console}
+	}
+	warnings.Add(code, deviceID, format, args...)
+}
+
+// InitializeRTRSession initializes a new Real-time Response session on deviceID.
+func (c *CrowdStrikeRTRClient) InitializeRTRSession(ctx context.Context, deviceID string) (*Session, error) {
+	deviceID = NormalizeDeviceID(deviceID)
+	if deviceID == "" {
+		return nil, fmt.Errorf("device ID not provided, cannot initialize RTR session")
+	}
+
+	headers := c.getHeaders("application/json", true)
+	params := url.Values{"timeout": {"30"}, "timeout_duration": {"30s"}}
+	origin := c.auditComment(c.userAgent())
+	payload := map[string]interface{}{"device_id": deviceID, "queue_offline": false, "origin": origin}
+
+	c.Console.Printf("Attempting to initialize RTR session for device: %s...\n", deviceID)
+	sessionInfo, err := c.makeAPICall(ctx, "POST", c.url(EndpointSessions, 0), headers, params, payload, nil)
+	record := audit.Record{Event: audit.EventSessionOpened, DeviceID: deviceID, Comment: origin}
+	if deviceNotFound(err) {
+		err = fmt.Errorf("failed to initialize RTR session: %w: %w", ErrDeviceNotFound, err)
+		c.record(record, err)
+		return nil, err
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to initialize RTR session: %w", err)
+		c.record(record, err)
+		return nil, err
+	}
+
+	// The response structure is `{"resources": [{"session_id": "..."}]}`
+	if resource := firstResource(sessionInfo); resource != nil {
+		if sessionID, ok := resource["session_id"].(string); ok && sessionID != "" {
+			c.Metrics.sessionOpened(1)
+			c.recordSession(sessionID)
+			record.SessionID = sessionID
+			c.record(record, nil)
+			return &Session{client: c, DeviceID: deviceID, SessionID: sessionID}, nil
+		}
+	}
+	err = fmt.Errorf("session_id not found in RTR session initialization response")
+	c.record(record, err)
+	return nil, err
+}
+
+// Refresh extends the session before it times out.
+func (s *Session) Refresh(ctx context.Context) error {
+	headers := s.client.getHeaders("application/json", true)
+	payload := map[string]interface{}{"device_id": s.DeviceID, "queue_offline": false}
+	response, err := s.client.makeAPICall(ctx, "POST", s.client.url(EndpointRefreshSession, 0), headers, nil, payload, nil)
+	if err != nil {
+		return fmt.Errorf("failed to refresh session %s: %w", s.SessionID, err)
+	}
+	if resource := firstResource(response); resource != nil {
+		if sessionID, ok := resource["session_id"].(string); ok && sessionID != "" {
+			s.SessionID = sessionID
+			s.client.recordSession(sessionID)
+		}
+	}
+	return nil
+}
+
+// Delete closes the session.
+func (s *Session) Delete(ctx context.Context) error {
+	return s.client.DeleteSession(ctx, s.SessionID)
+}
+
+// ScriptCommand returns the runscript command string RunScriptWithTimeout
+// issues for scriptName. A positive timeout is passed as -Timeout, rounded
+// up to whole seconds. The per-host fields of a CommandLine read as
+// <device_id> and <hostname>, and its secrets as [REDACTED:<name>].
+func (c *CrowdStrikeRTRClient) ScriptCommand(scriptName string, timeout time.Duration) string {
+	return c.plannedCommand(scriptName, timeout, "")
+}
+
+// ContinuationCommand returns the command string ContinueScript issues for
+// scriptName, as ScriptCommand does, with the token read as <token>.
+func (c *CrowdStrikeRTRClient) ContinuationCommand(scriptName string, timeout time.Duration) string {
+	return c.plannedCommand(scriptName, timeout, c.continuationArgument("<token>"))
+}
+
+// plannedCommand renders a script command string for display, with
+// placeholders for the per-host fields and secrets of a CommandLine.
+func (c *CrowdStrikeRTRClient) plannedCommand(scriptName string, timeout time.Duration, continuation string) string {
+	commandLine := ""
+	if c.CommandLine != nil {
+		// ParseCommandLine has checked the fields, so rendering cannot fail.
+		commandLine, _ = c.CommandLine.render(ScriptContext{
+			RunID: c.RunID, CaseID: c.CaseID, DeviceID: "<device_id>", Hostname: "<hostname>",
+			Secrets: ScriptSecrets{UninstallToken: "[REDACTED:uninstall_token]"},
+		})
+	}
+	return c.scriptCommand(scriptName, timeout, commandLine, continuation)
+}
+
+// scriptCommand builds a runscript command string, passing commandLine, if
+// any, and then continuation as -CommandLine.
+func (c *CrowdStrikeRTRClient) scriptCommand(scriptName string, timeout time.Duration, commandLine, continuation string) string {
+	commandString := fmt.Sprintf(`runscript -CloudFile="%s"`, scriptName)
+	if timeout > 0 {
+		commandString += fmt.Sprintf(" -Timeout=%d", scriptTimeoutSeconds(timeout))
+	}
+	if commandLine == "" && c.PassRunID && c.RunID != "" {
+		// Lets host-side script logs be tied back to this run.
+		commandLine = "-RunId " + c.RunID
+	}
+	if continuation != "" {
+		commandLine = strings.TrimSpace(commandLine + " " + continuation)
+	}
+	if commandLine != "" {
+		commandString += fmt.Sprintf(` -CommandLine="%s"`, commandLine)
+	}
+	return commandString
+}
+
+// continuationArgument is how a continuation token is passed to a script:
+// -<ContinuationParameter> '<token>'.
+func (c *CrowdStrikeRTRClient) continuationArgument(token string) string {
+	parameter := c.ContinuationParameter
+	if parameter == "" {
+		parameter = DefaultContinuationParameter
+	}
+	return fmt.Sprintf("-%s '%s'", parameter, token)
+}
+
+// DefaultContinuationParameter is the script parameter ContinueScript
+// passes a continuation token in when ContinuationParameter is not set.
+const DefaultContinuationParameter = "Continuation"
+
+// RunScript runs a cloud-stored script on the session with the client's
+// ScriptTimeout and returns a handle to the issued command.
+func (s *Session) RunScript(ctx context.Context, scriptName string) (*Command, error) {
+	return s.RunScriptWithTimeout(ctx, scriptName, s.client.ScriptTimeout)
+}
+
+// RunScriptWithTimeout runs a cloud-stored script with -Timeout set to
+// timeout, or the platform default when timeout is 0. Command.Wait then
+// polls until slightly after the script timeout. runscript needs the admin
+// endpoint unless command_endpoints says otherwise. A script pinned in the
+// client's ScriptPins is refused unless it still matches its pin. A
+// CommandLine is rendered for the session's host; an uninstall token it
+// uses is revealed first and concealed in everything but the command sent.
+func (s *Session) RunScriptWithTimeout(ctx context.Context, scriptName string, timeout time.Duration) (*Command, error) {
+	return s.runScript(ctx, scriptName, timeout, "")
+}
+
+// ContinueScript runs a cloud-stored script as RunScript does, for the
+// next part of work it reported as partial: token, the continuation token
+// of the run before, is appended to its -CommandLine as
+// -<ContinuationParameter> '<token>'. A token that cannot be quoted there,
+// one with quotes or line breaks, is refused.
+func (s *Session) ContinueScript(ctx context.Context, scriptName, token string) (*Command, error) {
+	if token == "" || strings.ContainsAny(token, "'\"\r\n") {
+		return nil, fmt.Errorf("continuation token %q cannot be passed on a command line", token)
+	}
+	return s.runScript(ctx, scriptName, s.client.ScriptTimeout, s.client.continuationArgument(token))
+}
+
+// runScript issues a runscript command for scriptName, with continuation,
+// if any, appended to its command line.
+func (s *Session) runScript(ctx context.Context, scriptName string, timeout time.Duration, continuation string) (*Command, error) {
+	if timeout < 0 || timeout > MaxScriptTimeout {
+		return nil, fmt.Errorf("script timeout %s is out of range (at most %s)", timeout, MaxScriptTimeout)
+	}
+	if err := s.client.VerifyScript(ctx, scriptName); err != nil {
+		return nil, err
+	}
+	commandLine, err := s.scriptCommandLine(ctx)
+	if err != nil {
+		return nil, err
+	}
+	commandString := s.client.scriptCommand(scriptName, timeout, commandLine, continuation)
+
+	s.client.Console.Printf("Attempting to run RTR script '%s' for session: %s on device: %s...\n",
+		scriptName, s.SessionID, s.DeviceID)
+	command, err := s.IssueCommand(ctx, "", "runscript", commandString)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		command.ScriptTimeout = time.Duration(scriptTimeoutSeconds(timeout)) * time.Second
+	}
+	return command, nil
+}
+
+// scriptTimeoutSeconds rounds timeout up to whole seconds.
+func scriptTimeoutSeconds(timeout time.Duration) int {
+	return int((timeout + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,76 @@
+package falconrtr_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/falconrtr"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/simulate"
+)
+
+// TestConcurrentSessions drives many sessions of one client at once; run
+// with -race. Each session must see only its own device's output.
+func TestConcurrentSessions(t *testing.T) {
+	const hosts = 16
+	var devices []simulate.Device
+	for i := 0; i < hosts; i++ {
+		devices = append(devices, simulate.Device{ID: fmt.Sprintf("%032x", i+1), Hostname: fmt.Sprintf("HOST-%02d", i+1), Platform: "windows"})
+	}
+	client, err := falconrtr.NewCrowdStrikeRTRClient(falconrtr.Options{
+		BaseURL:   "https://api.crowdstrike.com",
+		Simulated: true,
+		Transport: simulate.New(simulate.Options{
+			Devices: devices,
+			Outputs: map[string]string{"collect.ps1": "{{device_id}} {{hostname}}\n"},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := client.Authenticate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for _, device := range devices {
+		wg.Add(1)
+		go func(device simulate.Device) {
+			defer wg.Done()
+			session, err := client.InitializeRTRSession(ctx, device.ID)
+			if err != nil {
+				t.Errorf("%s: %v", device.ID, err)
+				return
+			}
+			defer session.Delete(context.Background())
+
+			for run := 0; run < 3; run++ {
+				command, err := session.RunScript(ctx, "collect.ps1")
+				if err != nil {
+					t.Errorf("%s: %v", device.ID, err)
+					return
+				}
+				result, err := command.Wait(ctx, time.Minute)
+				if err != nil {
+					t.Errorf("%s: %v", device.ID, err)
+					return
+				}
+				if want := device.ID + " " + device.Hostname + "\n"; result.Stdout != want {
+					t.Errorf("%s: stdout %q, want %q", device.ID, result.Stdout, want)
+				}
+				if result.SessionID != session.SessionID || result.CloudRequestID != command.CloudRequestID {
+					t.Errorf("%s: result of session %s request %s, want session %s request %s",
+						device.ID, result.SessionID, result.CloudRequestID, session.SessionID, command.CloudRequestID)
+				}
+			}
+		}(device)
+	}
+	wg.Wait()
+
+	if snapshot := client.Metrics.Snapshot(); snapshot.SessionsOpened != hosts {
+		t.Errorf("%d sessions opened, want %d", snapshot.SessionsOpened, hosts)
+	}
+}
@@ -0,0 +1,128 @@
+package falconrtr
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultThrottlePause is how long a 429 pauses polling when the response
+// does not say when to retry.
+const DefaultThrottlePause = 5 * time.Second
+
+// DefaultThrottleJitter spreads the pollers over this long after a pause.
+const DefaultThrottleJitter = 2 * time.Second
+
+// Throttle coordinates every poll loop of a client while the API throttles
+// it. A 429 anywhere pauses them all until its retry-after has passed; each
+// then resumes after its own random delay of up to Jitter, so they do not
+// return at once. With PauseIssuance, new commands wait out a pause too.
+// The zero value is ready to use and safe for concurrent use; a nil
+// *Throttle never pauses.
+type Throttle struct {
+	Jitter        time.Duration // 0 uses DefaultThrottleJitter
+	PauseIssuance bool
+	Clock         Clock // nil uses SystemClock
+
+	mu     sync.Mutex
+	until  time.Time
+	pauses int
+	paused time.Duration
+}
+
+// ThrottleStats counts the pauses of a Throttle and their combined length.
+type ThrottleStats struct {
+	Pauses    int           `json:"pauses"`
+	PausedFor time.Duration `json:"paused_for"`
+}
+
+// Pause holds every poller for d from now, or DefaultThrottlePause when d is
+// not positive. A pause that starts while one is in effect extends it rather
+// than counting anew.
+func (t *Throttle) Pause(d time.Duration) {
+	if t == nil {
+		return
+	}
+	if d <= 0 {
+		d = DefaultThrottlePause
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.clock().Now()
+	until := now.Add(d)
+	if !until.After(t.until) {
+		return
+	}
+	if t.until.After(now) {
+		t.paused += until.Sub(t.until)
+	} else {
+		t.pauses++
+		t.paused += d
+	}
+	t.until = until
+}
+
+// Wait returns once no pause is in effect, after a jittered delay when it
+// had to wait, or when ctx is done.
+func (t *Throttle) Wait(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	clock := t.clock()
+	for {
+		t.mu.Lock()
+		remaining := t.until.Sub(clock.Now())
+		jitter := t.Jitter
+		t.mu.Unlock()
+		if remaining <= 0 {
+			return nil
+		}
+		if jitter <= 0 {
+			jitter = DefaultThrottleJitter
+		}
+		if err := sleep(ctx, clock, remaining+time.Duration(rand.Int63n(int64(jitter)+1))); err != nil {
+			return err
+		}
+	}
+}
+
+func (t *Throttle) clock() Clock {
+	if t.Clock == nil {
+		return SystemClock
+	}
+	return t.Clock
+}
+
+// Stats returns the pauses so far.
+func (t *Throttle) Stats() ThrottleStats {
+	if t == nil {
+		return ThrottleStats{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return ThrottleStats{Pauses: t.pauses, PausedFor: t.paused}
+}
+
+// retryAfter reads when a throttled request may be retried: from
+// X-RateLimit-RetryAfter, which CrowdStrike sets to a Unix time, or from a
+// standard Retry-After in seconds or as an HTTP date. Both have a
+// resolution of seconds, so a parsed value is at least a second. It is 0
+// when neither parses. Absolute times are measured from now.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	if value := header.Get("X-RateLimit-RetryAfter"); value != "" {
+		if epoch, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return max(time.Unix(epoch, 0).Sub(now), time.Second)
+		}
+	}
+	value := header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, time.Second)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), time.Second)
+	}
+	return 0
+}
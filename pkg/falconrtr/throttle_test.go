@@ -0,0 +1,129 @@
+package falconrtr
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestThrottlePausesExtendAndCount(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	throttle := &Throttle{Clock: clock}
+
+	throttle.Pause(10 * time.Second)
+	clock.Advance(4 * time.Second)
+	throttle.Pause(10 * time.Second) // Extends the pause to 14s
+	throttle.Pause(time.Second)      // Within the pause; no change
+	if got, want := throttle.Stats(), (ThrottleStats{Pauses: 1, PausedFor: 14 * time.Second}); got != want {
+		t.Fatalf("after extending: %+v, want %+v", got, want)
+	}
+
+	clock.Advance(time.Minute)
+	throttle.Pause(0)
+	if got, want := throttle.Stats(), (ThrottleStats{Pauses: 2, PausedFor: 14*time.Second + DefaultThrottlePause}); got != want {
+		t.Fatalf("after a second pause: %+v, want %+v", got, want)
+	}
+}
+
+func TestThrottleWaitHoldsUntilPauseAndJitterPass(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	throttle := &Throttle{Clock: clock, Jitter: time.Second}
+	if err := throttle.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait without a pause: %v", err)
+	}
+
+	throttle.Pause(10 * time.Second)
+	done := make(chan error, 1)
+	go func() { done <- throttle.Wait(context.Background()) }()
+
+	awaitWaiters(t, clock, 1)
+	clock.Advance(10*time.Second - time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("Wait returned before the pause was over: %v", err)
+	default:
+	}
+	clock.Advance(time.Second + time.Millisecond) // The pause and the most jitter
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestThrottleWaitStopsWithContext(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	throttle := &Throttle{Clock: clock}
+	throttle.Pause(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- throttle.Wait(ctx) }()
+	awaitWaiters(t, clock, 1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Wait = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestNilThrottle(t *testing.T) {
+	var throttle *Throttle
+	throttle.Pause(time.Second)
+	if err := throttle.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stats := throttle.Stats(); stats != (ThrottleStats{}) {
+		t.Fatalf("Stats = %+v", stats)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := epoch
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"unix time", http.Header{"X-Ratelimit-Retryafter": {"1704067230"}}, 30 * time.Second},
+		{"unix time passed", http.Header{"X-Ratelimit-Retryafter": {"1704067100"}}, time.Second},
+		{"seconds", http.Header{"Retry-After": {"7"}}, 7 * time.Second},
+		{"zero seconds", http.Header{"Retry-After": {"0"}}, time.Second},
+		{"http date", http.Header{"Retry-After": {"Mon, 01 Jan 2024 00:02:00 GMT"}}, 2 * time.Minute},
+		{"ratelimit header first", http.Header{"X-Ratelimit-Retryafter": {"1704067205"}, "Retry-After": {"60"}}, 5 * time.Second},
+		{"unparsable", http.Header{"Retry-After": {"soon"}}, 0},
+		{"none", http.Header{}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := retryAfter(test.header, now); got != test.want {
+				t.Errorf("retryAfter = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitSpacesRequests(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limit := &RateLimit{Rate: 2, Clock: clock} // One request every 500ms
+	if err := limit.Wait(context.Background()); err != nil {
+		t.Fatalf("first request waited: %v", err)
+	}
+
+	done := make(chan error, 2)
+	go func() { done <- limit.Wait(context.Background()) }()
+	awaitWaiters(t, clock, 1)
+	go func() { done <- limit.Wait(context.Background()) }()
+	awaitWaiters(t, clock, 2)
+
+	clock.Advance(500 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+		t.Fatal("third request went out 500ms after the first")
+	default:
+	}
+	clock.Advance(500 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,183 @@
+package falconrtr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/audit"
+)
+
+// ErrAuditMessageRequired is returned when an uninstall token is requested
+// without the audit message the reveal is logged with.
+var ErrAuditMessageRequired = errors.New("an audit message is required to reveal an uninstall token")
+
+// ErrUninstallTokensForbidden is returned when uninstall_token.forbid
+// refuses every uninstall token reveal.
+var ErrUninstallTokensForbidden = errors.New("revealing uninstall tokens is forbidden by uninstall_token.forbid")
+
+// uninstallTokenScope is the API scope revealing uninstall tokens needs.
+const uninstallTokenScope = "Sensor update policies: Write"
+
+// Secret is a value that must not reach logs, reports or output files, such
+// as an uninstall token. Printing or marshalling it yields "[REDACTED]";
+// Reveal returns the value itself.
+type Secret string
+
+// String returns "[REDACTED]".
+func (Secret) String() string { return "[REDACTED]" }
+
+// GoString returns "[REDACTED]", so %#v does not leak the value either.
+func (Secret) GoString() string { return "[REDACTED]" }
+
+// MarshalJSON encodes the secret as "[REDACTED]".
+func (Secret) MarshalJSON() ([]byte, error) { return []byte(`"[REDACTED]"`), nil }
+
+// Reveal returns the secret value.
+func (s Secret) Reveal() string { return string(s) }
+
+// GetUninstallToken reveals the sensor uninstall (maintenance) token of
+// deviceID. The reveal is recorded in the Falcon audit log with
+// auditMessage, which is mandatory. The token is added to the client's
+// Redactor, so it is concealed wherever it would be printed or recorded.
+func (c *CrowdStrikeRTRClient) GetUninstallToken(ctx context.Context, deviceID, auditMessage string) (Secret, error) {
+	if c.ForbidUninstall {
+		return "", ErrUninstallTokensForbidden
+	}
+	if strings.TrimSpace(auditMessage) == "" {
+		return "", ErrAuditMessageRequired
+	}
+	if deviceID == "" {
+		return "", fmt.Errorf("device ID not available, cannot reveal an uninstall token")
+	}
+	headers := c.getHeaders("application/json", true)
+	comment := c.auditComment(auditMessage)
+	payload := map[string]interface{}{"audit_message": comment, "device_id": deviceID}
+	response, err := c.makeAPICall(ctx, "POST", c.url(EndpointRevealUninstallToken, 0), headers, nil, payload, nil)
+	// The record says a token was revealed, never what it is.
+	c.record(audit.Record{Event: audit.EventUninstallTokenRevealed, DeviceID: deviceID, Comment: comment}, err)
+	if err != nil {
+		return "", fmt.Errorf("failed to reveal the uninstall token of device %s: %w", deviceID, err)
+	}
+	resources, _ := response["resources"].([]interface{})
+	for _, resource := range resources {
+		resourceMap, _ := resource.(map[string]interface{})
+		if token, _ := resourceMap["uninstall_token"].(string); token != "" {
+			if c.Redactor != nil {
+				c.Redactor.AddSecret("uninstall_token", token)
+			}
+			return Secret(token), nil
+		}
+	}
+	return "", fmt.Errorf("no uninstall token returned for device %s", deviceID)
+}
+
+// probeUninstallTokens reports whether the credentials reach the sensor
+// update policies API. It only queries policies, so no token is revealed;
+// like probeSandbox, it cannot tell the write scope from its read half.
+func (c *CrowdStrikeRTRClient) probeUninstallTokens(ctx context.Context) (bool, error) {
+	headers := c.getHeaders("application/json", true)
+	return c.probeScope(ctx, c.url(EndpointSensorUpdateQuery, 0), headers, url.Values{"limit": {"1"}})
+}
+
+// ScriptContext is what a script_command_line template can use. Secrets
+// are only filled in for the command that is issued; everywhere else they
+// read as [REDACTED:<name>].
+type ScriptContext struct {
+	RunID    string
+	CaseID   string
+	DeviceID string
+	Hostname string
+	Secrets  ScriptSecrets
+}
+
+// ScriptSecrets are the secret fields of a ScriptContext.
+type ScriptSecrets struct {
+	UninstallToken string // Sensor uninstall token of the host, revealed with GetUninstallToken
+}
+
+// Markers a script_command_line is rendered with to find the fields it uses.
+const (
+	hostnameMarker       = "\x00hostname\x00"
+	uninstallTokenMarker = "\x00uninstall_token\x00"
+)
+
+// CommandLine is a parsed script_command_line template.
+type CommandLine struct {
+	Text string
+
+	tmpl           *template.Template
+	usesHostname   bool
+	uninstallToken bool
+}
+
+// ParseCommandLine parses a script_command_line template and checks that it
+// only uses the fields of ScriptContext.
+func ParseCommandLine(text string) (*CommandLine, error) {
+	tmpl, err := template.New("script_command_line").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("script_command_line: %w", err)
+	}
+	line := &CommandLine{Text: text, tmpl: tmpl}
+	sample, err := line.render(ScriptContext{
+		RunID: "run", CaseID: "case", DeviceID: "device", Hostname: hostnameMarker,
+		Secrets: ScriptSecrets{UninstallToken: uninstallTokenMarker},
+	})
+	if err != nil {
+		return nil, err
+	}
+	line.usesHostname = strings.Contains(sample, hostnameMarker)
+	line.uninstallToken = strings.Contains(sample, uninstallTokenMarker)
+	return line, nil
+}
+
+// NeedsUninstallToken reports whether the template uses
+// .Secrets.UninstallToken.
+func (l *CommandLine) NeedsUninstallToken() bool {
+	return l != nil && l.uninstallToken
+}
+
+// render executes the template against fields.
+func (l *CommandLine) render(fields ScriptContext) (string, error) {
+	var out bytes.Buffer
+	if err := l.tmpl.Execute(&out, fields); err != nil {
+		return "", fmt.Errorf("script_command_line: %w", err)
+	}
+	return out.String(), nil
+}
+
+// NeedsUninstallToken reports whether scripts run with an uninstall token
+// revealed for each host.
+func (c *CrowdStrikeRTRClient) NeedsUninstallToken() bool {
+	return c.CommandLine.NeedsUninstallToken()
+}
+
+// scriptCommandLine renders the client's CommandLine for the session's
+// host, revealing its uninstall token when the template uses it. It returns
+// "" when no CommandLine is configured.
+func (s *Session) scriptCommandLine(ctx context.Context) (string, error) {
+	line := s.client.CommandLine
+	if line == nil {
+		return "", nil
+	}
+	fields := ScriptContext{RunID: s.client.RunID, CaseID: s.client.CaseID, DeviceID: s.DeviceID}
+	if line.usesHostname {
+		host, err := s.client.host(ctx, s.DeviceID)
+		if err != nil {
+			return "", fmt.Errorf("script_command_line needs the hostname: %w", err)
+		}
+		fields.Hostname = host.Hostname
+	}
+	if line.uninstallToken {
+		token, err := s.client.GetUninstallToken(ctx, s.DeviceID, s.client.UninstallAudit)
+		if err != nil {
+			return "", err
+		}
+		fields.Secrets.UninstallToken = token.Reveal()
+	}
+	return line.render(fields)
+}
@@ -0,0 +1,432 @@
+// Package hooks lets programs that embed the collector run their own logic
+// at fixed points of a run without forking it: before the run, before and
+// after each host, and after the run. Hooks are registered from an init
+// function, as custom sink types are:
+//
+//	func init() {
+//		hooks.RegisterHostPre("cmdb", func(ctx context.Context, host *hooks.HostPre) error {
+//			owner, err := cmdb.Owner(ctx, host.DeviceID)
+//			if err != nil {
+//				return err
+//			}
+//			if owner == "" {
+//				host.Veto("not in the CMDB")
+//			}
+//			host.Labels["owner"] = owner
+//			return nil
+//		}, hooks.WithPolicy(hooks.PolicySkip), hooks.WithTimeout(10*time.Second))
+//	}
+//
+// Each hook gets a copy of the context object and only its allowed fields
+// are read back, and only when it returns nil in time. A hook that fails,
+// times out or panics is handled per its Policy, and every call is recorded
+// as a sink.HookOutcome in the report.
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/approval"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// Hook points, as recorded in sink.HookOutcome.Point.
+const (
+	PointPreRun   = "pre_run"
+	PointHostPre  = "host_pre"
+	PointHostPost = "host_post"
+	PointPostRun  = "post_run"
+)
+
+// Hook outcome statuses, as recorded in sink.HookOutcome.Status.
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusTimeout = "timeout"
+	StatusPanic   = "panic"
+	StatusVetoed  = "vetoed"
+)
+
+// Policy says what a hook's failure, timeout or panic does to the run.
+type Policy string
+
+const (
+	// PolicyContinue records the failure as a hook_failed warning and goes
+	// on. It is the default.
+	PolicyContinue Policy = "continue"
+	// PolicySkip skips the host a host_pre hook ran for. Elsewhere, where
+	// there is no host left to skip, it acts as PolicyContinue.
+	PolicySkip Policy = "skip"
+	// PolicyAbort stops the run: before any host is touched for a pre_run
+	// hook, and with no further hosts started for a host_pre hook. A
+	// host_post or post_run hook fails the run once the results are out.
+	PolicyAbort Policy = "abort"
+)
+
+// DefaultTimeout bounds a hook call unless WithTimeout says otherwise.
+const DefaultTimeout = 30 * time.Second
+
+var (
+	// ErrSkip is wrapped by the error of RunHostPre when the host is to be
+	// skipped, for a veto or a failed hook with PolicySkip.
+	ErrSkip = errors.New("skipped by hook")
+	// ErrAbort is wrapped by the error of a Run function when a hook with
+	// PolicyAbort failed.
+	ErrAbort = errors.New("aborted by hook")
+)
+
+// PreRun is what a pre_run hook sees: the run's plan after target
+// selection, before change-control approval. Hooks may change DeviceIDs,
+// e.g. to add hosts from a CMDB or drop excluded ones, and add Labels,
+// which every host's result carries. Changes to the other fields are
+// discarded.
+type PreRun struct {
+	RunID     string
+	DeviceIDs []string
+	Targets   []sink.TargetMapping
+	Commands  []approval.Command // Commands the run will issue on every host
+	Metadata  sink.Metadata
+	Labels    map[string]string
+}
+
+// HostPre is what a host_pre hook sees before a host is collected. Hooks
+// may add Labels to the host's result, or Veto the host.
+type HostPre struct {
+	RunID    string
+	DeviceID string
+	Target   *sink.TargetMapping // Identifier the device was resolved from, if any
+	Labels   map[string]string
+
+	veto string
+}
+
+// Veto skips the host for reason. The host's result has status
+// skipped_by_hook.
+func (h *HostPre) Veto(reason string) {
+	if reason == "" {
+		reason = "no reason given"
+	}
+	h.veto = reason
+}
+
+// HostPost is what a host_post hook sees once a host's result is final,
+// before it is delivered to the sinks. Result is a copy for reading; hooks
+// may add Labels to it.
+type HostPost struct {
+	RunID  string
+	Result sink.Result
+	Labels map[string]string
+}
+
+// PostRun is what a post_run hook sees once every result is delivered.
+// Nothing it changes is read back.
+type PostRun struct {
+	RunID        string
+	Status       string // succeeded, failed or cancelled
+	Error        string
+	HostsTotal   int
+	HostsFailed  int
+	HostsSkipped int
+	Results      []sink.Result
+}
+
+// Option configures a hook at registration.
+type Option func(*hook)
+
+// WithPolicy sets what the hook's failure does to the run.
+func WithPolicy(policy Policy) Option {
+	return func(h *hook) {
+		h.policy = policy
+	}
+}
+
+// WithTimeout bounds each call of the hook. The context the hook gets is
+// cancelled at the deadline; a hook still running then is abandoned and
+// whatever it changes afterwards is ignored.
+func WithTimeout(timeout time.Duration) Option {
+	return func(h *hook) {
+		h.timeout = timeout
+	}
+}
+
+// WithOrder places the hook among those of its point: lower orders run
+// first, and hooks of the same order run in registration order. The
+// default is 0.
+func WithOrder(order int) Option {
+	return func(h *hook) {
+		h.order = order
+	}
+}
+
+type hook struct {
+	name    string
+	policy  Policy
+	timeout time.Duration
+	order   int
+	seq     int
+	call    func(ctx context.Context, value interface{}) error
+}
+
+var (
+	registryMu      sync.RWMutex
+	registered      = map[string][]*hook{}
+	registeredCount int
+)
+
+// RegisterPreRun adds a hook run once before the run's hosts are approved
+// and collected.
+func RegisterPreRun(name string, fn func(ctx context.Context, run *PreRun) error, options ...Option) {
+	register(PointPreRun, name, func(ctx context.Context, value interface{}) error {
+		return fn(ctx, value.(*PreRun))
+	}, options)
+}
+
+// RegisterHostPre adds a hook run before each host is collected. Hosts
+// collected side by side run their hooks concurrently.
+func RegisterHostPre(name string, fn func(ctx context.Context, host *HostPre) error, options ...Option) {
+	register(PointHostPre, name, func(ctx context.Context, value interface{}) error {
+		return fn(ctx, value.(*HostPre))
+	}, options)
+}
+
+// RegisterHostPost adds a hook run with each host's final result, e.g. to
+// open a ticket for a failed host.
+func RegisterHostPost(name string, fn func(ctx context.Context, host *HostPost) error, options ...Option) {
+	register(PointHostPost, name, func(ctx context.Context, value interface{}) error {
+		return fn(ctx, value.(*HostPost))
+	}, options)
+}
+
+// RegisterPostRun adds a hook run once after every result is delivered.
+func RegisterPostRun(name string, fn func(ctx context.Context, run *PostRun) error, options ...Option) {
+	register(PointPostRun, name, func(ctx context.Context, value interface{}) error {
+		return fn(ctx, value.(*PostRun))
+	}, options)
+}
+
+func register(point, name string, call func(ctx context.Context, value interface{}) error, options []Option) {
+	h := &hook{name: name, policy: PolicyContinue, timeout: DefaultTimeout, call: call}
+	for _, option := range options {
+		option(h)
+	}
+	switch h.policy {
+	case PolicyContinue, PolicySkip, PolicyAbort:
+	default:
+		panic(fmt.Sprintf("hooks: %s hook %q has unknown policy %q", point, name, h.policy))
+	}
+	if h.timeout <= 0 {
+		h.timeout = DefaultTimeout
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registeredCount++
+	h.seq = registeredCount
+	hooks := append(registered[point], h)
+	sort.SliceStable(hooks, func(i, j int) bool {
+		if hooks[i].order != hooks[j].order {
+			return hooks[i].order < hooks[j].order
+		}
+		return hooks[i].seq < hooks[j].seq
+	})
+	registered[point] = hooks
+}
+
+// Registered lists the registered hooks as point/name, in the order they run.
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var names []string
+	for _, point := range []string{PointPreRun, PointHostPre, PointHostPost, PointPostRun} {
+		for _, h := range registered[point] {
+			names = append(names, point+"/"+h.name)
+		}
+	}
+	return names
+}
+
+func hooksAt(point string) []*hook {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]*hook(nil), registered[point]...)
+}
+
+// RunPreRun runs the pre_run hooks on run. The error wraps ErrAbort when a
+// hook with PolicyAbort failed; hooks after it are not run. DeviceIDs are
+// lowercased, trimmed and deduplicated after each hook.
+func RunPreRun(ctx context.Context, run *PreRun, warnings *sink.Warnings) ([]sink.HookOutcome, error) {
+	if run.Labels == nil {
+		run.Labels = map[string]string{}
+	}
+	return invokeAll(ctx, PointPreRun, "", warnings, func() interface{} {
+		working := *run
+		working.DeviceIDs = append([]string(nil), run.DeviceIDs...)
+		working.Targets = append([]sink.TargetMapping(nil), run.Targets...)
+		working.Commands = append([]approval.Command(nil), run.Commands...)
+		working.Labels = cloneLabels(run.Labels)
+		return &working
+	}, func(value interface{}) string {
+		working := value.(*PreRun)
+		run.DeviceIDs, run.Labels = normalizeDeviceIDs(working.DeviceIDs), working.Labels
+		return ""
+	})
+}
+
+// RunHostPre runs the host_pre hooks on host. The error wraps ErrSkip when
+// a hook vetoed the host or a hook with PolicySkip failed, and ErrAbort
+// when a hook with PolicyAbort failed; hooks after it are not run.
+func RunHostPre(ctx context.Context, host *HostPre, warnings *sink.Warnings) ([]sink.HookOutcome, error) {
+	if host.Labels == nil {
+		host.Labels = map[string]string{}
+	}
+	return invokeAll(ctx, PointHostPre, host.DeviceID, warnings, func() interface{} {
+		working := *host
+		if host.Target != nil {
+			target := *host.Target
+			working.Target = &target
+		}
+		working.Labels = cloneLabels(host.Labels)
+		return &working
+	}, func(value interface{}) string {
+		working := value.(*HostPre)
+		host.Labels = working.Labels
+		return working.veto
+	})
+}
+
+// RunHostPost runs the host_post hooks on host. The error wraps ErrAbort
+// when a hook with PolicyAbort failed; hooks after it are not run.
+func RunHostPost(ctx context.Context, host *HostPost, warnings *sink.Warnings) ([]sink.HookOutcome, error) {
+	if host.Labels == nil {
+		host.Labels = map[string]string{}
+	}
+	return invokeAll(ctx, PointHostPost, host.Result.DeviceID, warnings, func() interface{} {
+		working := *host
+		working.Labels = cloneLabels(host.Labels)
+		return &working
+	}, func(value interface{}) string {
+		host.Labels = value.(*HostPost).Labels
+		return ""
+	})
+}
+
+// RunPostRun runs the post_run hooks on run. The error wraps ErrAbort when
+// a hook with PolicyAbort failed; hooks after it are not run.
+func RunPostRun(ctx context.Context, run *PostRun, warnings *sink.Warnings) ([]sink.HookOutcome, error) {
+	return invokeAll(ctx, PointPostRun, "", warnings, func() interface{} {
+		working := *run
+		working.Results = append([]sink.Result(nil), run.Results...)
+		return &working
+	}, func(interface{}) string {
+		return ""
+	})
+}
+
+// invokeAll calls the hooks of point in order, each on a fresh copy made
+// by working. keep reads a successful hook's changes back and returns its
+// veto, if any.
+func invokeAll(ctx context.Context, point, deviceID string, warnings *sink.Warnings, working func() interface{}, keep func(value interface{}) string) ([]sink.HookOutcome, error) {
+	var outcomes []sink.HookOutcome
+	for _, h := range hooksAt(point) {
+		value := working()
+		outcome, err := h.invoke(ctx, point, value)
+		if err == nil {
+			if veto := keep(value); veto != "" {
+				outcome.Status, outcome.Error = StatusVetoed, veto
+				outcomes = append(outcomes, outcome)
+				return outcomes, fmt.Errorf("%w %s: %s", ErrSkip, h.name, veto)
+			}
+			outcomes = append(outcomes, outcome)
+			continue
+		}
+		outcomes = append(outcomes, outcome)
+		if ctx.Err() != nil {
+			return outcomes, ctx.Err()
+		}
+		switch {
+		case h.policy == PolicyAbort:
+			return outcomes, fmt.Errorf("%w: %s hook %s: %v", ErrAbort, point, h.name, err)
+		case h.policy == PolicySkip && point == PointHostPre:
+			return outcomes, fmt.Errorf("%w %s: %v", ErrSkip, h.name, err)
+		}
+		warnings.Add(sink.WarningHookFailed, deviceID, "%s hook %s: %v", point, h.name, err)
+	}
+	return outcomes, nil
+}
+
+// invoke calls the hook on value, bounded by its timeout, and turns a panic
+// into an error. A hook that outlives its timeout keeps running on its own
+// goroutine; its copy of value is not read again.
+func (h *hook) invoke(ctx context.Context, point string, value interface{}) (sink.HookOutcome, error) {
+	outcome := sink.HookOutcome{Hook: h.name, Point: point, Status: StatusOK}
+	started := time.Now()
+
+	callCtx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				panicked <- recovered
+			}
+		}()
+		done <- h.call(callCtx, value)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+		if err != nil {
+			outcome.Status = StatusFailed
+		}
+	case recovered := <-panicked:
+		err = fmt.Errorf("panic: %v", recovered)
+		outcome.Status = StatusPanic
+	case <-callCtx.Done():
+		err = fmt.Errorf("no answer within %s", h.timeout)
+		outcome.Status = StatusTimeout
+	}
+	if err != nil && outcome.Status != StatusPanic && ctx.Err() != nil {
+		// The run was interrupted under the hook. Whether the hook answered
+		// before invoke saw the interruption is a race, so it is reported
+		// the same either way: cut short.
+		err, outcome.Status = ctx.Err(), StatusTimeout
+	}
+	if err != nil {
+		outcome.Error = err.Error()
+	}
+	outcome.DurationMS = time.Since(started).Milliseconds()
+	return outcome, err
+}
+
+func cloneLabels(labels map[string]string) map[string]string {
+	clone := make(map[string]string, len(labels))
+	for key, value := range labels {
+		clone[key] = value
+	}
+	return clone
+}
+
+// normalizeDeviceIDs lowercases and trims device IDs, as the API reports
+// them, and drops empty and repeated ones.
+func normalizeDeviceIDs(deviceIDs []string) []string {
+	seen := map[string]bool{}
+	normalized := make([]string, 0, len(deviceIDs))
+	for _, id := range deviceIDs {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		normalized = append(normalized, id)
+	}
+	return normalized
+}
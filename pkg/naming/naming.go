@@ -0,0 +1,200 @@
+// Package naming builds the names of the files a run writes from
+// text/template templates, so artifacts can follow an evidence store's
+// naming convention, e.g. {{.CaseID}}_{{.Hostname}}_{{.Timestamp}}_{{.Name}}{{.Ext}}.
+package naming
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Default templates. They reproduce the names the collector used before
+// names were templated.
+const (
+	// DefaultArtifact names retrieved files: <run>-<sha256>/<file name>.
+	DefaultArtifact = `{{with .RunID}}{{.}}-{{end}}{{.SHA256}}/{{.Name}}{{.Ext}}`
+	// DefaultOutput names retained raw and original command output files.
+	DefaultOutput = `{{.Name}}-{{with .RunID}}{{.}}-{{end}}{{.CloudRequestID}}{{.Ext}}`
+	// DefaultReport names the status report attached to the email summary.
+	DefaultReport = `{{.Name}}{{.Ext}}`
+)
+
+// TimestampFormat is the UTC layout of the Timestamp field.
+const TimestampFormat = "20060102T150405Z"
+
+// Fields are the values a template can use. Name is the artifact's own name
+// without its extension, e.g. the retrieved file's base name or
+// "raw-output"; Ext includes the leading dot. Values are sanitized before
+// they are substituted.
+type Fields struct {
+	RunID          string
+	CaseID         string
+	Hostname       string
+	DeviceID       string
+	Platform       string
+	Command        string // Base command that produced the artifact, e.g. "get"
+	Name           string
+	Ext            string
+	SHA256         string
+	CloudRequestID string
+	Time           time.Time
+}
+
+// Timestamp returns Time in UTC as TimestampFormat.
+func (f Fields) Timestamp() string {
+	return f.Time.UTC().Format(TimestampFormat)
+}
+
+// Sample returns Fields with every field set, for checking templates ahead
+// of a run.
+func Sample() Fields { return sample }
+
+// sample fills every field, so executing a template against it only fails
+// on fields that do not exist.
+var sample = Fields{
+	RunID: "run", CaseID: "case", Hostname: "host", DeviceID: "device", Platform: "platform",
+	Command: "command", Name: "name", Ext: ".ext", SHA256: "sha256", CloudRequestID: "request",
+	Time: time.Unix(0, 0),
+}
+
+// Template is a parsed file name template.
+type Template struct {
+	Text string
+	tmpl *template.Template
+}
+
+// Parse parses and checks a file name template: it must only use the fields
+// of Fields and produce a non-empty name when they are all set.
+func Parse(text string) (*Template, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, errors.New("template is empty")
+	}
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	t := &Template{Text: text, tmpl: tmpl}
+	if _, err := t.Resolve(sample); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Uses reports whether the template refers to the named field.
+func (t *Template) Uses(field string) bool {
+	return strings.Contains(t.Text, "."+field)
+}
+
+// Resolve renders the template for f into a relative, slash-separated path.
+// Field values cannot add path separators, and every path element has
+// path-unsafe characters replaced; "." and ".." elements are rejected.
+func (t *Template) Resolve(f Fields) (string, error) {
+	for _, value := range []*string{&f.RunID, &f.CaseID, &f.Hostname, &f.DeviceID, &f.Platform, &f.Command, &f.Name, &f.SHA256, &f.CloudRequestID} {
+		*value = strings.ReplaceAll(Sanitize(*value), "/", "_")
+	}
+	f.Ext = strings.ReplaceAll(Sanitize(f.Ext), "/", "_")
+
+	var out bytes.Buffer
+	if err := t.tmpl.Execute(&out, f); err != nil {
+		return "", fmt.Errorf("template %q: %w", t.Text, err)
+	}
+	var elements []string
+	for _, element := range strings.Split(strings.ReplaceAll(out.String(), `\`, "/"), "/") {
+		element = strings.TrimSpace(Sanitize(element))
+		switch element {
+		case "":
+			continue
+		case ".", "..":
+			return "", fmt.Errorf("template %q: name %q may not contain %q", t.Text, out.String(), element)
+		}
+		elements = append(elements, element)
+	}
+	if len(elements) == 0 {
+		return "", fmt.Errorf("template %q produced an empty name", t.Text)
+	}
+	return strings.Join(elements, "/"), nil
+}
+
+// Sanitize replaces characters that are unsafe in file names on Windows or
+// POSIX systems, and control characters, with "_". Slashes are kept.
+func Sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Namer resolves file names under a directory and remembers them. Names
+// are made portable to Windows (see Portable). A name that is already
+// taken, on disk or earlier in the run, gets a numeric suffix before its
+// extension instead of overwriting the existing file.
+type Namer struct {
+	Template *Template
+
+	mu       sync.Mutex
+	resolved []string
+	renamed  map[string]string
+	taken    map[string]bool
+}
+
+// NewNamer returns a Namer for template.
+func NewNamer(template *Template) *Namer {
+	return &Namer{Template: template, renamed: map[string]string{}, taken: map[string]bool{}}
+}
+
+// Path resolves f under dir and reserves the resulting path.
+func (n *Namer) Path(dir string, f Fields) (string, error) {
+	name, err := n.Template.Resolve(f)
+	if err != nil {
+		return "", err
+	}
+	logical := filepath.Join(dir, filepath.FromSlash(name))
+	path := Portable(dir, name)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for i := 1; n.taken[path] || exists(path); i++ {
+		path = fmt.Sprintf("%s-%d%s", stem, i, ext)
+	}
+	n.taken[path] = true
+	n.resolved = append(n.resolved, path)
+	if path != logical {
+		n.renamed[logical] = path
+	}
+	return path, nil
+}
+
+// Resolved returns every path reserved so far, in order.
+func (n *Namer) Resolved() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.resolved...)
+}
+
+// Renamed maps the paths the template produced to the paths reserved for
+// them, for those made portable or given a suffix.
+func (n *Namer) Renamed() map[string]string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	renamed := make(map[string]string, len(n.renamed))
+	for logical, path := range n.renamed {
+		renamed[logical] = path
+	}
+	return renamed
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,114 @@
+package naming
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	for _, text := range []string{DefaultArtifact, DefaultOutput, DefaultReport, "{{.CaseID}}_{{.Hostname}}_{{.Timestamp}}_{{.Name}}{{.Ext}}"} {
+		if _, err := Parse(text); err != nil {
+			t.Errorf("Parse(%q) = %v", text, err)
+		}
+	}
+	for _, text := range []string{"", "  ", "{{.Owner}}", "{{.Name", "{{/* nothing */}}", ".."} {
+		if _, err := Parse(text); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", text)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	fields := Fields{
+		RunID: "run-1", CaseID: "IR/1042", Hostname: "WEB-01", Name: "Security", Ext: ".evtx",
+		SHA256: "abc123", CloudRequestID: "req", Time: time.Date(2024, 3, 4, 9, 12, 0, 0, time.FixedZone("CET", 3600)),
+	}
+	tests := []struct {
+		template string
+		fields   Fields
+		want     string
+	}{
+		{DefaultArtifact, fields, "run-1-abc123/Security.evtx"},
+		{DefaultArtifact, Fields{SHA256: "abc123", Name: "Security", Ext: ".evtx"}, "abc123/Security.evtx"},
+		{DefaultOutput, Fields{Name: "raw-output", RunID: "run-1", CloudRequestID: "req", Ext: ".json"}, "raw-output-run-1-req.json"},
+		// Field values cannot add path elements; the template can.
+		{"{{.CaseID}}/{{.Hostname}}_{{.Timestamp}}{{.Ext}}", fields, "IR_1042/WEB-01_20240304T081200Z.evtx"},
+		{`{{.Hostname}}\{{.Name}}`, fields, "WEB-01/Security"},
+		{"{{.Name}}:{{.Hostname}}?{{.Ext}}", fields, "Security_WEB-01_.evtx"},
+		{"//{{.Name}}// ", fields, "Security"},
+	}
+	for _, test := range tests {
+		tmpl, err := Parse(test.template)
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", test.template, err)
+		}
+		got, err := tmpl.Resolve(test.fields)
+		if err != nil || got != test.want {
+			t.Errorf("Resolve(%q) = %q, %v, want %q", test.template, got, err, test.want)
+		}
+	}
+
+	tmpl, err := Parse("{{.Name}}/{{.Hostname}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{".", ".."} {
+		if got, err := tmpl.Resolve(Fields{Name: name, Hostname: "host"}); err == nil {
+			t.Errorf("Resolve with name %q = %q, want an error", name, got)
+		}
+	}
+	if got, err := tmpl.Resolve(Fields{}); err == nil {
+		t.Errorf("Resolve to nothing = %q, want an error", got)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	if got, want := Sanitize("a\\b:c*d?e\"f<g>h|i\x00j\x7fk/l"), "a_b_c_d_e_f_g_h_i_j_k/l"; got != want {
+		t.Errorf("Sanitize = %q, want %q", got, want)
+	}
+}
+
+func TestTemplateUses(t *testing.T) {
+	tmpl, err := Parse(DefaultArtifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tmpl.Uses("SHA256") || !tmpl.Uses("RunID") || tmpl.Uses("Hostname") {
+		t.Errorf("Uses of %q got wrong", DefaultArtifact)
+	}
+}
+
+func TestNamerSuffixesTakenNames(t *testing.T) {
+	dir := t.TempDir()
+	tmpl, err := Parse("{{.Hostname}}{{.Ext}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "on-disk.log"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	namer := NewNamer(tmpl)
+	var paths []string
+	for _, hostname := range []string{"host", "host", "on-disk", "host"} {
+		path, err := namer.Path(dir, Fields{Hostname: hostname, Ext: ".log"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	want := []string{
+		filepath.Join(dir, "host.log"),
+		filepath.Join(dir, "host-1.log"),
+		filepath.Join(dir, "on-disk-1.log"),
+		filepath.Join(dir, "host-2.log"),
+	}
+	if !reflect.DeepEqual(paths, want) || !reflect.DeepEqual(namer.Resolved(), want) {
+		t.Errorf("paths %q, resolved %q, want %q", paths, namer.Resolved(), want)
+	}
+	if renamed := namer.Renamed(); renamed[filepath.Join(dir, "on-disk.log")] != filepath.Join(dir, "on-disk-1.log") {
+		t.Errorf("renamed %q, want on-disk.log mapped to on-disk-1.log", renamed)
+	}
+}
@@ -0,0 +1,101 @@
+package naming
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Windows limits on local paths. Names are kept within them on every
+// platform, so a run's files can be copied to, or written on, a Windows
+// workstation as they are.
+const (
+	// MaxPath is MAX_PATH less its terminating NUL.
+	MaxPath = 259
+	// MaxElement is the longest file or directory name NTFS accepts.
+	MaxElement = 255
+)
+
+// minShortened is the shortest a name is cut to when its directory leaves
+// less room under MaxPath; the path then stays too long, and only Windows
+// long path support can open it.
+const minShortened = 32
+
+// reservedNames are the Windows device names. They are reserved with any
+// extension too: CON.txt opens the console.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// PortableElement makes one file or directory name safe on Windows: the
+// trailing dots and spaces Windows would silently drop are trimmed, a
+// reserved device name gets "_" after its stem (con.txt becomes con_.txt),
+// and a name over MaxElement is shortened as Portable does. A name left
+// empty becomes "_".
+func PortableElement(element string) string {
+	element = strings.TrimRight(element, ". ")
+	if element == "" {
+		return "_"
+	}
+	stem, rest, _ := strings.Cut(element, ".")
+	if reservedNames[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		element = stem + "_"
+		if rest != "" {
+			element += "." + rest
+		}
+	}
+	return shorten(element, MaxElement)
+}
+
+// Portable joins the relative name, whose elements may be separated by
+// slashes or backslashes, to dir with every element of name made portable
+// by PortableElement. When the absolute result is longer than MaxPath, the
+// last element is shortened to fit: its tail is replaced by "~" and a hash
+// of the whole element, keeping the extension. dir is used as it is. The
+// same dir and name always give the same path, so a resumed run finds the
+// files of the run before it.
+func Portable(dir, name string) string {
+	var elements []string
+	for _, element := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		elements = append(elements, PortableElement(element))
+	}
+	if len(elements) == 0 {
+		return dir
+	}
+	path := filepath.Join(append([]string{dir}, elements...)...)
+
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		absolute = path
+	}
+	if over := len(absolute) - MaxPath; over > 0 {
+		last := elements[len(elements)-1]
+		elements[len(elements)-1] = shorten(last, max(len(last)-over, minShortened))
+		path = filepath.Join(append([]string{dir}, elements...)...)
+	}
+	return path
+}
+
+// shorten cuts element to at most limit bytes by replacing its tail with
+// "~" and the first 10 hex digits of its SHA256, keeping an extension of up
+// to 16 bytes.
+func shorten(element string, limit int) string {
+	if len(element) <= limit {
+		return element
+	}
+	ext := filepath.Ext(element)
+	if len(ext) > 16 || ext == element {
+		ext = ""
+	}
+	sum := sha256.Sum256([]byte(element))
+	suffix := "~" + hex.EncodeToString(sum[:5]) + ext
+	keep := max(limit-len(suffix), 1)
+	for keep > 0 && !utf8.RuneStart(element[keep]) {
+		keep--
+	}
+	return strings.TrimRight(element[:keep], ". ") + suffix
+}
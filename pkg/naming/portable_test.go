@@ -0,0 +1,75 @@
+package naming
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// TestPortableSeparators makes the same name portable with either
+// separator between its elements: reserved device names are escaped,
+// trailing dots and spaces trimmed, and an over-long last element shortened
+// to fit MaxPath, the same way each time.
+func TestPortableSeparators(t *testing.T) {
+	dir := t.TempDir()
+	long := strings.Repeat("x", 300) + ".json"
+	tests := []struct {
+		name      string
+		separator string
+	}{
+		{"slash", "/"},
+		{"backslash", `\`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := strings.Join([]string{"CON", "host. ", "aux.log", long}, test.separator)
+			got := Portable(dir, name)
+			if again := Portable(dir, name); again != got {
+				t.Errorf("Portable is not deterministic: %s, then %s", got, again)
+			}
+			rel, err := filepath.Rel(dir, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			elements := strings.Split(rel, string(filepath.Separator))
+			if len(elements) != 4 || elements[0] != "CON_" || elements[1] != "host" || elements[2] != "aux_.log" {
+				t.Fatalf("Portable(%q) = %s, want CON_, host and aux_.log before the file", name, rel)
+			}
+			abs, err := filepath.Abs(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if last := elements[3]; len(abs) > MaxPath || !strings.HasSuffix(last, ".json") || !strings.Contains(last, "~") || len(last) > MaxElement {
+				t.Errorf("last element %q (path of %d bytes), want it shortened with a hash to fit %d bytes", last, len(abs), MaxPath)
+			}
+		})
+	}
+}
+
+func TestPortableElement(t *testing.T) {
+	tests := []struct {
+		element string
+		want    string
+	}{
+		{"report.json", "report.json"},
+		{"con", "con_"},
+		{"com1.txt", "com1_.txt"},
+		{"LPT9.tar.gz", "LPT9_.tar.gz"},
+		{"CON .txt", "CON _.txt"},
+		{"console.txt", "console.txt"},
+		{"host. . ", "host"},
+		{"...", "_"},
+		{"", "_"},
+	}
+	for _, test := range tests {
+		if got := PortableElement(test.element); got != test.want {
+			t.Errorf("PortableElement(%q) = %q, want %q", test.element, got, test.want)
+		}
+	}
+	long := strings.Repeat("é", 200) + ".csv"
+	got := PortableElement(long)
+	if len(got) > MaxElement || !utf8.ValidString(got) || !strings.HasSuffix(got, ".csv") || got != PortableElement(long) {
+		t.Errorf("PortableElement of a %d-byte name = %q (%d bytes), want a stable name within %d bytes", len(long), got, len(got), MaxElement)
+	}
+}
@@ -0,0 +1,343 @@
+// Package notify sends run-completion email summaries over SMTP.
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/config"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+const (
+	defaultSubjectTemplate = "[crowdstrike-data-collector] Run {{.RunID}} {{.Status}} ({{.FailureCount}} failed)"
+	defaultAttachMaxBytes  = 5 * 1024 * 1024
+)
+
+// Summary describes the outcome of a collection run for notification purposes.
+type Summary struct {
+	RunID          string
+	Status         string // "succeeded" or "failed"
+	FailureCount   int
+	CID            string
+	DeviceID       string
+	SessionID      string
+	CloudRequestID string
+	Error          string
+	Hint           string // How to fix the classified failure, unless --no-hints
+
+	// Stages times each step of the run; the percentiles are over the
+	// per-host durations.
+	Stages          []sink.Stage
+	HostDurationP50 time.Duration
+	HostDurationP95 time.Duration
+
+	// APICalls counts the run's API calls by category.
+	APICalls map[string]int
+
+	// ApprovalReference is the change-control reference the run was approved under.
+	ApprovalReference string
+
+	// Metadata attributes the run to a case and an operator.
+	Metadata *sink.Metadata
+
+	// Capabilities names the API scopes the run could use; Disabled lists
+	// the features turned off for lack of one, with the reason.
+	Capabilities []string
+	Disabled     []string
+
+	// Warnings lists the run's warnings, run-level and per host.
+	Warnings []sink.Warning
+
+	// ReceiptsPlaced and ReceiptsFailed count the on-host receipts.
+	ReceiptsPlaced int
+	ReceiptsFailed int
+
+	// CircuitOpen lists the devices the circuit breaker stopped attempting,
+	// with the failures that opened their circuit.
+	CircuitOpen []string
+
+	// Sinks is the delivery status of each sink after it was drained.
+	Sinks []sink.DeliveryStatus
+
+	ReportName string // File name used for the attachment, e.g. "status.json"
+	Report     []byte // Report contents; attached when under the size threshold
+	ReportPath string // Where the report is stored when it is too large to attach
+}
+
+// Failed reports whether the run ended in failure.
+func (s *Summary) Failed() bool {
+	return s.Status != "succeeded"
+}
+
+// SMTPNotifier sends run-completion emails over SMTP.
+type SMTPNotifier struct {
+	Host               string
+	Port               int
+	TLSMode            string // "starttls" or "implicit"
+	InsecureSkipVerify bool
+	Username           string
+	Password           string
+	From               string
+	SuccessRecipients  []string
+	FailureRecipients  []string
+	SubjectTemplate    *template.Template
+	AttachMaxBytes     int
+}
+
+// NewSMTPNotifier builds an SMTPNotifier from the smtp configuration section.
+// It returns nil without an error when no SMTP host is configured.
+func NewSMTPNotifier(cfg config.SMTP) (*SMTPNotifier, error) {
+	if cfg.Host == "" {
+		return nil, nil
+	}
+
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+		if cfg.TLSMode == "implicit" {
+			port = 465
+		}
+	}
+
+	attachMaxBytes := cfg.AttachMaxBytes
+	if attachMaxBytes == 0 {
+		attachMaxBytes = defaultAttachMaxBytes
+	}
+
+	subject := cfg.SubjectTemplate
+	if subject == "" {
+		subject = defaultSubjectTemplate
+	}
+	subjectTemplate, err := template.New("subject").Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp.subject_template: %w", err)
+	}
+
+	n := &SMTPNotifier{
+		Host:               cfg.Host,
+		Port:               port,
+		TLSMode:            cfg.TLSMode,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		Username:           cfg.Username,
+		Password:           cfg.Password,
+		From:               cfg.From,
+		SuccessRecipients:  cfg.SuccessRecipients,
+		FailureRecipients:  cfg.FailureRecipients,
+		SubjectTemplate:    subjectTemplate,
+		AttachMaxBytes:     attachMaxBytes,
+	}
+	return n, nil
+}
+
+// Notify sends the run summary to the recipient list matching its outcome.
+func (n *SMTPNotifier) Notify(summary *Summary) error {
+	recipients := n.SuccessRecipients
+	if summary.Failed() {
+		recipients = n.FailureRecipients
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	message, err := n.buildMessage(summary, recipients)
+	if err != nil {
+		return err
+	}
+	return n.send(recipients, message)
+}
+
+// buildMessage renders a multipart MIME message with the summary as the body
+// and the report attached when it fits under AttachMaxBytes.
+func (n *SMTPNotifier) buildMessage(summary *Summary, recipients []string) ([]byte, error) {
+	var subject bytes.Buffer
+	if err := n.SubjectTemplate.Execute(&subject, summary); err != nil {
+		return nil, fmt.Errorf("failed to render email subject: %w", err)
+	}
+
+	var body strings.Builder
+	if summary.RunID != "" {
+		fmt.Fprintf(&body, "Run ID: %s\r\n", summary.RunID)
+	}
+	fmt.Fprintf(&body, "Status: %s\r\n", summary.Status)
+	fmt.Fprintf(&body, "Failures: %d\r\n", summary.FailureCount)
+	if summary.CID != "" {
+		fmt.Fprintf(&body, "CID: %s\r\n", summary.CID)
+	}
+	fmt.Fprintf(&body, "Device ID: %s\r\n", summary.DeviceID)
+	if summary.SessionID != "" {
+		fmt.Fprintf(&body, "Session ID: %s\r\n", summary.SessionID)
+	}
+	if summary.CloudRequestID != "" {
+		fmt.Fprintf(&body, "Cloud Request ID: %s\r\n", summary.CloudRequestID)
+	}
+	if summary.Error != "" {
+		fmt.Fprintf(&body, "Error: %s\r\n", summary.Error)
+	}
+	if summary.Hint != "" {
+		fmt.Fprintf(&body, "Hint: %s\r\n", summary.Hint)
+	}
+	if summary.ApprovalReference != "" {
+		fmt.Fprintf(&body, "Approval: %s\r\n", summary.ApprovalReference)
+	}
+	if m := summary.Metadata; m != nil {
+		for _, field := range []struct{ label, value string }{
+			{"Case ID", m.CaseID}, {"Operator", m.Operator}, {"Reason", m.Reason}, {"Ticket", m.TicketURL},
+		} {
+			if field.value != "" {
+				fmt.Fprintf(&body, "%s: %s\r\n", field.label, field.value)
+			}
+		}
+	}
+	if len(summary.Capabilities) > 0 {
+		fmt.Fprintf(&body, "Capabilities: %s\r\n", strings.Join(summary.Capabilities, ", "))
+	}
+	for _, disabled := range summary.Disabled {
+		fmt.Fprintf(&body, "Disabled: %s\r\n", disabled)
+	}
+	if len(summary.Warnings) > 0 {
+		fmt.Fprintf(&body, "Warnings: %d (%s)\r\n", len(summary.Warnings), sink.FormatWarningCounts(sink.CountWarnings(summary.Warnings)))
+	}
+	if summary.ReceiptsPlaced+summary.ReceiptsFailed > 0 {
+		fmt.Fprintf(&body, "Receipts: %d placed, %d failed\r\n", summary.ReceiptsPlaced, summary.ReceiptsFailed)
+	}
+	for _, circuit := range summary.CircuitOpen {
+		fmt.Fprintf(&body, "Circuit open: %s\r\n", circuit)
+	}
+	for _, status := range summary.Sinks {
+		fmt.Fprintf(&body, "Sink %s: %s\r\n", status.Sink, sink.FormatDeliveryStatus(status))
+	}
+	if len(summary.APICalls) > 0 {
+		total := 0
+		categories := make([]string, 0, len(summary.APICalls))
+		for category, n := range summary.APICalls {
+			total += n
+			categories = append(categories, fmt.Sprintf("%s=%d", category, n))
+		}
+		sort.Strings(categories)
+		fmt.Fprintf(&body, "API calls: %d (%s)\r\n", total, strings.Join(categories, ", "))
+	}
+	if len(summary.Stages) > 0 {
+		fmt.Fprintf(&body, "Host duration: p50 %s, p95 %s\r\n", summary.HostDurationP50, summary.HostDurationP95)
+		fmt.Fprintf(&body, "\r\nStages:\r\n")
+		for _, stage := range summary.Stages {
+			fmt.Fprintf(&body, "  %-18s %s  %s\r\n", stage.Name, stage.StartedAt.Format(time.RFC3339), stage.Duration())
+		}
+	}
+
+	attach := len(summary.Report) > 0 && len(summary.Report) <= n.AttachMaxBytes
+	if len(summary.Report) > n.AttachMaxBytes {
+		if summary.ReportPath != "" {
+			fmt.Fprintf(&body, "\r\nReport (%d bytes) is too large to attach and is stored at: %s\r\n", len(summary.Report), summary.ReportPath)
+		} else {
+			fmt.Fprintf(&body, "\r\nReport (%d bytes) exceeds the %d byte attachment limit and was not attached.\r\n", len(summary.Report), n.AttachMaxBytes)
+		}
+	}
+
+	var message bytes.Buffer
+	writer := multipart.NewWriter(&message)
+	fmt.Fprintf(&message, "From: %s\r\n", n.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", strings.TrimSpace(subject.String()))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+	textPart, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create email body: %w", err)
+	}
+	textPart.Write([]byte(body.String()))
+
+	if attach {
+		name := summary.ReportName
+		if name == "" {
+			name = "report.json"
+		}
+		attachmentPart, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/octet-stream"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf(`attachment; filename="%s"`, name)},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create email attachment: %w", err)
+		}
+		encoded := base64.StdEncoding.EncodeToString(summary.Report)
+		for len(encoded) > 76 {
+			attachmentPart.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		attachmentPart.Write([]byte(encoded + "\r\n"))
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize email: %w", err)
+	}
+	return message.Bytes(), nil
+}
+
+// send delivers the message using implicit TLS or STARTTLS depending on TLSMode.
+func (n *SMTPNotifier) send(recipients []string, message []byte) error {
+	address := net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+	tlsConfig := &tls.Config{ServerName: n.Host, InsecureSkipVerify: n.InsecureSkipVerify}
+
+	var client *smtp.Client
+	if n.TLSMode == "implicit" {
+		conn, err := tls.Dial("tcp", address, tlsConfig)
+		if err != nil {
+			return fmt.Errorf("failed to connect to SMTP server: %w", err)
+		}
+		client, err = smtp.NewClient(conn, n.Host)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to start SMTP session: %w", err)
+		}
+	} else {
+		var err error
+		client, err = smtp.Dial(address)
+		if err != nil {
+			return fmt.Errorf("failed to connect to SMTP server: %w", err)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	defer client.Close()
+
+	if n.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	if err := client.Mail(n.From); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s failed: %w", recipient, err)
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := writer.Write(message); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return client.Quit()
+}
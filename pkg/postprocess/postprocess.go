@@ -0,0 +1,107 @@
+// Package postprocess runs local processors, such as hashing, strings
+// extraction and YARA scanning, over files retrieved from hosts. A Pipeline
+// runs them in the background with bounded concurrency, so retrieval never
+// waits for them, and collects what they find per host.
+package postprocess
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// DefaultConcurrency bounds a Pipeline created with concurrency 0.
+const DefaultConcurrency = 2
+
+// Meta describes the retrieved file a processor is given.
+type Meta struct {
+	DeviceID   string
+	RemotePath string
+	SHA256     string // As reported by the API and verified on extraction
+	Size       int64
+}
+
+// Processor examines one retrieved file. It returns what it found; an error
+// marks the file's findings incomplete, but the findings returned with it
+// are kept, and the other processors still run.
+type Processor interface {
+	Name() string
+	Process(ctx context.Context, artifactPath string, meta Meta) ([]sink.Finding, error)
+}
+
+// Pipeline runs its processors over every submitted file, at most
+// concurrency files at a time.
+type Pipeline struct {
+	processors []Processor
+	slots      chan struct{}
+	wg         sync.WaitGroup
+
+	mu       sync.Mutex
+	findings map[string][]sink.ArtifactFindings // By device ID
+}
+
+// New returns a pipeline that runs processors in order on each file, with
+// at most concurrency files processed at once (DefaultConcurrency if 0).
+func New(processors []Processor, concurrency int) *Pipeline {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	return &Pipeline{processors: processors, slots: make(chan struct{}, concurrency), findings: map[string][]sink.ArtifactFindings{}}
+}
+
+// Submit queues artifactPath for processing and returns at once. ctx bounds
+// the processing; a file still waiting for a slot when ctx is done is
+// recorded as incomplete without running.
+func (p *Pipeline) Submit(ctx context.Context, artifactPath string, meta Meta) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		result := sink.ArtifactFindings{Path: artifactPath, RemotePath: meta.RemotePath, SHA256: meta.SHA256}
+		select {
+		case p.slots <- struct{}{}:
+			p.process(ctx, artifactPath, meta, &result)
+			<-p.slots
+		case <-ctx.Done():
+			result.Incomplete = true
+			result.Errors = append(result.Errors, fmt.Sprintf("not processed: %v", ctx.Err()))
+		}
+		p.mu.Lock()
+		p.findings[meta.DeviceID] = append(p.findings[meta.DeviceID], result)
+		p.mu.Unlock()
+	}()
+}
+
+// process runs every processor on one file.
+func (p *Pipeline) process(ctx context.Context, artifactPath string, meta Meta, result *sink.ArtifactFindings) {
+	for _, processor := range p.processors {
+		if err := ctx.Err(); err != nil {
+			result.Incomplete = true
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", processor.Name(), err))
+			continue
+		}
+		findings, err := processor.Process(ctx, artifactPath, meta)
+		result.Findings = append(result.Findings, findings...)
+		if err != nil {
+			result.Incomplete = true
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", processor.Name(), err))
+		}
+	}
+}
+
+// Wait blocks until every submitted file has been processed.
+func (p *Pipeline) Wait() {
+	p.wg.Wait()
+}
+
+// Findings returns the findings of the files retrieved from deviceID and
+// processed so far, ordered by path.
+func (p *Pipeline) Findings(deviceID string) []sink.ArtifactFindings {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	findings := append([]sink.ArtifactFindings(nil), p.findings[deviceID]...)
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Path < findings[j].Path })
+	return findings
+}
@@ -0,0 +1,204 @@
+package postprocess
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/sink"
+)
+
+// DefaultStringsMinLength is the shortest run Strings extracts when
+// MinLength is 0.
+const DefaultStringsMinLength = 6
+
+// Hashes computes the MD5, SHA1 and SHA256 of a file and, when
+// SSDeepBinary names the ssdeep tool, its fuzzy hash.
+type Hashes struct {
+	SSDeepBinary string
+}
+
+// Name returns "hashes".
+func (Hashes) Name() string { return "hashes" }
+
+// Process hashes the file at artifactPath.
+func (h Hashes) Process(ctx context.Context, artifactPath string, meta Meta) ([]sink.Finding, error) {
+	file, err := os.Open(artifactPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	names := []string{"md5", "sha1", "sha256"}
+	hashes := []hash.Hash{md5.New(), sha1.New(), sha256.New()}
+	writers := make([]io.Writer, len(hashes))
+	for i, hash := range hashes {
+		writers[i] = hash
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), file); err != nil {
+		return nil, err
+	}
+	findings := make([]sink.Finding, 0, len(hashes)+1)
+	for i, hash := range hashes {
+		findings = append(findings, sink.Finding{Processor: h.Name(), Name: names[i], Value: hex.EncodeToString(hash.Sum(nil))})
+	}
+	if h.SSDeepBinary == "" {
+		return findings, nil
+	}
+	fuzzy, err := ssdeep(ctx, h.SSDeepBinary, artifactPath)
+	if err != nil {
+		return findings, fmt.Errorf("ssdeep: %w", err)
+	}
+	return append(findings, sink.Finding{Processor: h.Name(), Name: "ssdeep", Value: fuzzy}), nil
+}
+
+// ssdeep runs the ssdeep tool in bare mode on path and returns its hash,
+// blocksize:hash:hash.
+func ssdeep(ctx context.Context, binary, path string) (string, error) {
+	output, err := exec.CommandContext(ctx, binary, "-s", "-b", path).Output()
+	if err != nil {
+		return "", toolError(err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if line == "" || strings.HasPrefix(line, "ssdeep,") {
+			continue
+		}
+		if i := strings.LastIndexByte(line, ','); i > 0 {
+			return line[:i], nil
+		}
+	}
+	return "", fmt.Errorf("no hash in output %q", strings.TrimSpace(string(output)))
+}
+
+// Strings extracts the runs of at least MinLength printable ASCII
+// characters of a file into a sidecar file next to it, artifact.strings.txt,
+// like strings(1) does.
+type Strings struct {
+	MinLength int
+}
+
+// Name returns "strings".
+func (Strings) Name() string { return "strings" }
+
+// Process writes the strings of the file at artifactPath to its sidecar.
+func (s Strings) Process(ctx context.Context, artifactPath string, meta Meta) ([]sink.Finding, error) {
+	minLength := s.MinLength
+	if minLength <= 0 {
+		minLength = DefaultStringsMinLength
+	}
+	in, err := os.Open(artifactPath)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	sidecar := artifactPath + ".strings.txt"
+	out, err := os.OpenFile(sidecar, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	writer := bufio.NewWriter(out)
+	count, err := extractStrings(ctx, bufio.NewReader(in), writer, minLength)
+	if flushErr := writer.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []sink.Finding{{
+		Processor: s.Name(), Name: "strings_file", Value: sidecar,
+		Detail: fmt.Sprintf("%d strings of at least %d characters", count, minLength),
+	}}, nil
+}
+
+// extractStrings writes each run of at least minLength printable ASCII
+// bytes of r to w on its own line and returns how many it wrote.
+func extractStrings(ctx context.Context, r io.ByteReader, w io.Writer, minLength int) (int, error) {
+	var run bytes.Buffer
+	count := 0
+	flush := func() error {
+		if run.Len() >= minLength {
+			count++
+			run.WriteByte('\n')
+			if _, err := w.Write(run.Bytes()); err != nil {
+				return err
+			}
+		}
+		run.Reset()
+		return nil
+	}
+	for read := 0; ; read++ {
+		if read%(1<<20) == 0 && ctx.Err() != nil {
+			return count, ctx.Err()
+		}
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return count, flush()
+		}
+		if err != nil {
+			return count, err
+		}
+		if b == '\t' || (b >= 0x20 && b < 0x7f) {
+			run.WriteByte(b)
+			continue
+		}
+		if err := flush(); err != nil {
+			return count, err
+		}
+	}
+}
+
+// YARA scans a file with the yara tool (Binary, "yara" if empty) and the
+// rules in Rules, reporting each matching rule with its tags.
+type YARA struct {
+	Binary string
+	Rules  string
+}
+
+// Name returns "yara".
+func (YARA) Name() string { return "yara" }
+
+// Process scans the file at artifactPath with the rules.
+func (y YARA) Process(ctx context.Context, artifactPath string, meta Meta) ([]sink.Finding, error) {
+	binary := y.Binary
+	if binary == "" {
+		binary = "yara"
+	}
+	output, err := exec.CommandContext(ctx, binary, "--print-tags", "--no-warnings", y.Rules, artifactPath).Output()
+	if err != nil {
+		return nil, toolError(err)
+	}
+	var findings []sink.Finding
+	for _, line := range strings.Split(string(output), "\n") {
+		// Each match is "rule [tag,...] path".
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(line), artifactPath))
+		if len(fields) == 0 {
+			continue
+		}
+		finding := sink.Finding{Processor: y.Name(), Name: "yara_match", Value: fields[0]}
+		if len(fields) > 1 {
+			finding.Detail = strings.Trim(fields[1], "[]")
+		}
+		findings = append(findings, finding)
+	}
+	return findings, nil
+}
+
+// toolError adds the stderr of a failed external tool to its error.
+func toolError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
@@ -0,0 +1,263 @@
+// Package rundir gives every run its own directory, parent/<run-id>, and
+// keeps overlapping runs, such as cron runs that outlast their interval,
+// from writing into the same parent at once: a run holds an advisory lock
+// file in the parent for as long as it writes, and points parent/latest at
+// its directory once it completes.
+package rundir
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/console"
+)
+
+// What a run does when another run holds the parent's lock.
+const (
+	OnLockedWait  = "wait"  // Wait for the lock to be released
+	OnLockedNew   = "new"   // Run in its own directory without the lock
+	OnLockedAbort = "abort" // Give up at once with ErrLocked
+)
+
+// LockName and LatestName are the lock file and the pointer to the most
+// recent completed run in the parent.
+const (
+	LockName   = ".collector.lock"
+	LatestName = "latest"
+)
+
+// pollInterval is how often a waiting run checks the lock.
+const pollInterval = time.Second
+
+// ErrLocked matches the error of a run that could not take the lock.
+var ErrLocked = errors.New("output directory is locked by another run")
+
+// Options tune Acquire.
+type Options struct {
+	OnLocked string        // OnLockedWait (default), OnLockedNew or OnLockedAbort
+	Wait     time.Duration // Bound of OnLockedWait; 0 waits until the lock is free
+
+	Console *console.Console // Reports waiting for the lock and breaking a stale one; nil reports nothing
+}
+
+// Dir is the directory of one run.
+type Dir struct {
+	Path   string // parent/<run-id>
+	Parent string
+	RunID  string
+	Locked bool // Whether the run holds the parent's lock; only then does it move latest
+
+	holder  holder
+	console *console.Console
+}
+
+// holder is the content of a lock file. ProcessStart tells a live holder
+// from an unrelated process that was given its PID after it crashed; it is
+// empty where the platform does not expose process start times.
+type holder struct {
+	RunID        string    `json:"run_id"`
+	PID          int       `json:"pid"`
+	Hostname     string    `json:"hostname"`
+	ProcessStart string    `json:"process_start,omitempty"`
+	AcquiredAt   time.Time `json:"acquired_at"`
+}
+
+// Acquire takes the lock of parent for the run and creates its directory.
+// A lock left behind by a crashed run on this host is broken; one held by a
+// live run, or by a run on another host, is handled per opts.OnLocked. The
+// directory must not exist yet, so a reused run ID cannot mix two runs.
+func Acquire(ctx context.Context, parent, runID string, opts Options) (*Dir, error) {
+	if err := os.MkdirAll(parent, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	dir := &Dir{Path: filepath.Join(parent, runID), Parent: parent, RunID: runID, console: opts.Console}
+	hostname, _ := os.Hostname()
+	dir.holder = holder{RunID: runID, PID: os.Getpid(), Hostname: hostname, ProcessStart: processStart(os.Getpid())}
+
+	var deadline <-chan time.Time
+	if opts.Wait > 0 {
+		timer := time.NewTimer(opts.Wait)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	waiting := false
+	for {
+		current, err := dir.lock()
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			dir.Locked = true
+			break
+		}
+		held := fmt.Errorf("%w: %s is held by run %s (pid %d on %s since %s)", ErrLocked,
+			filepath.Join(parent, LockName), current.RunID, current.PID, current.Hostname, current.AcquiredAt.Format(time.RFC3339))
+		if opts.OnLocked == OnLockedAbort {
+			return nil, held
+		}
+		if opts.OnLocked == OnLockedNew {
+			break
+		}
+		if !waiting {
+			opts.Console.Printf("%v; waiting for it to be released...\n", held)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w; stopped waiting: %v", held, ctx.Err())
+		case <-deadline:
+			return nil, fmt.Errorf("%w; gave up after %s", held, opts.Wait)
+		case <-time.After(pollInterval):
+		}
+	}
+
+	if err := os.Mkdir(dir.Path, 0700); err != nil {
+		dir.Release()
+		return nil, fmt.Errorf("failed to create run directory: %w", err)
+	}
+	return dir, nil
+}
+
+// lock creates the lock file, breaking a stale one. It returns the holder of
+// a lock it could not take, or nil once the run holds it.
+func (d *Dir) lock() (*holder, error) {
+	path := filepath.Join(d.Parent, LockName)
+	d.holder.AcquiredAt = time.Now().UTC()
+	data, err := json.Marshal(d.holder)
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = file.Write(data)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock file: %w", err)
+			}
+			return nil, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+		current, err := readHolder(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // Released meanwhile
+		}
+		if err != nil {
+			// Unreadable, e.g. half written by a holder that is starting;
+			// treat it as held and look again later.
+			return &holder{RunID: "unknown"}, nil
+		}
+		if attempt > 0 || !current.stale(d.holder.Hostname) {
+			return current, nil
+		}
+		if err := breakLock(path, current); err != nil {
+			return nil, err
+		}
+		d.console.Printf("Broke the stale lock of run %s (pid %d is gone) in %s.\n", current.RunID, current.PID, d.Parent)
+	}
+}
+
+// stale reports whether the holder is a run on this host that no longer
+// runs. A lock from another host sharing the directory is never judged
+// stale, as its process cannot be looked at from here.
+func (h *holder) stale(hostname string) bool {
+	if h.Hostname != hostname || h.PID <= 0 {
+		return false
+	}
+	if !processAlive(h.PID) {
+		return true
+	}
+	start := processStart(h.PID)
+	return h.ProcessStart != "" && start != "" && start != h.ProcessStart
+}
+
+// breakLock removes the stale lock at path. The lock is first renamed away,
+// which only one of several runs breaking it at once can do, and removed
+// only if it is still the stale one; a fresh lock caught by the rename
+// instead is put back.
+func breakLock(path string, stale *holder) error {
+	moved := fmt.Sprintf("%s.broken-%d", path, os.Getpid())
+	if err := os.Rename(path, moved); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to break stale lock: %w", err)
+	}
+	current, err := readHolder(moved)
+	if err == nil && !current.same(stale) {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return os.Rename(moved, path)
+		}
+	}
+	return os.Remove(moved)
+}
+
+// same reports whether h and other describe the same lock.
+func (h *holder) same(other *holder) bool {
+	return h.RunID == other.RunID && h.PID == other.PID && h.Hostname == other.Hostname &&
+		h.ProcessStart == other.ProcessStart && h.AcquiredAt.Equal(other.AcquiredAt)
+}
+
+func readHolder(path string) (*holder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	current := &holder{}
+	if err := json.Unmarshal(data, current); err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// MarkLatest points parent/latest at the run's directory: a relative
+// symlink, or on Windows, where creating one needs privileges, a file
+// holding the run ID. A run without the lock leaves latest alone.
+func (d *Dir) MarkLatest() error {
+	if !d.Locked {
+		return nil
+	}
+	latest := filepath.Join(d.Parent, LatestName)
+	temporary := fmt.Sprintf("%s.%d", latest, os.Getpid())
+	os.Remove(temporary)
+	var err error
+	if runtime.GOOS == "windows" {
+		err = os.WriteFile(temporary, []byte(d.RunID+"\n"), 0600)
+	} else {
+		err = os.Symlink(d.RunID, temporary)
+	}
+	if err == nil {
+		// The rename replaces the previous pointer atomically.
+		err = os.Rename(temporary, latest)
+	}
+	if err != nil {
+		os.Remove(temporary)
+		return fmt.Errorf("failed to update %s: %w", latest, err)
+	}
+	return nil
+}
+
+// Release removes the lock file if the run holds it.
+func (d *Dir) Release() error {
+	if !d.Locked {
+		return nil
+	}
+	d.Locked = false
+	path := filepath.Join(d.Parent, LockName)
+	if current, err := readHolder(path); err != nil || !current.same(&d.holder) {
+		// Broken by another run meanwhile; not ours to remove.
+		return nil
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,183 @@
+package rundir
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// exitedPID returns the PID of a process that has run and exited: the test
+// binary, run with no tests.
+func exitedPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+// writeLock leaves a lock file held by current in parent.
+func writeLock(t *testing.T, parent string, current holder) {
+	t.Helper()
+	data, err := json.Marshal(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, LockName), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireAndRelease(t *testing.T) {
+	parent := filepath.Join(t.TempDir(), "output")
+	dir, err := Acquire(context.Background(), parent, "run-1", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dir.Locked || dir.Path != filepath.Join(parent, "run-1") {
+		t.Errorf("dir %+v, want run-1 locked", dir)
+	}
+	if info, err := os.Stat(dir.Path); err != nil || !info.IsDir() {
+		t.Errorf("run directory %s not created: %v", dir.Path, err)
+	}
+	current, err := readHolder(filepath.Join(parent, LockName))
+	if err != nil || current.RunID != "run-1" || current.PID != os.Getpid() {
+		t.Errorf("lock holder %+v (%v), want run-1 and this process", current, err)
+	}
+
+	if err := dir.MarkLatest(); err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" {
+		if target, err := os.Readlink(filepath.Join(parent, LatestName)); err != nil || target != "run-1" {
+			t.Errorf("latest points at %q (%v), want run-1", target, err)
+		}
+	}
+	if err := dir.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, LockName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file left after Release: %v", err)
+	}
+
+	// A reused run ID cannot write into the first run's directory.
+	if _, err := Acquire(context.Background(), parent, "run-1", Options{}); err == nil {
+		t.Error("Acquire succeeded for a run ID already used")
+	}
+	if _, err := os.Stat(filepath.Join(parent, LockName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file left after a failed Acquire: %v", err)
+	}
+}
+
+func TestAcquireBreaksStaleLock(t *testing.T) {
+	hostname, _ := os.Hostname()
+	tests := []struct {
+		name   string
+		holder func(t *testing.T) holder
+	}{
+		{"exited process", func(t *testing.T) holder {
+			return holder{RunID: "crashed", PID: exitedPID(t), Hostname: hostname}
+		}},
+		{"reused PID", func(t *testing.T) holder {
+			if processStart(os.Getpid()) == "" {
+				t.Skip("process start times are not available here")
+			}
+			return holder{RunID: "crashed", PID: os.Getpid(), Hostname: hostname, ProcessStart: "1"}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parent := t.TempDir()
+			writeLock(t, parent, test.holder(t))
+			dir, err := Acquire(context.Background(), parent, "run-2", Options{OnLocked: OnLockedAbort})
+			if err != nil {
+				t.Fatalf("Acquire = %v, want the stale lock broken", err)
+			}
+			defer dir.Release()
+			if !dir.Locked {
+				t.Error("run does not hold the lock")
+			}
+			if current, err := readHolder(filepath.Join(parent, LockName)); err != nil || current.RunID != "run-2" {
+				t.Errorf("lock holder %+v (%v), want run-2", current, err)
+			}
+			if matches, _ := filepath.Glob(filepath.Join(parent, LockName+".broken-*")); len(matches) != 0 {
+				t.Errorf("broken lock left behind: %q", matches)
+			}
+		})
+	}
+}
+
+func TestAcquireHeldLock(t *testing.T) {
+	hostname, _ := os.Hostname()
+	live := holder{RunID: "running", PID: os.Getpid(), Hostname: hostname, ProcessStart: processStart(os.Getpid()), AcquiredAt: time.Now().UTC()}
+	// A lock from another host is never judged stale, whatever its PID.
+	remote := holder{RunID: "remote", PID: exitedPID(t), Hostname: hostname + "-other", AcquiredAt: time.Now().UTC()}
+	for _, current := range []holder{live, remote} {
+		t.Run(current.RunID, func(t *testing.T) {
+			t.Run("abort", func(t *testing.T) {
+				parent := t.TempDir()
+				writeLock(t, parent, current)
+				if _, err := Acquire(context.Background(), parent, "run-3", Options{OnLocked: OnLockedAbort}); !errors.Is(err, ErrLocked) {
+					t.Errorf("Acquire = %v, want ErrLocked", err)
+				}
+			})
+			t.Run("new", func(t *testing.T) {
+				parent := t.TempDir()
+				writeLock(t, parent, current)
+				dir, err := Acquire(context.Background(), parent, "run-3", Options{OnLocked: OnLockedNew})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if dir.Locked {
+					t.Error("run took a lock held by another")
+				}
+				dir.MarkLatest()
+				dir.Release()
+				if _, err := os.Lstat(filepath.Join(parent, LatestName)); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("run without the lock moved latest: %v", err)
+				}
+				if held, err := readHolder(filepath.Join(parent, LockName)); err != nil || held.RunID != current.RunID {
+					t.Errorf("lock holder %+v (%v), want %s left alone", held, err, current.RunID)
+				}
+			})
+			t.Run("wait", func(t *testing.T) {
+				parent := t.TempDir()
+				writeLock(t, parent, current)
+				if _, err := Acquire(context.Background(), parent, "run-3", Options{Wait: 10 * time.Millisecond}); !errors.Is(err, ErrLocked) {
+					t.Errorf("Acquire = %v, want ErrLocked after the wait", err)
+				}
+			})
+		})
+	}
+}
+
+// TestBreakLockKeepsFreshLock breaks a lock that another run replaced with
+// its own meanwhile, and checks that the fresh lock is put back.
+func TestBreakLockKeepsFreshLock(t *testing.T) {
+	parent := t.TempDir()
+	path := filepath.Join(parent, LockName)
+	stale := holder{RunID: "crashed", PID: 1, Hostname: "host"}
+	fresh := holder{RunID: "fresh", PID: 2, Hostname: "host", AcquiredAt: time.Now().UTC()}
+	writeLock(t, parent, fresh)
+	if err := breakLock(path, &stale); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := readHolder(path); err != nil || !current.same(&fresh) {
+		t.Errorf("lock holder %+v (%v), want the fresh lock put back", current, err)
+	}
+
+	writeLock(t, parent, stale)
+	if err := breakLock(path, &stale); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stale lock not removed: %v", err)
+	}
+}
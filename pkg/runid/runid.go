@@ -0,0 +1,42 @@
+// Package runid generates and validates the correlation IDs of runs.
+package runid
+
+import (
+	"crypto/rand"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// validPattern limits externally supplied run IDs to characters that are
+// safe in file names, object keys, HTTP headers and RTR command strings.
+var validPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// New returns a UUIDv7: a random UUID whose leading 48 bits are the Unix
+// time in milliseconds, so run IDs sort by start time.
+func New() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+
+	ms := uint64(time.Now().UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	b[6] = (b[6] & 0x0f) | 0x70 // Version 7
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Validate checks an externally supplied run ID (e.g. a SOAR correlation key).
+func Validate(id string) error {
+	if !validPattern.MatchString(id) {
+		return fmt.Errorf("run ID %q must be 1-128 characters of letters, digits, '.', '_', ':' or '-'", id)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package simulate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// DefaultVerdict is the sandbox verdict of files Options.Verdicts does not
+// name.
+const DefaultVerdict = "no specific threat"
+
+// verdictScores are the threat scores reported with each verdict.
+var verdictScores = map[string]int{"malicious": 100, "suspicious": 60, DefaultVerdict: 5}
+
+// submission is a file submitted to the simulated sandbox. It stays running
+// for the first status request and succeeds with the next.
+type submission struct {
+	sha256        string
+	name          string
+	environmentID int
+	polls         int
+}
+
+// uploadSample stores an uploaded sample and answers with its SHA256. A
+// request without a sample is refused with 400.
+func (t *Transport) uploadSample(req *http.Request, data []byte) (*http.Response, error) {
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		return respond(req, http.StatusBadRequest, errorBody("sample is required"))
+	}
+	file, _, err := req.FormFile("sample")
+	if err != nil {
+		return respond(req, http.StatusBadRequest, errorBody("sample is required"))
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	name := req.FormValue("file_name")
+	t.mu.Lock()
+	t.samples[sum] = name
+	t.mu.Unlock()
+	return respond(req, http.StatusOK, resources(map[string]interface{}{"sha256": sum, "file_name": name}))
+}
+
+// sample answers a sample lookup by SHA256 with the sample's name, or with
+// 404 for samples never uploaded.
+func (t *Transport) sample(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, sum := range req.URL.Query()["ids"] {
+		if name, ok := t.samples[sum]; ok {
+			return respond(req, http.StatusOK, resources(map[string]interface{}{"sha256": sum, "file_name": name}))
+		}
+	}
+	return respond(req, http.StatusNotFound, errorBody("sample not found"))
+}
+
+// querySubmissions lists the IDs of the sandbox submissions, paged.
+func (t *Transport) querySubmissions(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	ids := make([]interface{}, 0, len(t.submissions))
+	for id := range t.submissions {
+		ids = append(ids, id)
+	}
+	t.mu.Unlock()
+	sort.Slice(ids, func(i, j int) bool { return ids[i].(string) < ids[j].(string) })
+	return respond(req, http.StatusOK, page(req, ids))
+}
+
+// sandboxSubmission submits an uploaded sample, or reports the state of
+// submissions by ID.
+func (t *Transport) sandboxSubmission(req *http.Request, body map[string]interface{}) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if req.Method != http.MethodPost {
+		var states []interface{}
+		for _, id := range req.URL.Query()["ids"] {
+			if sub, ok := t.submissions[id]; ok {
+				sub.polls++
+				state := "running"
+				if sub.polls > 1 {
+					state = "success"
+				}
+				states = append(states, map[string]interface{}{"id": id, "state": state, "sandbox": []interface{}{map[string]interface{}{"sha256": sub.sha256}}})
+			}
+		}
+		return respond(req, http.StatusOK, resources(states...))
+	}
+
+	entries, _ := body["sandbox"].([]interface{})
+	if len(entries) == 0 {
+		return respond(req, http.StatusBadRequest, errorBody("sandbox is required"))
+	}
+	entry, _ := entries[0].(map[string]interface{})
+	sum, _ := entry["sha256"].(string)
+	name, ok := t.samples[sum]
+	if !ok {
+		return respond(req, http.StatusBadRequest, errorBody(fmt.Sprintf("sample %s has not been uploaded", sum)))
+	}
+	if submitName, _ := entry["submit_name"].(string); submitName != "" {
+		name = submitName
+	}
+	environmentID, _ := entry["environment_id"].(float64)
+	id := t.id()
+	t.submissions[id] = &submission{sha256: sum, name: name, environmentID: int(environmentID)}
+	return respond(req, http.StatusOK, resources(map[string]interface{}{"id": id, "state": "created"}))
+}
+
+// sandboxReportSummaries reports the verdict of completed submissions.
+func (t *Transport) sandboxReportSummaries(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var summaries []interface{}
+	for _, id := range req.URL.Query()["ids"] {
+		sub, ok := t.submissions[id]
+		if !ok || sub.polls < 2 {
+			continue
+		}
+		verdict := t.opts.Verdicts[sub.name]
+		if verdict == "" {
+			verdict = DefaultVerdict
+		}
+		summaries = append(summaries, map[string]interface{}{
+			"id":      id,
+			"verdict": verdict,
+			"sandbox": []interface{}{map[string]interface{}{
+				"sha256":         sub.sha256,
+				"environment_id": sub.environmentID,
+				"verdict":        verdict,
+				"threat_score":   verdictScores[verdict],
+			}},
+		})
+	}
+	return respond(req, http.StatusOK, resources(summaries...))
+}
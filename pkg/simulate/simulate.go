@@ -0,0 +1,814 @@
+// Package simulate fakes the CrowdStrike API for end-to-end runs without real
+// endpoints. Its Transport answers the requests the collector makes with
+// configurable devices, scripted command output, latency and failures.
+package simulate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SimulatedCID is the customer ID reported by the simulated tenant.
+const SimulatedCID = "51515151515151515151515151515151-51"
+
+// DefaultDevice is simulated when no devices are configured.
+var DefaultDevice = Device{ID: "sim-device-0001", Hostname: "SIM-WS-0001", Platform: "windows", SerialNumber: "SIM0001", MACAddress: "00-50-56-00-00-01"}
+
+// Device is one simulated host.
+type Device struct {
+	ID       string
+	Hostname string
+	Platform string
+	Offline  bool
+	BusyWith string // User holding a live RTR session on the device, if any
+	Stale    bool   // Still listed, but sessions answer 404, like the old ID of a reinstalled sensor
+
+	SerialNumber string
+	MACAddress   string // As the devices API reports it, e.g. 00-50-56-00-00-01
+}
+
+// Options configure the simulation. Outputs maps a cloud script name or base
+// command to its stdout; {{hostname}}, {{device_id}} and {{platform}} are
+// expanded. Each RTR request waits about Latency and fails with probability
+// FailureRate. Errors maps a script name or base command to an error message
+// its status resource reports, as RTR does when a command fails on the host.
+// Scopes are the API scopes granted to the client; requests needing another
+// are refused with 403, and an empty list grants every scope. Children are
+// the child CIDs of the simulated tenant, for MSSP runs: a token requested
+// with one of them as member_cid acts in that child. Ambiguous names
+// script names or base commands whose first post is accepted but answered
+// with a dropped connection, as when a request times out after reaching
+// the API. ThrottleRate is the probability that an RTR request is refused
+// with 429 and an X-RateLimit-RetryAfter one second out. Scripts maps the
+// names of the tenant's cloud scripts to their content. With LineInterval,
+// commands stream their stdout: each line appears that long after the
+// previous one, and the command completes with its last line. The same Seed
+// gives the same IDs, latencies and failures. Verdicts maps the names of
+// files submitted to the sandbox to their verdict, such as malicious.
+type Options struct {
+	Seed         int64
+	Devices      []Device
+	Outputs      map[string]string
+	Errors       map[string]string
+	Scopes       []string
+	Children     []string
+	Ambiguous    []string
+	Latency      time.Duration
+	FailureRate  float64
+	ThrottleRate float64
+	Scripts      map[string]string
+	LineInterval time.Duration
+	Verdicts     map[string]string
+}
+
+// Transport is an http.RoundTripper serving the simulated API.
+type Transport struct {
+	opts Options
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	sessions map[string]Device
+	commands map[string]command
+	putFiles map[string]string // put-file ID to name
+	scripts  map[string]script // Cloud script ID to script
+	dropped  map[string]bool   // Ambiguous commands whose response was already dropped
+
+	samples     map[string]string      // SHA256 of uploaded samples to their name
+	submissions map[string]*submission // Sandbox submission ID to submission
+}
+
+type script struct {
+	name           string
+	content        string
+	description    string
+	platform       string
+	permissionType string
+}
+
+type command struct {
+	device        Device
+	sessionID     string
+	baseCommand   string
+	commandString string
+	createdAt     time.Time
+}
+
+var cloudFilePattern = regexp.MustCompile(`-CloudFile="([^"]+)"`)
+
+// Scopes the simulated API client can be granted.
+const (
+	ScopeHostsRead = "hosts:read"
+	ScopeRTRRead   = "rtr:read"
+	ScopeRTRWrite  = "rtr:write"
+	ScopeRTRAdmin  = "rtr-admin:write"
+
+	ScopeSensorUpdatePolicies = "sensor-update-policies:write"
+	ScopeSandbox              = "falconx-sandbox:write"
+	ScopeSampleUploads        = "samples:write"
+)
+
+// ValidScope reports whether scope is one of the simulated scopes.
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeHostsRead, ScopeRTRRead, ScopeRTRWrite, ScopeRTRAdmin, ScopeSensorUpdatePolicies, ScopeSandbox, ScopeSampleUploads:
+		return true
+	}
+	return false
+}
+
+// requiredScope names the scope a request path needs, or "" when the
+// simulation does not restrict it.
+func requiredScope(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/devices/"):
+		return ScopeHostsRead
+	case strings.HasPrefix(path, "/policy/"):
+		return ScopeSensorUpdatePolicies
+	case strings.HasPrefix(path, "/falconx/"):
+		return ScopeSandbox
+	case strings.HasPrefix(path, "/samples/"):
+		return ScopeSampleUploads
+	case path == "/real-time-response/entities/active-responder-command/v1":
+		return ScopeRTRWrite
+	case path == "/real-time-response/entities/admin-command/v1", strings.HasPrefix(path, "/real-time-response/entities/put-files/"), strings.HasPrefix(path, "/real-time-response/entities/scripts/"):
+		return ScopeRTRAdmin
+	case strings.HasPrefix(path, "/real-time-response/"):
+		return ScopeRTRRead
+	}
+	return ""
+}
+
+// granted reports whether the client holds scope.
+func (t *Transport) granted(scope string) bool {
+	if scope == "" || len(t.opts.Scopes) == 0 {
+		return true
+	}
+	for _, held := range t.opts.Scopes {
+		if held == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// New returns a simulated API transport.
+func New(opts Options) *Transport {
+	if len(opts.Devices) == 0 {
+		opts.Devices = []Device{DefaultDevice}
+	}
+	t := &Transport{
+		opts:     opts,
+		rand:     rand.New(rand.NewSource(opts.Seed)),
+		sessions: make(map[string]Device),
+		commands: make(map[string]command),
+		putFiles: make(map[string]string),
+		scripts:  make(map[string]script),
+		dropped:  make(map[string]bool),
+
+		samples:     make(map[string]string),
+		submissions: make(map[string]*submission),
+	}
+	names := make([]string, 0, len(opts.Scripts))
+	for name := range opts.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.scripts[t.id()] = script{name: name, content: opts.Scripts[name], platform: "windows", permissionType: "private"}
+	}
+	return t
+}
+
+// RoundTrip answers one request from the simulated tenant.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body map[string]interface{}
+	var data []byte
+	if req.Body != nil {
+		var err error
+		data, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(data, &body)
+	}
+
+	path := req.URL.Path
+	if strings.HasPrefix(path, "/real-time-response") {
+		if err := t.delay(req); err != nil {
+			return nil, err
+		}
+		if t.chance(t.opts.ThrottleRate) {
+			resp, err := respond(req, http.StatusTooManyRequests, errorBody("API rate limit exceeded"))
+			resp.Header.Set("X-RateLimit-RetryAfter", strconv.FormatInt(time.Now().Add(time.Second).Unix(), 10))
+			return resp, err
+		}
+		if t.chance(t.opts.FailureRate) {
+			return respond(req, http.StatusInternalServerError, errorBody("simulated failure"))
+		}
+	}
+
+	if scope := requiredScope(path); !t.granted(scope) {
+		return respond(req, http.StatusForbidden, errorBody(fmt.Sprintf("access denied, authorization failed: requires %s", scope)))
+	}
+
+	switch {
+	case path == "/oauth2/token":
+		return t.token(req, data)
+	case path == "/sensors/queries/installers/ccid/v1":
+		cid := SimulatedCID
+		if member, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer simulated-token:"); ok {
+			cid = member
+		}
+		return respond(req, http.StatusOK, resources(cid))
+	case path == "/mssp/queries/children/v1":
+		ids := make([]interface{}, len(t.opts.Children))
+		for i, child := range t.opts.Children {
+			ids[i] = child
+		}
+		return respond(req, http.StatusOK, page(req, ids))
+	case path == "/mssp/entities/children/GET/v2":
+		ids, _ := body["ids"].([]interface{})
+		children := make([]interface{}, 0, len(ids))
+		for i, id := range ids {
+			children = append(children, map[string]interface{}{"child_cid": id, "name": fmt.Sprintf("Simulated Child %d", i+1)})
+		}
+		return respond(req, http.StatusOK, resources(children...))
+	case path == "/devices/queries/devices/v1":
+		return t.queryDevices(req)
+	case path == "/devices/queries/devices-scroll/v1":
+		return t.scrollDevices(req)
+	case path == "/devices/entities/devices/v2":
+		return t.devices(req, body)
+	case path == "/policy/queries/sensor-update/v1":
+		return respond(req, http.StatusOK, resources("simulated-sensor-update-policy"))
+	case path == "/policy/combined/reveal-uninstall-token/v1":
+		return t.uninstallToken(req, body)
+	case path == "/samples/entities/samples/v2":
+		return t.uploadSample(req, data)
+	case path == "/samples/entities/samples/v3":
+		return t.sample(req)
+	case path == "/falconx/queries/submissions/v1":
+		return t.querySubmissions(req)
+	case path == "/falconx/entities/submissions/v1":
+		return t.sandboxSubmission(req, body)
+	case path == "/falconx/entities/report-summaries/v1":
+		return t.sandboxReportSummaries(req)
+	case path == "/real-time-response-audit/combined/sessions/v1":
+		return t.auditSessions(req)
+	case path == "/real-time-response/queries/sessions/v1":
+		return respond(req, http.StatusOK, resources())
+	case path == "/real-time-response/entities/sessions/GET/v1":
+		return t.sessionDetails(req, body)
+	case path == "/real-time-response/entities/sessions/v1", path == "/real-time-response/entities/refresh-session/v1":
+		return t.session(req, body)
+	case path == "/real-time-response/queries/put-files/v1":
+		t.mu.Lock()
+		ids := make([]interface{}, 0, len(t.putFiles))
+		for id := range t.putFiles {
+			ids = append(ids, id)
+		}
+		t.mu.Unlock()
+		sort.Slice(ids, func(i, j int) bool { return ids[i].(string) < ids[j].(string) })
+		return respond(req, http.StatusOK, page(req, ids))
+	case path == "/real-time-response/entities/put-files/v1":
+		return t.putFile(req, data)
+	case path == "/real-time-response/queries/scripts/v1":
+		return t.queryScripts(req)
+	case path == "/real-time-response/entities/scripts/v1":
+		return t.cloudScript(req, data)
+	case strings.HasSuffix(path, "command/v1") && strings.HasPrefix(path, "/real-time-response/entities/"):
+		if req.Method == http.MethodPost {
+			return t.issue(req, body)
+		}
+		return t.status(req)
+	}
+	return respond(req, http.StatusNotFound, errorBody(fmt.Sprintf("%s %s is not simulated", req.Method, path)))
+}
+
+// token issues a token, for a child CID when member_cid names one.
+func (t *Transport) token(req *http.Request, data []byte) (*http.Response, error) {
+	form, _ := url.ParseQuery(string(data))
+	token := "simulated-token"
+	if member := form.Get("member_cid"); member != "" {
+		known := false
+		for _, child := range t.opts.Children {
+			known = known || strings.EqualFold(strings.SplitN(child, "-", 2)[0], member)
+		}
+		if !known {
+			return respond(req, http.StatusForbidden, errorBody(fmt.Sprintf("member_cid %s is not a child of this tenant", member)))
+		}
+		token += ":" + member
+	}
+	return respond(req, http.StatusCreated, map[string]interface{}{"access_token": token, "token_type": "bearer", "expires_in": 1799})
+}
+
+func (t *Transport) session(req *http.Request, body map[string]interface{}) (*http.Response, error) {
+	if req.Method == http.MethodDelete {
+		t.mu.Lock()
+		delete(t.sessions, req.URL.Query().Get("session_id"))
+		t.mu.Unlock()
+		return respond(req, http.StatusNoContent, nil)
+	}
+
+	deviceID, _ := body["device_id"].(string)
+	device, ok := t.device(deviceID)
+	if !ok || device.Stale {
+		return respond(req, http.StatusNotFound, errorBody(fmt.Sprintf("device %s not found", deviceID)))
+	}
+	if device.Offline {
+		return respond(req, http.StatusNotFound, errorBody("Could not establish sensor comms: host is offline"))
+	}
+
+	t.mu.Lock()
+	sessionID := t.id()
+	t.sessions[sessionID] = device
+	t.mu.Unlock()
+	return respond(req, http.StatusCreated, resources(map[string]interface{}{"session_id": sessionID, "device_id": device.ID}))
+}
+
+var (
+	identifierFilter = regexp.MustCompile(`(serial_number|mac_address|hostname):\[(.*)\]`)
+	quotedValue      = regexp.MustCompile(`'((?:[^'\\]|\\.)*)'`)
+)
+
+// queryDevices lists the simulated device IDs. A serial_number:[...],
+// mac_address:[...] or hostname:[...] filter is evaluated; any other filter
+// is ignored.
+func (t *Transport) queryDevices(req *http.Request) (*http.Response, error) {
+	var field string
+	values := map[string]bool{}
+	if match := identifierFilter.FindStringSubmatch(req.URL.Query().Get("filter")); match != nil {
+		field = match[1]
+		for _, value := range quotedValue.FindAllStringSubmatch(match[2], -1) {
+			values[strings.ToLower(value[1])] = true
+		}
+	}
+	ids := make([]interface{}, 0, len(t.opts.Devices))
+	for _, device := range t.opts.Devices {
+		switch field {
+		case "serial_number":
+			if !values[strings.ToLower(device.SerialNumber)] {
+				continue
+			}
+		case "mac_address":
+			if !values[strings.ToLower(device.MACAddress)] {
+				continue
+			}
+		case "hostname":
+			if !values[strings.ToLower(device.Hostname)] {
+				continue
+			}
+		}
+		ids = append(ids, device.ID)
+	}
+	return respond(req, http.StatusOK, page(req, ids))
+}
+
+// simulatedOSVersions are the OS versions simulated devices report by
+// platform.
+var simulatedOSVersions = map[string]string{"windows": "Windows 11", "linux": "Ubuntu 22.04", "mac": "macOS 14"}
+
+// scrollDevices pages through every simulated device as the scroll query
+// does: the offset parameter is the token of the previous page. The filter
+// is not evaluated.
+func (t *Transport) scrollDevices(req *http.Request) (*http.Response, error) {
+	query := req.URL.Query()
+	start, _ := strconv.Atoi(strings.TrimPrefix(query.Get("offset"), "sim-scroll-"))
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = len(t.opts.Devices)
+	}
+	start = min(max(start, 0), len(t.opts.Devices))
+	end := min(start+limit, len(t.opts.Devices))
+	ids := make([]interface{}, 0, end-start)
+	for _, device := range t.opts.Devices[start:end] {
+		ids = append(ids, device.ID)
+	}
+	body := resources(ids...)
+	body["meta"] = map[string]interface{}{
+		"pagination": map[string]interface{}{"offset": fmt.Sprintf("sim-scroll-%d", end), "limit": limit, "total": len(t.opts.Devices), "expires_at": time.Now().Add(2 * time.Minute).UnixNano()},
+	}
+	return respond(req, http.StatusOK, body)
+}
+
+// devices returns the details of the requested simulated devices.
+func (t *Transport) devices(req *http.Request, body map[string]interface{}) (*http.Response, error) {
+	ids, _ := body["ids"].([]interface{})
+	details := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		idString, _ := id.(string)
+		if device, ok := t.device(idString); ok {
+			details = append(details, map[string]interface{}{
+				"device_id":     device.ID,
+				"hostname":      device.Hostname,
+				"platform_name": device.Platform,
+				"serial_number": device.SerialNumber,
+				"mac_address":   device.MACAddress,
+				"os_version":    simulatedOSVersions[device.Platform],
+				"agent_version": "7.18.0-sim",
+				"status":        "normal",
+				"tags":          []interface{}{"SensorGroupingTags/simulated"},
+			})
+		}
+	}
+	return respond(req, http.StatusOK, resources(details...))
+}
+
+// uninstallToken reveals a simulated uninstall token, derived from the
+// device ID so it is the same on every run.
+func (t *Transport) uninstallToken(req *http.Request, body map[string]interface{}) (*http.Response, error) {
+	deviceID, _ := body["device_id"].(string)
+	if audit, _ := body["audit_message"].(string); deviceID == "" || audit == "" {
+		return respond(req, http.StatusBadRequest, errorBody("device_id and audit_message are required"))
+	}
+	if _, ok := t.device(deviceID); !ok {
+		return respond(req, http.StatusNotFound, errorBody(fmt.Sprintf("device %s not found", deviceID)))
+	}
+	sum := sha256.Sum256([]byte("uninstall-token:" + deviceID))
+	return respond(req, http.StatusOK, resources(map[string]interface{}{"device_id": deviceID, "uninstall_token": hex.EncodeToString(sum[:8])}))
+}
+
+// auditSessions lists a live session held by another user on every busy
+// device. The filter is not evaluated; callers match device IDs themselves.
+func (t *Transport) auditSessions(req *http.Request) (*http.Response, error) {
+	var sessions []interface{}
+	now := time.Now().UTC()
+	for _, device := range t.opts.Devices {
+		if device.BusyWith == "" {
+			continue
+		}
+		sessions = append(sessions, map[string]interface{}{
+			"id":         "busy-" + device.ID,
+			"device_id":  device.ID,
+			"hostname":   device.Hostname,
+			"user_name":  device.BusyWith,
+			"created_at": now.Add(-time.Minute).Format(time.RFC3339),
+			"updated_at": now.Format(time.RFC3339),
+		})
+	}
+	return respond(req, http.StatusOK, page(req, sessions))
+}
+
+// putFile creates, describes or deletes put-files.
+func (t *Transport) putFile(req *http.Request, data []byte) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch req.Method {
+	case http.MethodPost:
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		name := ""
+		if err := req.ParseMultipartForm(1 << 20); err == nil {
+			name = req.FormValue("name")
+		}
+		if name == "" {
+			return respond(req, http.StatusBadRequest, errorBody("put-file name is required"))
+		}
+		for _, existing := range t.putFiles {
+			if existing == name {
+				return respond(req, http.StatusConflict, errorBody(fmt.Sprintf("put-file %s already exists", name)))
+			}
+		}
+		id := t.id()
+		t.putFiles[id] = name
+		return respond(req, http.StatusOK, resources(map[string]interface{}{"id": id, "name": name}))
+	case http.MethodDelete:
+		delete(t.putFiles, req.URL.Query().Get("ids"))
+		return respond(req, http.StatusOK, resources())
+	}
+	var files []interface{}
+	for _, id := range req.URL.Query()["ids"] {
+		if name, ok := t.putFiles[id]; ok {
+			files = append(files, map[string]interface{}{"id": id, "name": name, "created_by": "simulated-client"})
+		}
+	}
+	return respond(req, http.StatusOK, resources(files...))
+}
+
+var scriptNameFilter = regexp.MustCompile(`name:'((?:[^'\\]|\\.)*)'`)
+
+// queryScripts lists the IDs of the cloud scripts, only the one named by a
+// name:'...' filter when there is one.
+func (t *Transport) queryScripts(req *http.Request) (*http.Response, error) {
+	name, filtered := "", false
+	if match := scriptNameFilter.FindStringSubmatch(req.URL.Query().Get("filter")); match != nil {
+		name, filtered = strings.NewReplacer(`\'`, "'", `\\`, `\`).Replace(match[1]), true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := []interface{}{}
+	for id, script := range t.scripts {
+		if !filtered || script.name == name {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].(string) < ids[j].(string) })
+	return respond(req, http.StatusOK, page(req, ids))
+}
+
+// cloudScript creates, updates, describes or deletes cloud scripts.
+func (t *Transport) cloudScript(req *http.Request, data []byte) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch req.Method {
+	case http.MethodPost, http.MethodPatch:
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		if err := req.ParseMultipartForm(1 << 20); err != nil {
+			return respond(req, http.StatusBadRequest, errorBody("expected a multipart form"))
+		}
+		id := req.FormValue("id")
+		current, exists := t.scripts[id]
+		if req.Method == http.MethodPost {
+			for _, existing := range t.scripts {
+				if existing.name == req.FormValue("name") {
+					return respond(req, http.StatusConflict, errorBody(fmt.Sprintf("script %s already exists", existing.name)))
+				}
+			}
+			id, current, exists = t.id(), script{}, true
+		}
+		if !exists {
+			return respond(req, http.StatusNotFound, errorBody(fmt.Sprintf("script %s not found", id)))
+		}
+		for field, value := range map[string]*string{"name": &current.name, "content": &current.content, "description": &current.description, "platform": &current.platform, "permission_type": &current.permissionType} {
+			if v := req.FormValue(field); v != "" {
+				*value = v
+			}
+		}
+		if current.name == "" {
+			return respond(req, http.StatusBadRequest, errorBody("script name is required"))
+		}
+		t.scripts[id] = current
+		return respond(req, http.StatusOK, resources())
+	case http.MethodDelete:
+		delete(t.scripts, req.URL.Query().Get("ids"))
+		return respond(req, http.StatusOK, resources())
+	}
+	var scripts []interface{}
+	for _, id := range req.URL.Query()["ids"] {
+		script, ok := t.scripts[id]
+		if !ok {
+			continue
+		}
+		sum := sha256.Sum256([]byte(script.content))
+		scripts = append(scripts, map[string]interface{}{
+			"id":              id,
+			"name":            script.name,
+			"content":         script.content,
+			"sha256":          hex.EncodeToString(sum[:]),
+			"description":     script.description,
+			"permission_type": script.permissionType,
+			"platform":        []interface{}{script.platform},
+			"created_by":      "simulated-client",
+		})
+	}
+	return respond(req, http.StatusOK, resources(scripts...))
+}
+
+func (t *Transport) issue(req *http.Request, body map[string]interface{}) (*http.Response, error) {
+	sessionID, _ := body["session_id"].(string)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	device, ok := t.sessions[sessionID]
+	if !ok {
+		return respond(req, http.StatusNotFound, errorBody(fmt.Sprintf("session %s not found", sessionID)))
+	}
+	cloudRequestID := t.id()
+	cmd := command{device: device, sessionID: sessionID, createdAt: time.Now().UTC()}
+	cmd.baseCommand, _ = body["base_command"].(string)
+	cmd.commandString, _ = body["command_string"].(string)
+	t.commands[cloudRequestID] = cmd
+	if key := scriptKey(cmd); t.ambiguous(key) && !t.dropped[key] {
+		t.dropped[key] = true
+		return nil, fmt.Errorf("simulated dropped connection after accepting %s", key)
+	}
+	return respond(req, http.StatusCreated, resources(map[string]interface{}{"cloud_request_id": cloudRequestID, "session_id": sessionID}))
+}
+
+// ambiguous reports whether key is listed in Ambiguous.
+func (t *Transport) ambiguous(key string) bool {
+	for _, name := range t.opts.Ambiguous {
+		if name == key {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionDetails describes sessions with the log of commands issued on them.
+func (t *Transport) sessionDetails(req *http.Request, body map[string]interface{}) (*http.Response, error) {
+	ids, _ := body["ids"].([]interface{})
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var sessions []interface{}
+	for _, id := range ids {
+		sessionID, _ := id.(string)
+		device, ok := t.sessions[sessionID]
+		if !ok {
+			continue
+		}
+		logs := []interface{}{}
+		for cloudRequestID, cmd := range t.commands {
+			if cmd.sessionID == sessionID {
+				logs = append(logs, map[string]interface{}{
+					"base_command":     cmd.baseCommand,
+					"command_string":   cmd.commandString,
+					"cloud_request_id": cloudRequestID,
+					"created_at":       cmd.createdAt.Format(time.RFC3339Nano),
+				})
+			}
+		}
+		sessions = append(sessions, map[string]interface{}{"id": sessionID, "device_id": device.ID, "logs": logs})
+	}
+	return respond(req, http.StatusOK, resources(sessions...))
+}
+
+func (t *Transport) status(req *http.Request) (*http.Response, error) {
+	query := req.URL.Query()
+	t.mu.Lock()
+	cmd, ok := t.commands[query.Get("cloud_request_id")]
+	t.mu.Unlock()
+	if !ok {
+		return respond(req, http.StatusNotFound, errorBody("cloud request not found"))
+	}
+	if query.Get("sequence_id") != "" && query.Get("sequence_id") != "0" {
+		return respond(req, http.StatusNotFound, errorBody("no further sequences"))
+	}
+	resource := map[string]interface{}{
+		"complete":     true,
+		"base_command": cmd.baseCommand,
+		"stdout":       t.output(cmd),
+		"stderr":       "",
+	}
+	if interval := t.opts.LineInterval; interval > 0 {
+		lines := strings.SplitAfter(t.output(cmd), "\n")
+		if shown := int(time.Since(cmd.createdAt) / interval); shown < len(lines) {
+			resource["complete"], resource["stdout"] = false, strings.Join(lines[:shown], "")
+		}
+	}
+	if message, ok := t.opts.Errors[scriptKey(cmd)]; ok {
+		resource["stdout"] = ""
+		resource["errors"] = []interface{}{map[string]interface{}{"code": 40006, "message": message}}
+	}
+	if message := platformError(cmd); message != "" {
+		resource["complete"], resource["stdout"], resource["stderr"] = true, "", message
+		resource["errors"] = []interface{}{map[string]interface{}{"code": 40006, "message": message}}
+	}
+	return respond(req, http.StatusOK, resources(resource))
+}
+
+// windowsOnlyCommands are refused by the simulated Linux and macOS sensors.
+var windowsOnlyCommands = []string{"encrypt", "eventlog", "getsid", "ipconfig", "map", "memdump", "put-and-run", "reg", "unmap", "update", "xmemdump", "zip"}
+
+// platformError returns the error a Linux or macOS sensor reports for a
+// Windows-only command or a PowerShell script, and a Windows sensor for
+// ifconfig, or "" when the device's platform runs cmd.
+func platformError(cmd command) string {
+	switch strings.ToLower(cmd.device.Platform) {
+	case "linux", "mac":
+		if slices.Contains(windowsOnlyCommands, cmd.baseCommand) {
+			return fmt.Sprintf("Command '%s' is not supported on this platform", cmd.baseCommand)
+		}
+		if strings.HasSuffix(strings.ToLower(scriptKey(cmd)), ".ps1") {
+			return fmt.Sprintf("/bin/sh: %s: PowerShell scripts are not supported on this platform", scriptKey(cmd))
+		}
+	case "windows":
+		if cmd.baseCommand == "ifconfig" {
+			return "Command 'ifconfig' is not supported on this platform"
+		}
+	}
+	return ""
+}
+
+// scriptKey names a command in Outputs and Errors: its cloud script name, or
+// its base command.
+func scriptKey(cmd command) string {
+	if match := cloudFilePattern.FindStringSubmatch(cmd.commandString); match != nil {
+		return match[1]
+	}
+	return cmd.baseCommand
+}
+
+// output renders the scripted stdout for a command.
+func (t *Transport) output(cmd command) string {
+	output, ok := t.opts.Outputs[scriptKey(cmd)]
+	if !ok {
+		output = fmt.Sprintf("Simulated output of '%s' on {{hostname}}\n", cmd.commandString)
+	}
+	return strings.NewReplacer(
+		"{{hostname}}", cmd.device.Hostname,
+		"{{device_id}}", cmd.device.ID,
+		"{{platform}}", cmd.device.Platform,
+	).Replace(output)
+}
+
+func (t *Transport) device(id string) (Device, bool) {
+	for _, device := range t.opts.Devices {
+		if device.ID == id {
+			return device, true
+		}
+	}
+	return Device{}, false
+}
+
+// delay sleeps between half and one and a half times the configured latency.
+func (t *Transport) delay(req *http.Request) error {
+	if t.opts.Latency <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	wait := t.opts.Latency/2 + time.Duration(t.rand.Int63n(int64(t.opts.Latency)+1))
+	t.mu.Unlock()
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// chance reports true with probability rate.
+func (t *Transport) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rand.Float64() < rate
+}
+
+// id returns a seeded pseudo-random identifier. The caller holds t.mu.
+func (t *Transport) id() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x", t.rand.Uint32(), t.rand.Intn(0x10000), t.rand.Intn(0x10000), t.rand.Intn(0x10000), t.rand.Int63n(1<<48))
+}
+
+func resources(items ...interface{}) map[string]interface{} {
+	return map[string]interface{}{"resources": append([]interface{}{}, items...), "errors": []interface{}{}}
+}
+
+// page returns the part of a query's results the request's offset and
+// limit select, with the pagination meta the API reports.
+func page(req *http.Request, items []interface{}) map[string]interface{} {
+	query := req.URL.Query()
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = len(items)
+	}
+	offset = min(max(offset, 0), len(items))
+	body := resources(items[offset:min(offset+limit, len(items))]...)
+	body["meta"] = map[string]interface{}{
+		"pagination": map[string]interface{}{"offset": offset, "limit": limit, "total": len(items)},
+	}
+	return body
+}
+
+func errorBody(message string) map[string]interface{} {
+	return map[string]interface{}{"resources": []interface{}{}, "errors": []interface{}{map[string]interface{}{"message": message}}}
+}
+
+// traces numbers the trace IDs of simulated responses.
+var traces atomic.Int64
+
+// respond encodes body, adding the meta every API response carries.
+func respond(req *http.Request, status int, body interface{}) (*http.Response, error) {
+	if object, ok := body.(map[string]interface{}); ok {
+		meta, _ := object["meta"].(map[string]interface{})
+		if meta == nil {
+			meta = map[string]interface{}{}
+			object["meta"] = meta
+		}
+		meta["query_time"] = 0.001
+		meta["powered_by"] = "simulate"
+		meta["trace_id"] = fmt.Sprintf("00000000-0000-4000-8000-%012x", traces.Add(1))
+	}
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
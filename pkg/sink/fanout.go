@@ -0,0 +1,271 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds a single delivery to one sink when the spec sets none.
+const DefaultTimeout = 30 * time.Second
+
+// DeliveryStatus aggregates the delivery outcomes of one sink over a run.
+// For a Buffered sink, Delivered counts the deliveries it accepted, and
+// Flushed and Dropped how many of those Shutdown wrote out and lost.
+type DeliveryStatus struct {
+	Sink      string `json:"sink"`
+	Delivered int    `json:"delivered"`
+	Failed    int    `json:"failed"`
+	Flushed   int    `json:"flushed,omitempty"`
+	Dropped   int    `json:"dropped,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+
+	Storage *Storage `json:"storage,omitempty"` // What a sink storing on local disk wrote
+}
+
+// Storage accounts for what a sink stored on local disk: the bytes it was
+// given and the bytes it wrote for them, which are fewer when it compresses.
+type Storage struct {
+	Encoding    string `json:"encoding,omitempty"` // zstd or gzip; "" stores as given
+	Files       int    `json:"files"`              // Deliveries stored
+	Bytes       int64  `json:"bytes"`              // Before compression
+	StoredBytes int64  `json:"stored_bytes"`       // On disk
+}
+
+// StorageReporter is implemented by sinks that store deliveries on local
+// disk; Status reports their storage with their delivery status.
+type StorageReporter interface {
+	Storage() Storage
+}
+
+type resultEntry struct {
+	sink    ResultSink
+	timeout time.Duration
+}
+
+type artifactEntry struct {
+	sink    ArtifactSink
+	timeout time.Duration
+}
+
+// FanOut delivers every result and artifact to all configured sinks concurrently.
+// Each sink gets its own timeout, and a failing or hung sink never blocks the others.
+type FanOut struct {
+	results   []resultEntry
+	artifacts []artifactEntry
+
+	mu        sync.Mutex
+	status    map[string]*DeliveryStatus
+	lifecycle []*bufferedEntry // Buffered sinks, started and shut down by Start and Shutdown
+	storage   map[string]StorageReporter
+	slots     chan struct{} // Deliveries in flight across all sinks; nil is one per sink
+}
+
+// NewFanOut returns an empty FanOut; add sinks with AddResultSink and AddArtifactSink.
+func NewFanOut() *FanOut {
+	return &FanOut{status: map[string]*DeliveryStatus{}}
+}
+
+// AddResultSink registers s with the given per-delivery timeout (DefaultTimeout if zero).
+func (f *FanOut) AddResultSink(s ResultSink, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	f.results = append(f.results, resultEntry{sink: s, timeout: timeout})
+	f.statusFor(s.Name())
+	f.addBuffered(s, true)
+	f.addStorage(s)
+}
+
+// AddArtifactSink registers s with the given per-delivery timeout (DefaultTimeout if zero).
+func (f *FanOut) AddArtifactSink(s ArtifactSink, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	f.artifacts = append(f.artifacts, artifactEntry{sink: s, timeout: timeout})
+	f.statusFor(s.Name())
+	f.addBuffered(s, false)
+	f.addStorage(s)
+}
+
+// addStorage registers s for storage accounting when it reports storage.
+func (f *FanOut) addStorage(s interface{ Name() string }) {
+	reporter, ok := s.(StorageReporter)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.storage == nil {
+		f.storage = map[string]StorageReporter{}
+	}
+	f.storage[s.Name()] = reporter
+}
+
+// LimitDeliveries caps the deliveries in flight at once across all sinks
+// at n (concurrency.sink_deliveries); the others wait their turn, which
+// does not count against their timeout. n <= 0 removes the cap.
+func (f *FanOut) LimitDeliveries(n int) {
+	f.slots = nil
+	if n > 0 {
+		f.slots = make(chan struct{}, n)
+	}
+}
+
+// Empty reports whether no sinks are configured.
+func (f *FanOut) Empty() bool {
+	return len(f.results) == 0 && len(f.artifacts) == 0
+}
+
+// DeliverResult sends result to every result sink and returns the per-sink errors.
+func (f *FanOut) DeliverResult(ctx context.Context, result *Result) map[string]error {
+	calls := make([]deliveryCall, 0, len(f.results))
+	for _, entry := range f.results {
+		entry := entry
+		calls = append(calls, deliveryCall{
+			name:    entry.sink.Name(),
+			timeout: entry.timeout,
+			deliver: func(ctx context.Context) error { return entry.sink.DeliverResult(ctx, result) },
+		})
+	}
+	return f.deliverAll(ctx, calls)
+}
+
+// DeliverArtifact sends artifact to every artifact sink and returns the per-sink errors.
+func (f *FanOut) DeliverArtifact(ctx context.Context, artifact *Artifact) map[string]error {
+	calls := make([]deliveryCall, 0, len(f.artifacts))
+	for _, entry := range f.artifacts {
+		entry := entry
+		calls = append(calls, deliveryCall{
+			name:    entry.sink.Name(),
+			timeout: entry.timeout,
+			deliver: func(ctx context.Context) error { return entry.sink.DeliverArtifact(ctx, artifact) },
+		})
+	}
+	return f.deliverAll(ctx, calls)
+}
+
+// Status returns the aggregated delivery status of every sink, sorted by sink name.
+func (f *FanOut) Status() []DeliveryStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	statuses := make([]DeliveryStatus, 0, len(f.status))
+	for _, s := range f.status {
+		status := *s
+		if reporter := f.storage[status.Sink]; reporter != nil {
+			storage := reporter.Storage()
+			status.Storage = &storage
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Sink < statuses[j].Sink })
+	return statuses
+}
+
+// FormatDeliveryStatus renders status as "n delivered, n failed", adding the
+// flushed and dropped counts of Buffered sinks when there are any, and what
+// a sink storing on local disk stored.
+func FormatDeliveryStatus(status DeliveryStatus) string {
+	text := fmt.Sprintf("%d delivered, %d failed", status.Delivered, status.Failed)
+	if status.Flushed > 0 || status.Dropped > 0 {
+		text += fmt.Sprintf(", %d flushed, %d dropped", status.Flushed, status.Dropped)
+	}
+	if storage := status.Storage; storage != nil && storage.Encoding != "" {
+		text += fmt.Sprintf(", %d bytes stored as %d (%s)", storage.Bytes, storage.StoredBytes, storage.Encoding)
+	} else if storage != nil {
+		text += fmt.Sprintf(", %d bytes stored", storage.StoredBytes)
+	}
+	return text
+}
+
+type deliveryCall struct {
+	name    string
+	timeout time.Duration
+	deliver func(ctx context.Context) error
+}
+
+// deliverAll runs every call concurrently and waits for each to finish or time out.
+func (f *FanOut) deliverAll(ctx context.Context, calls []deliveryCall) map[string]error {
+	errs := map[string]error{}
+	var errsMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, call := range calls {
+		wg.Add(1)
+		go func(call deliveryCall) {
+			defer wg.Done()
+			if f.slots != nil {
+				f.slots <- struct{}{}
+				defer func() { <-f.slots }()
+			}
+			err := runWithTimeout(ctx, call.timeout, call.deliver)
+			if err != nil {
+				err = fmt.Errorf("sink %s: %w", call.name, err)
+				errsMu.Lock()
+				errs[call.name] = err
+				errsMu.Unlock()
+			}
+			f.record(call.name, err)
+		}(call)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// runWithTimeout returns when deliver finishes or the timeout expires, whichever
+// comes first, so a sink that ignores its context cannot stall the fan-out.
+func runWithTimeout(ctx context.Context, timeout time.Duration, deliver func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic during delivery: %v", r)
+			}
+		}()
+		done <- deliver(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("delivery timed out after %s: %w", timeout, ctx.Err())
+	}
+}
+
+func (f *FanOut) statusFor(name string) *DeliveryStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.status[name]
+	if !ok {
+		s = &DeliveryStatus{Sink: name}
+		f.status[name] = s
+	}
+	return s
+}
+
+func (f *FanOut) record(name string, err error) {
+	s := f.statusFor(name)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		s.Failed++
+		s.LastError = err.Error()
+		return
+	}
+	s.Delivered++
+	for _, entry := range f.lifecycle {
+		if entry.name == name {
+			entry.pending++
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDrainTimeout bounds FanOut.Shutdown when sink_drain_timeout is unset.
+const DefaultDrainTimeout = 30 * time.Second
+
+// Buffered is implemented by sinks that hold deliveries before writing them
+// out, such as batching HTTP collectors, message queues or multipart
+// uploads. A FanOut starts them before the first delivery and flushes and
+// closes them in Shutdown, so a run that ends, or is interrupted, does not
+// lose the tail of its data. Sinks that write each delivery at once need not
+// implement it.
+type Buffered interface {
+	// Start prepares the sink, e.g. opens connections, before any delivery.
+	Start(ctx context.Context) error
+	// Flush writes out the buffered deliveries and returns how many it
+	// wrote. It must stop when ctx is done.
+	Flush(ctx context.Context) (int, error)
+	// Close releases the sink. Deliveries not flushed by then are lost.
+	Close(ctx context.Context) error
+}
+
+// bufferedEntry is a Buffered sink and the deliveries it accepted that have
+// not been flushed yet.
+type bufferedEntry struct {
+	name    string
+	sink    Buffered
+	results bool // A result sink, flushed before artifact-only sinks
+	pending int
+}
+
+// addBuffered registers s for Start and Shutdown when it is Buffered, once
+// even when it is both a result and an artifact sink.
+func (f *FanOut) addBuffered(s interface{ Name() string }, results bool) {
+	b, ok := s.(Buffered)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, entry := range f.lifecycle {
+		if entry.name == s.Name() {
+			entry.results = entry.results || results
+			return
+		}
+	}
+	f.lifecycle = append(f.lifecycle, &bufferedEntry{name: s.Name(), sink: b, results: results})
+}
+
+// Start starts every Buffered sink, each within its delivery timeout, and
+// returns the first failure.
+func (f *FanOut) Start(ctx context.Context) error {
+	for _, entry := range f.lifecycle {
+		sink := entry.sink
+		err := runWithTimeout(ctx, f.timeoutFor(entry.name), func(ctx context.Context) error { return sink.Start(ctx) })
+		if err != nil {
+			return fmt.Errorf("sink %s: failed to start: %w", entry.name, err)
+		}
+	}
+	return nil
+}
+
+// Shutdown flushes every Buffered sink within timeout (DefaultDrainTimeout
+// if zero), then closes each within its delivery timeout, and records in
+// Status how many deliveries each flushed and dropped. Result sinks flush
+// first, so a report built after Shutdown carries their delivery status;
+// artifact-only sinks flush next, and then every sink is closed. A sink
+// whose Flush overruns the drain deadline is abandoned rather than closed
+// under it, and its unflushed deliveries count as dropped. Call it once,
+// when no more deliveries will be made; ctx is usually not the run's
+// context, which a signal has already cancelled.
+func (f *FanOut) Shutdown(ctx context.Context, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+	drainCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var resultSinks, artifactSinks []*bufferedEntry
+	for _, entry := range f.lifecycle {
+		if entry.results {
+			resultSinks = append(resultSinks, entry)
+		} else {
+			artifactSinks = append(artifactSinks, entry)
+		}
+	}
+	var abandonedMu sync.Mutex
+	abandoned := map[*bufferedEntry]bool{}
+	for _, group := range [][]*bufferedEntry{resultSinks, artifactSinks} {
+		f.eachBuffered(drainCtx, group, func(ctx context.Context, entry *bufferedEntry) {
+			// An abandoned Flush may still report after the deadline.
+			var flushed atomic.Int64
+			var returned atomic.Bool
+			err := runWithDeadline(ctx, func(ctx context.Context) error {
+				n, err := entry.sink.Flush(ctx)
+				flushed.Store(int64(n))
+				returned.Store(true)
+				return err
+			})
+			if !returned.Load() {
+				abandonedMu.Lock()
+				abandoned[entry] = true
+				abandonedMu.Unlock()
+			}
+			f.recordFlush(entry, int(flushed.Load()), err)
+		})
+	}
+	f.eachBuffered(ctx, append(resultSinks, artifactSinks...), func(ctx context.Context, entry *bufferedEntry) {
+		if abandoned[entry] {
+			f.recordClose(entry, nil)
+			return
+		}
+		f.recordClose(entry, runWithTimeout(ctx, f.timeoutFor(entry.name), entry.sink.Close))
+	})
+}
+
+// eachBuffered runs call for every entry concurrently and waits for all.
+func (f *FanOut) eachBuffered(ctx context.Context, entries []*bufferedEntry, call func(ctx context.Context, entry *bufferedEntry)) {
+	var wg sync.WaitGroup
+	for _, entry := range entries {
+		wg.Add(1)
+		go func(entry *bufferedEntry) {
+			defer wg.Done()
+			call(ctx, entry)
+		}(entry)
+	}
+	wg.Wait()
+}
+
+// runWithDeadline is runWithTimeout bounded only by the deadline of ctx.
+func runWithDeadline(ctx context.Context, call func(ctx context.Context) error) error {
+	deadline, _ := ctx.Deadline()
+	return runWithTimeout(ctx, time.Until(deadline), call)
+}
+
+// timeoutFor returns the delivery timeout of the named sink.
+func (f *FanOut) timeoutFor(name string) time.Duration {
+	for _, entry := range f.results {
+		if entry.sink.Name() == name {
+			return entry.timeout
+		}
+	}
+	for _, entry := range f.artifacts {
+		if entry.sink.Name() == name {
+			return entry.timeout
+		}
+	}
+	return DefaultTimeout
+}
+
+// recordFlush records the outcome of flushing entry.
+func (f *FanOut) recordFlush(entry *bufferedEntry, flushed int, err error) {
+	s := f.statusFor(entry.name)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	flushed = min(max(flushed, 0), entry.pending)
+	entry.pending -= flushed
+	s.Flushed += flushed
+	if err != nil {
+		s.LastError = fmt.Sprintf("flush: %v", err)
+	}
+}
+
+// recordClose records the outcome of closing entry; whatever it had not
+// flushed is dropped.
+func (f *FanOut) recordClose(entry *bufferedEntry, err error) {
+	s := f.statusFor(entry.name)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s.Dropped += entry.pending
+	entry.pending = 0
+	if err != nil {
+		s.LastError = fmt.Sprintf("close: %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventLog records the lifecycle calls of the test sinks in order.
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *eventLog) list() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.events...)
+}
+
+// bufferedSink is a Buffered result and artifact sink that holds every
+// delivery until Flush, which writes them out the way flush says.
+type bufferedSink struct {
+	name  string
+	log   *eventLog
+	flush func(ctx context.Context, held int) (int, error) // nil writes out all it holds
+	close func(ctx context.Context) error
+
+	mu     sync.Mutex
+	held   int
+	closed bool
+}
+
+func (s *bufferedSink) Name() string { return s.name }
+
+func (s *bufferedSink) DeliverResult(ctx context.Context, result *Result) error {
+	return s.deliver()
+}
+
+func (s *bufferedSink) DeliverArtifact(ctx context.Context, artifact *Artifact) error {
+	return s.deliver()
+}
+
+func (s *bufferedSink) deliver() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held++
+	return nil
+}
+
+func (s *bufferedSink) Start(ctx context.Context) error {
+	if s.log != nil {
+		s.log.add("start " + s.name)
+	}
+	return nil
+}
+
+func (s *bufferedSink) Flush(ctx context.Context) (int, error) {
+	if s.log != nil {
+		s.log.add("flush " + s.name)
+	}
+	s.mu.Lock()
+	held := s.held
+	s.mu.Unlock()
+	if s.flush == nil {
+		return held, nil
+	}
+	return s.flush(ctx, held)
+}
+
+func (s *bufferedSink) Close(ctx context.Context) error {
+	if s.log != nil {
+		s.log.add("close " + s.name)
+	}
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	if s.close == nil {
+		return nil
+	}
+	return s.close(ctx)
+}
+
+// hang blocks until the test ends, ignoring its context like a sink stuck
+// on a dead connection.
+func hang(t *testing.T) func() {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	return func() { <-release }
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	const drain, deliveryTimeout = 50 * time.Millisecond, 100 * time.Millisecond
+	tests := []struct {
+		name        string
+		flush       func(t *testing.T) func(ctx context.Context, held int) (int, error)
+		close       func(t *testing.T) func(ctx context.Context) error
+		wantFlushed int
+		wantDropped int
+		wantErr     string
+		wantClosed  bool
+	}{
+		{
+			name:        "flushes in time",
+			wantFlushed: 3,
+			wantClosed:  true,
+		},
+		{
+			name: "ignores the deadline",
+			flush: func(t *testing.T) func(ctx context.Context, held int) (int, error) {
+				wait := hang(t)
+				return func(ctx context.Context, held int) (int, error) {
+					wait()
+					return held, nil
+				}
+			},
+			wantDropped: 3,
+			wantErr:     "flush: delivery timed out",
+		},
+		{
+			name: "flushes part",
+			flush: func(t *testing.T) func(ctx context.Context, held int) (int, error) {
+				return func(ctx context.Context, held int) (int, error) { return 1, errors.New("batch rejected") }
+			},
+			wantFlushed: 1,
+			wantDropped: 2,
+			wantErr:     "flush: batch rejected",
+			wantClosed:  true,
+		},
+		{
+			name: "reports more than it held",
+			flush: func(t *testing.T) func(ctx context.Context, held int) (int, error) {
+				return func(ctx context.Context, held int) (int, error) { return held + 10, nil }
+			},
+			wantFlushed: 3,
+			wantClosed:  true,
+		},
+		{
+			name: "fails to flush",
+			flush: func(t *testing.T) func(ctx context.Context, held int) (int, error) {
+				return func(ctx context.Context, held int) (int, error) { return 0, errors.New("broker unavailable") }
+			},
+			wantDropped: 3,
+			wantErr:     "flush: broker unavailable",
+			wantClosed:  true,
+		},
+		{
+			name: "close hangs",
+			close: func(t *testing.T) func(ctx context.Context) error {
+				wait := hang(t)
+				return func(ctx context.Context) error {
+					wait()
+					return nil
+				}
+			},
+			wantFlushed: 3,
+			wantErr:     "close: delivery timed out after 100ms",
+			wantClosed:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slow := &bufferedSink{name: "slow"}
+			if test.flush != nil {
+				slow.flush = test.flush(t)
+			}
+			if test.close != nil {
+				slow.close = test.close(t)
+			}
+			fast := &bufferedSink{name: "fast"}
+			fanOut := NewFanOut()
+			fanOut.AddResultSink(slow, deliveryTimeout)
+			fanOut.AddResultSink(fast, deliveryTimeout)
+			if err := fanOut.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3; i++ {
+				if errs := fanOut.DeliverResult(context.Background(), &Result{DeviceID: "d"}); len(errs) > 0 {
+					t.Fatal(errs)
+				}
+			}
+
+			started := time.Now()
+			fanOut.Shutdown(context.Background(), drain)
+			if elapsed := time.Since(started); elapsed > drain+deliveryTimeout+time.Second {
+				t.Errorf("Shutdown took %s with a %s drain timeout", elapsed, drain)
+			}
+			slow.mu.Lock()
+			closed := slow.closed
+			slow.mu.Unlock()
+			if closed != test.wantClosed {
+				t.Errorf("slow sink closed = %t, want %t", closed, test.wantClosed)
+			}
+
+			statuses := map[string]DeliveryStatus{}
+			for _, status := range fanOut.Status() {
+				statuses[status.Sink] = status
+			}
+			got := statuses["slow"]
+			if got.Delivered != 3 || got.Flushed != test.wantFlushed || got.Dropped != test.wantDropped {
+				t.Errorf("slow sink delivered %d, flushed %d, dropped %d; want 3, %d, %d",
+					got.Delivered, got.Flushed, got.Dropped, test.wantFlushed, test.wantDropped)
+			}
+			if test.wantErr == "" && got.LastError != "" || !strings.Contains(got.LastError, test.wantErr) {
+				t.Errorf("slow sink error = %q, want one containing %q", got.LastError, test.wantErr)
+			}
+			if other := statuses["fast"]; other.Flushed != 3 || other.Dropped != 0 || other.LastError != "" || !fast.closed {
+				t.Errorf("fast sink = %+v, want all 3 flushed and closed next to a slow one", other)
+			}
+		})
+	}
+}
+
+func TestShutdownDefaultDrainTimeout(t *testing.T) {
+	fanOut := NewFanOut()
+	var deadline time.Time
+	fanOut.AddResultSink(&bufferedSink{name: "queue", flush: func(ctx context.Context, held int) (int, error) {
+		deadline, _ = ctx.Deadline()
+		return held, nil
+	}}, 0)
+	started := time.Now()
+	fanOut.Shutdown(context.Background(), 0)
+	if remaining := deadline.Sub(started); remaining < DefaultDrainTimeout-time.Second || remaining > DefaultDrainTimeout+time.Second {
+		t.Errorf("Flush deadline %s after Shutdown, want about %s", remaining, DefaultDrainTimeout)
+	}
+}
+
+func TestShutdownOrder(t *testing.T) {
+	log := &eventLog{}
+	results := &bufferedSink{name: "results", log: log}
+	artifacts := &bufferedSink{name: "artifacts", log: log}
+	fanOut := NewFanOut()
+	fanOut.AddArtifactSink(artifacts, 0)
+	fanOut.AddResultSink(results, 0)
+	// Also an artifact sink: it flushes with the result sinks, and only once.
+	fanOut.AddArtifactSink(results, 0)
+
+	if err := fanOut.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	fanOut.Shutdown(context.Background(), time.Second)
+
+	events := log.list()
+	wantStart := []string{"start artifacts", "start results"}
+	if !reflect.DeepEqual(events[:2], wantStart) {
+		t.Errorf("start events = %q, want %q", events[:2], wantStart)
+	}
+	wantFlush := []string{"flush results", "flush artifacts"}
+	if !reflect.DeepEqual(events[2:4], wantFlush) {
+		t.Errorf("flush events = %q, want %q", events[2:4], wantFlush)
+	}
+	closes := append([]string(nil), events[4:]...)
+	if len(closes) != 2 || closes[0] == closes[1] || !strings.HasPrefix(closes[0], "close ") || !strings.HasPrefix(closes[1], "close ") {
+		t.Errorf("close events = %q, want each sink closed once after every flush", closes)
+	}
+}
+
+func TestStartFailure(t *testing.T) {
+	fanOut := NewFanOut()
+	fanOut.AddResultSink(startFailingSink{&bufferedSink{name: "queue"}}, time.Second)
+	err := fanOut.Start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "sink queue: failed to start: connection refused") {
+		t.Errorf("Start error = %v", err)
+	}
+}
+
+type startFailingSink struct{ *bufferedSink }
+
+func (startFailingSink) Start(ctx context.Context) error { return errors.New("connection refused") }
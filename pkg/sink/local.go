@@ -0,0 +1,269 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/compression"
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/naming"
+)
+
+func init() {
+	RegisterResultSink("file", newFileSink)
+	RegisterArtifactSink("directory", newDirectorySink)
+}
+
+// FileSink appends each result as one JSON line to a local file. With the
+// compression setting, zstd or gzip, the lines of a run are appended as one
+// compressed stream, and the path gets the encoding's extension, e.g.
+// results.jsonl.zst; the stream of each run reads back after the ones
+// before it as one file. The file is opened on the first delivery and held
+// open for the run: the sink is Buffered, so Shutdown flushes and closes it.
+type FileSink struct {
+	name     string
+	path     string
+	encoding string
+
+	mu       sync.Mutex
+	file     *os.File
+	stored   *compression.Counter // Counts what reaches file
+	w        compression.Writer
+	unsynced int // Lines written since the last Flush
+	storage  Storage
+}
+
+func newFileSink(spec Spec) (ResultSink, error) {
+	path, err := spec.StringSetting("path", true)
+	if err != nil {
+		return nil, err
+	}
+	encoding, err := compressionSetting(spec)
+	if err != nil {
+		return nil, err
+	}
+	if ext := compression.Ext(encoding); !strings.HasSuffix(path, ext) {
+		path += ext
+	}
+	return &FileSink{name: spec.Name, path: path, encoding: encoding, storage: Storage{Encoding: encoding}}, nil
+}
+
+// compressionSetting returns the compression setting of a local sink.
+func compressionSetting(spec Spec) (string, error) {
+	encoding, err := spec.StringSetting("compression", false)
+	if err != nil {
+		return "", err
+	}
+	if err := compression.Check(encoding); err != nil {
+		return "", fmt.Errorf("setting \"compression\": %w", err)
+	}
+	return encoding, nil
+}
+
+// Name returns the configured sink name.
+func (s *FileSink) Name() string { return s.name }
+
+// DeliverResult appends result to the file as a JSON line.
+func (s *FileSink) DeliverResult(ctx context.Context, result *Result) error {
+	line, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.w == nil {
+		file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", s.path, err)
+		}
+		stored := &compression.Counter{W: file}
+		w, err := compression.NewWriter(stored, s.encoding)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		s.file, s.stored, s.w = file, stored, w
+	}
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.path, err)
+	}
+	s.unsynced++
+	s.storage.Files++
+	s.storage.Bytes += int64(len(line) + 1)
+	return nil
+}
+
+// Start does nothing; the file is opened on the first delivery.
+func (s *FileSink) Start(ctx context.Context) error { return nil }
+
+// Flush writes out the lines the compressor holds and returns how many.
+func (s *FileSink) Flush(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		return 0, nil
+	}
+	if err := s.w.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", s.path, err)
+	}
+	flushed := s.unsynced
+	s.unsynced = 0
+	return flushed, nil
+}
+
+// Close finishes the compressed stream and closes the file.
+func (s *FileSink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		return nil
+	}
+	err := s.w.Close()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.storage.StoredBytes += s.stored.N
+	s.file, s.stored, s.w = nil, nil, nil
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Storage returns what the sink appended to its file in this run.
+func (s *FileSink) Storage() Storage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	storage := s.storage
+	if s.stored != nil {
+		storage.StoredBytes += s.stored.N
+	}
+	return storage
+}
+
+// DirectorySink copies artifacts into <path>/<run_id>/<device_id>/<name>,
+// with the artifact's metadata, when it has any, in <name>.metadata.json.
+// With the compression setting, zstd or gzip, an artifact is compressed as
+// it is copied, to <name>.zst or <name>.gz. A file already there is never
+// overwritten; the name gets a numbered suffix (see createUnique).
+type DirectorySink struct {
+	name     string
+	path     string
+	encoding string
+
+	mu      sync.Mutex
+	storage Storage
+}
+
+func newDirectorySink(spec Spec) (ArtifactSink, error) {
+	path, err := spec.StringSetting("path", true)
+	if err != nil {
+		return nil, err
+	}
+	encoding, err := compressionSetting(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &DirectorySink{name: spec.Name, path: path, encoding: encoding, storage: Storage{Encoding: encoding}}, nil
+}
+
+// Name returns the configured sink name.
+func (s *DirectorySink) Name() string { return s.name }
+
+// DeliverArtifact copies the artifact file into the sink directory.
+func (s *DirectorySink) DeliverArtifact(ctx context.Context, artifact *Artifact) error {
+	dir := filepath.Join(s.path, artifact.RunID, artifact.DeviceID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	src, err := os.Open(artifact.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open artifact: %w", err)
+	}
+	defer src.Close()
+
+	dst, dstPath, err := createUnique(dir, naming.Sanitize(filepath.Base(artifact.Name)), compression.Ext(s.encoding))
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	stored := &compression.Counter{W: dst}
+	w, err := compression.NewWriter(stored, s.encoding)
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(w, &contextReader{ctx: ctx, r: src})
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy artifact to %s: %w", dstPath, err)
+	}
+	s.mu.Lock()
+	s.storage.Files++
+	s.storage.Bytes += size
+	s.storage.StoredBytes += stored.N
+	s.mu.Unlock()
+	if artifact.Metadata != nil {
+		data, err := json.MarshalIndent(artifact.Metadata, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode artifact metadata: %w", err)
+		}
+		if err := os.WriteFile(dstPath+".metadata.json", data, 0600); err != nil {
+			return fmt.Errorf("failed to write artifact metadata: %w", err)
+		}
+	}
+	return nil
+}
+
+// createUnique creates name, with ext appended, in dir. A file already
+// there is never overwritten: the name gets a -1, -2... suffix before its
+// extension instead, as names from the naming templates do.
+func createUnique(dir, name, ext string) (*os.File, string, error) {
+	stem, nameExt := strings.TrimSuffix(name, filepath.Ext(name)), filepath.Ext(name)
+	for i := 0; ; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = fmt.Sprintf("%s-%d%s", stem, i, nameExt)
+		}
+		path := naming.Portable(dir, candidate+ext)
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			return file, path, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, "", fmt.Errorf("failed to create %s: %w", path, err)
+		}
+	}
+}
+
+// Storage returns what the sink copied into its directory in this run.
+func (s *DirectorySink) Storage() Storage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.storage
+}
+
+// contextReader stops a copy once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,60 @@
+package sink
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// TimeFormat is how reports write timestamps: in UTC, always with three
+// fractional digits, so that two reports line up when diffed. Maps in
+// reports need nothing of the kind, as encoding/json sorts their keys.
+const TimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// FormatTime formats t in UTC with TimeFormat.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// SortWarnings orders warnings by code, then device ID and message.
+func SortWarnings(warnings []Warning) {
+	sort.SliceStable(warnings, func(i, j int) bool {
+		a, b := warnings[i], warnings[j]
+		if a.Code != b.Code {
+			return a.Code < b.Code
+		}
+		if a.DeviceID != b.DeviceID {
+			return a.DeviceID < b.DeviceID
+		}
+		return a.Message < b.Message
+	})
+}
+
+// SortResourceErrors orders errors by code, then message.
+func SortResourceErrors(errs []ResourceError) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Code != errs[j].Code {
+			return errs[i].Code < errs[j].Code
+		}
+		return errs[i].Message < errs[j].Message
+	})
+}
+
+// MarshalJSON writes the result with CollectedAt in TimeFormat.
+func (r Result) MarshalJSON() ([]byte, error) {
+	type plain Result
+	return json.Marshal(struct {
+		plain
+		CollectedAt string `json:"collected_at"`
+	}{plain(r), FormatTime(r.CollectedAt)})
+}
+
+// MarshalJSON writes the stage with its times in TimeFormat.
+func (s Stage) MarshalJSON() ([]byte, error) {
+	type plain Stage
+	return json.Marshal(struct {
+		plain
+		StartedAt   string `json:"started_at"`
+		CompletedAt string `json:"completed_at"`
+	}{plain(s), FormatTime(s.StartedAt), FormatTime(s.CompletedAt)})
+}
@@ -0,0 +1,122 @@
+package sink
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatTime(t *testing.T) {
+	tests := []struct {
+		name string
+		time time.Time
+		want string
+	}{
+		{"whole second", time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), "2026-03-01T12:00:00.000Z"},
+		{"nanoseconds truncated", time.Date(2026, 3, 1, 12, 0, 0, 123987654, time.UTC), "2026-03-01T12:00:00.123Z"},
+		{"zone converted to UTC", time.Date(2026, 3, 1, 14, 30, 0, 5e6, time.FixedZone("CEST", 2*3600+30*60)), "2026-03-01T12:00:00.005Z"},
+		{"zero", time.Time{}, "0001-01-01T00:00:00.000Z"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := FormatTime(test.time); got != test.want {
+				t.Errorf("FormatTime = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSortWarnings(t *testing.T) {
+	warnings := []Warning{
+		{Code: WarningSinkFailed, DeviceID: "b", Message: "second"},
+		{Code: WarningCIDUnknown, Message: "run"},
+		{Code: WarningSinkFailed, DeviceID: "a", Message: "z"},
+		{Code: WarningSinkFailed, DeviceID: "b", Message: "first"},
+		{Code: WarningHookFailed, DeviceID: "c", Message: "hook"},
+	}
+	SortWarnings(warnings)
+	want := []Warning{
+		{Code: WarningCIDUnknown, Message: "run"},
+		{Code: WarningHookFailed, DeviceID: "c", Message: "hook"},
+		{Code: WarningSinkFailed, DeviceID: "a", Message: "z"},
+		{Code: WarningSinkFailed, DeviceID: "b", Message: "first"},
+		{Code: WarningSinkFailed, DeviceID: "b", Message: "second"},
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("sorted warnings = %+v, want %+v", warnings, want)
+	}
+}
+
+func TestSortResourceErrors(t *testing.T) {
+	errs := []ResourceError{{Code: 500, Message: "b"}, {Code: 404, Message: "not found"}, {Code: 500, Message: "a"}}
+	SortResourceErrors(errs)
+	want := []ResourceError{{Code: 404, Message: "not found"}, {Code: 500, Message: "a"}, {Code: 500, Message: "b"}}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("sorted errors = %+v, want %+v", errs, want)
+	}
+}
+
+func TestStagesInStartOrder(t *testing.T) {
+	start := time.Now()
+	timing := &Timing{}
+	timing.Add(Stage{Name: "command_wait", StartedAt: start.Add(2 * time.Second)})
+	timing.Add(Stage{Name: "session_init", StartedAt: start})
+	timing.Add(Stage{Name: "command_issue", StartedAt: start.Add(time.Second)})
+	timing.Add(Stage{Name: "command_status", StartedAt: start.Add(2 * time.Second)})
+
+	var names []string
+	for _, stage := range timing.Stages() {
+		names = append(names, stage.Name)
+	}
+	want := []string{"session_init", "command_issue", "command_wait", "command_status"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("stages = %q, want %q (ties kept in the order added)", names, want)
+	}
+}
+
+func TestReportJSONIsStable(t *testing.T) {
+	zone := time.FixedZone("EST", -5*3600)
+	result := Result{
+		DeviceID:    "a",
+		CollectedAt: time.Date(2026, 3, 1, 7, 0, 0, 999999999, zone),
+		Stages: []Stage{{
+			Name:        "session_init",
+			StartedAt:   time.Date(2026, 3, 1, 7, 0, 0, 1, zone),
+			CompletedAt: time.Date(2026, 3, 1, 7, 0, 1, 0, zone),
+			DurationMS:  1000,
+		}},
+		APICalls: map[string]int{"status_polls": 3, "auth": 1, "sessions": 2, "commands": 1},
+		Labels:   map[string]string{"zone": "eu", "owner": "soc", "app": "web"},
+	}
+	first, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		again, err := json.Marshal(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(again) != string(first) {
+			t.Fatalf("result serialized differently:\n%s\n%s", first, again)
+		}
+	}
+
+	report := string(first)
+	for _, want := range []string{
+		`"collected_at":"2026-03-01T12:00:00.999Z"`,
+		`"started_at":"2026-03-01T12:00:00.000Z"`,
+		`"completed_at":"2026-03-01T12:00:01.000Z"`,
+		`"api_calls":{"auth":1,"commands":1,"sessions":2,"status_polls":3}`,
+		`"labels":{"app":"web","owner":"soc","zone":"eu"}`,
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("result JSON lacks %s:\n%s", want, report)
+		}
+	}
+	if strings.Count(report, `"collected_at"`) != 1 || strings.Count(report, `"started_at"`) != 1 {
+		t.Errorf("times written twice:\n%s", report)
+	}
+}
@@ -0,0 +1,156 @@
+package sink
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spec describes one configured sink: its registered type, an optional unique
+// name (defaults to the type), an optional delivery timeout, and type-specific settings.
+type Spec struct {
+	Type     string                 `json:"type" yaml:"type"`
+	Name     string                 `json:"name,omitempty" yaml:"name,omitempty"`
+	Timeout  string                 `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Settings map[string]interface{} `json:"settings,omitempty" yaml:"settings,omitempty"`
+}
+
+// ResultSinkFactory builds a ResultSink from a spec.
+type ResultSinkFactory func(spec Spec) (ResultSink, error)
+
+// ArtifactSinkFactory builds an ArtifactSink from a spec.
+type ArtifactSinkFactory func(spec Spec) (ArtifactSink, error)
+
+var (
+	registryMu        sync.RWMutex
+	resultFactories   = map[string]ResultSinkFactory{}
+	artifactFactories = map[string]ArtifactSinkFactory{}
+)
+
+// RegisterResultSink makes a result sink type available to Build.
+// Downstream users call it from an init function to add custom sink types.
+func RegisterResultSink(sinkType string, factory ResultSinkFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	resultFactories[sinkType] = factory
+}
+
+// RegisterArtifactSink makes an artifact sink type available to Build.
+func RegisterArtifactSink(sinkType string, factory ArtifactSinkFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	artifactFactories[sinkType] = factory
+}
+
+// RegisteredTypes lists every registered sink type, sorted.
+func RegisteredTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return sortedKeys()
+}
+
+// Build constructs a FanOut from specs. A type registered as both a result and
+// an artifact sink is added to both sides of the fan-out.
+func Build(specs []Spec) (*FanOut, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	fanOut := NewFanOut()
+	names := map[string]bool{}
+	for i, spec := range specs {
+		if spec.Type == "" {
+			return nil, fmt.Errorf("sinks[%d]: type is required", i)
+		}
+		if spec.Name == "" {
+			spec.Name = spec.Type
+		}
+		if names[spec.Name] {
+			return nil, fmt.Errorf("sinks[%d]: duplicate sink name %q", i, spec.Name)
+		}
+		names[spec.Name] = true
+
+		var timeout time.Duration
+		if spec.Timeout != "" {
+			parsed, err := time.ParseDuration(spec.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("sinks[%d]: invalid timeout %q: %w", i, spec.Timeout, err)
+			}
+			timeout = parsed
+		}
+
+		resultFactory, isResult := resultFactories[spec.Type]
+		artifactFactory, isArtifact := artifactFactories[spec.Type]
+		if !isResult && !isArtifact {
+			return nil, fmt.Errorf("sinks[%d]: unknown sink type %q (registered: %s)", i, spec.Type, strings.Join(sortedKeys(), ", "))
+		}
+		if isResult {
+			s, err := resultFactory(spec)
+			if err != nil {
+				return nil, fmt.Errorf("sinks[%d] (%s): %w", i, spec.Name, err)
+			}
+			fanOut.AddResultSink(s, timeout)
+		}
+		if isArtifact {
+			s, err := artifactFactory(spec)
+			if err != nil {
+				return nil, fmt.Errorf("sinks[%d] (%s): %w", i, spec.Name, err)
+			}
+			fanOut.AddArtifactSink(s, timeout)
+		}
+	}
+	return fanOut, nil
+}
+
+// sortedKeys is RegisteredTypes for callers already holding registryMu.
+func sortedKeys() []string {
+	seen := map[string]bool{}
+	for t := range resultFactories {
+		seen[t] = true
+	}
+	for t := range artifactFactories {
+		seen[t] = true
+	}
+	types := make([]string, 0, len(seen))
+	for t := range seen {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Under returns a copy of the spec whose relative path setting, as used by
+// the local file and directory sinks, is resolved under dir.
+func (s Spec) Under(dir string) Spec {
+	path, ok := s.Settings["path"].(string)
+	if !ok || path == "" || filepath.IsAbs(path) {
+		return s
+	}
+	settings := make(map[string]interface{}, len(s.Settings))
+	for key, value := range s.Settings {
+		settings[key] = value
+	}
+	settings["path"] = filepath.Join(dir, path)
+	s.Settings = settings
+	return s
+}
+
+// StringSetting returns a string setting, or an error naming the sink when a
+// required setting is missing or has the wrong type.
+func (s Spec) StringSetting(key string, required bool) (string, error) {
+	value, ok := s.Settings[key]
+	if !ok {
+		if required {
+			return "", fmt.Errorf("setting %q is required", key)
+		}
+		return "", nil
+	}
+	str, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("setting %q must be a string", key)
+	}
+	return str, nil
+}
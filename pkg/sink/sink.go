@@ -0,0 +1,188 @@
+// Package sink delivers per-host results and retrieved artifacts to the
+// configured destinations, and times the stages of a run.
+package sink
+
+import (
+	"context"
+	"time"
+)
+
+// Result is a per-host structured command result delivered to ResultSinks.
+type Result struct {
+	RunID          string                 `json:"run_id,omitempty"`
+	CID            string                 `json:"cid,omitempty"`
+	DeviceID       string                 `json:"device_id"`
+	SessionID      string                 `json:"session_id,omitempty"`
+	CloudRequestID string                 `json:"cloud_request_id,omitempty"`
+	Endpoint       string                 `json:"endpoint,omitempty"` // Command endpoint the script was issued through
+	Status         string                 `json:"status"`
+	Stdout         string                 `json:"stdout,omitempty"`
+	Stderr         string                 `json:"stderr,omitempty"`
+	FailureReason  string                 `json:"failure_reason,omitempty"`
+	Errors         []ResourceError        `json:"errors,omitempty"`          // Errors the command reported in a successful status response
+	TimeoutSeconds int                    `json:"timeout_seconds,omitempty"` // Effective runscript -Timeout
+	Iterations     int                    `json:"iterations,omitempty"`      // Script runs merged into the result (continuation)
+	HeldBy         string                 `json:"held_by,omitempty"`         // Who holds the live session a busy host was skipped for
+	Normalization  []string               `json:"normalization,omitempty"`
+	Redactions     map[string]int         `json:"redactions,omitempty"` // Matches redacted from the output, by rule
+	Error          string                 `json:"error,omitempty"`
+	Hint           string                 `json:"hint,omitempty"` // How to fix the classified failure, unless --no-hints
+	CollectedAt    time.Time              `json:"collected_at"`
+	Stages         []Stage                `json:"stages,omitempty"`
+	DurationMS     int64                  `json:"duration_ms,omitempty"`
+	APICalls       map[string]int         `json:"api_calls,omitempty"`
+	Approval       string                 `json:"approval,omitempty"`  // Change-control reference the run was approved under
+	Receipt        *ReceiptStatus         `json:"receipt,omitempty"`   // Outcome of placing the on-host receipt
+	Warnings       []Warning              `json:"warnings,omitempty"`  // Conditions worth tracking that did not fail the host
+	Metadata       *Metadata              `json:"metadata,omitempty"`  // Case, operator and reason the run was made for
+	Target         *TargetMapping         `json:"target,omitempty"`    // Inventory identifier the device was resolved from
+	Replaced       *Replacement           `json:"replaced,omitempty"`  // Stale device ID the host was collected from under a new one for
+	Resources      *HostResources         `json:"resources,omitempty"` // Free disk and memory found by the prerequisites probe
+	Clock          *HostClock             `json:"clock,omitempty"`     // Host clock skew and timezone (host_clock)
+	Circuit        *CircuitState          `json:"circuit,omitempty"`   // Why the circuit breaker stopped attempting the device
+	Labels         map[string]string      `json:"labels,omitempty"`    // Added by hooks, e.g. the owner from a CMDB
+	Hooks          []HookOutcome          `json:"hooks,omitempty"`     // Host hooks called for the host
+	Artifacts      []ArtifactFindings     `json:"artifacts,omitempty"`
+	Raw            map[string]interface{} `json:"raw,omitempty"`
+}
+
+// Finding is one result of post-processing a retrieved file: a hash, a
+// strings extraction or a YARA rule match.
+type Finding struct {
+	Processor string `json:"processor"`
+	Name      string `json:"name"`             // e.g. sha256, strings_file or yara_match
+	Value     string `json:"value"`            // e.g. the digest, the sidecar path or the rule name
+	Detail    string `json:"detail,omitempty"` // e.g. the strings count or the matched rule's tags
+}
+
+// ArtifactFindings are the post-processing findings of one retrieved file.
+// Incomplete is set when a processor failed; Errors says which and why.
+type ArtifactFindings struct {
+	Path       string    `json:"path"`
+	RemotePath string    `json:"remote_path,omitempty"`
+	SHA256     string    `json:"sha256,omitempty"`
+	Findings   []Finding `json:"findings,omitempty"`
+	Incomplete bool      `json:"incomplete,omitempty"`
+	Errors     []string  `json:"errors,omitempty"`
+}
+
+// ResourceError is one entry of the errors array of an RTR status
+// resource: the API call succeeded but the command failed on the host.
+type ResourceError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Target resolution statuses of a TargetMapping.
+const (
+	TargetResolved  = "resolved"
+	TargetAmbiguous = "ambiguous"
+	TargetUnmatched = "unmatched"
+)
+
+// TargetMapping traces a target device back to the serial number or MAC
+// address it was resolved from, and where that identifier was given. An
+// ambiguous identifier lists every matching device in Matches and is not
+// targeted; an unmatched one has no device.
+type TargetMapping struct {
+	Kind       string   `json:"kind"`       // serial or mac
+	Identifier string   `json:"identifier"` // As given
+	Source     string   `json:"source"`     // e.g. target.serials[0] or inventory.txt:14
+	Status     string   `json:"status"`
+	DeviceID   string   `json:"device_id,omitempty"`
+	Hostname   string   `json:"hostname,omitempty"`
+	Matches    []string `json:"matches,omitempty"`
+}
+
+// HostResources are the free disk space on Volume and the free memory a
+// prerequisites probe found on a host. A value the probe did not report
+// is -1.
+type HostResources struct {
+	Volume          string `json:"volume"`
+	FreeDiskBytes   int64  `json:"free_disk_bytes"`
+	FreeMemoryBytes int64  `json:"free_memory_bytes"`
+}
+
+// Replacement records a host whose device ID was no longer found, e.g.
+// after a sensor reinstall, and that was collected from under DeviceID, the
+// device its identifier resolved to once more.
+type Replacement struct {
+	StaleDeviceID string `json:"stale_device_id"`
+	DeviceID      string `json:"device_id"`
+	Kind          string `json:"kind"` // serial, mac or hostname
+	Identifier    string `json:"identifier"`
+}
+
+// Metadata attributes a run to a case and an operator. Policy can require
+// each field; see config.MetadataPolicy.
+type Metadata struct {
+	CaseID    string `json:"case_id,omitempty"`
+	Operator  string `json:"operator,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	TicketURL string `json:"ticket_url,omitempty"`
+}
+
+// HostClock is the host's clock as read at session start. SkewMS is how
+// far the host's clock is ahead of the collector's (negative when behind),
+// give or take UncertaintyMS; subtract it from host-side timestamps to
+// line them up with the report's.
+type HostClock struct {
+	HostTime      string `json:"host_time"`            // As the host read it, in UTC
+	Timezone      string `json:"timezone,omitempty"`   // e.g. Europe/Berlin, or W. Europe Standard Time on Windows
+	UTCOffset     string `json:"utc_offset,omitempty"` // e.g. +0200
+	SkewMS        int64  `json:"skew_ms"`
+	UncertaintyMS int64  `json:"uncertainty_ms"`
+}
+
+// CircuitState is why the circuit breaker stopped attempting a device:
+// Failures attempts in a row failed with the failure class Class.
+// QuarantinedUntil is when the device's quarantine ends, if it is
+// quarantined.
+type CircuitState struct {
+	Class            string `json:"class"`
+	Failures         int    `json:"failures"`
+	QuarantinedUntil string `json:"quarantined_until,omitempty"`
+}
+
+// HookOutcome is the outcome of one call of a registered hook; see
+// package hooks.
+type HookOutcome struct {
+	Hook       string `json:"hook"`
+	Point      string `json:"point"`  // pre_run, host_pre, host_post or post_run
+	Status     string `json:"status"` // ok, failed, timeout, panic or vetoed
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// ReceiptStatus is the outcome of placing a signed collection receipt on
+// the host. A failed receipt does not fail the host's collection.
+type ReceiptStatus struct {
+	Path   string `json:"path"`
+	Status string `json:"status"` // "placed" or "failed"
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Artifact is a file retrieved from (or produced for) a host, stored locally at Path.
+type Artifact struct {
+	RunID    string `json:"run_id,omitempty"`
+	Name     string `json:"name"`
+	DeviceID string `json:"device_id"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256,omitempty"`
+
+	Metadata *Metadata `json:"metadata,omitempty"` // Object metadata for stores that keep it
+}
+
+// ResultSink receives per-host structured results.
+type ResultSink interface {
+	Name() string
+	DeliverResult(ctx context.Context, result *Result) error
+}
+
+// ArtifactSink receives files and blobs.
+type ArtifactSink interface {
+	Name() string
+	DeliverArtifact(ctx context.Context, artifact *Artifact) error
+}
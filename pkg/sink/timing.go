@@ -0,0 +1,92 @@
+package sink
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stage is the timing of one step of a host's collection. StartedAt and
+// CompletedAt are UTC wall-clock times (RFC3339 in JSON); DurationMS is
+// measured on the monotonic clock, so it is unaffected by clock changes.
+type Stage struct {
+	Name        string    `json:"name"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+	DurationMS  int64     `json:"duration_ms"`
+}
+
+// Duration returns the stage's monotonic duration.
+func (s Stage) Duration() time.Duration {
+	return time.Duration(s.DurationMS) * time.Millisecond
+}
+
+// Timing collects the stages of one host's collection. The zero value is
+// ready to use and safe for concurrent use.
+type Timing struct {
+	mu      sync.Mutex
+	started time.Time
+	elapsed time.Duration
+	stages  []Stage
+}
+
+// Start begins a stage and returns the function that ends it.
+func (t *Timing) Start(name string) func() {
+	start := time.Now()
+	return func() { t.Record(name, start) }
+}
+
+// Record adds a stage that began at start and ends now. start must come from
+// time.Now so that it carries a monotonic clock reading.
+func (t *Timing) Record(name string, start time.Time) {
+	elapsed := time.Since(start)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.started.IsZero() || start.Before(t.started) {
+		t.started = start
+	}
+	t.elapsed = max(t.elapsed, time.Since(t.started))
+	t.stages = append(t.stages, Stage{
+		Name:        name,
+		StartedAt:   start.UTC(),
+		CompletedAt: start.Add(elapsed).UTC(),
+		DurationMS:  elapsed.Milliseconds(),
+	})
+}
+
+// Add appends stages recorded elsewhere, such as by a command.
+func (t *Timing) Add(stages ...Stage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stages = append(t.stages, stages...)
+}
+
+// Stages returns the recorded stages in the order they started.
+func (t *Timing) Stages() []Stage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stages := append([]Stage(nil), t.stages...)
+	sort.SliceStable(stages, func(i, j int) bool { return stages[i].StartedAt.Before(stages[j].StartedAt) })
+	return stages
+}
+
+// Elapsed returns the time from the start of the first stage recorded
+// through Start or Record to the end of the last one.
+func (t *Timing) Elapsed() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.elapsed
+}
+
+// Percentile returns the nearest-rank p-th percentile (0-100) of durations,
+// or 0 when there are none.
+func Percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := min(max(int(math.Ceil(p/100*float64(len(sorted)))), 1), len(sorted))
+	return sorted[rank-1]
+}
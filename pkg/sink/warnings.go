@@ -0,0 +1,104 @@
+package sink
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/omkarj-metron/crowdstrike-data-collector/pkg/console"
+)
+
+// Warning codes. A warning records a condition worth tracking that does not
+// fail the host.
+const (
+	WarningSessionRefreshed     = "session_refreshed"     // A stalled command's session was refreshed
+	WarningSessionReopened      = "session_reopened"      // The session was lost and a new one opened
+	WarningScriptRetried        = "script_retried"        // The script was re-run after a retryable failure
+	WarningCommandReissued      = "command_reissued"      // A command post failed ambiguously and was adopted or re-posted
+	WarningOutputTruncated      = "output_truncated"      // Output was cut at a size limit
+	WarningOutputNotRetained    = "output_not_retained"   // Raw or original output could not be kept locally
+	WarningStdoutParseFailed    = "stdout_parse_failed"   // Stdout looked like JSON but did not parse
+	WarningHostLookupFailed     = "host_lookup_failed"    // Host details for file names were unavailable
+	WarningReceiptFailed        = "receipt_failed"        // The on-host receipt could not be placed
+	WarningSinkFailed           = "sink_failed"           // A result could not be delivered to a sink
+	WarningCIDUnknown           = "cid_unknown"           // The authenticated CID could not be determined
+	WarningScriptPinMismatch    = "script_pin_mismatch"   // A cloud script no longer matched its pinned SHA256 (security finding)
+	WarningPostProcessFailed    = "postprocess_failed"    // A processor failed on a retrieved file, whose findings are incomplete
+	WarningDeviceReplaced       = "device_replaced"       // The device ID was stale and the host was re-resolved to a new one
+	WarningPrerequisitesUnknown = "prerequisites_unknown" // The prerequisites probe failed or was not understood, and the host was collected anyway
+	WarningHookFailed           = "hook_failed"           // A registered hook failed, timed out or panicked, and the run went on
+	WarningInventoryFailed      = "inventory_failed"      // The inventory snapshot could not be taken or written
+	WarningClockCaptureFailed   = "clock_capture_failed"  // The host's clock and timezone could not be read
+	WarningQuarantineFailed     = "quarantine_failed"     // The circuit breaker's quarantine file could not be written
+	WarningContinuationLimit    = "continuation_limit"    // The script still asked to continue after continuation.max_iterations runs
+	WarningSessionNotDeleted    = "session_not_deleted"   // The host's session could not be deleted and is left to time out
+	WarningReportFailed         = "report_failed"         // The run's status report could not be written
+	WarningAuditLogFailed       = "audit_log_failed"      // A record could not be appended to the local audit log
+)
+
+// Warning is one warning raised during a run. DeviceID is empty for
+// run-level warnings.
+type Warning struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	DeviceID string `json:"device_id,omitempty"`
+}
+
+// Warnings collects the warnings of a host or a run. The zero value is
+// ready to use and safe for concurrent use; methods on a nil *Warnings do
+// nothing, so code that may run without a collector need not check.
+type Warnings struct {
+	Console *console.Console // Prints each warning as it is added; nil prints none
+
+	mu       sync.Mutex
+	warnings []Warning
+}
+
+// Add records a warning and prints it as a progress line.
+func (w *Warnings) Add(code, deviceID, format string, args ...interface{}) {
+	if w == nil {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	w.Console.Printf("Warning [%s]: %s\n", code, message)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.warnings = append(w.warnings, Warning{Code: code, Message: message, DeviceID: deviceID})
+}
+
+// List returns the recorded warnings in the order they were raised.
+func (w *Warnings) List() []Warning {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Warning(nil), w.warnings...)
+}
+
+// CountWarnings counts warnings by code.
+func CountWarnings(warnings []Warning) map[string]int {
+	if len(warnings) == 0 {
+		return nil
+	}
+	counts := map[string]int{}
+	for _, warning := range warnings {
+		counts[warning.Code]++
+	}
+	return counts
+}
+
+// FormatWarningCounts renders counts as "code=n, ..." in code order.
+func FormatWarningCounts(counts map[string]int) string {
+	codes := make([]string, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		parts[i] = fmt.Sprintf("%s=%d", code, counts[code])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,170 @@
+package vcr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// scrubbedValue replaces any secret before an interaction is written.
+const scrubbedValue = "REDACTED"
+
+// sensitiveHeaders are dropped from recorded requests and responses.
+// Content-Length is dropped too because scrubbing changes body lengths.
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Cs-Username", "Proxy-Authorization", "Content-Length"}
+
+// sensitiveKeyWords marks JSON keys, form fields and query parameters whose
+// values are secrets.
+var sensitiveKeyWords = []string{"secret", "token", "password", "authorization", "client_id", "api_key"}
+
+// identifierKeys are the fields rewritten when AnonymizeIDs is set.
+var identifierKeys = []string{"device_id", "session_id", "cloud_request_id", "cid", "aid", "hostname", "ids"}
+
+// Scrubber removes authentication material from interactions and, when
+// AnonymizeIDs is set, replaces host and session identifiers with stable
+// placeholders. The same input always yields the same placeholder, so
+// replay can apply the scrubber to live requests before matching.
+//
+// Every secret value the scrubber removes is remembered and also replaced
+// wherever it reappears, for example echoed in command output.
+type Scrubber struct {
+	AnonymizeIDs bool
+
+	mu      sync.Mutex
+	secrets map[string]bool
+}
+
+// minSecretLength keeps short values such as "0" from being treated as secrets.
+const minSecretLength = 6
+
+// Learn records a secret so it is scrubbed from every later value.
+func (s *Scrubber) Learn(secret string) {
+	if len(secret) < minSecretLength || secret == scrubbedValue {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.secrets == nil {
+		s.secrets = make(map[string]bool)
+	}
+	s.secrets[secret] = true
+}
+
+// replaceSecrets replaces every learned secret in text.
+func (s *Scrubber) replaceSecrets(text string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for secret := range s.secrets {
+		text = strings.ReplaceAll(text, secret, scrubbedValue)
+	}
+	return text
+}
+
+// Headers returns a copy of header without sensitive entries. Bearer tokens
+// found in Authorization are learned as secrets.
+func (s *Scrubber) Headers(header http.Header) http.Header {
+	if token, ok := strings.CutPrefix(header.Get("Authorization"), "Bearer "); ok {
+		s.Learn(token)
+	}
+	scrubbed := header.Clone()
+	for _, name := range sensitiveHeaders {
+		scrubbed.Del(name)
+	}
+	for name, values := range scrubbed {
+		for i, value := range values {
+			values[i] = s.replaceSecrets(value)
+		}
+		scrubbed[name] = values
+	}
+	return scrubbed
+}
+
+// Query scrubs the values of an encoded query string.
+func (s *Scrubber) Query(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return ""
+	}
+	return s.values(values).Encode()
+}
+
+// Body scrubs a JSON or form-encoded body. Other bodies are returned as is.
+func (s *Scrubber) Body(contentType string, body []byte) []byte {
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var decoded interface{}
+		if err := json.Unmarshal(body, &decoded); err == nil {
+			scrubbed, _ := json.Marshal(s.json("", decoded))
+			return []byte(s.replaceSecrets(string(scrubbed)))
+		}
+	}
+	if strings.Contains(contentType, "application/x-www-form-urlencoded") {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			return []byte(s.values(values).Encode())
+		}
+	}
+	return []byte(s.replaceSecrets(string(body)))
+}
+
+func (s *Scrubber) values(values url.Values) url.Values {
+	scrubbed := make(url.Values, len(values))
+	for key, list := range values {
+		for _, value := range list {
+			scrubbed.Add(key, s.scalar(key, value))
+		}
+	}
+	return scrubbed
+}
+
+func (s *Scrubber) json(key string, value interface{}) interface{} {
+	switch node := value.(type) {
+	case map[string]interface{}:
+		scrubbed := make(map[string]interface{}, len(node))
+		for childKey, child := range node {
+			scrubbed[childKey] = s.json(childKey, child)
+		}
+		return scrubbed
+	case []interface{}:
+		scrubbed := make([]interface{}, len(node))
+		for i, child := range node {
+			scrubbed[i] = s.json(key, child)
+		}
+		return scrubbed
+	case string:
+		return s.scalar(key, node)
+	}
+	return value
+}
+
+// scalar scrubs one value given the key it appears under.
+func (s *Scrubber) scalar(key, value string) string {
+	lowerKey := strings.ToLower(key)
+	for _, word := range sensitiveKeyWords {
+		if strings.Contains(lowerKey, word) {
+			s.Learn(value)
+			return scrubbedValue
+		}
+	}
+	if s.AnonymizeIDs && value != "" {
+		for _, idKey := range identifierKeys {
+			if lowerKey == idKey {
+				return anonymize(value)
+			}
+		}
+	}
+	return s.replaceSecrets(value)
+}
+
+// anonymize maps an identifier to a stable placeholder. Placeholders map to
+// themselves, so replayed IDs sent back by the client still match.
+func anonymize(value string) string {
+	if strings.HasPrefix(value, "anon-") {
+		return value
+	}
+	sum := sha256.Sum256([]byte(value))
+	return "anon-" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,124 @@
+package vcr
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestScrubberBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{
+			name:        "token response",
+			contentType: "application/json",
+			body:        `{"access_token":"eyJhbGciOiJSUzI1NiJ9","expires_in":1799,"token_type":"bearer"}`,
+			want:        `{"access_token":"REDACTED","expires_in":1799,"token_type":"REDACTED"}`,
+		},
+		{
+			name:        "nested and in arrays",
+			contentType: "application/json",
+			body:        `{"resources":[{"uninstall_token":"abcdef123456","device_id":"d1"}],"meta":{"api_key":"k-123456"}}`,
+			want:        `{"meta":{"api_key":"REDACTED"},"resources":[{"device_id":"d1","uninstall_token":"REDACTED"}]}`,
+		},
+		{
+			name:        "form credentials",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "client_id=myclientid&client_secret=mysecretvalue&member_cid=abc",
+			want:        "client_id=REDACTED&client_secret=REDACTED&member_cid=abc",
+		},
+		{
+			name:        "other bodies pass through",
+			contentType: "application/octet-stream",
+			body:        "plain bytes",
+			want:        "plain bytes",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var scrubber Scrubber
+			if got := string(scrubber.Body(test.contentType, []byte(test.body))); got != test.want {
+				t.Errorf("Body =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScrubberReplacesLearnedSecretsEverywhere(t *testing.T) {
+	var scrubber Scrubber
+	scrubber.Body("application/json", []byte(`{"client_secret":"hunter2hunter2"}`))
+
+	echoed := scrubber.Body("application/json", []byte(`{"resources":[{"stdout":"secret is hunter2hunter2"}]}`))
+	if strings.Contains(string(echoed), "hunter2hunter2") {
+		t.Errorf("secret echoed in JSON output survived: %s", echoed)
+	}
+	if got := string(scrubber.Body("text/plain", []byte("log: hunter2hunter2"))); got != "log: REDACTED" {
+		t.Errorf("plain body = %q", got)
+	}
+	if got := scrubber.Query("filter=hunter2hunter2"); got != "filter=REDACTED" {
+		t.Errorf("query = %q", got)
+	}
+}
+
+func TestScrubberIgnoresShortValues(t *testing.T) {
+	var scrubber Scrubber
+	scrubber.Learn("0")
+	scrubber.Learn(scrubbedValue)
+	if got := scrubber.replaceSecrets("0 REDACTED"); got != "0 REDACTED" {
+		t.Errorf("replaceSecrets = %q", got)
+	}
+}
+
+func TestScrubberHeaders(t *testing.T) {
+	var scrubber Scrubber
+	header := http.Header{
+		"Authorization":   {"Bearer tok-abcdef-123"},
+		"Cookie":          {"session=1"},
+		"X-Cs-Username":   {"analyst"},
+		"Content-Length":  {"42"},
+		"X-Echo":          {"saw tok-abcdef-123"},
+		"X-Cs-Traceid":    {"trace-1"},
+		"X-Ratelimit-Max": {"6000"},
+	}
+	scrubbed := scrubber.Headers(header)
+	for _, name := range []string{"Authorization", "Cookie", "X-Cs-Username", "Content-Length"} {
+		if scrubbed.Get(name) != "" {
+			t.Errorf("%s kept: %q", name, scrubbed.Get(name))
+		}
+	}
+	if got := scrubbed.Get("X-Echo"); got != "saw REDACTED" {
+		t.Errorf("X-Echo = %q", got)
+	}
+	if got := scrubbed.Get("X-Cs-Traceid"); got != "trace-1" {
+		t.Errorf("X-Cs-Traceid = %q", got)
+	}
+	if header.Get("Authorization") == "" {
+		t.Error("Headers modified its argument")
+	}
+}
+
+func TestScrubberAnonymizeIDs(t *testing.T) {
+	scrubber := Scrubber{AnonymizeIDs: true}
+	first := string(scrubber.Body("application/json", []byte(`{"device_id":"0123abcd","hostname":"WS-01","platform":"windows"}`)))
+	second := string(scrubber.Body("application/json", []byte(`{"device_id":"0123abcd"}`)))
+	if strings.Contains(first, "0123abcd") || strings.Contains(first, "WS-01") {
+		t.Fatalf("identifiers kept: %s", first)
+	}
+	if !strings.Contains(first, `"platform":"windows"`) {
+		t.Errorf("non-identifier changed: %s", first)
+	}
+	id := anonymize("0123abcd")
+	if !strings.Contains(first, id) || !strings.Contains(second, id) {
+		t.Errorf("device_id not mapped to %s in %s and %s", id, first, second)
+	}
+	if anonymize(id) != id {
+		t.Errorf("placeholder %s not kept as is", id)
+	}
+	if got := scrubber.Query("ids=0123abcd"); got != "ids="+id {
+		t.Errorf("query = %q, want ids=%s", got, id)
+	}
+}
@@ -0,0 +1,259 @@
+// Package vcr records API interactions to cassette files and replays them,
+// so the collector can be developed and exercised without network access.
+package vcr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Transport modes.
+const (
+	ModeRecord = "record"
+	ModeReplay = "replay"
+)
+
+// DefaultMatchFields are the JSON body fields compared during replay in
+// addition to method, path and query.
+var DefaultMatchFields = []string{"base_command", "command_string", "device_id"}
+
+// Cassette is the on-disk form of a recording.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one scrubbed request/response pair.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the part of a request used for matching.
+type RecordedRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Body   string `json:"body,omitempty"`
+}
+
+// RecordedResponse is a replayable response. Binary bodies are stored base64
+// encoded with BodyEncoding set to "base64".
+type RecordedResponse struct {
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// Options configure a Transport.
+type Options struct {
+	AnonymizeIDs bool     // Replace device, session and request IDs with stable placeholders
+	MatchFields  []string // JSON body fields compared on replay (default DefaultMatchFields)
+}
+
+// Transport is an http.RoundTripper that records interactions made through next
+// into a cassette, or serves them back from one.
+type Transport struct {
+	mode        string
+	path        string
+	next        http.RoundTripper
+	scrubber    *Scrubber
+	matchFields []string
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// New returns a recording or replaying transport for the cassette at path.
+// In record mode requests go through next (http.DefaultTransport when nil)
+// and every interaction is appended to the cassette as it completes. In
+// replay mode the cassette must exist and no request reaches the network.
+func New(mode, path string, next http.RoundTripper, opts Options) (*Transport, error) {
+	if path == "" {
+		return nil, fmt.Errorf("vcr: a cassette path is required")
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t := &Transport{
+		mode:        mode,
+		path:        path,
+		next:        next,
+		scrubber:    &Scrubber{AnonymizeIDs: opts.AnonymizeIDs},
+		matchFields: opts.MatchFields,
+	}
+	if t.matchFields == nil {
+		t.matchFields = DefaultMatchFields
+	}
+
+	switch mode {
+	case ModeRecord:
+	case ModeReplay:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("vcr: failed to read cassette: %w", err)
+		}
+		if err := json.Unmarshal(data, &t.cassette); err != nil {
+			return nil, fmt.Errorf("vcr: failed to parse cassette %s: %w", path, err)
+		}
+		t.used = make([]bool, len(t.cassette.Interactions))
+	default:
+		return nil, fmt.Errorf("vcr: mode must be %s or %s, got %q", ModeRecord, ModeReplay, mode)
+	}
+	return t, nil
+}
+
+// RoundTrip records or replays one request.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	// Learn the request's bearer token before anything is written.
+	t.scrubber.Headers(req.Header)
+	recorded := RecordedRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  t.scrubber.Query(req.URL.RawQuery),
+		Body:   string(t.scrubber.Body(req.Header.Get("Content-Type"), body)),
+	}
+
+	if t.mode == ModeReplay {
+		return t.replay(req, recorded)
+	}
+	return t.record(req, recorded)
+}
+
+func (t *Transport) record(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	response := RecordedResponse{StatusCode: resp.StatusCode, Header: t.scrubber.Headers(resp.Header)}
+	if utf8.Valid(body) {
+		response.Body = string(t.scrubber.Body(resp.Header.Get("Content-Type"), body))
+	} else {
+		response.Body = base64.StdEncoding.EncodeToString(body)
+		response.BodyEncoding = "base64"
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cassette.Interactions = append(t.cassette.Interactions, Interaction{Request: recorded, Response: response})
+	if err := t.save(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *Transport) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Interactions are consumed in order, so repeated polls of the same
+	// request get the successive recorded responses.
+	for i, interaction := range t.cassette.Interactions {
+		if t.used[i] || !t.matches(interaction.Request, recorded) {
+			continue
+		}
+		t.used[i] = true
+
+		body := []byte(interaction.Response.Body)
+		if interaction.Response.BodyEncoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(interaction.Response.Body)
+			if err != nil {
+				return nil, fmt.Errorf("vcr: interaction %d has an invalid base64 body: %w", i, err)
+			}
+			body = decoded
+		}
+		header := interaction.Response.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("vcr: no unused interaction in %s matches %s %s?%s", t.path, recorded.Method, recorded.Path, recorded.Query)
+}
+
+// matches compares method, path, query and the configured body fields.
+func (t *Transport) matches(recorded, live RecordedRequest) bool {
+	if recorded.Method != live.Method || recorded.Path != live.Path || sortedQuery(recorded.Query) != sortedQuery(live.Query) {
+		return false
+	}
+	recordedFields := bodyFields(recorded.Body, t.matchFields)
+	liveFields := bodyFields(live.Body, t.matchFields)
+	for _, field := range t.matchFields {
+		if recordedFields[field] != liveFields[field] {
+			return false
+		}
+	}
+	return true
+}
+
+// save writes the cassette atomically. The caller holds t.mu.
+func (t *Transport) save() error {
+	data, err := json.MarshalIndent(t.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("vcr: failed to marshal cassette: %w", err)
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("vcr: failed to write cassette: %w", err)
+	}
+	if err := os.Rename(tmp, t.path); err != nil {
+		return fmt.Errorf("vcr: failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// bodyFields extracts top-level JSON fields from body as compact JSON text.
+func bodyFields(body string, fields []string) map[string]string {
+	values := make(map[string]string, len(fields))
+	var decoded map[string]json.RawMessage
+	if json.Unmarshal([]byte(body), &decoded) != nil {
+		return values
+	}
+	for _, field := range fields {
+		values[field] = string(decoded[field])
+	}
+	return values
+}
+
+// sortedQuery normalizes a query string so parameter order does not matter.
+func sortedQuery(query string) string {
+	parts := strings.Split(query, "&")
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
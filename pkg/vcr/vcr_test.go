@@ -0,0 +1,158 @@
+package vcr
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// apiStub answers like the API: a token for the credentials, and the
+// output of the command posted otherwise.
+type apiStub struct{}
+
+func (apiStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	response := `{"access_token":"live-bearer-token-1","expires_in":1799}`
+	if req.URL.Path != "/oauth2/token" {
+		var command struct {
+			CommandString string `json:"command_string"`
+		}
+		json.NewDecoder(req.Body).Decode(&command)
+		output, _ := json.Marshal(map[string]interface{}{"resources": []interface{}{map[string]string{"stdout": "ran " + command.CommandString}}})
+		response = string(output)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}, "Set-Cookie": {"s=1"}},
+		Body:       io.NopCloser(strings.NewReader(response)),
+		Request:    req,
+	}, nil
+}
+
+func request(t *testing.T, transport http.RoundTripper, method, target, contentType, body string) (string, error) {
+	t.Helper()
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer live-bearer-token-1")
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return string(data), err
+}
+
+// recordCassette records a token request and two commands.
+func recordCassette(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, err := New(ModeRecord, path, apiStub{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := request(t, recorder, "POST", "https://api.test/oauth2/token", "application/x-www-form-urlencoded", "client_id=live-client-id&client_secret=live-client-secret"); err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range []string{"ls C:\\", "ps"} {
+		if _, err := request(t, recorder, "POST", "https://api.test/real-time-response/entities/command/v1", "application/json", `{"base_command":"x","command_string":"`+strings.ReplaceAll(command, `\`, `\\`)+`","session_id":"s1"}`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestRecordKeepsNoSecrets(t *testing.T) {
+	data, err := os.ReadFile(recordCassette(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"live-bearer-token-1", "live-client-id", "live-client-secret", "Set-Cookie", "Authorization"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q:\n%s", secret, data)
+		}
+	}
+}
+
+func TestReplayServesRecordedResponses(t *testing.T) {
+	player, err := New(ModeReplay, recordCassette(t), nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := request(t, player, "POST", "https://api.test/oauth2/token", "application/x-www-form-urlencoded", "client_secret=another-secret&client_id=another-id"); err != nil {
+		t.Fatalf("token request with other credentials did not match: %v", err)
+	}
+	// Out of recording order: matching is on the command, not position.
+	body, err := request(t, player, "POST", "https://api.test/real-time-response/entities/command/v1", "application/json", `{"base_command":"x","command_string":"ps","session_id":"s2"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body, `"stdout":"ran ps"`) {
+		t.Errorf("ps answered with %s", body)
+	}
+}
+
+func TestReplayMismatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{"other command", "POST", "https://api.test/real-time-response/entities/command/v1", `{"base_command":"x","command_string":"netstat"}`},
+		{"other method", "GET", "https://api.test/real-time-response/entities/command/v1", `{"base_command":"x","command_string":"ps"}`},
+		{"other path", "POST", "https://api.test/real-time-response/entities/admin-command/v1", `{"base_command":"x","command_string":"ps"}`},
+		{"other query", "POST", "https://api.test/real-time-response/entities/command/v1?sequence_id=1", `{"base_command":"x","command_string":"ps"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			player, err := New(ModeReplay, recordCassette(t), nil, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = request(t, player, test.method, test.target, "application/json", test.body)
+			if err == nil || !strings.Contains(err.Error(), "no unused interaction") {
+				t.Fatalf("err = %v, want no unused interaction", err)
+			}
+		})
+	}
+}
+
+func TestReplayUsesEachInteractionOnce(t *testing.T) {
+	player, err := New(ModeReplay, recordCassette(t), nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := `{"base_command":"x","command_string":"ps"}`
+	if _, err := request(t, player, "POST", "https://api.test/real-time-response/entities/command/v1", "application/json", ps); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := request(t, player, "POST", "https://api.test/real-time-response/entities/command/v1", "application/json", ps); err == nil {
+		t.Fatal("a used interaction was served again")
+	}
+}
+
+func TestNewRejects(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, mode, path, want string
+	}{
+		{"no path", ModeReplay, "", "a cassette path is required"},
+		{"unknown mode", "rewind", filepath.Join(dir, "c.json"), `got "rewind"`},
+		{"missing cassette", ModeReplay, filepath.Join(dir, "missing.json"), "failed to read cassette"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(test.mode, test.path, nil, Options{})
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("err = %v, want %q", err, test.want)
+			}
+		})
+	}
+}